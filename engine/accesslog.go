@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// time of a request in the access log, the same as in S3 (and Apache) access logs
+	accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+	// suffix of rotated access log files, sorts chronologically
+	rotatedAccessLogLayout = "2006-01-02T15-04-05.000"
+
+	accessLogTimeout = 5 * time.Second
+)
+
+// accessLogSink destination of the access log, each write is a single line
+type accessLogSink interface {
+	io.Writer
+	Close() error
+}
+
+// accessLogger writes access log lines asynchronously to a sink (file or syslog), so slow
+// storage never delays requests. When the buffer is full lines are dropped, and reported.
+type accessLogger struct {
+	service string
+	sink    accessLogSink
+	lines   chan string
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+func newAccessLogger(config *AccessLog, service string) (*accessLogger, error) {
+	var sink accessLogSink
+	var err error
+	if config.Syslog != nil {
+		sink, err = newSyslogSink(config.Syslog)
+	} else {
+		sink, err = newRotatingFile(*config.File, int64(config.MaxSize)*1024*1024, config.MaxBackups)
+	}
+	if err != nil {
+		return nil, err
+	}
+	al := &accessLogger{
+		service: service,
+		sink:    sink,
+		lines:   make(chan string, config.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go al.run()
+	return al, nil
+}
+
+func (al *accessLogger) run() {
+	defer close(al.done)
+	for line := range al.lines {
+		if _, err := io.WriteString(al.sink, line); err != nil {
+			log.Printf("failed to write access log: %v", err)
+		}
+		if dropped := al.dropped.Swap(0); dropped > 0 {
+			log.Printf("dropped %d access log lines, since the access log couldn't keep up", dropped)
+		}
+	}
+}
+
+// log queues the given line, without blocking
+func (al *accessLogger) log(line string) {
+	select {
+	case al.lines <- line:
+	default:
+		al.dropped.Add(1)
+	}
+}
+
+// close writes the remaining (buffered) lines and closes the sink
+func (al *accessLogger) close(ctx context.Context) {
+	close(al.lines)
+	select {
+	case <-al.done:
+	case <-ctx.Done():
+		log.Printf("access log not completely written, %d lines remaining", len(al.lines))
+	}
+	if err := al.sink.Close(); err != nil {
+		log.Printf("failed to close access log: %v", err)
+	}
+}
+
+// LogAccess middleware writes a line per request to the access log, only active when
+// the access log is enabled in the config. Should be used after middleware.RealIP.
+func (e *Engine) LogAccess(next http.Handler) http.Handler {
+	if e.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		e.accessLog.log(formatAccessLogLine(e.accessLog.service, r, ww.Status(), ww.BytesWritten(), start, time.Since(start)))
+	})
+}
+
+// formatAccessLogLine formats a request in the style of S3 server access logs. Fields are separated by
+// spaces, absent values are written as '-'. The order of the fields is stable, new fields are only appended:
+//
+//	service [time] remote-ip request-id method "request-uri" status bytes-sent total-time-ms "referer" "user-agent" host protocol route collection
+func formatAccessLogLine(service string, r *http.Request, status int, bytesSent int, start time.Time, duration time.Duration) string {
+	if status == 0 {
+		status = http.StatusOK // handler didn't write anything
+	}
+	route := ""
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && len(rctx.RoutePatterns) > 0 {
+		route = endpoint(r) // only for requests matching a route
+	}
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	fields := []string{
+		accessLogField(service),
+		"[" + start.UTC().Format(accessLogTimeLayout) + "]",
+		accessLogField(remoteIP),
+		accessLogField(middleware.GetReqID(r.Context())),
+		accessLogField(r.Method),
+		strconv.Quote(r.URL.RequestURI()),
+		strconv.Itoa(status),
+		strconv.Itoa(bytesSent),
+		strconv.FormatInt(duration.Milliseconds(), 10),
+		quotedAccessLogField(r.Referer()),
+		quotedAccessLogField(r.UserAgent()),
+		accessLogField(r.Host),
+		accessLogField(r.Proto),
+		accessLogField(route),
+		accessLogField(collectionID(r)),
+	}
+	return strings.Join(fields, " ") + "\n"
+}
+
+// accessLogField unquoted field, without whitespace so fields can't be mixed up
+func accessLogField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.Join(strings.Fields(value), "+")
+}
+
+// quotedAccessLogField quoted (and escaped) field, for values which may contain spaces or quotes
+func quotedAccessLogField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strconv.Quote(value)
+}
+
+// rotatingFile access log file which is rotated (renamed with a timestamp suffix) once it exceeds
+// the max size, only the given number of rotated files is kept
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open access log %s: %w", rf.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to open access log %s: %w", rf.path, err)
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	suffix := time.Now().UTC().Format(rotatedAccessLogLayout)
+	rotated := rf.path + "." + suffix
+	for i := 1; fileExists(rotated); i++ {
+		// rotated more than once within the same millisecond
+		rotated = fmt.Sprintf("%s.%s.%d", rf.path, suffix, i)
+	}
+	if err := os.Rename(rf.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate access log %s: %w", rf.path, err)
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	rf.removeOldBackups()
+	return nil
+}
+
+func (rf *rotatingFile) removeOldBackups() {
+	if rf.maxBackups == 0 {
+		return
+	}
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil || len(backups) <= rf.maxBackups {
+		return
+	}
+	sort.Strings(backups) // oldest first
+	for _, backup := range backups[:len(backups)-rf.maxBackups] {
+		if err = os.Remove(backup); err != nil {
+			log.Printf("failed to remove rotated access log %s: %v", backup, err)
+		}
+	}
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !plan9
+
+package engine
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+func newSyslogSink(config *AccessLogSyslog) (accessLogSink, error) {
+	writer, err := syslog.Dial(config.Network, config.Address, syslog.LOG_INFO|syslog.LOG_LOCAL0, config.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog for the access log: %w", err)
+	}
+	return writer, nil
+}
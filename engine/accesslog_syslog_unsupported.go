@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package engine
+
+import "errors"
+
+func newSyslogSink(_ *AccessLogSyslog) (accessLogSink, error) {
+	return nil, errors.New("syslog isn't supported on this platform, write the access log to a file instead")
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogAccess(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := newAccessLogger(&AccessLog{File: &file, MaxSize: 1, BufferSize: 10}, "Feats")
+	require.NoError(t, err)
+	engine := &Engine{Config: &Config{}, accessLog: accessLog}
+
+	router := chi.NewRouter()
+	router.Use(engine.LogAccess)
+	router.Get("/collections/{collectionId}/items", func(w http.ResponseWriter, _ *http.Request) {
+		SafeWrite(w.Write, []byte("{}"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/collections/foo/items?limit=2&q=a%20b", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", `curl "quoted"`)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8080/missing", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	accessLog.close(context.Background())
+
+	contents, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	require.Len(t, lines, 2)
+
+	timestamp := `\[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} \+0000\]`
+	assert.Regexp(t, regexp.MustCompile(`^Feats `+timestamp+` 10\.0\.0\.1 - GET "/collections/foo/items\?limit=2&q=a%20b" 200 2 \d+ - "curl \\"quoted\\"" localhost:8080 HTTP/1\.1 /collections/\{collectionId\}/items foo$`), lines[0])
+	assert.Regexp(t, regexp.MustCompile(`^Feats `+timestamp+` 10\.0\.0\.2 - GET "/missing" 404 \d+ \d+ - - localhost:8080 HTTP/1\.1 - -$`), lines[1])
+}
+
+func TestLogAccess_Disabled(t *testing.T) {
+	engine := &Engine{Config: &Config{}}
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	assert.NotNil(t, engine.LogAccess(handler))
+}
+
+func TestAccessLogger_DropsLinesWhenBufferIsFull(t *testing.T) {
+	al := &accessLogger{lines: make(chan string, 1)}
+	al.log("first\n")
+	al.log("second\n")
+	assert.Len(t, al.lines, 1)
+	assert.Equal(t, uint64(1), al.dropped.Load())
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	rf, err := newRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		_, err = rf.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, rf.Close())
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "line 4\n", string(current))
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	assert.Len(t, backups, 2, "oldest rotated file should be removed")
+	for _, backup := range backups {
+		contents, err := os.ReadFile(backup)
+		require.NoError(t, err)
+		assert.NotEqual(t, "line 1\n", string(contents))
+	}
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"strings"
+)
+
+// Breadcrumb part of the crumb path to a page, see Engine.Breadcrumbs
+type Breadcrumb struct {
+	Name string
+	Path string
+
+	// Optional. ID of the i18n message to use as name, so the crumb is shown in the language of the page
+	MessageID string
+}
+
+// RegisterRouteTitle registers the title of the (HTML) page at the given path, e.g. "collections/foo".
+// Breadcrumbs are derived from the titles of the page and its parent pages, see Breadcrumbs.
+func (e *Engine) RegisterRouteTitle(path string, title string) {
+	e.registerBreadcrumb(Breadcrumb{Name: title, Path: normalizeCrumbPath(path)})
+}
+
+// RegisterLocalizedRouteTitle same as RegisterRouteTitle, but uses the i18n message with
+// the given ID as title. This way the breadcrumb is shown in the language of the page.
+func (e *Engine) RegisterLocalizedRouteTitle(path string, messageID string) {
+	e.registerBreadcrumb(Breadcrumb{MessageID: messageID, Path: normalizeCrumbPath(path)})
+}
+
+func (e *Engine) registerBreadcrumb(crumb Breadcrumb) {
+	if e.breadcrumbs == nil {
+		e.breadcrumbs = make(map[string]Breadcrumb)
+	}
+	e.breadcrumbs[crumb.Path] = crumb
+}
+
+// Breadcrumbs returns the crumb path to the page at the given path, derived from the registered
+// titles of the page and its parent pages (e.g. "collections" and "collections/foo" for
+// "collections/foo/items"). Pages without a registered title are left out.
+func (e *Engine) Breadcrumbs(path string) []Breadcrumb {
+	var result []Breadcrumb
+	segments := strings.Split(normalizeCrumbPath(path), "/")
+	for i := range segments {
+		if crumb, ok := e.breadcrumbs[strings.Join(segments[:i+1], "/")]; ok {
+			result = append(result, crumb)
+		}
+	}
+	return result
+}
+
+// normalizeCrumbPath breadcrumbs use relative paths (to the base URL)
+func normalizeCrumbPath(path string) string {
+	return strings.Trim(path, "/")
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Breadcrumbs(t *testing.T) {
+	e := &Engine{}
+	e.RegisterLocalizedRouteTitle("/collections", "Collections")
+	e.RegisterRouteTitle("/collections/foo", "Foo")
+	e.RegisterRouteTitle("collections/foo/items", "Items")
+
+	tests := []struct {
+		name string
+		path string
+		want []Breadcrumb
+	}{
+		{
+			name: "root",
+			path: "/",
+			want: nil,
+		},
+		{
+			name: "localized title",
+			path: "/collections",
+			want: []Breadcrumb{{MessageID: "Collections", Path: "collections"}},
+		},
+		{
+			name: "derived from parent pages",
+			path: "/collections/foo/items",
+			want: []Breadcrumb{
+				{MessageID: "Collections", Path: "collections"},
+				{Name: "Foo", Path: "collections/foo"},
+				{Name: "Items", Path: "collections/foo/items"},
+			},
+		},
+		{
+			name: "pages without title are left out",
+			path: "/collections/foo/items/123",
+			want: []Breadcrumb{
+				{MessageID: "Collections", Path: "collections"},
+				{Name: "Foo", Path: "collections/foo"},
+				{Name: "Items", Path: "collections/foo/items"},
+			},
+		},
+		{
+			name: "unknown page",
+			path: "/collections/bar",
+			want: []Breadcrumb{{MessageID: "Collections", Path: "collections"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, e.Breadcrumbs(tt.path))
+		})
+	}
+}
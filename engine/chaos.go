@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const chaosHeader = "GoKoala-Chaos"
+
+// Chaos middleware injects latency, errors or truncated responses into requests of routes which match a
+// ChaosRule in the config, for resilience testing of clients. When multiple rules match a route the most
+// specific (the one with the longest path) is used. Injected faults are marked by the GoKoala-Chaos
+// response header. Should be placed after the Recoverer middleware, since truncated responses are aborted.
+func (e *Engine) Chaos(next http.Handler) http.Handler {
+	rules := make([]ChaosRule, len(e.Config.Chaos))
+	copy(rules, e.Config.Chaos)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Path) > len(rules[j].Path)
+	})
+	if len(rules) > 0 {
+		log.Printf("chaos enabled, injecting faults into responses of %d route(s). Never use this in production!", len(rules))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if rule.matches(r.URL.Path) {
+				rule.serve(w, r, next)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *ChaosRule) matches(path string) bool {
+	prefix := strings.TrimSuffix(c.Path, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (c *ChaosRule) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if chance(c.LatencyRate) {
+		w.Header().Add(chaosHeader, "latency")
+		select {
+		case <-time.After(c.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if chance(c.ErrorRate) {
+		w.Header().Add(chaosHeader, "error")
+		RenderProblem(w, c.ErrorStatus, "error injected by chaos testing")
+		return
+	}
+	if !chance(c.TruncateRate) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	// buffer the response, so we know where the body is halfway
+	response := newBufferedResponse()
+	next.ServeHTTP(response, r)
+	for name, values := range response.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Add(chaosHeader, "truncate")
+	w.WriteHeader(response.statusCode)
+	body := response.body.Bytes()
+	SafeWrite(w.Write, body[:len(body)/2])
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	// abort the response so the client notices the body is incomplete (e.g. unexpected EOF)
+	panic(http.ErrAbortHandler)
+}
+
+func chance(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate //nolint:gosec // no need for a cryptographically secure random number
+}
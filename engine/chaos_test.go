@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Chaos(t *testing.T) {
+	engine := &Engine{Config: &Config{Chaos: []ChaosRule{
+		{ErrorRate: 1, ErrorStatus: http.StatusServiceUnavailable},
+		{Path: "/collections/foo", Latency: 10 * time.Millisecond, LatencyRate: 1},
+		{Path: "/collections/bar", ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests},
+		{Path: "/collections/baz", TruncateRate: 1},
+		{Path: "/health"},
+	}}}
+	handler := engine.Chaos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+
+	tests := []struct {
+		name        string
+		path        string
+		wantStatus  int
+		wantBody    string
+		wantChaos   string
+		wantAborted bool
+	}{
+		{
+			name:       "latency",
+			path:       "/collections/foo/items",
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+			wantChaos:  "latency",
+		},
+		{
+			name:       "error of most specific rule",
+			path:       "/collections/bar/items",
+			wantStatus: http.StatusTooManyRequests,
+			wantChaos:  "error",
+		},
+		{
+			name:       "error of rule for all routes",
+			path:       "/collections/foobar/items",
+			wantStatus: http.StatusServiceUnavailable,
+			wantChaos:  "error",
+		},
+		{
+			name:        "truncated response",
+			path:        "/collections/baz/items",
+			wantStatus:  http.StatusOK,
+			wantBody:    "01234",
+			wantChaos:   "truncate",
+			wantAborted: true,
+		},
+		{
+			name:       "rule without faults",
+			path:       "/health",
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+tt.path, nil)
+			recorder := httptest.NewRecorder()
+			if tt.wantAborted {
+				assert.PanicsWithValue(t, http.ErrAbortHandler, func() { handler.ServeHTTP(recorder, req) })
+			} else {
+				handler.ServeHTTP(recorder, req)
+			}
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			assert.Equal(t, tt.wantChaos, recorder.Header().Get(chaosHeader))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestEngine_Chaos_LatencyCanceled(t *testing.T) {
+	engine := &Engine{Config: &Config{Chaos: []ChaosRule{{Latency: time.Hour, LatencyRate: 1}}}}
+	handler := engine.Chaos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be handled once the client went away")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/collections", nil).WithContext(ctx)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestEngine_NoChaos(t *testing.T) {
+	engine := &Engine{Config: &Config{}}
+	handler := engine.Chaos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost:8080/collections", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(chaosHeader))
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// headers which influence the response, requests only share a response when these are equal
+var coalesceVaryHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Cookie"}
+
+// formats which are meant for bulk downloads (all features streamed in one response), these aren't
+// coalesced since buffering them in memory defeats the purpose of streaming
+var uncoalescedFormats = []string{FormatCSV, FormatFlatGeobuf, FormatGeoParquet, FormatGeoJSONSeq}
+
+// responses larger than this aren't shared, identical requests waiting on such a response are handled on their own
+const maxCoalescedResponseSize = 8 << 20 // 8 MiB
+
+// RequestCoalescer shares the response of a request with identical requests which arrive while the
+// first request is still in-flight. So when many clients request the same tile or page of features at
+// the same time (e.g. a popular viewer) only one query to the backend/datasource is performed.
+type RequestCoalescer struct {
+	cn          *ContentNegotiation
+	mu          sync.Mutex
+	calls       map[string]*coalescedCall
+	varyHeaders []string
+}
+
+type coalescedCall struct {
+	done     chan struct{}
+	response *bufferedResponse
+}
+
+// NewRequestCoalescer optionally accepts extra headers which influence the response, e.g. see Templates.VariantHeaders.
+// Content negotiation is used to determine the format of the response, since bulk download formats aren't coalesced.
+func NewRequestCoalescer(cn *ContentNegotiation, varyHeaders ...string) *RequestCoalescer {
+	return &RequestCoalescer{
+		cn:          cn,
+		calls:       make(map[string]*coalescedCall),
+		varyHeaders: append(slices.Clone(coalesceVaryHeaders), varyHeaders...),
+	}
+}
+
+// Coalesce middleware, only GET requests are coalesced. Note that responses are buffered in memory
+// (up to maxCoalescedResponseSize), bulk download formats (see uncoalescedFormats) are therefore never coalesced.
+func (c *RequestCoalescer) Coalesce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || c.isBulkDownload(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := c.coalesceKey(r)
+
+		c.mu.Lock()
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+				if call.response.overflow {
+					// response was too large to share
+					next.ServeHTTP(w, r)
+					return
+				}
+				call.response.writeTo(w)
+			case <-r.Context().Done():
+				// client went away, nothing to write
+			}
+			return
+		}
+		call := &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		// the response is written to this client as it's generated (e.g. streamed features), and
+		// buffered for the identical requests which arrive in the meantime
+		response := newBufferedResponse()
+		response.passthrough = w
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				// don't share a partial response, let the Recoverer middleware handle the panic
+				response = newBufferedResponse()
+				response.WriteHeader(http.StatusInternalServerError)
+				c.finish(key, call, response)
+				panic(rvr)
+			}
+			c.finish(key, call, response)
+			response.writeHeaderToPassthrough()
+		}()
+
+		// the response is shared, so don't abort when this specific client disconnects
+		next.ServeHTTP(response, r.WithContext(context.WithoutCancel(r.Context())))
+	})
+}
+
+// isBulkDownload whether a format meant for bulk downloads is requested, either using the f query param or the Accept header
+func (c *RequestCoalescer) isBulkDownload(r *http.Request) bool {
+	// negotiate on a copy of the request, since negotiation removes the f query param
+	return slices.Contains(uncoalescedFormats, c.cn.NegotiateFormat(r.Clone(r.Context())))
+}
+
+func (c *RequestCoalescer) finish(key string, call *coalescedCall, response *bufferedResponse) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	call.response = response
+	close(call.done)
+}
+
+func (c *RequestCoalescer) coalesceKey(r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(r.URL.String())
+	for _, header := range c.varyHeaders {
+		key.WriteString("\n")
+		key.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+	return key.String()
+}
+
+// bufferedResponse http.ResponseWriter which keeps the response in memory, so it can be written to multiple clients
+type bufferedResponse struct {
+	header      http.Header
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool // body exceeded maxCoalescedResponseSize, so it's discarded
+
+	// optional writer to which the response is also written as it's generated, errors are ignored
+	// since the buffered response is still of use to other clients
+	passthrough       http.ResponseWriter
+	passedThroughHead bool
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	if b.passthrough != nil {
+		b.writeHeaderToPassthrough()
+		_, _ = b.passthrough.Write(p)
+	}
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.body.Len()+len(p) > maxCoalescedResponseSize {
+		b.overflow = true
+		b.body = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.body.Write(p)
+}
+
+// Flush sends buffered data to the passthrough writer (when it supports flushing), so streamed
+// responses reach the client as they're generated
+func (b *bufferedResponse) Flush() {
+	if b.passthrough == nil {
+		return
+	}
+	b.writeHeaderToPassthrough()
+	if flusher, ok := b.passthrough.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.wroteHeader {
+		return
+	}
+	b.statusCode = statusCode
+	b.wroteHeader = true
+}
+
+// writeHeaderToPassthrough writes the header to the passthrough writer, when not done already
+func (b *bufferedResponse) writeHeaderToPassthrough() {
+	if b.passthrough == nil || b.passedThroughHead {
+		return
+	}
+	b.passedThroughHead = true
+	for name, values := range b.header {
+		b.passthrough.Header()[name] = append([]string(nil), values...)
+	}
+	b.passthrough.WriteHeader(b.statusCode)
+}
+
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(b.statusCode)
+	SafeWrite(w.Write, b.body.Bytes())
+}
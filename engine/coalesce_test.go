@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestRequestCoalescer_Coalesce(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		urls        []string
+		accepts     []string
+		wantBackend int32
+	}{
+		{
+			name:        "identical requests share response",
+			method:      http.MethodGet,
+			urls:        []string{"/items?limit=10", "/items?limit=10", "/items?limit=10"},
+			accepts:     []string{"application/json", "application/json", "application/json"},
+			wantBackend: 1,
+		},
+		{
+			name:        "different urls aren't coalesced",
+			method:      http.MethodGet,
+			urls:        []string{"/items?limit=10", "/items?limit=20"},
+			accepts:     []string{"application/json", "application/json"},
+			wantBackend: 2,
+		},
+		{
+			name:        "different accept headers aren't coalesced",
+			method:      http.MethodGet,
+			urls:        []string{"/items", "/items"},
+			accepts:     []string{"application/json", "text/html"},
+			wantBackend: 2,
+		},
+		{
+			name:        "bulk download formats aren't coalesced",
+			method:      http.MethodGet,
+			urls:        []string{"/items?f=parquet", "/items?f=parquet"},
+			accepts:     []string{"application/json", "application/json"},
+			wantBackend: 2,
+		},
+		{
+			name:        "bulk download formats requested using the Accept header aren't coalesced",
+			method:      http.MethodGet,
+			urls:        []string{"/items", "/items"},
+			accepts:     []string{MediaTypeGeoParquet, MediaTypeGeoParquet},
+			wantBackend: 2,
+		},
+		{
+			name:        "only GET is coalesced",
+			method:      http.MethodPost,
+			urls:        []string{"/items", "/items"},
+			accepts:     []string{"application/json", "application/json"},
+			wantBackend: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var backendCalls atomic.Int32
+			release := make(chan struct{})
+			handler := newTestRequestCoalescer().Coalesce(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				backendCalls.Add(1)
+				<-release
+				w.Header().Set("Content-Type", r.Header.Get("Accept"))
+				w.WriteHeader(http.StatusCreated)
+				SafeWrite(w.Write, []byte(r.URL.String()))
+			}))
+
+			var wg sync.WaitGroup
+			recorders := make([]*httptest.ResponseRecorder, len(tt.urls))
+			for i, url := range tt.urls {
+				req := httptest.NewRequest(tt.method, url, nil)
+				req.Header.Set("Accept", tt.accepts[i])
+				recorders[i] = httptest.NewRecorder()
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					handler.ServeHTTP(recorders[i], req)
+				}(i)
+			}
+			// wait until all requests arrived at the backend or are waiting on a coalesced request
+			assert.Eventually(t, func() bool { return backendCalls.Load() == tt.wantBackend }, time.Second, time.Millisecond)
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			assert.Equal(t, tt.wantBackend, backendCalls.Load())
+			for i, rr := range recorders {
+				assert.Equal(t, http.StatusCreated, rr.Code)
+				assert.Equal(t, tt.accepts[i], rr.Header().Get("Content-Type"))
+				assert.Equal(t, tt.urls[i], rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequestCoalescer_Panic(t *testing.T) {
+	var calls atomic.Int32
+	handler := newTestRequestCoalescer().Coalesce(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	assert.Panics(t, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	})
+
+	// next request isn't coalesced with the panicked one
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRequestCoalescer_Passthrough(t *testing.T) {
+	written := make(chan struct{})
+	release := make(chan struct{})
+	handler := newTestRequestCoalescer().Coalesce(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/geo+json")
+		SafeWrite(w.Write, []byte("first"))
+		close(written)
+		<-release
+		SafeWrite(w.Write, []byte(",second"))
+	}))
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+	}()
+
+	// the first part of the response is sent before the response is complete
+	<-written
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "first", rr.Body.String())
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "first,second", rr.Body.String())
+}
+
+func TestRequestCoalescer_Overflow(t *testing.T) {
+	var backendCalls atomic.Int32
+	release := make(chan struct{})
+	body := bytes.Repeat([]byte("x"), maxCoalescedResponseSize+1)
+	handler := newTestRequestCoalescer().Coalesce(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if backendCalls.Add(1) == 1 {
+			<-release
+		}
+		SafeWrite(w.Write, body)
+	}))
+
+	var wg sync.WaitGroup
+	recorders := []*httptest.ResponseRecorder{httptest.NewRecorder(), httptest.NewRecorder()}
+	for _, rr := range recorders {
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+		}(rr)
+	}
+	assert.Eventually(t, func() bool { return backendCalls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// response is too large to share, so the waiting request is handled on its own
+	assert.Equal(t, int32(2), backendCalls.Load())
+	for _, rr := range recorders {
+		assert.Equal(t, len(body), rr.Body.Len())
+	}
+}
+
+func TestRequestCoalescer_Flush(t *testing.T) {
+	handler := newTestRequestCoalescer().Coalesce(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/geo+json")
+		flusher, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		flusher.Flush()
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+}
+
+func newTestRequestCoalescer() *RequestCoalescer {
+	return NewRequestCoalescer(newContentNegotiation([]language.Tag{language.English}, language.English))
+}
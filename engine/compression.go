@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	encodingGzip   = "gzip"
+	gzipFileSuffix = ".gz"
+)
+
+// magic number at the start of gzip content, see https://www.rfc-editor.org/rfc/rfc1952#page-6
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// acceptsGzip returns true when the client supports gzip content according to the Accept-Encoding header
+func acceptsGzip(r *http.Request) bool {
+	accepted := false
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != encodingGzip && coding != "x-gzip" && coding != "*" {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					if coding != "*" {
+						return false // explicitly refused
+					}
+					continue
+				}
+			}
+			accepted = true
+		}
+	}
+	return accepted
+}
+
+// adaptContentEncoding makes sure a proxied response is gzip compressed only when the client supports it.
+// Content from the upstream server which is gzip compressed without a Content-Encoding header (e.g.
+// vector tiles from MBTiles, which are stored gzip'ed) is detected and labeled as such. When the
+// client doesn't support gzip the content is decompressed. Since Content-Encoding is set, our
+// compression middleware leaves the response alone, so content is never compressed twice.
+func adaptContentEncoding(r *http.Request, res *http.Response) error {
+	if r.Method == http.MethodHead || res.StatusCode == http.StatusNoContent || res.Body == nil {
+		return nil
+	}
+	encoding := strings.ToLower(res.Header.Get("Content-Encoding"))
+	if encoding == "" {
+		body := bufio.NewReader(res.Body)
+		magic, _ := body.Peek(len(gzipMagic))
+		res.Body = readCloser{body, res.Body}
+		if !bytes.Equal(magic, gzipMagic) {
+			return nil
+		}
+		encoding = encodingGzip
+		res.Header.Set("Content-Encoding", encodingGzip)
+	}
+	if encoding != encodingGzip {
+		return nil // other encodings (br, etc.) are passed through as-is
+	}
+	addVary(res.Header, "Accept-Encoding")
+	if acceptsGzip(r) {
+		return nil
+	}
+	gzipReader, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return err
+	}
+	res.Body = readCloser{gzipReader, res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	return nil
+}
+
+// precompressedFileServer serves static files from the given directory just like http.FileServer,
+// but serves gzip'ed content as-is (with the correct Content-Encoding) to clients which support it.
+// This applies to pre-compressed siblings of files (e.g. style.json.gz next to style.json) as well as to
+// files which are gzip'ed themselves (e.g. vector tiles exported from MBTiles). Gzip'ed content is
+// decompressed for clients which don't support gzip.
+func precompressedFileServer(dir string) http.Handler {
+	fileServer := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if relativePath := RelativePath(r); relativePath != r.URL.Path {
+			// serve files relative to the router, in case the API is mounted under a prefix
+			r = r.Clone(r.Context())
+			r.URL.Path = relativePath
+			r.URL.RawPath = ""
+		}
+		filePath := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if acceptsGzip(r) && servePrecompressed(w, r, filePath+gzipFileSuffix, filePath) {
+			return
+		}
+		if servePrecompressed(w, r, filePath, filePath) {
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// servePrecompressed serves the given file when it's gzip'ed, returns false otherwise
+func servePrecompressed(w http.ResponseWriter, r *http.Request, gzipFile string, originalFile string) bool {
+	file, err := os.Open(gzipFile)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+	magic := make([]byte, len(gzipMagic))
+	if _, err = io.ReadFull(file, magic); err != nil || !bytes.Equal(magic, gzipMagic) {
+		return false
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(originalFile))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	addVary(w.Header(), "Accept-Encoding")
+
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", encodingGzip)
+		http.ServeContent(w, r, originalFile, info.ModTime(), file)
+		return true
+	}
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return false
+	}
+	defer gzipReader.Close()
+	if r.Method != http.MethodHead {
+		if _, err = io.Copy(w, gzipReader); err != nil {
+			log.Printf("failed to write decompressed %s: %v", originalFile, err)
+		}
+	}
+	return true
+}
+
+func addVary(header http.Header, value string) {
+	for _, existing := range header.Values("Vary") {
+		for _, v := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// readCloser reads from the given reader but closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
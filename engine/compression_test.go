@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{acceptEncoding: "", want: false},
+		{acceptEncoding: "gzip", want: true},
+		{acceptEncoding: "gzip, deflate, br", want: true},
+		{acceptEncoding: "br;q=1.0, GZIP;q=0.5", want: true},
+		{acceptEncoding: "x-gzip", want: true},
+		{acceptEncoding: "*", want: true},
+		{acceptEncoding: "br", want: false},
+		{acceptEncoding: "gzip;q=0", want: false},
+		{acceptEncoding: "*, gzip;q=0", want: false},
+		{acceptEncoding: "*;q=0", want: false},
+		{acceptEncoding: "identity", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			assert.Equal(t, tt.want, acceptsGzip(req))
+		})
+	}
+}
+
+func TestEngine_ReverseProxy_ContentEncoding(t *testing.T) {
+	tile := []byte("fake vector tile content")
+	tests := []struct {
+		name                string
+		upstreamGzip        bool
+		upstreamEncodingHdr bool
+		clientAcceptsGzip   bool
+		wantContentEncoding string
+	}{
+		{
+			name:                "plain upstream, client accepts gzip",
+			clientAcceptsGzip:   true,
+			wantContentEncoding: "",
+		},
+		{
+			name:                "plain upstream, client doesn't accept gzip",
+			wantContentEncoding: "",
+		},
+		{
+			name:                "gzip upstream with header, client accepts gzip",
+			upstreamGzip:        true,
+			upstreamEncodingHdr: true,
+			clientAcceptsGzip:   true,
+			wantContentEncoding: "gzip",
+		},
+		{
+			name:                "gzip upstream with header, client doesn't accept gzip",
+			upstreamGzip:        true,
+			upstreamEncodingHdr: true,
+			wantContentEncoding: "",
+		},
+		{
+			name:                "gzip upstream without header (e.g. MBTiles), client accepts gzip",
+			upstreamGzip:        true,
+			clientAcceptsGzip:   true,
+			wantContentEncoding: "gzip",
+		},
+		{
+			name:                "gzip upstream without header (e.g. MBTiles), client doesn't accept gzip",
+			upstreamGzip:        true,
+			wantContentEncoding: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				body := tile
+				if tt.upstreamGzip {
+					body = gzipBytes(t, tile)
+				}
+				if tt.upstreamEncodingHdr {
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				SafeWrite(w.Write, body)
+			}))
+			defer upstream.Close()
+			target, err := url.Parse(upstream.URL + "/tiles/0/0/0.pbf")
+			require.NoError(t, err)
+
+			e := &Engine{Config: &Config{BaseURL: YAMLURL{&url.URL{Scheme: "http", Host: "localhost"}}}}
+			req := httptest.NewRequest(http.MethodGet, "/tiles/0/0/0", nil)
+			if tt.clientAcceptsGzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			rr := httptest.NewRecorder()
+			e.ReverseProxy(rr, req, target, true, MediaTypeMVT)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantContentEncoding, rr.Header().Get("Content-Encoding"))
+			body := rr.Body.Bytes()
+			if tt.wantContentEncoding == "gzip" {
+				body = gunzipBytes(t, body)
+			}
+			assert.Equal(t, tile, body)
+		})
+	}
+}
+
+func TestPrecompressedFileServer(t *testing.T) {
+	style := []byte(`{"version": 8}`)
+	tile := []byte("fake vector tile content")
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "resources"), 0o755))
+	writeFile(t, filepath.Join(dir, "resources", "style.json"), style)
+	writeFile(t, filepath.Join(dir, "resources", "style.json.gz"), gzipBytes(t, style))
+	writeFile(t, filepath.Join(dir, "resources", "tile.pbf"), gzipBytes(t, tile))
+	writeFile(t, filepath.Join(dir, "resources", "plain.txt"), []byte("plain"))
+
+	tests := []struct {
+		name                string
+		path                string
+		clientAcceptsGzip   bool
+		wantContentEncoding string
+		wantContentType     string
+		wantBody            []byte
+	}{
+		{
+			name:                "pre-compressed sibling, client accepts gzip",
+			path:                "/resources/style.json",
+			clientAcceptsGzip:   true,
+			wantContentEncoding: "gzip",
+			wantContentType:     "application/json",
+			wantBody:            style,
+		},
+		{
+			name:            "pre-compressed sibling, client doesn't accept gzip",
+			path:            "/resources/style.json",
+			wantContentType: "application/json",
+			wantBody:        style,
+		},
+		{
+			name:                "gzip'ed file, client accepts gzip",
+			path:                "/resources/tile.pbf",
+			clientAcceptsGzip:   true,
+			wantContentEncoding: "gzip",
+			wantContentType:     "application/octet-stream",
+			wantBody:            tile,
+		},
+		{
+			name:            "gzip'ed file, client doesn't accept gzip",
+			path:            "/resources/tile.pbf",
+			wantContentType: "application/octet-stream",
+			wantBody:        tile,
+		},
+		{
+			name:              "plain file",
+			path:              "/resources/plain.txt",
+			clientAcceptsGzip: true,
+			wantContentType:   "text/plain; charset=utf-8",
+			wantBody:          []byte("plain"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.clientAcceptsGzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			rr := httptest.NewRecorder()
+			precompressedFileServer(dir).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantContentEncoding, rr.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.wantContentType, rr.Header().Get("Content-Type"))
+			body := rr.Body.Bytes()
+			if tt.wantContentEncoding == "gzip" {
+				body = gunzipBytes(t, body)
+			}
+			assert.Equal(t, tt.wantBody, body)
+		})
+	}
+}
+
+func TestPrecompressedFileServer_MountedUnderPrefix(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "resources"), 0o755))
+	writeFile(t, filepath.Join(dir, "resources", "plain.txt"), []byte("plain"))
+
+	router := chi.NewRouter()
+	router.Route("/some/prefix", func(r chi.Router) {
+		r.Handle("/resources/*", precompressedFileServer(dir))
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/some/prefix/resources/plain.txt", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "plain", rr.Body.String())
+}
+
+func writeFile(t *testing.T, name string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(name, content, 0o600))
+}
+
+func gzipBytes(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func gunzipBytes(t *testing.T, content []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	require.NoError(t, err)
+	result, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return result
+}
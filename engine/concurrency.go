@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// ConcurrencyLimiter caps the number of concurrent in-flight requests and sheds load when saturated
+type ConcurrencyLimiter struct {
+	name       string
+	slots      chan struct{}
+	retryAfter string
+	rejected   atomic.Uint64
+}
+
+// NewConcurrencyLimiter creates a limiter based on the given config, the name is used in logging
+func NewConcurrencyLimiter(name string, cfg ConcurrencyLimit) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		name:       name,
+		slots:      make(chan struct{}, cfg.Max),
+		retryAfter: strconv.Itoa(int(math.Ceil(cfg.GetRetryAfter().Seconds()))),
+	}
+}
+
+// Limit middleware rejects requests with HTTP 503 and a Retry-After header when the max number of
+// concurrent requests is reached. Only requests for which isExpensive returns true are limited,
+// when isExpensive is nil all requests are limited. Requests are never queued, to prevent
+// a thundering herd from piling up on the (SQLite) datasource.
+func (l *ConcurrencyLimiter) Limit(isExpensive func(r *http.Request) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isExpensive != nil && !isExpensive(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			select {
+			case l.slots <- struct{}{}:
+				defer func() { <-l.slots }()
+				next.ServeHTTP(w, r)
+			default:
+				if rejected := l.rejected.Add(1); rejected == 1 || rejected%100 == 0 {
+					log.Printf("%s saturated (max %d concurrent requests), %d requests rejected so far",
+						l.name, cap(l.slots), rejected)
+				}
+				w.Header().Set("Retry-After", l.retryAfter)
+				http.Error(w, "too many concurrent requests, please retry later", http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
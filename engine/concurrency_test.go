@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimiter_Limit(t *testing.T) {
+	retryAfter := 1500 * time.Millisecond
+	tests := []struct {
+		name           string
+		max            int
+		inFlight       int
+		isExpensive    func(r *http.Request) bool
+		wantStatusCode int
+		wantRetryAfter string
+	}{
+		{
+			name:           "below limit",
+			max:            2,
+			inFlight:       1,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "saturated",
+			max:            2,
+			inFlight:       2,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantRetryAfter: "2",
+		},
+		{
+			name:           "saturated but cheap request",
+			max:            1,
+			inFlight:       1,
+			isExpensive:    func(r *http.Request) bool { return r.URL.Query().Has("bbox") },
+			wantStatusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewConcurrencyLimiter("test", ConcurrencyLimit{Max: tt.max, RetryAfter: &retryAfter})
+			release := make(chan struct{})
+			started := make(chan struct{})
+			handler := limiter.Limit(tt.isExpensive)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Has("block") {
+					started <- struct{}{}
+					<-release
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			// occupy slots with long-running (expensive) requests
+			var wg sync.WaitGroup
+			for i := 0; i < tt.inFlight; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items?block&bbox=1,2,3,4", nil))
+				}()
+				<-started
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			assert.Equal(t, tt.wantRetryAfter, rr.Header().Get("Retry-After"))
+
+			close(release)
+			wg.Wait()
+
+			// slots are released after requests finish
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items?bbox=1,2,3,4", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
@@ -2,12 +2,17 @@ package engine
 
 import (
 	"errors"
+	"fmt"
+	"html"
 	"log"
 	"net/url"
 	"os"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
+	_ "time/tzdata" // embed time zone database, since it's absent in our (scratch) Docker image
 
 	"github.com/creasty/defaults"
 	"github.com/go-playground/validator/v10"
@@ -16,8 +21,18 @@ import (
 )
 
 const (
-	cookieMaxAge        = 60 * 60 * 24
-	defaultQueryTimeout = 10 * time.Second
+	cookieMaxAge                    = 60 * 60 * 24
+	defaultQueryTimeout             = 10 * time.Second
+	defaultBusyTimeout              = 5 * time.Second
+	defaultRetryAfter               = 5 * time.Second
+	defaultSubtreeCacheSize         = 32 // MiB
+	defaultStylesRefreshInterval    = 5 * time.Minute
+	defaultResourcesRefreshInterval = 5 * time.Minute
+	defaultStagingMaxFeatures       = 10000
+	defaultResultsLinkExpiry        = 1 * time.Hour
+	defaultObjectStorageRegion      = "us-east-1"
+	defaultSnapshotSyncInterval     = 5 * time.Minute
+	defaultWarmupTimeout            = 30 * time.Second
 )
 
 func readConfigFile(configFile string) *Config {
@@ -70,6 +85,186 @@ func validate(config *Config) {
 		}
 		log.Fatalf("invalid config file provided:\n %v", errMessages)
 	}
+	if config.Branding != nil && (config.Branding.Favicon != nil || len(config.Branding.Icons) > 0) && config.Resources == nil {
+		log.Fatalf("invalid config file provided:\n branding favicon and icons require resources to be configured")
+	}
+	validateStyles(config)
+	validateProcesses(config)
+	validateConformance(config)
+	validateFeatureFlags(config)
+	validateLanguageFallback(config)
+	validateCollectionsListing(config)
+	validateFeatureDatasource(config)
+	validateFeatureViews(config)
+	validateFeatureIDs(config)
+	validateFeatureForeignMembers(config)
+	validateTiles(config)
+	validateFormatRules(config)
+}
+
+func validateFeatureDatasource(config *Config) {
+	if config.OgcAPI.Features == nil {
+		return
+	}
+	if config.OgcAPI.Features.Datasource.PostGIS != nil {
+		log.Fatalf("invalid config file provided:\n PostGIS is not supported (yet) as features datasource, use a geopackage instead")
+	}
+}
+
+func validateFeatureViews(config *Config) {
+	if config.OgcAPI.Features == nil {
+		return
+	}
+	for _, collection := range config.OgcAPI.Features.Collections {
+		if collection.Features == nil || collection.Features.View == nil {
+			continue
+		}
+		if config.OgcAPI.Features.Datasource.GeoPackage == nil {
+			log.Fatalf("invalid config file provided:\n view of collection %s requires a geopackage datasource", collection.ID)
+		}
+		if collection.Features.DatasourceID != nil {
+			log.Fatalf("invalid config file provided:\n collection %s has both a view and a datasourceId, choose one", collection.ID)
+		}
+		if collection.Features.Search != nil {
+			log.Fatalf("invalid config file provided:\n collection %s has a view, full-text search isn't supported on views", collection.ID)
+		}
+	}
+}
+
+func validateFeatureIDs(config *Config) {
+	if config.OgcAPI.Features == nil {
+		return
+	}
+	for _, collection := range config.OgcAPI.Features.Collections {
+		if collection.Features == nil || !collection.Features.HasTextFid() {
+			continue
+		}
+		if config.OgcAPI.Features.Datasource.GeoPackage != nil && collection.Features.View == nil {
+			log.Fatalf("invalid config file provided:\n collection %s has %s feature ids, this requires a view "+
+				"since feature tables in a geopackage have an integer primary key", collection.ID, collection.Features.FidType)
+		}
+	}
+}
+
+func validateFeatureForeignMembers(config *Config) {
+	if config.OgcAPI.Features == nil {
+		return
+	}
+	// members defined by GeoJSON, OGC API Features or JSON-LD which can't be overwritten
+	reservedFeatureCollection := []string{"type", "features", "links", "bbox", "timeStamp", "numberMatched", "numberReturned", "@context"}
+	reservedFeature := []string{"type", "id", "geometry", "properties", "links", "bbox", "@context"}
+	for _, collection := range config.OgcAPI.Features.Collections {
+		if collection.Features == nil || collection.Features.ForeignMembers == nil {
+			continue
+		}
+		for member := range collection.Features.ForeignMembers.FeatureCollection {
+			if slices.Contains(reservedFeatureCollection, member) {
+				log.Fatalf("invalid config file provided:\n collection %s has foreign member %s, "+
+					"this is a reserved member of a FeatureCollection", collection.ID, member)
+			}
+		}
+		for member := range collection.Features.ForeignMembers.Feature {
+			if slices.Contains(reservedFeature, member) {
+				log.Fatalf("invalid config file provided:\n collection %s has foreign member %s, "+
+					"this is a reserved member of a Feature", collection.ID, member)
+			}
+		}
+	}
+}
+
+func validateCollectionsListing(config *Config) {
+	if config.CollectionsListing == nil {
+		return
+	}
+	collections := config.AllCollections()
+	for _, collectionID := range config.CollectionsListing.Order {
+		if !collections.ContainsID(collectionID) {
+			log.Fatalf("invalid config file provided:\n collections listing order refers to unknown collection %s", collectionID)
+		}
+	}
+	themeIDs := make(map[string]bool)
+	for _, theme := range config.CollectionsListing.Themes {
+		if themeIDs[theme.ID] {
+			log.Fatalf("invalid config file provided:\n theme %s is configured more than once", theme.ID)
+		}
+		themeIDs[theme.ID] = true
+		for _, collectionID := range theme.Collections {
+			if !collections.ContainsID(collectionID) {
+				log.Fatalf("invalid config file provided:\n theme %s refers to unknown collection %s", theme.ID, collectionID)
+			}
+		}
+	}
+}
+
+func validateTiles(config *Config) {
+	if config.OgcAPI.Tiles == nil {
+		return
+	}
+	validateTilesTemplate("uriTemplateTiles", config.OgcAPI.Tiles.URITemplateTiles, "{z}", "{x}", "{y}")
+	validateTilesTemplate("uriTemplateCollectionTiles", config.OgcAPI.Tiles.URITemplateCollectionTiles, "{collection}", "{z}", "{x}", "{y}")
+}
+
+func validateTilesTemplate(name string, tmpl *string, placeholders ...string) {
+	if tmpl == nil {
+		return
+	}
+	for _, placeholder := range placeholders {
+		if !strings.Contains(*tmpl, placeholder) {
+			log.Fatalf("invalid config file provided:\n %s is missing placeholder %s", name, placeholder)
+		}
+	}
+}
+
+func validateFormatRules(config *Config) {
+	for _, rule := range config.Formats {
+		if rule.Default != nil && !rule.Allows(*rule.Default) {
+			log.Fatalf("invalid config file provided:\n default format %s of path '%s' isn't allowed", *rule.Default, rule.Path)
+		}
+	}
+}
+
+func validateLanguageFallback(config *Config) {
+	for _, lang := range config.LanguageFallback {
+		if !slices.Contains(config.AvailableLanguages, lang) {
+			log.Fatalf("invalid config file provided:\n language fallback %s isn't one of the available languages", lang)
+		}
+	}
+}
+
+func validateStyles(config *Config) {
+	if config.OgcAPI.Styles == nil {
+		return
+	}
+	collections := config.AllCollections()
+	for _, style := range config.OgcAPI.Styles.SupportedStyles {
+		for _, collectionID := range style.Collections {
+			if !collections.ContainsID(collectionID) {
+				log.Fatalf("invalid config file provided:\n style %s refers to unknown collection %s", style.ID, collectionID)
+			}
+		}
+	}
+}
+
+func validateProcesses(config *Config) {
+	if config.OgcAPI.Processes == nil {
+		return
+	}
+	hasServer := config.OgcAPI.Processes.ProcessesServer.URL != nil
+	hasBackends := len(config.OgcAPI.Processes.Backends) > 0
+	if hasServer == hasBackends {
+		log.Fatalf("invalid config file provided:\n processes requires either a processesServer or backends, not both")
+	}
+	for _, backend := range config.OgcAPI.Processes.Backends {
+		if backend.ProcessesServer.URL == nil {
+			log.Fatalf("invalid config file provided:\n processes backend %s requires a processesServer", backend.ID)
+		}
+	}
+	if config.OgcAPI.Processes.Staging != nil && config.OgcAPI.Features == nil {
+		log.Fatalf("invalid config file provided:\n processes staging requires features to be configured")
+	}
+	if config.OgcAPI.Processes.ResultsStorage != nil && config.OgcAPI.Processes.ResultsStorage.Type == ObjectStorageLocal {
+		log.Fatalf("invalid config file provided:\n processes resultsStorage requires object storage which supports signed URLs (azure, s3 or gcs)")
+	}
 }
 
 type Config struct {
@@ -82,15 +277,78 @@ type Config struct {
 	LastUpdated        *string         `yaml:"lastUpdated"`
 	LastUpdatedBy      string          `yaml:"lastUpdatedBy"`
 	License            License         `yaml:"license" validate:"required"`
+	Attribution        *string         `yaml:"attribution"`
 	Support            *Support        `yaml:"support"`
 	DatasetDetails     []DatasetDetail `yaml:"datasetDetails"`
 	DatasetMetadata    DatasetMetadata `yaml:"datasetMetadata"`
 	DatasetCatalogURL  YAMLURL         `yaml:"datasetCatalogUrl" validate:"url"`
 	BaseURL            YAMLURL         `yaml:"baseUrl" validate:"required,url"`
 	Resources          *Resources      `yaml:"resources"`
+	Branding           *Branding       `yaml:"branding"`
+	HTMLBlocks         []HTMLBlock     `yaml:"htmlBlocks" validate:"dive"`
+	Deprecations       []Deprecation   `yaml:"deprecations" validate:"dive"`
+	Statistics         *Statistics     `yaml:"statistics"`
 	AvailableLanguages []language.Tag  `yaml:"availableLanguages"`
-	OgcAPI             OgcAPI          `yaml:"ogcApi" validate:"required"`
-	CookieMaxAge       int
+	// optional order in which languages are tried when content isn't available in the requested language,
+	// e.g. [fy, nl, en]. The first language is the default language. See LanguageFallbackChain.
+	LanguageFallback []language.Tag `yaml:"languageFallback"`
+	OgcAPI           OgcAPI         `yaml:"ogcApi" validate:"required"`
+	CookieMaxAge     int
+
+	// optional settings of the /collections endpoint, e.g. to list the most important collections first
+	// or to page through APIs with many collections. See OrderedCollections.
+	CollectionsListing *CollectionsListing `yaml:"collectionsListing"`
+
+	// optional conformance classes (by URI) to explicitly enable (true) or disable (false), e.g. to
+	// switch off CRS support even though GoKoala supports it. See ConformanceClassEnabled.
+	Conformance map[string]bool `yaml:"conformance"`
+
+	// optional feature flags to enable (true) or disable (false) experimental behavior, e.g. jsonfg.
+	// Can be overridden per environment by GOKOALA_FEATURE_<FLAG> env vars. See FeatureEnabled.
+	FeatureFlags map[string]bool `yaml:"featureFlags"`
+
+	// optional extra links (e.g. documentation, support portal, data license or related APIs)
+	// shown on the landing page and conformance page, both in JSON and HTML
+	Links []ExtraLink `yaml:"links" validate:"dive"`
+
+	// optional access log with all details of each request in a stable machine-readable format, written to
+	// a (rotated) file or syslog. Separate from the console log, e.g. to retain access logs per policy.
+	AccessLog *AccessLog `yaml:"accessLog"`
+
+	// optional alternative sets of HTML templates (e.g. a redesigned UI) served to clients which opt in by header
+	// or cookie, to trial UI changes on a subset of users. Requires the template-variants feature flag.
+	TemplateVariants *TemplateVariants `yaml:"templateVariants"`
+
+	// optional warmup (slow start) before /health/ready reports ready, so k8s doesn't route traffic
+	// to cold pods. E.g. to run a smoke query per collection. See RegisterWarmupTask.
+	Warmup *Warmup `yaml:"warmup"`
+
+	// optional faults (latency, errors, truncated responses) to inject per route, so client teams can test
+	// their retry and caching behavior. Only active when started with --enable-chaos. See Chaos.
+	Chaos []ChaosRule `yaml:"chaos" validate:"dive"`
+
+	// optional restrictions of the output formats per route (e.g. per module or collection), for example
+	// to disable HTML for machine-only APIs or to disable experimental formats. See FormatRule.
+	Formats []FormatRule `yaml:"formats" validate:"dive"`
+}
+
+// OrderedCollections lists all unique collections in the order of the collections listing (when configured).
+// Collections not mentioned in this order follow in alphabetic order.
+func (c *Config) OrderedCollections() []GeoSpatialCollection {
+	result := c.AllCollections().Unique()
+	if c.CollectionsListing == nil || len(c.CollectionsListing.Order) == 0 {
+		return result
+	}
+	rank := func(coll GeoSpatialCollection) int {
+		if i := slices.Index(c.CollectionsListing.Order, coll.ID); i >= 0 {
+			return i
+		}
+		return len(c.CollectionsListing.Order)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return rank(result[i]) < rank(result[j])
+	})
+	return result
 }
 
 func (c *Config) HasCollections() bool {
@@ -114,6 +372,103 @@ func (c *Config) AllCollections() GeoSpatialCollections {
 	return result
 }
 
+// MapAttribution short attribution (may contain HTML links) to show on maps, e.g. in TileJSON, styles and
+// map previews. Uses the configured attribution, defaults to the title and license of the dataset.
+func (c *Config) MapAttribution() string {
+	if c.Attribution != nil {
+		return *c.Attribution
+	}
+	return fmt.Sprintf(`%s (<a href="%s">%s</a>)`, html.EscapeString(c.Title),
+		html.EscapeString(c.License.URL), html.EscapeString(c.License.Name))
+}
+
+// MajorVersionPrefix path prefix based on the major version of this API, e.g. /v1 for version 1.2.3
+func (c *Config) MajorVersionPrefix() string {
+	major, _, _ := strings.Cut(c.Version, ".")
+	return "/v" + major
+}
+
+// DefaultLanguage language used when the client doesn't request one of the available languages. This is the
+// first language of the configured fallback order, defaults to Dutch (or the first available language without Dutch).
+func (c *Config) DefaultLanguage() language.Tag {
+	if len(c.LanguageFallback) > 0 {
+		return c.LanguageFallback[0]
+	}
+	if len(c.AvailableLanguages) == 0 || slices.Contains(c.AvailableLanguages, language.Dutch) {
+		return language.Dutch
+	}
+	return c.AvailableLanguages[0]
+}
+
+// LanguageFallbackChain languages to try - in order - for content (e.g. a translation) in the given language:
+// the given language itself followed by the configured fallback order, or the default language without one.
+func (c *Config) LanguageFallbackChain(lang language.Tag) []language.Tag {
+	fallback := c.LanguageFallback
+	if len(fallback) == 0 {
+		fallback = []language.Tag{c.DefaultLanguage()}
+	}
+	chain := []language.Tag{lang}
+	for _, l := range fallback {
+		if !slices.Contains(chain, l) {
+			chain = append(chain, l)
+		}
+	}
+	return chain
+}
+
+// EnabledModules lists the OGC API modules enabled in this config, OGC API Common is always enabled
+func (c *Config) EnabledModules() []string {
+	result := []string{"common"}
+	if c.OgcAPI.GeoVolumes != nil {
+		result = append(result, "3dgeovolumes")
+	}
+	if c.OgcAPI.Tiles != nil {
+		result = append(result, "tiles")
+	}
+	if c.OgcAPI.Styles != nil {
+		result = append(result, "styles")
+	}
+	if c.OgcAPI.Features != nil {
+		result = append(result, "features")
+	}
+	if c.OgcAPI.Maps != nil {
+		result = append(result, "maps")
+	}
+	if c.OgcAPI.Processes != nil {
+		result = append(result, "processes")
+	}
+	return result
+}
+
+// Redacted returns the (resolved) config as YAML, with the values of secrets like passwords and tokens
+// replaced. Useful to log the effective config, e.g. to verify defaults and environment variables.
+func (c *Config) Redacted() (string, error) {
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return "", err
+	}
+	redactSecrets(&node)
+	redacted, err := yaml.Marshal(&node)
+	return string(redacted), err
+}
+
+// config keys holding secrets (credentials, tokens), see Redacted
+var secretConfigKeys = []string{"auth", "password", "token"}
+
+func redactSecrets(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if slices.Contains(secretConfigKeys, key.Value) && value.Kind == yaml.ScalarNode && value.Tag != "!!null" && value.Value != "" {
+				value.SetString("REDACTED")
+			}
+		}
+	}
+	for _, child := range node.Content {
+		redactSecrets(child)
+	}
+}
+
 type Support struct {
 	Name  string `yaml:"name" validate:"required"`
 	Email string `yaml:"email" validate:"omitempty,email"`
@@ -132,8 +487,285 @@ type DatasetMetadata struct {
 }
 
 type Resources struct {
-	URL       YAMLURL `yaml:"url" validate:"required_without=Directory,omitempty,url"`
-	Directory string  `yaml:"directory" validate:"required_without=URL,omitempty,dir"`
+	URL YAMLURL `yaml:"url" validate:"required_without_all=Directory Storage,omitempty,url"`
+
+	// local directory with resources, gzip'ed files and pre-compressed siblings (e.g. style.json.gz
+	// next to style.json) are served as-is to clients which support gzip
+	Directory string `yaml:"directory" validate:"required_without_all=URL Storage,omitempty,dir"`
+
+	// alternatively resources can be served from object storage (e.g. sprites and glyphs in an S3 bucket)
+	Storage *ObjectStorage `yaml:"storage" validate:"required_without_all=URL Directory"`
+
+	// optional interval at which resources in object storage are checked for changes, until then
+	// resources are served from memory (default is 5m, see constant)
+	RefreshInterval *time.Duration `yaml:"refreshInterval"`
+}
+
+func (r *Resources) GetRefreshInterval() time.Duration {
+	if r.RefreshInterval != nil {
+		return *r.RefreshInterval
+	}
+	return defaultResourcesRefreshInterval
+}
+
+// ObjectStorage settings to access objects (files) in object storage, used for e.g. styles, resources and job results
+type ObjectStorage struct {
+	// type of object storage: azure (Azure Blob Storage or Azurite), s3 (AWS S3 or compatible like MinIO),
+	// gcs (Google Cloud Storage through its S3 compatible XML API, using HMAC keys) or local (a directory, for development)
+	Type string `yaml:"type" validate:"required,oneof=azure s3 gcs local"`
+
+	// optional URL of the storage service, e.g. https://myaccount.blob.core.windows.net, http://127.0.0.1:10000/devstoreaccount1
+	// when using Azurite or http://localhost:9000 when using MinIO. Defaults to the public endpoint of the storage service.
+	URL *YAMLURL `yaml:"url" validate:"omitempty,url"`
+
+	// optional region of the bucket, s3 only (default is us-east-1, see constant)
+	Region *string `yaml:"region"`
+
+	// optional name of the storage account (azure) or access key ID (s3, gcs). When both user and auth are
+	// omitted these are read from the environment: AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY or AWS_ACCESS_KEY_ID
+	// and AWS_SECRET_ACCESS_KEY. Without credentials requests are anonymous, e.g. for a public bucket/container.
+	User string `yaml:"user"`
+
+	// optional (base64 encoded) key of the storage account (azure) or secret access key (s3, gcs)
+	Auth string `yaml:"auth"`
+
+	// container (azure), bucket (s3, gcs) or directory (local)
+	Container string `yaml:"container" validate:"required"`
+
+	// optional prefix (folder) of all objects in the container/bucket
+	Prefix string `yaml:"prefix"`
+}
+
+func (s *ObjectStorage) GetRegion() string {
+	if s.Region != nil {
+		return *s.Region
+	}
+	return defaultObjectStorageRegion
+}
+
+// HTMLBlock custom HTML snippet (e.g. maintenance notice, usage conditions) shown on the landing page
+// or collection page, this avoids the need to fork templates for small content changes.
+type HTMLBlock struct {
+	// Style of the block: info, warning or danger (shown as alert) or none (plain content)
+	Style string `yaml:"style" default:"info" validate:"oneof=info warning danger none"`
+
+	// HTML content per language (e.g. nl, en). When a language is missing we fall back to Dutch
+	Content map[string]string `yaml:"content" validate:"required"`
+}
+
+// ExtraLink link to a resource outside this API, e.g. documentation or a related API
+type ExtraLink struct {
+	// Relation of the link (e.g. describedby, license, help or related), see https://www.iana.org/assignments/link-relations
+	Rel string `yaml:"rel" default:"related" validate:"required"`
+
+	// Title per language (e.g. nl, en). When a language is missing the language fallback order applies
+	Title map[string]string `yaml:"title" validate:"required"`
+
+	// URL of the linked resource
+	Href string `yaml:"href" validate:"required,url"`
+
+	// Optional media type of the linked resource, e.g. text/html or application/pdf
+	Type *string `yaml:"type"`
+}
+
+// Deprecation announces the deprecation of (part of) this API using the Deprecation (RFC 9745)
+// and Sunset (RFC 8594) headers, as required by the lifecycle rules of the Dutch API strategy.
+type Deprecation struct {
+	// Path (prefix) of the deprecated routes, e.g. /collections/foo. When omitted this whole API version is deprecated
+	Path string `yaml:"path" validate:"omitempty,startswith=/"`
+
+	// Date since when the routes are deprecated, e.g. 2024-01-01
+	Since time.Time `yaml:"since" validate:"required"`
+
+	// Date on which the routes will be removed, e.g. 2024-12-31. Optional
+	Sunset *time.Time `yaml:"sunset"`
+
+	// URL of the successor (e.g. the next major version of this API). Optional
+	Successor *YAMLURL `yaml:"successor" validate:"omitempty,url"`
+
+	// URL of a page with more information about the deprecation. Optional
+	Info *YAMLURL `yaml:"info" validate:"omitempty,url"`
+}
+
+// Statistics enables collection of usage statistics: the number of requests per collection and
+// format and the number of unique consumers, e.g. for mandatory usage reporting of (open) data.
+type Statistics struct {
+	// Bearer token required to access the statistics on the main server (under /admin), e.g. ${STATISTICS_TOKEN}.
+	// When omitted the statistics are only available on the debug server.
+	Token *string `yaml:"token"`
+
+	// Request header identifying consumers, e.g. an API key header set by an API gateway. When omitted (or
+	// absent in a request) the client IP is used. Consumers are only kept as (salted) hash. Optional
+	ConsumerHeader *string `yaml:"consumerHeader"`
+
+	// Monthly usage report, written to a directory and/or sent by email. Optional
+	Report *UsageReport `yaml:"report"`
+}
+
+// UsageReport exports the usage statistics at the end of each month, and on shutdown (partial month)
+// since statistics are kept in memory. Each GoKoala instance reports its own usage.
+type UsageReport struct {
+	// Format of the report: csv or json
+	Format string `yaml:"format" default:"csv" validate:"oneof=csv json"`
+
+	// Directory to write reports to, e.g. a mounted (network) volume. Required when no email is configured
+	Directory *string `yaml:"directory" validate:"required_without=Email"`
+
+	// Send reports by email. Optional
+	Email *UsageReportEmail `yaml:"email"`
+}
+
+// AccessLog writes a line per request, in the style of S3 server access logs. Lines are written asynchronously,
+// when the buffer is full (e.g. the disk or syslog server is too slow) lines are dropped instead of delaying requests.
+type AccessLog struct {
+	// File to write the access log to, rotated once it exceeds MaxSize. Required when syslog isn't configured
+	File *string `yaml:"file" validate:"required_without=Syslog"`
+
+	// Max size of the access log file in MiB, before it's rotated (renamed with a timestamp suffix)
+	MaxSize int `yaml:"maxSize" default:"100" validate:"gt=0"`
+
+	// Number of rotated access log files to keep, older files are removed. Use 0 to keep all files
+	MaxBackups int `yaml:"maxBackups" default:"10" validate:"gte=0"`
+
+	// Send the access log to syslog instead of a file. Optional
+	Syslog *AccessLogSyslog `yaml:"syslog"`
+
+	// Number of lines buffered before lines are dropped
+	BufferSize int `yaml:"bufferSize" default:"10000" validate:"gt=0"`
+}
+
+// Warmup settings, by default the API is ready once datasources are opened and templates are rendered
+type Warmup struct {
+	// run a smoke query (retrieving a single feature) per feature collection, failed queries are retried
+	SmokeQueries bool `yaml:"smokeQueries"`
+
+	// optional max duration of each warmup task, e.g. a smoke query (default is 30s, see constant)
+	Timeout *time.Duration `yaml:"timeout"`
+
+	// optional minimum duration (since startup) before reporting ready, e.g. to give connection pools
+	// and caches of the datasource some time to fill
+	SlowStart *time.Duration `yaml:"slowStart"`
+}
+
+func (w *Warmup) GetTimeout() time.Duration {
+	if w.Timeout != nil {
+		return *w.Timeout
+	}
+	return defaultWarmupTimeout
+}
+
+// ChaosRule injects faults into responses of matching routes at the given rates, each rate is a fraction
+// between 0 (never) and 1 (every request). Never enable this in production.
+type ChaosRule struct {
+	// Path (prefix) of the routes, e.g. /collections/foo/items. When omitted the rule applies to all routes
+	Path string `yaml:"path" validate:"omitempty,startswith=/"`
+
+	// Latency added to requests before they're handled, e.g. 2s
+	Latency time.Duration `yaml:"latency" validate:"required_with=LatencyRate"`
+
+	// Fraction of requests delayed by the latency
+	LatencyRate float64 `yaml:"latencyRate" validate:"gte=0,lte=1"`
+
+	// Fraction of requests answered by an error instead of being handled
+	ErrorRate float64 `yaml:"errorRate" validate:"gte=0,lte=1"`
+
+	// HTTP status of the injected errors, e.g. 500, 503 or 429
+	ErrorStatus int `yaml:"errorStatus" default:"503" validate:"gte=400,lte=599"`
+
+	// Fraction of responses aborted halfway through the body
+	TruncateRate float64 `yaml:"truncateRate" validate:"gte=0,lte=1"`
+}
+
+// FormatRule restricts the output formats of routes, formats are referenced by name (e.g. json, html, jsonfg)
+type FormatRule struct {
+	// Path (prefix) of the routes, e.g. /collections/foo or /tiles. Use * to match any path segment,
+	// e.g. /collections/*/items for the features of all collections. When omitted the rule applies to all routes
+	Path string `yaml:"path" validate:"omitempty,startswith=/"`
+
+	// Formats available on the routes. When omitted all formats are available
+	Allowed []string `yaml:"allowed"`
+
+	// Formats not available on the routes, takes precedence over allowed
+	Disallowed []string `yaml:"disallowed"`
+
+	// Format used when the client doesn't ask for a specific format (no f param or Accept header), instead of json
+	Default *string `yaml:"default"`
+}
+
+// Allows returns true when the given format is available on the routes of this rule
+func (f *FormatRule) Allows(format string) bool {
+	if slices.Contains(f.Disallowed, format) {
+		return false
+	}
+	return len(f.Allowed) == 0 || slices.Contains(f.Allowed, format)
+}
+
+type AccessLogSyslog struct {
+	// Network of the syslog server: udp, tcp or unix. When empty the local syslog daemon is used
+	Network string `yaml:"network" validate:"omitempty,oneof=udp tcp unix"`
+
+	// Address of the syslog server, e.g. syslog.example.com:514. Required when a network is configured
+	Address string `yaml:"address" validate:"required_with=Network"`
+
+	// Tag (program name) of the log messages
+	Tag string `yaml:"tag" default:"gokoala"`
+}
+
+// TemplateVariants alternative sets of HTML templates, the variant is selected per request by header or cookie
+// (the header takes precedence). Clients requesting no or an unknown variant receive the default templates.
+type TemplateVariants struct {
+	// Name of the request header holding the name of the requested variant
+	Header string `yaml:"header" default:"X-Template-Variant" validate:"required"`
+
+	// Name of the cookie holding the name of the requested variant
+	Cookie string `yaml:"cookie" default:"template-variant" validate:"required"`
+
+	// Variants available besides the default templates
+	Variants []TemplateVariant `yaml:"variants" validate:"required,min=1,unique=Name,dive"`
+}
+
+// TemplateVariant HTML templates which override the default templates. The directory mirrors the layout of
+// this repository, e.g. <directory>/engine/templates/partials/header.go.html overrides the default header and
+// <directory>/ogc/common/core/templates/landing-page.go.html the landing page. Absent templates aren't overridden.
+type TemplateVariant struct {
+	// Name of the variant, as sent by clients in the header or cookie, e.g. beta
+	Name string `yaml:"name" validate:"required"`
+
+	// Directory holding the overriding templates
+	Directory string `yaml:"directory" validate:"required,dir"`
+}
+
+type UsageReportEmail struct {
+	// SMTP server as host:port, e.g. smtp.example.com:587. STARTTLS is used when supported by the server
+	SMTPServer string `yaml:"smtpServer" validate:"required,hostname_port"`
+
+	// Username and password for SMTP authentication, e.g. ${SMTP_PASSWORD}. Optional
+	Username *string `yaml:"username"`
+	Password *string `yaml:"password" validate:"required_with=Username"`
+
+	// Sender of the reports
+	From string `yaml:"from" validate:"required,email"`
+
+	// Recipients of the reports
+	To []string `yaml:"to" validate:"required,min=1,dive,email"`
+}
+
+// Branding of the HTML pages and web manifest. Files (favicon, icons) are served from Resources.
+type Branding struct {
+	// Filename of the favicon in Resources, e.g. favicon.ico. When omitted the default favicon is used
+	Favicon *string `yaml:"favicon"`
+
+	// Color of the browser UI (theme-color) and splash screen, e.g. #26076b
+	ThemeColor string `yaml:"themeColor" validate:"omitempty,hexcolor"`
+
+	// Icons in Resources used when the site is installed as (progressive) web app
+	Icons []BrandingIcon `yaml:"icons" validate:"dive"`
+}
+
+type BrandingIcon struct {
+	File  string `yaml:"file" validate:"required"`
+	Sizes string `yaml:"sizes" validate:"required"` // e.g. 192x192
+	Type  string `yaml:"type"`                      // e.g. image/png
 }
 
 type OgcAPI struct {
@@ -145,6 +777,42 @@ type OgcAPI struct {
 	Processes  *OgcAPIProcesses    `yaml:"processes"`
 }
 
+// CollectionsListing settings of the /collections endpoint
+type CollectionsListing struct {
+	// Optional order of collections (by ID), collections not mentioned here follow in alphabetic order
+	Order []string `yaml:"order"`
+
+	// Optional number of collections per page (default) and the max page size clients may request using
+	// the limit param. By default, all collections are listed on a single page.
+	Limit *Limit `yaml:"limit"`
+
+	// Optional thematic groups of collections (e.g. addresses, buildings) for APIs with many collections.
+	// Rendered as sections on the collections page, collections without a theme are listed last.
+	Themes []CollectionTheme `yaml:"themes" validate:"dive"`
+}
+
+// CollectionTheme thematic group of collections
+type CollectionTheme struct {
+	ID          string   `yaml:"id" validate:"required"`
+	Title       string   `yaml:"title" validate:"required"`
+	Description *string  `yaml:"description"`
+	Collections []string `yaml:"collections" validate:"required"`
+}
+
+// CollectionThemes returns the themes (in configured order) to which the given collection belongs
+func (c *Config) CollectionThemes(collectionID string) []CollectionTheme {
+	if c.CollectionsListing == nil {
+		return nil
+	}
+	var result []CollectionTheme
+	for _, theme := range c.CollectionsListing.Themes {
+		if slices.Contains(theme.Collections, collectionID) {
+			result = append(result, theme)
+		}
+	}
+	return result
+}
+
 type GeoSpatialCollections []GeoSpatialCollection
 
 // Unique lists all unique GeoSpatialCollections (no duplicate IDs),
@@ -202,6 +870,8 @@ type GeoSpatialCollectionMetadata struct {
 	LastUpdated   *string  `yaml:"lastUpdated"`
 	LastUpdatedBy string   `yaml:"lastUpdatedBy"`
 	Extent        *Extent  `yaml:"extent"`
+
+	HTMLBlocks []HTMLBlock `yaml:"htmlBlocks" validate:"dive"`
 }
 
 type CollectionEntry3dGeoVolumes struct {
@@ -219,6 +889,18 @@ type CollectionEntry3dGeoVolumes struct {
 
 	// Optional URL to 3D viewer to visualize the given collection of 3D Tiles.
 	URL3DViewer *YAMLURL `yaml:"3dViewerUrl" validate:"url"`
+
+	// Metadata derived from the tileset on the tileserver at startup, not configurable.
+	TilesetMetadata *TilesetMetadata `yaml:"-"`
+}
+
+// TilesetMetadata of a 3D collection, derived from the tileset.json (3D Tiles) or layer.json (DTM)
+type TilesetMetadata struct {
+	// Geometric error of the root tile, in meters. Only for 3D Tiles
+	GeometricError *float64
+
+	// Number of levels of the tileset
+	AvailableLevels *int
 }
 
 func (gv *CollectionEntry3dGeoVolumes) Has3DTiles() bool {
@@ -236,6 +918,212 @@ type CollectionEntryTiles struct {
 type CollectionEntryFeatures struct {
 	// Optional way to map a collection ID to the underlying datasource (e.g. table in database).
 	DatasourceID *string `yaml:"datasourceId"`
+
+	// Optional references from properties of this collection to features in other collections.
+	// These relations can be expanded inline on request (using the 'expand' query param).
+	Relations []FeatureRelation `yaml:"relations" validate:"dive"`
+
+	// Optional JSON-LD context of this collection, maps properties to vocabulary URIs (e.g. schema.org).
+	// Used in the JSON-LD (application/ld+json) representation of features.
+	JSONLDContext map[string]any `yaml:"jsonLdContext"`
+
+	// Optional path to a (R2RML-lite) mapping file to convert features of this collection to RDF.
+	// When set features are also available as Turtle (text/turtle) and N-Triples (application/n-triples).
+	RDFMapping *string `yaml:"rdfMapping"`
+
+	// Optional properties of this collection on which features can be filtered using query params,
+	// e.g. ?status=active&year=2023. Repeat a query param to match multiple values (e.g. ?year=2022&year=2023).
+	Queryables []string `yaml:"queryables"`
+
+	// Optional way to match text when filtering: 'exact' (default), 'case-insensitive' or 'case-accent-insensitive'.
+	// The latter also ignores diacritics, so e.g. 'Zuid-Holland' matches 'zuid-holland' and 'Curaçao' matches 'curacao'.
+	// Note that database indexes can't be used when matching text case- or accent-insensitive.
+	TextMatching string `yaml:"textMatching" validate:"omitempty,oneof=exact case-insensitive case-accent-insensitive"`
+
+	// Optional full-text search on properties of this collection using the 'q' query param, e.g. ?q=damrak amsterdam.
+	Search *FeatureSearch `yaml:"search"`
+
+	// Optional time zone (IANA name, e.g. Europe/Amsterdam) of datetime columns without an offset in the datasource.
+	// By default these are considered UTC. Use this for (legacy) datasets which store local time. Datetime properties
+	// are always returned in UTC, timestamps to filter on are converted to this time zone.
+	TimeZone *string `yaml:"timeZone" validate:"omitempty,timezone"`
+
+	// Optional coordinate reference systems (e.g. EPSG:28992) of this collection besides CRS84, overrides
+	// the supportedCrs of the features API as a whole.
+	SupportedCrs []string `yaml:"supportedCrs" validate:"dive,startswith=EPSG:"`
+
+	// Optional temporal properties (date or datetime columns) of this collection, to select features by time
+	// using the 'datetime' query param. Either a single property (features are instants) or a start and end.
+	Temporal *FeatureTemporalProperties `yaml:"temporal"`
+
+	// Optional types of properties (columns) of this collection: boolean, date, datetime, integer, number or string.
+	// By default the type is derived from the schema of the datasource. Use this to override the type of a column,
+	// e.g. when booleans are stored as 0/1 or dates are stored as text.
+	PropertyTypes map[string]string `yaml:"propertyTypes" validate:"dive,oneof=boolean date datetime integer number string"`
+
+	// Optional properties (blob columns) of this collection holding large binary content, like photos or documents.
+	// Instead of embedding these in the features, each property holds a link to the content which is served
+	// separately at /collections/{collectionId}/items/{featureId}/attachments/{property}.
+	Attachments []FeatureAttachment `yaml:"attachments" validate:"dive"`
+
+	// Optional terms (e.g. a license or usage conditions) users need to accept before downloading attachments of this
+	// collection. Browsers are shown the terms first, API clients acknowledge these using the X-Terms-Accepted header.
+	Terms *DownloadTerms `yaml:"terms"`
+
+	// Optional SQL query (e.g. joining multiple tables or computing columns) of which the rows are served as the features
+	// of this collection, instead of a single feature table. GeoPackage only, can't be combined with a datasourceId.
+	View *FeatureView `yaml:"view"`
+
+	// Optional type of the feature ids (fid column) of this collection: 'int' (default), 'string' or 'uuid'.
+	// Features are paged in order of their id, so textual ids should be sortable. Since feature tables in a
+	// GeoPackage have an integer primary key, textual ids require a view.
+	FidType string `yaml:"fidType" validate:"omitempty,oneof=int string uuid"`
+
+	// Optional enable offset-based pagination (offset or startIndex param) alongside cursor-based pagination,
+	// for clients that expect this (e.g. QGIS). Note that large offsets are slow, since skipped features
+	// are still read.
+	OffsetPagination bool `yaml:"offsetPagination"`
+
+	// Optional metadata (description, unit of measure and example value) of properties of this collection.
+	// Shown in the schema and queryables of the collection and in the HTML representation of features.
+	Properties []FeatureProperty `yaml:"properties" validate:"dive"`
+
+	// Optional foreign members (custom top-level members, e.g. conformsTo or a dataset DOI) of this collection,
+	// added to the GeoJSON (and GeoJSON-LD) representation of features. For profiles that require these.
+	ForeignMembers *FeatureForeignMembers `yaml:"foreignMembers"`
+}
+
+// HasTextFid whether the feature ids of this collection are textual (string or UUID) instead of integers
+func (cf *CollectionEntryFeatures) HasTextFid() bool {
+	return cf.FidType == FidTypeString || cf.FidType == FidTypeUUID
+}
+
+// FeatureView a collection backed by a SQL query instead of a feature table
+type FeatureView struct {
+	// SQL (select) query, the result should contain the fid column (see datasource), the geometry column and the
+	// bbox columns (minx, miny, maxx, maxy) of the geometry. Full-text search and nearest aren't supported on views.
+	Query string `yaml:"query" validate:"required"`
+
+	// Optional name of the geometry column in the result of the query (default is 'geom')
+	GeometryColumn string `yaml:"geometryColumn" default:"geom"`
+
+	// Optionally materialize the view: store the result of the query in a separate database on local disk, with
+	// indexes on the fid, bbox, queryables and temporal properties. Use this for expensive queries (e.g. with joins),
+	// otherwise the query is executed for each page of features.
+	Materialize *FeatureViewMaterialization `yaml:"materialize"`
+}
+
+// FeatureViewMaterialization settings to materialize a view, see FeatureView. The view is materialized at startup and
+// materialized again in the background when the GeoPackage changes (based on the last_change of the feature tables).
+type FeatureViewMaterialization struct {
+	// optional directory for the materialized view (default is a temp dir)
+	Dir *string `yaml:"dir" validate:"omitempty,dir"`
+
+	// optional interval at which the GeoPackage is checked for changes, by default the view is only materialized
+	// at startup (e.g. for immutable GeoPackages)
+	RefreshInterval *time.Duration `yaml:"refreshInterval"`
+}
+
+// FeatureTemporalProperties properties holding the time (instant or interval) of a feature
+type FeatureTemporalProperties struct {
+	// Property holding the time of the feature, or the start of its validity when an end is configured
+	StartDate string `yaml:"startDate" validate:"required"`
+
+	// Optional property holding the end of the validity of the feature. An empty (null) end means the
+	// feature is still valid.
+	EndDate string `yaml:"endDate"`
+}
+
+// DownloadTerms terms users need to accept before downloading data, e.g. of a restricted dataset
+type DownloadTerms struct {
+	// Title of the terms, e.g. "Terms of use"
+	Title string `yaml:"title" validate:"required"`
+
+	// The terms itself (markdown), users need to accept these again when changed
+	Content string `yaml:"content" validate:"required"`
+}
+
+const (
+	FidTypeInt    = "int"
+	FidTypeString = "string"
+	FidTypeUUID   = "uuid"
+)
+
+const (
+	NumberMatchedExact     = "exact"
+	NumberMatchedEstimated = "estimated"
+)
+
+const (
+	TextMatchingExact                 = "exact"
+	TextMatchingCaseInsensitive       = "case-insensitive"
+	TextMatchingCaseAccentInsensitive = "case-accent-insensitive"
+)
+
+// FeatureSearch full-text search on properties of features, e.g. to lookup addresses or place names
+type FeatureSearch struct {
+	// Properties (text columns) to search in
+	Fields []string `yaml:"fields" validate:"required,min=1"`
+
+	// Properties to compose the display name of suggestions (autocomplete) from, separated by a space.
+	// Default is the search fields.
+	DisplayFields []string `yaml:"displayFields"`
+
+	// Create the full-text index at startup when it doesn't exist yet (default is false). The index
+	// is stored in the GeoPackage itself, so this requires a local GeoPackage on a writable disk.
+	CreateIndex bool `yaml:"createIndex"`
+}
+
+func (fs *FeatureSearch) GetDisplayFields() []string {
+	if len(fs.DisplayFields) > 0 {
+		return fs.DisplayFields
+	}
+	return fs.Fields
+}
+
+// FeatureAttachment a property of a feature holding large binary content (blob), served as a separate resource
+type FeatureAttachment struct {
+	// Name of the property (blob column) holding the content
+	Property string `yaml:"property" validate:"required"`
+
+	// Optional media type of the content, e.g. image/jpeg. By default the media type is derived from the content itself.
+	ContentType *string `yaml:"contentType"`
+}
+
+// FeatureProperty metadata of a property of features, for users to understand its values
+type FeatureProperty struct {
+	// Name of the property (column)
+	Property string `yaml:"property" validate:"required"`
+
+	// Optional human-readable description of the property
+	Description string `yaml:"description"`
+
+	// Optional unit of measure of the property values, preferably an UCUM code (e.g. 'm', 'm2' or 'kg')
+	Unit string `yaml:"unit"`
+
+	// Optional example value of the property
+	Example any `yaml:"example"`
+}
+
+// FeatureForeignMembers custom members added to GeoJSON documents, as allowed by RFC 7946 section 6.1
+type FeatureForeignMembers struct {
+	// Optional members of each FeatureCollection (page of features) of the collection
+	FeatureCollection map[string]any `yaml:"featureCollection"`
+
+	// Optional members of each Feature of the collection, also when embedded in a FeatureCollection
+	Feature map[string]any `yaml:"feature"`
+}
+
+// FeatureRelation a property of a feature holding the ID of a feature in another collection
+type FeatureRelation struct {
+	// Name of the property holding the ID of the referenced feature
+	Property string `yaml:"property" validate:"required"`
+
+	// ID of the collection containing the referenced features
+	Collection string `yaml:"collection" validate:"required"`
+
+	// Properties of the referenced feature to embed when the relation is expanded, all properties when empty
+	KeyProperties []string `yaml:"keyProperties"`
 }
 
 type CollectionEntryMaps struct {
@@ -245,27 +1133,152 @@ type CollectionEntryMaps struct {
 type OgcAPI3dGeoVolumes struct {
 	TileServer  YAMLURL               `yaml:"tileServer" validate:"required,url"`
 	Collections GeoSpatialCollections `yaml:"collections"`
+
+	// Optional size (in MiB) of the in-memory cache of implicit tiling subtrees (default is 32 MiB)
+	SubtreeCacheSize *int `yaml:"subtreeCacheSize" validate:"omitempty,gt=0"`
+}
+
+func (gv *OgcAPI3dGeoVolumes) GetSubtreeCacheSize() int {
+	if gv.SubtreeCacheSize != nil {
+		return *gv.SubtreeCacheSize
+	}
+	return defaultSubtreeCacheSize
 }
 
 type OgcAPITiles struct {
 	TileServer YAMLURL `yaml:"tileServer" validate:"required,url"`
-	// Optional template to the vector tiles on the tileserver. Defaults to {tms}/{z}/{x}/{y}.pbf.
+	// Optional template to the vector tiles on the tileserver, supports the placeholders {tms}, {z}, {x} and {y}.
+	// Defaults to {tms}/{z}/{x}/{y}.pbf.
 	URITemplateTiles *string               `yaml:"uriTemplateTiles"`
 	Types            []string              `yaml:"types" validate:"required"`
 	SupportedSrs     []SupportedSrs        `yaml:"supportedSrs" validate:"required,dive"`
 	Collections      GeoSpatialCollections `yaml:"collections"`
+
+	// Optional template to the vector tiles of a single collection on the tileserver, e.g. {collection}/{tms}/{z}/{x}/{y}.pbf.
+	// When set, tiles containing only the requested collection are served at /collections/{collectionId}/tiles/...
+	URITemplateCollectionTiles *string `yaml:"uriTemplateCollectionTiles"`
+
+	// Optional query params of tile requests to pass on to the tileserver. By default, query params aren't passed on.
+	QueryPassthrough *TilesQueryPassthrough `yaml:"queryPassthrough"`
+}
+
+// TilesQueryPassthrough determines which query params of tile requests are passed on to the tileserver
+type TilesQueryPassthrough struct {
+	// Names of query params to pass on, use * to pass on all query params
+	Allow []string `yaml:"allow" validate:"required,min=1"`
+
+	// Names of query params to never pass on, takes precedence over allow
+	Deny []string `yaml:"deny"`
+}
+
+// Allows returns true when the given query param should be passed on to the tileserver
+func (q *TilesQueryPassthrough) Allows(param string) bool {
+	if q == nil || slices.Contains(q.Deny, param) {
+		return false
+	}
+	return slices.Contains(q.Allow, "*") || slices.Contains(q.Allow, param)
 }
 
 type OgcAPIStyles struct {
-	Default          string          `yaml:"default" validate:"required"`
-	MapboxStylesPath string          `yaml:"mapboxStylesPath" validate:"required,dir"`
-	SupportedStyles  []StyleMetadata `yaml:"supportedStyles" validate:"required"`
+	Default         string          `yaml:"default" validate:"required"`
+	SupportedStyles []StyleMetadata `yaml:"supportedStyles" validate:"required"`
+
+	// local directory with the (Mapbox) stylesheets, named after the style ID (e.g. default.json)
+	MapboxStylesPath string `yaml:"mapboxStylesPath" validate:"required_without=MapboxStylesStorage,omitempty,dir"`
+
+	// alternatively the stylesheets can be stored in object storage (e.g. an S3 bucket or Azure blob container).
+	// Only the stylesheets, sprites and glyphs are served as resources (see Resources.Storage).
+	MapboxStylesStorage *ObjectStorage `yaml:"mapboxStylesStorage" validate:"required_without=MapboxStylesPath"`
+
+	// optional interval at which stylesheets in object storage are checked for changes (default is 5m, see constant)
+	RefreshInterval *time.Duration `yaml:"refreshInterval"`
+
+	// Optional rewrites of the URLs (sources, sprite and glyphs) in Mapbox styles, applied after relative
+	// URLs are resolved against the baseUrl. Allows one style to be used in multiple environments.
+	URLRewrites []URLRewrite `yaml:"urlRewrites" validate:"dive"`
+}
+
+// URLRewrite replaces the given prefix of a URL, e.g. https://api.test.example -> https://api.example
+type URLRewrite struct {
+	From string `yaml:"from" validate:"required"`
+	To   string `yaml:"to" validate:"required"`
+}
+
+func (s *OgcAPIStyles) GetRefreshInterval() time.Duration {
+	if s.RefreshInterval != nil {
+		return *s.RefreshInterval
+	}
+	return defaultStylesRefreshInterval
+}
+
+// StylesForCollection returns the styles applicable to the collection with the given ID
+func (s *OgcAPIStyles) StylesForCollection(collectionID string) []StyleMetadata {
+	var result []StyleMetadata
+	for _, style := range s.SupportedStyles {
+		if slices.Contains(style.Collections, collectionID) {
+			result = append(result, style)
+		}
+	}
+	return result
+}
+
+// StyledCollections returns the IDs of all collections for which one or more styles are available (sorted)
+func (s *OgcAPIStyles) StyledCollections() []string {
+	var result []string
+	for _, style := range s.SupportedStyles {
+		for _, collectionID := range style.Collections {
+			if !slices.Contains(result, collectionID) {
+				result = append(result, collectionID)
+			}
+		}
+	}
+	slices.Sort(result)
+	return result
 }
 
 type OgcAPIFeatures struct {
 	Limit       Limit                 `yaml:"limit"`
 	Collections GeoSpatialCollections `yaml:"collections" validate:"required"`
 	Datasource  Datasource            `yaml:"datasource" validate:"required"`
+
+	// optional cap on concurrent expensive requests (e.g. items with bbox or nearest), protects the datasource from overload
+	ConcurrencyLimit *ConcurrencyLimit `yaml:"concurrencyLimit"`
+
+	// Optional max size (in MiB) of a (JSON) features response, larger responses are aborted with a 413.
+	// Protects against huge responses, e.g. many complex geometries combined with a high limit (default is unlimited)
+	MaxResponseSize *int `yaml:"maxResponseSize" validate:"omitempty,gt=0"`
+
+	// Optional coordinate reference systems (e.g. EPSG:28992) in which features can be requested (crs param)
+	// and filtered (bbox-crs, filter-crs and nearest-crs params), besides CRS84 which is always supported.
+	// Applies to all collections, unless overridden per collection. When empty any EPSG code is accepted.
+	SupportedCrs []string `yaml:"supportedCrs" validate:"dive,startswith=EPSG:"`
+
+	// Optional number of features matching the request (numberMatched) in each page of features, by default only
+	// returned on request (limit=0). Either 'exact' (count of the matching features, may be slow on large tables) or
+	// 'estimated' (fast estimate based on table statistics, only for requests without filters).
+	NumberMatched string `yaml:"numberMatched" validate:"omitempty,oneof=exact estimated"`
+
+	// Optional name of the column holding the geometry in the CSV representation of features. The geometry
+	// is encoded as WKT by default, clients can request another encoding using the geometry-encoding param.
+	CSVGeometryColumn string `yaml:"csvGeometryColumn" default:"geometry"`
+}
+
+func (of *OgcAPIFeatures) GetMaxResponseSize() int {
+	if of.MaxResponseSize != nil {
+		return *of.MaxResponseSize
+	}
+	return 0
+}
+
+// SupportedCrsForCollection returns the coordinate reference systems (e.g. EPSG:28992) besides CRS84 in which
+// features of the given collection are available, empty when these aren't restricted
+func (of *OgcAPIFeatures) SupportedCrsForCollection(collectionID string) []string {
+	for _, collection := range of.Collections {
+		if collection.ID == collectionID && collection.Features != nil && len(collection.Features.SupportedCrs) > 0 {
+			return collection.Features.SupportedCrs
+		}
+	}
+	return of.SupportedCrs
 }
 
 type OgcAPIMaps struct {
@@ -276,6 +1289,69 @@ type OgcAPIProcesses struct {
 	SupportsDismiss  bool    `yaml:"supportsDismiss"`
 	SupportsCallback bool    `yaml:"supportsCallback"`
 	ProcessesServer  YAMLURL `yaml:"processesServer" validate:"url"`
+
+	// alternatively multiple upstream processes servers (backends) can be aggregated under a single /processes API,
+	// process and job IDs are prefixed with the ID of the backend, e.g. process "buffer" becomes "vector.buffer"
+	Backends []ProcessesBackend `yaml:"backends" validate:"omitempty,unique=ID,dive"`
+
+	// optionally stage features of collections in this API which are referenced as process input
+	Staging *ProcessesStaging `yaml:"staging"`
+
+	// optionally persist the results of (async) jobs in object storage, /jobs/{jobId}/results
+	// then returns time-limited signed links to the results instead of the results themselves
+	ResultsStorage *ProcessesResultsStorage `yaml:"resultsStorage"`
+}
+
+// ProcessesResultsStorage object storage for job results, the storage should support signed URLs (so not local)
+type ProcessesResultsStorage struct {
+	ObjectStorage `yaml:",inline"`
+
+	// optional time the links to the results are valid (default is 1h, see constant)
+	LinkExpiry *time.Duration `yaml:"linkExpiry"`
+}
+
+func (s *ProcessesResultsStorage) GetLinkExpiry() time.Duration {
+	if s.LinkExpiry != nil {
+		return *s.LinkExpiry
+	}
+	return defaultResultsLinkExpiry
+}
+
+// ProcessesStaging settings to stage features as process input. Instead of having the processes server
+// fetch the features itself, references to collections of this API (e.g. {"href": ".../collections/foo/items?bbox=..."})
+// are replaced by the features as GeoJSON, so the processes server doesn't need access to this API.
+type ProcessesStaging struct {
+	// optional max number of features staged per input (default is 10.000, see constant)
+	MaxFeatures *int `yaml:"maxFeatures" validate:"omitempty,gt=0"`
+}
+
+func (s *ProcessesStaging) GetMaxFeatures() int {
+	if s.MaxFeatures != nil {
+		return *s.MaxFeatures
+	}
+	return defaultStagingMaxFeatures
+}
+
+type ProcessesBackend struct {
+	// prefix of the process and job IDs of this backend
+	ID              string  `yaml:"id" validate:"required,excludes=."`
+	ProcessesServer YAMLURL `yaml:"processesServer" validate:"url"`
+}
+
+// ConcurrencyLimit settings to shed load when too many expensive requests are in-flight
+type ConcurrencyLimit struct {
+	// max number of concurrent in-flight requests, additional requests are rejected with HTTP 503
+	Max int `yaml:"max" validate:"required,gt=0"`
+
+	// optional time clients are advised to wait before retrying, used in the Retry-After header (default is 5s, see constant)
+	RetryAfter *time.Duration `yaml:"retryAfter"`
+}
+
+func (cl *ConcurrencyLimit) GetRetryAfter() time.Duration {
+	if cl.RetryAfter != nil {
+		return *cl.RetryAfter
+	}
+	return defaultRetryAfter
 }
 
 type Limit struct {
@@ -320,23 +1396,65 @@ type GeoPackageLocal struct {
 
 	// location of GeoPackage on disk
 	File string `yaml:"file" validate:"file"`
+
+	// optional, open the GeoPackage as immutable, SQLite then skips all file locking and change detection
+	// which improves concurrency. Disable when the GeoPackage is modified while GoKoala is running (default is true)
+	Immutable *bool `yaml:"immutable"`
+
+	// optional time to wait when the GeoPackage is locked by another process (default is 5s, see constant)
+	BusyTimeout *time.Duration `yaml:"busyTimeout"`
+
+	// optional size (in KiB) of the SQLite page cache per connection (default is the SQLite default of 2000 KiB)
+	CacheSize *int `yaml:"cacheSize" validate:"omitempty,gt=0"`
+
+	// optional number of connection pools over which queries are distributed, to avoid
+	// contention on a single connection pool (default is the number of CPUs)
+	ConnectionPools *int `yaml:"connectionPools" validate:"omitempty,gt=0"`
+}
+
+func (gl *GeoPackageLocal) IsImmutable() bool {
+	return gl.Immutable == nil || *gl.Immutable
+}
+
+func (gl *GeoPackageLocal) GetBusyTimeout() time.Duration {
+	if gl.BusyTimeout != nil {
+		return *gl.BusyTimeout
+	}
+	return defaultBusyTimeout
+}
+
+func (gl *GeoPackageLocal) GetConnectionPools() int {
+	if gl.ConnectionPools != nil {
+		return *gl.ConnectionPools
+	}
+	return runtime.NumCPU()
 }
 
 // GeoPackageCloud settings to read a GeoPackage as a Cloud-Backed SQLite database
 type GeoPackageCloud struct {
 	GeoPackageCommon `yaml:",inline"`
 
-	// reference to the cloud storage (either azure or google at the moment), e.g:
+	// type of cloud storage: azure (Azure Blob Storage or Azurite) or google (Google Cloud Storage)
+	Type string `yaml:"type" validate:"required_without=Connection,omitempty,oneof=azure google"`
+
+	// optional host:port of the Azurite emulator, azure only
+	Emulator *string `yaml:"emulator" validate:"omitempty,hostname_port"`
+
+	// optional, auth is a SAS token instead of the key of the storage account, azure only
+	SAS bool `yaml:"sas"`
+
+	// alternatively the raw reference to the cloud storage as used by Cloud-Backed SQLite, e.g:
 	// - azure?emulator=127.0.0.1:10000&sas=0
 	// - google
-	Connection string `yaml:"connection" validate:"required"`
+	Connection string `yaml:"connection" validate:"required_without=Type"`
 
-	// username of the storage account, e.g: devstoreaccount1 when using Azurite
-	User string `yaml:"user" validate:"required"`
+	// name of the storage account (azure) or project (google), e.g: devstoreaccount1 when using Azurite.
+	// When both user and auth are omitted these are read from the environment, see GetCredentials.
+	User string `yaml:"user"`
 
-	// some kind of credential like a password or key to authenticate with the storage backend, e.g:
+	// some kind of credential like a key, SAS token or access token to authenticate with the storage backend, e.g:
 	// 'Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==' when using Azurite
-	Auth string `yaml:"auth" validate:"required"`
+	Auth string `yaml:"auth"`
 
 	// container/bucket on the storage account
 	Container string `yaml:"container" validate:"required"`
@@ -346,6 +1464,65 @@ type GeoPackageCloud struct {
 
 	// local cache of fetched blocks from cloud storage
 	Cache *string `yaml:"cache" validate:"omitempty,dir"`
+
+	// optionally serve from a full copy (snapshot) of the GeoPackage on local disk instead of
+	// directly from cloud storage, for maximum query performance
+	Snapshot *GeoPackageSnapshot `yaml:"snapshot"`
+}
+
+// GeoPackageSnapshot settings to serve a cloud-backed GeoPackage from a copy on local disk. The copy is made
+// at startup and replaced in the background when the GeoPackage in cloud storage changes (based on the last_change
+// of the feature tables). Only changed blocks are fetched from cloud storage, the others come from the local cache.
+type GeoPackageSnapshot struct {
+	// optional directory for the snapshot, needs room for (twice) the GeoPackage (default is a temp dir)
+	Dir *string `yaml:"dir" validate:"omitempty,dir"`
+
+	// optional interval at which the GeoPackage in cloud storage is checked for changes (default is 5m, see constant)
+	SyncInterval *time.Duration `yaml:"syncInterval"`
+}
+
+func (gs *GeoPackageSnapshot) GetSyncInterval() time.Duration {
+	if gs.SyncInterval != nil {
+		return *gs.SyncInterval
+	}
+	return defaultSnapshotSyncInterval
+}
+
+// GetConnection returns the reference to the cloud storage as used by Cloud-Backed SQLite
+func (gc *GeoPackageCloud) GetConnection() string {
+	if gc.Connection != "" {
+		return gc.Connection
+	}
+	if gc.Type != "azure" {
+		return gc.Type
+	}
+	options := url.Values{}
+	if gc.Emulator != nil {
+		options.Set("emulator", *gc.Emulator)
+	}
+	if gc.SAS {
+		options.Set("sas", "1")
+	}
+	if len(options) == 0 {
+		return gc.Type
+	}
+	return gc.Type + "?" + options.Encode()
+}
+
+// GetCredentials returns the user and auth, when both are omitted these are read from the
+// environment: AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY (or AZURE_STORAGE_SAS_TOKEN) for azure,
+// or GOOGLE_CLOUD_PROJECT and GOOGLE_OAUTH_ACCESS_TOKEN for google.
+func (gc *GeoPackageCloud) GetCredentials() (string, string) {
+	if gc.User != "" || gc.Auth != "" {
+		return gc.User, gc.Auth
+	}
+	if strings.HasPrefix(gc.GetConnection(), "google") {
+		return os.Getenv("GOOGLE_CLOUD_PROJECT"), os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	if gc.SAS {
+		return os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	}
+	return os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_KEY")
 }
 
 type SupportedSrs struct {
@@ -393,6 +1570,10 @@ type StyleMetadata struct {
 		PropertiesSchema *PropertiesSchema `yaml:"propertiesSchema" json:"propertiesSchema,omitempty"`
 	} `yaml:"layers" json:"layers,omitempty"`
 	Links []Link `yaml:"links" json:"links,omitempty"`
+
+	// Optional IDs of the collections this style applies to. Without collections the
+	// style applies to the dataset as a whole and is only listed under /styles.
+	Collections []string `yaml:"collections" json:"-"`
 }
 
 // StyleSheet based on OGC API Styles Requirement 7B
@@ -432,3 +1613,11 @@ func (o *YAMLURL) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	o.URL = parsedURL
 	return err
 }
+
+// MarshalYAML turns the URL back into a string, see UnmarshalYAML
+func (o YAMLURL) MarshalYAML() (interface{}, error) {
+	if o.URL == nil {
+		return nil, nil
+	}
+	return o.URL.String(), nil
+}
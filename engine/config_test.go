@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
 )
 
 func TestGeoSpatialCollections_Unique(t *testing.T) {
@@ -156,6 +158,434 @@ func TestGeoSpatialCollections_ContainsID(t *testing.T) {
 	}
 }
 
+func TestConfig_MajorVersionPrefix(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{version: "1.0.0", want: "/v1"},
+		{version: "2.3.12", want: "/v2"},
+		{version: "10.0.0-rc1", want: "/v10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			config := &Config{Version: tt.version}
+			assert.Equal(t, tt.want, config.MajorVersionPrefix())
+		})
+	}
+}
+
+func TestConfig_LanguageFallbackChain(t *testing.T) {
+	frisian := language.MustParse("fy")
+	tests := []struct {
+		name        string
+		available   []language.Tag
+		fallback    []language.Tag
+		lang        language.Tag
+		wantDefault language.Tag
+		want        []language.Tag
+	}{
+		{
+			name:        "default to Dutch",
+			available:   []language.Tag{language.English, language.Dutch},
+			lang:        language.English,
+			wantDefault: language.Dutch,
+			want:        []language.Tag{language.English, language.Dutch},
+		},
+		{
+			name:        "default to first available language without Dutch",
+			available:   []language.Tag{language.English, language.German},
+			lang:        language.German,
+			wantDefault: language.English,
+			want:        []language.Tag{language.German, language.English},
+		},
+		{
+			name:        "configured fallback order",
+			available:   []language.Tag{language.English, language.Dutch, frisian},
+			fallback:    []language.Tag{frisian, language.Dutch, language.English},
+			lang:        language.Dutch,
+			wantDefault: frisian,
+			want:        []language.Tag{language.Dutch, frisian, language.English},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{AvailableLanguages: tt.available, LanguageFallback: tt.fallback}
+			assert.Equal(t, tt.wantDefault, config.DefaultLanguage())
+			assert.Equal(t, tt.want, config.LanguageFallbackChain(tt.lang))
+		})
+	}
+}
+
+func TestConfig_OrderedCollections(t *testing.T) {
+	title := "Addresses"
+	collections := GeoSpatialCollections{
+		{ID: "roads"},
+		{ID: "buildings"},
+		{ID: "addresses", Metadata: &GeoSpatialCollectionMetadata{Title: &title}},
+	}
+	tests := []struct {
+		name    string
+		listing *CollectionsListing
+		want    []string
+	}{
+		{
+			name: "alphabetic by default",
+			want: []string{"addresses", "buildings", "roads"},
+		},
+		{
+			name:    "configured order first",
+			listing: &CollectionsListing{Order: []string{"roads", "buildings"}},
+			want:    []string{"roads", "buildings", "addresses"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{OgcAPI: OgcAPI{Features: &OgcAPIFeatures{Collections: collections}}, CollectionsListing: tt.listing}
+			var got []string
+			for _, coll := range config.OrderedCollections() {
+				got = append(got, coll.ID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConfig_CollectionThemes(t *testing.T) {
+	config := &Config{CollectionsListing: &CollectionsListing{Themes: []CollectionTheme{
+		{ID: "bag", Title: "BAG", Collections: []string{"addresses", "buildings"}},
+		{ID: "topography", Title: "Topography", Collections: []string{"buildings", "roads"}},
+	}}}
+	themeIDs := func(themes []CollectionTheme) []string {
+		var result []string
+		for _, theme := range themes {
+			result = append(result, theme.ID)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"bag", "topography"}, themeIDs(config.CollectionThemes("buildings")))
+	assert.Equal(t, []string{"topography"}, themeIDs(config.CollectionThemes("roads")))
+	assert.Empty(t, config.CollectionThemes("water"))
+	assert.Empty(t, (&Config{}).CollectionThemes("roads"))
+}
+
+func TestConfig_MapAttribution(t *testing.T) {
+	attribution := `<a href="https://example.com">Example</a>`
+	tests := []struct {
+		name        string
+		attribution *string
+		want        string
+	}{
+		{
+			name: "derived from title and license",
+			want: `Foo &amp; Bar (<a href="https://creativecommons.org/publicdomain/zero/1.0/">CC0 1.0</a>)`,
+		},
+		{
+			name:        "configured",
+			attribution: &attribution,
+			want:        attribution,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Title:       "Foo & Bar",
+				License:     License{Name: "CC0 1.0", URL: "https://creativecommons.org/publicdomain/zero/1.0/"},
+				Attribution: tt.attribution,
+			}
+			assert.Equal(t, tt.want, config.MapAttribution())
+		})
+	}
+}
+
+func TestOgcAPIStyles_StylesForCollection(t *testing.T) {
+	styles := &OgcAPIStyles{
+		SupportedStyles: []StyleMetadata{
+			{ID: "default"},
+			{ID: "buildings", Collections: []string{"buildings"}},
+			{ID: "roads-and-buildings", Collections: []string{"roads", "buildings"}},
+		},
+	}
+	tests := []struct {
+		collection string
+		want       []string
+	}{
+		{collection: "buildings", want: []string{"buildings", "roads-and-buildings"}},
+		{collection: "roads", want: []string{"roads-and-buildings"}},
+		{collection: "water", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			var got []string
+			for _, style := range styles.StylesForCollection(tt.collection) {
+				got = append(got, style.ID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	assert.Equal(t, []string{"buildings", "roads"}, styles.StyledCollections())
+}
+
+func TestOgcAPIFeatures_SupportedCrsForCollection(t *testing.T) {
+	features := &OgcAPIFeatures{
+		SupportedCrs: []string{"EPSG:28992", "EPSG:3035"},
+		Collections: GeoSpatialCollections{
+			{ID: "addresses"},
+			{ID: "buildings", Features: &CollectionEntryFeatures{SupportedCrs: []string{"EPSG:28992"}}},
+		},
+	}
+	tests := []struct {
+		collection string
+		want       []string
+	}{
+		{collection: "addresses", want: []string{"EPSG:28992", "EPSG:3035"}},
+		{collection: "buildings", want: []string{"EPSG:28992"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			assert.Equal(t, tt.want, features.SupportedCrsForCollection(tt.collection))
+		})
+	}
+}
+
+func TestTilesQueryPassthrough_Allows(t *testing.T) {
+	tests := []struct {
+		name        string
+		passthrough *TilesQueryPassthrough
+		param       string
+		want        bool
+	}{
+		{name: "nothing passed on by default", passthrough: nil, param: "datetime", want: false},
+		{name: "allowed", passthrough: &TilesQueryPassthrough{Allow: []string{"datetime"}}, param: "datetime", want: true},
+		{name: "not allowed", passthrough: &TilesQueryPassthrough{Allow: []string{"datetime"}}, param: "token", want: false},
+		{name: "all allowed", passthrough: &TilesQueryPassthrough{Allow: []string{"*"}}, param: "token", want: true},
+		{name: "denied", passthrough: &TilesQueryPassthrough{Allow: []string{"*"}, Deny: []string{"token"}}, param: "token", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.passthrough.Allows(tt.param))
+		})
+	}
+}
+
+func TestConfig_ConformanceClassEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		conformance map[string]bool
+		class       string
+		want        bool
+	}{
+		{
+			name:  "enabled by default",
+			class: ConformanceClassFeaturesCRS,
+			want:  true,
+		},
+		{
+			name:        "explicitly disabled",
+			conformance: map[string]bool{ConformanceClassFeaturesCRS: false},
+			class:       ConformanceClassFeaturesCRS,
+			want:        false,
+		},
+		{
+			name:        "explicitly enabled",
+			conformance: map[string]bool{ConformanceClassFeaturesCRS: true},
+			class:       ConformanceClassFeaturesCRS,
+			want:        true,
+		},
+		{
+			name:  "filter enabled by default",
+			class: ConformanceClassFeaturesFilter,
+			want:  true,
+		},
+		{
+			name:  "implied by filter",
+			class: ConformanceClassCQL2Text,
+			want:  true,
+		},
+		{
+			name:        "implied class disabled along with filter",
+			conformance: map[string]bool{ConformanceClassFeaturesFilter: false},
+			class:       ConformanceClassCQL2Text,
+			want:        false,
+		},
+		{
+			name:        "required class disabled",
+			conformance: map[string]bool{ConformanceClassBasicSpatialFunctions: false},
+			class:       ConformanceClassSpatialFunctions,
+			want:        false,
+		},
+		{
+			name:  "unknown class",
+			class: "http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/queryables",
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Conformance: tt.conformance}
+			assert.Equal(t, tt.want, config.ConformanceClassEnabled(tt.class))
+		})
+	}
+}
+
+func TestConfig_FeatureEnabled(t *testing.T) {
+	tests := []struct {
+		name         string
+		featureFlags map[string]bool
+		env          string
+		flag         string
+		want         bool
+	}{
+		{
+			name: "disabled by default",
+			flag: FeatureFlagJSONFG,
+			want: false,
+		},
+		{
+			name:         "enabled in config",
+			featureFlags: map[string]bool{FeatureFlagJSONFG: true},
+			flag:         FeatureFlagJSONFG,
+			want:         true,
+		},
+		{
+			name:         "env overrides config",
+			featureFlags: map[string]bool{FeatureFlagJSONFG: true},
+			env:          "false",
+			flag:         FeatureFlagJSONFG,
+			want:         false,
+		},
+		{
+			name:         "invalid env is ignored",
+			featureFlags: map[string]bool{FeatureFlagJSONFG: true},
+			env:          "maybe",
+			flag:         FeatureFlagJSONFG,
+			want:         true,
+		},
+		{
+			name: "enabled by env",
+			env:  "true",
+			flag: FeatureFlagTemplateVariants,
+			want: true,
+		},
+		{
+			name: "unknown flag",
+			flag: "foo",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv(featureFlagEnvVar(tt.flag), tt.env)
+			}
+			config := &Config{FeatureFlags: tt.featureFlags}
+			assert.Equal(t, tt.want, config.FeatureEnabled(tt.flag))
+		})
+	}
+}
+
+func TestGeoPackageCloud_GetConnection(t *testing.T) {
+	tests := []struct {
+		name  string
+		cloud GeoPackageCloud
+		want  string
+	}{
+		{
+			name:  "raw connection",
+			cloud: GeoPackageCloud{Connection: "azure?emulator=127.0.0.1:10000&sas=0"},
+			want:  "azure?emulator=127.0.0.1:10000&sas=0",
+		},
+		{
+			name:  "azure",
+			cloud: GeoPackageCloud{Type: "azure"},
+			want:  "azure",
+		},
+		{
+			name:  "azure emulator with SAS token",
+			cloud: GeoPackageCloud{Type: "azure", Emulator: ptrTo("azurite:10000"), SAS: true},
+			want:  "azure?emulator=azurite%3A10000&sas=1",
+		},
+		{
+			name:  "google",
+			cloud: GeoPackageCloud{Type: "google", SAS: true},
+			want:  "google",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cloud.GetConnection())
+		})
+	}
+}
+
+func TestGeoPackageCloud_GetCredentials(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_ACCOUNT", "account")
+	t.Setenv("AZURE_STORAGE_KEY", "key")
+	t.Setenv("AZURE_STORAGE_SAS_TOKEN", "token")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "project")
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "access-token")
+
+	tests := []struct {
+		name     string
+		cloud    GeoPackageCloud
+		wantUser string
+		wantAuth string
+	}{
+		{
+			name:     "from config",
+			cloud:    GeoPackageCloud{Type: "azure", User: "devstoreaccount1", Auth: "secret"},
+			wantUser: "devstoreaccount1",
+			wantAuth: "secret",
+		},
+		{
+			name:     "azure key",
+			cloud:    GeoPackageCloud{Type: "azure"},
+			wantUser: "account",
+			wantAuth: "key",
+		},
+		{
+			name:     "azure SAS token",
+			cloud:    GeoPackageCloud{Type: "azure", SAS: true},
+			wantUser: "account",
+			wantAuth: "token",
+		},
+		{
+			name:     "google",
+			cloud:    GeoPackageCloud{Connection: "google"},
+			wantUser: "project",
+			wantAuth: "access-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, auth := tt.cloud.GetCredentials()
+			assert.Equal(t, tt.wantUser, user)
+			assert.Equal(t, tt.wantAuth, auth)
+		})
+	}
+}
+
 func ptrTo[T any](val T) *T {
 	return &val
 }
+
+func TestConfig_Redacted(t *testing.T) {
+	config := readConfigFile("engine/testdata/config_minimal.yaml")
+	config.Statistics = &Statistics{
+		Token: ptrTo("statistics-token"),
+		Report: &UsageReport{Email: &UsageReportEmail{
+			SMTPServer: "smtp.example.com:587",
+			Username:   ptrTo("gokoala"),
+			Password:   ptrTo("smtp-password"),
+		}},
+	}
+
+	redacted, err := config.Redacted()
+	require.NoError(t, err)
+	assert.NotContains(t, redacted, "statistics-token")
+	assert.NotContains(t, redacted, "smtp-password")
+	assert.Contains(t, redacted, "token: REDACTED")
+	assert.Contains(t, redacted, "password: REDACTED")
+	assert.Contains(t, redacted, "username: gokoala")
+	assert.Contains(t, redacted, "baseUrl: "+config.BaseURL.String())
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"log"
+	"sort"
+)
+
+const (
+	// ConformanceClassFeaturesCRS OGC API Features - Part 2: Coordinate Reference Systems by Reference
+	ConformanceClassFeaturesCRS = "http://www.opengis.net/spec/ogcapi-features-2/1.0/conf/crs"
+
+	// ConformanceClassFeaturesFilter OGC API Features - Part 3: Filtering (using CQL2). Implies the
+	// features-filter, cql2-text and basic-cql2 classes, since these are required to support filtering.
+	ConformanceClassFeaturesFilter         = "http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/filter"
+	ConformanceClassFeaturesFeaturesFilter = "http://www.opengis.net/spec/ogcapi-features-3/1.0/conf/features-filter"
+	ConformanceClassCQL2Text               = "http://www.opengis.net/spec/cql2/1.0/conf/cql2-text"
+	ConformanceClassBasicCQL2              = "http://www.opengis.net/spec/cql2/1.0/conf/basic-cql2"
+
+	// ConformanceClassAdvancedComparisonOperators CQL2 LIKE, BETWEEN and IN operators
+	ConformanceClassAdvancedComparisonOperators = "http://www.opengis.net/spec/cql2/1.0/conf/advanced-comparison-operators"
+
+	// ConformanceClassBasicSpatialFunctions CQL2 S_INTERSECTS function
+	ConformanceClassBasicSpatialFunctions = "http://www.opengis.net/spec/cql2/1.0/conf/basic-spatial-functions"
+
+	// ConformanceClassSpatialFunctions all CQL2 spatial functions (e.g. S_WITHIN, S_CONTAINS)
+	ConformanceClassSpatialFunctions = "http://www.opengis.net/spec/cql2/1.0/conf/spatial-functions"
+)
+
+type optionalConformanceClass struct {
+	enabledByDefault bool
+
+	// class which should be enabled as well, e.g. CQL2 extensions require filtering
+	requires string
+}
+
+// optional conformance classes which can be toggled in the config
+var optionalConformanceClasses = map[string]optionalConformanceClass{
+	ConformanceClassFeaturesCRS:                 {enabledByDefault: true},
+	ConformanceClassFeaturesFilter:              {enabledByDefault: true},
+	ConformanceClassAdvancedComparisonOperators: {enabledByDefault: true, requires: ConformanceClassFeaturesFilter},
+	ConformanceClassBasicSpatialFunctions:       {enabledByDefault: true, requires: ConformanceClassFeaturesFilter},
+	ConformanceClassSpatialFunctions:            {enabledByDefault: true, requires: ConformanceClassBasicSpatialFunctions},
+}
+
+// conformance classes which can't be toggled themselves, but are enabled along with another (optional) class
+var impliedConformanceClasses = map[string]string{
+	ConformanceClassFeaturesFeaturesFilter: ConformanceClassFeaturesFilter,
+	ConformanceClassCQL2Text:               ConformanceClassFeaturesFilter,
+	ConformanceClassBasicCQL2:              ConformanceClassFeaturesFilter,
+}
+
+// ConformanceClasses URIs of the optional (and implied) conformance classes, for use in templates
+// (e.g. {{ $cc := conformanceClasses }} ... {{ .Config.ConformanceClassEnabled $cc.FeaturesCRS }})
+type ConformanceClasses struct {
+	FeaturesCRS                 string
+	FeaturesFilter              string
+	FeaturesFeaturesFilter      string
+	CQL2Text                    string
+	BasicCQL2                   string
+	AdvancedComparisonOperators string
+	BasicSpatialFunctions       string
+	SpatialFunctions            string
+}
+
+func conformanceClasses() ConformanceClasses {
+	return ConformanceClasses{
+		FeaturesCRS:                 ConformanceClassFeaturesCRS,
+		FeaturesFilter:              ConformanceClassFeaturesFilter,
+		FeaturesFeaturesFilter:      ConformanceClassFeaturesFeaturesFilter,
+		CQL2Text:                    ConformanceClassCQL2Text,
+		BasicCQL2:                   ConformanceClassBasicCQL2,
+		AdvancedComparisonOperators: ConformanceClassAdvancedComparisonOperators,
+		BasicSpatialFunctions:       ConformanceClassBasicSpatialFunctions,
+		SpatialFunctions:            ConformanceClassSpatialFunctions,
+	}
+}
+
+// ConformanceClassEnabled returns true when the given optional conformance class is enabled, either
+// explicitly in the config or by default, and the class it requires is enabled as well. The conformance
+// document, OpenAPI spec and validation of query parameters should all consult this.
+func (c *Config) ConformanceClassEnabled(class string) bool {
+	if implied, ok := impliedConformanceClasses[class]; ok {
+		return c.ConformanceClassEnabled(implied)
+	}
+	optional, ok := optionalConformanceClasses[class]
+	if !ok {
+		return false
+	}
+	enabled := optional.enabledByDefault
+	if configured, ok := c.Conformance[class]; ok {
+		enabled = configured
+	}
+	return enabled && (optional.requires == "" || c.ConformanceClassEnabled(optional.requires))
+}
+
+func validateConformance(config *Config) {
+	for class := range config.Conformance {
+		if _, ok := optionalConformanceClasses[class]; !ok {
+			supported := make([]string, 0, len(optionalConformanceClasses))
+			for optional := range optionalConformanceClasses {
+				supported = append(supported, optional)
+			}
+			sort.Strings(supported)
+			log.Fatalf("invalid config file provided:\n conformance class %s is unknown or can't be "+
+				"enabled/disabled, supported classes are: %v", class, supported)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package engine
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"sync"
 
 	"github.com/elnormous/contenttype"
 	"golang.org/x/text/language"
@@ -21,8 +24,21 @@ const (
 	MediaTypeSLD           = "application/vnd.ogc.sld+xml;version=1.0"
 	MediaTypeOpenAPI       = "application/vnd.oai.openapi+json;version=3.0"
 	MediaTypeGeoJSON       = "application/geo+json"
+	MediaTypeGeoJSONSeq    = "application/geo+json-seq"    // https://www.rfc-editor.org/rfc/rfc8142
 	MediaTypeJSONFG        = "application/vnd.ogc.fg+json" // https://docs.ogc.org/per/21-017r1.html#toc17
+	MediaTypeJSONLD        = "application/ld+json"
+	MediaTypeTurtle        = "text/turtle"
+	MediaTypeNTriples      = "application/n-triples"
+	MediaTypeGML           = "application/gml+xml;version=3.2"
+	MediaTypeCSV           = "text/csv"
+	MediaTypeFlatGeobuf    = "application/flatgeobuf"
+	MediaTypeGeoParquet    = "application/vnd.apache.parquet"
+	MediaTypeKML           = "application/vnd.google-earth.kml+xml"
+	MediaTypeKMZ           = "application/vnd.google-earth.kmz"
 	MediaTypeQuantizedMesh = "application/vnd.quantized-mesh"
+	MediaTypeProblemJSON   = "application/problem+json"
+	MediaTypeWebManifest   = "application/manifest+json"
+	MediaTypeSVG           = "image/svg+xml"
 
 	FormatHTML        = "html"
 	FormatJSON        = "json"
@@ -33,48 +49,126 @@ const (
 	FormatSLD         = "sld10"
 	FormatGeoJSON     = "geojson" // ?=json should also work for geojson
 	FormatJSONFG      = "jsonfg"
+	FormatJSONLD      = "jsonld"
+	FormatTurtle      = "ttl"
+	FormatNTriples    = "nt"
+	FormatGML         = "gml"
+	FormatCSV         = "csv"
+	FormatFlatGeobuf  = "fgb"
+	FormatGeoParquet  = "parquet"
+	FormatKML         = "kml"
+	FormatKMZ         = "kmz"
+	FormatGeoJSONSeq  = "geojsonseq"
 )
 
+// Format an output format known to content negotiation, see RegisterFormat
+type Format struct {
+	// Name of the format, e.g. json. Used in the f query param and as extension
+	// of the templates which render this format (e.g. landing-page.go.json)
+	Name string
+
+	// MediaType of the format, e.g. application/json. Used in the Content-Type header of responses
+	MediaType string
+
+	// Extension of files in this format, e.g. .json. Optional
+	Extension string
+
+	// Negotiable when true the format can also be requested using the Accept header, otherwise
+	// only using the f query param (e.g. since clients send the media type for another format)
+	Negotiable bool
+}
+
+// built-in formats, negotiable formats are in order of preference
+var builtinFormats = []Format{
+	{Name: FormatJSON, MediaType: MediaTypeJSON, Extension: ".json", Negotiable: true},
+	{Name: FormatHTML, MediaType: MediaTypeHTML, Extension: ".html", Negotiable: true},
+	{Name: FormatTileJSON, MediaType: MediaTypeTileJSON, Extension: ".json", Negotiable: true},
+	{Name: FormatMVT, MediaType: MediaTypeMVT, Extension: ".pbf", Negotiable: true},
+	{Name: FormatMapboxStyle, MediaType: MediaTypeMapboxStyle, Extension: ".json", Negotiable: true},
+	{Name: FormatCustomStyle, MediaType: MediaTypeCustomStyle, Extension: ".style", Negotiable: true},
+	{Name: FormatSLD, MediaType: MediaTypeSLD, Extension: ".sld", Negotiable: true},
+	{Name: FormatJSONLD, MediaType: MediaTypeJSONLD, Extension: ".jsonld", Negotiable: true},
+	{Name: FormatTurtle, MediaType: MediaTypeTurtle, Extension: ".ttl", Negotiable: true},
+	{Name: FormatNTriples, MediaType: MediaTypeNTriples, Extension: ".nt", Negotiable: true},
+	{Name: FormatGML, MediaType: MediaTypeGML, Extension: ".gml", Negotiable: true},
+	{Name: FormatCSV, MediaType: MediaTypeCSV, Extension: ".csv", Negotiable: true},
+	{Name: FormatFlatGeobuf, MediaType: MediaTypeFlatGeobuf, Extension: ".fgb", Negotiable: true},
+	{Name: FormatGeoParquet, MediaType: MediaTypeGeoParquet, Extension: ".parquet", Negotiable: true},
+	{Name: FormatKML, MediaType: MediaTypeKML, Extension: ".kml", Negotiable: true},
+	{Name: FormatKMZ, MediaType: MediaTypeKMZ, Extension: ".kmz", Negotiable: true},
+	{Name: FormatGeoJSONSeq, MediaType: MediaTypeGeoJSONSeq, Extension: ".geojsons", Negotiable: true},
+	{Name: FormatGeoJSON, MediaType: MediaTypeGeoJSON, Extension: ".geojson"},
+	{Name: FormatJSONFG, MediaType: MediaTypeJSONFG, Extension: ".json"},
+}
+
 type ContentNegotiation struct {
+	availableLanguages []language.Tag
+	defaultLanguage    language.Tag
+
+	mu                  sync.RWMutex
 	availableMediaTypes []contenttype.MediaType
-	availableLanguages  []language.Tag
+	formatsByName       map[string]Format
+	formatsByMediaType  map[string]string
+}
 
-	formatsByMediaType map[string]string
-	mediaTypesByFormat map[string]string
+func newContentNegotiation(availableLanguages []language.Tag, defaultLanguage language.Tag) *ContentNegotiation {
+	cn := &ContentNegotiation{
+		availableLanguages: availableLanguages,
+		defaultLanguage:    defaultLanguage,
+		formatsByName:      make(map[string]Format),
+		formatsByMediaType: make(map[string]string),
+	}
+	for _, format := range builtinFormats {
+		if err := cn.RegisterFormat(format); err != nil {
+			log.Fatalf("failed to register format: %v", err)
+		}
+	}
+	return cn
 }
 
-func newContentNegotiation(availableLanguages []language.Tag) *ContentNegotiation {
-	availableMediaTypes := []contenttype.MediaType{
-		// in order
-		contenttype.NewMediaType(MediaTypeJSON),
-		contenttype.NewMediaType(MediaTypeHTML),
-		contenttype.NewMediaType(MediaTypeTileJSON),
-		contenttype.NewMediaType(MediaTypeMVT),
-		contenttype.NewMediaType(MediaTypeMapboxStyle),
-		contenttype.NewMediaType(MediaTypeCustomStyle),
-		contenttype.NewMediaType(MediaTypeSLD),
+// RegisterFormat adds an output format to content negotiation, so modules (or plugins) can support
+// additional formats without changes to the engine. The format can be requested using the f query param
+// and - when negotiable - the Accept header. Responses are rendered from templates with the name of the
+// format as extension (HTML templates are only used for html, text templates for all other formats).
+// Registering the same format twice is allowed, conflicting registrations are not.
+func (cn *ContentNegotiation) RegisterFormat(format Format) error {
+	if format.Name == "" || format.MediaType == "" {
+		return fmt.Errorf("format requires a name and media type, got %+v", format)
 	}
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
 
-	formatsByMediaType := map[string]string{
-		MediaTypeJSON:        FormatJSON,
-		MediaTypeHTML:        FormatHTML,
-		MediaTypeTileJSON:    FormatTileJSON,
-		MediaTypeGeoJSON:     FormatGeoJSON,
-		MediaTypeJSONFG:      FormatJSONFG,
-		MediaTypeMVT:         FormatMVT,
-		MediaTypeMapboxStyle: FormatMapboxStyle,
-		MediaTypeCustomStyle: FormatCustomStyle,
-		MediaTypeSLD:         FormatSLD,
+	if existing, ok := cn.formatsByName[format.Name]; ok {
+		if existing != format {
+			return fmt.Errorf("format %s is already registered as %+v", format.Name, existing)
+		}
+		return nil
 	}
+	if existing, ok := cn.formatsByMediaType[format.MediaType]; ok {
+		return fmt.Errorf("media type %s is already registered for format %s", format.MediaType, existing)
+	}
+	cn.formatsByName[format.Name] = format
+	cn.formatsByMediaType[format.MediaType] = format.Name
+	if format.Negotiable {
+		cn.availableMediaTypes = append(cn.availableMediaTypes, contenttype.NewMediaType(format.MediaType))
+	}
+	return nil
+}
 
-	mediaTypesByFormat := reverseMap(formatsByMediaType)
+// GetFormat returns the registered format by name
+func (cn *ContentNegotiation) GetFormat(name string) (Format, bool) {
+	cn.mu.RLock()
+	defer cn.mu.RUnlock()
+	format, ok := cn.formatsByName[name]
+	return format, ok
+}
 
-	return &ContentNegotiation{
-		availableMediaTypes: availableMediaTypes,
-		availableLanguages:  availableLanguages,
-		formatsByMediaType:  formatsByMediaType,
-		mediaTypesByFormat:  mediaTypesByFormat,
-	}
+// GetFormatByMediaType returns the name of the registered format with the given media type
+func (cn *ContentNegotiation) GetFormatByMediaType(mediaType string) (string, bool) {
+	cn.mu.RLock()
+	defer cn.mu.RUnlock()
+	format, ok := cn.formatsByMediaType[mediaType]
+	return format, ok
 }
 
 func (cn *ContentNegotiation) GetSupportedStyleFormats() []string {
@@ -82,25 +176,27 @@ func (cn *ContentNegotiation) GetSupportedStyleFormats() []string {
 }
 
 func (cn *ContentNegotiation) GetStyleFormatExtension(format string) string {
-	extensionsByFormat := map[string]string{
-		FormatMapboxStyle: ".json",
-		FormatCustomStyle: ".style",
-		FormatSLD:         ".sld",
-	}
-	if extension, exists := extensionsByFormat[format]; exists {
-		return extension
+	if slices.Contains(cn.GetSupportedStyleFormats(), format) {
+		if f, ok := cn.GetFormat(format); ok {
+			return f.Extension
+		}
 	}
 	return ""
 }
 
-// NegotiateFormat performs content negotiation, not idempotent (since it removes the ?f= param)
+// NegotiateFormat performs content negotiation, not idempotent (since it removes the ?f= param).
+// Only formats available according to the FormatRule of the route are negotiated, see Formats.
 func (cn *ContentNegotiation) NegotiateFormat(req *http.Request) string {
+	rule := formatRuleFromContext(req.Context())
 	requestedFormat := cn.getFormatFromQueryParam(req)
-	if requestedFormat == "" {
-		requestedFormat = cn.getFormatFromAcceptHeader(req)
+	if requestedFormat == "" && (rule == nil || rule.Default == nil || req.Header.Get("Accept") != "") {
+		requestedFormat = cn.getFormatFromAcceptHeader(req, rule)
 	}
 	if requestedFormat == "" {
 		requestedFormat = FormatJSON // default
+		if rule != nil && rule.Default != nil {
+			requestedFormat = *rule.Default
+		}
 	}
 	return requestedFormat
 }
@@ -115,13 +211,14 @@ func (cn *ContentNegotiation) NegotiateLanguage(w http.ResponseWriter, req *http
 		requestedLanguage = cn.getLanguageFromHeader(req)
 	}
 	if requestedLanguage == language.Und {
-		requestedLanguage = language.Dutch // default
+		requestedLanguage = cn.defaultLanguage
 	}
 	return requestedLanguage
 }
 
 func (cn *ContentNegotiation) formatToMediaType(format string) string {
-	return cn.mediaTypesByFormat[format]
+	f, _ := cn.GetFormat(format)
+	return f.MediaType
 }
 
 func (cn *ContentNegotiation) getFormatFromQueryParam(req *http.Request) string {
@@ -137,13 +234,42 @@ func (cn *ContentNegotiation) getFormatFromQueryParam(req *http.Request) string
 	return requestedFormat
 }
 
-func (cn *ContentNegotiation) getFormatFromAcceptHeader(req *http.Request) string {
-	accepted, _, err := contenttype.GetAcceptableMediaType(req, cn.availableMediaTypes)
+func (cn *ContentNegotiation) getFormatFromAcceptHeader(req *http.Request, rule *FormatRule) string {
+	cn.mu.RLock()
+	availableMediaTypes := cn.availableMediaTypes
+	if rule != nil {
+		availableMediaTypes = cn.allowedMediaTypes(rule)
+	}
+	cn.mu.RUnlock()
+	if len(availableMediaTypes) == 0 {
+		return ""
+	}
+
+	accepted, _, err := contenttype.GetAcceptableMediaType(req, availableMediaTypes)
 	if err != nil {
 		log.Printf("Failed to parse Accept header: %v. Continuing\n", err)
 		return ""
 	}
-	return cn.formatsByMediaType[accepted.String()]
+	format, _ := cn.GetFormatByMediaType(accepted.String())
+	return format
+}
+
+// allowedMediaTypes negotiable media types of the formats allowed by the given rule,
+// the default format of the rule is preferred (e.g. for Accept: */*). Requires a read lock.
+func (cn *ContentNegotiation) allowedMediaTypes(rule *FormatRule) []contenttype.MediaType {
+	result := make([]contenttype.MediaType, 0, len(cn.availableMediaTypes))
+	for _, mediaType := range cn.availableMediaTypes {
+		format := cn.formatsByMediaType[mediaType.String()]
+		if !rule.Allows(format) {
+			continue
+		}
+		if rule.Default != nil && *rule.Default == format {
+			result = append([]contenttype.MediaType{mediaType}, result...)
+		} else {
+			result = append(result, mediaType)
+		}
+	}
+	return result
 }
 
 func (cn *ContentNegotiation) getLanguageFromQueryParam(w http.ResponseWriter, req *http.Request) language.Tag {
@@ -155,9 +281,7 @@ func (cn *ContentNegotiation) getLanguageFromQueryParam(w http.ResponseWriter, r
 		if err != nil {
 			return requestedLanguage
 		}
-		m := language.NewMatcher(cn.availableLanguages)
-		_, langIndex, _ := m.Match(accepted...)
-		requestedLanguage = cn.availableLanguages[langIndex]
+		requestedLanguage = cn.matchLanguage(accepted)
 		// override for use in cookie
 		lang = requestedLanguage.String()
 
@@ -194,10 +318,7 @@ func (cn *ContentNegotiation) getLanguageFromCookie(req *http.Request) language.
 	if err != nil {
 		return requestedLanguage
 	}
-	m := language.NewMatcher(cn.availableLanguages)
-	_, langIndex, _ := m.Match(accepted...)
-	requestedLanguage = cn.availableLanguages[langIndex]
-	return requestedLanguage
+	return cn.matchLanguage(accepted)
 }
 
 func (cn *ContentNegotiation) getLanguageFromHeader(req *http.Request) language.Tag {
@@ -208,17 +329,18 @@ func (cn *ContentNegotiation) getLanguageFromHeader(req *http.Request) language.
 			log.Printf("Failed to parse Accept-Language header: %v. Continuing\n", err)
 			return requestedLanguage
 		}
-		m := language.NewMatcher(cn.availableLanguages)
-		_, langIndex, _ := m.Match(accepted...)
-		requestedLanguage = cn.availableLanguages[langIndex]
+		requestedLanguage = cn.matchLanguage(accepted)
 	}
 	return requestedLanguage
 }
 
-func reverseMap(input map[string]string) map[string]string {
-	output := make(map[string]string)
-	for k, v := range input {
-		output[v] = k
+// matchLanguage returns the available language which best matches the given accepted languages,
+// or the default language when none of the available languages match
+func (cn *ContentNegotiation) matchLanguage(accepted []language.Tag) language.Tag {
+	m := language.NewMatcher(cn.availableLanguages)
+	_, langIndex, confidence := m.Match(accepted...)
+	if confidence == language.No {
+		return cn.defaultLanguage
 	}
-	return output
+	return cn.availableLanguages[langIndex]
 }
@@ -6,12 +6,13 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/text/language"
 )
 
 func TestContentNegotiation_NegotiateFormat(t *testing.T) {
 	// given
-	cn := newContentNegotiation([]language.Tag{language.Dutch, language.English})
+	cn := newContentNegotiation([]language.Tag{language.Dutch, language.English}, language.Dutch)
 	chromeAcceptHeader := "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9"
 
 	// when/then
@@ -23,6 +24,16 @@ func TestContentNegotiation_NegotiateFormat(t *testing.T) {
 	testFormat(t, cn, "application/json", "http://pdok.example/ogc/api?f=json", "json")
 	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=json", "json")
 	testFormat(t, cn, "application/xml, application/json, text/css, text/html", "http://pdok.example/ogc/api/", "json")
+	testFormat(t, cn, "application/gml+xml", "http://pdok.example/ogc/api", "gml")
+	testFormat(t, cn, "application/gml+xml;version=3.2", "http://pdok.example/ogc/api", "gml")
+	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=gml", "gml")
+	testFormat(t, cn, "application/flatgeobuf", "http://pdok.example/ogc/api", "fgb")
+	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=fgb", "fgb")
+	testFormat(t, cn, "application/vnd.apache.parquet", "http://pdok.example/ogc/api", "parquet")
+	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=parquet", "parquet")
+	testFormat(t, cn, "application/vnd.google-earth.kml+xml", "http://pdok.example/ogc/api", "kml")
+	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=kmz", "kmz")
+	testFormat(t, cn, "application/geo+json-seq", "http://pdok.example/ogc/api", "geojsonseq")
 	testLanguage(t, cn, "nl;q=1", "http://pdok.example/ogc/api", language.Dutch)
 	testLanguage(t, cn, "fr;q=0.8, de;q=0.5", "http://pdok.example/ogc/api", language.Dutch)
 	testLanguage(t, cn, "en;q=1", "http://pdok.example/ogc/api", language.English)
@@ -31,6 +42,18 @@ func TestContentNegotiation_NegotiateFormat(t *testing.T) {
 	testLanguage(t, cn, "", "http://pdok.example/ogc/api?lang=en", language.English)
 }
 
+func TestContentNegotiation_NegotiateLanguageDefault(t *testing.T) {
+	// given
+	frisian := language.MustParse("fy")
+	cn := newContentNegotiation([]language.Tag{language.English, language.Dutch, frisian}, frisian)
+
+	// when/then
+	testLanguage(t, cn, "", "http://pdok.example/ogc/api", frisian)
+	testLanguage(t, cn, "fr;q=0.8, de;q=0.5", "http://pdok.example/ogc/api", frisian)
+	testLanguage(t, cn, "nl;q=1", "http://pdok.example/ogc/api", language.Dutch)
+	testLanguage(t, cn, "", "http://pdok.example/ogc/api?lang=en", language.English)
+}
+
 func testFormat(t *testing.T, cn *ContentNegotiation, acceptHeader string, givenURL string, expectedFormat string) {
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, givenURL, nil)
 	req.Header.Set("Accept", acceptHeader)
@@ -54,3 +77,44 @@ func testLanguage(t *testing.T, cn *ContentNegotiation, acceptLanguageHeader str
 		t.Fatalf("Expected %v for input %s, got %v", expectedLanguage, givenURL, language)
 	}
 }
+
+func TestContentNegotiation_RegisterFormat(t *testing.T) {
+	cn := newContentNegotiation([]language.Tag{language.Dutch}, language.Dutch)
+	csv := Format{Name: "csv", MediaType: "text/csv", Extension: ".csv", Negotiable: true}
+
+	tests := []struct {
+		name    string
+		format  Format
+		wantErr bool
+	}{
+		{name: "new format", format: csv},
+		{name: "same format again", format: csv},
+		{name: "missing media type", format: Format{Name: "foo"}, wantErr: true},
+		{name: "conflicting media type", format: Format{Name: "comma", MediaType: "text/csv"}, wantErr: true},
+		{name: "conflicting format", format: Format{Name: FormatJSON, MediaType: "application/vnd.foo+json"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cn.RegisterFormat(tt.format)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	testFormat(t, cn, "text/csv", "http://pdok.example/ogc/api", "csv")
+	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=csv", "csv")
+	testFormat(t, cn, "application/json", "http://pdok.example/ogc/api", "json")
+	assert.Equal(t, "text/csv", cn.formatToMediaType("csv"))
+	format, ok := cn.GetFormatByMediaType("text/csv")
+	assert.True(t, ok)
+	assert.Equal(t, "csv", format)
+
+	// non-negotiable formats are only available using the f query param
+	testFormat(t, cn, MediaTypeGeoJSON, "http://pdok.example/ogc/api", "json")
+	testFormat(t, cn, "", "http://pdok.example/ogc/api?f=jsonfg", "jsonfg")
+	assert.Equal(t, ".sld", cn.GetStyleFormatExtension(FormatSLD))
+	assert.Equal(t, "", cn.GetStyleFormatExtension("csv"))
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Deprecation middleware adds Deprecation, Sunset and Link headers to responses of routes
+// which are deprecated according to the config. When multiple deprecations match a route
+// the most specific (the one with the longest path) is used.
+func (e *Engine) Deprecation(next http.Handler) http.Handler {
+	deprecations := make([]Deprecation, len(e.Config.Deprecations))
+	copy(deprecations, e.Config.Deprecations)
+	sort.SliceStable(deprecations, func(i, j int) bool {
+		return len(deprecations[i].Path) > len(deprecations[j].Path)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, deprecation := range deprecations {
+			if deprecation.matches(r.URL.Path) {
+				deprecation.setHeaders(w)
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Deprecation) matches(path string) bool {
+	prefix := strings.TrimSuffix(d.Path, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (d *Deprecation) setHeaders(w http.ResponseWriter) {
+	// see https://www.rfc-editor.org/rfc/rfc9745.html (structured field date)
+	w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+	if d.Sunset != nil {
+		// see https://www.rfc-editor.org/rfc/rfc8594.html (HTTP date)
+		w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Successor != nil && d.Successor.URL != nil {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, d.Successor.String()))
+	}
+	if d.Info != nil && d.Info.URL != nil {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, d.Info.String()))
+	}
+}
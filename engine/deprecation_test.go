@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Deprecation(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+	successor, _ := url.Parse("https://example.com/v2/collections/foo")
+	engine := &Engine{Config: &Config{Deprecations: []Deprecation{
+		{Since: since},
+		{Path: "/collections/foo", Since: since, Sunset: &sunset, Successor: &YAMLURL{successor}},
+	}}}
+	handler := engine.Deprecation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name            string
+		path            string
+		wantDeprecation string
+		wantSunset      string
+		wantLink        string
+	}{
+		{
+			name:            "deprecated route",
+			path:            "/collections/foo/items",
+			wantDeprecation: "@1704067200",
+			wantSunset:      "Tue, 31 Dec 2024 00:00:00 GMT",
+			wantLink:        `<https://example.com/v2/collections/foo>; rel="successor-version"`,
+		},
+		{
+			name:            "route deprecated as part of whole API",
+			path:            "/collections/foobar",
+			wantDeprecation: "@1704067200",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+tt.path, nil)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tt.wantDeprecation, recorder.Header().Get("Deprecation"))
+			assert.Equal(t, tt.wantSunset, recorder.Header().Get("Sunset"))
+			assert.Equal(t, tt.wantLink, recorder.Header().Get("Link"))
+		})
+	}
+}
+
+func TestEngine_NoDeprecation(t *testing.T) {
+	engine := &Engine{Config: &Config{}}
+	handler := engine.Deprecation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/collections", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Empty(t, recorder.Header().Get("Deprecation"))
+	assert.Empty(t, recorder.Header().Get("Sunset"))
+}
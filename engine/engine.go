@@ -5,14 +5,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	htmltemplate "html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	texttemplate "text/template"
 	"time"
@@ -33,7 +36,15 @@ type Engine struct {
 	Templates *Templates
 	CN        *ContentNegotiation
 
-	shutdownHooks []func()
+	shutdownHooks   []ShutdownHook
+	healthChecks    map[string]HealthCheck
+	warmupTasks     []WarmupTask
+	attachedWarmups []*Engine
+	warmingUp       atomic.Bool
+	errorReporters  []ErrorReporter
+	statistics      *StatisticsCollector
+	accessLog       *accessLogger
+	breadcrumbs     map[string]Breadcrumb
 }
 
 // NewEngine builds a new Engine
@@ -43,7 +54,7 @@ func NewEngine(configFile string, openAPIFile string) *Engine {
 
 // NewEngineWithConfig builds a new Engine
 func NewEngineWithConfig(config *Config, openAPIFile string) *Engine {
-	contentNegotiation := newContentNegotiation(config.AvailableLanguages)
+	contentNegotiation := newContentNegotiation(config.AvailableLanguages, config.DefaultLanguage())
 	templates := newTemplates(config)
 	openAPI := newOpenAPI(config, openAPIFile)
 
@@ -53,19 +64,44 @@ func NewEngineWithConfig(config *Config, openAPIFile string) *Engine {
 		Templates: templates,
 		CN:        contentNegotiation,
 	}
+	if config.Statistics != nil {
+		engine.statistics = newStatisticsCollector(config.Statistics, contentNegotiation)
+		if config.Statistics.Report != nil {
+			engine.startUsageReports()
+		}
+	}
+	if config.AccessLog != nil {
+		accessLog, err := newAccessLogger(config.AccessLog, config.ServiceIdentifier)
+		if err != nil {
+			log.Fatalf("failed to start access log: %v", err)
+		}
+		engine.accessLog = accessLog
+		engine.RegisterShutdownHook(ShutdownHook{Name: "access log", Func: accessLog.close, Timeout: accessLogTimeout})
+	}
+	if config.Warmup != nil {
+		engine.warmingUp.Store(true) // at least the slow start delay, see RegisterWarmupTask
+	}
 	return engine
 }
 
 // Start the engine by initializing all components and starting the server
-func (e *Engine) Start(address string, router *chi.Mux, debugPort int, shutdownDelay int) error {
+func (e *Engine) Start(address string, handler http.Handler, debugPort int, shutdownDelay int, reusePort bool) error {
 	// debug server (binds to localhost).
 	if debugPort > 0 {
 		go func() {
 			debugAddress := fmt.Sprintf("localhost:%d", debugPort)
+			debugListener, err := net.Listen("tcp", debugAddress)
+			if err != nil {
+				log.Fatalf("debug server failed %v", err)
+			}
 			debugRouter := chi.NewRouter()
 			debugRouter.Use(middleware.Logger)
 			debugRouter.Mount("/debug", middleware.Profiler())
-			err := e.startServer("debug server", debugAddress, 0, debugRouter)
+			if e.statistics != nil {
+				debugRouter.Get("/statistics", e.statistics.ServeJSON())
+				debugRouter.Get("/metrics", e.statistics.ServeMetrics())
+			}
+			err = e.startServer("debug server", debugListener, 0, debugRouter)
 			if err != nil {
 				log.Fatalf("debug server failed %v", err)
 			}
@@ -73,15 +109,25 @@ func (e *Engine) Start(address string, router *chi.Mux, debugPort int, shutdownD
 	}
 
 	// main server
-	return e.startServer("main server", address, shutdownDelay, router)
+	listener, err := newListener(address, reusePort)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	warmupCtx, cancelWarmup := context.WithCancel(context.Background())
+	e.startWarmup(warmupCtx) // readiness is reported once warmed up, liveness is reported right away
+	err = e.startServer("main server", listener, shutdownDelay, handler)
+	cancelWarmup()
+
+	// execute shutdown hooks (e.g. closing datasources) once all in-flight requests are handled
+	e.runShutdownHooks(context.Background())
+	return err
 }
 
 // startServer creates and starts an HTTP server, also takes care of graceful shutdown
-func (e *Engine) startServer(name string, address string, shutdownDelay int, router *chi.Mux) error {
+func (e *Engine) startServer(name string, listener net.Listener, shutdownDelay int, handler http.Handler) error {
 	// create HTTP server
 	server := http.Server{
-		Addr:    address,
-		Handler: router,
+		Handler: handler,
 
 		ReadTimeout:       15 * time.Second,
 		ReadHeaderTimeout: 15 * time.Second,
@@ -91,10 +137,10 @@ func (e *Engine) startServer(name string, address string, shutdownDelay int, rou
 	defer stop()
 
 	go func() {
-		log.Printf("%s listening on %s", name, address)
-		// ListenAndServe always returns a non-nil error. After Shutdown or
+		log.Printf("%s listening on %s", name, listener.Addr())
+		// Serve always returns a non-nil error. After Shutdown or
 		// Close, the returned error is ErrServerClosed
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("failed to shutdown %s: %v", name, err)
 		}
 	}()
@@ -103,11 +149,6 @@ func (e *Engine) startServer(name string, address string, shutdownDelay int, rou
 	<-ctx.Done()
 	stop()
 
-	// execute shutdown hooks
-	for _, shutdownHook := range e.shutdownHooks {
-		shutdownHook()
-	}
-
 	if shutdownDelay > 0 {
 		log.Printf("stop signal received, initiating shutdown of %s after %d seconds delay", name, shutdownDelay)
 		time.Sleep(time.Duration(shutdownDelay) * time.Second)
@@ -120,10 +161,6 @@ func (e *Engine) startServer(name string, address string, shutdownDelay int, rou
 	return server.Shutdown(timeoutCtx)
 }
 
-func (e *Engine) RegisterShutdownHook(fn func()) {
-	e.shutdownHooks = append(e.shutdownHooks, fn)
-}
-
 // ParseTemplate parses both HTML and non-HTML templates depending on the format given in the TemplateKey and
 // stores it in the engine for future rendering using RenderAndServePage.
 func (e *Engine) ParseTemplate(key TemplateKey) {
@@ -164,23 +201,25 @@ func (e *Engine) RenderAndServePage(w http.ResponseWriter, r *http.Request, key
 
 	// validate request
 	if err := e.OpenAPI.validateRequest(r); err != nil {
-		log.Printf("%v", err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		RenderError(w, r, BadRequest(err.Error()))
 		return
 	}
 
 	// get template
+	if key.Format == FormatHTML {
+		key.Variant = e.Templates.requestedVariant(w, r)
+	}
 	parsedTemplate, err := e.Templates.getParsedTemplate(key)
 	if err != nil {
-		log.Printf("%v", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		RenderError(w, r, InternalError("", err))
+		return
 	}
 
 	// render output
 	var output []byte
 	if key.Format == FormatHTML {
 		htmlTmpl := parsedTemplate.(*htmltemplate.Template)
-		output = e.Templates.renderHTMLTemplate(htmlTmpl, params, breadcrumbs, "")
+		output = e.Templates.renderHTMLTemplate(htmlTmpl, params, breadcrumbs, isEmbedRequested(r), "")
 	} else {
 		jsonTmpl := parsedTemplate.(*texttemplate.Template)
 		output = e.Templates.renderNonHTMLTemplate(jsonTmpl, params, key, "")
@@ -189,8 +228,7 @@ func (e *Engine) RenderAndServePage(w http.ResponseWriter, r *http.Request, key
 
 	// validate response
 	if err := e.OpenAPI.validateResponse(contentType, output, r); err != nil {
-		log.Printf("%v", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		RenderError(w, r, InternalError("response doesn't conform to OpenAPI spec", err))
 		return
 	}
 
@@ -205,13 +243,16 @@ func (e *Engine) RenderAndServePage(w http.ResponseWriter, r *http.Request, key
 func (e *Engine) ServePage(w http.ResponseWriter, r *http.Request, templateKey TemplateKey) {
 	// validate request
 	if err := e.OpenAPI.validateRequest(r); err != nil {
-		log.Printf("%v", err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		RenderError(w, r, BadRequest(err.Error()))
 		return
 	}
 
 	// render output
-	output, err := e.Templates.getRenderedTemplate(templateKey)
+	if templateKey.Format == FormatHTML {
+		templateKey.Embed = isEmbedRequested(r)
+		templateKey.Variant = e.Templates.requestedVariant(w, r)
+	}
+	output, validators, err := e.Templates.getRenderedTemplateWithValidators(templateKey)
 	if err != nil {
 		http.NotFound(w, r)
 		return
@@ -220,16 +261,43 @@ func (e *Engine) ServePage(w http.ResponseWriter, r *http.Request, templateKey T
 
 	// validate response
 	if err := e.OpenAPI.validateResponse(contentType, output, r); err != nil {
-		log.Printf("%v", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		RenderError(w, r, InternalError("response doesn't conform to OpenAPI spec", err))
 		return
 	}
 
-	// return response output to client
+	// return response output to client, or 304 Not Modified in case of a conditional request
 	if contentType != "" {
 		w.Header().Set("Content-Type", contentType)
 	}
-	SafeWrite(w.Write, output)
+	ServeContent(w, r, output, validators.etag, validators.lastModified)
+}
+
+// ServeContent writes the given content to the client with the given ETag and Last-Modified time. Conditional
+// requests (If-None-Match, If-Modified-Since, etc.) are honored, in which case no content is written.
+func ServeContent(w http.ResponseWriter, r *http.Request, content []byte, etag string, lastModified time.Time) {
+	ServeReader(w, r, bytes.NewReader(content), etag, lastModified)
+}
+
+// ServeReader same as ServeContent, for content which is read incrementally (e.g. large files)
+func ServeReader(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, etag string, lastModified time.Time) {
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", lastModified, content)
+}
+
+// NewETag returns a strong ETag based on the given content
+func NewETag(content []byte) string {
+	hasher := fnv.New64a() // fast non-cryptographic hash
+	hasher.Write(content)
+	return fmt.Sprintf(`"%x"`, hasher.Sum(nil))
+}
+
+// NewETagFromReader same as NewETag, for content which is read incrementally. The reader is consumed.
+func NewETagFromReader(content io.Reader) (string, error) {
+	hasher := fnv.New64a()
+	if _, err := io.Copy(hasher, content); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%x"`, hasher.Sum(nil)), nil
 }
 
 // ReverseProxy forwards given HTTP request to given target server, and optionally tweaks response
@@ -256,7 +324,8 @@ func (e *Engine) ReverseProxy(w http.ResponseWriter, r *http.Request, target *ur
 				proxyRes.Header.Set("Content-Type", contentTypeOverwrite)
 			}
 		}
-		return nil
+		// pass through pre-compressed content without compressing twice, honoring client support
+		return adaptContentEncoding(r, proxyRes)
 	}
 
 	reverseProxy := &httputil.ReverseProxy{Rewrite: rewrite, ModifyResponse: modifyResponse}
@@ -271,7 +340,7 @@ func removeBody(proxyRes *http.Response) {
 }
 
 func (e *Engine) validateStaticResponse(key TemplateKey, urlPath string) {
-	template, _ := e.Templates.getRenderedTemplate(key)
+	template, _ := e.Templates.GetRenderedTemplate(key)
 	serverURL := normalizeBaseURL(e.Config.BaseURL.String())
 	req, err := http.NewRequest(http.MethodGet, serverURL+urlPath, nil)
 	if err != nil {
@@ -291,3 +360,12 @@ func SafeWrite(write func([]byte) (int, error), body []byte) {
 		log.Printf("failed to write response: %v", err)
 	}
 }
+
+// RelativePath returns the path of the request relative to the router on which the handler is registered.
+// This differs from the path in the URL when the API is mounted under a prefix (e.g. using chi's Route or Mount).
+func RelativePath(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		return rctx.RoutePath
+	}
+	return r.URL.Path
+}
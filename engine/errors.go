@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Error an error which translates to a specific HTTP status. Handlers return these errors (see
+// HandleErrors), after which RenderError takes care of logging and the response to the client.
+type Error struct {
+	// HTTP status code of the response
+	Status int
+
+	// message for the client, should be safe to share (no internal error messages, queries, etc.)
+	Detail string
+
+	// optional underlying error, which is logged but never shared with the client
+	Cause error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Detail, e.Cause)
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// BadRequest the request of the client is invalid, the reason is shared with the client
+func BadRequest(detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, Detail: detail}
+}
+
+// Forbidden the client isn't allowed to access the resource
+func Forbidden(detail string) *Error {
+	return &Error{Status: http.StatusForbidden, Detail: detail}
+}
+
+// NotFound the requested resource doesn't exist
+func NotFound(detail string) *Error {
+	return &Error{Status: http.StatusNotFound, Detail: detail}
+}
+
+// NotAcceptable the requested format isn't available
+func NotAcceptable(detail string) *Error {
+	return &Error{Status: http.StatusNotAcceptable, Detail: detail}
+}
+
+// ContentTooLarge the response would be too large, the detail should guide the client to a smaller request
+func ContentTooLarge(detail string) *Error {
+	return &Error{Status: http.StatusRequestEntityTooLarge, Detail: detail}
+}
+
+// InternalError something went wrong on our side, the cause is logged but not shared with the client
+func InternalError(detail string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Detail: detail, Cause: cause}
+}
+
+// UpstreamUnavailable a backend (tile server, processes server, object storage, etc.) failed,
+// the cause is logged but not shared with the client
+func UpstreamUnavailable(detail string, cause error) *Error {
+	return &Error{Status: http.StatusBadGateway, Detail: detail, Cause: cause}
+}
+
+// ErrorHandlerFunc handler which returns errors instead of writing these to the client itself
+type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// HandleErrors adapts the given handler to an http.HandlerFunc, errors are rendered using RenderError
+func HandleErrors(handler ErrorHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := handler(w, r); err != nil {
+			RenderError(w, r, err)
+		}
+	}
+}
+
+// RenderError writes the given error as problem (application/problem+json) to the client. Server
+// errors (5xx) are logged, including their cause. Client errors (4xx) aren't logged since these
+// aren't actionable for us. Errors other than Error are treated as internal errors.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = InternalError("", err)
+	}
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("error while serving %s %s: %v", r.Method, r.URL.String(), apiErr)
+	}
+	RenderProblem(w, apiErr.Status, apiErr.Detail)
+}
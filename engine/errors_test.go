@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "no error",
+			err:      nil,
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "bad request",
+			err:      BadRequest("limit should be a number"),
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"limit should be a number"}`,
+		},
+		{
+			name:     "not found, wrapped",
+			err:      fmt.Errorf("wrapped: %w", NotFound("collection foo doesn't exist")),
+			wantCode: http.StatusNotFound,
+			wantBody: `{"type":"about:blank","title":"Not Found","status":404,"detail":"collection foo doesn't exist"}`,
+		},
+		{
+			name:     "upstream unavailable, cause isn't shared",
+			err:      UpstreamUnavailable("failed to retrieve subtree", errors.New("secret tileserver hostname")),
+			wantCode: http.StatusBadGateway,
+			wantBody: `{"type":"about:blank","title":"Bad Gateway","status":502,"detail":"failed to retrieve subtree"}`,
+		},
+		{
+			name:     "other errors are internal errors",
+			err:      errors.New("secret database password leaked"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: `{"type":"about:blank","title":"Internal Server Error","status":500}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := HandleErrors(func(w http.ResponseWriter, _ *http.Request) error {
+				if tt.err != nil {
+					return tt.err
+				}
+				SafeWrite(w.Write, []byte("ok"))
+				return nil
+			})
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil))
+
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.err != nil {
+				assert.Equal(t, MediaTypeProblemJSON, recorder.Header().Get("Content-Type"))
+				assert.JSONEq(t, tt.wantBody, recorder.Body.String())
+			} else {
+				assert.Equal(t, tt.wantBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestError_Unwrap(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := UpstreamUnavailable("failed to retrieve job results", cause)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "failed to retrieve job results: connection refused", err.Error())
+}
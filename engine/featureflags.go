@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FeatureFlagJSONFG output of features as JSON-FG (f=jsonfg), the spec is still a draft
+	FeatureFlagJSONFG = "jsonfg"
+
+	// FeatureFlagTemplateVariants serve alternative HTML templates by header or cookie, see TemplateVariants in config
+	FeatureFlagTemplateVariants = "template-variants"
+
+	featureFlagEnvPrefix = "GOKOALA_FEATURE_"
+)
+
+// experimental behavior which can be toggled in the config, mapped to whether it's enabled by default
+var featureFlags = map[string]bool{
+	FeatureFlagJSONFG:           false,
+	FeatureFlagTemplateVariants: false,
+}
+
+// FeatureEnabled returns true when the given feature flag is enabled, either by environment variable
+// (e.g. GOKOALA_FEATURE_JSONFG=true), explicitly in the config or by default. The environment variable
+// takes precedence, so operators can opt in (or out) per environment using the same config file.
+func (c *Config) FeatureEnabled(flag string) bool {
+	if value, ok := os.LookupEnv(featureFlagEnvVar(flag)); ok {
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			return enabled
+		}
+		log.Printf("ignoring invalid value '%s' of environment variable %s", value, featureFlagEnvVar(flag))
+	}
+	if enabled, ok := c.FeatureFlags[flag]; ok {
+		return enabled
+	}
+	return featureFlags[flag]
+}
+
+func featureFlagEnvVar(flag string) string {
+	return featureFlagEnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+func validateFeatureFlags(config *Config) {
+	for flag := range config.FeatureFlags {
+		if _, ok := featureFlags[flag]; !ok {
+			supported := make([]string, 0, len(featureFlags))
+			for known := range featureFlags {
+				supported = append(supported, known)
+			}
+			sort.Strings(supported)
+			log.Fatalf("invalid config file provided:\n feature flag %s is unknown, supported flags are: %v", flag, supported)
+		}
+	}
+}
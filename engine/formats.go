@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type contextKey int
+
+const formatRuleContextKey contextKey = iota
+
+// Formats middleware restricts the output formats of routes which match a FormatRule in the config.
+// When multiple rules match a route the most specific (the one with the longest path) is used.
+// Explicitly requesting a format which isn't available (using the f param) results in 406 Not Acceptable,
+// otherwise content negotiation only considers the available formats (see NegotiateFormat).
+func (e *Engine) Formats(next http.Handler) http.Handler {
+	rules := make([]FormatRule, len(e.Config.Formats))
+	copy(rules, e.Config.Formats)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Path) > len(rules[j].Path)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := range rules {
+			rule := &rules[i]
+			if !rule.matches(r.URL.Path) {
+				continue
+			}
+			if format := r.URL.Query().Get(FormatParam); format != "" && !rule.Allows(format) {
+				RenderError(w, r, NotAcceptable(fmt.Sprintf("format %s isn't available for this resource", format)))
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), formatRuleContextKey, rule))
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matches the path (prefix) of the rule against the given path, where * matches any path segment
+func (f *FormatRule) matches(path string) bool {
+	prefix := strings.TrimSuffix(f.Path, "/")
+	if prefix == "" {
+		return true
+	}
+	ruleSegments := strings.Split(prefix, "/")
+	pathSegments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	if len(pathSegments) < len(ruleSegments) {
+		return false
+	}
+	for i, segment := range ruleSegments {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatRuleFromContext returns the FormatRule which applies to the request, if any
+func formatRuleFromContext(ctx context.Context) *FormatRule {
+	rule, _ := ctx.Value(formatRuleContextKey).(*FormatRule)
+	return rule
+}
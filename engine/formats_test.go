@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestEngine_Formats(t *testing.T) {
+	engine := &Engine{
+		Config: &Config{Formats: []FormatRule{
+			{Disallowed: []string{FormatJSONFG}},
+			{Path: "/collections/*/items", Allowed: []string{FormatJSON, FormatGeoJSON, FormatCSV}, Default: ptrTo(FormatCSV)},
+			{Path: "/collections/foo", Disallowed: []string{FormatHTML}},
+		}},
+		CN: newContentNegotiation([]language.Tag{language.Dutch}, language.Dutch),
+	}
+	handler := engine.Formats(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SafeWrite(w.Write, []byte(engine.CN.NegotiateFormat(r)))
+	}))
+	chromeAcceptHeader := "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"
+
+	tests := []struct {
+		name       string
+		url        string
+		accept     string
+		wantStatus int
+		wantFormat string
+	}{
+		{
+			name:       "allowed format",
+			url:        "/collections/bar/items?f=geojson",
+			wantStatus: http.StatusOK,
+			wantFormat: FormatGeoJSON,
+		},
+		{
+			name:       "format not allowed on route",
+			url:        "/collections/bar/items?f=html",
+			wantStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:       "format disallowed on all routes",
+			url:        "/collections?f=jsonfg",
+			wantStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:       "default format without Accept header",
+			url:        "/collections/bar/items",
+			wantStatus: http.StatusOK,
+			wantFormat: FormatCSV,
+		},
+		{
+			name:       "default format preferred for wildcard Accept header",
+			url:        "/collections/bar/items",
+			accept:     "*/*",
+			wantStatus: http.StatusOK,
+			wantFormat: FormatCSV,
+		},
+		{
+			name:       "Accept header only negotiates allowed formats",
+			url:        "/collections/foo",
+			accept:     chromeAcceptHeader,
+			wantStatus: http.StatusOK,
+			wantFormat: FormatJSON,
+		},
+		{
+			name:       "most specific rule wins",
+			url:        "/collections/foo/items?f=csv",
+			wantStatus: http.StatusOK,
+			wantFormat: FormatCSV,
+		},
+		{
+			name:       "Accept header without rule restrictions",
+			url:        "/collections",
+			accept:     chromeAcceptHeader,
+			wantStatus: http.StatusOK,
+			wantFormat: FormatHTML,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantFormat != "" {
+				assert.Equal(t, tt.wantFormat, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestFormatRule_matches(t *testing.T) {
+	tests := []struct {
+		path     string
+		rulePath string
+		want     bool
+	}{
+		{path: "/collections/foo/items", rulePath: "", want: true},
+		{path: "/collections/foo/items", rulePath: "/collections/foo", want: true},
+		{path: "/collections/foobar", rulePath: "/collections/foo", want: false},
+		{path: "/collections/foo/items/1", rulePath: "/collections/*/items", want: true},
+		{path: "/collections/foo", rulePath: "/collections/*/items", want: false},
+		{path: "/tiles/", rulePath: "/tiles/", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rulePath+" "+tt.path, func(t *testing.T) {
+			rule := &FormatRule{Path: tt.rulePath}
+			assert.Equal(t, tt.want, rule.matches(tt.path))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	healthPath         = "/health"
+	readinessPath      = "/health/ready"
+	healthCheckTimeout = 5 * time.Second
+)
+
+// HealthCheck verifies connectivity with a dependency (e.g. a datasource), returns an error when unhealthy
+type HealthCheck func(ctx context.Context) error
+
+// RegisterHealthCheck registers a check which is executed on each readiness request
+func (e *Engine) RegisterHealthCheck(name string, check HealthCheck) {
+	if e.healthChecks == nil {
+		e.healthChecks = make(map[string]HealthCheck)
+	}
+	e.healthChecks[name] = check
+}
+
+// NewHealthEndpoint serves a liveness endpoint (is GoKoala running) and a readiness endpoint
+// (is GoKoala warmed up and can it reach its dependencies, see RegisterWarmupTask and RegisterHealthCheck).
+func NewHealthEndpoint(e *Engine, router chi.Router) {
+	router.Get(healthPath, func(w http.ResponseWriter, _ *http.Request) {
+		SafeWrite(w.Write, []byte("OK"))
+	})
+	router.Get(readinessPath, e.Readiness())
+}
+
+func (e *Engine) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if e.WarmingUp() {
+			http.Error(w, "NOT OK, warming up", http.StatusServiceUnavailable)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		names := make([]string, 0, len(e.healthChecks))
+		for name := range e.healthChecks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var unhealthy []string
+		for _, name := range names {
+			if err := e.healthChecks[name](ctx); err != nil {
+				log.Printf("health check '%s' failed: %v", name, err)
+				unhealthy = append(unhealthy, name)
+			}
+		}
+		if len(unhealthy) > 0 {
+			// only report names of failed checks, not the errors since these may contain internals
+			http.Error(w, fmt.Sprintf("NOT OK, unhealthy: %s", strings.Join(unhealthy, ", ")), http.StatusServiceUnavailable)
+			return
+		}
+		SafeWrite(w.Write, []byte("OK"))
+	}
+}
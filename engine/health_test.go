@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthEndpoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		healthChecks   map[string]HealthCheck
+		warmupTasks    []WarmupTask
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "liveness",
+			path:           "/health",
+			healthChecks:   map[string]HealthCheck{"db": func(_ context.Context) error { return errors.New("down") }},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "OK",
+		},
+		{
+			name:           "ready without health checks",
+			path:           "/health/ready",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "OK",
+		},
+		{
+			name: "ready",
+			path: "/health/ready",
+			healthChecks: map[string]HealthCheck{
+				"db": func(_ context.Context) error { return nil },
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "OK",
+		},
+		{
+			name: "not ready",
+			path: "/health/ready",
+			healthChecks: map[string]HealthCheck{
+				"db":    func(_ context.Context) error { return errors.New("secret connection string") },
+				"cache": func(_ context.Context) error { return nil },
+			},
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantBody:       "NOT OK, unhealthy: db\n",
+		},
+		{
+			name:           "not ready while warming up",
+			path:           "/health/ready",
+			warmupTasks:    []WarmupTask{{Name: "smoke query", Func: func(_ context.Context) error { return nil }}},
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantBody:       "NOT OK, warming up\n",
+		},
+		{
+			name:           "alive while warming up",
+			path:           "/health",
+			warmupTasks:    []WarmupTask{{Name: "smoke query", Func: func(_ context.Context) error { return nil }}},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "OK",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &Engine{}
+			for name, check := range tt.healthChecks {
+				engine.RegisterHealthCheck(name, check)
+			}
+			for _, task := range tt.warmupTasks {
+				engine.RegisterWarmupTask(task)
+			}
+			router := chi.NewRouter()
+			NewHealthEndpoint(engine, router)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost:8080"+tt.path, nil))
+
+			assert.Equal(t, tt.wantStatusCode, recorder.Code)
+			assert.Equal(t, tt.wantBody, recorder.Body.String())
+		})
+	}
+}
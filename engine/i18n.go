@@ -1,11 +1,31 @@
 package engine
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/BurntSushi/toml"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
 )
 
+// dateLayouts layouts to format dates and timestamps per language, other
+// languages fall back to ISO-8601 (with a space between date and time for readability)
+var dateLayouts = map[language.Tag]dateLayout{
+	language.Dutch: {date: "02-01-2006", dateTime: "02-01-2006 15:04:05 MST"},
+}
+
+var defaultDateLayout = dateLayout{date: "2006-01-02", dateTime: "2006-01-02 15:04:05 MST"}
+
+type dateLayout struct {
+	date     string
+	dateTime string
+}
+
 func newLocalizers(availableLanguages []language.Tag) map[language.Tag]i18n.Localizer {
 	localizers := make(map[language.Tag]i18n.Localizer)
 	// add localizer for each available language
@@ -17,3 +37,103 @@ func newLocalizers(availableLanguages []language.Tag) map[language.Tag]i18n.Loca
 	}
 	return localizers
 }
+
+// formatDate formats the date of the given time (or ISO-8601 string) in the given language.
+// Values which aren't a date are returned as-is.
+func formatDate(value any, lang language.Tag) string {
+	t, ok := toTime(value)
+	if !ok {
+		return toString(value)
+	}
+	return t.Format(getDateLayout(lang).date)
+}
+
+// formatDateTime formats the given time (or ISO-8601 string) in the given language.
+// Values which aren't a date are returned as-is.
+func formatDateTime(value any, lang language.Tag) string {
+	t, ok := toTime(value)
+	if !ok {
+		return toString(value)
+	}
+	return t.Format(getDateLayout(lang).dateTime)
+}
+
+// formatNumber formats the given number with the decimal and grouping separators
+// of the given language, e.g. 1.234,5 in Dutch. Values which aren't a number are returned as-is.
+func formatNumber(value any, lang language.Tag) string {
+	printer := message.NewPrinter(lang)
+	switch v := value.(type) {
+	case int:
+		return printer.Sprint(number.Decimal(v))
+	case int64:
+		return printer.Sprint(number.Decimal(v))
+	case float64:
+		// use the shortest representation of the float to prevent rounding (or noise) in the decimals
+		decimals := 0
+		if _, fraction, found := strings.Cut(strconv.FormatFloat(v, 'f', -1, 64), "."); found {
+			decimals = len(fraction)
+		}
+		return printer.Sprint(number.Decimal(v, number.MaxFractionDigits(decimals)))
+	}
+	return toString(value)
+}
+
+// formatValue formats the given value (e.g. a feature property from a datasource) for display
+// in the given language. Timestamps at midnight are considered dates. Integers aren't formatted, since
+// these are often identifiers or codes (e.g. years, house numbers). Other values are returned as-is.
+func formatValue(value any, lang language.Tag) any {
+	switch v := value.(type) {
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return formatDate(v, lang)
+		}
+		return formatDateTime(v, lang)
+	case float64:
+		return formatNumber(v, lang)
+	}
+	return value
+}
+
+func getDateLayout(lang language.Tag) dateLayout {
+	if layout, ok := dateLayouts[lang]; ok {
+		return layout
+	}
+	return defaultDateLayout
+}
+
+func toTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case string:
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	case *string:
+		if v != nil {
+			return toTime(*v)
+		}
+	}
+	return time.Time{}, false
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+		return ""
+	}
+	return fmt.Sprint(value)
+}
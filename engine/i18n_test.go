@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestFormatValue(t *testing.T) {
+	timestamp := time.Date(2023, 5, 8, 14, 30, 5, 0, time.UTC)
+	date := time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value any
+		lang  language.Tag
+		want  any
+	}{
+		{name: "timestamp in Dutch", value: timestamp, lang: language.Dutch, want: "08-05-2023 14:30:05 UTC"},
+		{name: "timestamp in English", value: timestamp, lang: language.English, want: "2023-05-08 14:30:05 UTC"},
+		{name: "date in Dutch", value: date, lang: language.Dutch, want: "08-05-2023"},
+		{name: "date in English", value: date, lang: language.English, want: "2023-05-08"},
+		{name: "integer as-is", value: int64(1234567), lang: language.Dutch, want: int64(1234567)},
+		{name: "year as-is", value: int64(2023), lang: language.English, want: int64(2023)},
+		{name: "float in Dutch", value: 1234.000123, lang: language.Dutch, want: "1.234,000123"},
+		{name: "float in English", value: 52.123456789, lang: language.English, want: "52.123456789"},
+		{name: "string as-is", value: "2023-05-08", lang: language.Dutch, want: "2023-05-08"},
+		{name: "boolean as-is", value: true, lang: language.Dutch, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatValue(tt.value, tt.lang))
+		})
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	assert.Equal(t, "1.234.567", formatNumber(int64(1234567), language.Dutch))
+	assert.Equal(t, "1,234,567", formatNumber(1234567, language.English))
+	assert.Equal(t, "not a number", formatNumber("not a number", language.Dutch))
+}
+
+func TestFormatDate(t *testing.T) {
+	lastUpdated := "2023-05-08T12:00:00Z"
+	tests := []struct {
+		name  string
+		value any
+		lang  language.Tag
+		want  string
+	}{
+		{name: "ISO-8601 timestamp", value: lastUpdated, lang: language.Dutch, want: "08-05-2023"},
+		{name: "pointer to ISO-8601 timestamp", value: &lastUpdated, lang: language.English, want: "2023-05-08"},
+		{name: "ISO-8601 date", value: "2023-05-08", lang: language.Dutch, want: "08-05-2023"},
+		{name: "not a date", value: "yesterday", lang: language.Dutch, want: "yesterday"},
+		{name: "nil", value: nil, lang: language.Dutch, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatDate(tt.value, tt.lang))
+		})
+	}
+}
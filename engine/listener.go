@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// UnixSocketPrefix prefix of an address which refers to a Unix domain socket instead of a TCP host:port.
+	// Prefix the socket path with @ to use an abstract socket (Linux only).
+	UnixSocketPrefix = "unix:"
+
+	// first file descriptor passed by systemd, see https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+	listenFdsStart = 3
+)
+
+// newListener creates the listener for the main server. When started through systemd socket
+// activation the socket passed by systemd is used. Otherwise, a new socket is bound to the given address,
+// optionally with SO_REUSEPORT so a new GoKoala instance can bind to the same address while the
+// old instance is still finishing its in-flight requests. An address starting with UnixSocketPrefix
+// results in a Unix domain socket.
+func newListener(address string, reusePort bool) (net.Listener, error) {
+	listener, err := socketActivationListener()
+	if err != nil || listener != nil {
+		return listener, err
+	}
+	if socketPath, ok := strings.CutPrefix(address, UnixSocketPrefix); ok {
+		return unixSocketListener(socketPath)
+	}
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = func(_, _ string, conn syscall.RawConn) error {
+			var sockErr error
+			if err := conn.Control(func(fd uintptr) {
+				sockErr = setReusePort(fd)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", address)
+}
+
+// unixSocketListener listens on the given Unix domain socket, the socket file is removed on close
+func unixSocketListener(socketPath string) (net.Listener, error) {
+	if socketPath == "" {
+		return nil, errors.New("empty Unix socket path")
+	}
+	if !strings.HasPrefix(socketPath, "@") {
+		// remove stale socket, e.g. left behind by a crashed instance
+		if info, err := os.Stat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err = os.Remove(socketPath); err != nil {
+				return nil, fmt.Errorf("failed to remove stale Unix socket %s: %w", socketPath, err)
+			}
+		}
+	}
+	return net.Listen("unix", socketPath)
+}
+
+// socketActivationListener returns the listener passed by systemd, or nil when not socket activated
+func socketActivationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil //nolint:nilnil // not socket activated
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil //nolint:nilnil // not socket activated
+	}
+	if fds > 1 {
+		log.Printf("WARNING: received %d sockets from systemd, only the first one is used", fds)
+	}
+	// don't pass the sockets on to child processes
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(uintptr(listenFdsStart), "LISTEN_FD_"+strconv.Itoa(listenFdsStart))
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by systemd: %w", err)
+	}
+	log.Printf("using socket passed by systemd (socket activation)")
+	return listener, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package engine
+
+import "errors"
+
+func setReusePort(_ uintptr) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
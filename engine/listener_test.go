@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewListener_ReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("SO_REUSEPORT not supported on " + runtime.GOOS)
+	}
+	first, err := newListener("127.0.0.1:0", true)
+	require.NoError(t, err)
+	defer first.Close()
+
+	// second listener on the same port, like a new instance starting while the old one is still running
+	second, err := newListener(first.Addr().String(), true)
+	require.NoError(t, err)
+	defer second.Close()
+	assert.Equal(t, first.Addr().String(), second.Addr().String())
+}
+
+func TestNewListener_WithoutReusePort(t *testing.T) {
+	first, err := newListener("127.0.0.1:0", false)
+	require.NoError(t, err)
+	defer first.Close()
+
+	_, err = newListener(first.Addr().String(), false)
+	assert.Error(t, err)
+}
+
+func TestSocketActivationListener(t *testing.T) {
+	tests := []struct {
+		name      string
+		listenPid string
+		listenFds string
+	}{
+		{
+			name: "not socket activated",
+		},
+		{
+			name:      "socket activated for other process",
+			listenPid: "1",
+			listenFds: "1",
+		},
+		{
+			name:      "no sockets passed",
+			listenPid: strconv.Itoa(os.Getpid()),
+			listenFds: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.listenPid)
+			t.Setenv("LISTEN_FDS", tt.listenFds)
+
+			listener, err := socketActivationListener()
+			assert.NoError(t, err)
+			assert.Nil(t, listener)
+		})
+	}
+}
+
+func TestNewListener_UnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets not supported on " + runtime.GOOS)
+	}
+	socketPath := filepath.Join(t.TempDir(), "gokoala.sock")
+
+	listener, err := newListener(UnixSocketPrefix+socketPath, false)
+	require.NoError(t, err)
+	assert.Equal(t, "unix", listener.Addr().Network())
+
+	server := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		SafeWrite(w.Write, []byte("OK"))
+	})}
+	go func() { _ = server.Serve(listener) }()
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://gokoala/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "OK", string(body))
+
+	require.NoError(t, server.Close())
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err), "socket file should be removed on close")
+
+	// stale socket file is replaced
+	stale, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+	listener, err = newListener(UnixSocketPrefix+socketPath, false)
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// methods for which we check whether a route supports them, HEAD and OPTIONS are implied
+var allowedMethodCandidates = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// HandleOptions middleware responds to OPTIONS requests with the methods supported by the requested
+// route in the Allow header, see https://gitdocumentatie.logius.nl/publicatie/api/adr/#http-methods.
+// OPTIONS requests for unknown routes are passed on (resulting in a 404), as are OPTIONS requests for
+// routes which handle OPTIONS themselves. Should be registered on the router (using Use), since it
+// needs the routes of the router.
+func HandleOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx := chi.RouteContext(r.Context())
+		if r.Method != http.MethodOptions || rctx == nil || rctx.Routes == nil ||
+			rctx.Routes.Match(chi.NewRouteContext(), http.MethodOptions, RelativePath(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed := allowedMethods(rctx.Routes, RelativePath(r))
+		if len(allowed) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedMethods returns the methods supported by the given path, or nothing when the path is unknown
+func allowedMethods(routes chi.Routes, path string) []string {
+	var allowed []string
+	for _, method := range allowedMethodCandidates {
+		if routes.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+			if method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+		}
+	}
+	if len(allowed) > 0 {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
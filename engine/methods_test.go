@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleOptions(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(HandleOptions)
+	router.Get("/collections", func(w http.ResponseWriter, r *http.Request) {})
+	router.Get("/processes/{processId}", func(w http.ResponseWriter, r *http.Request) {})
+	router.Post("/processes/{processId}/execution", func(w http.ResponseWriter, r *http.Request) {})
+	router.Handle("/proxy", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	router.Route("/some/prefix", func(r chi.Router) {
+		r.Use(HandleOptions)
+		r.Get("/conformance", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantAllow  string
+	}{
+		{
+			name:       "GET route",
+			url:        "/collections",
+			wantStatus: http.StatusNoContent,
+			wantAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			name:       "POST route with URL param",
+			url:        "/processes/buffer/execution",
+			wantStatus: http.StatusNoContent,
+			wantAllow:  "POST, OPTIONS",
+		},
+		{
+			name:       "route mounted under prefix",
+			url:        "/some/prefix/conformance",
+			wantStatus: http.StatusNoContent,
+			wantAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			name:       "route which handles OPTIONS itself",
+			url:        "/proxy",
+			wantStatus: http.StatusTeapot,
+		},
+		{
+			name:       "unknown route",
+			url:        "/foo",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, tt.url, nil))
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantAllow, rr.Header().Get("Allow"))
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	ObjectStorageAzure = "azure"
+	ObjectStorageS3    = "s3"
+	ObjectStorageGCS   = "gcs"
+	ObjectStorageLocal = "local"
+
+	objectStorageTimeout = 5 * time.Minute
+)
+
+var (
+	ErrObjectNotFound    = errors.New("object not found")
+	ErrObjectNotModified = errors.New("object not modified")
+	ErrSignedURLs        = errors.New("signed URLs aren't supported by this type of object storage")
+)
+
+// Object a single object (file) in object storage
+type Object struct {
+	Content     []byte
+	ContentType string
+	ETag        string
+}
+
+// ObjectStore access to objects in object storage, being Azure Blob Storage, AWS S3 (or compatible),
+// Google Cloud Storage or a local directory. Modules use this instead of talking to the storage
+// service themselves. Keys are relative to the configured container/bucket and prefix, e.g. "job-1/result".
+type ObjectStore interface {
+	// Get returns the given object, or ErrObjectNotFound when it doesn't exist. When an etag is
+	// given and the object still has this etag, ErrObjectNotModified is returned instead.
+	Get(ctx context.Context, key string, etag string) (*Object, error)
+
+	// Put stores the given content as object, length may be -1 when unknown
+	Put(ctx context.Context, key string, contentType string, content io.Reader, length int64) error
+
+	// SignedURL returns a URL to read the given object without further credentials, valid
+	// for the given duration. Returns ErrSignedURLs when the storage doesn't support this.
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
+
+// NewObjectStore returns the ObjectStore for the given type of object storage. Credentials
+// missing from the config are read from the environment, see ObjectStorage.
+func NewObjectStore(config *ObjectStorage) (ObjectStore, error) {
+	switch config.Type {
+	case ObjectStorageAzure:
+		return newAzureObjectStore(config)
+	case ObjectStorageS3, ObjectStorageGCS:
+		return newS3ObjectStore(config)
+	case ObjectStorageLocal:
+		return newLocalObjectStore(config), nil
+	default:
+		return nil, fmt.Errorf("unsupported type of object storage: %s", config.Type)
+	}
+}
+
+// credentials returns the user and auth of the given config, falling back to the given environment variables
+func credentials(config *ObjectStorage, userEnv string, authEnv string) (string, string) {
+	user, auth := config.User, config.Auth
+	if user == "" && auth == "" {
+		user, auth = os.Getenv(userEnv), os.Getenv(authEnv)
+	}
+	return user, auth
+}
+
+// objectName the name of the given object in the container/bucket, including the configured prefix
+func objectName(config *ObjectStorage, key string) string {
+	if config.Prefix == "" {
+		return key
+	}
+	return path.Join(config.Prefix, key)
+}
+
+// bufferContent reads content of unknown length (-1) into memory, since
+// cloud storage services require the content length up front
+func bufferContent(content io.Reader, length int64) (io.Reader, int64, error) {
+	if length >= 0 {
+		return content, length, nil
+	}
+	buffered, err := io.ReadAll(content)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(buffered), int64(len(buffered)), nil
+}
+
+// readObject reads the object from the given (conditional) GET response of a storage service
+func readObject(resp *http.Response, name string) (*Object, error) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		content, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %s: %w", name, err)
+		}
+		return &Object{
+			Content:     content,
+			ContentType: resp.Header.Get("Content-Type"),
+			ETag:        resp.Header.Get("ETag"),
+		}, nil
+	case http.StatusNotModified:
+		return nil, ErrObjectNotModified
+	case http.StatusNotFound:
+		return nil, ErrObjectNotFound
+	default:
+		return nil, fmt.Errorf("unexpected status %d while downloading object %s", resp.StatusCode, name)
+	}
+}
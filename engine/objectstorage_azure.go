@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	sasVersion         = "2020-12-06"
+	sasResourceBlob    = "b"
+	sasPermissionRead  = "r"
+	sasPermissionWrite = "cw" // create + write
+)
+
+// azureObjectStore minimal client for Azure Blob Storage. Requests are authorized with a service SAS
+// (shared access signature) signed with the account key, the same signature we hand out to clients
+// as time-limited links to blobs. Without an account key requests are anonymous (public container).
+type azureObjectStore struct {
+	config  *ObjectStorage
+	url     *url.URL
+	account string
+	key     []byte
+	client  *http.Client
+	now     func() time.Time
+}
+
+func newAzureObjectStore(config *ObjectStorage) (*azureObjectStore, error) {
+	account, auth := credentials(config, "AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_KEY")
+	key, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key for storage account %s: %w", account, err)
+	}
+	var serviceURL *url.URL
+	if config.URL != nil && config.URL.URL != nil {
+		serviceURL = config.URL.URL
+	} else {
+		if account == "" {
+			return nil, errors.New("azure object storage requires either an url or a storage account")
+		}
+		serviceURL = &url.URL{Scheme: "https", Host: account + ".blob.core.windows.net"}
+	}
+	return &azureObjectStore{
+		config:  config,
+		url:     serviceURL,
+		account: account,
+		key:     key,
+		client:  &http.Client{Timeout: objectStorageTimeout},
+		now:     time.Now,
+	}, nil
+}
+
+func (a *azureObjectStore) Get(ctx context.Context, key string, etag string) (*Object, error) {
+	blobName := objectName(a.config, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.signedURL(blobName, sasPermissionRead, objectStorageTimeout), nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s", blobName) // don't log the error as-is, since the URL contains a signature
+	}
+	defer resp.Body.Close()
+	return readObject(resp, blobName)
+}
+
+func (a *azureObjectStore) Put(ctx context.Context, key string, contentType string, content io.Reader, length int64) error {
+	blobName := objectName(a.config, key)
+	content, length, err := bufferContent(content, length)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.signedURL(blobName, sasPermissionWrite, objectStorageTimeout), content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-blob-content-type", contentType)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob %s", blobName)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status %d while uploading blob %s", resp.StatusCode, blobName)
+	}
+	return nil
+}
+
+func (a *azureObjectStore) SignedURL(key string, expiry time.Duration) (string, error) {
+	return a.signedURL(objectName(a.config, key), sasPermissionRead, expiry), nil
+}
+
+// signedURL returns the URL of the given blob including a SAS token, which grants the given
+// permissions on this blob until the given expiry. Without account key the URL is unsigned.
+func (a *azureObjectStore) signedURL(blobName string, permissions string, expiry time.Duration) string {
+	blobURL := *a.url
+	blobURL.Path = strings.TrimSuffix(a.url.Path, "/") + "/" + a.config.Container + "/" + blobName
+	if len(a.key) == 0 {
+		return blobURL.String()
+	}
+
+	expiresAt := a.now().UTC().Add(expiry).Format(time.RFC3339)
+	stringToSign := strings.Join([]string{
+		permissions,
+		"", // start
+		expiresAt,
+		"/blob/" + a.account + "/" + a.config.Container + "/" + blobName,
+		"", // identifier
+		"", // IP
+		"", // protocol
+		sasVersion,
+		sasResourceBlob,
+		"", // snapshot time
+		"", // encryption scope
+		"", // cache-control
+		"", // content-disposition
+		"", // content-encoding
+		"", // content-language
+		"", // content-type
+	}, "\n")
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(stringToSign))
+
+	query := url.Values{}
+	query.Set("sv", sasVersion)
+	query.Set("sr", sasResourceBlob)
+	query.Set("sp", permissions)
+	query.Set("se", expiresAt)
+	query.Set("sig", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	blobURL.RawQuery = query.Encode()
+	return blobURL.String()
+}
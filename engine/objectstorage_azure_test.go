@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+func TestAzureObjectStore_SignedURL(t *testing.T) {
+	storageURL, _ := url.Parse("http://127.0.0.1:10000/devstoreaccount1")
+	store, err := newAzureObjectStore(&ObjectStorage{
+		Type:      ObjectStorageAzure,
+		URL:       &YAMLURL{URL: storageURL},
+		User:      "devstoreaccount1",
+		Auth:      azuriteKey,
+		Container: "results",
+	})
+	assert.NoError(t, err)
+	store.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	signedURL, err := store.SignedURL("job-1/result", time.Hour)
+	assert.NoError(t, err)
+	signed, err := url.Parse(signedURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "/devstoreaccount1/results/job-1/result", signed.Path)
+	assert.Equal(t, url.Values{
+		"sv":  {"2020-12-06"},
+		"sr":  {"b"},
+		"sp":  {"r"},
+		"se":  {"2024-01-01T01:00:00Z"},
+		"sig": {"tIVbmtulwtOkNdc3GAcER66KBYAmiDSz7kKiVCa8jA8="},
+	}, signed.Query())
+}
+
+func TestAzureObjectStore_credentialsFromEnvironment(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_ACCOUNT", "myaccount")
+	t.Setenv("AZURE_STORAGE_KEY", azuriteKey)
+	store, err := NewObjectStore(&ObjectStorage{Type: ObjectStorageAzure, Container: "styles", Prefix: "v1"})
+	assert.NoError(t, err)
+
+	signedURL, err := store.SignedURL("foo.json", time.Hour)
+	assert.NoError(t, err)
+	signed, _ := url.Parse(signedURL)
+	assert.Equal(t, "myaccount.blob.core.windows.net", signed.Host)
+	assert.Equal(t, "/styles/v1/foo.json", signed.Path)
+	assert.NotEmpty(t, signed.Query().Get("sig"))
+}
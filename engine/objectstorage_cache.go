@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// max total size of the objects kept in memory by cachedObjectStore, objects beyond this size are served uncached
+const maxCachedObjectsSize = 64 << 20
+
+// cachedObjectStore keeps objects of an ObjectStore in memory, e.g. the sprites and glyphs of styles. Cached
+// objects are revalidated (using their etag) once they're older than the refresh interval, so changes in
+// object storage are picked up without downloading unchanged objects again.
+type cachedObjectStore struct {
+	ObjectStore
+	refreshInterval time.Duration
+	maxSize         int
+	now             func() time.Time
+
+	mu      sync.Mutex
+	objects map[string]cachedObject
+	size    int
+}
+
+type cachedObject struct {
+	*Object
+	fetched time.Time
+}
+
+func newCachedObjectStore(store ObjectStore, refreshInterval time.Duration) *cachedObjectStore {
+	return &cachedObjectStore{
+		ObjectStore:     store,
+		refreshInterval: refreshInterval,
+		maxSize:         maxCachedObjectsSize,
+		now:             time.Now,
+		objects:         make(map[string]cachedObject),
+	}
+}
+
+// Get see ObjectStore, returns the cached object when it's fresh or unchanged
+func (c *cachedObjectStore) Get(ctx context.Context, key string, etag string) (*Object, error) {
+	c.mu.Lock()
+	cached, ok := c.objects[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.fetched) < c.refreshInterval {
+		return notModified(cached.Object, etag)
+	}
+
+	var cachedETag string
+	if ok {
+		cachedETag = cached.ETag
+	}
+	object, err := c.ObjectStore.Get(ctx, key, cachedETag)
+	switch {
+	case ok && errors.Is(err, ErrObjectNotModified):
+		object = cached.Object
+	case errors.Is(err, ErrObjectNotFound):
+		c.remove(key)
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+	c.put(key, object)
+	return notModified(object, etag)
+}
+
+// Put see ObjectStore, the cached object (if any) is dropped
+func (c *cachedObjectStore) Put(ctx context.Context, key string, contentType string, content io.Reader, length int64) error {
+	c.remove(key)
+	return c.ObjectStore.Put(ctx, key, contentType, content, length)
+}
+
+func (c *cachedObjectStore) put(key string, object *Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+	if c.size+len(object.Content) > c.maxSize {
+		return
+	}
+	c.objects[key] = cachedObject{Object: object, fetched: c.now()}
+	c.size += len(object.Content)
+}
+
+func (c *cachedObjectStore) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+func (c *cachedObjectStore) removeLocked(key string) {
+	if existing, ok := c.objects[key]; ok {
+		c.size -= len(existing.Content)
+		delete(c.objects, key)
+	}
+}
+
+// notModified returns ErrObjectNotModified when the object still has the given etag, like ObjectStore.Get
+func notModified(object *Object, etag string) (*Object, error) {
+	if etag != "" && object.ETag == etag {
+		return nil, ErrObjectNotModified
+	}
+	return object, nil
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingObjectStore counts the objects downloaded from the underlying store
+type countingObjectStore struct {
+	ObjectStore
+	downloads int
+}
+
+func (s *countingObjectStore) Get(ctx context.Context, key string, etag string) (*Object, error) {
+	object, err := s.ObjectStore.Get(ctx, key, etag)
+	if err == nil {
+		s.downloads++
+	}
+	return object, err
+}
+
+func TestCachedObjectStore(t *testing.T) {
+	local, err := NewObjectStore(&ObjectStorage{Type: ObjectStorageLocal, Container: t.TempDir()})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, local.Put(ctx, "sprites/sprite.json", MediaTypeJSON, strings.NewReader(`{}`), 2))
+
+	store := &countingObjectStore{ObjectStore: local}
+	cache := newCachedObjectStore(store, time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	object, err := cache.Get(ctx, "sprites/sprite.json", "")
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(object.Content))
+	_, err = cache.Get(ctx, "sprites/sprite.json", object.ETag)
+	assert.ErrorIs(t, err, ErrObjectNotModified)
+	assert.Equal(t, 1, store.downloads, "fresh objects are served from memory")
+
+	// unchanged objects are revalidated, not downloaded again
+	now = now.Add(2 * time.Minute)
+	object, err = cache.Get(ctx, "sprites/sprite.json", "")
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(object.Content))
+	assert.Equal(t, 1, store.downloads)
+
+	// changed objects are downloaded once stale
+	require.NoError(t, local.Put(ctx, "sprites/sprite.json", MediaTypeJSON, strings.NewReader(`{"a":1}`), 7))
+	now = now.Add(2 * time.Minute)
+	object, err = cache.Get(ctx, "sprites/sprite.json", "")
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(object.Content))
+	assert.Equal(t, 2, store.downloads)
+
+	_, err = cache.Get(ctx, "sprites/missing.png", "")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestCachedObjectStore_MaxSize(t *testing.T) {
+	local, err := NewObjectStore(&ObjectStorage{Type: ObjectStorageLocal, Container: t.TempDir()})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, local.Put(ctx, "small", MediaTypeJSON, strings.NewReader(`{}`), 2))
+	require.NoError(t, local.Put(ctx, "large", MediaTypeJSON, strings.NewReader(`{"a":1}`), 7))
+
+	store := &countingObjectStore{ObjectStore: local}
+	cache := newCachedObjectStore(store, time.Minute)
+	cache.maxSize = 5
+	for i := 0; i < 2; i++ {
+		_, err = cache.Get(ctx, "small", "")
+		require.NoError(t, err)
+		_, err = cache.Get(ctx, "large", "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, store.downloads, "objects beyond the max size aren't cached")
+	assert.Equal(t, 2, cache.size)
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// localObjectStore objects as files in a local directory, mainly for development and testing. The
+// directory is the configured container, the prefix (if any) is a subdirectory of it.
+type localObjectStore struct {
+	dir string
+}
+
+func newLocalObjectStore(config *ObjectStorage) *localObjectStore {
+	return &localObjectStore{dir: filepath.Join(config.Container, filepath.FromSlash(config.Prefix))}
+}
+
+func (l *localObjectStore) Get(_ context.Context, key string, etag string) (*Object, error) {
+	content, err := os.ReadFile(l.file(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	object := &Object{
+		Content:     content,
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ETag:        NewETag(content),
+	}
+	if etag != "" && etag == object.ETag {
+		return nil, ErrObjectNotModified
+	}
+	return object, nil
+}
+
+func (l *localObjectStore) Put(_ context.Context, key string, _ string, content io.Reader, _ int64) error {
+	file := l.file(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, content)
+	return err
+}
+
+func (l *localObjectStore) SignedURL(_ string, _ time.Duration) (string, error) {
+	return "", ErrSignedURLs
+}
+
+// file the location of the given object on disk, keys can't escape the directory
+func (l *localObjectStore) file(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
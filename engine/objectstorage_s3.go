@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DateFormat      = "20060102T150405Z"
+	s3MaxLinkExpiry   = 7 * 24 * time.Hour
+	gcsEndpoint       = "https://storage.googleapis.com"
+	gcsRegion         = "auto"
+)
+
+// s3ObjectStore minimal client for AWS S3 and compatible storage, like MinIO or Google Cloud Storage
+// (through its XML API using HMAC keys). Requests are signed using AWS Signature Version 4, either in
+// the Authorization header or - for links handed out to clients - in the query string (presigned URL).
+// Without credentials requests are anonymous (public bucket). Uses path-style URLs: {endpoint}/{bucket}/{key}.
+type s3ObjectStore struct {
+	config    *ObjectStorage
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func newS3ObjectStore(config *ObjectStorage) (*s3ObjectStore, error) {
+	accessKey, secretKey := credentials(config, "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY")
+	region := config.GetRegion()
+	var endpoint *url.URL
+	switch {
+	case config.URL != nil && config.URL.URL != nil:
+		endpoint = config.URL.URL
+	case config.Type == ObjectStorageGCS:
+		endpoint, _ = url.Parse(gcsEndpoint)
+		if config.Region == nil {
+			region = gcsRegion
+		}
+	default:
+		endpoint = &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com"}
+	}
+	return &s3ObjectStore{
+		config:    config,
+		endpoint:  endpoint,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: objectStorageTimeout},
+		now:       time.Now,
+	}, nil
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string, etag string) (*Object, error) {
+	name := objectName(s.config, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	s.sign(req, s3UnsignedPayload)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	return readObject(resp, name)
+}
+
+func (s *s3ObjectStore) Put(ctx context.Context, key string, contentType string, content io.Reader, length int64) error {
+	name := objectName(s.config, key)
+	content, length, err := bufferContent(content, length)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(name).String(), content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	s.sign(req, s3UnsignedPayload)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d while uploading object %s", resp.StatusCode, name)
+	}
+	return nil
+}
+
+func (s *s3ObjectStore) SignedURL(key string, expiry time.Duration) (string, error) {
+	objectURL := s.objectURL(objectName(s.config, key))
+	if s.accessKey == "" {
+		return objectURL.String(), nil
+	}
+	return s.presign(http.MethodGet, objectURL, min(expiry, s3MaxLinkExpiry)).String(), nil
+}
+
+func (s *s3ObjectStore) objectURL(name string) *url.URL {
+	objectURL := *s.endpoint
+	objectURL.Path = strings.TrimSuffix(s.endpoint.Path, "/") + "/" + s.config.Container + "/" + name
+	return &objectURL
+}
+
+// sign adds the AWS Signature Version 4 to the headers of the given request, all headers present are signed
+func (s *s3ObjectStore) sign(req *http.Request, payloadHash string) {
+	if s.accessKey == "" {
+		return
+	}
+	now := s.now().UTC()
+	req.Header.Set("x-amz-date", now.Format(s3DateFormat))
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	signature := s.signature(req.Method, req.URL, canonicalHeaders.String(), signedHeaders, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, s.scope(now), signedHeaders, signature))
+}
+
+// presign returns the given URL including the AWS Signature Version 4 in the query string, valid for the given duration
+func (s *s3ObjectStore) presign(method string, target *url.URL, expiry time.Duration) *url.URL {
+	now := s.now().UTC()
+	query := target.Query()
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3DateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	presigned := *target
+	presigned.RawQuery = canonicalQuery(query)
+	signature := s.signature(method, &presigned, "host:"+target.Host+"\n", "host", s3UnsignedPayload, now)
+	presigned.RawQuery += "&X-Amz-Signature=" + signature
+	return &presigned
+}
+
+func (s *s3ObjectStore) signature(method string, target *url.URL, canonicalHeaders string, signedHeaders string,
+	payloadHash string, now time.Time) string {
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(target.Path, false),
+		canonicalQuery(target.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3DateFormat),
+		s.scope(now),
+		hex.EncodeToString(hashedRequest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s *s3ObjectStore) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery the query string sorted by key, with keys and values encoded as required by AWS
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes everything except unreserved characters (and optionally the slash)
+func uriEncode(value string, encodeSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9'),
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			result.WriteByte(b)
+		default:
+			fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
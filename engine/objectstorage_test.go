@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalObjectStore(t *testing.T) {
+	store, err := NewObjectStore(&ObjectStorage{Type: ObjectStorageLocal, Container: t.TempDir(), Prefix: "results"})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = store.Get(ctx, "job-1/result.json", "")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	assert.NoError(t, store.Put(ctx, "job-1/result.json", MediaTypeJSON, strings.NewReader(`{"count": 42}`), -1))
+	object, err := store.Get(ctx, "job-1/result.json", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"count": 42}`, string(object.Content))
+	assert.Equal(t, MediaTypeJSON, object.ContentType)
+
+	_, err = store.Get(ctx, "job-1/result.json", object.ETag)
+	assert.ErrorIs(t, err, ErrObjectNotModified)
+
+	// keys can't escape the directory
+	object, err = store.Get(ctx, "../results/job-1/result.json", "")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+	assert.Nil(t, object)
+
+	_, err = store.SignedURL("job-1/result.json", time.Hour)
+	assert.ErrorIs(t, err, ErrSignedURLs)
+}
+
+func TestObjectStoreHandler(t *testing.T) {
+	store, _ := NewObjectStore(&ObjectStorage{Type: ObjectStorageLocal, Container: t.TempDir()})
+	assert.NoError(t, store.Put(context.Background(), "sprites/sprite.json", MediaTypeJSON, strings.NewReader(`{}`), 2))
+	router := chi.NewRouter()
+	router.Get("/resources/*", objectStoreHandler(store))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/resources/sprites/sprite.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, MediaTypeJSON, rr.Header().Get("Content-Type"))
+	assert.Equal(t, `{}`, rr.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/resources/sprites/sprite.json", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/resources/sprites/missing.png", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
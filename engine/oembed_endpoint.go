@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	oEmbedPath          = "/oembed"
+	oEmbedDefaultWidth  = 800
+	oEmbedDefaultHeight = 600
+)
+
+// OEmbedResponse "rich" oEmbed response, see https://oembed.com/#section2.3
+type OEmbedResponse struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Title        string `json:"title,omitempty"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type OEmbedEndpoint struct {
+	engine *Engine
+}
+
+// NewOEmbedEndpoint serves an oEmbed (https://oembed.com) endpoint, this allows
+// CMS's of data publishers to embed (iframe) HTML pages of this API, e.g. a feature or a map.
+func NewOEmbedEndpoint(e *Engine, router chi.Router) *OEmbedEndpoint {
+	oEmbed := &OEmbedEndpoint{
+		engine: e,
+	}
+	router.Get(oEmbedPath, oEmbed.OEmbed())
+	return oEmbed
+}
+
+func (o *OEmbedEndpoint) OEmbed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		if format := params.Get("format"); format != "" && format != FormatJSON {
+			http.Error(w, "only format json is supported", http.StatusNotImplemented)
+			return
+		}
+		pageURL, err := o.parsePageURL(params.Get("url"))
+		if err != nil {
+			// per oEmbed spec a 404 is returned when the provider has no response for the requested url
+			log.Printf("invalid oEmbed request: %v", err)
+			http.NotFound(w, r)
+			return
+		}
+		width, widthErr := parseMaxDimension(params.Get("maxwidth"), oEmbedDefaultWidth)
+		height, heightErr := parseMaxDimension(params.Get("maxheight"), oEmbedDefaultHeight)
+		if widthErr != nil || heightErr != nil {
+			http.Error(w, "maxwidth and maxheight should be positive numbers", http.StatusBadRequest)
+			return
+		}
+
+		embedParams := pageURL.Query()
+		embedParams.Set(FormatParam, FormatHTML)
+		embedParams.Set(EmbedParam, "true")
+		pageURL.RawQuery = embedParams.Encode()
+
+		response := OEmbedResponse{
+			Type:         "rich",
+			Version:      "1.0",
+			Title:        o.engine.Config.Title,
+			ProviderName: o.engine.Config.Title,
+			ProviderURL:  o.engine.Config.BaseURL.String(),
+			HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" style="border:0" loading="lazy"></iframe>`,
+				html.EscapeString(pageURL.String()), width, height),
+			Width:  width,
+			Height: height,
+		}
+		responseJSON, err := json.Marshal(&response)
+		if err != nil {
+			log.Printf("failed to marshal oEmbed response: %v", err)
+			http.Error(w, "failed to marshal oEmbed response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		SafeWrite(w.Write, responseJSON)
+	}
+}
+
+// only pages of this API can be embedded
+func (o *OEmbedEndpoint) parsePageURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("url param is required")
+	}
+	pageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := o.engine.Config.BaseURL.URL
+	basePath := strings.TrimSuffix(baseURL.Path, "/")
+	if pageURL.Scheme != baseURL.Scheme || pageURL.Host != baseURL.Host ||
+		(pageURL.Path != basePath && !strings.HasPrefix(pageURL.Path, basePath+"/")) {
+		return nil, fmt.Errorf("url %s isn't part of this API", rawURL)
+	}
+	return pageURL, nil
+}
+
+func parseMaxDimension(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	maxValue, err := strconv.Atoi(value)
+	if err != nil || maxValue <= 0 {
+		return 0, fmt.Errorf("invalid dimension %s", value)
+	}
+	return min(maxValue, defaultValue), nil
+}
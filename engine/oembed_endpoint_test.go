@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOEmbedEndpoint_OEmbed(t *testing.T) {
+	baseURL, _ := url.Parse("http://localhost:8080/api")
+	engine := &Engine{Config: &Config{Title: "Test API", BaseURL: YAMLURL{baseURL}}}
+	router := chi.NewRouter()
+	NewOEmbedEndpoint(engine, router)
+
+	tests := []struct {
+		name           string
+		query          string
+		wantStatusCode int
+		wantHTML       string
+		wantWidth      int
+	}{
+		{
+			name:           "embed feature page",
+			query:          "url=" + url.QueryEscape("http://localhost:8080/api/collections/foo/items/1"),
+			wantStatusCode: http.StatusOK,
+			wantHTML:       `<iframe src="http://localhost:8080/api/collections/foo/items/1?embed=true&amp;f=html" width="800" height="600" style="border:0" loading="lazy"></iframe>`,
+			wantWidth:      800,
+		},
+		{
+			name:           "embed with max width",
+			query:          "maxwidth=400&url=" + url.QueryEscape("http://localhost:8080/api/collections/foo"),
+			wantStatusCode: http.StatusOK,
+			wantHTML:       `<iframe src="http://localhost:8080/api/collections/foo?embed=true&amp;f=html" width="400" height="600" style="border:0" loading="lazy"></iframe>`,
+			wantWidth:      400,
+		},
+		{
+			name:           "url of another site",
+			query:          "url=" + url.QueryEscape("https://example.com/api/collections/foo"),
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "missing url",
+			query:          "",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "xml format",
+			query:          "format=xml&url=" + url.QueryEscape("http://localhost:8080/api/collections/foo"),
+			wantStatusCode: http.StatusNotImplemented,
+		},
+		{
+			name:           "invalid max width",
+			query:          "maxwidth=-1&url=" + url.QueryEscape("http://localhost:8080/api/collections/foo"),
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/oembed?"+tt.query, nil)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.wantStatusCode, recorder.Code)
+			if tt.wantStatusCode == http.StatusOK {
+				var response OEmbedResponse
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				assert.Equal(t, "rich", response.Type)
+				assert.Equal(t, "1.0", response.Version)
+				assert.Equal(t, tt.wantHTML, response.HTML)
+				assert.Equal(t, tt.wantWidth, response.Width)
+			}
+		})
+	}
+}
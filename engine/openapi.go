@@ -103,6 +103,20 @@ func setupRequestResponseValidation() {
 			return string(data), nil
 		})
 
+	openapi3filter.RegisterBodyDecoder(MediaTypeSVG,
+		func(body io.Reader, header http.Header, ref *openapi3.SchemaRef,
+			fn openapi3filter.EncodingFn) (interface{}, error) {
+
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return nil, errors.New("failed to read response body")
+			}
+			if !bytes.Contains(data, []byte("<svg")) {
+				return nil, errors.New("response doesn't contain SVG")
+			}
+			return string(data), nil
+		})
+
 	openapi3filter.RegisterBodyDecoder(MediaTypeTileJSON,
 		func(body io.Reader, header http.Header, schema *openapi3.SchemaRef,
 			fn openapi3filter.EncodingFn) (interface{}, error) {
@@ -222,6 +236,11 @@ func (o *OpenAPI) validateResponse(contentType string, body []byte, r *http.Requ
 }
 
 func (o *OpenAPI) getRequestValidationInput(r *http.Request) (*openapi3filter.RequestValidationInput, error) {
+	if r.Method == http.MethodHead {
+		// HEAD requests are handled by GET routes, so validate these as GET requests
+		r = r.WithContext(r.Context()) // shallow copy
+		r.Method = http.MethodGet
+	}
 	route, pathParams, err := o.router.FindRoute(r)
 	if err != nil {
 		log.Printf("route not found in OpenAPI spec for url %s (host: %s), "+
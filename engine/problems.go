@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ProblemDetails error response according to RFC 7807, https://datatracker.ietf.org/doc/html/rfc7807
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// RenderProblem writes an RFC 7807 problem (application/problem+json) to the client. Only pass
+// details that are safe to share with clients, so no internal error messages, stack traces, etc.
+func RenderProblem(w http.ResponseWriter, status int, detail string) {
+	problem := ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+	problemJSON, err := json.Marshal(&problem)
+	if err != nil {
+		log.Printf("failed to marshal problem details: %v", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", MediaTypeProblemJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	SafeWrite(w.Write, problemJSON)
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ErrorReporter reports unexpected errors (like panics) to an external error tracking service.
+// The signature is modelled after the Sentry SDK (CaptureException) so a Sentry client - or any
+// compatible service - can be plugged in with a thin adapter.
+type ErrorReporter interface {
+	CaptureException(err error, report ErrorReport)
+}
+
+// ErrorReport context of an unexpected error. Note: contains internals, never send this to the client.
+type ErrorReport struct {
+	// Stack trace at the moment of the panic
+	Stack []byte
+
+	// Request context
+	RequestID  string
+	Method     string
+	URL        string
+	RemoteAddr string
+	UserAgent  string
+}
+
+// logErrorReporter default ErrorReporter, writes the report to the log
+type logErrorReporter struct{}
+
+func (logErrorReporter) CaptureException(err error, report ErrorReport) {
+	log.Printf("panic while serving %s %s (request id: %s, remote: %s): %v\n%s",
+		report.Method, report.URL, report.RequestID, report.RemoteAddr, err, report.Stack)
+}
+
+// RegisterErrorReporter adds an ErrorReporter which is called when a panic is recovered
+// while serving a request. Panics are always logged, regardless of registered reporters.
+func (e *Engine) RegisterErrorReporter(reporter ErrorReporter) {
+	e.errorReporters = append(e.errorReporters, reporter)
+}
+
+// Recoverer middleware recovers from panics, reports them to the registered ErrorReporter(s)
+// and returns a 500 problem (application/problem+json) to the client. In contrast to
+// chi's middleware.Recoverer no internals (panic value, stack trace) are exposed to the client.
+func (e *Engine) Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				if rvr == http.ErrAbortHandler { //nolint:errorlint // comparison is intentional, panic value isn't wrapped
+					// we don't recover http.ErrAbortHandler so the response to the client is aborted
+					panic(rvr)
+				}
+				e.reportPanic(r, rvr, debug.Stack())
+
+				if r.Header.Get("Connection") != "Upgrade" {
+					RenderProblem(w, http.StatusInternalServerError, "")
+				}
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (e *Engine) reportPanic(r *http.Request, rvr any, stack []byte) {
+	var err error
+	if rvrErr, ok := rvr.(error); ok {
+		err = fmt.Errorf("recovered from panic: %w", rvrErr)
+	} else {
+		err = fmt.Errorf("recovered from panic: %v", rvr)
+	}
+
+	report := ErrorReport{
+		Stack:      stack,
+		RequestID:  middleware.GetReqID(r.Context()),
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	logErrorReporter{}.CaptureException(err, report)
+	for _, reporter := range e.errorReporters {
+		reporter.CaptureException(err, report)
+	}
+}
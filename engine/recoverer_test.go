@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeErrorReporter struct {
+	err    error
+	report ErrorReport
+}
+
+func (f *fakeErrorReporter) CaptureException(err error, report ErrorReport) {
+	f.err = err
+	f.report = report
+}
+
+func TestEngine_Recoverer(t *testing.T) {
+	// given
+	engine := &Engine{}
+	reporter := &fakeErrorReporter{}
+	engine.RegisterErrorReporter(reporter)
+
+	handler := engine.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("secret database password leaked"))
+	}))
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8080/collections/foo/items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+
+	// when
+	handler.ServeHTTP(recorder, req)
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, MediaTypeProblemJSON, recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Internal Server Error","status":500}`, recorder.Body.String())
+	assert.NotContains(t, recorder.Body.String(), "secret")
+
+	assert.ErrorContains(t, reporter.err, "secret database password leaked")
+	assert.Equal(t, http.MethodGet, reporter.report.Method)
+	assert.Equal(t, "http://localhost:8080/collections/foo/items", reporter.report.URL)
+	assert.NotEmpty(t, reporter.report.Stack)
+}
+
+func TestEngine_Recoverer_AbortHandler(t *testing.T) {
+	engine := &Engine{}
+	handler := engine.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
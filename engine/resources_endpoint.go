@@ -1,10 +1,13 @@
 package engine
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -13,15 +16,21 @@ type ResourcesEndpoint struct {
 	engine *Engine
 }
 
-func NewResourcesEndpoint(e *Engine, router *chi.Mux) *ResourcesEndpoint {
+func NewResourcesEndpoint(e *Engine, router chi.Router) *ResourcesEndpoint {
 	resources := &ResourcesEndpoint{
 		engine: e,
 	}
 
-	// Serve static assets either from local storage or through reverse proxy
+	// Serve static assets either from local storage, object storage or through reverse proxy
 	if resourcesDir := e.Config.Resources.Directory; resourcesDir != "" {
 		resourcesPath := strings.TrimSuffix(resourcesDir, "/resources")
-		router.Handle("/resources/*", http.FileServer(http.Dir(resourcesPath)))
+		router.Method(http.MethodGet, "/resources/*", precompressedFileServer(resourcesPath))
+	} else if storage := e.Config.Resources.Storage; storage != nil {
+		store, err := NewObjectStore(storage)
+		if err != nil {
+			log.Fatalf("failed to configure object storage for resources: %v", err)
+		}
+		router.Get("/resources/*", objectStoreHandler(newCachedObjectStore(store, e.Config.Resources.GetRefreshInterval())))
 	} else if resourcesURL := e.Config.Resources.URL.String(); resourcesURL != "" {
 		router.Get("/resources/*",
 			func(w http.ResponseWriter, r *http.Request) {
@@ -38,3 +47,22 @@ func NewResourcesEndpoint(e *Engine, router *chi.Mux) *ResourcesEndpoint {
 
 	return resources
 }
+
+// objectStoreHandler serves the requested object from object storage, conditional requests
+// are supported based on the etag of the object
+func objectStoreHandler(store ObjectStore) http.HandlerFunc {
+	return HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		key := strings.TrimPrefix(path.Clean("/"+chi.URLParam(r, "*")), "/")
+		object, err := store.Get(r.Context(), key, "")
+		if errors.Is(err, ErrObjectNotFound) {
+			return NotFound("resource doesn't exist")
+		} else if err != nil {
+			return UpstreamUnavailable("failed to retrieve resource", err)
+		}
+		if object.ContentType != "" {
+			w.Header().Set("Content-Type", object.ContentType)
+		}
+		ServeContent(w, r, object.Content, object.ETag, time.Time{})
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultShutdownHookTimeout = 5 * time.Second
+	slowShutdownHookRatio      = 0.5 // log hooks that take more than half of their timeout
+)
+
+// ShutdownHook function to execute on shutdown, e.g. to close datasources
+type ShutdownHook struct {
+	// Name of the hook, used in logging
+	Name string
+
+	// Func to execute, the given context is canceled when the timeout of the hook expires
+	Func func(ctx context.Context)
+
+	// Order in which hooks are executed, hooks with a lower order are executed first.
+	// Hooks with the same order are executed in parallel.
+	Order int
+
+	// Timeout of this hook, defaults to 5s. When the timeout expires shutdown continues with the next hooks.
+	// Keep the total (shutdown-delay + shutdown timeout + hook timeouts) within the grace period of your platform (e.g. k8s).
+	Timeout time.Duration
+}
+
+// RegisterShutdownHook registers a function to execute on shutdown, see ShutdownHook.
+func (e *Engine) RegisterShutdownHook(hook ShutdownHook) {
+	if hook.Timeout <= 0 {
+		hook.Timeout = defaultShutdownHookTimeout
+	}
+	e.shutdownHooks = append(e.shutdownHooks, hook)
+}
+
+// AttachShutdownHooks executes the shutdown hooks of the given engine on shutdown of this engine.
+// Used when multiple engines (API versions) are served side-by-side by the server of this engine.
+func (e *Engine) AttachShutdownHooks(other *Engine) {
+	e.shutdownHooks = append(e.shutdownHooks, other.shutdownHooks...)
+}
+
+// runShutdownHooks executes the shutdown hooks in order, hooks with the same order in parallel
+func (e *Engine) runShutdownHooks(ctx context.Context) {
+	hooks := make([]ShutdownHook, len(e.shutdownHooks))
+	copy(hooks, e.shutdownHooks)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Order < hooks[j].Order
+	})
+
+	for start := 0; start < len(hooks); {
+		end := start + 1
+		for end < len(hooks) && hooks[end].Order == hooks[start].Order {
+			end++
+		}
+		var wg sync.WaitGroup
+		for _, hook := range hooks[start:end] {
+			wg.Add(1)
+			go func(hook ShutdownHook) {
+				defer wg.Done()
+				runShutdownHook(ctx, hook)
+			}(hook)
+		}
+		wg.Wait()
+		start = end
+	}
+}
+
+func runShutdownHook(ctx context.Context, hook ShutdownHook) {
+	hookCtx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hook.Func(hookCtx)
+	}()
+
+	select {
+	case <-done:
+		if duration := time.Since(start); duration > time.Duration(float64(hook.Timeout)*slowShutdownHookRatio) {
+			log.Printf("slow shutdown hook '%s' took %s (timeout %s)", hook.Name, duration, hook.Timeout)
+		}
+	case <-hookCtx.Done():
+		// don't wait for hooks that ignore their context, continue shutdown
+		log.Printf("shutdown hook '%s' didn't finish within timeout %s", hook.Name, hook.Timeout)
+	}
+}
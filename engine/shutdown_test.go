@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunShutdownHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		hooks     []ShutdownHook
+		wantOrder []string
+	}{
+		{
+			name:      "no hooks",
+			wantOrder: []string{},
+		},
+		{
+			name: "hooks in order",
+			hooks: []ShutdownHook{
+				{Name: "close datasource", Order: 2},
+				{Name: "flush cache", Order: 1},
+				{Name: "close logger", Order: 3},
+			},
+			wantOrder: []string{"flush cache", "close datasource", "close logger"},
+		},
+		{
+			name: "hook exceeding timeout doesn't block next hooks",
+			hooks: []ShutdownHook{
+				{Name: "slow", Order: 1, Timeout: 10 * time.Millisecond},
+				{Name: "fast", Order: 2},
+			},
+			wantOrder: []string{"slow", "fast"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			executed := []string{}
+
+			engine := &Engine{}
+			for _, hook := range tt.hooks {
+				name := hook.Name
+				hook.Func = func(_ context.Context) {
+					mu.Lock()
+					executed = append(executed, name)
+					mu.Unlock()
+					if name == "slow" {
+						time.Sleep(time.Second) // ignores its context
+					}
+				}
+				engine.RegisterShutdownHook(hook)
+			}
+
+			start := time.Now()
+			engine.runShutdownHooks(context.Background())
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantOrder, executed)
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
+
+func TestRunShutdownHooksParallel(t *testing.T) {
+	engine := &Engine{}
+	for _, name := range []string{"a", "b", "c"} {
+		engine.RegisterShutdownHook(ShutdownHook{
+			Name: name,
+			Func: func(_ context.Context) { time.Sleep(100 * time.Millisecond) },
+		})
+	}
+
+	start := time.Now()
+	engine.runShutdownHooks(context.Background())
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestRegisterShutdownHookDefaultTimeout(t *testing.T) {
+	engine := &Engine{}
+	engine.RegisterShutdownHook(ShutdownHook{Name: "a", Func: func(_ context.Context) {}})
+	engine.RegisterShutdownHook(ShutdownHook{Name: "b", Func: func(_ context.Context) {}, Timeout: time.Second})
+
+	assert.Equal(t, defaultShutdownHookTimeout, engine.shutdownHooks[0].Timeout)
+	assert.Equal(t, time.Second, engine.shutdownHooks[1].Timeout)
+}
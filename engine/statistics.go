@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	statisticsPath = "/admin/statistics"
+	metricsPath    = "/admin/metrics"
+
+	// unique consumers are tracked up to this number per collection, to bound memory usage
+	maxConsumersPerCollection = 100_000
+
+	unknownFormat = "unknown"
+)
+
+// URL params identifying a collection, see the routes of the various OGC API modules
+var collectionParams = []string{"collectionId", "3dContainerId"}
+
+// paths (prefixes) which aren't part of the API and therefore aren't counted
+var excludedFromStatistics = []string{"/admin", healthPath, versionPath}
+
+type usageKey struct {
+	collection string
+	endpoint   string
+	format     string
+}
+
+// StatisticsCollector keeps usage statistics in memory, since the start of this GoKoala
+// instance or since the last usage report (when enabled), see Rotate.
+type StatisticsCollector struct {
+	consumerHeader string
+	salt           []byte
+	cn             *ContentNegotiation
+
+	mu        sync.Mutex
+	since     time.Time
+	requests  map[usageKey]uint64
+	consumers map[string]map[uint64]struct{} // hashed consumers per collection
+	all       map[uint64]struct{}            // hashed consumers of the whole API
+}
+
+// UsageStatistics snapshot of the collected usage statistics
+type UsageStatistics struct {
+	Since           time.Time         `json:"since"`
+	Until           time.Time         `json:"until"`
+	Requests        uint64            `json:"requests"`
+	UniqueConsumers int               `json:"uniqueConsumers"`
+	Collections     []CollectionUsage `json:"collections"`
+}
+
+// CollectionUsage usage of a single collection. Requests not related to a
+// collection (landing page, conformance, etc.) are reported without collection.
+type CollectionUsage struct {
+	Collection      string                       `json:"collection,omitempty"`
+	Requests        map[string]map[string]uint64 `json:"requests"` // by endpoint (route) and format, e.g. json, html, pbf
+	UniqueConsumers int                          `json:"uniqueConsumers"`
+}
+
+func newStatisticsCollector(config *Statistics, cn *ContentNegotiation) *StatisticsCollector {
+	// random salt per instance, so hashed consumers can't be traced back by
+	// hashing all possible IP addresses (or API keys) with a known salt
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		log.Fatalf("failed to generate salt for usage statistics: %v", err)
+	}
+	collector := &StatisticsCollector{
+		salt:      salt,
+		cn:        cn,
+		since:     time.Now(),
+		requests:  make(map[usageKey]uint64),
+		consumers: make(map[string]map[uint64]struct{}),
+		all:       make(map[uint64]struct{}),
+	}
+	if config.ConsumerHeader != nil {
+		collector.consumerHeader = *config.ConsumerHeader
+	}
+	return collector
+}
+
+// CollectStatistics middleware records usage statistics of successful requests, only
+// active when statistics are enabled in the config. Should be used after middleware.RealIP.
+func (e *Engine) CollectStatistics(next http.Handler) http.Handler {
+	if e.statistics == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, excluded := range excludedFromStatistics {
+			if r.URL.Path == excluded || strings.HasPrefix(r.URL.Path, excluded+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// only count successful requests, status is 0 when the handler didn't write anything
+		if ww.Status() >= http.StatusBadRequest {
+			return
+		}
+		// route context is complete once the request is handled
+		e.statistics.record(collectionID(r), endpoint(r), ww.Header().Get("Content-Type"), e.statistics.consumer(r))
+	})
+}
+
+// Snapshot returns the usage statistics collected so far
+func (sc *StatisticsCollector) Snapshot() UsageStatistics {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.snapshot(time.Now())
+}
+
+// Rotate returns the usage statistics collected so far and starts collecting anew,
+// e.g. to report usage per month. Note that this resets the Prometheus counters.
+func (sc *StatisticsCollector) Rotate(until time.Time) UsageStatistics {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	result := sc.snapshot(until)
+	sc.since = until
+	sc.requests = make(map[usageKey]uint64)
+	sc.consumers = make(map[string]map[uint64]struct{})
+	sc.all = make(map[uint64]struct{})
+	return result
+}
+
+func (sc *StatisticsCollector) snapshot(until time.Time) UsageStatistics {
+	byCollection := make(map[string]*CollectionUsage)
+	result := UsageStatistics{Since: sc.since, Until: until, UniqueConsumers: len(sc.all)}
+	for key, count := range sc.requests {
+		usage, ok := byCollection[key.collection]
+		if !ok {
+			usage = &CollectionUsage{
+				Collection:      key.collection,
+				Requests:        make(map[string]map[string]uint64),
+				UniqueConsumers: len(sc.consumers[key.collection]),
+			}
+			byCollection[key.collection] = usage
+		}
+		if usage.Requests[key.endpoint] == nil {
+			usage.Requests[key.endpoint] = make(map[string]uint64)
+		}
+		usage.Requests[key.endpoint][key.format] += count
+		result.Requests += count
+	}
+	result.Collections = make([]CollectionUsage, 0, len(byCollection))
+	for _, usage := range byCollection {
+		result.Collections = append(result.Collections, *usage)
+	}
+	sort.Slice(result.Collections, func(i, j int) bool {
+		return result.Collections[i].Collection < result.Collections[j].Collection
+	})
+	return result
+}
+
+func (sc *StatisticsCollector) record(collection string, endpoint string, contentType string, consumer uint64) {
+	format := unknownFormat
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		format = mediaType
+		if f, ok := sc.cn.GetFormatByMediaType(mediaType); ok {
+			format = f
+		}
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.requests[usageKey{collection: collection, endpoint: endpoint, format: format}]++
+	consumers, ok := sc.consumers[collection]
+	if !ok {
+		consumers = make(map[uint64]struct{})
+		sc.consumers[collection] = consumers
+	}
+	if len(consumers) < maxConsumersPerCollection {
+		consumers[consumer] = struct{}{}
+	}
+	if len(sc.all) < maxConsumersPerCollection {
+		sc.all[consumer] = struct{}{}
+	}
+}
+
+// consumer returns the salted hash of the consumer (API key or client IP) of the given request
+func (sc *StatisticsCollector) consumer(r *http.Request) uint64 {
+	consumer := ""
+	if sc.consumerHeader != "" {
+		consumer = r.Header.Get(sc.consumerHeader)
+	}
+	if consumer == "" {
+		consumer = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			consumer = host
+		}
+	}
+	hash := sha256.New()
+	hash.Write(sc.salt)
+	hash.Write([]byte(consumer))
+	return binary.BigEndian.Uint64(hash.Sum(nil))
+}
+
+func collectionID(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	for _, param := range collectionParams {
+		if id := rctx.URLParam(param); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// endpoint returns the route (pattern) of the given request, e.g. /collections/{collectionId}/items
+func endpoint(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return r.URL.Path
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+	return "/" // chi trims the slash of the root route
+}
+
+// NewStatisticsEndpoint serves the usage statistics on the main server (as JSON and in the Prometheus
+// text format), only when a token is configured. Without token the statistics are only available on
+// the debug server, see Start.
+func NewStatisticsEndpoint(e *Engine, router chi.Router) {
+	if e.statistics == nil || e.Config.Statistics.Token == nil {
+		return
+	}
+	authorized := router.With(requireBearerToken(*e.Config.Statistics.Token))
+	authorized.Get(statisticsPath, e.statistics.ServeJSON())
+	authorized.Get(metricsPath, e.statistics.ServeMetrics())
+}
+
+// ServeJSON serves the usage statistics as JSON
+func (sc *StatisticsCollector) ServeJSON() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		statisticsJSON, err := json.Marshal(sc.Snapshot())
+		if err != nil {
+			http.Error(w, "failed to marshal usage statistics", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		SafeWrite(w.Write, statisticsJSON)
+	}
+}
+
+// ServeMetrics serves the usage statistics in the Prometheus text-based exposition
+// format, see https://prometheus.io/docs/instrumenting/exposition_formats/
+func (sc *StatisticsCollector) ServeMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		statistics := sc.Snapshot()
+
+		var sb strings.Builder
+		sb.WriteString("# HELP gokoala_requests_total Number of successful requests per collection, endpoint and format.\n")
+		sb.WriteString("# TYPE gokoala_requests_total counter\n")
+		for _, row := range statistics.rows() {
+			fmt.Fprintf(&sb, "gokoala_requests_total{collection=\"%s\",endpoint=\"%s\",format=\"%s\"} %d\n",
+				escapeLabelValue(row.collection), escapeLabelValue(row.endpoint), escapeLabelValue(row.format), row.requests)
+		}
+		sb.WriteString("# HELP gokoala_unique_consumers Number of unique consumers per collection.\n")
+		sb.WriteString("# TYPE gokoala_unique_consumers gauge\n")
+		for _, usage := range statistics.Collections {
+			fmt.Fprintf(&sb, "gokoala_unique_consumers{collection=\"%s\"} %d\n",
+				escapeLabelValue(usage.Collection), usage.UniqueConsumers)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		SafeWrite(w.Write, []byte(sb.String()))
+	}
+}
+
+type usageRow struct {
+	usageKey
+	requests        uint64
+	uniqueConsumers int // of the collection
+}
+
+// rows flattens the usage statistics to one row per collection, endpoint and format (sorted)
+func (us UsageStatistics) rows() []usageRow {
+	var result []usageRow
+	for _, usage := range us.Collections {
+		for endpoint, formats := range usage.Requests {
+			for format, count := range formats {
+				result = append(result, usageRow{
+					usageKey:        usageKey{collection: usage.Collection, endpoint: endpoint, format: format},
+					requests:        count,
+					uniqueConsumers: usage.UniqueConsumers,
+				})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].collection != result[j].collection {
+			return result[i].collection < result[j].collection
+		}
+		if result[i].endpoint != result[j].endpoint {
+			return result[i].endpoint < result[j].endpoint
+		}
+		return result[i].format < result[j].format
+	})
+	return result
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func requireBearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
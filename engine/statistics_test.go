@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestCollectStatistics(t *testing.T) {
+	consumerHeader := "X-Api-Key"
+	engine := newStatisticsTestEngine(&Statistics{ConsumerHeader: &consumerHeader})
+	router := newStatisticsTestRouter(engine)
+
+	requests := []struct {
+		path       string
+		remoteAddr string
+		apiKey     string
+	}{
+		{path: "/", remoteAddr: "10.0.0.1:1234"},
+		{path: "/collections/foo/items", remoteAddr: "10.0.0.1:1234"},
+		{path: "/collections/foo/items", remoteAddr: "10.0.0.1:5678"}, // same consumer, other port
+		{path: "/collections/foo/items", remoteAddr: "10.0.0.2:1234"},
+		{path: "/collections/foo/items?f=html", remoteAddr: "10.0.0.2:1234"},
+		{path: "/collections/bar/items", remoteAddr: "10.0.0.1:1234", apiKey: "abc"},
+		{path: "/collections/bar/items", remoteAddr: "10.0.0.3:1234", apiKey: "abc"}, // same consumer, other IP
+		{path: "/collections/bar/missing", remoteAddr: "10.0.0.4:1234"},              // not found, not counted
+		{path: "/health", remoteAddr: "10.0.0.5:1234"},                               // not part of API, not counted
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodGet, req.path, nil)
+		r.RemoteAddr = req.remoteAddr
+		if req.apiKey != "" {
+			r.Header.Set(consumerHeader, req.apiKey)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	statistics := engine.statistics.Snapshot()
+	assert.Equal(t, uint64(7), statistics.Requests)
+	assert.Equal(t, 3, statistics.UniqueConsumers)
+	assert.Equal(t, []CollectionUsage{
+		{Collection: "", Requests: map[string]map[string]uint64{
+			"/": {"html": 1},
+		}, UniqueConsumers: 1},
+		{Collection: "bar", Requests: map[string]map[string]uint64{
+			"/collections/{collectionId}/items": {"geojson": 2},
+		}, UniqueConsumers: 1},
+		{Collection: "foo", Requests: map[string]map[string]uint64{
+			"/collections/{collectionId}/items": {"geojson": 3, "html": 1},
+		}, UniqueConsumers: 2},
+	}, statistics.Collections)
+}
+
+func TestStatisticsCollector_Rotate(t *testing.T) {
+	engine := newStatisticsTestEngine(&Statistics{})
+	router := newStatisticsTestRouter(engine)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/collections/foo/items", nil))
+
+	until := time.Now()
+	statistics := engine.statistics.Rotate(until)
+	assert.Equal(t, uint64(1), statistics.Requests)
+	assert.Equal(t, 1, statistics.UniqueConsumers)
+	assert.Equal(t, until, statistics.Until)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	statistics = engine.statistics.Snapshot()
+	assert.Equal(t, until, statistics.Since)
+	assert.Equal(t, uint64(1), statistics.Requests)
+	assert.Equal(t, []CollectionUsage{
+		{Collection: "", Requests: map[string]map[string]uint64{"/": {"html": 1}}, UniqueConsumers: 1},
+	}, statistics.Collections)
+}
+
+func TestCollectStatistics_Disabled(t *testing.T) {
+	engine := newStatisticsTestEngine(nil)
+	router := newStatisticsTestRouter(engine)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/collections/foo/items", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, engine.statistics)
+}
+
+func TestStatisticsEndpoint(t *testing.T) {
+	token := "secret"
+	engine := newStatisticsTestEngine(&Statistics{Token: &token})
+	router := newStatisticsTestRouter(engine)
+	NewStatisticsEndpoint(engine, router)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/collections/foo/items", nil))
+
+	tests := []struct {
+		name            string
+		path            string
+		authorization   string
+		wantStatusCode  int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:           "without token",
+			path:           "/admin/statistics",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "with wrong token",
+			path:           "/admin/metrics",
+			authorization:  "Bearer wrong",
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:            "statistics as JSON",
+			path:            "/admin/statistics",
+			authorization:   "Bearer secret",
+			wantStatusCode:  http.StatusOK,
+			wantContentType: MediaTypeJSON,
+		},
+		{
+			name:            "statistics in Prometheus format",
+			path:            "/admin/metrics",
+			authorization:   "Bearer secret",
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "text/plain; version=0.0.4; charset=utf-8",
+			wantBody: `# HELP gokoala_requests_total Number of successful requests per collection, endpoint and format.
+# TYPE gokoala_requests_total counter
+gokoala_requests_total{collection="foo",endpoint="/collections/{collectionId}/items",format="geojson"} 1
+# HELP gokoala_unique_consumers Number of unique consumers per collection.
+# TYPE gokoala_unique_consumers gauge
+gokoala_unique_consumers{collection="foo"} 1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantContentType != "" {
+				assert.Equal(t, tt.wantContentType, rr.Header().Get("Content-Type"))
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+			if tt.wantContentType == MediaTypeJSON {
+				var statistics UsageStatistics
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &statistics))
+				assert.Equal(t, uint64(1), statistics.Requests)
+			}
+		})
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `foo \"bar\" \\ \n`, escapeLabelValue("foo \"bar\" \\ \n"))
+}
+
+func newStatisticsTestEngine(statistics *Statistics) *Engine {
+	cn := newContentNegotiation(nil, language.Dutch)
+	engine := &Engine{Config: &Config{Statistics: statistics}, CN: cn}
+	if statistics != nil {
+		engine.statistics = newStatisticsCollector(statistics, cn)
+	}
+	return engine
+}
+
+func newStatisticsTestRouter(engine *Engine) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(engine.CollectStatistics)
+	NewHealthEndpoint(engine, router)
+	router.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		SafeWrite(w.Write, []byte("<html></html>"))
+	})
+	router.Get("/collections/{collectionId}/items", func(w http.ResponseWriter, r *http.Request) {
+		contentType := MediaTypeGeoJSON
+		if r.URL.Query().Get(FormatParam) == FormatHTML {
+			contentType = MediaTypeHTML
+		}
+		w.Header().Set("Content-Type", contentType)
+		SafeWrite(w.Write, []byte("{}"))
+	})
+	return router
+}
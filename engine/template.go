@@ -9,10 +9,15 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	texttemplate "text/template"
+	"time"
 
 	"github.com/PDOK/gokoala/engine/util"
 	sprig "github.com/go-task/slim-sprig"
@@ -25,7 +30,11 @@ import (
 )
 
 const (
-	layoutFile = "layout.go.html"
+	layoutFile  = "layout.go.html"
+	partialsDir = templatesDir + "partials/"
+
+	// EmbedParam query param to request the "embed" variant of an HTML page, see TemplateData.Embed
+	EmbedParam = "embed"
 )
 
 var (
@@ -49,6 +58,12 @@ type TemplateKey struct {
 	// Optional. Only required when you want to render the same template multiple times (with different content).
 	// By specifying an 'instance name' you can refer to a certain instance of a rendered template later on.
 	InstanceName string
+
+	// Embed the chrome-less variant of a rendered HTML template, see TemplateData.Embed
+	Embed bool
+
+	// Variant name of the alternative HTML templates (see TemplateVariants in config), empty for the default templates
+	Variant string
 }
 
 // TemplateData the data/variables passed as an argument into the template.
@@ -61,11 +76,10 @@ type TemplateData struct {
 
 	// Crumb path to the page, in key-value pairs of name, path
 	Breadcrumbs []Breadcrumb
-}
 
-type Breadcrumb struct {
-	Name string
-	Path string
+	// Embed when true the HTML page is rendered without header and footer ("chrome-less")
+	// so it can be embedded in other websites using an iframe, see also the oEmbed endpoint.
+	Embed bool
 }
 
 // NewTemplateKey build TemplateKeys
@@ -99,6 +113,12 @@ func ExpandTemplateKey(key TemplateKey, language language.Tag) TemplateKey {
 	return copyKey
 }
 
+// validators of a rendered template, used to honor conditional requests (If-None-Match, If-Modified-Since)
+type validators struct {
+	etag         string
+	lastModified time.Time
+}
+
 type Templates struct {
 	// ParsedTemplates templates loaded from disk and parsed to an in-memory Go representation.
 	ParsedTemplates map[TemplateKey]interface{}
@@ -107,21 +127,38 @@ type Templates struct {
 	// We prefer pre-rendered templates whenever possible. These are stored in this map.
 	RenderedTemplates map[TemplateKey][]byte
 
+	// validators (ETag, Last-Modified) of RenderedTemplates, to serve conditional requests
+	validators map[TemplateKey]validators
+
 	config     *Config
 	localizers map[language.Tag]i18n.Localizer
+
+	// directories of the enabled template variants by name, see TemplateVariants in config
+	variants map[string]string
+
+	// guards RenderedTemplates (and validators), since templates can be (re)rendered at runtime (e.g. when a style changes)
+	mu sync.RWMutex
 }
 
 func newTemplates(config *Config) *Templates {
 	templates := &Templates{
 		ParsedTemplates:   make(map[TemplateKey]interface{}),
 		RenderedTemplates: make(map[TemplateKey][]byte),
+		validators:        make(map[TemplateKey]validators),
 		config:            config,
 		localizers:        newLocalizers(config.AvailableLanguages),
+		variants:          make(map[string]string),
+	}
+	if config.TemplateVariants != nil && config.FeatureEnabled(FeatureFlagTemplateVariants) {
+		for _, variant := range config.TemplateVariants.Variants {
+			templates.variants[variant.Name] = variant.Directory
+		}
 	}
 	customFuncs := texttemplate.FuncMap{
 		// custom template functions
-		"markdown":   markdown,
-		"unmarkdown": unmarkdown,
+		"markdown":           markdown,
+		"unmarkdown":         unmarkdown,
+		"conformanceClasses": conformanceClasses,
 	}
 	// we also support https://github.com/go-task/slim-sprig functions
 	sprigFuncs := sprig.FuncMap()
@@ -136,19 +173,58 @@ func (t *Templates) getParsedTemplate(key TemplateKey) (interface{}, error) {
 	return nil, fmt.Errorf("no parsed template with name %s", key.Name)
 }
 
-func (t *Templates) getRenderedTemplate(key TemplateKey) ([]byte, error) {
+// GetRenderedTemplate returns the rendered template with the given key
+func (t *Templates) GetRenderedTemplate(key TemplateKey) ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if RenderedTemplate, ok := t.RenderedTemplates[key]; ok {
 		return RenderedTemplate, nil
 	}
 	return nil, fmt.Errorf("no rendered template with name %s", key.Name)
 }
 
+// getRenderedTemplateWithValidators returns the rendered template with the given key, including its validators
+func (t *Templates) getRenderedTemplateWithValidators(key TemplateKey) ([]byte, validators, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if renderedTemplate, ok := t.RenderedTemplates[key]; ok {
+		return renderedTemplate, t.validators[key], nil
+	}
+	return nil, validators{}, fmt.Errorf("no rendered template with name %s", key.Name)
+}
+
+// UpdateRenderedTemplate applies the given update to the rendered template with the given key
+// (in all languages), e.g. to post-process a rendered template. Safe to use while serving requests.
+func (t *Templates) UpdateRenderedTemplate(key TemplateKey, update func(rendered []byte) ([]byte, error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for lang := range t.localizers {
+		keyWithLang := ExpandTemplateKey(key, lang)
+		rendered, ok := t.RenderedTemplates[keyWithLang]
+		if !ok {
+			continue
+		}
+		result, err := update(rendered)
+		if err != nil {
+			return err
+		}
+		t.RenderedTemplates[keyWithLang] = result
+		if !bytes.Equal(rendered, result) {
+			t.validators[keyWithLang] = newValidators(result)
+		}
+	}
+	return nil
+}
+
 func (t *Templates) parseAndSaveTemplate(key TemplateKey) {
 	for lang := range t.localizers {
 		keyWithLang := ExpandTemplateKey(key, lang)
 		if key.Format == FormatHTML {
-			_, parsed := t.parseHTMLTemplate(keyWithLang, lang)
-			t.ParsedTemplates[keyWithLang] = parsed
+			for _, variant := range t.variantNames() {
+				keyWithLang.Variant = variant
+				_, parsed := t.parseHTMLTemplate(keyWithLang, lang)
+				t.ParsedTemplates[keyWithLang] = parsed
+			}
 		} else {
 			_, parsed := t.parseNonHTMLTemplate(keyWithLang, lang)
 			t.ParsedTemplates[keyWithLang] = parsed
@@ -158,35 +234,81 @@ func (t *Templates) parseAndSaveTemplate(key TemplateKey) {
 
 func (t *Templates) renderAndSaveTemplate(key TemplateKey, breadcrumbs []Breadcrumb, params interface{}) {
 	for lang := range t.localizers {
-		var result []byte
+		// Store rendered template per language
+		keyWithLang := ExpandTemplateKey(key, lang)
 		if key.Format == FormatHTML {
-			file, parsed := t.parseHTMLTemplate(key, lang)
-			result = t.renderHTMLTemplate(parsed, params, breadcrumbs, file)
+			for _, variant := range t.variantNames() {
+				keyWithLang.Variant = variant
+				file, parsed := t.parseHTMLTemplate(keyWithLang, lang)
+				t.saveRenderedTemplate(keyWithLang, t.renderHTMLTemplate(parsed, params, breadcrumbs, false, file))
+
+				// also store the embed variant of each HTML page
+				embedKey := keyWithLang
+				embedKey.Embed = true
+				t.saveRenderedTemplate(embedKey, t.renderHTMLTemplate(parsed, params, breadcrumbs, true, file))
+			}
 		} else {
 			file, parsed := t.parseNonHTMLTemplate(key, lang)
-			result = t.renderNonHTMLTemplate(parsed, params, key, file)
+			t.saveRenderedTemplate(keyWithLang, t.renderNonHTMLTemplate(parsed, params, key, file))
 		}
-
-		// Store rendered template per language
-		key.Language = lang
-		t.RenderedTemplates[key] = result
 	}
 }
 
+func (t *Templates) saveRenderedTemplate(key TemplateKey, rendered []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.RenderedTemplates[key] = rendered
+	t.validators[key] = newValidators(rendered)
+}
+
+// newValidators strong ETag (hash of the rendered template) and Last-Modified (time of rendering, so startup
+// or the moment the template is re-rendered at runtime) of the given rendered template
+func newValidators(rendered []byte) validators {
+	return validators{etag: NewETag(rendered), lastModified: time.Now()}
+}
+
+// parseHTMLTemplate parses the given HTML template together with the base layout and the shared
+// partials (header, breadcrumbs, footer, map widget, etc.). The template is parsed last, so it can
+// override blocks/partials of the layout by (re)defining them, e.g. {{define "footer"}}.
+// For a template variant the layout, partials and template of the variant take precedence.
 func (t *Templates) parseHTMLTemplate(key TemplateKey, lang language.Tag) (string, *htmltemplate.Template) {
 	file := filepath.Clean(filepath.Join(key.Directory, key.Name))
+	files := append([]string{templatesDir + layoutFile}, globPartials("")...)
+	if dir, ok := t.variants[key.Variant]; ok {
+		// files with the same name are parsed again, the last one parsed wins
+		if variantLayout := filepath.Join(dir, templatesDir, layoutFile); fileExists(variantLayout) {
+			files = append(files, variantLayout)
+		}
+		files = append(files, globPartials(dir)...)
+		if variantFile := filepath.Join(dir, file); fileExists(variantFile) {
+			file = variantFile
+		}
+	}
+	files = append(files, file)
+
 	templateFuncs := t.createTemplateFuncs(lang)
 	parsed := htmltemplate.Must(htmltemplate.New(layoutFile).
-		Funcs(templateFuncs).ParseFiles(templatesDir+layoutFile, file))
+		Funcs(templateFuncs).ParseFiles(files...))
 	return file, parsed
 }
 
-func (t *Templates) renderHTMLTemplate(parsed *htmltemplate.Template, params interface{}, breadcrumbs []Breadcrumb, file string) []byte {
+func globPartials(dir string) []string {
+	partials, err := filepath.Glob(filepath.Join(dir, partialsDir, "*.go.html"))
+	if err != nil {
+		log.Fatalf("invalid glob pattern for partials: %v", err)
+	}
+	return partials
+}
+
+func (t *Templates) renderHTMLTemplate(parsed *htmltemplate.Template, params interface{},
+	breadcrumbs []Breadcrumb, embed bool, file string) []byte {
+
 	var rendered bytes.Buffer
 	if err := parsed.Execute(&rendered, &TemplateData{
 		Config:      t.config,
 		Params:      params,
 		Breadcrumbs: breadcrumbs,
+		Embed:       embed,
 	}); err != nil {
 		log.Fatalf("failed to execute HTML template %s, error: %v", file, err)
 	}
@@ -222,13 +344,61 @@ func (t *Templates) createTemplateFuncs(lang language.Tag) map[string]interface{
 	return combineFuncMaps(globalTemplateFuncs, texttemplate.FuncMap{
 		// create func just-in-time based on TemplateKey
 		"i18n": func(messageID string) htmltemplate.HTML {
-			localizer := t.localizers[lang]
-			translated := localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: messageID})
-			return htmltemplate.HTML(translated) //nolint:gosec // since we trust our language files
+			return htmltemplate.HTML(t.translate(messageID, lang)) //nolint:gosec // since we trust our language files
+		},
+		// pick the variant of the given content (e.g. HTMLBlock) for the current language
+		"localize": func(content map[string]string) htmltemplate.HTML {
+			return htmltemplate.HTML(localize(content, t.config.LanguageFallbackChain(lang))) //nolint:gosec // since we trust our config file
+		},
+		// format dates, timestamps and numbers (e.g. feature properties) according to the current language
+		"formatDate": func(value any) string {
+			return formatDate(value, lang)
+		},
+		"formatDateTime": func(value any) string {
+			return formatDateTime(value, lang)
+		},
+		"formatNumber": func(value any) string {
+			return formatNumber(value, lang)
+		},
+		"formatValue": func(value any) any {
+			return formatValue(value, lang)
 		},
 	})
 }
 
+// translate returns the message with the given ID in the given language, falls back to the
+// next language in the fallback chain when the message isn't translated in that language.
+func (t *Templates) translate(messageID string, lang language.Tag) string {
+	var err error
+	for _, l := range t.config.LanguageFallbackChain(lang) {
+		localizer, ok := t.localizers[l]
+		if !ok {
+			continue
+		}
+		var translated string
+		if translated, err = localizer.Localize(&i18n.LocalizeConfig{MessageID: messageID}); err == nil {
+			return translated
+		}
+	}
+	panic(fmt.Errorf("no translation of message %s in language %s or its fallback languages: %w", messageID, lang, err))
+}
+
+// localize returns the content in the first language of the given fallback chain for which content
+// is available, and when none of these is available the first language in alphabetical order.
+func localize(content map[string]string, chain []language.Tag) string {
+	for _, lang := range chain {
+		if value, ok := content[lang.String()]; ok {
+			return value
+		}
+	}
+	languages := util.Keys(content)
+	if len(languages) == 0 {
+		return ""
+	}
+	slices.Sort(languages)
+	return content[languages[0]]
+}
+
 // read file, return contents as string
 func (t *Templates) readFile(filePath string) string {
 	gzipFile := filePath + ".gz"
@@ -339,3 +509,43 @@ func unmarkdown(s *string) string {
 	withoutLinebreaks := strings.ReplaceAll(withoutMarkdown, "\n", " ")
 	return withoutLinebreaks
 }
+
+// variantNames names of the HTML template variants to render, including the default (empty name)
+func (t *Templates) variantNames() []string {
+	return append([]string{""}, util.Keys(t.variants)...)
+}
+
+// requestedVariant the template variant requested by the client through the configured header or cookie,
+// empty for the default templates. Also marks the response as varying by this header and cookie.
+func (t *Templates) requestedVariant(w http.ResponseWriter, r *http.Request) string {
+	if len(t.variants) == 0 {
+		return ""
+	}
+	addVary(w.Header(), t.config.TemplateVariants.Header)
+	addVary(w.Header(), "Cookie")
+
+	variant := r.Header.Get(t.config.TemplateVariants.Header)
+	if variant == "" {
+		if cookie, err := r.Cookie(t.config.TemplateVariants.Cookie); err == nil {
+			variant = cookie.Value
+		}
+	}
+	if _, ok := t.variants[variant]; ok {
+		return variant
+	}
+	return ""
+}
+
+// VariantHeaders request headers (besides Cookie) which select a template variant, e.g. to use in cache keys
+func (t *Templates) VariantHeaders() []string {
+	if len(t.variants) == 0 {
+		return nil
+	}
+	return []string{t.config.TemplateVariants.Header}
+}
+
+// isEmbedRequested whether the client requested the embed variant of an HTML page
+func isEmbedRequested(r *http.Request) bool {
+	embed, err := strconv.ParseBool(r.URL.Query().Get(EmbedParam))
+	return err == nil && embed
+}
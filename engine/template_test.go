@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  map[string]string
+		lang     language.Tag
+		fallback []language.Tag
+		want     string
+	}{
+		{
+			name:    "requested language available",
+			content: map[string]string{"nl": "Onderhoud", "en": "Maintenance"},
+			lang:    language.English,
+			want:    "Maintenance",
+		},
+		{
+			name:    "fallback to Dutch",
+			content: map[string]string{"nl": "Onderhoud", "fr": "Maintenance"},
+			lang:    language.English,
+			want:    "Onderhoud",
+		},
+		{
+			name:     "configured fallback order",
+			content:  map[string]string{"nl": "Onderhoud", "en": "Maintenance", "de": "Wartung"},
+			lang:     language.MustParse("fy"),
+			fallback: []language.Tag{language.English, language.Dutch},
+			want:     "Maintenance",
+		},
+		{
+			name:     "next language in configured fallback order",
+			content:  map[string]string{"nl": "Onderhoud", "de": "Wartung"},
+			lang:     language.MustParse("fy"),
+			fallback: []language.Tag{language.English, language.Dutch},
+			want:     "Onderhoud",
+		},
+		{
+			name:    "fallback to first language",
+			content: map[string]string{"fr": "Entretien", "de": "Wartung"},
+			lang:    language.English,
+			want:    "Wartung",
+		},
+		{
+			name:    "no content",
+			content: map[string]string{},
+			lang:    language.English,
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{LanguageFallback: tt.fallback}
+			assert.Equal(t, tt.want, localize(tt.content, config.LanguageFallbackChain(tt.lang)))
+		})
+	}
+}
+
+func TestTemplates_translate(t *testing.T) {
+	frisian := language.MustParse("fy")
+	localizers := make(map[language.Tag]i18n.Localizer)
+	for lang, messages := range map[language.Tag][]*i18n.Message{
+		frisian:          {{ID: "Home", Other: "Thús"}},
+		language.Dutch:   {{ID: "Home", Other: "Home"}, {ID: "Download", Other: "Downloaden"}},
+		language.English: {{ID: "Home", Other: "Home"}, {ID: "Download", Other: "Download"}, {ID: "Search", Other: "Search"}},
+	} {
+		bundle := i18n.NewBundle(lang)
+		require.NoError(t, bundle.AddMessages(lang, messages...))
+		localizers[lang] = *i18n.NewLocalizer(bundle, lang.String())
+	}
+	templates := &Templates{
+		config: &Config{
+			AvailableLanguages: []language.Tag{frisian, language.Dutch, language.English},
+			LanguageFallback:   []language.Tag{frisian, language.Dutch, language.English},
+		},
+		localizers: localizers,
+	}
+
+	assert.Equal(t, "Thús", templates.translate("Home", frisian))
+	assert.Equal(t, "Downloaden", templates.translate("Download", frisian))
+	assert.Equal(t, "Search", templates.translate("Search", frisian))
+	assert.Equal(t, "Download", templates.translate("Download", language.English))
+	assert.Panics(t, func() { templates.translate("Unknown", frisian) })
+}
+
+func TestTemplates_RenderHTMLWithLayoutAndPartials(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		template   string
+		want       []string
+		wantAbsent []string
+	}{
+		{
+			name:     "content in layout with shared header and footer",
+			template: `{{ define "content" }}<p>page content</p>{{ end }}`,
+			want:     []string{"<title>Minimal OGC API (OGC API)</title>", "<p>page content</p>", `<ol class="breadcrumb">`, "logo-footer.png"},
+		},
+		{
+			name: "override blocks and partials of layout",
+			template: `{{ define "title" }}Custom title{{ end }}
+{{ define "footer" }}<footer>custom footer</footer>{{ end }}
+{{ define "content" }}<p>page content</p>{{ end }}`,
+			want:       []string{"<title>Custom title</title>", "<p>page content</p>", "<footer>custom footer</footer>"},
+			wantAbsent: []string{"logo-footer.png"},
+		},
+		{
+			name:     "map widget partial",
+			template: `{{ define "content" }}{{ template "vectortile-view" (dict "ID" "map" "TileURL" "https://tiles.example/tiles" "ShowGrid" "false") }}{{ end }}`,
+			want: []string{"vectortile-view-component/main.js", `<app-vectortile-view id="map"`,
+				`tile-url="https://tiles.example/tiles"`, `show-grid="false"`},
+			wantAbsent: []string{"style-url", "show-object-info"},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, fmt.Sprintf("page%d.go.html", i))
+			require.NoError(t, os.WriteFile(file, []byte(tt.template), 0o600))
+			templates := newTemplates(readConfigFile("engine/testdata/config_minimal.yaml"))
+
+			key := NewTemplateKey(file)
+			templates.renderAndSaveTemplate(key, nil, nil)
+			rendered, err := templates.GetRenderedTemplate(ExpandTemplateKey(key, language.Dutch))
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, string(rendered), want)
+			}
+			for _, absent := range tt.wantAbsent {
+				assert.NotContains(t, string(rendered), absent)
+			}
+		})
+	}
+}
+
+func TestTemplates_Variants(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.go.html")
+	require.NoError(t, os.WriteFile(page, []byte(`{{ define "content" }}<p>default page</p>{{ end }}`), 0o600))
+
+	// beta overrides the footer partial and the page, redesign only the page
+	beta := filepath.Join(dir, "beta")
+	require.NoError(t, os.MkdirAll(filepath.Join(beta, partialsDir), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(beta, partialsDir, "footer.go.html"),
+		[]byte(`{{ define "footer" }}<footer>beta footer</footer>{{ end }}`), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(beta, dir), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(beta, page),
+		[]byte(`{{ define "content" }}<p>beta page</p>{{ end }}`), 0o600))
+	redesign := filepath.Join(dir, "redesign")
+	require.NoError(t, os.MkdirAll(filepath.Join(redesign, dir), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(redesign, page),
+		[]byte(`{{ define "content" }}<p>redesigned page</p>{{ end }}`), 0o600))
+
+	config := readConfigFile("engine/testdata/config_minimal.yaml")
+	config.FeatureFlags = map[string]bool{FeatureFlagTemplateVariants: true}
+	config.TemplateVariants = &TemplateVariants{
+		Header:   "X-Template-Variant",
+		Cookie:   "template-variant",
+		Variants: []TemplateVariant{{Name: "beta", Directory: beta}, {Name: "redesign", Directory: redesign}},
+	}
+	templates := newTemplates(config)
+	key := NewTemplateKey(page)
+	templates.renderAndSaveTemplate(key, nil, nil)
+
+	tests := []struct {
+		name       string
+		header     string
+		cookie     string
+		want       []string
+		wantAbsent []string
+	}{
+		{
+			name:       "default templates",
+			want:       []string{"<p>default page</p>", "logo-footer.png"},
+			wantAbsent: []string{"beta"},
+		},
+		{
+			name:   "variant by header",
+			header: "beta",
+			want:   []string{"<p>beta page</p>", "<footer>beta footer</footer>"},
+		},
+		{
+			name:   "variant by cookie",
+			cookie: "redesign",
+			want:   []string{"<p>redesigned page</p>", "logo-footer.png"},
+		},
+		{
+			name:   "header takes precedence over cookie",
+			header: "beta",
+			cookie: "redesign",
+			want:   []string{"<p>beta page</p>"},
+		},
+		{
+			name:   "unknown variant",
+			header: "alpha",
+			want:   []string{"<p>default page</p>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/page", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Template-Variant", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "template-variant", Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			variantKey := ExpandTemplateKey(key, language.Dutch)
+			variantKey.Variant = templates.requestedVariant(w, r)
+			assert.Equal(t, []string{"X-Template-Variant", "Cookie"}, w.Header().Values("Vary"))
+
+			rendered, err := templates.GetRenderedTemplate(variantKey)
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, string(rendered), want)
+			}
+			for _, absent := range tt.wantAbsent {
+				assert.NotContains(t, string(rendered), absent)
+			}
+		})
+	}
+}
+
+func TestTemplates_VariantsDisabledByFeatureFlag(t *testing.T) {
+	config := readConfigFile("engine/testdata/config_minimal.yaml")
+	config.TemplateVariants = &TemplateVariants{
+		Header:   "X-Template-Variant",
+		Cookie:   "template-variant",
+		Variants: []TemplateVariant{{Name: "beta", Directory: t.TempDir()}},
+	}
+	templates := newTemplates(config)
+
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/page", nil)
+	r.Header.Set("X-Template-Variant", "beta")
+	w := httptest.NewRecorder()
+	assert.Empty(t, templates.requestedVariant(w, r))
+	assert.Empty(t, w.Header().Values("Vary"))
+	assert.Empty(t, templates.VariantHeaders())
+}
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	usageReportTimeout = 30 * time.Second
+	usageReportTime    = "20060102T150405"
+)
+
+// usageReport usage of a single GoKoala instance during (part of) a month
+type usageReport struct {
+	Service  string `json:"service"`
+	Instance string `json:"instance"`
+	UsageStatistics
+}
+
+type usageReporter struct {
+	config   *UsageReport
+	service  string
+	instance string
+
+	// sends email, replaceable for testing
+	sendMail func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newUsageReporter(config *Config) *usageReporter {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = unknownBuildInfo
+	}
+	return &usageReporter{
+		config:   config.Statistics.Report,
+		service:  config.ServiceIdentifier,
+		instance: instance,
+		sendMail: sendMail,
+	}
+}
+
+// startUsageReports reports the usage statistics at the start of each month. Statistics are
+// kept in memory, so the usage of a partial month is reported on shutdown.
+func (e *Engine) startUsageReports() {
+	reporter := newUsageReporter(e.Config)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			next := startOfNextMonth(time.Now())
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				reportCtx, reportCancel := context.WithTimeout(ctx, usageReportTimeout)
+				reporter.report(reportCtx, e.statistics.Rotate(next))
+				reportCancel()
+			}
+		}
+	}()
+	e.RegisterShutdownHook(ShutdownHook{
+		Name: "usage report",
+		Func: func(ctx context.Context) {
+			cancel()
+			<-done
+			reporter.report(ctx, e.statistics.Rotate(time.Now()))
+		},
+		Timeout: usageReportTimeout,
+	})
+}
+
+func startOfNextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+// report writes the given usage statistics to the configured directory and/or sends them by email.
+// Failures are logged, reporting is best-effort since it shouldn't interfere with serving the API.
+// Sending email is aborted when the given context is done, e.g. when the shutdown timeout expires.
+func (ur *usageReporter) report(ctx context.Context, statistics UsageStatistics) {
+	report := usageReport{Service: ur.service, Instance: ur.instance, UsageStatistics: statistics}
+	content, err := ur.encode(report)
+	if err != nil {
+		log.Printf("failed to encode usage report: %v", err)
+		return
+	}
+	filename := fmt.Sprintf("usage-%s-%s.%s", statistics.Since.Format(usageReportTime), ur.instance, ur.config.Format)
+
+	if ur.config.Directory != nil {
+		file := filepath.Join(*ur.config.Directory, filename)
+		if err = os.WriteFile(file, content, 0o644); err != nil { //nolint:gosec // reports aren't secret
+			log.Printf("failed to write usage report %s: %v", file, err)
+		} else {
+			log.Printf("written usage report %s", file)
+		}
+	}
+	if ur.config.Email != nil {
+		if err = ur.email(ctx, report, filename, content); err != nil {
+			log.Printf("failed to email usage report %s: %v", filename, err)
+		} else {
+			log.Printf("emailed usage report %s to %s", filename, strings.Join(ur.config.Email.To, ", "))
+		}
+	}
+}
+
+func (ur *usageReporter) encode(report usageReport) ([]byte, error) {
+	if ur.config.Format == "json" {
+		return json.MarshalIndent(report, "", "  ")
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	err := writer.Write([]string{"service", "instance", "since", "until", "collection", "endpoint",
+		"format", "requests", "uniqueConsumers"})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range report.rows() {
+		err = writer.Write([]string{report.Service, report.Instance,
+			report.Since.Format(time.RFC3339), report.Until.Format(time.RFC3339),
+			row.collection, row.endpoint, row.format,
+			strconv.FormatUint(row.requests, 10), strconv.Itoa(row.uniqueConsumers)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// email sends the report as attachment of a (MIME multipart) email
+func (ur *usageReporter) email(ctx context.Context, report usageReport, filename string, content []byte) error {
+	config := ur.config.Email
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	text, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(text, "Usage of %s (instance %s) from %s until %s, see attachment.\r\n",
+		report.Service, report.Instance, report.Since.Format(time.RFC3339), report.Until.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	contentType := MediaTypeCSV
+	if ur.config.Format == "json" {
+		contentType = MediaTypeJSON
+	}
+	attachment, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("%s; name=%q", contentType, filename)},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", filename)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 { // max line length, see RFC 2045
+		if _, err = fmt.Fprintf(attachment, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	if _, err = fmt.Fprintf(attachment, "%s\r\n", encoded); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: Usage report %s %s\r\n", report.Service, report.Since.Format("2006-01"))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+	msg.Write(body.Bytes())
+
+	var auth smtp.Auth
+	if config.Username != nil {
+		host, _, err := net.SplitHostPort(config.SMTPServer)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", *config.Username, *config.Password, host)
+	}
+	return ur.sendMail(ctx, config.SMTPServer, auth, config.From, config.To, msg.Bytes())
+}
+
+// sendMail sends an email like smtp.SendMail, but aborts when the given context is done. Otherwise an
+// unresponsive SMTP server blocks indefinitely, since smtp.SendMail has no timeout.
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// interrupt pending reads/writes once the context is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if err = client.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err = client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = data.Write(msg); err != nil {
+		return err
+	}
+	if err = data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testUsageStatistics = UsageStatistics{
+	Since:           time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	Until:           time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	Requests:        6,
+	UniqueConsumers: 2,
+	Collections: []CollectionUsage{
+		{Collection: "", Requests: map[string]map[string]uint64{"/": {"html": 1}}, UniqueConsumers: 1},
+		{Collection: "foo", Requests: map[string]map[string]uint64{
+			"/collections/{collectionId}/items": {"json": 2, "html": 1},
+			"/collections/{collectionId}":       {"json": 2},
+		}, UniqueConsumers: 2},
+	},
+}
+
+func TestStartOfNextMonth(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want time.Time
+	}{
+		{
+			name: "middle of month",
+			time: time.Date(2024, 5, 15, 13, 45, 0, 0, time.UTC),
+			want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "start of month",
+			time: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "end of year",
+			time: time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, startOfNextMonth(tt.time))
+		})
+	}
+}
+
+func TestUsageReporter_ReportToDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		wantFile string
+		want     string
+	}{
+		{
+			name:     "csv",
+			format:   "csv",
+			wantFile: "usage-20240501T000000-host1.csv",
+			want: `service,instance,since,until,collection,endpoint,format,requests,uniqueConsumers
+test,host1,2024-05-01T00:00:00Z,2024-06-01T00:00:00Z,,/,html,1,1
+test,host1,2024-05-01T00:00:00Z,2024-06-01T00:00:00Z,foo,/collections/{collectionId},json,2,2
+test,host1,2024-05-01T00:00:00Z,2024-06-01T00:00:00Z,foo,/collections/{collectionId}/items,html,1,2
+test,host1,2024-05-01T00:00:00Z,2024-06-01T00:00:00Z,foo,/collections/{collectionId}/items,json,2,2
+`,
+		},
+		{
+			name:     "json",
+			format:   "json",
+			wantFile: "usage-20240501T000000-host1.json",
+			want: `{
+  "service": "test",
+  "instance": "host1",
+  "since": "2024-05-01T00:00:00Z",
+  "until": "2024-06-01T00:00:00Z",
+  "requests": 6,
+  "uniqueConsumers": 2,
+  "collections": [
+    {
+      "requests": {
+        "/": {
+          "html": 1
+        }
+      },
+      "uniqueConsumers": 1
+    },
+    {
+      "collection": "foo",
+      "requests": {
+        "/collections/{collectionId}": {
+          "json": 2
+        },
+        "/collections/{collectionId}/items": {
+          "html": 1,
+          "json": 2
+        }
+      },
+      "uniqueConsumers": 2
+    }
+  ]
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			reporter := &usageReporter{
+				config:   &UsageReport{Format: tt.format, Directory: &dir},
+				service:  "test",
+				instance: "host1",
+			}
+			reporter.report(context.Background(), testUsageStatistics)
+
+			content, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(content))
+		})
+	}
+}
+
+func TestUsageReporter_ReportByEmail(t *testing.T) {
+	var sentTo []string
+	var sentMsg string
+	username := "user"
+	password := "secret"
+	reporter := &usageReporter{
+		config: &UsageReport{Format: "csv", Email: &UsageReportEmail{
+			SMTPServer: "smtp.example.com:587",
+			Username:   &username,
+			Password:   &password,
+			From:       "gokoala@example.com",
+			To:         []string{"a@example.com", "b@example.com"},
+		}},
+		service:  "test",
+		instance: "host1",
+		sendMail: func(_ context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			assert.Equal(t, "smtp.example.com:587", addr)
+			assert.NotNil(t, a)
+			assert.Equal(t, "gokoala@example.com", from)
+			sentTo = to
+			sentMsg = string(msg)
+			return nil
+		},
+	}
+	reporter.report(context.Background(), testUsageStatistics)
+
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, sentTo)
+	assert.Contains(t, sentMsg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, sentMsg, "Subject: Usage report test 2024-05\r\n")
+	assert.Contains(t, sentMsg, "Content-Type: multipart/mixed; boundary=")
+	assert.Contains(t, sentMsg, `Content-Disposition: attachment; filename="usage-20240501T000000-host1.csv"`)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(sentMsg), "--"))
+}
+
+func TestSendMail_Timeout(t *testing.T) {
+	// SMTP server which accepts connections, but never responds
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = sendMail(ctx, listener.Addr().String(), nil, "gokoala@example.com", []string{"a@example.com"}, []byte("test"))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	versionPath      = "/version"
+	unknownBuildInfo = "unknown"
+)
+
+// Build information, injected at build-time using ldflags. For example:
+//
+//	go build -ldflags "-X github.com/PDOK/gokoala/engine.buildVersion=1.2.3 -X github.com/PDOK/gokoala/engine.buildCommit=$(git rev-parse HEAD)"
+var (
+	buildVersion = ""
+	buildCommit  = ""
+	buildDate    = ""
+)
+
+// VersionInfo build and runtime information of this GoKoala instance
+type VersionInfo struct {
+	// Version of the API (from the config file), also reported in the API-Version header
+	APIVersion string `json:"apiVersion"`
+
+	// Version of the GoKoala application
+	Version string `json:"version"`
+
+	// Git commit of the GoKoala application
+	Commit string `json:"commit"`
+
+	// Date on which the GoKoala application was build
+	BuildDate string `json:"buildDate"`
+
+	// Version of Go used to build the GoKoala application
+	GoVersion string `json:"goVersion"`
+
+	// OGC API modules enabled in the config file
+	Modules []string `json:"modules"`
+}
+
+// NewVersionInfo returns build information, falling back to the info embedded
+// by the Go toolchain when no build information is injected at build-time
+func NewVersionInfo(config *Config) VersionInfo {
+	info := VersionInfo{
+		APIVersion: config.Version,
+		Version:    buildVersion,
+		Commit:     buildCommit,
+		BuildDate:  buildDate,
+		GoVersion:  runtime.Version(),
+		Modules:    config.EnabledModules(),
+	}
+	if goBuildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && goBuildInfo.Main.Version != "(devel)" {
+			info.Version = goBuildInfo.Main.Version
+		}
+		for _, setting := range goBuildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+	}
+	for _, field := range []*string{&info.Version, &info.Commit, &info.BuildDate} {
+		if *field == "" {
+			*field = unknownBuildInfo
+		}
+	}
+	return info
+}
+
+type VersionEndpoint struct {
+	versionJSON []byte
+}
+
+// NewVersionEndpoint serves build information (version, commit, build date and enabled
+// modules) to identify which GoKoala version runs where, useful for monitoring a fleet of instances.
+func NewVersionEndpoint(e *Engine, router chi.Router) *VersionEndpoint {
+	versionJSON, err := json.Marshal(NewVersionInfo(e.Config))
+	if err != nil {
+		log.Fatalf("failed to marshal version info: %v", err)
+	}
+	version := &VersionEndpoint{
+		versionJSON: versionJSON,
+	}
+	router.Get(versionPath, version.Version())
+	return version
+}
+
+func (v *VersionEndpoint) Version() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		SafeWrite(w.Write, v.versionJSON)
+	}
+}
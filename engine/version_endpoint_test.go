@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionEndpoint_Version(t *testing.T) {
+	buildVersion = "1.2.3"
+	buildCommit = "abc123"
+	defer func() {
+		buildVersion = ""
+		buildCommit = ""
+	}()
+
+	engine := &Engine{Config: &Config{
+		Version: "2.0.0",
+		OgcAPI:  OgcAPI{Tiles: &OgcAPITiles{}, Styles: &OgcAPIStyles{}},
+	}}
+	router := chi.NewRouter()
+	NewVersionEndpoint(engine, router)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/version", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, MediaTypeJSON, recorder.Header().Get("Content-Type"))
+
+	var info VersionInfo
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &info))
+	assert.Equal(t, "2.0.0", info.APIVersion)
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, "abc123", info.Commit)
+	assert.NotEmpty(t, info.BuildDate)
+	assert.NotEmpty(t, info.GoVersion)
+	assert.Equal(t, []string{"common", "tiles", "styles"}, info.Modules)
+}
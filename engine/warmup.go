@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const warmupRetryInterval = 5 * time.Second
+
+// WarmupTask function to execute before reporting ready, e.g. to warm caches or run a smoke query
+type WarmupTask struct {
+	// Name of the task, used in logging
+	Name string
+
+	// Func to execute, the given context is canceled when the timeout of the warmup expires.
+	// Failed tasks are retried until they succeed, the API isn't ready in the meantime.
+	Func func(ctx context.Context) error
+}
+
+// RegisterWarmupTask registers a task which should succeed before the readiness endpoint reports ready.
+// Tasks are executed in order of registration once the server is started, see Warmup in config.
+func (e *Engine) RegisterWarmupTask(task WarmupTask) {
+	e.warmupTasks = append(e.warmupTasks, task)
+	e.warmingUp.Store(true)
+}
+
+// AttachWarmup warms up the given engine once this engine is started.
+// Used when multiple engines (API versions) are served side-by-side by the server of this engine.
+func (e *Engine) AttachWarmup(other *Engine) {
+	e.attachedWarmups = append(e.attachedWarmups, other)
+}
+
+// WarmingUp whether the engine is still warming up, in which case it isn't ready to receive traffic
+func (e *Engine) WarmingUp() bool {
+	return e.warmingUp.Load()
+}
+
+// startWarmup warms up this engine and the attached engines in the background
+func (e *Engine) startWarmup(ctx context.Context) {
+	for _, engine := range append([]*Engine{e}, e.attachedWarmups...) {
+		if engine.WarmingUp() {
+			go engine.warmup(ctx)
+		}
+	}
+}
+
+// warmup executes the warmup tasks in order, retries failed tasks and waits for
+// the (optional) slow start delay. Afterwards the engine is ready to receive traffic.
+func (e *Engine) warmup(ctx context.Context) {
+	start := time.Now()
+	timeout := defaultWarmupTimeout
+	if e.Config.Warmup != nil {
+		timeout = e.Config.Warmup.GetTimeout()
+	}
+	for _, task := range e.warmupTasks {
+		for {
+			taskCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := task.Func(taskCtx)
+			cancel()
+			if err == nil {
+				break
+			}
+			log.Printf("warmup task '%s' failed, retrying in %s: %v", task.Name, warmupRetryInterval, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(warmupRetryInterval):
+			}
+		}
+	}
+	if e.Config.Warmup != nil && e.Config.Warmup.SlowStart != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*e.Config.Warmup.SlowStart - time.Since(start)):
+		}
+	}
+	log.Printf("warmup finished in %s, ready to receive traffic", time.Since(start).Round(time.Millisecond))
+	e.warmingUp.Store(false)
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmup(t *testing.T) {
+	tests := []struct {
+		name          string
+		warmup        *Warmup
+		tasks         int
+		cancel        bool
+		wantWarmingUp bool
+		wantDuration  time.Duration
+	}{
+		{
+			name:          "ready without warmup",
+			wantWarmingUp: false,
+		},
+		{
+			name:          "ready once all tasks succeeded",
+			warmup:        &Warmup{SmokeQueries: true},
+			tasks:         3,
+			wantWarmingUp: false,
+		},
+		{
+			name:          "ready after slow start",
+			warmup:        &Warmup{SlowStart: ptrTo(50 * time.Millisecond)},
+			wantWarmingUp: false,
+			wantDuration:  50 * time.Millisecond,
+		},
+		{
+			name:          "not ready when canceled during slow start",
+			warmup:        &Warmup{SlowStart: ptrTo(time.Hour)},
+			cancel:        true,
+			wantWarmingUp: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &Engine{Config: &Config{Warmup: tt.warmup}}
+			engine.warmingUp.Store(tt.warmup != nil)
+			var executed []int
+			for i := 0; i < tt.tasks; i++ {
+				i := i
+				engine.RegisterWarmupTask(WarmupTask{Name: "task", Func: func(ctx context.Context) error {
+					_, hasDeadline := ctx.Deadline()
+					assert.True(t, hasDeadline)
+					executed = append(executed, i)
+					return nil
+				}})
+			}
+			assert.Equal(t, tt.warmup != nil || tt.tasks > 0, engine.WarmingUp()) // see RegisterWarmupTask
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			start := time.Now()
+			engine.warmup(ctx)
+			cancel()
+
+			assert.Equal(t, tt.wantWarmingUp, engine.WarmingUp())
+			assert.GreaterOrEqual(t, time.Since(start), tt.wantDuration)
+			for i := range executed {
+				assert.Equal(t, i, executed[i]) // in order of registration
+			}
+			assert.Len(t, executed, tt.tasks)
+		})
+	}
+}
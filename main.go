@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
 	gokoalaEngine "github.com/PDOK/gokoala/engine"
 	"github.com/PDOK/gokoala/ogc/common/core"
@@ -40,6 +42,13 @@ func main() {
 			Required: false,
 			EnvVars:  []string{"PORT"},
 		},
+		&cli.StringFlag{
+			Name: "unix-socket",
+			Usage: "bind OGC server to a Unix domain socket at the given path instead of host/port, " +
+				"prefix with @ for an abstract socket (Linux only)",
+			Required: false,
+			EnvVars:  []string{"UNIX_SOCKET"},
+		},
 		&cli.IntFlag{
 			Name:     "debug-port",
 			Usage:    "bind port for debug server (disabled by default), do not expose this port publicly",
@@ -54,18 +63,36 @@ func main() {
 			Required: false,
 			EnvVars:  []string{"SHUTDOWN_DELAY"},
 		},
-		&cli.StringFlag{
-			Name:     "config-file",
-			Usage:    "reference to YAML configuration file",
+		&cli.BoolFlag{
+			Name: "reuse-port",
+			Usage: "bind with SO_REUSEPORT, allowing a new instance to start on the same port while the old " +
+				"instance finishes in-flight requests (not needed when using systemd socket activation)",
+			Value:    false,
+			Required: false,
+			EnvVars:  []string{"REUSE_PORT"},
+		},
+		&cli.StringSliceFlag{
+			Name: "config-file",
+			Usage: "reference to YAML configuration file. Repeat (or comma-separate) to serve multiple " +
+				"major versions of an API side-by-side, each under a version prefix (e.g. /v1, /v2)",
 			Required: true,
 			EnvVars:  []string{"CONFIG_FILE"},
 		},
-		&cli.StringFlag{
-			Name:     "openapi-file",
-			Usage:    "reference to a (customized) OGC OpenAPI spec for the dynamic parts of your OGC API",
+		&cli.StringSliceFlag{
+			Name: "openapi-file",
+			Usage: "reference to a (customized) OGC OpenAPI spec for the dynamic parts of your OGC API. " +
+				"When multiple config files are provided, repeat in the same order",
 			Required: false,
 			EnvVars:  []string{"OPENAPI_FILE"},
 		},
+		&cli.BoolFlag{
+			Name: "check-tiles",
+			Usage: "don't start the OGC server, instead run OGC API Tiles conformance smoke tests (tile matrix " +
+				"limits, empty tiles, media types) against the configured tile server and report discrepancies",
+			Value:    false,
+			Required: false,
+			EnvVars:  []string{"CHECK_TILES"},
+		},
 		&cli.BoolFlag{
 			Name:     "allow-trailing-slash",
 			Usage:    "support API calls to URLs with a trailing slash",
@@ -73,23 +100,54 @@ func main() {
 			Required: false,
 			EnvVars:  []string{"ALLOW_TRAILING_SLASH"},
 		},
+		&cli.BoolFlag{
+			Name: "enable-chaos",
+			Usage: "inject faults (latency, errors, truncated responses) into responses according to the chaos " +
+				"rules in the config, for resilience testing of clients. Never enable this in production",
+			Value:    false,
+			Required: false,
+			EnvVars:  []string{"ENABLE_CHAOS"},
+		},
 	}
 
 	app.Action = func(c *cli.Context) error {
 		log.Printf("%s - %s\n", app.Name, app.Usage)
 
 		address := net.JoinHostPort(c.String("host"), strconv.Itoa(c.Int("port")))
+		if unixSocket := c.String("unix-socket"); unixSocket != "" {
+			address = gokoalaEngine.UnixSocketPrefix + unixSocket
+		}
 		debugPort := c.Int("debug-port")
 		shutdownDelay := c.Int("shutdown-delay")
-		configFile := c.String("config-file")
-		openAPIFile := c.String("openapi-file")
-
-		// Engine encapsulates shared non-OGC API specific logic
-		engine := gokoalaEngine.NewEngine(configFile, openAPIFile)
+		reusePort := c.Bool("reuse-port")
+		configFiles := c.StringSlice("config-file")
+		openAPIFiles := c.StringSlice("openapi-file")
+		if len(openAPIFiles) > 0 && len(openAPIFiles) != len(configFiles) {
+			log.Fatalf("number of OpenAPI files (%d) should match number of config files (%d)",
+				len(openAPIFiles), len(configFiles))
+		}
 
-		router := newRouter(engine, c.Bool("allow-trailing-slash"))
+		// Engine encapsulates shared non-OGC API specific logic, one engine per config file
+		engines := make([]*gokoalaEngine.Engine, 0, len(configFiles))
+		for i, configFile := range configFiles {
+			openAPIFile := ""
+			if len(openAPIFiles) > 0 {
+				openAPIFile = openAPIFiles[i]
+			}
+			engine := gokoalaEngine.NewEngine(configFile, openAPIFile)
+			logStartupBanner(engine)
+			engines = append(engines, engine)
+		}
 
-		return engine.Start(address, router, debugPort, shutdownDelay)
+		if c.Bool("check-tiles") {
+			return checkTiles(engines)
+		}
+		if len(engines) == 1 {
+			router := newRouter(engines[0], c.Bool("allow-trailing-slash"), c.Bool("enable-chaos"))
+			return engines[0].Start(address, router, debugPort, shutdownDelay, reusePort)
+		}
+		router := newVersionedRouter(engines, c.Bool("allow-trailing-slash"), c.Bool("enable-chaos"))
+		return engines[0].Start(address, router, debugPort, shutdownDelay, reusePort)
 	}
 
 	err := app.Run(os.Args)
@@ -98,29 +156,38 @@ func main() {
 	}
 }
 
-func newRouter(engine *gokoalaEngine.Engine, allowTrailingSlash bool) *chi.Mux {
+func newRouter(engine *gokoalaEngine.Engine, allowTrailingSlash bool, enableChaos bool) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
 	router.Use(middleware.RealIP)
+	router.Use(engine.Recoverer)         // returns problem+json and reports panics (including the client IP), see RegisterErrorReporter
+	router.Use(engine.CollectStatistics) // usage statistics, see Statistics in config
+	router.Use(engine.LogAccess)         // access log, see AccessLog in config
+	if enableChaos {
+		router.Use(engine.Chaos) // fault injection for resilience testing, see Chaos in config
+	}
 	if allowTrailingSlash {
 		router.Use(middleware.StripSlashes)
 	}
 	// implements https://gitdocumentatie.logius.nl/publicatie/api/adr/#api-57
 	router.Use(middleware.SetHeader("API-Version", engine.Config.Version))
-	router.Use(middleware.Compress(5)) // enable gzip responses
+	router.Use(engine.Deprecation)          // announces deprecated routes, see Deprecations in config
+	router.Use(engine.Formats)              // restricts output formats per route, see Formats in config
+	router.Use(middleware.GetHead)          // HEAD requests are handled by GET routes, without a body
+	router.Use(gokoalaEngine.HandleOptions) // OPTIONS requests list the methods allowed by a route
+	router.Use(middleware.Compress(5))      // enable gzip responses
 
 	// OGC Common Part 1, will always be started
 	core.NewCommonCore(engine, router)
 
+	// OGC 3D GeoVolumes API, before OGC Common part 2 since it derives collection metadata from the tilesets
+	if engine.Config.OgcAPI.GeoVolumes != nil {
+		geovolumes.NewThreeDimensionalGeoVolumes(engine, router)
+	}
 	// OGC Common part 2
 	if engine.Config.HasCollections() {
 		geospatial.NewCollections(engine, router)
 	}
-	// OGC 3D GeoVolumes API
-	if engine.Config.OgcAPI.GeoVolumes != nil {
-		geovolumes.NewThreeDimensionalGeoVolumes(engine, router)
-	}
 	// OGC Tiles API
 	if engine.Config.OgcAPI.Tiles != nil {
 		tiles.NewTiles(engine, router)
@@ -142,10 +209,77 @@ func newRouter(engine *gokoalaEngine.Engine, allowTrailingSlash bool) *chi.Mux {
 	if engine.Config.Resources != nil {
 		gokoalaEngine.NewResourcesEndpoint(engine, router)
 	}
-	// Health endpoint
+	// oEmbed endpoint to embed HTML pages in other websites
+	gokoalaEngine.NewOEmbedEndpoint(engine, router)
+	// Version endpoint to report build info
+	gokoalaEngine.NewVersionEndpoint(engine, router)
+	// Health endpoints (liveness and readiness)
+	gokoalaEngine.NewHealthEndpoint(engine, router)
+	// Usage statistics endpoints (when enabled)
+	gokoalaEngine.NewStatisticsEndpoint(engine, router)
+
+	return router
+}
+
+// newVersionedRouter serves multiple major versions of an API side-by-side, each version
+// (engine) under its own version prefix (e.g. /v1) based on the version in the config
+func newVersionedRouter(engines []*gokoalaEngine.Engine, allowTrailingSlash bool, enableChaos bool) *chi.Mux {
+	router := chi.NewRouter()
+	for _, engine := range engines {
+		prefix := engine.Config.MajorVersionPrefix()
+		if !strings.HasSuffix(engine.Config.BaseURL.Path, prefix) {
+			log.Fatalf("baseUrl %s of API version %s should end with %s when serving multiple versions",
+				engine.Config.BaseURL.String(), engine.Config.Version, prefix)
+		}
+		if router.Match(chi.NewRouteContext(), http.MethodGet, prefix) {
+			log.Fatalf("multiple config files with the same major version %s", prefix)
+		}
+		// strip version prefix, so each engine serves its routes as if it were the only API
+		router.Mount(prefix, http.StripPrefix(prefix, newRouter(engine, allowTrailingSlash, enableChaos)))
+		if engine != engines[0] {
+			// shutdown hooks (e.g. closing datasources) of all versions should run on shutdown
+			engines[0].AttachShutdownHooks(engine)
+			// likewise all versions should be warmed up before reporting ready
+			engines[0].AttachWarmup(engine)
+		}
+	}
 	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		gokoalaEngine.SafeWrite(w.Write, []byte("OK"))
 	})
-
 	return router
 }
+
+// checkTiles runs OGC API Tiles conformance smoke tests against the API of each engine (in-process,
+// without starting a server), fails when discrepancies are found. See tiles.CheckConformance.
+func checkTiles(engines []*gokoalaEngine.Engine) error {
+	var discrepancies int
+	for _, engine := range engines {
+		if engine.Config.OgcAPI.Tiles == nil {
+			log.Printf("OGC API Tiles isn't enabled for '%s' API version %s, skipping tiles check",
+				engine.Config.Title, engine.Config.Version)
+			continue
+		}
+		for _, discrepancy := range tiles.CheckConformance(engine.Config, newRouter(engine, false, false)) {
+			log.Printf("tiles check failed: %s\n", discrepancy)
+			discrepancies++
+		}
+	}
+	if discrepancies > 0 {
+		return cli.Exit(fmt.Sprintf("tiles check found %d discrepancies with the OGC API Tiles spec", discrepancies), 1)
+	}
+	log.Println("tiles check passed, no discrepancies found")
+	return nil
+}
+
+func logStartupBanner(engine *gokoalaEngine.Engine) {
+	info := gokoalaEngine.NewVersionInfo(engine.Config)
+	log.Printf("version %s (commit %s, build date %s, %s)\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+	log.Printf("serving '%s' API version %s on %s with modules %s\n",
+		engine.Config.Title, info.APIVersion, engine.Config.BaseURL.String(), strings.Join(info.Modules, ", "))
+	config, err := engine.Config.Redacted()
+	if err != nil {
+		log.Printf("failed to log configuration: %v\n", err)
+		return
+	}
+	log.Printf("effective configuration (secrets redacted):\n%s", config)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	gokoalaEngine "github.com/PDOK/gokoala/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVersionedRouter(t *testing.T) {
+	engines := []*gokoalaEngine.Engine{
+		newTestEngine(t, "1.0.2", "http://localhost:8080/v1"),
+		newTestEngine(t, "2.1.0", "http://localhost:8080/v2"),
+	}
+	router := newVersionedRouter(engines, false, false)
+
+	tests := []struct {
+		name           string
+		url            string
+		wantStatusCode int
+		wantAPIVersion string
+	}{
+		{
+			name:           "landing page of version 1",
+			url:            "http://localhost:8080/v1/",
+			wantStatusCode: http.StatusOK,
+			wantAPIVersion: "1.0.2",
+		},
+		{
+			name:           "conformance of version 2",
+			url:            "http://localhost:8080/v2/conformance?f=json",
+			wantStatusCode: http.StatusOK,
+			wantAPIVersion: "2.1.0",
+		},
+		{
+			name:           "health of all versions",
+			url:            "http://localhost:8080/health",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "unknown version",
+			url:            "http://localhost:8080/v3/",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "without version prefix",
+			url:            "http://localhost:8080/conformance",
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			assert.Equal(t, tt.wantAPIVersion, rr.Header().Get("API-Version"))
+		})
+	}
+}
+
+func newTestEngine(t *testing.T, version string, baseURL string) *gokoalaEngine.Engine {
+	t.Helper()
+	configFile := path.Join(t.TempDir(), "config.yaml")
+	config := `---
+version: ` + version + `
+title: Versioned OGC API
+abstract: This is a minimal OGC API, offering only OGC API Common
+baseUrl: ` + baseURL + `
+serviceIdentifier: Versioned
+license:
+  name: MIT
+  url: https://www.tldrlegal.com/license/mit-license
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0o600))
+	return gokoalaEngine.NewEngine(configFile, "")
+}
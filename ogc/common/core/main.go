@@ -1,7 +1,10 @@
 package core
 
 import (
+	"encoding/json"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/PDOK/gokoala/engine"
 	"github.com/go-chi/chi/v5"
@@ -13,47 +16,65 @@ const (
 	apiPath            = "/api"
 	alternativeAPIPath = "/openapi.json"
 	conformancePath    = "/conformance"
+	webManifestPath    = "/manifest.webmanifest"
 )
 
 type CommonCore struct {
 	engine *engine.Engine
+
+	webManifest []byte
+
+	// validators of the OpenAPI spec (JSON), to serve conditional requests
+	apiETag         string
+	apiLastModified time.Time
 }
 
-func NewCommonCore(e *engine.Engine, router *chi.Mux) *CommonCore {
-	conformanceBreadcrumbs := []engine.Breadcrumb{
-		{
-			Name: "Conformance",
-			Path: "conformance",
-		},
-	}
-	apiBreadcrumbs := []engine.Breadcrumb{
-		{
-			Name: "OpenAPI specificatie",
-			Path: "api",
-		},
-	}
+// webManifest see https://developer.mozilla.org/en-US/docs/Web/Manifest
+type webManifest struct {
+	Name            string            `json:"name"`
+	ShortName       string            `json:"short_name"`
+	StartURL        string            `json:"start_url"`
+	Display         string            `json:"display"`
+	ThemeColor      string            `json:"theme_color,omitempty"`
+	BackgroundColor string            `json:"background_color,omitempty"`
+	Icons           []webManifestIcon `json:"icons,omitempty"`
+}
+
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type,omitempty"`
+}
+
+func NewCommonCore(e *engine.Engine, router chi.Router) *CommonCore {
+	e.RegisterLocalizedRouteTitle(apiPath, "OpenAPISpecification")
+	e.RegisterLocalizedRouteTitle(conformancePath, "Conformance")
 
 	e.RenderTemplates(rootPath,
 		nil,
 		engine.NewTemplateKey(templatesDir+"landing-page.go.json"),
 		engine.NewTemplateKey(templatesDir+"landing-page.go.html"))
 	e.RenderTemplates(rootPath,
-		apiBreadcrumbs,
+		e.Breadcrumbs(apiPath),
 		engine.NewTemplateKey(templatesDir+"api.go.html"))
 	e.RenderTemplates(conformancePath,
-		conformanceBreadcrumbs,
+		e.Breadcrumbs(conformancePath),
 		engine.NewTemplateKey(templatesDir+"conformance.go.json"),
 		engine.NewTemplateKey(templatesDir+"conformance.go.html"))
 	core := &CommonCore{
-		engine: e,
+		engine:          e,
+		webManifest:     newWebManifest(e.Config),
+		apiETag:         engine.NewETag(e.OpenAPI.SpecJSON),
+		apiLastModified: time.Now(),
 	}
 
 	router.Get(rootPath, core.LandingPage())
 	router.Get(apiPath, core.API())
 	// implements https://gitdocumentatie.logius.nl/publicatie/api/adr/#api-17
-	router.Get(alternativeAPIPath, func(w http.ResponseWriter, r *http.Request) { core.apiAsJSON(w) })
+	router.Get(alternativeAPIPath, func(w http.ResponseWriter, r *http.Request) { core.apiAsJSON(w, r) })
 	router.Get(conformancePath, core.Conformance())
-	router.Handle("/*", http.FileServer(http.Dir("assets")))
+	router.Get(webManifestPath, core.WebManifest())
+	router.Method(http.MethodGet, "/*", http.FileServer(http.Dir("assets")))
 
 	return core
 }
@@ -72,7 +93,7 @@ func (c *CommonCore) API() http.HandlerFunc {
 			c.apiAsHTML(w, r)
 			return
 		} else if format == engine.FormatJSON {
-			c.apiAsJSON(w)
+			c.apiAsJSON(w, r)
 			return
 		}
 		http.NotFound(w, r)
@@ -84,9 +105,9 @@ func (c *CommonCore) apiAsHTML(w http.ResponseWriter, r *http.Request) {
 	c.engine.ServePage(w, r, key)
 }
 
-func (c *CommonCore) apiAsJSON(w http.ResponseWriter) {
+func (c *CommonCore) apiAsJSON(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", engine.MediaTypeOpenAPI)
-	engine.SafeWrite(w.Write, c.engine.OpenAPI.SpecJSON)
+	engine.ServeContent(w, r, c.engine.OpenAPI.SpecJSON, c.apiETag, c.apiLastModified)
 }
 
 func (c *CommonCore) Conformance() http.HandlerFunc {
@@ -95,3 +116,43 @@ func (c *CommonCore) Conformance() http.HandlerFunc {
 		c.engine.ServePage(w, r, key)
 	}
 }
+
+// WebManifest serves the web app manifest, to allow users to install the site as (progressive) web app
+func (c *CommonCore) WebManifest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", engine.MediaTypeWebManifest)
+		engine.SafeWrite(w.Write, c.webManifest)
+	}
+}
+
+func newWebManifest(config *engine.Config) []byte {
+	manifest := webManifest{
+		Name:      config.Title,
+		ShortName: config.ServiceIdentifier,
+		StartURL:  config.BaseURL.String() + "/",
+		Display:   "browser",
+		Icons: []webManifestIcon{
+			{Src: "img/favicon-32x32.png", Sizes: "32x32", Type: "image/png"},
+			{Src: "img/favicon-16x16.png", Sizes: "16x16", Type: "image/png"},
+		},
+	}
+	if config.Branding != nil {
+		manifest.ThemeColor = config.Branding.ThemeColor
+		manifest.BackgroundColor = config.Branding.ThemeColor
+		if len(config.Branding.Icons) > 0 {
+			manifest.Icons = make([]webManifestIcon, 0, len(config.Branding.Icons))
+			for _, icon := range config.Branding.Icons {
+				manifest.Icons = append(manifest.Icons, webManifestIcon{
+					Src:   "resources/" + icon.File,
+					Sizes: icon.Sizes,
+					Type:  icon.Type,
+				})
+			}
+		}
+	}
+	manifestJSON, err := json.Marshal(&manifest)
+	if err != nil {
+		log.Fatalf("failed to marshal web manifest: %v", err)
+	}
+	return manifestJSON
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
@@ -11,6 +13,7 @@ import (
 	"golang.org/x/text/language"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -57,3 +60,201 @@ func TestNewCommonCore(t *testing.T) {
 		})
 	}
 }
+
+func TestCommonCore_ConditionalRequests(t *testing.T) {
+	e := engine.NewEngineWithConfig(&engine.Config{
+		Version:            "2.3.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.Dutch},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/"}},
+	}, "")
+	router := chi.NewRouter()
+	NewCommonCore(e, router)
+
+	tests := []string{"/", "/?f=html", "/api", "/api?f=html", "/conformance", "/conformance?f=html"}
+	for _, requestURL := range tests {
+		t.Run(requestURL, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, requestURL, nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			etag := rr.Header().Get("ETag")
+			lastModified := rr.Header().Get("Last-Modified")
+			assert.NotEmpty(t, etag)
+			assert.NotEmpty(t, lastModified)
+
+			conditionalHeaders := []map[string]string{
+				{"If-None-Match": etag},
+				{"If-Modified-Since": lastModified},
+			}
+			for _, headers := range conditionalHeaders {
+				req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+				for name, value := range headers {
+					req.Header.Set(name, value)
+				}
+				rr = httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, http.StatusNotModified, rr.Code)
+				assert.Empty(t, rr.Body.String())
+			}
+
+			req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+			req.Header.Set("If-None-Match", `"outdated"`)
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.NotEmpty(t, rr.Body.String())
+		})
+	}
+}
+
+func TestCommonCore_HeadAndOptions(t *testing.T) {
+	e := engine.NewEngineWithConfig(&engine.Config{
+		Version:            "2.3.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.Dutch},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/"}},
+	}, "")
+	router := chi.NewRouter()
+	router.Use(middleware.GetHead)
+	router.Use(engine.HandleOptions)
+	NewCommonCore(e, router)
+
+	get := httptest.NewRecorder()
+	router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/conformance", nil))
+	head := httptest.NewRecorder()
+	router.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/conformance", nil))
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, get.Header().Get("Content-Type"), head.Header().Get("Content-Type"))
+	assert.Equal(t, get.Header().Get("ETag"), head.Header().Get("ETag"))
+
+	options := httptest.NewRecorder()
+	router.ServeHTTP(options, httptest.NewRequest(http.MethodOptions, "/conformance", nil))
+	assert.Equal(t, http.StatusNoContent, options.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", options.Header().Get("Allow"))
+}
+
+func TestNewWebManifest(t *testing.T) {
+	favicon := "favicon.ico"
+	tests := []struct {
+		name   string
+		config *engine.Config
+		want   string
+	}{
+		{
+			name: "default manifest",
+			config: &engine.Config{
+				Title:             "Test API",
+				ServiceIdentifier: "Test",
+				BaseURL:           engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/test"}},
+			},
+			want: `{"name":"Test API","short_name":"Test","start_url":"https://api.foobar.example/test/","display":"browser",
+				"icons":[{"src":"img/favicon-32x32.png","sizes":"32x32","type":"image/png"},{"src":"img/favicon-16x16.png","sizes":"16x16","type":"image/png"}]}`,
+		},
+		{
+			name: "manifest with branding",
+			config: &engine.Config{
+				Title:             "Test API",
+				ServiceIdentifier: "Test",
+				BaseURL:           engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/test"}},
+				Branding: &engine.Branding{
+					Favicon:    &favicon,
+					ThemeColor: "#26076b",
+					Icons:      []engine.BrandingIcon{{File: "icon-512.png", Sizes: "512x512", Type: "image/png"}},
+				},
+			},
+			want: `{"name":"Test API","short_name":"Test","start_url":"https://api.foobar.example/test/","display":"browser",
+				"theme_color":"#26076b","background_color":"#26076b","icons":[{"src":"resources/icon-512.png","sizes":"512x512","type":"image/png"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.JSONEq(t, tt.want, string(newWebManifest(tt.config)))
+		})
+	}
+}
+
+func TestCommonCore_ExtraLinks(t *testing.T) {
+	linkType := "text/html"
+	e := engine.NewEngineWithConfig(&engine.Config{
+		Version:            "2.3.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.Dutch, language.English},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/"}},
+		Links: []engine.ExtraLink{
+			{
+				Rel:   "describedby",
+				Title: map[string]string{"nl": "Documentatie", "en": "Documentation"},
+				Href:  "https://docs.foobar.example",
+				Type:  &linkType,
+			},
+			{
+				Rel:   "help",
+				Title: map[string]string{"nl": "Ondersteuning"},
+				Href:  "https://support.foobar.example",
+			},
+		},
+	}, "")
+	router := chi.NewRouter()
+	NewCommonCore(e, router)
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{
+			url:  "/?f=json",
+			want: []string{`"rel": "describedby"`, `"title": "Documentatie"`, `"href": "https://docs.foobar.example"`, `"title": "Ondersteuning"`},
+		},
+		{
+			url:  "/?f=json&lang=en",
+			want: []string{`"title": "Documentation"`, `"title": "Ondersteuning"`},
+		},
+		{
+			url:  "/?f=html",
+			want: []string{`<a href="https://docs.foobar.example" rel="describedby" target="_blank">Documentatie</a>`},
+		},
+		{
+			url:  "/conformance?f=json",
+			want: []string{`"rel": "help"`, `"href": "https://support.foobar.example"`},
+		},
+		{
+			url:  "/conformance?f=html&lang=en",
+			want: []string{`<a href="https://docs.foobar.example" rel="describedby" target="_blank">Documentation</a>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			for _, expected := range tt.want {
+				assert.Contains(t, rr.Body.String(), expected)
+			}
+		})
+	}
+}
+
+func TestCommonCore_ConformanceClasses(t *testing.T) {
+	e := engine.NewEngine("ogc/features/testdata/config_features_basic_cql2.yaml", "")
+	router := chi.NewRouter()
+	NewCommonCore(e, router)
+
+	for _, format := range []string{"json", "html"} {
+		t.Run(format, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/conformance?f="+format, nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			for _, enabled := range []string{engine.ConformanceClassFeaturesCRS, engine.ConformanceClassFeaturesFilter,
+				engine.ConformanceClassCQL2Text, engine.ConformanceClassBasicSpatialFunctions} {
+				assert.Contains(t, rr.Body.String(), `"`+enabled+`"`)
+			}
+			for _, disabled := range []string{engine.ConformanceClassAdvancedComparisonOperators,
+				engine.ConformanceClassSpatialFunctions} {
+				assert.NotContains(t, rr.Body.String(), disabled)
+			}
+		})
+	}
+}
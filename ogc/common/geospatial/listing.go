@@ -0,0 +1,171 @@
+package geospatial
+
+import (
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const (
+	limitParam  = "limit"
+	offsetParam = "offset"
+	searchParam = "q"
+)
+
+// collectionsPage a (filtered) page of collections, as listed on the /collections endpoint
+type collectionsPage struct {
+	Collections []engine.GeoSpatialCollection
+
+	// number of collections matching the q param, across all pages
+	NumberMatched int
+
+	// query params (without format) of this page and of the previous/next page, empty when there's no such page
+	SelfQuery string
+	PrevQuery string
+	NextQuery string
+
+	themes []engine.CollectionTheme
+}
+
+// collectionsSection collections on a page that belong to the given theme, or to no theme at all (nil)
+type collectionsSection struct {
+	Theme       *engine.CollectionTheme
+	Collections []engine.GeoSpatialCollection
+}
+
+// Sections groups the collections on this page by theme (in configured order), collections without a
+// theme come last. A collection is listed in each of its themes. Without themes there's one section.
+func (p *collectionsPage) Sections() []collectionsSection {
+	if len(p.themes) == 0 {
+		return []collectionsSection{{Collections: p.Collections}}
+	}
+	var result []collectionsSection
+	themed := make(map[string]bool)
+	for i := range p.themes {
+		section := collectionsSection{Theme: &p.themes[i]}
+		for _, coll := range p.Collections {
+			if slices.Contains(p.themes[i].Collections, coll.ID) {
+				section.Collections = append(section.Collections, coll)
+				themed[coll.ID] = true
+			}
+		}
+		if len(section.Collections) > 0 {
+			result = append(result, section)
+		}
+	}
+	other := collectionsSection{}
+	for _, coll := range p.Collections {
+		if !themed[coll.ID] {
+			other.Collections = append(other.Collections, coll)
+		}
+	}
+	if len(other.Collections) > 0 || len(result) == 0 {
+		result = append(result, other)
+	}
+	return result
+}
+
+// hasListingParams true when the client requested a specific page and/or filtered the collections,
+// in all other cases the (pre-rendered) default listing is served
+func hasListingParams(params neturl.Values) bool {
+	return params.Has(limitParam) || params.Has(offsetParam) || params.Has(searchParam)
+}
+
+// parseCollectionsPage selects the collections matching the q param and the page given by the limit/offset params
+func parseCollectionsPage(config *engine.Config, params neturl.Values) (*collectionsPage, error) {
+	limit, maxLimit := 0, 0 // unlimited
+	if config.CollectionsListing != nil && config.CollectionsListing.Limit != nil {
+		limit, maxLimit = config.CollectionsListing.Limit.Default, config.CollectionsListing.Limit.Max
+	}
+	var err error
+	if params.Get(limitParam) != "" {
+		if limit, err = strconv.Atoi(params.Get(limitParam)); err != nil || limit < 1 {
+			return nil, fmt.Errorf("limit must be a positive number")
+		}
+		if maxLimit > 0 && limit > maxLimit {
+			limit = maxLimit
+		}
+	}
+	offset := 0
+	if params.Get(offsetParam) != "" {
+		if offset, err = strconv.Atoi(params.Get(offsetParam)); err != nil || offset < 0 {
+			return nil, fmt.Errorf("offset must be zero or a positive number")
+		}
+	}
+	page := newCollectionsPage(config.OrderedCollections(), params.Get(searchParam), limit, offset)
+	if config.CollectionsListing != nil {
+		page.themes = config.CollectionsListing.Themes
+	}
+	return page, nil
+}
+
+// newCollectionsPage returns the page (limit 0 means all) of the given collections that match
+// one or more of the comma-separated search terms, on title/ID or keywords (case-insensitive).
+func newCollectionsPage(all []engine.GeoSpatialCollection, q string, limit int, offset int) *collectionsPage {
+	var terms []string
+	for _, term := range strings.Split(q, ",") {
+		if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	matched := make([]engine.GeoSpatialCollection, 0, len(all))
+	for _, coll := range all {
+		if len(terms) == 0 || matchesAny(coll, terms) {
+			matched = append(matched, coll)
+		}
+	}
+
+	end := len(matched)
+	if limit > 0 {
+		end = min(offset+limit, len(matched))
+	}
+	page := &collectionsPage{NumberMatched: len(matched)}
+	if offset < end {
+		page.Collections = matched[offset:end]
+	}
+
+	query := func(offset int) string {
+		params := neturl.Values{}
+		if q != "" {
+			params.Set(searchParam, q)
+		}
+		if limit > 0 {
+			params.Set(limitParam, strconv.Itoa(limit))
+		}
+		if offset > 0 {
+			params.Set(offsetParam, strconv.Itoa(offset))
+		}
+		return params.Encode()
+	}
+	page.SelfQuery = query(offset)
+	if limit > 0 && offset > 0 {
+		page.PrevQuery = query(max(offset-limit, 0))
+	}
+	if limit > 0 && offset+limit < len(matched) {
+		page.NextQuery = query(offset + limit)
+	}
+	return page
+}
+
+func matchesAny(coll engine.GeoSpatialCollection, terms []string) bool {
+	var candidates []string
+	if coll.Metadata != nil && coll.Metadata.Title != nil {
+		candidates = append(candidates, strings.ToLower(*coll.Metadata.Title))
+	} else {
+		candidates = append(candidates, strings.ToLower(coll.ID))
+	}
+	if coll.Metadata != nil {
+		for _, keyword := range coll.Metadata.Keywords {
+			candidates = append(candidates, strings.ToLower(keyword))
+		}
+	}
+	return slices.ContainsFunc(terms, func(term string) bool {
+		return slices.ContainsFunc(candidates, func(candidate string) bool {
+			return strings.Contains(candidate, term)
+		})
+	})
+}
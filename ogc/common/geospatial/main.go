@@ -1,6 +1,7 @@
 package geospatial
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/PDOK/gokoala/engine"
@@ -13,45 +14,44 @@ const (
 )
 
 type Collections struct {
-	engine *engine.Engine
+	engine      *engine.Engine
+	breadcrumbs []engine.Breadcrumb
 }
 
-func NewCollections(e *engine.Engine, router *chi.Mux) *Collections {
+func NewCollections(e *engine.Engine, router chi.Router) *Collections {
 	if e.Config.HasCollections() {
-		collectionsBreadcrumbs := []engine.Breadcrumb{
-			{
-				Name: "Collections",
-				Path: "collections",
-			},
+		e.RegisterLocalizedRouteTitle(CollectionsPath, "Collections")
+		// the default listing is pre-rendered, other pages and filtered listings are rendered on request
+		defaultPage, err := parseCollectionsPage(e.Config, nil)
+		if err != nil {
+			log.Fatalf("failed to list collections: %v", err)
 		}
-		e.RenderTemplates(CollectionsPath,
-			collectionsBreadcrumbs,
+		e.RenderTemplatesWithParams(defaultPage,
+			e.Breadcrumbs(CollectionsPath),
 			engine.NewTemplateKey(templatesDir+"collections.go.json"),
 			engine.NewTemplateKey(templatesDir+"collections.go.html"))
+		e.ParseTemplate(engine.NewTemplateKey(templatesDir + "collections.go.json"))
+		e.ParseTemplate(engine.NewTemplateKey(templatesDir + "collections.go.html"))
 
 		for _, coll := range e.Config.AllCollections() {
 			title := coll.ID
 			if coll.Metadata != nil && coll.Metadata.Title != nil {
 				title = *coll.Metadata.Title
 			}
-			collectionBreadcrumbs := collectionsBreadcrumbs
-			collectionBreadcrumbs = append(collectionBreadcrumbs, []engine.Breadcrumb{
-				{
-					Name: title,
-					Path: "collections/" + coll.ID,
-				},
-			}...)
+			collectionPath := CollectionsPath + "/" + coll.ID
+			e.RegisterRouteTitle(collectionPath, title)
 			e.RenderTemplatesWithParams(coll,
 				nil,
 				engine.NewTemplateKeyWithName(templatesDir+"collection.go.json", coll.ID))
 			e.RenderTemplatesWithParams(coll,
-				collectionBreadcrumbs,
+				e.Breadcrumbs(collectionPath),
 				engine.NewTemplateKeyWithName(templatesDir+"collection.go.html", coll.ID))
 		}
 	}
 
 	instance := &Collections{
-		engine: e,
+		engine:      e,
+		breadcrumbs: e.Breadcrumbs(CollectionsPath),
 	}
 
 	router.Get(CollectionsPath, instance.Collections())
@@ -60,12 +60,21 @@ func NewCollections(e *engine.Engine, router *chi.Mux) *Collections {
 	return instance
 }
 
-// Collections returns list of collections
+// Collections returns list of collections, optionally filtered (q) and paged (limit/offset)
 func (c *Collections) Collections() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
 		key := engine.NewTemplateKeyWithLanguage(templatesDir+"collections.go."+c.engine.CN.NegotiateFormat(r), c.engine.CN.NegotiateLanguage(w, r))
-		c.engine.ServePage(w, r, key)
-	}
+		if !hasListingParams(r.URL.Query()) {
+			c.engine.ServePage(w, r, key)
+			return nil
+		}
+		page, err := parseCollectionsPage(c.engine.Config, r.URL.Query())
+		if err != nil {
+			return engine.BadRequest(err.Error())
+		}
+		c.engine.RenderAndServePage(w, r, key, page, c.breadcrumbs)
+		return nil
+	})
 }
 
 func (c *Collections) Collection() http.HandlerFunc {
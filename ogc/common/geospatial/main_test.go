@@ -127,6 +127,239 @@ func TestNewCollections_Collections(t *testing.T) {
 	}
 }
 
+func TestNewCollections_CollectionsListing(t *testing.T) {
+	type want struct {
+		bodyContains    []string
+		bodyNotContains []string
+		statusCode      int
+	}
+	tests := []struct {
+		name string
+		url  string
+		want want
+	}{
+		{
+			name: "default page in configured order",
+			url:  "http://localhost:8080/collections?f=json",
+			want: want{
+				bodyContains:    []string{`"id": "baz"`, `"id": "bar"`, `"numberMatched": 3`, `"href": "http://localhost:8080/collections?limit=2&offset=2&f=json"`},
+				bodyNotContains: []string{`"id": "foo"`, `"rel": "prev"`},
+				statusCode:      http.StatusOK,
+			},
+		},
+		{
+			name: "next page",
+			url:  "http://localhost:8080/collections?f=json&limit=2&offset=2",
+			want: want{
+				bodyContains:    []string{`"id": "foo"`, `"numberReturned": 1`, `"href": "http://localhost:8080/collections?limit=2&f=json"`},
+				bodyNotContains: []string{`"id": "bar"`, `"rel": "next"`},
+				statusCode:      http.StatusOK,
+			},
+		},
+		{
+			name: "search on keyword",
+			url:  "http://localhost:8080/collections?f=json&q=building",
+			want: want{
+				bodyContains:    []string{`"id": "bar"`, `"numberMatched": 1`},
+				bodyNotContains: []string{`"id": "foo"`, `"id": "baz"`},
+				statusCode:      http.StatusOK,
+			},
+		},
+		{
+			name: "search in HTML",
+			url:  "http://localhost:8080/collections?f=html&q=foo",
+			want: want{
+				bodyContains:    []string{"Foooo"},
+				bodyNotContains: []string{"Barrr"},
+				statusCode:      http.StatusOK,
+			},
+		},
+		{
+			name: "themes in JSON",
+			url:  "http://localhost:8080/collections?f=json&q=foo",
+			want: want{
+				bodyContains: []string{`"themes": [`, `"id": "addresses"`, `"title": "Addresses"`, `"scheme": "http://localhost:8080/collections"`},
+				statusCode:   http.StatusOK,
+			},
+		},
+		{
+			name: "themes as sections in HTML",
+			url:  "http://localhost:8080/collections?f=html&limit=3",
+			want: want{
+				bodyContains: []string{`<h3 class="pt-3" id="theme-addresses">Addresses</h3>`, "All about addresses", "Overige collecties"},
+				statusCode:   http.StatusOK,
+			},
+		},
+		{
+			name: "supported CRSs overridden by collection",
+			url:  "http://localhost:8080/collections?f=json&q=foo",
+			want: want{
+				bodyContains:    []string{`"http://www.opengis.net/def/crs/OGC/1.3/CRS84"`, `"http://www.opengis.net/def/crs/EPSG/0/3035"`},
+				bodyNotContains: []string{`"http://www.opengis.net/def/crs/EPSG/0/28992"`},
+				statusCode:      http.StatusOK,
+			},
+		},
+		{
+			name: "supported CRSs of features API",
+			url:  "http://localhost:8080/collections?f=json&q=baz",
+			want: want{
+				bodyContains:    []string{`"http://www.opengis.net/def/crs/OGC/1.3/CRS84"`, `"http://www.opengis.net/def/crs/EPSG/0/28992"`},
+				bodyNotContains: []string{`"http://www.opengis.net/def/crs/EPSG/0/3035"`},
+				statusCode:      http.StatusOK,
+			},
+		},
+		{
+			name: "invalid offset",
+			url:  "http://localhost:8080/collections?f=json&offset=-1",
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createCollectionsRequest(tt.url)
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr, ts := createMockServer()
+			defer ts.Close()
+
+			newEngine := engine.NewEngine("ogc/common/geospatial/testdata/config_collections.yaml", "")
+			collections := NewCollections(newEngine, chi.NewRouter())
+			handler := collections.Collections()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.want.statusCode, rr.Code)
+			for _, expected := range tt.want.bodyContains {
+				assert.Contains(t, rr.Body.String(), expected)
+			}
+			for _, unexpected := range tt.want.bodyNotContains {
+				assert.NotContains(t, rr.Body.String(), unexpected)
+			}
+		})
+	}
+}
+
+func Test_newCollectionsPage(t *testing.T) {
+	title := "Addresses"
+	all := []engine.GeoSpatialCollection{
+		{ID: "addresses", Metadata: &engine.GeoSpatialCollectionMetadata{Title: &title}},
+		{ID: "buildings", Metadata: &engine.GeoSpatialCollectionMetadata{Keywords: []string{"BAG"}}},
+		{ID: "roads"},
+	}
+	tests := []struct {
+		name      string
+		q         string
+		limit     int
+		offset    int
+		wantIDs   []string
+		wantPrev  string
+		wantNext  string
+		wantMatch int
+	}{
+		{
+			name:      "all",
+			wantIDs:   []string{"addresses", "buildings", "roads"},
+			wantMatch: 3,
+		},
+		{
+			name:      "first page",
+			limit:     2,
+			wantIDs:   []string{"addresses", "buildings"},
+			wantNext:  "limit=2&offset=2",
+			wantMatch: 3,
+		},
+		{
+			name:      "middle page",
+			limit:     1,
+			offset:    1,
+			wantIDs:   []string{"buildings"},
+			wantPrev:  "limit=1",
+			wantNext:  "limit=1&offset=2",
+			wantMatch: 3,
+		},
+		{
+			name:      "beyond last page",
+			limit:     2,
+			offset:    10,
+			wantPrev:  "limit=2&offset=8",
+			wantMatch: 3,
+		},
+		{
+			name:      "search terms on title and keyword",
+			q:         "bag, ADDRESS",
+			wantIDs:   []string{"addresses", "buildings"},
+			wantMatch: 2,
+		},
+		{
+			name:      "search term on ID without title",
+			q:         "road",
+			limit:     1,
+			wantIDs:   []string{"roads"},
+			wantMatch: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := newCollectionsPage(all, tt.q, tt.limit, tt.offset)
+			var ids []string
+			for _, coll := range page.Collections {
+				ids = append(ids, coll.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+			assert.Equal(t, tt.wantPrev, page.PrevQuery)
+			assert.Equal(t, tt.wantNext, page.NextQuery)
+			assert.Equal(t, tt.wantMatch, page.NumberMatched)
+		})
+	}
+}
+
+func Test_collectionsPage_Sections(t *testing.T) {
+	all := []engine.GeoSpatialCollection{{ID: "addresses"}, {ID: "buildings"}, {ID: "roads"}}
+	themes := []engine.CollectionTheme{
+		{ID: "bag", Title: "BAG", Collections: []string{"addresses", "buildings"}},
+		{ID: "topography", Title: "Topography", Collections: []string{"buildings"}},
+		{ID: "empty", Title: "Empty", Collections: []string{"water"}},
+	}
+	tests := []struct {
+		name   string
+		themes []engine.CollectionTheme
+		want   map[string][]string
+	}{
+		{
+			name: "without themes",
+			want: map[string][]string{"": {"addresses", "buildings", "roads"}},
+		},
+		{
+			name:   "with themes",
+			themes: themes,
+			want: map[string][]string{
+				"bag":        {"addresses", "buildings"},
+				"topography": {"buildings"},
+				"":           {"roads"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := newCollectionsPage(all, "", 0, 0)
+			page.themes = tt.themes
+			got := make(map[string][]string)
+			for _, section := range page.Sections() {
+				themeID := ""
+				if section.Theme != nil {
+					themeID = section.Theme.ID
+				}
+				for _, coll := range section.Collections {
+					got[themeID] = append(got[themeID], coll.ID)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestNewCollections_Collection(t *testing.T) {
 	type fields struct {
 		configFile  string
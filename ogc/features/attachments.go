@@ -0,0 +1,132 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+// attachmentsByCollectionID properties holding large binary content (e.g. photos or documents) per collection,
+// these are served separately instead of as part of the features. See Attachments in config.
+type attachmentsByCollectionID map[string][]engine.FeatureAttachment
+
+// AttachmentAccessHook decides whether the given request is allowed to access an attachment, for example
+// based on a token or the network of the client. Return an error to deny access, its message is sent to the client.
+type AttachmentAccessHook func(r *http.Request, collectionID string, featureID domain.FeatureID, property string) error
+
+func newAttachments(collections engine.GeoSpatialCollections) attachmentsByCollectionID {
+	result := make(attachmentsByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || len(collection.Features.Attachments) == 0 {
+			continue
+		}
+		result[collection.ID] = collection.Features.Attachments
+	}
+	return result
+}
+
+// get returns the attachment config of the given property, false when it isn't an attachment
+func (a attachmentsByCollectionID) get(collectionID string, property string) (engine.FeatureAttachment, bool) {
+	i := slices.IndexFunc(a[collectionID], func(attachment engine.FeatureAttachment) bool {
+		return attachment.Property == property
+	})
+	if i == -1 {
+		return engine.FeatureAttachment{}, false
+	}
+	return a[collectionID][i], true
+}
+
+// link replaces the attachment properties of the given features with a link to the content of the attachment
+func (a attachmentsByCollectionID) link(baseURL neturl.URL, collectionID string, features []*domain.Feature) {
+	attachments, ok := a[collectionID]
+	if !ok {
+		return
+	}
+	for _, feature := range features {
+		for _, attachment := range attachments {
+			if _, present := feature.Properties[attachment.Property]; present {
+				feature.Properties[attachment.Property] = baseURL.JoinPath("collections", collectionID,
+					"items", feature.ID.String(), "attachments", attachment.Property).String()
+			}
+		}
+	}
+}
+
+// RegisterAttachmentAccessHook registers a hook to control access to attachments, see AttachmentAccessHook.
+// Access is only allowed when all registered hooks allow it.
+func (f *Features) RegisterAttachmentAccessHook(hook AttachmentAccessHook) {
+	f.attachmentAccessHooks = append(f.attachmentAccessHooks, hook)
+}
+
+// Attachment serves the (binary) content of an attachment property of a single Feature. Supports
+// conditional requests (using ETags) and range requests, e.g. to resume downloads of large documents.
+func (f *Features) Attachment() http.HandlerFunc {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		collectionID := chi.URLParam(r, "collectionId")
+		property := chi.URLParam(r, "property")
+		featureID, err := f.fidTypes.parse(collectionID, chi.URLParam(r, "featureId"))
+		if err != nil {
+			return engine.BadRequest(err.Error())
+		}
+		attachment, ok := f.attachments.get(collectionID, property)
+		if !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist or doesn't have attachment %s", collectionID, property))
+		}
+		if proceed, err := f.requireTerms(w, r, collectionID); !proceed {
+			return err
+		}
+		for _, hook := range f.attachmentAccessHooks {
+			if err = hook(r, collectionID, featureID, property); err != nil {
+				return engine.Forbidden(err.Error())
+			}
+		}
+
+		content, err := f.datasource.GetAttachment(r.Context(), collectionID, featureID, property)
+		if err != nil {
+			// generic message to client to prevent possible information leakage from datasource
+			return engine.InternalError(fmt.Sprintf("failed to retrieve attachment %s of feature %s in collection %s", property, featureID, collectionID), err)
+		}
+		if content == nil {
+			return engine.NotFound(fmt.Sprintf("no attachment %s found for feature %s in collection %s", property, featureID, collectionID))
+		}
+
+		etag, contentType, err := describeAttachment(content)
+		if err != nil {
+			return engine.InternalError(fmt.Sprintf("failed to read attachment %s of feature %s in collection %s", property, featureID, collectionID), err)
+		}
+		if attachment.ContentType != nil {
+			contentType = *attachment.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		// handles conditional requests (If-None-Match, etc.) and range requests
+		engine.ServeReader(w, r, content, etag, time.Time{})
+		return nil
+	})
+}
+
+// describeAttachment returns the ETag and sniffed content type of the given attachment. Reads the content
+// once (without keeping it in memory) and rewinds it afterward, so it can be served.
+func describeAttachment(content io.ReadSeeker) (etag string, contentType string, err error) {
+	head := make([]byte, 512) // http.DetectContentType considers at most 512 bytes
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", "", err
+	}
+	contentType = http.DetectContentType(head[:n])
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	if etag, err = engine.NewETagFromReader(content); err != nil {
+		return "", "", err
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	return etag, contentType, err
+}
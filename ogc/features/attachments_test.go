@@ -0,0 +1,157 @@
+package features
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+// attachmentDatasource datasource stub, only supports attachments
+type attachmentDatasource struct {
+	datasources.Datasource
+	content []byte
+}
+
+func (ds attachmentDatasource) GetAttachment(_ context.Context, _ string, featureID domain.FeatureID, _ string) (io.ReadSeeker, error) {
+	if featureID != domain.NewFeatureID(1) {
+		return nil, nil
+	}
+	return bytes.NewReader(ds.content), nil
+}
+
+func TestAttachments_Link(t *testing.T) {
+	attachments := newAttachments(engine.GeoSpatialCollections{
+		{ID: "buildings", Features: &engine.CollectionEntryFeatures{
+			Attachments: []engine.FeatureAttachment{{Property: "photo"}, {Property: "floorplan"}},
+		}},
+		{ID: "roads", Features: &engine.CollectionEntryFeatures{}},
+	})
+	baseURL, err := url.Parse("https://api.example.com/v1")
+	assert.NoError(t, err)
+
+	features := []*domain.Feature{
+		{ID: domain.NewFeatureID(1), Feature: geojson.Feature{Properties: map[string]any{"name": "town hall", "photo": int64(1), "floorplan": int64(1)}}},
+		{ID: domain.NewFeatureID(2), Feature: geojson.Feature{Properties: map[string]any{"name": "station", "photo": int64(1)}}},
+	}
+	attachments.link(*baseURL, "buildings", features)
+	assert.Equal(t, map[string]any{
+		"name":      "town hall",
+		"photo":     "https://api.example.com/v1/collections/buildings/items/1/attachments/photo",
+		"floorplan": "https://api.example.com/v1/collections/buildings/items/1/attachments/floorplan",
+	}, features[0].Properties)
+	assert.Equal(t, map[string]any{
+		"name":  "station",
+		"photo": "https://api.example.com/v1/collections/buildings/items/2/attachments/photo",
+	}, features[1].Properties)
+
+	road := &domain.Feature{ID: domain.NewFeatureID(1), Feature: geojson.Feature{Properties: map[string]any{"photo": int64(1)}}}
+	attachments.link(*baseURL, "roads", []*domain.Feature{road})
+	assert.Equal(t, int64(1), road.Properties["photo"])
+}
+
+func TestFeatures_Attachment(t *testing.T) {
+	pdf := []byte("%PDF-1.7 a document with some content")
+	jpeg := "image/jpeg"
+	f := &Features{
+		datasource: attachmentDatasource{content: pdf},
+		attachments: newAttachments(engine.GeoSpatialCollections{
+			{ID: "buildings", Features: &engine.CollectionEntryFeatures{
+				Attachments: []engine.FeatureAttachment{{Property: "floorplan"}, {Property: "photo", ContentType: &jpeg}},
+			}},
+		}),
+	}
+	f.RegisterAttachmentAccessHook(func(r *http.Request, _ string, _ domain.FeatureID, property string) error {
+		if property == "floorplan" && r.Header.Get("Authorization") == "" {
+			return errors.New("floorplans require authorization")
+		}
+		return nil
+	})
+	router := chi.NewRouter()
+	router.Get("/collections/{collectionId}/items/{featureId}/attachments/{property}", f.Attachment())
+	etag := engine.NewETag(pdf)
+
+	tests := []struct {
+		name            string
+		url             string
+		headers         map[string]string
+		wantStatusCode  int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "sniff content type",
+			url:             "/collections/buildings/items/1/attachments/floorplan",
+			headers:         map[string]string{"Authorization": "Bearer foo"},
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "application/pdf",
+			wantBody:        string(pdf),
+		},
+		{
+			name:            "configured content type",
+			url:             "/collections/buildings/items/1/attachments/photo",
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "image/jpeg",
+			wantBody:        string(pdf),
+		},
+		{
+			name:           "range",
+			url:            "/collections/buildings/items/1/attachments/photo",
+			headers:        map[string]string{"Range": "bytes=0-7"},
+			wantStatusCode: http.StatusPartialContent,
+			wantBody:       "%PDF-1.7",
+		},
+		{
+			name:           "not modified",
+			url:            "/collections/buildings/items/1/attachments/photo",
+			headers:        map[string]string{"If-None-Match": etag},
+			wantStatusCode: http.StatusNotModified,
+		},
+		{
+			name:           "access denied",
+			url:            "/collections/buildings/items/1/attachments/floorplan",
+			wantStatusCode: http.StatusForbidden,
+			wantBody:       `{"type":"about:blank","title":"Forbidden","status":403,"detail":"floorplans require authorization"}`,
+		},
+		{
+			name:           "unknown attachment",
+			url:            "/collections/buildings/items/1/attachments/name",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "unknown feature",
+			url:            "/collections/buildings/items/2/attachments/photo",
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantContentType != "" {
+				assert.Equal(t, tt.wantContentType, rr.Header().Get("Content-Type"))
+				assert.Equal(t, etag, rr.Header().Get("ETag"))
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package cql
+
+import "slices"
+
+// Expression a boolean expression of a CQL2 filter, e.g. "a = 1 AND b LIKE 'foo%'"
+type Expression interface {
+	expression()
+}
+
+// Operand a value in a predicate, e.g. a property, literal or geometry
+type Operand interface {
+	operand()
+}
+
+// Logical AND or OR of two or more expressions
+type Logical struct {
+	Op   string // "and" or "or"
+	Args []Expression
+}
+
+// Not negation of an expression
+type Not struct {
+	Arg Expression
+}
+
+// Comparison binary comparison, e.g. "a >= 1"
+type Comparison struct {
+	Op    string // one of =, <>, <, >, <=, >=
+	Left  Operand
+	Right Operand
+}
+
+// Like pattern matching with % (any characters) and _ (single character) wildcards
+type Like struct {
+	Operand Operand
+	Pattern Operand
+	Negated bool
+}
+
+// Between range check (inclusive)
+type Between struct {
+	Operand Operand
+	Low     Operand
+	High    Operand
+	Negated bool
+}
+
+// In check whether a value is in a list of values
+type In struct {
+	Operand Operand
+	List    []Operand
+	Negated bool
+}
+
+// IsNull check whether a value is missing
+type IsNull struct {
+	Operand Operand
+	Negated bool
+}
+
+// Spatial spatial comparison function of two geometries, e.g. "S_INTERSECTS(geometry, POINT(5 52))"
+type Spatial struct {
+	Op    string // lowercase name of the function, e.g. s_intersects
+	Left  Operand
+	Right Operand
+}
+
+// Property reference to a property (queryable) of the features
+type Property struct {
+	Name string
+}
+
+// Literal string, number (int64 or float64), boolean or temporal (as ISO-8601 string) value
+type Literal struct {
+	Value any
+}
+
+// Geometry literal, as WKT (BBOX literals are converted to a WKT polygon)
+type Geometry struct {
+	WKT string
+}
+
+func (Logical) expression()    {}
+func (Not) expression()        {}
+func (Comparison) expression() {}
+func (Like) expression()       {}
+func (Between) expression()    {}
+func (In) expression()         {}
+func (IsNull) expression()     {}
+func (Spatial) expression()    {}
+func (Literal) expression()    {} // TRUE or FALSE
+
+func (Property) operand() {}
+func (Literal) operand()  {}
+func (Geometry) operand() {}
+
+// Properties returns the (unique) names of all properties referenced in the given expression
+func Properties(expr Expression) []string {
+	var result []string
+	add := func(operands ...Operand) {
+		for _, operand := range operands {
+			if p, ok := operand.(Property); ok && !slices.Contains(result, p.Name) {
+				result = append(result, p.Name)
+			}
+		}
+	}
+	var walk func(expr Expression)
+	walk = func(expr Expression) {
+		switch e := expr.(type) {
+		case Logical:
+			for _, arg := range e.Args {
+				walk(arg)
+			}
+		case Not:
+			walk(e.Arg)
+		case Comparison:
+			add(e.Left, e.Right)
+		case Like:
+			add(e.Operand, e.Pattern)
+		case Between:
+			add(e.Operand, e.Low, e.High)
+		case In:
+			add(e.Operand)
+			add(e.List...)
+		case IsNull:
+			add(e.Operand)
+		case Spatial:
+			add(e.Left, e.Right)
+		}
+	}
+	walk(expr)
+	return result
+}
+
+// Operators returns the (unique) advanced comparison operators (like, between, in) and spatial
+// functions (e.g. s_intersects) used in the given expression, in lowercase
+func Operators(expr Expression) []string {
+	var result []string
+	add := func(op string) {
+		if !slices.Contains(result, op) {
+			result = append(result, op)
+		}
+	}
+	var walk func(expr Expression)
+	walk = func(expr Expression) {
+		switch e := expr.(type) {
+		case Logical:
+			for _, arg := range e.Args {
+				walk(arg)
+			}
+		case Not:
+			walk(e.Arg)
+		case Like:
+			add("like")
+		case Between:
+			add("between")
+		case In:
+			add("in")
+		case Spatial:
+			add(e.Op)
+		}
+	}
+	walk(expr)
+	return result
+}
@@ -0,0 +1,468 @@
+package cql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-spatial/geom/encoding/wkt"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdentifier
+	tokenQuotedIdentifier
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+// reserved words of CQL2 which can't be used as (unquoted) property names
+var keywords = []string{"and", "or", "not", "like", "between", "in", "is", "null", "true", "false"}
+
+var spatialFunctions = []string{"s_intersects", "s_equals", "s_disjoint", "s_touches",
+	"s_within", "s_overlaps", "s_crosses", "s_contains"}
+
+var geometryTypes = []string{"point", "linestring", "polygon", "multipoint", "multilinestring",
+	"multipolygon", "geometrycollection"}
+
+type token struct {
+	typ   tokenType
+	value string
+	start int // position in the filter
+	end   int
+}
+
+func (t token) is(keyword string) bool {
+	return t.typ == tokenIdentifier && strings.EqualFold(t.value, keyword)
+}
+
+func (t token) String() string {
+	if t.typ == tokenEOF {
+		return "end of filter"
+	}
+	return fmt.Sprintf("'%s' at position %d", t.value, t.start+1)
+}
+
+// Parse parses a filter in CQL2 text encoding (https://docs.ogc.org/is/21-065r2/21-065r2.html). Supported are
+// basic CQL2 (comparisons, AND/OR/NOT, IS NULL), advanced comparison operators (LIKE, BETWEEN, IN), spatial
+// functions (S_INTERSECTS and friends, with WKT or BBOX geometries) and DATE/TIMESTAMP literals.
+func Parse(filter string) (Expression, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{filter: filter, tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.typ != tokenEOF {
+		return nil, fmt.Errorf("invalid CQL2 filter, unexpected %s", next)
+	}
+	return expr, nil
+}
+
+func tokenize(filter string) ([]token, error) {
+	var tokens []token
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{tokenLeftParen, "(", start, i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRightParen, ")", start, i + 1})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokenComma, ",", start, i + 1})
+			i++
+		case r == '=':
+			tokens = append(tokens, token{tokenOperator, "=", start, i + 1})
+			i++
+		case r == '<' || r == '>':
+			i++
+			if i < len(runes) && (runes[i] == '=' || (r == '<' && runes[i] == '>')) {
+				i++
+			}
+			tokens = append(tokens, token{tokenOperator, string(runes[start:i]), start, i})
+		case r == '\'' || r == '"':
+			value, end, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			typ := tokenString
+			if r == '"' {
+				typ = tokenQuotedIdentifier
+			}
+			tokens = append(tokens, token{typ, value, start, end})
+			i = end
+		case unicode.IsDigit(r) || ((r == '-' || r == '+' || r == '.') && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.')):
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE", runes[i]) ||
+				((runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i]), start, i})
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_.:", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdentifier, string(runes[start:i]), start, i})
+		default:
+			return nil, fmt.Errorf("invalid CQL2 filter, unexpected character '%c' at position %d", r, i+1)
+		}
+	}
+	return append(tokens, token{typ: tokenEOF, start: len(runes), end: len(runes)}), nil
+}
+
+// readQuoted reads a string or identifier between quotes, a quote inside is escaped by doubling it
+func readQuoted(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var value strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			value.WriteRune(runes[i])
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			value.WriteRune(quote)
+			i++
+			continue
+		}
+		return value.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("invalid CQL2 filter, missing closing quote for %c at position %d", quote, start+1)
+}
+
+type parser struct {
+	filter string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType, description string) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, fmt.Errorf("invalid CQL2 filter, expected %s but found %s", description, t)
+	}
+	return t, nil
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if t := p.next(); !t.is(keyword) {
+		return fmt.Errorf("invalid CQL2 filter, expected %s but found %s", strings.ToUpper(keyword), t)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	return p.parseLogical("or", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	return p.parseLogical("and", p.parseNot)
+}
+
+func (p *parser) parseLogical(op string, parseArg func() (Expression, error)) (Expression, error) {
+	arg, err := parseArg()
+	if err != nil {
+		return nil, err
+	}
+	args := []Expression{arg}
+	for p.peek().is(op) {
+		p.next()
+		if arg, err = parseArg(); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return Logical{Op: op, Args: args}, nil
+}
+
+func (p *parser) parseNot() (Expression, error) {
+	if p.peek().is("not") {
+		p.next()
+		arg, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Arg: arg}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expression, error) {
+	t := p.peek()
+	if t.typ == tokenLeftParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenRightParen, "')'"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	if t.typ == tokenIdentifier && isOneOf(t.value, spatialFunctions) {
+		return p.parseSpatial()
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return p.parsePredicate(left)
+}
+
+func (p *parser) parsePredicate(left Operand) (Expression, error) {
+	t := p.peek()
+	if t.typ == tokenOperator {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return Comparison{Op: t.value, Left: left, Right: right}, nil
+	}
+	negated := false
+	if t.is("not") {
+		p.next()
+		negated = true
+		t = p.peek()
+	}
+	switch {
+	case t.is("like"):
+		p.next()
+		pattern, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return Like{Operand: left, Pattern: pattern, Negated: negated}, nil
+	case t.is("between"):
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return Between{Operand: left, Low: low, High: high, Negated: negated}, nil
+	case t.is("in"):
+		p.next()
+		list, err := p.parseOperandList()
+		if err != nil {
+			return nil, err
+		}
+		return In{Operand: left, List: list, Negated: negated}, nil
+	case t.is("is") && !negated:
+		p.next()
+		if p.peek().is("not") {
+			p.next()
+			negated = true
+		}
+		if err := p.expectKeyword("null"); err != nil {
+			return nil, err
+		}
+		return IsNull{Operand: left, Negated: negated}, nil
+	}
+	if literal, ok := left.(Literal); ok && !negated {
+		if _, isBool := literal.Value.(bool); isBool {
+			return literal, nil // TRUE or FALSE
+		}
+	}
+	return nil, fmt.Errorf("invalid CQL2 filter, expected a comparison, LIKE, BETWEEN, IN or IS NULL but found %s", t)
+}
+
+func (p *parser) parseSpatial() (Expression, error) {
+	op := strings.ToLower(p.next().value)
+	if _, err := p.expect(tokenLeftParen, "'('"); err != nil {
+		return nil, err
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokenComma, "','"); err != nil {
+		return nil, err
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokenRightParen, "')'"); err != nil {
+		return nil, err
+	}
+	return Spatial{Op: op, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseOperandList() ([]Operand, error) {
+	if _, err := p.expect(tokenLeftParen, "'('"); err != nil {
+		return nil, err
+	}
+	var list []Operand
+	for {
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, operand)
+		t := p.next()
+		if t.typ == tokenRightParen {
+			return list, nil
+		}
+		if t.typ != tokenComma {
+			return nil, fmt.Errorf("invalid CQL2 filter, expected ',' or ')' but found %s", t)
+		}
+	}
+}
+
+func (p *parser) parseOperand() (Operand, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenString:
+		return Literal{Value: t.value}, nil
+	case tokenNumber:
+		if value, err := strconv.ParseInt(t.value, 10, 64); err == nil {
+			return Literal{Value: value}, nil
+		}
+		value, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CQL2 filter, invalid number %s", t)
+		}
+		return Literal{Value: value}, nil
+	case tokenQuotedIdentifier:
+		return Property{Name: t.value}, nil
+	case tokenIdentifier:
+		switch {
+		case t.is("true"), t.is("false"):
+			return Literal{Value: t.is("true")}, nil
+		case (t.is("date") || t.is("timestamp")) && p.peek().typ == tokenLeftParen:
+			return p.parseTemporal(t)
+		case t.is("bbox") && p.peek().typ == tokenLeftParen:
+			return p.parseBbox()
+		case isOneOf(t.value, geometryTypes):
+			return p.parseGeometry(t)
+		case isOneOf(t.value, keywords):
+			return nil, fmt.Errorf("invalid CQL2 filter, unexpected keyword %s", t)
+		}
+		return Property{Name: t.value}, nil
+	}
+	return nil, fmt.Errorf("invalid CQL2 filter, expected a property or value but found %s", t)
+}
+
+// parseTemporal parses DATE('2023-05-08') or TIMESTAMP('2023-05-08T14:30:05Z'), the value is kept as ISO-8601 string
+func (p *parser) parseTemporal(t token) (Operand, error) {
+	if _, err := p.expect(tokenLeftParen, "'('"); err != nil {
+		return nil, err
+	}
+	value, err := p.expect(tokenString, "a quoted date or timestamp")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokenRightParen, "')'"); err != nil {
+		return nil, err
+	}
+	layout := time.RFC3339
+	if t.is("date") {
+		layout = time.DateOnly
+	}
+	if _, err = time.Parse(layout, value.value); err != nil {
+		return nil, fmt.Errorf("invalid CQL2 filter, invalid %s %s", strings.ToUpper(t.value), value)
+	}
+	return Literal{Value: value.value}, nil
+}
+
+// parseBbox parses BBOX(minx, miny, maxx, maxy) into a polygon
+func (p *parser) parseBbox() (Operand, error) {
+	list, err := p.parseOperandList()
+	if err != nil {
+		return nil, err
+	}
+	coords := make([]string, 0, len(list))
+	for _, operand := range list {
+		literal, ok := operand.(Literal)
+		if !ok {
+			return nil, fmt.Errorf("invalid CQL2 filter, BBOX should contain numbers only")
+		}
+		switch literal.Value.(type) {
+		case int64, float64:
+			coords = append(coords, fmt.Sprint(literal.Value))
+		default:
+			return nil, fmt.Errorf("invalid CQL2 filter, BBOX should contain numbers only")
+		}
+	}
+	if len(coords) != 4 {
+		return nil, fmt.Errorf("invalid CQL2 filter, BBOX should contain exactly 4 values (minx, miny, maxx, maxy)")
+	}
+	minx, miny, maxx, maxy := coords[0], coords[1], coords[2], coords[3]
+	return Geometry{WKT: fmt.Sprintf("POLYGON ((%[1]s %[2]s, %[3]s %[2]s, %[3]s %[4]s, %[1]s %[4]s, %[1]s %[2]s))",
+		minx, miny, maxx, maxy)}, nil
+}
+
+// parseGeometry parses a WKT geometry, e.g. POINT(5 52)
+func (p *parser) parseGeometry(t token) (Operand, error) {
+	if p.peek().typ != tokenLeftParen {
+		return nil, fmt.Errorf("invalid CQL2 filter, expected '(' after %s", t)
+	}
+	depth := 0
+	for {
+		next := p.next()
+		switch next.typ {
+		case tokenLeftParen:
+			depth++
+		case tokenRightParen:
+			depth--
+		case tokenEOF:
+			return nil, fmt.Errorf("invalid CQL2 filter, missing ')' for geometry %s", t)
+		}
+		if depth == 0 {
+			geometryWKT := string([]rune(p.filter)[t.start:next.end])
+			if _, err := wkt.DecodeString(geometryWKT); err != nil {
+				return nil, fmt.Errorf("invalid CQL2 filter, invalid geometry %s: %w", t, err)
+			}
+			return Geometry{WKT: geometryWKT}, nil
+		}
+	}
+}
+
+func isOneOf(value string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if strings.EqualFold(value, candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package cql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    Expression
+		wantErr string
+	}{
+		{
+			name:   "comparison",
+			filter: "straatnaam = 'Silodam'",
+			want:   Comparison{Op: "=", Left: Property{Name: "straatnaam"}, Right: Literal{Value: "Silodam"}},
+		},
+		{
+			name:   "quoted property and escaped quote",
+			filter: `"street name" <> 'Dam''s'`,
+			want:   Comparison{Op: "<>", Left: Property{Name: "street name"}, Right: Literal{Value: "Dam's"}},
+		},
+		{
+			name:   "numbers",
+			filter: "huisnummer >= 10 and oppervlakte < -1.5e2",
+			want: Logical{Op: "and", Args: []Expression{
+				Comparison{Op: ">=", Left: Property{Name: "huisnummer"}, Right: Literal{Value: int64(10)}},
+				Comparison{Op: "<", Left: Property{Name: "oppervlakte"}, Right: Literal{Value: -150.0}},
+			}},
+		},
+		{
+			name:   "and binds stronger than or",
+			filter: "a = 1 OR b = 2 AND NOT c = 3",
+			want: Logical{Op: "or", Args: []Expression{
+				Comparison{Op: "=", Left: Property{Name: "a"}, Right: Literal{Value: int64(1)}},
+				Logical{Op: "and", Args: []Expression{
+					Comparison{Op: "=", Left: Property{Name: "b"}, Right: Literal{Value: int64(2)}},
+					Not{Arg: Comparison{Op: "=", Left: Property{Name: "c"}, Right: Literal{Value: int64(3)}}},
+				}},
+			}},
+		},
+		{
+			name:   "parentheses",
+			filter: "(a = 1 OR b = 2) AND c = 3",
+			want: Logical{Op: "and", Args: []Expression{
+				Logical{Op: "or", Args: []Expression{
+					Comparison{Op: "=", Left: Property{Name: "a"}, Right: Literal{Value: int64(1)}},
+					Comparison{Op: "=", Left: Property{Name: "b"}, Right: Literal{Value: int64(2)}},
+				}},
+				Comparison{Op: "=", Left: Property{Name: "c"}, Right: Literal{Value: int64(3)}},
+			}},
+		},
+		{
+			name:   "advanced comparison operators",
+			filter: "a NOT LIKE 'Silo%' and b between 1 and 10 and c in ('x', 'y') and d is not null and e = true",
+			want: Logical{Op: "and", Args: []Expression{
+				Like{Operand: Property{Name: "a"}, Pattern: Literal{Value: "Silo%"}, Negated: true},
+				Between{Operand: Property{Name: "b"}, Low: Literal{Value: int64(1)}, High: Literal{Value: int64(10)}},
+				In{Operand: Property{Name: "c"}, List: []Operand{Literal{Value: "x"}, Literal{Value: "y"}}},
+				IsNull{Operand: Property{Name: "d"}, Negated: true},
+				Comparison{Op: "=", Left: Property{Name: "e"}, Right: Literal{Value: true}},
+			}},
+		},
+		{
+			name:   "temporal literals",
+			filter: "date > DATE('2023-05-08') and updated <= TIMESTAMP('2023-05-08T14:30:05Z')",
+			want: Logical{Op: "and", Args: []Expression{
+				Comparison{Op: ">", Left: Property{Name: "date"}, Right: Literal{Value: "2023-05-08"}},
+				Comparison{Op: "<=", Left: Property{Name: "updated"}, Right: Literal{Value: "2023-05-08T14:30:05Z"}},
+			}},
+		},
+		{
+			name:   "spatial function with WKT",
+			filter: "S_INTERSECTS(geometry, POLYGON((4 52, 5 52, 5 53, 4 52)))",
+			want:   Spatial{Op: "s_intersects", Left: Property{Name: "geometry"}, Right: Geometry{WKT: "POLYGON((4 52, 5 52, 5 53, 4 52))"}},
+		},
+		{
+			name:   "spatial function with BBOX",
+			filter: "s_within(geometry, BBOX(4.5, 52, 5, 52.5))",
+			want: Spatial{Op: "s_within", Left: Property{Name: "geometry"},
+				Right: Geometry{WKT: "POLYGON ((4.5 52, 5 52, 5 52.5, 4.5 52.5, 4.5 52))"}},
+		},
+		{
+			name:   "boolean literal",
+			filter: "TRUE",
+			want:   Literal{Value: true},
+		},
+		{
+			name:    "missing value",
+			filter:  "a = ",
+			wantErr: "invalid CQL2 filter, expected a property or value but found end of filter",
+		},
+		{
+			name:    "missing quote",
+			filter:  "a = 'foo",
+			wantErr: "invalid CQL2 filter, missing closing quote for ' at position 5",
+		},
+		{
+			name:    "trailing tokens",
+			filter:  "a = 1 b = 2",
+			wantErr: "invalid CQL2 filter, unexpected 'b' at position 7",
+		},
+		{
+			name:    "invalid date",
+			filter:  "a = DATE('08-05-2023')",
+			wantErr: "invalid CQL2 filter, invalid DATE '08-05-2023' at position 10",
+		},
+		{
+			name:    "invalid geometry",
+			filter:  "S_INTERSECTS(geometry, POINT(5))",
+			wantErr: "invalid CQL2 filter, invalid geometry 'POINT' at position 24",
+		},
+		{
+			name:    "property only",
+			filter:  "a",
+			wantErr: "invalid CQL2 filter, expected a comparison, LIKE, BETWEEN, IN or IS NULL but found end of filter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.filter)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProperties(t *testing.T) {
+	expr, err := Parse("a = 1 and (b like 'x%' or not c in (1, 2)) and S_INTERSECTS(geometry, POINT(5 52)) and a < 5")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "geometry"}, Properties(expr))
+}
+
+func TestOperators(t *testing.T) {
+	expr, err := Parse("a = 1 and (b like 'x%' or not c in (1, 2)) and S_WITHIN(geometry, POINT(5 52)) and b like 'y%'")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"like", "in", "s_within"}, Operators(expr))
+}
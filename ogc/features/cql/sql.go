@@ -0,0 +1,152 @@
+package cql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect translates the datasource specific parts of a CQL filter to SQL
+type Dialect interface {
+	// Property returns the SQL (e.g. a quoted column) of the given property, or
+	// an error when the property doesn't exist or can't be used in filters
+	Property(name string) (string, error)
+
+	// GeometryProperty returns the SQL of the given geometry property, or an error
+	// when the property isn't a geometry or spatial filters aren't supported
+	GeometryProperty(name string) (string, error)
+
+	// GeometryLiteral returns the SQL of a geometry given as WKT (in the CRS of the filter) in the given bind param
+	GeometryLiteral(param string) string
+
+	// SpatialFunction returns the SQL of the given spatial function (e.g. s_intersects) of two geometries
+	SpatialFunction(name string, left string, right string) (string, error)
+}
+
+// ToSQL translates the given CQL filter to a SQL predicate in the given dialect. All values
+// are passed as named bind params (:cql0, :cql1, etc.) which are returned alongside the predicate.
+func ToSQL(expr Expression, dialect Dialect) (string, map[string]any, error) {
+	t := &translator{dialect: dialect, args: make(map[string]any)}
+	predicate, err := t.expression(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	return predicate, t.args, nil
+}
+
+type translator struct {
+	dialect Dialect
+	args    map[string]any
+}
+
+func (t *translator) bind(value any) string {
+	param := fmt.Sprintf("cql%d", len(t.args))
+	t.args[param] = value
+	return ":" + param
+}
+
+//nolint:cyclop // one case per type of expression
+func (t *translator) expression(expr Expression) (string, error) {
+	switch e := expr.(type) {
+	case Logical:
+		args := make([]string, 0, len(e.Args))
+		for _, arg := range e.Args {
+			sql, err := t.expression(arg)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, "("+sql+")")
+		}
+		return strings.Join(args, " "+e.Op+" "), nil
+	case Not:
+		sql, err := t.expression(e.Arg)
+		return "not (" + sql + ")", err
+	case Literal:
+		if value, ok := e.Value.(bool); ok {
+			if value {
+				return "1 = 1", nil
+			}
+			return "1 = 0", nil
+		}
+	case Comparison:
+		operands, err := t.operands(e.Left, e.Right)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", operands[0], e.Op, operands[1]), nil
+	case Like:
+		operands, err := t.operands(e.Operand, e.Pattern)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`%s %slike %s escape '\'`, operands[0], not(e.Negated), operands[1]), nil
+	case Between:
+		operands, err := t.operands(e.Operand, e.Low, e.High)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %sbetween %s and %s", operands[0], not(e.Negated), operands[1], operands[2]), nil
+	case In:
+		operands, err := t.operands(append([]Operand{e.Operand}, e.List...)...)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %sin (%s)", operands[0], not(e.Negated), strings.Join(operands[1:], ", ")), nil
+	case IsNull:
+		operands, err := t.operands(e.Operand)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s is %snull", operands[0], not(e.Negated)), nil
+	case Spatial:
+		left, err := t.geometry(e.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := t.geometry(e.Right)
+		if err != nil {
+			return "", err
+		}
+		return t.dialect.SpatialFunction(e.Op, left, right)
+	}
+	return "", fmt.Errorf("unsupported CQL expression %T", expr)
+}
+
+// operands translates (non-spatial) operands
+func (t *translator) operands(operands ...Operand) ([]string, error) {
+	result := make([]string, 0, len(operands))
+	for _, operand := range operands {
+		switch o := operand.(type) {
+		case Property:
+			sql, err := t.dialect.Property(o.Name)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, sql)
+		case Literal:
+			result = append(result, t.bind(o.Value))
+		case Geometry:
+			return nil, fmt.Errorf("geometries can only be used in spatial functions like S_INTERSECTS")
+		default:
+			return nil, fmt.Errorf("unsupported CQL operand %T", operand)
+		}
+	}
+	return result, nil
+}
+
+// geometry translates an operand of a spatial function
+func (t *translator) geometry(operand Operand) (string, error) {
+	switch o := operand.(type) {
+	case Property:
+		return t.dialect.GeometryProperty(o.Name)
+	case Geometry:
+		return t.dialect.GeometryLiteral(t.bind(o.WKT)), nil
+	}
+	return "", fmt.Errorf("spatial functions only accept geometry properties and geometries")
+}
+
+func not(negated bool) string {
+	if negated {
+		return "not "
+	}
+	return ""
+}
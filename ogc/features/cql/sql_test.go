@@ -0,0 +1,104 @@
+package cql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDialect struct{}
+
+func (testDialect) Property(name string) (string, error) {
+	if name == "unknown" {
+		return "", fmt.Errorf("unknown property %s", name)
+	}
+	return `"` + name + `"`, nil
+}
+
+func (testDialect) GeometryProperty(name string) (string, error) {
+	if name != "geometry" {
+		return "", fmt.Errorf("%s isn't a geometry", name)
+	}
+	return "geom", nil
+}
+
+func (testDialect) GeometryLiteral(param string) string {
+	return fmt.Sprintf("geomfromtext(%s)", param)
+}
+
+func (testDialect) SpatialFunction(name string, left string, right string) (string, error) {
+	return fmt.Sprintf("%s(%s, %s)", name, left, right), nil
+}
+
+func TestToSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   string
+		want     string
+		wantArgs map[string]any
+		wantErr  string
+	}{
+		{
+			name:     "comparison",
+			filter:   "a = 'x'",
+			want:     `"a" = :cql0`,
+			wantArgs: map[string]any{"cql0": "x"},
+		},
+		{
+			name:   "logical",
+			filter: "a = 1 or not (b > 2.5 and c <> true)",
+			want:   `("a" = :cql0) or (not (("b" > :cql1) and ("c" <> :cql2)))`,
+			wantArgs: map[string]any{
+				"cql0": int64(1), "cql1": 2.5, "cql2": true,
+			},
+		},
+		{
+			name:     "advanced comparison operators",
+			filter:   "a like 'x%' and b not between 1 and 2 and c not in ('x', 'y') and d is null",
+			want:     `("a" like :cql0 escape '\') and ("b" not between :cql1 and :cql2) and ("c" not in (:cql3, :cql4)) and ("d" is null)`,
+			wantArgs: map[string]any{"cql0": "x%", "cql1": int64(1), "cql2": int64(2), "cql3": "x", "cql4": "y"},
+		},
+		{
+			name:     "spatial",
+			filter:   "s_intersects(geometry, POINT(5 52))",
+			want:     `s_intersects(geom, geomfromtext(:cql0))`,
+			wantArgs: map[string]any{"cql0": "POINT(5 52)"},
+		},
+		{
+			name:     "boolean literal",
+			filter:   "false",
+			want:     "1 = 0",
+			wantArgs: map[string]any{},
+		},
+		{
+			name:    "unknown property",
+			filter:  "unknown = 1",
+			wantErr: "unknown property unknown",
+		},
+		{
+			name:    "geometry in comparison",
+			filter:  "a = POINT(5 52)",
+			wantErr: "geometries can only be used in spatial functions like S_INTERSECTS",
+		},
+		{
+			name:    "no geometry in spatial function",
+			filter:  "s_intersects(a, 'x')",
+			wantErr: "a isn't a geometry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.filter)
+			assert.NoError(t, err)
+			got, args, err := ToSQL(expr, testDialect{})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
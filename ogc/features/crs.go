@@ -0,0 +1,119 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const (
+	crsURIPrefix = "http://www.opengis.net/def/crs/EPSG/0/"
+	crs84URI     = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+
+	// OGC API Features part 2: CRS of the geometries in the response
+	contentCrsHeader = "Content-Crs"
+)
+
+// params holding a CRS URI, besides crs these determine the CRS of the given coordinates
+var crsParams = []string{crsParam, bboxCrsParam, filterCrsParam, nearestCrsParam}
+
+// supportedCrsByCollectionID EPSG codes (besides CRS84) per collection, see SupportedCrs in config.
+// Collections without a configured list accept any EPSG code.
+type supportedCrsByCollectionID map[string][]int
+
+func newSupportedCrs(cfg *engine.OgcAPIFeatures) supportedCrsByCollectionID {
+	result := make(supportedCrsByCollectionID)
+	for _, collection := range cfg.Collections {
+		for _, srs := range cfg.SupportedCrsForCollection(collection.ID) {
+			// format is validated on startup (EPSG:<code>)
+			if code, err := strconv.Atoi(strings.TrimPrefix(srs, "EPSG:")); err == nil {
+				result[collection.ID] = append(result[collection.ID], code)
+			}
+		}
+	}
+	return result
+}
+
+// validate checks whether the CRSs requested by the crs, bbox-crs, filter-crs and nearest-crs params
+// are supported by the given collection. Note the format of these params is validated separately.
+func (s supportedCrsByCollectionID) validate(collectionID string, params neturl.Values) error {
+	supported, ok := s[collectionID]
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, param := range crsParams {
+		if params.Get(param) == "" {
+			continue
+		}
+		code, err := parseCrsToEPSGCode(params.Get(param))
+		if err != nil || code == wgs84SRID || slices.Contains(supported, code) {
+			continue
+		}
+		uris := []string{crs84URI}
+		for _, srid := range supported {
+			uris = append(uris, crsURIPrefix+strconv.Itoa(srid))
+		}
+		errs = append(errs, fmt.Errorf("%s %s isn't supported by collection %s, supported are: %v",
+			param, params.Get(param), collectionID, uris))
+	}
+	return errors.Join(errs...)
+}
+
+// parseCrsToEPSGCode extracts the EPSG code from a CRS URI like http://www.opengis.net/def/crs/EPSG/0/28992,
+// also in its safe CURIE form [EPSG:28992]. OGC CRS84 is treated as EPSG:4326.
+func parseCrsToEPSGCode(crsURI string) (int, error) {
+	if crsURI == crs84URI || crsURI == "[OGC:CRS84]" {
+		return wgs84SRID, nil
+	}
+	var crs string
+	switch {
+	case strings.HasPrefix(crsURI, crsURIPrefix):
+		crs = strings.TrimPrefix(crsURI, crsURIPrefix)
+	case strings.HasPrefix(crsURI, "[EPSG:") && strings.HasSuffix(crsURI, "]"):
+		crs = strings.TrimSuffix(strings.TrimPrefix(crsURI, "[EPSG:"), "]")
+	default:
+		return wgs84SRID, fmt.Errorf("CRS should be an URI like %s28992 or %s, received: %s",
+			crsURIPrefix, crs84URI, crsURI)
+	}
+	code, err := strconv.Atoi(crs)
+	if err != nil || code <= 0 {
+		return wgs84SRID, fmt.Errorf("CRS code should be a positive numeric value, received: %s", crs)
+	}
+	return code, nil
+}
+
+// setContentCrs advertises the CRS of the geometries in the response, as required by OGC API Features part 2
+func (f *Features) setContentCrs(w http.ResponseWriter, crs int) {
+	if !f.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesCRS) {
+		return
+	}
+	w.Header().Set(contentCrsHeader, "<"+crsURI(crs)+">")
+}
+
+// responseCrs EPSG code of the CRS of the geometries in the response: the one requested by the crs param
+// (already validated), otherwise the CRS in which the features of the collection are stored.
+func (f *Features) responseCrs(collectionID string, params neturl.Values) (int, error) {
+	if params.Get(crsParam) != "" {
+		return parseCrsToEPSGCode(params.Get(crsParam))
+	}
+	crs, err := f.datasource.GetStorageCrs(collectionID)
+	if err != nil {
+		return 0, engine.InternalError(fmt.Sprintf("failed to retrieve CRS of collection %s", collectionID), err)
+	}
+	return crs, nil
+}
+
+// crsURI URI of the given CRS (EPSG code), EPSG:4326 is identified as CRS84 (longitude/latitude)
+func crsURI(crs int) string {
+	if crs == wgs84SRID {
+		return crs84URI
+	}
+	return crsURIPrefix + strconv.Itoa(crs)
+}
@@ -0,0 +1,133 @@
+package features
+
+import (
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseCrsToEPSGCode(t *testing.T) {
+	tests := []struct {
+		crs     string
+		want    int
+		wantErr bool
+	}{
+		{crs: "http://www.opengis.net/def/crs/EPSG/0/28992", want: 28992},
+		{crs: "http://www.opengis.net/def/crs/OGC/1.3/CRS84", want: wgs84SRID},
+		{crs: "[EPSG:3035]", want: 3035},
+		{crs: "[OGC:CRS84]", want: wgs84SRID},
+		{crs: "EPSG:28992", wantErr: true},
+		{crs: "http://www.opengis.net/def/crs/EPSG/0/RD", wantErr: true},
+		{crs: "http://example.com/crs/28992", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.crs, func(t *testing.T) {
+			got, err := parseCrsToEPSGCode(tt.crs)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSupportedCrs_validate(t *testing.T) {
+	supportedCrs := newSupportedCrs(&engine.OgcAPIFeatures{
+		SupportedCrs: []string{"EPSG:28992"},
+		Collections: engine.GeoSpatialCollections{
+			{ID: "addresses"},
+			{ID: "buildings", Features: &engine.CollectionEntryFeatures{SupportedCrs: []string{"EPSG:3035"}}},
+		},
+	})
+	tests := []struct {
+		name       string
+		collection string
+		query      string
+		wantErr    string
+	}{
+		{
+			name:       "configured for all collections",
+			collection: "addresses",
+			query:      "crs=http://www.opengis.net/def/crs/EPSG/0/28992&bbox-crs=http://www.opengis.net/def/crs/OGC/1.3/CRS84",
+		},
+		{
+			name:       "overridden by collection",
+			collection: "buildings",
+			query:      "crs=http://www.opengis.net/def/crs/EPSG/0/28992",
+			wantErr:    "crs http://www.opengis.net/def/crs/EPSG/0/28992 isn't supported by collection buildings",
+		},
+		{
+			name:       "unsupported filter-crs",
+			collection: "addresses",
+			query:      "filter-crs=http://www.opengis.net/def/crs/EPSG/0/3857",
+			wantErr:    "filter-crs http://www.opengis.net/def/crs/EPSG/0/3857 isn't supported by collection addresses",
+		},
+		{
+			name:       "unknown collection isn't restricted",
+			collection: "roads",
+			query:      "crs=http://www.opengis.net/def/crs/EPSG/0/3857",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := neturl.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			err = supportedCrs.validate(tt.collection, params)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFeatures_setContentCrs(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		query      string
+		want       string
+	}{
+		{
+			name:       "default to CRS in which the features are stored",
+			configFile: "ogc/features/testdata/config_features.yaml",
+			want:       "<http://www.opengis.net/def/crs/EPSG/0/28992>",
+		},
+		{
+			name:       "requested CRS84",
+			configFile: "ogc/features/testdata/config_features.yaml",
+			query:      "crs=http://www.opengis.net/def/crs/OGC/1.3/CRS84",
+			want:       "<http://www.opengis.net/def/crs/OGC/1.3/CRS84>",
+		},
+		{
+			name:       "requested CRS",
+			configFile: "ogc/features/testdata/config_features.yaml",
+			query:      "crs=[EPSG:28992]",
+			want:       "<http://www.opengis.net/def/crs/EPSG/0/28992>",
+		},
+		{
+			name:       "CRS conformance class disabled",
+			configFile: "ogc/features/testdata/config_features_without_crs.yaml",
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := neturl.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			features := NewFeatures(engine.NewEngine(tt.configFile, ""), chi.NewRouter())
+			crs, err := features.responseCrs("foo", params)
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			features.setContentCrs(rr, crs)
+			assert.Equal(t, tt.want, rr.Header().Get(contentCrsHeader))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package features
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+const (
+	// name of the column holding the feature id in CSV
+	csvIDColumn = "id"
+
+	// prefix of properties named like the id or geometry column
+	csvPropertyPrefix = "properties."
+)
+
+// csvFeatures serves features as CSV (RFC 4180), one row per feature. Nested properties (e.g. expanded
+// relations) are flattened to columns like relation.property, the geometry is in a separate column
+// as WKT or another encoding requested using the geometry-encoding param.
+type csvFeatures struct {
+	geometryColumn string
+}
+
+func newCSVFeatures(e *engine.Engine) *csvFeatures {
+	return &csvFeatures{
+		geometryColumn: e.Config.OgcAPI.Features.CSVGeometryColumn,
+	}
+}
+
+// features serves a page of features as CSV. CSV has no room for links, so the next/prev page is linked
+// using Link headers (RFC 8288). Rows are written as features are returned by next (nil when done), the
+// columns are given upfront since the header precedes the rows. Errors are returned as long as nothing
+// is sent to the client, afterwards the response can only be aborted.
+func (cf *csvFeatures) features(w http.ResponseWriter, collectionID string, cursor domain.Cursors,
+	featuresURL featureCollectionURL, columns []string, next func() (*domain.Feature, error)) error {
+
+	// geometry encoding is validated beforehand, see CollectionContent
+	encoding, _ := domain.ParseGeometryEncoding(featuresURL.params.Get(geometryEncodingParam))
+	featuresURL.setPaginationLinkHeaders(w, collectionID, cursor, engine.FormatCSV, engine.MediaTypeCSV)
+	w.Header().Set("Content-Type", engine.MediaTypeCSV)
+
+	header := make([]string, 0, len(columns)+2)
+	header = append(header, csvIDColumn)
+	for _, column := range columns {
+		header = append(header, cf.csvHeader(column))
+	}
+	header = append(header, cf.geometryColumn)
+
+	writer := newStreamWriter(w)
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(header); err != nil {
+		return writer.fail(fmt.Sprintf("failed to write CSV header of collection %s", collectionID), err)
+	}
+	row := make([]string, len(header))
+	for {
+		feat, err := next()
+		if err != nil {
+			return writer.fail(fmt.Sprintf("failed to retrieve features of collection %s", collectionID), err)
+		}
+		if feat == nil {
+			break
+		}
+		values := make(map[string]string, len(columns))
+		flattenProperties("", feat.Properties, values)
+		geometry, err := domain.EncodeGeometry(feat.Geometry.Geometry, encoding)
+		if err != nil {
+			return writer.fail(fmt.Sprintf("failed to encode geometry of feature %s in collection %s as %s",
+				feat.ID, collectionID, encoding), err)
+		}
+		row[0] = feat.ID.String()
+		for i, column := range columns {
+			row[i+1] = values[column]
+		}
+		row[len(row)-1] = geometry
+		if err = csvWriter.Write(row); err != nil {
+			return writer.fail(fmt.Sprintf("failed to write CSV row of collection %s", collectionID), err)
+		}
+	}
+	csvWriter.Flush()
+	err := csvWriter.Error()
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		log.Printf("failed to write CSV of collection %s: %v", collectionID, err)
+	}
+	return nil
+}
+
+// csvHeader name of the column of the given (flattened) property. Properties named like the id or
+// geometry column are prefixed, otherwise the CSV would have duplicate columns.
+func (cf *csvFeatures) csvHeader(column string) string {
+	if column == csvIDColumn || column == cf.geometryColumn {
+		return csvPropertyPrefix + column
+	}
+	return column
+}
+
+// csvPropertyColumns names of the properties of the collection, for when the columns can't be derived from
+// the features because the features are streamed, see csvColumns. Sorted for stable output.
+func csvPropertyColumns(properties []domain.Property, options datasources.OutputOptions) []string {
+	result := make([]string, 0, len(properties))
+	for _, property := range properties {
+		if len(options.Properties) > 0 && !slices.Contains(options.Properties, property.Name) {
+			continue
+		}
+		result = append(result, property.Name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// csvColumns (flattened) property names of the given features, sorted for stable output
+func csvColumns(features []*domain.Feature) []string {
+	unique := make(map[string]struct{})
+	for _, feat := range features {
+		values := make(map[string]string, len(feat.Properties))
+		flattenProperties("", feat.Properties, values)
+		for column := range values {
+			unique[column] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(unique))
+	for column := range unique {
+		result = append(result, column)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// flattenProperties converts the (nested) properties to text values, nested objects
+// become separate columns prefixed by the name of the parent property
+func flattenProperties(prefix string, properties map[string]any, result map[string]string) {
+	for name, value := range properties {
+		if nested, ok := value.(map[string]any); ok {
+			flattenProperties(prefix+name+".", nested, result)
+			continue
+		}
+		result[prefix+name] = csvValue(value)
+	}
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []any:
+		// e.g. multiple expanded relations, keep as JSON
+		result, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(result)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,189 @@
+package features
+
+import (
+	"encoding/csv"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_CSV(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		wantStatusCode int
+		wantRows       int
+		wantFirstRow   map[string]string
+		wantNextLink   bool
+	}{
+		{
+			name:           "Features as CSV",
+			url:            "http://localhost:8080/collections/:collectionId/items?limit=2",
+			wantStatusCode: http.StatusOK,
+			wantRows:       2,
+			wantFirstRow: map[string]string{
+				"id":         "3542",
+				"straatnaam": "Van Diemenkade",
+				"huisnummer": "14",
+				"geometry":   "POINT (120919.942 489320.199)",
+			},
+			wantNextLink: true,
+		},
+		{
+			name:           "Filtered features as CSV",
+			url:            "http://localhost:8080/collections/:collectionId/items?straatnaam=Realengracht&limit=10",
+			wantStatusCode: http.StatusOK,
+			wantRows:       7,
+			wantFirstRow: map[string]string{
+				"id":         "3837",
+				"straatnaam": "Realengracht",
+			},
+		},
+		{
+			name:           "Features as CSV with geometry as GeoJSON",
+			url:            "http://localhost:8080/collections/:collectionId/items?limit=1&geometry-encoding=geojson",
+			wantStatusCode: http.StatusOK,
+			wantRows:       1,
+			wantFirstRow: map[string]string{
+				"id":       "3542",
+				"geometry": `{"type":"Point","coordinates":[120919.942,489320.199]}`,
+			},
+			wantNextLink: true,
+		},
+		{
+			name:           "Fail on unknown geometry encoding",
+			url:            "http://localhost:8080/collections/:collectionId/items?geometry-encoding=gml",
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest(tt.url, "foo", "", "csv")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, engine.MediaTypeCSV, rr.Header().Get("Content-Type"))
+			if tt.wantNextLink {
+				assert.Contains(t, rr.Header().Get("Link"), `; rel="next"; type="text/csv"`)
+				assert.Contains(t, rr.Header().Get("Link"), "f=csv")
+			} else {
+				assert.Empty(t, rr.Header().Get("Link"))
+			}
+
+			records, err := csv.NewReader(rr.Body).ReadAll()
+			assert.NoError(t, err)
+			assert.Len(t, records, tt.wantRows+1) // incl. header
+			header := records[0]
+			assert.Equal(t, "id", header[0])
+			assert.Equal(t, "geometry", header[len(header)-1])
+			for column, want := range tt.wantFirstRow {
+				i := slices.Index(header, column)
+				assert.GreaterOrEqual(t, i, 0, column)
+				assert.Equal(t, want, records[1][i], column)
+			}
+		})
+	}
+}
+
+func TestFlattenProperties(t *testing.T) {
+	properties := map[string]any{
+		"straatnaam": "Realengracht, \"Amsterdam\"",
+		"huisnummer": int64(9),
+		"leeg":       nil,
+		"datum":      time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		"ligplaats": map[string]any{
+			"id":     int64(4030),
+			"status": "actief",
+		},
+		"panden": []any{map[string]any{"id": int64(1)}, map[string]any{"id": int64(2)}},
+	}
+	result := make(map[string]string)
+	flattenProperties("", properties, result)
+	assert.Equal(t, map[string]string{
+		"straatnaam":       "Realengracht, \"Amsterdam\"",
+		"huisnummer":       "9",
+		"leeg":             "",
+		"datum":            "2023-01-02T03:04:05Z",
+		"ligplaats.id":     "4030",
+		"ligplaats.status": "actief",
+		"panden":           `[{"id":1},{"id":2}]`,
+	}, result)
+}
+
+func TestCSVFeatures_features(t *testing.T) {
+	cf := &csvFeatures{geometryColumn: "geometry"}
+	baseURL, _ := neturl.Parse("http://localhost:8080")
+	featuresURL := featureCollectionURL{*baseURL, neturl.Values{}, nil}
+	features := []*domain.Feature{
+		{ID: domain.NewTextFeatureID("a"), Feature: geojson.Feature{
+			Geometry:   geojson.Geometry{Geometry: geom.Point{1, 2}},
+			Properties: map[string]any{"id": "b", "geometry": "point", "name": "c"},
+		}},
+	}
+
+	t.Run("properties named like id or geometry column", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		err := cf.features(rr, "foo", domain.Cursors{}, featuresURL, csvColumns(features), sliceFeatures(features))
+		require.NoError(t, err)
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"id", "properties.geometry", "properties.id", "name", "geometry"},
+			{"a", "point", "b", "c", "POINT (1 2)"},
+		}, records)
+	})
+
+	t.Run("error before anything is sent", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		err := cf.features(rr, "foo", domain.Cursors{}, featuresURL, nil, func() (*domain.Feature, error) {
+			return nil, errors.New("datasource failed")
+		})
+		var apiErr *engine.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+		assert.Empty(t, rr.Body.Bytes())
+	})
+
+	t.Run("invalid geometry", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		invalid := []*domain.Feature{{ID: domain.NewTextFeatureID("a"), Feature: geojson.Feature{
+			Geometry: geojson.Geometry{Geometry: "not a geometry"},
+		}}}
+		err := cf.features(rr, "foo", domain.Cursors{}, featuresURL, nil, sliceFeatures(invalid))
+		var apiErr *engine.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+		assert.Empty(t, rr.Body.Bytes())
+	})
+}
+
+func TestCSVPropertyColumns(t *testing.T) {
+	properties := []domain.Property{{Name: "straatnaam"}, {Name: "huisnummer"}, {Name: "postcode"}}
+	assert.Equal(t, []string{"huisnummer", "postcode", "straatnaam"},
+		csvPropertyColumns(properties, datasources.OutputOptions{}))
+	assert.Equal(t, []string{"postcode", "straatnaam"},
+		csvPropertyColumns(properties, datasources.OutputOptions{Properties: []string{"straatnaam", "postcode"}}))
+}
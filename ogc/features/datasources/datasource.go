@@ -2,7 +2,9 @@ package datasources
 
 import (
 	"context"
+	"io"
 
+	"github.com/PDOK/gokoala/ogc/features/cql"
 	"github.com/PDOK/gokoala/ogc/features/domain"
 	"github.com/go-spatial/geom"
 )
@@ -13,10 +15,59 @@ type Datasource interface {
 	// GetFeatures returns a FeatureCollection from the underlying datasource and Cursors for pagination
 	GetFeatures(ctx context.Context, collection string, options FeatureOptions) (*domain.FeatureCollection, domain.Cursors, error)
 
+	// GetFeatureCount returns the number of Features matching the given options, pagination options are ignored.
+	// When estimated is true the count of requests without filters may be estimated (e.g. from table statistics),
+	// which is much faster on large tables. The count of requests with filters is always exact.
+	GetFeatureCount(ctx context.Context, collection string, options FeatureOptions, estimated bool) (int, error)
+
+	// GetFeatureHits returns a FeatureCollection without Features, holding only the number of Features matching
+	// the given options (numberMatched) and their extent (bbox). Pagination options are ignored.
+	GetFeatureHits(ctx context.Context, collection string, options FeatureOptions) (*domain.FeatureCollection, error)
+
 	// GetFeature returns a specific Feature from the FeatureCollection of the underlying datasource
-	GetFeature(ctx context.Context, collection string, featureID int64) (*domain.Feature, error)
+	GetFeature(ctx context.Context, collection string, featureID domain.FeatureID, options OutputOptions) (*domain.Feature, error)
+
+	// GetFeaturesByID returns a FeatureCollection with the Features matching the given IDs, in a single
+	// roundtrip to the underlying datasource. IDs that don't exist are silently ignored.
+	GetFeaturesByID(ctx context.Context, collection string, featureIDs []domain.FeatureID, options OutputOptions) (*domain.FeatureCollection, error)
+
+	// GetAttachment returns the (binary) content of the given attachment property of a specific Feature,
+	// see Attachments in config. Returns nil when the Feature doesn't exist or doesn't have this attachment.
+	// The content is read incrementally, since attachments can be large.
+	GetAttachment(ctx context.Context, collection string, featureID domain.FeatureID, property string) (io.ReadSeeker, error)
+
+	// GetProperties returns the properties of the Features in the given collection, in the order of the datasource.
+	// The feature id and geometry aren't included.
+	GetProperties(collection string) ([]domain.Property, error)
+
+	// GetStorageCrs returns the CRS (EPSG code) in which the Features of the given collection are stored.
+	// Features are returned in this CRS when no other CRS is requested, see OutputOptions.
+	GetStorageCrs(collection string) (int, error)
+
+	// Ping verifies connectivity with the datasource, used for readiness checks
+	Ping(ctx context.Context) error
+
+	// Close closes (connections to) the datasource gracefully, within the deadline of the given context
+	Close(ctx context.Context)
+}
 
-	// Close closes (connections to) the datasource gracefully
+// StreamingDatasource is implemented by datasources which can stream Features as they're read (e.g. scanned from
+// the SQL result set), instead of materializing a whole page of Features in memory first
+type StreamingDatasource interface {
+
+	// StreamFeatures performs the equivalent of GetFeatures, but returns the Features as a stream. The Cursors are
+	// derived from the first Feature, which is therefore read beforehand. The stream is nil when no Features match,
+	// otherwise it should always be closed. Offset-based pagination isn't supported, use GetFeatures instead.
+	StreamFeatures(ctx context.Context, collection string, options FeatureOptions) (FeatureStream, domain.Cursors, error)
+}
+
+// FeatureStream a page of Features which are read one by one from the datasource, see StreamingDatasource
+type FeatureStream interface {
+
+	// Next returns the next Feature, nil when all Features are read
+	Next() (*domain.Feature, error)
+
+	// Close releases the resources (e.g. result set) of the stream
 	Close()
 }
 
@@ -25,15 +76,81 @@ type FeatureOptions struct {
 	// pagination
 	Cursor domain.DecodedCursor
 	Limit  int
-
-	// multiple projections support
-	Crs string
+	// offset-based pagination instead of cursor-based pagination when set, number of features to skip
+	Offset *int
 
 	// filtering by bounding box
 	Bbox    *geom.Extent
 	BboxCrs int
 
-	// filtering by CQL
-	Filter    string
-	FilterCrs string
+	// selecting the features nearest to this point (k-nearest neighbors, where k is the limit).
+	// Matching features are ordered by distance, in other words pagination isn't supported.
+	Nearest    *geom.Point
+	NearestCrs int
+
+	// filtering by CQL, geometries in the filter are in the given CRS (EPSG code)
+	Filter    cql.Expression
+	FilterCrs int
+
+	// filtering by property values (equality), multiple values of the same property are OR-ed (IN)
+	PropertyFilters map[string][]string
+
+	// filtering by time (datetime param), on the temporal properties of the collection
+	Temporal *TemporalFilter
+
+	// full-text search, matching features are ordered by relevance. Only the best matches
+	// (up to the limit) are returned, in other words pagination isn't supported.
+	Search string
+	// match the last search term as prefix, useful for autocomplete (type-ahead)
+	SearchPrefix bool
+
+	OutputOptions
+}
+
+// HasFilters whether the options select a subset of the Features (by bbox, nearest, filters, time or search)
+func (o FeatureOptions) HasFilters() bool {
+	return o.Bbox != nil || o.Nearest != nil || o.Filter != nil || len(o.PropertyFilters) > 0 ||
+		o.Temporal != nil || o.Search != ""
+}
+
+// TemporalFilter selects features of which the time intersects the given instant or interval. Start and end are
+// timestamps (ISO-8601, in the time zone of the collection), an empty start or end means the interval is open-ended.
+type TemporalFilter struct {
+	Start string
+	End   string
+
+	// temporal properties of the collection (see Temporal in config), features are instants without an end property
+	StartProperty string
+	EndProperty   string
+}
+
+// OutputOptions to shape the output of the selected Feature(s). Applies to
+// both a single Feature and a set of Features.
+type OutputOptions struct {
+	// multiple projections support, EPSG code of the output CRS. When 0 the
+	// features are returned in the CRS in which they are stored.
+	Crs int
+
+	// only return these properties, return all properties when empty
+	Properties []string
+
+	// don't return geometries at all
+	SkipGeometry bool
+
+	// return the bounding box of each feature instead of the actual geometry, the bounding
+	// box is read from the bbox columns (minx, miny, maxx, maxy) so geometries aren't decoded
+	BboxOnly bool
+
+	// return a point on the surface of each geometry (e.g. for label placement) instead of the actual geometry
+	Centroid bool
+}
+
+// NotSupportedError is returned when the datasource can't handle the given options, e.g. reprojection when
+// the required (spatial) extension isn't available. This is a client error, the request may succeed with other options.
+type NotSupportedError struct {
+	Message string
+}
+
+func (e *NotSupportedError) Error() string {
+	return e.Message
 }
@@ -0,0 +1,120 @@
+package geopackage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/PDOK/gokoala/engine/util"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// max number of bytes of an attachment read per query, see attachmentReader
+const attachmentChunkSize = 1 << 20
+
+func (g *GeoPackage) GetAttachment(ctx context.Context, collection string, featureID domain.FeatureID, property string) (io.ReadSeeker, error) {
+	table, ok := g.featureTableByCollectionID[collection]
+	if !ok {
+		return nil, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
+	}
+	if !slices.Contains(table.Attachments, property) {
+		return nil, fmt.Errorf("property '%s' of collection '%s' isn't an attachment", property, collection)
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
+	defer cancel()
+
+	// cast to blob, otherwise length() and substr() count characters instead of bytes for text columns
+	column := fmt.Sprintf(`cast(f."%s" as blob)`, property)
+	where := fmt.Sprintf(`from %s f where f."%s" = :fid limit 1`, table.from(), g.fidColumn)
+	query := fmt.Sprintf("select length(%s) %s", column, where)
+	db := g.getDB(table)
+	stmt, err := db.PrepareNamedContext(queryCtx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query '%s' error: %w", query, err)
+	}
+	defer stmt.Close()
+
+	var size sql.NullInt64
+	err = stmt.GetContext(queryCtx, &size, map[string]any{"fid": featureID})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !size.Valid) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("query '%s' failed: %w", query, err)
+	}
+	return &attachmentReader{
+		ctx:          ctx,
+		db:           db,
+		query:        fmt.Sprintf("select substr(%s, :offset, :length) %s", column, where),
+		queryTimeout: g.queryTimeout,
+		fid:          featureID,
+		size:         size.Int64,
+		chunkSize:    attachmentChunkSize,
+	}, nil
+}
+
+// attachmentReader reads the content of an attachment incrementally, a chunk at a time, so large
+// attachments (e.g. documents) aren't loaded in memory all at once. Supports seeking, e.g. for range requests.
+type attachmentReader struct {
+	ctx          context.Context
+	db           *sqlx.DB
+	query        string
+	queryTimeout time.Duration
+	fid          domain.FeatureID
+	size         int64
+	chunkSize    int64
+	offset       int64
+}
+
+func (a *attachmentReader) Read(p []byte) (int, error) {
+	if a.offset >= a.size {
+		return 0, io.EOF
+	}
+	length := min(int64(len(p)), a.chunkSize, a.size-a.offset)
+	if length == 0 {
+		return 0, nil
+	}
+
+	queryCtx, cancel := context.WithTimeout(a.ctx, a.queryTimeout)
+	defer cancel()
+
+	var chunk []byte
+	args := map[string]any{"fid": a.fid, "offset": a.offset + 1, "length": length} // substr() is 1-based
+	query, bindArgs, err := sqlx.Named(a.query, args)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bind query '%s' error: %w", a.query, err)
+	}
+	if err = a.db.GetContext(queryCtx, &chunk, query, bindArgs...); err != nil {
+		return 0, fmt.Errorf("query '%s' failed: %w", a.query, err)
+	}
+	if len(chunk) == 0 {
+		// attachment has been changed or removed in the meantime
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, chunk)
+	a.offset += int64(n)
+	return n, nil
+}
+
+func (a *attachmentReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += a.offset
+	case io.SeekEnd:
+		offset += a.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	a.offset = offset
+	return offset, nil
+}
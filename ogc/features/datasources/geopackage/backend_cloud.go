@@ -24,19 +24,28 @@ type cloudGeoPackage struct {
 }
 
 func newCloudBackedGeoPackage(gpkg *engine.GeoPackageCloud) geoPackageBackend {
-	log.Printf("connecting to Cloud-Backed GeoPackage on '%s' in container '%s'\n", gpkg.Connection, gpkg.Container)
-	vfs, err := cloudsqlitevfs.NewVFS(vfsName, gpkg.Connection, gpkg.User, gpkg.Auth, gpkg.Container, getCacheDir(gpkg))
+	connection := gpkg.GetConnection()
+	user, auth := gpkg.GetCredentials()
+	if user == "" || auth == "" {
+		log.Fatalf("no credentials for Cloud-Backed GeoPackage on '%s', configure user and auth or use environment variables", connection)
+	}
+	log.Printf("connecting to Cloud-Backed GeoPackage on '%s' in container '%s'\n", connection, gpkg.Container)
+	vfs, err := cloudsqlitevfs.NewVFS(vfsName, connection, user, auth, gpkg.Container, getCacheDir(gpkg))
 	if err != nil {
 		log.Fatalf("failed to connect with Cloud-Backed GeoPackage: %v", err)
 	}
-	log.Printf("connected to Cloud-Backed GeoPackage: %s\n", gpkg.Connection)
+	log.Printf("connected to Cloud-Backed GeoPackage: %s\n", connection)
 
 	db, err := sqlx.Open(sqliteDriverName, fmt.Sprintf("/%s/%s?vfs=%s", gpkg.Container, gpkg.File, vfsName))
 	if err != nil {
 		log.Fatalf("failed to open Cloud-Backed GeoPackage: %v", err)
 	}
 
-	return &cloudGeoPackage{db, &vfs}
+	cloudGeoPackage := &cloudGeoPackage{db, &vfs}
+	if gpkg.Snapshot != nil {
+		return newSnapshotGeoPackage(cloudGeoPackage, gpkg.Snapshot)
+	}
+	return cloudGeoPackage
 }
 
 func getCacheDir(gpkg *engine.GeoPackageCloud) string {
@@ -1,7 +1,10 @@
 package geopackage
 
 import (
+	"fmt"
 	"log"
+	"net/url"
+	"sync/atomic"
 
 	"github.com/PDOK/gokoala/engine"
 	"github.com/jmoiron/sqlx"
@@ -9,26 +12,51 @@ import (
 
 // GeoPackage on local disk
 type localGeoPackage struct {
-	db *sqlx.DB
+	// multiple connection pools (shards) to avoid contention on a single pool during concurrent queries
+	dbs  []*sqlx.DB
+	next atomic.Uint64
 }
 
 func newLocalGeoPackage(gpkg *engine.GeoPackageLocal) geoPackageBackend {
-	db, err := sqlx.Open(sqliteDriverName, gpkg.File)
-	if err != nil {
-		log.Fatalf("failed to open GeoPackage: %v", err)
+	dsn := localGeoPackageDSN(gpkg)
+	dbs := make([]*sqlx.DB, 0, gpkg.GetConnectionPools())
+	for i := 0; i < gpkg.GetConnectionPools(); i++ {
+		db, err := sqlx.Open(sqliteDriverName, dsn)
+		if err != nil {
+			log.Fatalf("failed to open GeoPackage: %v", err)
+		}
+		dbs = append(dbs, db)
 	}
-	log.Printf("connected to local GeoPackage: %s", gpkg.File)
+	log.Printf("connected to local GeoPackage: %s (using %d connection pools)", gpkg.File, len(dbs))
 
-	return &localGeoPackage{db}
+	return &localGeoPackage{dbs: dbs}
+}
+
+// localGeoPackageDSN opens the GeoPackage read-only (GoKoala never writes) with the configured pragmas,
+// see https://www.sqlite.org/uri.html
+func localGeoPackageDSN(gpkg *engine.GeoPackageLocal) string {
+	params := url.Values{}
+	params.Set("mode", "ro")
+	if gpkg.IsImmutable() {
+		params.Set("immutable", "1")
+	}
+	addPragma(params, "busy_timeout", fmt.Sprint(gpkg.GetBusyTimeout().Milliseconds()))
+	if gpkg.CacheSize != nil {
+		addPragma(params, "cache_size", fmt.Sprint(-*gpkg.CacheSize)) // negative means KiB instead of pages
+	}
+	file := &url.URL{Path: gpkg.File}
+	return "file:" + file.EscapedPath() + "?" + params.Encode()
 }
 
 func (g *localGeoPackage) getDB() *sqlx.DB {
-	return g.db
+	return g.dbs[(g.next.Add(1)-1)%uint64(len(g.dbs))]
 }
 
 func (g *localGeoPackage) close() {
-	err := g.db.Close()
-	if err != nil {
-		log.Printf("failed to close GeoPackage: %v", err)
+	for _, db := range g.dbs {
+		err := db.Close()
+		if err != nil {
+			log.Printf("failed to close GeoPackage: %v", err)
+		}
 	}
 }
@@ -0,0 +1,168 @@
+package geopackage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	snapshotTempDirName = "gokoala-snapshot-"
+
+	// time a snapshot which is swapped out stays open, should exceed the duration of the queries of a request
+	retireGracePeriod = time.Minute
+)
+
+// snapshotGeoPackage serves a full copy (snapshot) of a (cloud-backed) GeoPackage from local disk. The source is
+// periodically checked for changes, after which a new snapshot is made and swapped in. The previous snapshot is
+// retired, so queries on it are allowed to finish.
+type snapshotGeoPackage struct {
+	source geoPackageBackend
+	dir    string
+
+	current     atomic.Pointer[snapshot]
+	retired     retiredSnapshots
+	fingerprint string
+	done        chan struct{}
+}
+
+type snapshot struct {
+	file string
+	db   *localGeoPackage
+}
+
+func newSnapshotGeoPackage(source geoPackageBackend, config *engine.GeoPackageSnapshot) geoPackageBackend {
+	dir := ""
+	if config.Dir != nil {
+		dir = *config.Dir
+	} else {
+		var err error
+		if dir, err = os.MkdirTemp("", snapshotTempDirName); err != nil {
+			log.Fatalf("failed to create tempdir for GeoPackage snapshot: %v", err)
+		}
+	}
+	s := &snapshotGeoPackage{source: source, dir: dir, done: make(chan struct{})}
+	if _, err := s.sync(); err != nil {
+		log.Fatalf("failed to create GeoPackage snapshot: %v", err)
+	}
+	go s.syncPeriodically(config.GetSyncInterval())
+	return s
+}
+
+func (s *snapshotGeoPackage) getDB() *sqlx.DB {
+	return s.current.Load().db.getDB()
+}
+
+func (s *snapshotGeoPackage) close() {
+	close(s.done)
+	s.current.Load().close()
+	s.retired.closeAll()
+	s.source.close()
+}
+
+func (s *snapshotGeoPackage) syncPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if _, err := s.sync(); err != nil {
+				log.Printf("failed to sync GeoPackage snapshot, keep serving previous snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// sync makes a new snapshot when the source has changed since the previous snapshot, returns true when
+// a new snapshot was made. Blocks of a cloud-backed GeoPackage which didn't change come from its local cache.
+func (s *snapshotGeoPackage) sync() (bool, error) {
+	fingerprint, err := readFingerprint(s.source.getDB())
+	if err != nil {
+		return false, err
+	}
+	if fingerprint == s.fingerprint {
+		return false, nil
+	}
+	file := filepath.Join(s.dir, fmt.Sprintf("snapshot-%d.gpkg", time.Now().UnixNano()))
+	if _, err = s.source.getDB().Exec("vacuum into ?", file); err != nil {
+		_ = os.Remove(file)
+		return false, fmt.Errorf("failed to copy GeoPackage to %s: %w", file, err)
+	}
+	next := &snapshot{
+		file: file,
+		db:   newLocalGeoPackage(&engine.GeoPackageLocal{File: file}).(*localGeoPackage),
+	}
+	previous := s.current.Swap(next)
+	s.fingerprint = fingerprint
+	log.Printf("serving GeoPackage from snapshot %s", file)
+	if previous != nil {
+		s.retired.retire(previous, retireGracePeriod)
+	}
+	return true, nil
+}
+
+// readFingerprint identifies the current state of the GeoPackage, based on the last
+// change of each feature table (which GeoPackage producers update on each change)
+func readFingerprint(db *sqlx.DB) (string, error) {
+	var fingerprint string
+	err := db.Get(&fingerprint, `select coalesce(group_concat(table_name || '@' || last_change, ','), '')
+		from (select table_name, last_change from gpkg_contents order by table_name)`)
+	if err != nil {
+		return "", fmt.Errorf("failed to read gpkg_contents: %w", err)
+	}
+	return fingerprint, nil
+}
+
+func (s *snapshot) close() {
+	s.db.close()
+	if err := os.Remove(s.file); err != nil {
+		log.Printf("failed to remove GeoPackage snapshot %s: %v", s.file, err)
+	}
+}
+
+// retiredSnapshots closes snapshots which are swapped out after a grace period. Queries get hold of the current
+// snapshot without keeping a reference to it, so closing a snapshot right away would fail queries which are about
+// to start (with "sql: database is closed"), as well as subsequent queries of the same request.
+type retiredSnapshots struct {
+	mu      sync.Mutex
+	pending map[*snapshot]*time.Timer
+}
+
+// retire closes the given snapshot after the grace period
+func (r *retiredSnapshots) retire(s *snapshot, gracePeriod time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[*snapshot]*time.Timer)
+	}
+	r.pending[s] = time.AfterFunc(gracePeriod, func() {
+		r.mu.Lock()
+		_, ok := r.pending[s]
+		delete(r.pending, s)
+		r.mu.Unlock()
+		if ok {
+			s.close()
+		}
+	})
+}
+
+// closeAll closes the retired snapshots right away, e.g. on shutdown
+func (r *retiredSnapshots) closeAll() {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	for s, timer := range pending {
+		timer.Stop()
+		s.close()
+	}
+}
@@ -0,0 +1,110 @@
+package geopackage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotGeoPackage_sync(t *testing.T) {
+	s, sourceFile, dir := newTestSnapshotGeoPackage(t)
+	first := s.current.Load().file
+	assert.FileExists(t, first)
+
+	var count int
+	assert.NoError(t, s.getDB().Get(&count, "select count(*) from ligplaatsen"))
+	assert.Positive(t, count)
+
+	// unchanged source, keep snapshot
+	synced, err := s.sync()
+	assert.NoError(t, err)
+	assert.False(t, synced)
+	assert.Equal(t, first, s.current.Load().file)
+
+	// changed source, new snapshot replaces previous one
+	changeSource(t, sourceFile, "2030-01-01T00:00:00.000Z")
+	synced, err = s.sync()
+	assert.NoError(t, err)
+	assert.True(t, synced)
+	assert.NotEqual(t, first, s.current.Load().file)
+	assert.FileExists(t, first) // retired, still available to queries in progress
+	assert.NoError(t, s.getDB().Get(&count, "select count(*) from ligplaatsen"))
+	assert.Positive(t, count)
+
+	s.close()
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
+
+func TestSnapshotGeoPackage_syncWhileQuerying(t *testing.T) {
+	s, sourceFile, _ := newTestSnapshotGeoPackage(t)
+	defer s.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				var count int
+				if err := s.getDB().Get(&count, "select count(*) from ligplaatsen"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		changeSource(t, sourceFile, fmt.Sprintf("203%d-01-01T00:00:00.000Z", i))
+		db := s.getDB() // obtained before the sync, used after
+		synced, err := s.sync()
+		require.NoError(t, err)
+		assert.True(t, synced)
+		var count int
+		assert.NoError(t, db.Get(&count, "select count(*) from ligplaatsen"))
+	}
+	cancel()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+// newTestSnapshotGeoPackage makes a snapshot of a writable copy of the test GeoPackage, standing in for a cloud-backed GeoPackage
+func newTestSnapshotGeoPackage(t *testing.T) (s *snapshotGeoPackage, sourceFile string, dir string) {
+	t.Helper()
+	registerDriver()
+	sourceFile = filepath.Join(t.TempDir(), "addresses.gpkg")
+	content, err := os.ReadFile(pwd + "/testdata/addresses.gpkg")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(sourceFile, content, 0o600))
+	immutable := false
+	source := newLocalGeoPackage(&engine.GeoPackageLocal{File: sourceFile, Immutable: &immutable})
+
+	dir = t.TempDir()
+	interval := time.Hour
+	s = newSnapshotGeoPackage(source, &engine.GeoPackageSnapshot{Dir: &dir, SyncInterval: &interval}).(*snapshotGeoPackage)
+	return s, sourceFile, dir
+}
+
+// changeSource marks the feature tables of the source GeoPackage as changed at the given time
+func changeSource(t *testing.T, sourceFile string, lastChange string) {
+	t.Helper()
+	writer, err := sqlx.Open(sqliteDriverName, sourceFile)
+	require.NoError(t, err)
+	_, err = writer.Exec("update gpkg_contents set last_change = ?", lastChange)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+}
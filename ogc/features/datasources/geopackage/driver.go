@@ -0,0 +1,66 @@
+package geopackage
+
+import (
+	"database/sql"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/mattn/go-sqlite3"
+	"github.com/qustavo/sqlhooks/v2"
+)
+
+var (
+	registerOnce     sync.Once
+	spatialiteLoaded bool
+)
+
+// registerDriver registers the sqlite driver and loads sqlite extensions once. Returns
+// whether spatialite is loaded, so spatial SQL functions (st_intersects, st_transform, etc.) are available.
+//
+// Extensions are by default expected in /usr/lib. For spatialite you can
+// alternatively/optionally set SPATIALITE_LIBRARY_PATH.
+//
+// When spatialite can't be loaded we fall back to a driver without extensions, spatial
+// filtering is then performed by a SQL function implemented in Go (see intersects) and reprojection isn't supported.
+func registerDriver() bool {
+	registerOnce.Do(func() {
+		driver := &sqlite3.SQLiteDriver{
+			Extensions: []string{
+				path.Join(os.Getenv("SPATIALITE_LIBRARY_PATH"), "mod_spatialite"),
+			},
+			ConnectHook: registerFunctions,
+		}
+		// extensions are loaded when opening a connection, so try this up front
+		conn, err := driver.Open(":memory:")
+		if err != nil {
+			log.Printf("WARNING: failed to load spatialite, falling back to spatial filtering in Go "+
+				"(without support for reprojection). Error: %v", err)
+			driver = &sqlite3.SQLiteDriver{ConnectHook: registerFunctions}
+		} else {
+			_ = conn.Close()
+			spatialiteLoaded = true
+		}
+		sql.Register(sqliteDriverName, sqlhooks.Wrap(driver, &datasources.SQLLog{}))
+	})
+	return spatialiteLoaded
+}
+
+// registerFunctions registers custom SQL functions on each new connection
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterFunc(lowerFunction, asSQLFunction(lower), true); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc(intersectsFunction, intersects, true); err != nil {
+		return err
+	}
+	return conn.RegisterFunc(foldFunction, asSQLFunction(fold), true)
+}
+
+// add pragma to connection string, see https://github.com/mattn/go-sqlite3#connection-string
+func addPragma(params url.Values, name string, value string) {
+	params.Set("_"+name, value)
+}
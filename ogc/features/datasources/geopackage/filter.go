@@ -0,0 +1,108 @@
+package geopackage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/PDOK/gokoala/ogc/features/cql"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+)
+
+// name of the geometry in CQL filters, besides the name of the actual geometry column
+const filterGeometryProperty = "geometry"
+
+// spatialite functions per CQL spatial function, these return 1 (true), 0 (false) or -1 (error)
+var spatialiteFunctions = map[string]string{
+	"s_intersects": "st_intersects",
+	"s_equals":     "st_equals",
+	"s_disjoint":   "st_disjoint",
+	"s_touches":    "st_touches",
+	"s_within":     "st_within",
+	"s_overlaps":   "st_overlaps",
+	"s_crosses":    "st_crosses",
+	"s_contains":   "st_contains",
+}
+
+// filterDialect translates CQL filters on a feature table to SQLite (with spatialite for spatial functions)
+type filterDialect struct {
+	table      *featureTable
+	spatialite bool
+	filterCrs  int
+}
+
+// Build predicate (prefixed with 'and', like the property filters) of the CQL filter
+// in the given options. Values are passed as named params.
+func (g *GeoPackage) makeFilter(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+	if opt.Filter == nil {
+		return "", map[string]any{}, nil
+	}
+	predicate, args, err := cql.ToSQL(opt.Filter, filterDialect{table: table, spatialite: g.spatialite, filterCrs: opt.FilterCrs})
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf(" and (%s)", predicate), args, nil
+}
+
+func (d filterDialect) Property(name string) (string, error) {
+	if !slices.Contains(d.table.ColumnNames, name) || name == d.table.GeometryColumnName {
+		return "", fmt.Errorf("can't filter on property '%s', it doesn't exist in table '%s'", name, d.table.TableName)
+	}
+	return fmt.Sprintf("f.\"%s\"", name), nil
+}
+
+func (d filterDialect) GeometryProperty(name string) (string, error) {
+	if name != filterGeometryProperty && name != d.table.GeometryColumnName {
+		return "", fmt.Errorf("property '%s' isn't a geometry, spatial functions require '%s'", name, filterGeometryProperty)
+	}
+	if !d.spatialite {
+		return "", &datasources.NotSupportedError{Message: "spatial filters require spatialite, which isn't available"}
+	}
+	return fmt.Sprintf("castautomagic(f.\"%s\")", d.table.GeometryColumnName), nil
+}
+
+func (d filterDialect) GeometryLiteral(param string) string {
+	if d.filterCrs <= 0 || int64(d.filterCrs) == d.table.SRS {
+		return fmt.Sprintf("geomfromtext(%s, %d)", param, d.table.SRS)
+	}
+	return fmt.Sprintf("st_transform(geomfromtext(%s, %d), %d)", param, d.filterCrs, d.table.SRS)
+}
+
+func (d filterDialect) SpatialFunction(name string, left string, right string) (string, error) {
+	function, ok := spatialiteFunctions[name]
+	if !ok {
+		return "", fmt.Errorf("spatial function %s isn't supported", name)
+	}
+	return fmt.Sprintf("%s(%s, %s) = 1", function, left, right), nil
+}
+
+// Build predicate (prefixed with 'and', like the property filters) to select features of which the time intersects
+// the instant or interval of the given temporal filter. Features without an end are still valid. Dates and timestamps
+// are compared using datetime(), which normalizes both (e.g. '2023-05-08' and '2023-05-08T12:00:00Z') to UTC.
+func makeTemporalFilter(table *featureTable, temporal *datasources.TemporalFilter) (string, map[string]any, error) {
+	if temporal == nil {
+		return "", map[string]any{}, nil
+	}
+	for _, property := range []string{temporal.StartProperty, temporal.EndProperty} {
+		if property != "" && !slices.Contains(table.ColumnNames, property) {
+			return "", nil, fmt.Errorf("temporal property '%s' doesn't exist in table '%s'", property, table.TableName)
+		}
+	}
+	var predicates strings.Builder
+	args := make(map[string]any)
+	start := fmt.Sprintf("datetime(f.\"%s\")", temporal.StartProperty)
+	if temporal.End != "" {
+		predicates.WriteString(fmt.Sprintf(" and %s <= datetime(:dtend)", start))
+		args["dtend"] = temporal.End
+	}
+	if temporal.Start != "" {
+		if temporal.EndProperty == "" {
+			predicates.WriteString(fmt.Sprintf(" and %s >= datetime(:dtstart)", start))
+		} else {
+			predicates.WriteString(fmt.Sprintf(" and (f.\"%[1]s\" is null or datetime(f.\"%[1]s\") >= datetime(:dtstart))",
+				temporal.EndProperty))
+		}
+		args["dtstart"] = temporal.Start
+	}
+	return predicates.String(), args, nil
+}
@@ -0,0 +1,113 @@
+package geopackage
+
+import (
+	"testing"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoPackage_makeFilter(t *testing.T) {
+	table := &featureTable{TableName: "ligplaatsen", GeometryColumnName: "geom", SRS: 28992,
+		ColumnNames: []string{"feature_id", "geom", "straatnaam"}}
+	tests := []struct {
+		name       string
+		spatialite bool
+		filter     string
+		filterCrs  int
+		want       string
+		wantErr    string
+	}{
+		{
+			name:   "property",
+			filter: "straatnaam = 'Silodam'",
+			want:   ` and (f."straatnaam" = :cql0)`,
+		},
+		{
+			name:       "spatial in CRS of table",
+			spatialite: true,
+			filter:     "S_WITHIN(geometry, POINT(120000 480000))",
+			filterCrs:  28992,
+			want:       ` and (st_within(castautomagic(f."geom"), geomfromtext(:cql0, 28992)) = 1)`,
+		},
+		{
+			name:       "spatial in other CRS",
+			spatialite: true,
+			filter:     "S_INTERSECTS(geom, BBOX(4.8, 52.3, 4.9, 52.4))",
+			filterCrs:  4326,
+			want:       ` and (st_intersects(castautomagic(f."geom"), st_transform(geomfromtext(:cql0, 4326), 28992)) = 1)`,
+		},
+		{
+			name:    "spatial without spatialite",
+			filter:  "S_INTERSECTS(geometry, POINT(5 52))",
+			wantErr: "spatial filters require spatialite",
+		},
+		{
+			name:    "unknown property",
+			filter:  "huisnummer = 1",
+			wantErr: "can't filter on property 'huisnummer'",
+		},
+		{
+			name:    "geometry in comparison",
+			filter:  "geom = 1",
+			wantErr: "can't filter on property 'geom'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GeoPackage{spatialite: tt.spatialite}
+			got, _, err := g.makeFilter(table, datasources.FeatureOptions{Filter: mustParseFilter(tt.filter), FilterCrs: tt.filterCrs})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMakeTemporalFilter(t *testing.T) {
+	table := &featureTable{TableName: "ligplaatsen", ColumnNames: []string{"feature_id", "geom", "datum_strt", "datum_eind"}}
+	tests := []struct {
+		name     string
+		temporal *datasources.TemporalFilter
+		want     string
+		wantArgs map[string]any
+		wantErr  string
+	}{
+		{
+			name:     "none",
+			wantArgs: map[string]any{},
+		},
+		{
+			name:     "instant features",
+			temporal: &datasources.TemporalFilter{Start: "2023-05-08T00:00:00Z", End: "2023-05-08T23:59:59Z", StartProperty: "datum_strt"},
+			want:     ` and datetime(f."datum_strt") <= datetime(:dtend) and datetime(f."datum_strt") >= datetime(:dtstart)`,
+			wantArgs: map[string]any{"dtstart": "2023-05-08T00:00:00Z", "dtend": "2023-05-08T23:59:59Z"},
+		},
+		{
+			name:     "interval features, open end",
+			temporal: &datasources.TemporalFilter{Start: "2023-05-08T00:00:00Z", StartProperty: "datum_strt", EndProperty: "datum_eind"},
+			want:     ` and (f."datum_eind" is null or datetime(f."datum_eind") >= datetime(:dtstart))`,
+			wantArgs: map[string]any{"dtstart": "2023-05-08T00:00:00Z"},
+		},
+		{
+			name:     "unknown property",
+			temporal: &datasources.TemporalFilter{End: "2023-05-08T00:00:00Z", StartProperty: "datum"},
+			wantErr:  "temporal property 'datum' doesn't exist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, err := makeTemporalFilter(table, tt.temporal)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
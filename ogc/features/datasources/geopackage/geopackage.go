@@ -3,11 +3,12 @@ package geopackage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PDOK/gokoala/engine"
@@ -18,10 +19,6 @@ import (
 	"github.com/go-spatial/geom/encoding/gpkg"
 	"github.com/go-spatial/geom/encoding/wkt"
 	"github.com/jmoiron/sqlx"
-	"github.com/mattn/go-sqlite3"
-	"github.com/qustavo/sqlhooks/v2"
-
-	_ "github.com/mattn/go-sqlite3" // import for side effect (= sqlite3 driver) only
 )
 
 const (
@@ -29,18 +26,8 @@ const (
 	bboxSizeBig      = 10000
 )
 
-// Load sqlite extensions once.
-//
-// Extensions are by default expected in /usr/lib. For spatialite you can
-// alternatively/optionally set SPATIALITE_LIBRARY_PATH.
-func init() {
-	driver := &sqlite3.SQLiteDriver{
-		Extensions: []string{
-			path.Join(os.Getenv("SPATIALITE_LIBRARY_PATH"), "mod_spatialite"),
-		},
-	}
-	sql.Register(sqliteDriverName, sqlhooks.Wrap(driver, &datasources.SQLLog{}))
-}
+// columns in each feature table holding the bbox of the feature, used for bbox filtering and bbox-only output
+var bboxColumns = []string{"minx", "miny", "maxx", "maxy"}
 
 type geoPackageBackend interface {
 	getDB() *sqlx.DB
@@ -60,6 +47,15 @@ type featureTable struct {
 	MaxX               float64   `db:"max_x"` // bbox
 	MaxY               float64   `db:"max_y"` // bbox
 	SRS                int64     `db:"srs_id"`
+
+	ColumnNames   []string
+	PropertyTypes domain.PropertyTypes // type per column, used to coerce values read from the table
+	Attachments   []string             // blob columns which are served separately instead of as part of the features
+	TextMatching  string               // how to compare text in property filters, e.g. case-insensitive
+	SearchIndex   string               // name of the full-text index, empty when search isn't enabled
+	ViewQuery     string               // SQL query of a view, empty for regular feature tables
+	Materialized  *materializedView    // result of the view stored in a separate database, nil when not materialized
+	TextFid       bool                 // whether the feature ids are textual (e.g. UUIDs) instead of integers
 }
 
 type GeoPackage struct {
@@ -68,10 +64,14 @@ type GeoPackage struct {
 	fidColumn                  string
 	featureTableByCollectionID map[string]*featureTable
 	queryTimeout               time.Duration
+	spatialite                 bool // whether spatialite SQL functions are available
+
+	// whether features of a table can be reprojected to a CRS, per table and EPSG code (see assertKnownCrs)
+	knownCrs sync.Map
 }
 
 func NewGeoPackage(collections engine.GeoSpatialCollections, gpkgConfig engine.GeoPackage) *GeoPackage {
-	g := &GeoPackage{}
+	g := &GeoPackage{spatialite: registerDriver()}
 	switch {
 	case gpkgConfig.Local != nil:
 		g.backend = newLocalGeoPackage(gpkgConfig.Local)
@@ -85,7 +85,7 @@ func NewGeoPackage(collections engine.GeoSpatialCollections, gpkgConfig engine.G
 		log.Fatal("unknown geopackage config encountered")
 	}
 
-	metadata, err := readDriverMetadata(g.backend.getDB())
+	metadata, err := readDriverMetadata(g.backend.getDB(), g.spatialite)
 	if err != nil {
 		log.Fatalf("failed to connect with geopackage: %v", err)
 	}
@@ -95,84 +95,164 @@ func NewGeoPackage(collections engine.GeoSpatialCollections, gpkgConfig engine.G
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, table := range featureTables {
+		if err = readFeatureTableColumns(table, g.backend.getDB()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err = readViews(collections, g.backend.getDB(), g.fidColumn, featureTables); err != nil {
+		log.Fatal(err)
+	}
 	g.featureTableByCollectionID = featureTables
+	assertConfiguredColumnsExist(collections, g.featureTableByCollectionID)
+	if g.prepareSearchIndexes(collections, gpkgConfig) {
+		// reopen, so all connections are aware of the newly created indexes
+		g.backend.close()
+		g.backend = newLocalGeoPackage(gpkgConfig.Local)
+	}
 
 	// assert that an index named <table>_spatial_idx exists on each feature table with the given columns
 	g.assertIndexExistOnFeatureTables("_spatial_idx",
 		strings.Join([]string{g.fidColumn, "minx", "maxx", "miny", "maxy"}, ","))
 
+	g.materializeViews(collections)
+
 	return g
 }
 
-func (g *GeoPackage) Close() {
-	g.backend.close()
+func (g *GeoPackage) Ping(ctx context.Context) error {
+	return g.backend.getDB().PingContext(ctx)
+}
+
+func (g *GeoPackage) Close(ctx context.Context) {
+	// closing may take a while (e.g. cleanup of cloud-backed cache), don't exceed the shutdown timeout
+	done := make(chan struct{})
+	go func() {
+		for _, table := range g.featureTableByCollectionID {
+			if table.Materialized != nil {
+				table.Materialized.close()
+			}
+		}
+		g.backend.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("failed to close GeoPackage in time: %v", ctx.Err())
+	}
 }
 
 func (g *GeoPackage) GetFeatures(ctx context.Context, collection string, options datasources.FeatureOptions) (*domain.FeatureCollection, domain.Cursors, error) {
+	query, err := g.queryFeatures(ctx, collection, options)
+	if err != nil {
+		return nil, domain.Cursors{}, err
+	}
+	defer query.close()
+
+	var nextPrev *domain.PrevNextFID
+	result := domain.FeatureCollection{}
+	result.Features, nextPrev, err = domain.MapRowsToFeatures(query.rows, g.fidColumn, query.table.GeometryColumnName,
+		query.table.PropertyTypes, options.Properties, readGpkgGeometry)
+	if err != nil {
+		return nil, domain.Cursors{}, err
+	}
+	if nextPrev == nil {
+		return nil, domain.Cursors{}, nil
+	}
+	var hasNext bool
+	if options.Offset != nil {
+		result.Features, hasNext = trimOffsetPage(result.Features, options.Limit)
+	}
+
+	result.NumberReturned = len(result.Features)
+	if options.Offset != nil {
+		return &result, domain.NewOffsetCursors(*options.Offset, options.Limit, hasNext), nil
+	}
+	return &result, domain.NewCursors(*nextPrev, options.Cursor.FiltersChecksum), nil
+}
+
+// featuresQuery result set of the features query, close releases the result set, statement and query context
+type featuresQuery struct {
+	table *featureTable
+	rows  *sqlx.Rows
+	close func()
+}
+
+func (g *GeoPackage) queryFeatures(ctx context.Context, collection string, options datasources.FeatureOptions) (*featuresQuery, error) {
 	table, ok := g.featureTableByCollectionID[collection]
 	if !ok {
-		return nil, domain.Cursors{}, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+		return nil, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
 			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
 	}
 
+	if err := g.assertSupported(ctx, table, options.OutputOptions); err != nil {
+		return nil, err
+	}
 	queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
-	defer cancel()
-
-	query, queryArgs, err := g.makeFeaturesQuery(table, options)
+	options, err := g.toTableBbox(queryCtx, table, options)
 	if err != nil {
-		return nil, domain.Cursors{}, fmt.Errorf("failed to make features query, error: %w", err)
+		cancel()
+		return nil, err
 	}
-
-	stmt, err := g.backend.getDB().PrepareNamedContext(queryCtx, query)
+	query, queryArgs, err := g.makeFeaturesQuery(queryCtx, table, options)
 	if err != nil {
-		return nil, domain.Cursors{}, fmt.Errorf("failed to prepare query '%s' error: %w", query, err)
+		cancel()
+		return nil, fmt.Errorf("failed to make features query, error: %w", err)
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.QueryxContext(queryCtx, queryArgs)
+	stmt, err := g.getDB(table).PrepareNamedContext(queryCtx, query)
 	if err != nil {
-		return nil, domain.Cursors{}, fmt.Errorf("failed to execute query '%s' error: %w", query, err)
+		cancel()
+		return nil, fmt.Errorf("failed to prepare query '%s' error: %w", query, err)
 	}
-	defer rows.Close()
 
-	var nextPrev *domain.PrevNextFID
-	result := domain.FeatureCollection{}
-	result.Features, nextPrev, err = domain.MapRowsToFeatures(rows, g.fidColumn, table.GeometryColumnName, readGpkgGeometry)
+	rows, err := stmt.QueryxContext(queryCtx, queryArgs)
 	if err != nil {
-		return nil, domain.Cursors{}, err
-	}
-	if nextPrev == nil {
-		return nil, domain.Cursors{}, nil
+		stmt.Close()
+		cancel()
+		return nil, fmt.Errorf("failed to execute query '%s' error: %w", query, err)
 	}
-
-	result.NumberReturned = len(result.Features)
-	return &result, domain.NewCursors(*nextPrev, options.Cursor.FiltersChecksum), nil
+	return &featuresQuery{
+		table: table,
+		rows:  rows,
+		close: func() {
+			rows.Close()
+			stmt.Close()
+			cancel()
+		},
+	}, nil
 }
 
-func (g *GeoPackage) GetFeature(ctx context.Context, collection string, featureID int64) (*domain.Feature, error) {
+func (g *GeoPackage) GetFeature(ctx context.Context, collection string, featureID domain.FeatureID, options datasources.OutputOptions) (*domain.Feature, error) {
 	table, ok := g.featureTableByCollectionID[collection]
 	if !ok {
 		return nil, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
 			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
 	}
 
+	if err := g.assertSupported(ctx, table, options); err != nil {
+		return nil, err
+	}
+
 	queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
 	defer cancel()
 
-	query := fmt.Sprintf("select * from %s f where f.%s = :fid limit 1", table.TableName, g.fidColumn)
-	stmt, err := g.backend.getDB().PrepareNamedContext(queryCtx, query)
+	query := fmt.Sprintf("select %s from %s f where f.%s = :fid limit 1",
+		g.selectColumns(table, options), table.from(), g.fidColumn)
+	stmt, err := g.getDB(table).PrepareNamedContext(queryCtx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.QueryxContext(queryCtx, map[string]any{"fid": featureID})
+	rows, err := stmt.QueryxContext(queryCtx, map[string]any{"fid": featureID, "crs": options.Crs})
 	if err != nil {
 		return nil, fmt.Errorf("query '%s' failed: %w", query, err)
 	}
 	defer rows.Close()
 
-	features, _, err := domain.MapRowsToFeatures(rows, g.fidColumn, table.GeometryColumnName, readGpkgGeometry)
+	features, _, err := domain.MapRowsToFeatures(rows, g.fidColumn, table.GeometryColumnName, table.PropertyTypes, options.Properties, readGpkgGeometry)
 	if err != nil {
 		return nil, err
 	}
@@ -182,35 +262,211 @@ func (g *GeoPackage) GetFeature(ctx context.Context, collection string, featureI
 	return features[0], nil
 }
 
+func (g *GeoPackage) GetFeaturesByID(ctx context.Context, collection string, featureIDs []domain.FeatureID, options datasources.OutputOptions) (*domain.FeatureCollection, error) {
+	table, ok := g.featureTableByCollectionID[collection]
+	if !ok {
+		return nil, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
+	}
+	if len(featureIDs) == 0 {
+		return &domain.FeatureCollection{Features: make([]*domain.Feature, 0)}, nil
+	}
+	if err := g.assertSupported(ctx, table, options); err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
+	defer cancel()
+
+	// single IN-query, sqlx expands the slice of ids to the correct number of bind variables
+	namedQuery := fmt.Sprintf("select %s from %s f where f.%[3]s in (:fids) order by f.%[3]s",
+		g.selectColumns(table, options), table.from(), g.fidColumn)
+	query, queryArgs, err := sqlx.Named(namedQuery, map[string]any{"fids": featureIDs, "crs": options.Crs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to make features by id query, error: %w", err)
+	}
+	query, queryArgs, err = sqlx.In(query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand ids in query '%s', error: %w", query, err)
+	}
+	db := g.getDB(table)
+	rows, err := db.QueryxContext(queryCtx, db.Rebind(query), queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("query '%s' failed: %w", query, err)
+	}
+	defer rows.Close()
+
+	result := domain.FeatureCollection{}
+	result.Features, _, err = domain.MapRowsToFeatures(rows, g.fidColumn, table.GeometryColumnName, table.PropertyTypes, options.Properties, readGpkgGeometry)
+	if err != nil {
+		return nil, err
+	}
+	result.NumberReturned = len(result.Features)
+	return &result, nil
+}
+
+func (g *GeoPackage) GetProperties(collection string) ([]domain.Property, error) {
+	table, ok := g.featureTableByCollectionID[collection]
+	if !ok {
+		return nil, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
+	}
+	result := make([]domain.Property, 0, len(table.ColumnNames))
+	for _, column := range table.ColumnNames {
+		// skip columns which aren't mapped to properties of features, see MapRowsToFeatures
+		if column == g.fidColumn || column == table.GeometryColumnName || slices.Contains(bboxColumns, column) ||
+			column == "min_zoom" || column == "max_zoom" {
+			continue
+		}
+		result = append(result, domain.Property{Name: column, Type: table.PropertyTypes[column]})
+	}
+	return result, nil
+}
+
+func (g *GeoPackage) GetStorageCrs(collection string) (int, error) {
+	table, ok := g.featureTableByCollectionID[collection]
+	if !ok {
+		return 0, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
+	}
+	return int(table.SRS), nil
+}
+
 // Build specific features queries based on the given options.
 // Make sure to use SQL bind variables and return named params: https://jmoiron.github.io/sqlx/#namedParams
-func (g *GeoPackage) makeFeaturesQuery(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
-	if opt.Bbox != nil {
-		return g.makeBboxQuery(table, opt)
+func (g *GeoPackage) makeFeaturesQuery(ctx context.Context, table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+	if opt.Offset != nil {
+		return g.makeOffsetQuery(table, opt)
+	}
+	propertyFilters, propertyFilterArgs, err := g.makeFilters(table, opt)
+	if err != nil {
+		return "", nil, err
+	}
+	if table.isView() && (opt.Nearest != nil || opt.Search != "") {
+		return "", nil, fmt.Errorf("nearest and full-text search aren't supported on views")
+	}
+	var query string
+	var args map[string]any
+	switch {
+	case opt.Bbox != nil && table.isView():
+		bboxFilter, bboxFilterArgs, bboxErr := g.makeViewBboxFilter(table, opt)
+		if bboxErr != nil {
+			return "", nil, bboxErr
+		}
+		propertyFilters += bboxFilter
+		for name, value := range bboxFilterArgs {
+			propertyFilterArgs[name] = value
+		}
+		query, args, err = g.makeDefaultQuery(table, opt, propertyFilters)
+	case opt.Nearest != nil:
+		query, args, err = g.makeNearestQuery(ctx, table, opt, propertyFilters, propertyFilterArgs)
+	case opt.Search != "":
+		query, args, err = g.makeSearchQuery(table, opt, propertyFilters)
+	case opt.Bbox != nil:
+		query, args, err = g.makeBboxQuery(table, opt, propertyFilters)
+	default:
+		query, args, err = g.makeDefaultQuery(table, opt, propertyFilters)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	for name, value := range propertyFilterArgs {
+		args[name] = value
+	}
+	return query, args, nil
+}
+
+// Build the predicates (each prefixed with 'and') of the property, CQL and temporal filters in the given options.
+// These are applied alongside each other, values are passed as named params.
+func (g *GeoPackage) makeFilters(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+	propertyFilters, args, err := makePropertyFilters(table, opt.PropertyFilters)
+	if err != nil {
+		return "", nil, err
+	}
+	filter, filterArgs, err := g.makeFilter(table, opt)
+	if err != nil {
+		return "", nil, err
+	}
+	temporalFilter, temporalFilterArgs, err := makeTemporalFilter(table, opt.Temporal)
+	if err != nil {
+		return "", nil, err
+	}
+	for name, value := range filterArgs {
+		args[name] = value
 	}
-	return g.makeDefaultQuery(table, opt)
+	for name, value := range temporalFilterArgs {
+		args[name] = value
+	}
+	return propertyFilters + filter + temporalFilter, args, nil
 }
 
-func (g *GeoPackage) makeDefaultQuery(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+// Build predicates to filter on property values: equality for a single value, IN for multiple values.
+// Only known column names end up in the query, values are passed as named params.
+func makePropertyFilters(table *featureTable, propertyFilters map[string][]string) (string, map[string]any, error) {
+	if len(propertyFilters) == 0 {
+		return "", map[string]any{}, nil
+	}
+	properties := util.Keys(propertyFilters)
+	slices.Sort(properties) // deterministic query, allows for statement caching
+
+	sqlFunction, transformValue := textMatcher(table.TextMatching)
+
+	var predicates strings.Builder
+	args := make(map[string]any)
+	for i, property := range properties {
+		if !slices.Contains(table.ColumnNames, property) {
+			return "", nil, fmt.Errorf("can't filter on property '%s', it doesn't exist in table '%s'",
+				property, table.TableName)
+		}
+		column := fmt.Sprintf("f.\"%s\"", property)
+		if sqlFunction != "" {
+			column = fmt.Sprintf("%s(%s)", sqlFunction, column)
+		}
+		values := propertyFilters[property]
+		params := make([]string, 0, len(values))
+		for j, value := range values {
+			param := fmt.Sprintf("pf%d_%d", i, j)
+			params = append(params, ":"+param)
+			if transformValue != nil {
+				value = transformValue(value)
+			}
+			args[param] = value
+		}
+		if len(params) == 1 {
+			predicates.WriteString(fmt.Sprintf(" and %s = %s", column, params[0]))
+		} else {
+			predicates.WriteString(fmt.Sprintf(" and %s in (%s)", column, strings.Join(params, ", ")))
+		}
+	}
+	return predicates.String(), args, nil
+}
+
+func (g *GeoPackage) makeDefaultQuery(table *featureTable, opt datasources.FeatureOptions, propertyFilters string) (string, map[string]any, error) {
 	defaultQuery := fmt.Sprintf(`
 with 
-    next as (select * from %[1]s where %[2]s >= :fid order by %[2]s asc limit :limit + 1),
-    prev as (select * from %[1]s where %[2]s < :fid order by %[2]s desc limit :limit),
+    next as (select * from %[1]s f where f.%[2]s >= :fid %[4]s order by f.%[2]s asc limit :limit + 1),
+    prev as (select * from %[1]s f where f.%[2]s < :fid %[4]s order by f.%[2]s desc limit :limit),
     nextprev as (select * from next union all select * from prev),
     nextprevfeat as (select *, lag(%[2]s, :limit) over (order by %[2]s) as prevfid, lead(%[2]s, :limit) over (order by %[2]s) as nextfid from nextprev)
-select * from nextprevfeat where %[2]s >= :fid limit :limit
-`, table.TableName, g.fidColumn)
+select %[3]s from nextprevfeat f where f.%[2]s >= :fid limit :limit
+`, table.from(), g.fidColumn, g.selectColumns(table, opt.OutputOptions, "prevfid", "nextfid"), propertyFilters)
 
 	return defaultQuery, map[string]any{
-		"fid":   opt.Cursor.FID,
+		"fid":   table.cursorFID(opt.Cursor),
 		"limit": opt.Limit,
+		"crs":   opt.Crs,
 	}, nil
 }
 
-func (g *GeoPackage) makeBboxQuery(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+func (g *GeoPackage) makeBboxQuery(table *featureTable, opt datasources.FeatureOptions, propertyFilters string) (string, map[string]any, error) {
+	givenBbox, intersects := "", g.makeIntersectsPredicate(table)
+	if g.spatialite {
+		// parse the given bbox only once
+		givenBbox = "given_bbox as (select geomfromtext(:bboxWkt, :bboxCrs)),"
+		intersects = fmt.Sprintf("and st_intersects((select * from given_bbox), castautomagic(f.%s)) = 1", table.GeometryColumnName)
+	}
 	bboxQuery := fmt.Sprintf(`
-with 
-     given_bbox as (select geomfromtext(:bboxWkt, :bboxCrs)),
+with %[6]s
      bbox_size as (select iif(count(id) < %[3]d, 'small', 'big') as bbox_size
                      from (select id from rtree_%[1]s_%[4]s
                            where minx <= :maxx and maxx >= :minx and miny <= :maxy and maxy >= :miny
@@ -218,14 +474,14 @@ with
      next_bbox_rtree as (select f.*
                          from %[1]s f inner join rtree_%[1]s_%[4]s rf on f.%[2]s = rf.id
                          where rf.minx <= :maxx and rf.maxx >= :minx and rf.miny <= :maxy and rf.maxy >= :miny
-                           and st_intersects((select * from given_bbox), castautomagic(f.%[4]s)) = 1
+                           %[7]s %[8]s
                            and f.%[2]s >= :fid 
                          order by f.%[2]s asc 
                          limit (select iif(bbox_size == 'small', :limit + 1, 0) from bbox_size)),
      next_bbox_btree as (select f.*
                          from %[1]s f indexed by %[1]s_spatial_idx
                          where f.minx <= :maxx and f.maxx >= :minx and f.miny <= :maxy and f.maxy >= :miny
-                           and st_intersects((select * from given_bbox), castautomagic(f.%[4]s)) = 1
+                           %[7]s %[8]s
                            and f.%[2]s >= :fid 
                          order by f.%[2]s asc 
                          limit (select iif(bbox_size == 'big', :limit + 1, 0) from bbox_size)),
@@ -233,40 +489,150 @@ with
      prev_bbox_rtree as (select f.*
                          from %[1]s f inner join rtree_%[1]s_%[4]s rf on f.%[2]s = rf.id
                          where rf.minx <= :maxx and rf.maxx >= :minx and rf.miny <= :maxy and rf.maxy >= :miny
-                           and st_intersects((select * from given_bbox), castautomagic(f.%[4]s)) = 1
+                           %[7]s %[8]s
                            and f.%[2]s < :fid 
                          order by f.%[2]s desc 
                          limit (select iif(bbox_size == 'small', :limit, 0) from bbox_size)),
      prev_bbox_btree as (select f.*
                          from %[1]s f indexed by %[1]s_spatial_idx
                          where f.minx <= :maxx and f.maxx >= :minx and f.miny <= :maxy and f.maxy >= :miny
-                           and st_intersects((select * from given_bbox), castautomagic(f.%[4]s)) = 1
+                           %[7]s %[8]s
                            and f.%[2]s < :fid 
                          order by f.%[2]s desc 
                          limit (select iif(bbox_size == 'big', :limit, 0) from bbox_size)),
      prev as (select * from prev_bbox_rtree union all select * from prev_bbox_btree),
      nextprev as (select * from next union all select * from prev),
      nextprevfeat as (select *, lag(%[2]s, :limit) over (order by %[2]s) as prevfid, lead(%[2]s, :limit) over (order by %[2]s) as nextfid from nextprev)
-select * from nextprevfeat where %[2]s >= :fid limit :limit
-`, table.TableName, g.fidColumn, bboxSizeBig, table.GeometryColumnName)
+select %[5]s from nextprevfeat f where f.%[2]s >= :fid limit :limit
+`, table.TableName, g.fidColumn, bboxSizeBig, table.GeometryColumnName, g.selectColumns(table, opt.OutputOptions, "prevfid", "nextfid"),
+		givenBbox, intersects, propertyFilters)
 
 	bboxAsWKT, err := wkt.EncodeString(opt.Bbox)
 	if err != nil {
 		return "", nil, err
 	}
 	return bboxQuery, map[string]any{
-		"fid":     opt.Cursor.FID,
+		"fid":     table.cursorFID(opt.Cursor),
 		"limit":   opt.Limit,
 		"bboxWkt": bboxAsWKT,
 		"maxx":    opt.Bbox.MaxX(),
 		"minx":    opt.Bbox.MinX(),
 		"maxy":    opt.Bbox.MaxY(),
 		"miny":    opt.Bbox.MinY(),
-		"bboxCrs": opt.BboxCrs}, nil
+		"bboxCrs": opt.BboxCrs,
+		"crs":     opt.Crs}, nil
+}
+
+// Without spatialite we can't reproject, so geometries can only be served in the CRS of the feature table
+func (g *GeoPackage) assertSupported(ctx context.Context, table *featureTable, opt datasources.OutputOptions) error {
+	if opt.BboxOnly && opt.Crs > 0 && int64(opt.Crs) != table.SRS {
+		return &datasources.NotSupportedError{Message: fmt.Sprintf(
+			"bounding boxes can only be returned in the CRS of the features (EPSG:%d)", table.SRS)}
+	}
+	if !g.spatialite && opt.Crs > 0 && int64(opt.Crs) != table.SRS {
+		return &datasources.NotSupportedError{Message: fmt.Sprintf(
+			"reprojection to EPSG:%d requires spatialite, which isn't available", opt.Crs)}
+	}
+	if !g.spatialite && opt.Centroid {
+		return &datasources.NotSupportedError{Message: "centroids require spatialite, which isn't available"}
+	}
+	if opt.Crs > 0 && int64(opt.Crs) != table.SRS && !opt.SkipGeometry {
+		return g.assertKnownCrs(ctx, table, opt.Crs)
+	}
+	return nil
+}
+
+type tableCrs struct {
+	table string
+	crs   int
+}
+
+// Spatialite returns null when reprojecting to an unknown CRS, which would result in features without
+// geometries. Therefore, verify upfront that a geometry of the table can be reprojected to the given CRS.
+func (g *GeoPackage) assertKnownCrs(ctx context.Context, table *featureTable, crs int) error {
+	key := tableCrs{table.TableName, crs}
+	known, ok := g.knownCrs.Load(key)
+	if !ok {
+		queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
+		defer cancel()
+
+		query := fmt.Sprintf("select st_transform(castautomagic(f.%[1]s), :crs) is not null from %[2]s f "+
+			"where f.%[1]s is not null limit 1", table.GeometryColumnName, table.from())
+		stmt, err := g.getDB(table).PrepareNamedContext(queryCtx, query)
+		if err != nil {
+			return fmt.Errorf("failed to prepare query '%s' error: %w", query, err)
+		}
+		defer stmt.Close()
+
+		var transformed bool
+		err = stmt.GetContext(queryCtx, &transformed, map[string]any{"crs": crs})
+		if errors.Is(err, sql.ErrNoRows) {
+			transformed = true // no geometries to reproject
+		} else if err != nil {
+			return fmt.Errorf("query '%s' failed: %w", query, err)
+		}
+		known, _ = g.knownCrs.LoadOrStore(key, transformed)
+	}
+	if !known.(bool) {
+		return &datasources.NotSupportedError{Message: fmt.Sprintf(
+			"reprojection to EPSG:%d isn't possible, this CRS is unknown", crs)}
+	}
+	return nil
+}
+
+// Build the select list of a features query. When possible we push down the requested
+// output options (property selection, skipping geometries, reprojection) to the database
+// instead of post-processing the results. Only known column names end up in the query.
+func (g *GeoPackage) selectColumns(table *featureTable, opt datasources.OutputOptions, extraColumns ...string) string {
+	reproject := opt.Crs > 0 && int64(opt.Crs) != table.SRS
+	if len(opt.Properties) == 0 && !opt.SkipGeometry && !opt.BboxOnly && !opt.Centroid && !reproject && len(table.Attachments) == 0 {
+		return "*"
+	}
+
+	columns := []string{"f." + g.fidColumn}
+	if !opt.SkipGeometry {
+		if opt.BboxOnly {
+			// bbox columns are mapped to a geometry, no need to read (and decode) the actual geometry
+			for _, column := range bboxColumns {
+				columns = append(columns, "f."+column)
+			}
+		} else if opt.Centroid || reproject {
+			// spatialite returns spatialite blobs, convert back to geopackage binary
+			geometry := fmt.Sprintf("castautomagic(f.%s)", table.GeometryColumnName)
+			if opt.Centroid {
+				// point on surface instead of the actual centroid, since the latter may lie outside the polygon
+				geometry = fmt.Sprintf("st_pointonsurface(%s)", geometry)
+			}
+			if reproject {
+				geometry = fmt.Sprintf("st_transform(%s, :crs)", geometry)
+			}
+			columns = append(columns, fmt.Sprintf("asgpb(%s) as %s", geometry, table.GeometryColumnName))
+		} else {
+			columns = append(columns, "f."+table.GeometryColumnName)
+		}
+	}
+	for _, column := range table.ColumnNames {
+		if column == g.fidColumn || column == table.GeometryColumnName || slices.Contains(bboxColumns, column) {
+			continue
+		}
+		if len(opt.Properties) > 0 && !slices.Contains(opt.Properties, column) {
+			continue
+		}
+		if slices.Contains(table.Attachments, column) {
+			// don't read the (large) content of attachments, only whether it's present
+			columns = append(columns, fmt.Sprintf("iif(f.%[1]s is null, null, 1) as %[1]s", column))
+		} else {
+			columns = append(columns, "f."+column)
+		}
+	}
+	for _, column := range extraColumns {
+		columns = append(columns, "f."+column)
+	}
+	return strings.Join(columns, ", ")
 }
 
 // Read metadata about gpkg and sqlite driver
-func readDriverMetadata(db *sqlx.DB) (string, error) {
+func readDriverMetadata(db *sqlx.DB, spatialite bool) (string, error) {
 	type pragma struct {
 		UserVersion string `db:"user_version"`
 	}
@@ -277,10 +643,14 @@ func readDriverMetadata(db *sqlx.DB) (string, error) {
 	}
 
 	var m metadata
-	err := db.QueryRowx(`
+	query := `select sqlite_version() as sqlite, 'unavailable' as spatialite, 'unknown' as arch`
+	if spatialite {
+		query = `
 select sqlite_version() as sqlite, 
 spatialite_version() as spatialite,  
-spatialite_target_cpu() as arch`).StructScan(&m)
+spatialite_target_cpu() as arch`
+	}
+	err := db.QueryRowx(query).StructScan(&m)
 	if err != nil {
 		return "", err
 	}
@@ -298,6 +668,9 @@ spatialite_target_cpu() as arch`).StructScan(&m)
 // Assert that an index on each feature table exists with the given suffix and covering the given columns, in the given order.
 func (g *GeoPackage) assertIndexExistOnFeatureTables(expectedIndexNameSuffix string, expectedIndexColumns string) {
 	for _, collection := range g.featureTableByCollectionID {
+		if collection.isView() {
+			continue // views don't have indexes, see makeViewBboxFilter
+		}
 		expectedIndexName := collection.TableName + expectedIndexNameSuffix
 		var actualIndexColumns string
 
@@ -353,10 +726,8 @@ where
 			result[row.Identifier] = &row
 		} else {
 			for _, collection := range collections {
-				if row.Identifier == collection.ID {
-					result[collection.ID] = &row
-					break
-				} else if hasMatchingDatasourceID(collection, row) {
+				if row.Identifier == collection.ID || hasMatchingDatasourceID(collection, row) {
+					applyCollectionConfig(&row, collection)
 					result[collection.ID] = &row
 					break
 				}
@@ -374,11 +745,125 @@ where
 	return result, nil
 }
 
+// Read the column names of the given feature table, in the order they're defined. The property type of
+// each column is derived from its declared type, unless the property type is explicitly configured.
+func readFeatureTableColumns(table *featureTable, db *sqlx.DB) error {
+	type column struct {
+		Name string `db:"name"`
+		Type string `db:"type"`
+	}
+	var columns []column
+	if table.isView() {
+		names, types, err := readViewColumns(table, db)
+		if err != nil {
+			return err
+		}
+		for i := range names {
+			columns = append(columns, column{Name: names[i], Type: types[i]})
+		}
+	} else {
+		err := db.Select(&columns, `select name, type from pragma_table_info(?) order by cid`, table.TableName)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of feature table '%s', error: %w", table.TableName, err)
+		}
+	}
+	if table.PropertyTypes == nil {
+		table.PropertyTypes = make(domain.PropertyTypes)
+	}
+	table.ColumnNames = make([]string, 0, len(columns))
+	for _, c := range columns {
+		table.ColumnNames = append(table.ColumnNames, c.Name)
+		if _, configured := table.PropertyTypes[c.Name]; configured {
+			continue
+		}
+		if propertyType, ok := propertyTypeFromSchema(c.Type); ok {
+			table.PropertyTypes[c.Name] = propertyType
+		}
+	}
+	return nil
+}
+
+// Map the declared type of a column to a property type, see http://www.geopackage.org/spec/#table_column_data_types.
+// Columns of other types (e.g. geometries or blobs) don't have a property type.
+func propertyTypeFromSchema(declaredType string) (domain.PropertyType, bool) {
+	declaredType, _, _ = strings.Cut(strings.ToUpper(declaredType), "(") // e.g. TEXT(255)
+	switch strings.TrimSpace(declaredType) {
+	case "BOOLEAN":
+		return domain.PropertyTypeBoolean, true
+	case "DATE":
+		return domain.PropertyTypeDate, true
+	case "DATETIME", "TIMESTAMP":
+		return domain.PropertyTypeDateTime, true
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT":
+		return domain.PropertyTypeInteger, true
+	case "FLOAT", "DOUBLE", "REAL":
+		return domain.PropertyTypeNumber, true
+	case "TEXT", "VARCHAR":
+		return domain.PropertyTypeString, true
+	}
+	return "", false
+}
+
+func configuredPropertyTypes(propertyTypes map[string]string) domain.PropertyTypes {
+	result := make(domain.PropertyTypes, len(propertyTypes))
+	for column, propertyType := range propertyTypes {
+		result[column] = domain.PropertyType(propertyType)
+	}
+	return result
+}
+
+// assert that the configured queryables, property types, property metadata and attachments exist as columns in the feature tables
+func assertConfiguredColumnsExist(collections engine.GeoSpatialCollections, featureTables map[string]*featureTable) {
+	for _, collection := range collections {
+		table, ok := featureTables[collection.ID]
+		if !ok || collection.Features == nil {
+			continue
+		}
+		for _, queryable := range collection.Features.Queryables {
+			if !slices.Contains(table.ColumnNames, queryable) {
+				log.Fatalf("queryable '%s' of collection '%s' doesn't exist in table '%s'",
+					queryable, collection.ID, table.TableName)
+			}
+		}
+		for column := range collection.Features.PropertyTypes {
+			if !slices.Contains(table.ColumnNames, column) {
+				log.Fatalf("property '%s' of collection '%s' has a configured type but doesn't exist in table '%s'",
+					column, collection.ID, table.TableName)
+			}
+		}
+		for _, property := range collection.Features.Properties {
+			if !slices.Contains(table.ColumnNames, property.Property) {
+				log.Fatalf("property '%s' of collection '%s' has configured metadata but doesn't exist in table '%s'",
+					property.Property, collection.ID, table.TableName)
+			}
+		}
+		for _, attachment := range collection.Features.Attachments {
+			if !slices.Contains(table.ColumnNames, attachment.Property) {
+				log.Fatalf("attachment '%s' of collection '%s' doesn't exist in table '%s'",
+					attachment.Property, collection.ID, table.TableName)
+			}
+		}
+	}
+}
+
 func hasMatchingDatasourceID(collection engine.GeoSpatialCollection, row featureTable) bool {
 	return collection.Features != nil && collection.Features.DatasourceID != nil &&
 		row.Identifier == *collection.Features.DatasourceID
 }
 
+// Apply the configuration of the collection (text matching, property types and attachments) to its feature table
+func applyCollectionConfig(table *featureTable, collection engine.GeoSpatialCollection) {
+	if collection.Features == nil {
+		return
+	}
+	table.TextMatching = collection.Features.TextMatching
+	table.TextFid = collection.Features.HasTextFid()
+	table.PropertyTypes = configuredPropertyTypes(collection.Features.PropertyTypes)
+	for _, attachment := range collection.Features.Attachments {
+		table.Attachments = append(table.Attachments, attachment.Property)
+	}
+}
+
 func readGpkgGeometry(rawGeom []byte) (geom.Geometry, error) {
 	geometry, err := gpkg.DecodeGeometry(rawGeom)
 	if err != nil {
@@ -2,16 +2,21 @@ package geopackage
 
 import (
 	"context"
+	"io"
+	"log"
 	"path"
 	"runtime"
 	"testing"
 	"time"
 
 	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/cql"
 	"github.com/PDOK/gokoala/ogc/features/datasources"
 	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
 	"github.com/go-spatial/geom/encoding/geojson"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var pwd string
@@ -22,6 +27,7 @@ func init() {
 }
 
 func newAddressesGeoPackage() geoPackageBackend {
+	registerDriver()
 	return newLocalGeoPackage(&engine.GeoPackageLocal{
 		GeoPackageCommon: engine.GeoPackageCommon{
 			Fid: "feature_id",
@@ -93,7 +99,7 @@ func TestGeoPackage_GetFeatures(t *testing.T) {
 				ctx:        context.Background(),
 				collection: "ligplaatsen",
 				queryParams: datasources.FeatureOptions{
-					Cursor: domain.DecodedCursor{FID: 0, FiltersChecksum: []byte{}},
+					Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
 					Limit:  2,
 				},
 			},
@@ -137,7 +143,7 @@ func TestGeoPackage_GetFeatures(t *testing.T) {
 				collection: "ligplaatsen",
 				queryParams: datasources.FeatureOptions{
 					Cursor: domain.DecodedCursor{
-						FID:             3838, // see next cursor from test above
+						FID:             domain.NewFeatureID(3838), // see next cursor from test above
 						FiltersChecksum: []byte{},
 					},
 					Limit: 3,
@@ -178,6 +184,295 @@ func TestGeoPackage_GetFeatures(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "get first page of features filtered on property",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor:          domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:           2,
+					PropertyFilters: map[string][]string{"straatnaam": {"Realengracht"}},
+				},
+			},
+			wantFC: &domain.FeatureCollection{
+				NumberReturned: 2,
+				Features: []*domain.Feature{
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Realengracht",
+								"nummer_id":  "0363200000398886",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Realengracht",
+								"nummer_id":  "0363200000398887",
+							},
+						},
+					},
+				},
+			},
+			wantCursor: domain.Cursors{
+				Prev: "fA==",
+				Next: "Dv98", // 3839
+			},
+			wantErr: false,
+		},
+		{
+			name: "get features filtered on property, case and accent insensitive",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}, TextMatching: engine.TextMatchingCaseAccentInsensitive}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor:          domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:           2,
+					PropertyFilters: map[string][]string{"straatnaam": {"RÉALENGRACHT"}},
+				},
+			},
+			wantFC: &domain.FeatureCollection{
+				NumberReturned: 2,
+				Features: []*domain.Feature{
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Realengracht",
+								"nummer_id":  "0363200000398886",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Realengracht",
+								"nummer_id":  "0363200000398887",
+							},
+						},
+					},
+				},
+			},
+			wantCursor: domain.Cursors{
+				Prev: "fA==",
+				Next: "Dv98",
+			},
+			wantErr: false,
+		},
+		{
+			name: "get features filtered on multiple property values",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor:          domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:           10,
+					PropertyFilters: map[string][]string{"nummer_id": {"0363200000454013", "0363200000398888"}},
+				},
+			},
+			wantFC: &domain.FeatureCollection{
+				NumberReturned: 2,
+				Features: []*domain.Feature{
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Van Diemenkade",
+								"nummer_id":  "0363200000454013",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Realengracht",
+								"nummer_id":  "0363200000398888",
+							},
+						},
+					},
+				},
+			},
+			wantCursor: domain.Cursors{
+				Prev: "fA==",
+				Next: "fA==", // no next page
+			},
+			wantErr: false,
+		},
+		{
+			name: "get features filtered by CQL",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:  10,
+					Filter: mustParseFilter("nummer_id = '0363200000454013' or (straatnaam like 'Realen%' and nummer_id like '%888')"),
+				},
+			},
+			wantFC: &domain.FeatureCollection{
+				NumberReturned: 2,
+				Features: []*domain.Feature{
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Van Diemenkade",
+								"nummer_id":  "0363200000454013",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Realengracht",
+								"nummer_id":  "0363200000398888",
+							},
+						},
+					},
+				},
+			},
+			wantCursor: domain.Cursors{
+				Prev: "fA==",
+				Next: "fA==", // no next page
+			},
+			wantErr: false,
+		},
+		{
+			name: "get features filtered by time interval, features are instants",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id", "datum_strt", "datum_eind"}}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:  10,
+					Temporal: &datasources.TemporalFilter{
+						Start:         "2016-01-01T00:00:00Z",
+						End:           "2021-02-26T23:59:59Z",
+						StartProperty: "datum_strt",
+					},
+				},
+			},
+			wantFC: &domain.FeatureCollection{
+				NumberReturned: 4,
+				Features: []*domain.Feature{
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Van Diemenkade",
+								"nummer_id":  "0363200000508831",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Van Diemenkade",
+								"nummer_id":  "0363200011942764",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Zandhoek",
+								"nummer_id":  "0363200012111723",
+							},
+						},
+					},
+					{
+						Feature: geojson.Feature{
+							Properties: map[string]interface{}{
+								"straatnaam": "Bokkinghangen",
+								"nummer_id":  "0363200012163629",
+							},
+						},
+					},
+				},
+			},
+			wantCursor: domain.Cursors{
+				Prev: "fA==",
+				Next: "fA==", // no next page
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail on spatial CQL filter without spatialite",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:  10,
+					Filter: mustParseFilter("S_INTERSECTS(geometry, POINT(4.88 52.38))"),
+				},
+			},
+			wantFC:     nil,
+			wantCursor: domain.Cursors{},
+			wantErr:    true, // should fail
+		},
+		{
+			name: "fail on filter on non existing property",
+			fields: fields{
+				backend:   newAddressesGeoPackage(),
+				fidColumn: "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+					ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+				queryTimeout: 5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				queryParams: datasources.FeatureOptions{
+					Cursor:          domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+					Limit:           10,
+					PropertyFilters: map[string][]string{"foo": {"bar"}},
+				},
+			},
+			wantFC:     nil,
+			wantCursor: domain.Cursors{},
+			wantErr:    true, // should fail
+		},
 		{
 			name: "fail on non existing collection",
 			fields: fields{
@@ -190,7 +485,7 @@ func TestGeoPackage_GetFeatures(t *testing.T) {
 				ctx:        context.Background(),
 				collection: "vakantiehuizen", // not in gpkg
 				queryParams: datasources.FeatureOptions{
-					Cursor: domain.DecodedCursor{FID: 0, FiltersChecksum: []byte{}},
+					Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
 					Limit:  10,
 				},
 			},
@@ -226,6 +521,14 @@ func TestGeoPackage_GetFeatures(t *testing.T) {
 	}
 }
 
+func mustParseFilter(filter string) cql.Expression {
+	expr, err := cql.Parse(filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return expr
+}
+
 func TestGeoPackage_GetFeature(t *testing.T) {
 	type fields struct {
 		backend          geoPackageBackend
@@ -236,7 +539,7 @@ func TestGeoPackage_GetFeature(t *testing.T) {
 	type args struct {
 		ctx        context.Context
 		collection string
-		featureID  int64
+		featureID  domain.FeatureID
 	}
 	tests := []struct {
 		name    string
@@ -256,10 +559,10 @@ func TestGeoPackage_GetFeature(t *testing.T) {
 			args: args{
 				ctx:        context.Background(),
 				collection: "ligplaatsen",
-				featureID:  3837,
+				featureID:  domain.NewFeatureID(3837),
 			},
 			want: &domain.Feature{
-				ID:    0,
+				ID:    domain.NewFeatureID(0),
 				Links: nil,
 				Feature: geojson.Feature{
 					Properties: map[string]interface{}{
@@ -281,7 +584,7 @@ func TestGeoPackage_GetFeature(t *testing.T) {
 			args: args{
 				ctx:        context.Background(),
 				collection: "ligplaatsen",
-				featureID:  999991111111111111,
+				featureID:  domain.NewFeatureID(999991111111111111),
 			},
 			want:    nil,
 			wantErr: false, // not an error situation
@@ -297,7 +600,7 @@ func TestGeoPackage_GetFeature(t *testing.T) {
 			args: args{
 				ctx:        context.Background(),
 				collection: "vakantieparken", // not in gpkg
-				featureID:  3837,
+				featureID:  domain.NewFeatureID(3837),
 			},
 			want:    nil,
 			wantErr: true,
@@ -311,7 +614,7 @@ func TestGeoPackage_GetFeature(t *testing.T) {
 				featureTableByCollectionID: tt.fields.featureTableByID,
 				queryTimeout:               tt.fields.queryTimeout,
 			}
-			got, err := g.GetFeature(tt.args.ctx, tt.args.collection, tt.args.featureID)
+			got, err := g.GetFeature(tt.args.ctx, tt.args.collection, tt.args.featureID, datasources.OutputOptions{})
 			if err != nil {
 				if !tt.wantErr {
 					t.Errorf("GetFeature, error %v, wantErr %v", err, tt.wantErr)
@@ -325,3 +628,584 @@ func TestGeoPackage_GetFeature(t *testing.T) {
 		})
 	}
 }
+
+func TestGeoPackage_GetFeature_BboxOnly(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {
+			TableName: "ligplaatsen", GeometryColumnName: "geom", ColumnNames: []string{"feature_id", "geom", "minx", "straatnaam"}}},
+		queryTimeout: 5 * time.Second,
+	}
+	// bbox of a point is the point itself, see domain for polygons
+	bboxOnly, err := g.GetFeature(context.Background(), "ligplaatsen", domain.NewFeatureID(3837), datasources.OutputOptions{BboxOnly: true})
+	assert.NoError(t, err)
+	assert.Equal(t, geom.Point{121108.424, 488930.925}, bboxOnly.Geometry.Geometry)
+	assert.Equal(t, "Realengracht", bboxOnly.Properties["straatnaam"])
+	assert.NotContains(t, bboxOnly.Properties, "minx")
+
+	_, err = g.GetFeature(context.Background(), "ligplaatsen", domain.NewFeatureID(3837), datasources.OutputOptions{BboxOnly: true, Crs: 4326})
+	var notSupported *datasources.NotSupportedError
+	assert.ErrorAs(t, err, &notSupported)
+}
+
+func TestGeoPackage_selectColumns(t *testing.T) {
+	table := &featureTable{TableName: "buildings", GeometryColumnName: "geom", SRS: 28992,
+		ColumnNames: []string{"fid", "geom", "name", "minx", "miny", "maxx", "maxy"}}
+	tests := []struct {
+		name string
+		opt  datasources.OutputOptions
+		want string
+	}{
+		{
+			name: "all columns",
+			opt:  datasources.OutputOptions{},
+			want: "*",
+		},
+		{
+			name: "skip geometry",
+			opt:  datasources.OutputOptions{SkipGeometry: true},
+			want: "f.fid, f.name",
+		},
+		{
+			name: "bbox only",
+			opt:  datasources.OutputOptions{BboxOnly: true},
+			want: "f.fid, f.minx, f.miny, f.maxx, f.maxy, f.name",
+		},
+		{
+			name: "centroid",
+			opt:  datasources.OutputOptions{Centroid: true},
+			want: "f.fid, asgpb(st_pointonsurface(castautomagic(f.geom))) as geom, f.name",
+		},
+		{
+			name: "reprojected centroid",
+			opt:  datasources.OutputOptions{Centroid: true, Crs: 4326},
+			want: "f.fid, asgpb(st_transform(st_pointonsurface(castautomagic(f.geom)), :crs)) as geom, f.name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GeoPackage{fidColumn: "fid", spatialite: true}
+			assert.Equal(t, tt.want, g.selectColumns(table, tt.opt))
+		})
+	}
+
+	// centroids are computed using spatialite
+	g := &GeoPackage{fidColumn: "fid", spatialite: false}
+	assert.Error(t, g.assertSupported(context.Background(), table, datasources.OutputOptions{Centroid: true}))
+}
+
+func TestGeoPackage_GetFeaturesByID(t *testing.T) {
+	type fields struct {
+		backend          geoPackageBackend
+		fidColumn        string
+		featureTableByID map[string]*featureTable
+		queryTimeout     time.Duration
+	}
+	type args struct {
+		ctx        context.Context
+		collection string
+		featureIDs []domain.FeatureID
+	}
+	tests := []struct {
+		name           string
+		fields         fields
+		args           args
+		wantFeatureIDs []domain.FeatureID
+		wantErr        bool
+	}{
+		{
+			name: "get features by id",
+			fields: fields{
+				backend:          newAddressesGeoPackage(),
+				fidColumn:        "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom"}},
+				queryTimeout:     5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "ligplaatsen",
+				featureIDs: []domain.FeatureID{domain.NewFeatureID(3839), domain.NewFeatureID(3837), domain.NewFeatureID(999991111111111111)},
+			},
+			wantFeatureIDs: []domain.FeatureID{domain.NewFeatureID(3837), domain.NewFeatureID(3839)}, // ordered by id, non existing id is ignored
+			wantErr:        false,
+		},
+		{
+			name: "fail on non existing collection",
+			fields: fields{
+				backend:          newAddressesGeoPackage(),
+				fidColumn:        "feature_id",
+				featureTableByID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom"}},
+				queryTimeout:     5 * time.Second,
+			},
+			args: args{
+				ctx:        context.Background(),
+				collection: "vakantieparken", // not in gpkg
+				featureIDs: []domain.FeatureID{domain.NewFeatureID(3837)},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GeoPackage{
+				backend:                    tt.fields.backend,
+				fidColumn:                  tt.fields.fidColumn,
+				featureTableByCollectionID: tt.fields.featureTableByID,
+				queryTimeout:               tt.fields.queryTimeout,
+			}
+			got, err := g.GetFeaturesByID(tt.args.ctx, tt.args.collection, tt.args.featureIDs, datasources.OutputOptions{})
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("GetFeaturesByID, error %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			assert.Equal(t, len(tt.wantFeatureIDs), got.NumberReturned)
+			for i, feature := range got.Features {
+				assert.Equal(t, tt.wantFeatureIDs[i], feature.ID)
+			}
+		})
+	}
+}
+
+func TestGeoPackage_PropertyTypes(t *testing.T) {
+	collections := engine.GeoSpatialCollections{
+		{ID: "ligplaatsen", Features: &engine.CollectionEntryFeatures{
+			PropertyTypes: map[string]string{"datum_strt": "date", "huisnummer": "string"},
+		}},
+	}
+	backend := newAddressesGeoPackage()
+	featureTables, err := readGpkgContents(collections, backend.getDB())
+	assert.NoError(t, err)
+	table := featureTables["ligplaatsen"]
+	assert.NoError(t, readFeatureTableColumns(table, backend.getDB()))
+
+	// derived from schema
+	assert.Equal(t, domain.PropertyTypeString, table.PropertyTypes["straatnaam"])
+	assert.NotContains(t, table.PropertyTypes, "geom")
+	// configured
+	assert.Equal(t, domain.PropertyTypeDate, table.PropertyTypes["datum_strt"])
+	assert.Equal(t, domain.PropertyTypeString, table.PropertyTypes["huisnummer"])
+
+	g := &GeoPackage{
+		backend:                    backend,
+		fidColumn:                  "feature_id",
+		featureTableByCollectionID: featureTables,
+		queryTimeout:               5 * time.Second,
+	}
+	fc, _, err := g.GetFeatures(context.Background(), "ligplaatsen", datasources.FeatureOptions{
+		Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+		Limit:  1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), fc.Features[0].Properties["datum_strt"])
+	assert.Equal(t, "14", fc.Features[0].Properties["huisnummer"])
+}
+
+func TestPropertyTypeFromSchema(t *testing.T) {
+	tests := []struct {
+		declaredType string
+		want         domain.PropertyType
+		wantOk       bool
+	}{
+		{declaredType: "BOOLEAN", want: domain.PropertyTypeBoolean, wantOk: true},
+		{declaredType: "DATE", want: domain.PropertyTypeDate, wantOk: true},
+		{declaredType: "datetime", want: domain.PropertyTypeDateTime, wantOk: true},
+		{declaredType: "MEDIUMINT", want: domain.PropertyTypeInteger, wantOk: true},
+		{declaredType: "DOUBLE", want: domain.PropertyTypeNumber, wantOk: true},
+		{declaredType: "TEXT(255)", want: domain.PropertyTypeString, wantOk: true},
+		{declaredType: "POINT", wantOk: false},
+		{declaredType: "BLOB", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.declaredType, func(t *testing.T) {
+			got, ok := propertyTypeFromSchema(tt.declaredType)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
+
+func TestLocalGeoPackageDSN(t *testing.T) {
+	mutable := false
+	busyTimeout := 2 * time.Second
+	cacheSize := 8192
+
+	tests := []struct {
+		name   string
+		config *engine.GeoPackageLocal
+		want   string
+	}{
+		{
+			name:   "defaults",
+			config: &engine.GeoPackageLocal{File: "/data/addresses.gpkg"},
+			want:   "file:/data/addresses.gpkg?_busy_timeout=5000&immutable=1&mode=ro",
+		},
+		{
+			name: "mutable with pragmas",
+			config: &engine.GeoPackageLocal{
+				File:        "testdata/my addresses?.gpkg",
+				Immutable:   &mutable,
+				BusyTimeout: &busyTimeout,
+				CacheSize:   &cacheSize,
+			},
+			want: "file:testdata/my%20addresses%3F.gpkg?_busy_timeout=2000&_cache_size=-8192&mode=ro",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, localGeoPackageDSN(tt.config))
+		})
+	}
+}
+
+func TestGeoPackage_GetAttachment(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames: []string{"feature_id", "geom", "straatnaam", "rdf_seealso"}, Attachments: []string{"rdf_seealso"}}},
+		queryTimeout: 5 * time.Second,
+	}
+	content, err := g.GetAttachment(context.Background(), "ligplaatsen", domain.NewFeatureID(3542), "rdf_seealso")
+	assert.NoError(t, err)
+	all, err := io.ReadAll(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://bag.basisregistraties.overheid.nl/bag/id/nummeraanduiding/0363200000454013", string(all))
+
+	// read in chunks, after seeking (e.g. for range requests)
+	content.(*attachmentReader).chunkSize = 4
+	_, err = content.Seek(-10, io.SeekEnd)
+	assert.NoError(t, err)
+	tail, err := io.ReadAll(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "0000454013", string(tail))
+
+	content, err = g.GetAttachment(context.Background(), "ligplaatsen", domain.NewFeatureID(1), "rdf_seealso")
+	assert.NoError(t, err)
+	assert.Nil(t, content)
+
+	_, err = g.GetAttachment(context.Background(), "ligplaatsen", domain.NewFeatureID(3542), "straatnaam")
+	assert.Error(t, err)
+
+	// features only indicate the presence of an attachment, the content itself isn't read
+	feature, err := g.GetFeature(context.Background(), "ligplaatsen", domain.NewFeatureID(3542), datasources.OutputOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), feature.Properties["rdf_seealso"])
+	assert.Equal(t, "Van Diemenkade", feature.Properties["straatnaam"])
+}
+
+func TestGeoPackage_GetFeatureHits(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+		queryTimeout: 5 * time.Second,
+	}
+	tests := []struct {
+		name       string
+		collection string
+		options    datasources.FeatureOptions
+		wantCount  int
+		wantBbox   *geom.Extent
+		wantErr    string
+	}{
+		{
+			name:       "all features",
+			collection: "ligplaatsen",
+			wantCount:  67,
+			wantBbox:   &geom.Extent{120894.401, 488873.556, 121269.506, 489370.511},
+		},
+		{
+			name:       "filtered on property",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{PropertyFilters: map[string][]string{"straatnaam": {"Realengracht"}}},
+			wantCount:  7,
+			wantBbox:   &geom.Extent{120980.398, 488919.715, 121108.424, 488930.925},
+		},
+		{
+			name:       "filtered on bbox",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{Bbox: &geom.Extent{120900, 488800, 121100, 489000}, BboxCrs: 28992},
+			wantCount:  8,
+		},
+		{
+			name:       "no matches",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{PropertyFilters: map[string][]string{"straatnaam": {"Damrak"}}},
+			wantCount:  0,
+		},
+		{
+			name:       "fail on search",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{Search: "Realengracht"},
+			wantErr:    "isn't available for nearest or search queries",
+		},
+		{
+			name:       "fail on non existing collection",
+			collection: "vakantieparken",
+			wantErr:    "doesn't exist in geopackage",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.GetFeatureHits(context.Background(), tt.collection, tt.options)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCount, *got.NumberMatched)
+			assert.Equal(t, 0, got.NumberReturned)
+			assert.Empty(t, got.Features)
+			if tt.wantBbox != nil {
+				assert.Equal(t, tt.wantBbox, got.Bbox)
+			}
+			if tt.wantCount == 0 {
+				assert.Nil(t, got.Bbox)
+			}
+		})
+	}
+}
+
+func TestGeoPackage_GetFeatureCount(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+		queryTimeout: 5 * time.Second,
+	}
+	tests := []struct {
+		name       string
+		collection string
+		options    datasources.FeatureOptions
+		estimated  bool
+		wantCount  int
+		wantErr    string
+	}{
+		{
+			name:       "exact count",
+			collection: "ligplaatsen",
+			wantCount:  67,
+		},
+		{
+			name:       "estimated count",
+			collection: "ligplaatsen",
+			estimated:  true,
+			wantCount:  67,
+		},
+		{
+			name:       "exact count when filtered, even when estimated",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{PropertyFilters: map[string][]string{"straatnaam": {"Realengracht"}}},
+			estimated:  true,
+			wantCount:  7,
+		},
+		{
+			name:       "exact count when filtered on bbox",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{Bbox: &geom.Extent{120900, 488800, 121100, 489000}, BboxCrs: 28992},
+			wantCount:  8,
+		},
+		{
+			name:       "fail on search",
+			collection: "ligplaatsen",
+			options:    datasources.FeatureOptions{Search: "Realengracht"},
+			wantErr:    "isn't available for nearest or search queries",
+		},
+		{
+			name:       "fail on non existing collection",
+			collection: "vakantieparken",
+			wantErr:    "doesn't exist in geopackage",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.GetFeatureCount(context.Background(), tt.collection, tt.options, tt.estimated)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCount, got)
+		})
+	}
+}
+
+func TestGeoPackage_estimateFeatureCount(t *testing.T) {
+	g := &GeoPackage{backend: newAddressesGeoPackage()}
+
+	// feature count maintained by GDAL
+	count, found, err := g.estimateFeatureCount(context.Background(), &featureTable{TableName: "standplaatsen"})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, count)
+
+	// no statistics available
+	_, found, err = g.estimateFeatureCount(context.Background(), &featureTable{TableName: "vakantieparken"})
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestGeoPackage_View(t *testing.T) {
+	collections := engine.GeoSpatialCollections{
+		{ID: "realengracht", Features: &engine.CollectionEntryFeatures{View: &engine.FeatureView{
+			Query: `select feature_id, geom, minx, miny, maxx, maxy, straatnaam, huisnummer || ':' || postcode as adres
+                    from ligplaatsen where straatnaam = 'Realengracht';`,
+			GeometryColumn: "geom",
+		}}},
+	}
+	backend := newAddressesGeoPackage()
+	featureTables := make(map[string]*featureTable)
+	assert.NoError(t, readViews(collections, backend.getDB(), "feature_id", featureTables))
+	table := featureTables["realengracht"]
+	assert.Equal(t, int64(28992), table.SRS)
+	assert.Equal(t, []string{"feature_id", "geom", "minx", "miny", "maxx", "maxy", "straatnaam", "adres"}, table.ColumnNames)
+	assert.Equal(t, domain.PropertyTypeString, table.PropertyTypes["straatnaam"])
+
+	g := &GeoPackage{
+		backend:                    backend,
+		fidColumn:                  "feature_id",
+		featureTableByCollectionID: featureTables,
+		queryTimeout:               5 * time.Second,
+	}
+	fc, cursors, err := g.GetFeatures(context.Background(), "realengracht", datasources.FeatureOptions{Limit: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, fc.NumberReturned)
+	assert.True(t, cursors.HasNext)
+	assert.Equal(t, domain.NewFeatureID(3837), fc.Features[0].ID)
+	assert.Contains(t, fc.Features[0].Properties["adres"], ":")
+
+	fc, _, err = g.GetFeatures(context.Background(), "realengracht", datasources.FeatureOptions{
+		Limit:  10,
+		Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(3842)},
+		Bbox:   &geom.Extent{120900, 488800, 121100, 489000},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fc.NumberReturned)
+
+	feature, err := g.GetFeature(context.Background(), "realengracht", domain.NewFeatureID(4180), datasources.OutputOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Realengracht", feature.Properties["straatnaam"])
+
+	hits, err := g.GetFeatureHits(context.Background(), "realengracht", datasources.FeatureOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, *hits.NumberMatched)
+
+	_, _, err = g.GetFeatures(context.Background(), "realengracht", datasources.FeatureOptions{Limit: 5, Search: "Realengracht"})
+	assert.ErrorContains(t, err, "aren't supported on views")
+}
+
+func TestGeoPackage_View_TextFid(t *testing.T) {
+	collections := engine.GeoSpatialCollections{
+		{ID: "realengracht", Features: &engine.CollectionEntryFeatures{FidType: engine.FidTypeString, View: &engine.FeatureView{
+			Query: `select 'NL.IMBAG.Ligplaats.' || feature_id as feature_id, geom, minx, miny, maxx, maxy, straatnaam
+                    from ligplaatsen where straatnaam = 'Realengracht'`,
+			GeometryColumn: "geom",
+		}}},
+	}
+	backend := newAddressesGeoPackage()
+	featureTables := make(map[string]*featureTable)
+	assert.NoError(t, readViews(collections, backend.getDB(), "feature_id", featureTables))
+	assert.True(t, featureTables["realengracht"].TextFid)
+
+	g := &GeoPackage{
+		backend:                    backend,
+		fidColumn:                  "feature_id",
+		featureTableByCollectionID: featureTables,
+		queryTimeout:               5 * time.Second,
+	}
+	fc, cursors, err := g.GetFeatures(context.Background(), "realengracht", datasources.FeatureOptions{Limit: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, fc.NumberReturned)
+	assert.Equal(t, domain.NewTextFeatureID("NL.IMBAG.Ligplaats.3837"), fc.Features[0].ID)
+	assert.False(t, cursors.HasPrev)
+	assert.True(t, cursors.HasNext)
+
+	// next page, the cursor holds a textual feature id
+	fc, cursors, err = g.GetFeatures(context.Background(), "realengracht", datasources.FeatureOptions{
+		Limit:  4,
+		Cursor: cursors.Next.Decode([]byte{}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fc.NumberReturned)
+	assert.Equal(t, domain.NewTextFeatureID("NL.IMBAG.Ligplaats.3841"), fc.Features[0].ID)
+	assert.True(t, cursors.HasPrev)
+	assert.False(t, cursors.HasNext)
+
+	feature, err := g.GetFeature(context.Background(), "realengracht", domain.NewTextFeatureID("NL.IMBAG.Ligplaats.4180"), datasources.OutputOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Realengracht", feature.Properties["straatnaam"])
+
+	byID, err := g.GetFeaturesByID(context.Background(), "realengracht", []domain.FeatureID{
+		domain.NewTextFeatureID("NL.IMBAG.Ligplaats.4180"), domain.NewTextFeatureID("NL.IMBAG.Ligplaats.3837"),
+	}, datasources.OutputOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, byID.NumberReturned)
+}
+
+func TestReadViews_MissingColumns(t *testing.T) {
+	collections := engine.GeoSpatialCollections{
+		{ID: "realengracht", Features: &engine.CollectionEntryFeatures{View: &engine.FeatureView{
+			Query:          `select feature_id, geom, straatnaam from ligplaatsen`,
+			GeometryColumn: "geom",
+		}}},
+	}
+	err := readViews(collections, newAddressesGeoPackage().getDB(), "feature_id", make(map[string]*featureTable))
+	assert.ErrorContains(t, err, "view of collection 'realengracht' should return column 'minx'")
+}
+
+func TestGeoPackage_GetProperties(t *testing.T) {
+	g := &GeoPackage{
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames:   []string{"feature_id", "geom", "straatnaam", "huisnummer", "photo", "minx", "miny", "maxx", "maxy"},
+			PropertyTypes: domain.PropertyTypes{"straatnaam": domain.PropertyTypeString, "huisnummer": domain.PropertyTypeInteger}}},
+	}
+	properties, err := g.GetProperties("ligplaatsen")
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Property{
+		{Name: "straatnaam", Type: domain.PropertyTypeString},
+		{Name: "huisnummer", Type: domain.PropertyTypeInteger},
+		{Name: "photo"},
+	}, properties)
+
+	_, err = g.GetProperties("vakantieparken")
+	assert.ErrorContains(t, err, "doesn't exist in geopackage")
+}
+
+func TestGeoPackage_GetStorageCrs(t *testing.T) {
+	g := &GeoPackage{
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", SRS: 28992}},
+	}
+	crs, err := g.GetStorageCrs("ligplaatsen")
+	assert.NoError(t, err)
+	assert.Equal(t, 28992, crs)
+
+	_, err = g.GetStorageCrs("vakantieparken")
+	assert.ErrorContains(t, err, "doesn't exist in geopackage")
+}
+
+func TestGeoPackage_GetFeature_UnknownCrs(t *testing.T) {
+	g := NewGeoPackage(nil, engine.GeoPackage{
+		Local: &engine.GeoPackageLocal{
+			GeoPackageCommon: engine.GeoPackageCommon{Fid: "feature_id"},
+			File:             pwd + "/testdata/addresses.gpkg",
+		},
+	})
+	if !g.spatialite {
+		t.Skip("spatialite isn't available")
+	}
+	feature, err := g.GetFeature(context.Background(), "ligplaatsen", domain.NewFeatureID(4030), datasources.OutputOptions{Crs: 4326})
+	require.NoError(t, err)
+	assert.NotNil(t, feature.Geometry)
+
+	// unknown CRS is a client error (400), instead of a feature without geometry
+	_, err = g.GetFeature(context.Background(), "ligplaatsen", domain.NewFeatureID(4030), datasources.OutputOptions{Crs: 99999})
+	var notSupported *datasources.NotSupportedError
+	require.ErrorAs(t, err, &notSupported)
+	assert.Contains(t, notSupported.Message, "EPSG:99999")
+}
@@ -0,0 +1,202 @@
+package geopackage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/PDOK/gokoala/engine/util"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/wkt"
+	"github.com/jmoiron/sqlx"
+)
+
+func (g *GeoPackage) GetFeatureCount(ctx context.Context, collection string, options datasources.FeatureOptions, estimated bool) (int, error) {
+	table, ok := g.featureTableByCollectionID[collection]
+	if !ok {
+		return 0, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
+	}
+	if options.Nearest != nil || options.Search != "" {
+		return 0, fmt.Errorf("number of matching features isn't available for nearest or search queries")
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
+	defer cancel()
+
+	if estimated && !options.HasFilters() && (!table.isView() || table.Materialized != nil) {
+		if count, found, err := g.estimateFeatureCount(queryCtx, table); err != nil || found {
+			return count, err
+		}
+	}
+	options, err := g.toTableBbox(queryCtx, table, options)
+	if err != nil {
+		return 0, err
+	}
+	query, queryArgs, err := g.makeCountQuery(table, options, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make count query, error: %w", err)
+	}
+	stmt, err := g.getDB(table).PrepareNamedContext(queryCtx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare query '%s' error: %w", query, err)
+	}
+	defer stmt.Close()
+
+	var count int
+	if err = stmt.GetContext(queryCtx, &count, queryArgs); err != nil {
+		return 0, fmt.Errorf("failed to execute query '%s' error: %w", query, err)
+	}
+	return count, nil
+}
+
+func (g *GeoPackage) GetFeatureHits(ctx context.Context, collection string, options datasources.FeatureOptions) (*domain.FeatureCollection, error) {
+	table, ok := g.featureTableByCollectionID[collection]
+	if !ok {
+		return nil, fmt.Errorf("can't query collection '%s' since it doesn't exist in "+
+			"geopackage, available in geopackage: %v", collection, util.Keys(g.featureTableByCollectionID))
+	}
+	if options.Nearest != nil || options.Search != "" {
+		return nil, fmt.Errorf("number of matching features isn't available for nearest or search queries")
+	}
+	if err := g.assertSupported(ctx, table, options.OutputOptions); err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout) // https://go.dev/doc/database/cancel-operations
+	defer cancel()
+
+	options, err := g.toTableBbox(queryCtx, table, options)
+	if err != nil {
+		return nil, err
+	}
+	query, queryArgs, err := g.makeCountQuery(table, options, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make hits query, error: %w", err)
+	}
+	stmt, err := g.getDB(table).PrepareNamedContext(queryCtx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query '%s' error: %w", query, err)
+	}
+	defer stmt.Close()
+
+	var hits struct {
+		Count int             `db:"count"`
+		MinX  sql.NullFloat64 `db:"minx"`
+		MinY  sql.NullFloat64 `db:"miny"`
+		MaxX  sql.NullFloat64 `db:"maxx"`
+		MaxY  sql.NullFloat64 `db:"maxy"`
+	}
+	if err = stmt.GetContext(queryCtx, &hits, queryArgs); err != nil {
+		return nil, fmt.Errorf("failed to execute query '%s' error: %w", query, err)
+	}
+
+	result := domain.FeatureCollection{NumberMatched: &hits.Count, Features: make([]*domain.Feature, 0)}
+	if hits.Count > 0 && hits.MinX.Valid {
+		extent := geom.Extent{hits.MinX.Float64, hits.MinY.Float64, hits.MaxX.Float64, hits.MaxY.Float64}
+		if result.Bbox, err = g.fromTableCrs(queryCtx, table, extent, options.Crs); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// Count the features matching the given filters, and optionally determine their extent from the bbox columns. This
+// is a single aggregate query (on the rtree when filtering by bbox) instead of the paginated features query.
+func (g *GeoPackage) makeCountQuery(table *featureTable, opt datasources.FeatureOptions, withExtent bool) (string, map[string]any, error) {
+	join, predicates, args, err := g.makeMatchClauses(table, opt)
+	if err != nil {
+		return "", nil, err
+	}
+	columns := "count(*) as count"
+	if withExtent {
+		columns += ", min(f.minx) as minx, min(f.miny) as miny, max(f.maxx) as maxx, max(f.maxy) as maxy"
+	}
+	countQuery := fmt.Sprintf(`
+select %[1]s
+from %[2]s f %[3]s
+where 1 = 1 %[4]s
+`, columns, table.from(), join, predicates)
+
+	return countQuery, args, nil
+}
+
+// Build the join (on the rtree when filtering by bbox) and predicates (each prefixed with 'and') that select the
+// features matching the given filters in a single query, as opposed to the CTEs of the cursor-based queries.
+func (g *GeoPackage) makeMatchClauses(table *featureTable, opt datasources.FeatureOptions) (string, string, map[string]any, error) {
+	filters, args, err := g.makeFilters(table, opt)
+	if err != nil {
+		return "", "", nil, err
+	}
+	join, intersects := "", ""
+	if opt.Bbox != nil && table.isView() {
+		bboxFilter, bboxFilterArgs, err := g.makeViewBboxFilter(table, opt)
+		if err != nil {
+			return "", "", nil, err
+		}
+		filters += bboxFilter
+		for name, value := range bboxFilterArgs {
+			args[name] = value
+		}
+	} else if opt.Bbox != nil {
+		join = fmt.Sprintf(`inner join rtree_%[1]s_%[2]s rf on f.%[3]s = rf.id
+        and rf.minx <= :maxx and rf.maxx >= :minx and rf.miny <= :maxy and rf.maxy >= :miny`,
+			table.TableName, table.GeometryColumnName, g.fidColumn)
+		intersects = g.makeIntersectsPredicate(table)
+		bboxAsWKT, err := wkt.EncodeString(opt.Bbox)
+		if err != nil {
+			return "", "", nil, err
+		}
+		args["bboxWkt"] = bboxAsWKT
+		args["bboxCrs"] = opt.BboxCrs
+		args["maxx"] = opt.Bbox.MaxX()
+		args["minx"] = opt.Bbox.MinX()
+		args["maxy"] = opt.Bbox.MaxY()
+		args["miny"] = opt.Bbox.MinY()
+	}
+	return join, intersects + " " + filters, args, nil
+}
+
+// Estimate the number of features in the given feature table without counting. Uses the feature count maintained
+// by GDAL (gpkg_ogr_contents) or otherwise the statistics gathered by ANALYZE (sqlite_stat1). Returns false when
+// neither is available.
+func (g *GeoPackage) estimateFeatureCount(ctx context.Context, table *featureTable) (int, bool, error) {
+	db := g.getDB(table)
+	for _, estimate := range []struct {
+		statsTable string
+		query      string
+	}{
+		{"gpkg_ogr_contents", `select feature_count from gpkg_ogr_contents where table_name = ? and feature_count is not null`},
+		{"sqlite_stat1", `select cast(stat as integer) from sqlite_stat1 where tbl = ? limit 1`}, // first number is the row count
+	} {
+		exists, err := tableExists(db, estimate.statsTable)
+		if err != nil {
+			return 0, false, err
+		}
+		if !exists {
+			continue
+		}
+		var count int
+		err = sqlx.GetContext(ctx, db, &count, estimate.query, table.TableName)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return 0, false, fmt.Errorf("failed to estimate number of features in table '%s', error: %w", table.TableName, err)
+		}
+		return count, true, nil
+	}
+	return 0, false, nil
+}
+
+// fromTableCrs transforms the given extent from the CRS of the feature table to the given CRS (EPSG code),
+// the result is the extent of the transformed extent. A CRS of 0 means the CRS of the feature table.
+func (g *GeoPackage) fromTableCrs(ctx context.Context, table *featureTable, extent geom.Extent, crs int) (*geom.Extent, error) {
+	if crs <= 0 || int64(crs) == table.SRS {
+		return &extent, nil
+	}
+	// assertSupported guarantees spatialite is available
+	return g.transformExtent(ctx, extent, table.SRS, int64(crs))
+}
@@ -0,0 +1,226 @@
+package geopackage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	materializedTempDirName = "gokoala-materialized-"
+	materializedSchema      = "materialized"
+)
+
+// materializedView serves the result of a view (SQL query) from a separate database on local disk, with indexes,
+// see Materialize in config. The view is executed once instead of for each page of features. Like snapshots the
+// view is materialized again in the background when the GeoPackage changes, the previous result is retired so
+// queries on it are allowed to finish.
+type materializedView struct {
+	source       geoPackageBackend
+	table        *featureTable
+	columnTypes  []string // declared type per column of the view
+	indexColumns []string
+	fidColumn    string
+	dir          string
+
+	current     atomic.Pointer[snapshot]
+	retired     retiredSnapshots
+	fingerprint string
+	done        chan struct{}
+}
+
+// Materialize the views of collections for which this is configured, must be called after all
+// feature tables (including views) are read.
+func (g *GeoPackage) materializeViews(collections engine.GeoSpatialCollections) {
+	for _, collection := range collections {
+		if collection.Features == nil || collection.Features.View == nil || collection.Features.View.Materialize == nil {
+			continue
+		}
+		table, ok := g.featureTableByCollectionID[collection.ID]
+		if !ok {
+			continue
+		}
+		view, err := newMaterializedView(g.backend, table, g.fidColumn, collection.Features, collection.Features.View.Materialize)
+		if err != nil {
+			log.Fatalf("failed to materialize view of collection '%s': %v", collection.ID, err)
+		}
+		table.Materialized = view
+	}
+}
+
+func newMaterializedView(source geoPackageBackend, table *featureTable, fidColumn string,
+	features *engine.CollectionEntryFeatures, config *engine.FeatureViewMaterialization) (*materializedView, error) {
+
+	dir := ""
+	if config.Dir != nil {
+		dir = *config.Dir
+	} else {
+		var err error
+		if dir, err = os.MkdirTemp("", materializedTempDirName); err != nil {
+			return nil, fmt.Errorf("failed to create tempdir: %w", err)
+		}
+	}
+	_, columnTypes, err := readViewColumns(table, source.getDB())
+	if err != nil {
+		return nil, err
+	}
+	m := &materializedView{
+		source:       source,
+		table:        table,
+		columnTypes:  columnTypes,
+		indexColumns: materializedIndexColumns(table, features),
+		fidColumn:    fidColumn,
+		dir:          dir,
+		done:         make(chan struct{}),
+	}
+	if _, err = m.refresh(); err != nil {
+		return nil, err
+	}
+	if config.RefreshInterval != nil {
+		go m.refreshPeriodically(*config.RefreshInterval)
+	}
+	return m, nil
+}
+
+func (m *materializedView) getDB() *sqlx.DB {
+	return m.current.Load().db.getDB()
+}
+
+func (m *materializedView) close() {
+	close(m.done)
+	m.current.Load().close()
+	m.retired.closeAll()
+}
+
+func (m *materializedView) refreshPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			if _, err := m.refresh(); err != nil {
+				log.Printf("failed to refresh materialized view '%s', keep serving previous result: %v",
+					m.table.TableName, err)
+			}
+		}
+	}
+}
+
+// refresh materializes the view when the GeoPackage has changed since the previous materialization,
+// returns true when the view was materialized.
+func (m *materializedView) refresh() (bool, error) {
+	fingerprint, err := readFingerprint(m.source.getDB())
+	if err != nil {
+		return false, err
+	}
+	if fingerprint == m.fingerprint {
+		return false, nil
+	}
+	file := filepath.Join(m.dir, fmt.Sprintf("%s-%d.sqlite", m.table.TableName, time.Now().UnixNano()))
+	start := time.Now()
+	if err = m.materialize(file); err != nil {
+		_ = os.Remove(file)
+		return false, err
+	}
+	next := &snapshot{
+		file: file,
+		db:   newLocalGeoPackage(&engine.GeoPackageLocal{File: file}).(*localGeoPackage),
+	}
+	previous := m.current.Swap(next)
+	m.fingerprint = fingerprint
+	log.Printf("materialized view '%s' in %s to %s", m.table.TableName, time.Since(start).Round(time.Millisecond), file)
+	if previous != nil {
+		m.retired.retire(previous, retireGracePeriod)
+	}
+	return true, nil
+}
+
+// materialize executes the query of the view and stores the result in a new database (the given file) together
+// with indexes. The database is attached to a connection of the GeoPackage, so rows are copied by SQLite as-is.
+func (m *materializedView) materialize(file string) error {
+	ctx := context.Background()
+	conn, err := m.source.getDB().Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	target := &url.URL{Path: file}
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf("attach database ? as %s", materializedSchema),
+		"file:"+target.EscapedPath()+"?mode=rwc"); err != nil {
+		return fmt.Errorf("failed to attach %s: %w", file, err)
+	}
+	defer conn.ExecContext(ctx, "detach database "+materializedSchema) //nolint:errcheck // connection is closed anyway
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	for _, statement := range m.statements() {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to execute '%s': %w", statement, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	// gather statistics for the query planner (and estimates of the number of features)
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("analyze %s", materializedSchema))
+	return err
+}
+
+// SQL statements to create and fill the table (named after the view) holding the result of the view.
+// The fid is the primary key, so features are stored in the order in which these are paged.
+func (m *materializedView) statements() []string {
+	name := fmt.Sprintf(`%s."%s"`, materializedSchema, m.table.TableName)
+	columns := make([]string, 0, len(m.table.ColumnNames))
+	for i, column := range m.table.ColumnNames {
+		definition := fmt.Sprintf(`"%s" %s`, column, m.columnTypes[i])
+		if column == m.fidColumn && m.table.TextFid {
+			definition = fmt.Sprintf(`"%s" text primary key`, column)
+		} else if column == m.fidColumn {
+			definition = fmt.Sprintf(`"%s" integer primary key`, column)
+		}
+		columns = append(columns, strings.TrimSpace(definition))
+	}
+	statements := []string{
+		fmt.Sprintf("create table %s (%s)", name, strings.Join(columns, ", ")),
+		fmt.Sprintf("insert into %s select * from (%s)", name, m.table.ViewQuery),
+		fmt.Sprintf(`create index %[1]s."%[2]s_spatial_idx" on "%[2]s" ("%[3]s", minx, maxx, miny, maxy)`,
+			materializedSchema, m.table.TableName, m.fidColumn),
+	}
+	for _, column := range m.indexColumns {
+		statements = append(statements, fmt.Sprintf(`create index %[1]s."%[2]s_%[3]s_idx" on "%[2]s" ("%[3]s")`,
+			materializedSchema, m.table.TableName, column))
+	}
+	return statements
+}
+
+// Columns of the view on which features can be filtered (queryables and temporal properties)
+func materializedIndexColumns(table *featureTable, features *engine.CollectionEntryFeatures) []string {
+	candidates := slices.Clone(features.Queryables)
+	if features.Temporal != nil {
+		candidates = append(candidates, features.Temporal.StartDate, features.Temporal.EndDate)
+	}
+	var result []string
+	for _, column := range candidates {
+		if column != "" && slices.Contains(table.ColumnNames, column) && !slices.Contains(result, column) {
+			result = append(result, column)
+		}
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package geopackage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterializedView(t *testing.T) {
+	registerDriver()
+	// source is a writable copy of the test GeoPackage, so it can be changed to trigger a refresh
+	sourceFile := filepath.Join(t.TempDir(), "addresses.gpkg")
+	content, err := os.ReadFile(pwd + "/testdata/addresses.gpkg")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(sourceFile, content, 0o600))
+	immutable := false
+	source := newLocalGeoPackage(&engine.GeoPackageLocal{File: sourceFile, Immutable: &immutable})
+
+	dir := t.TempDir()
+	interval := time.Hour
+	features := &engine.CollectionEntryFeatures{
+		Queryables: []string{"straatnaam", "nonexisting"},
+		View: &engine.FeatureView{
+			Query: `select l.feature_id, l.geom, l.minx, l.miny, l.maxx, l.maxy, l.straatnaam, count(v.feature_id) as verblijfsobjecten
+                    from ligplaatsen l left join verblijfsobjecten v on v.straatnaam = l.straatnaam
+                    group by l.feature_id`,
+			GeometryColumn: "geom",
+			Materialize:    &engine.FeatureViewMaterialization{Dir: &dir, RefreshInterval: &interval},
+		},
+	}
+	featureTables := make(map[string]*featureTable)
+	require.NoError(t, readViews(engine.GeoSpatialCollections{{ID: "ligplaatsen-met-vbo", Features: features}},
+		source.getDB(), "feature_id", featureTables))
+	table := featureTables["ligplaatsen-met-vbo"]
+	assert.Equal(t, []string{"straatnaam"}, materializedIndexColumns(table, features))
+
+	m, err := newMaterializedView(source, table, "feature_id", features, features.View.Materialize)
+	require.NoError(t, err)
+	table.Materialized = m
+	first := m.current.Load().file
+	assert.FileExists(t, first)
+	assert.Equal(t, `"ligplaatsen-met-vbo"`, table.from())
+
+	var indexes []string
+	require.NoError(t, m.getDB().Select(&indexes, `select name from sqlite_master where type = 'index' order by name`))
+	assert.Equal(t, []string{"ligplaatsen-met-vbo_spatial_idx", "ligplaatsen-met-vbo_straatnaam_idx"}, indexes)
+
+	g := &GeoPackage{
+		backend:                    source,
+		fidColumn:                  "feature_id",
+		featureTableByCollectionID: featureTables,
+		queryTimeout:               5 * time.Second,
+	}
+	fc, cursors, err := g.GetFeatures(context.Background(), "ligplaatsen-met-vbo", datasources.FeatureOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 10, fc.NumberReturned)
+	assert.True(t, cursors.HasNext)
+
+	fc, _, err = g.GetFeatures(context.Background(), "ligplaatsen-met-vbo", datasources.FeatureOptions{
+		Limit:           10,
+		Bbox:            &geom.Extent{120900, 488800, 121100, 489000},
+		PropertyFilters: map[string][]string{"straatnaam": {"Realengracht"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 6, fc.NumberReturned)
+
+	feature, err := g.GetFeature(context.Background(), "ligplaatsen-met-vbo", domain.NewFeatureID(4180), datasources.OutputOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Realengracht", feature.Properties["straatnaam"])
+
+	count, err := g.GetFeatureCount(context.Background(), "ligplaatsen-met-vbo", datasources.FeatureOptions{}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 67, count) // estimated from statistics of the materialized view
+
+	// unchanged source, keep materialized view
+	refreshed, err := m.refresh()
+	require.NoError(t, err)
+	assert.False(t, refreshed)
+
+	// changed source, view is materialized again
+	writer, err := sqlx.Open(sqliteDriverName, sourceFile)
+	require.NoError(t, err)
+	_, err = writer.Exec("delete from ligplaatsen where straatnaam = 'Realengracht'")
+	require.NoError(t, err)
+	_, err = writer.Exec("update gpkg_contents set last_change = '2030-01-01T00:00:00.000Z'")
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	refreshed, err = m.refresh()
+	require.NoError(t, err)
+	assert.True(t, refreshed)
+	assert.FileExists(t, first) // retired, still available to queries in progress
+	fc, _, err = g.GetFeatures(context.Background(), "ligplaatsen-met-vbo", datasources.FeatureOptions{
+		Limit:           10,
+		PropertyFilters: map[string][]string{"straatnaam": {"Realengracht"}},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, fc) // no results
+
+	m.close()
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,127 @@
+package geopackage
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// initial size of the search window for nearest features, as fraction of the extent of the feature table
+	nearestInitialWindowFraction = 1000
+)
+
+// Nearest neighbor (KNN) query. We first determine a search window around the given point which
+// contains at least 'limit' features using the rtree, see nearestSearchRadius. Next the features in
+// this window are ordered by distance. The window is enlarged by √2 since features just outside the
+// (square) window can be closer to the point than the features in the corners of the window.
+//
+// With spatialite the exact distance to the geometry is used, otherwise the distance to the bbox of
+// the geometry (which is exact for points). Results are ordered by distance, so no pagination.
+func (g *GeoPackage) makeNearestQuery(ctx context.Context, table *featureTable, opt datasources.FeatureOptions,
+	propertyFilters string, propertyFilterArgs map[string]any) (string, map[string]any, error) {
+
+	x, y, err := g.toTableCrs(ctx, table, opt.Nearest.X(), opt.Nearest.Y(), opt.NearestCrs)
+	if err != nil {
+		return "", nil, err
+	}
+	radius, err := g.nearestSearchRadius(ctx, table, x, y, opt.Limit, propertyFilters, propertyFilterArgs)
+	if err != nil {
+		return "", nil, err
+	}
+
+	distance := `max(f.minx - :x, 0, :x - f.maxx) * max(f.minx - :x, 0, :x - f.maxx) +
+                      max(f.miny - :y, 0, :y - f.maxy) * max(f.miny - :y, 0, :y - f.maxy)`
+	if g.spatialite {
+		distance = fmt.Sprintf("st_distance(castautomagic(f.%s), makepoint(:x, :y, :srs))", table.GeometryColumnName)
+	}
+	nearestQuery := fmt.Sprintf(`
+select %[4]s from (
+    select f.*, 0 as prevfid, 0 as nextfid
+    from rtree_%[1]s_%[3]s rf join %[1]s f on f.%[2]s = rf.id
+    where rf.minx <= :x + :radius and rf.maxx >= :x - :radius and rf.miny <= :y + :radius and rf.maxy >= :y - :radius
+      %[6]s
+    order by %[5]s
+    limit :limit) f
+`, table.TableName, g.fidColumn, table.GeometryColumnName, g.selectColumns(table, opt.OutputOptions, "prevfid", "nextfid"),
+		distance, propertyFilters)
+
+	return nearestQuery, map[string]any{
+		"x":      x,
+		"y":      y,
+		"srs":    table.SRS,
+		"radius": radius * math.Sqrt2,
+		"limit":  opt.Limit,
+		"crs":    opt.Crs,
+	}, nil
+}
+
+// nearestSearchRadius returns the (half) size of a square window around the given point containing at least k
+// features. Starting with a small window, the window is doubled until it contains enough features or covers
+// the whole extent of the feature table. Only the rtree is used here, so this is cheap.
+func (g *GeoPackage) nearestSearchRadius(ctx context.Context, table *featureTable, x float64, y float64, k int,
+	propertyFilters string, propertyFilterArgs map[string]any) (float64, error) {
+
+	// beyond this radius the window covers the whole extent of the feature table
+	maxRadius := math.Max(
+		math.Max(math.Abs(x-table.MinX), math.Abs(x-table.MaxX)),
+		math.Max(math.Abs(y-table.MinY), math.Abs(y-table.MaxY)))
+	radius := math.Max(table.MaxX-table.MinX, table.MaxY-table.MinY) / nearestInitialWindowFraction
+	if radius <= 0 || radius >= maxRadius {
+		return maxRadius, nil
+	}
+
+	countQuery := fmt.Sprintf(`
+select count(*) from (
+    select rf.id
+    from rtree_%[1]s_%[3]s rf join %[1]s f on f.%[2]s = rf.id
+    where rf.minx <= :x + :radius and rf.maxx >= :x - :radius and rf.miny <= :y + :radius and rf.maxy >= :y - :radius
+      %[4]s
+    limit :limit)
+`, table.TableName, g.fidColumn, table.GeometryColumnName, propertyFilters)
+
+	stmt, err := g.backend.getDB().PrepareNamedContext(ctx, countQuery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare query '%s' error: %w", countQuery, err)
+	}
+	defer stmt.Close()
+
+	args := map[string]any{"x": x, "y": y, "limit": k}
+	for name, value := range propertyFilterArgs {
+		args[name] = value
+	}
+	for ; radius < maxRadius; radius *= 2 {
+		args["radius"] = radius
+		var count int
+		if err = stmt.GetContext(ctx, &count, args); err != nil {
+			return 0, fmt.Errorf("failed to execute query '%s' error: %w", countQuery, err)
+		}
+		if count >= k {
+			return radius, nil
+		}
+	}
+	return maxRadius, nil
+}
+
+// toTableCrs transforms the given coordinate to the CRS of the feature table
+func (g *GeoPackage) toTableCrs(ctx context.Context, table *featureTable, x float64, y float64, crs int) (float64, float64, error) {
+	if crs <= 0 || int64(crs) == table.SRS {
+		return x, y, nil
+	}
+	if !g.spatialite {
+		return 0, 0, &datasources.NotSupportedError{Message: fmt.Sprintf("nearest-crs EPSG:%d differs from the CRS "+
+			"of the features (EPSG:%d), transformation requires spatialite, which isn't available", crs, table.SRS)}
+	}
+	var result struct {
+		X float64 `db:"x"`
+		Y float64 `db:"y"`
+	}
+	query := `select st_x(p) as x, st_y(p) as y from (select st_transform(makepoint(?, ?, ?), ?) as p)`
+	if err := sqlx.GetContext(ctx, g.backend.getDB(), &result, query, x, y, crs, table.SRS); err != nil {
+		return 0, 0, fmt.Errorf("failed to transform coordinate from EPSG:%d to EPSG:%d, error: %w", crs, table.SRS, err)
+	}
+	return result.X, result.Y, nil
+}
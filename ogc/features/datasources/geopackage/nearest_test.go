@@ -0,0 +1,91 @@
+package geopackage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/go-spatial/geom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoPackage_GetFeatures_Nearest(t *testing.T) {
+	g := NewGeoPackage(nil, engine.GeoPackage{
+		Local: &engine.GeoPackageLocal{
+			GeoPackageCommon: engine.GeoPackageCommon{Fid: "feature_id"},
+			File:             pwd + "/testdata/addresses.gpkg",
+		},
+	})
+
+	tests := []struct {
+		name          string
+		options       datasources.FeatureOptions
+		wantNumber    int
+		wantNummerIDs []string // in order of distance, only the first features are compared
+	}{
+		{
+			name:          "nearest feature",
+			options:       datasources.FeatureOptions{Nearest: &geom.Point{121108.424, 488930.925}, NearestCrs: 28992, Limit: 1},
+			wantNumber:    1,
+			wantNummerIDs: []string{"0363200000398886"},
+		},
+		{
+			name:          "k nearest features ordered by distance",
+			options:       datasources.FeatureOptions{Nearest: &geom.Point{121100, 488900}, NearestCrs: 28992, Limit: 4},
+			wantNumber:    4,
+			wantNummerIDs: []string{"0363200000428648", "0363200000428649", "0363200000428647", "0363200000398888"},
+		},
+		{
+			name:          "point outside extent of collection",
+			options:       datasources.FeatureOptions{Nearest: &geom.Point{120000, 480000}, NearestCrs: 28992, Limit: 3},
+			wantNumber:    3,
+			wantNummerIDs: []string{"0363200000428646", "0363200000428647", "0363200000517234"},
+		},
+		{
+			name: "nearest combined with property filter",
+			options: datasources.FeatureOptions{Nearest: &geom.Point{121100, 488900}, NearestCrs: 28992, Limit: 2,
+				PropertyFilters: map[string][]string{"straatnaam": {"Westerdok"}}},
+			wantNumber:    2,
+			wantNummerIDs: []string{"0363200000517236", "0363200000517237"},
+		},
+		{
+			name:          "more features requested than available",
+			options:       datasources.FeatureOptions{Nearest: &geom.Point{121100, 488900}, NearestCrs: 28992, Limit: 100},
+			wantNumber:    67, // all features in table
+			wantNummerIDs: []string{"0363200000428648", "0363200000428649"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, cursors, err := g.GetFeatures(context.Background(), "ligplaatsen", tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNumber, fc.NumberReturned)
+			for i, nummerID := range tt.wantNummerIDs {
+				assert.Equal(t, nummerID, fc.Features[i].Properties["nummer_id"])
+			}
+			assert.False(t, cursors.HasPrev)
+			assert.False(t, cursors.HasNext)
+		})
+	}
+}
+
+func TestGeoPackage_GetFeatures_NearestRequiresSpatialiteForTransformation(t *testing.T) {
+	g := NewGeoPackage(nil, engine.GeoPackage{
+		Local: &engine.GeoPackageLocal{
+			GeoPackageCommon: engine.GeoPackageCommon{Fid: "feature_id"},
+			File:             pwd + "/testdata/addresses.gpkg",
+		},
+	})
+	if g.spatialite {
+		t.Skip("spatialite is available")
+	}
+	_, _, err := g.GetFeatures(context.Background(), "ligplaatsen", datasources.FeatureOptions{
+		Nearest: &geom.Point{4.88, 52.38}, NearestCrs: 4326, Limit: 1})
+
+	// not supported is a client error (400), the request succeeds with a nearest-crs equal to the CRS of the features
+	var notSupported *datasources.NotSupportedError
+	require.ErrorAs(t, err, &notSupported)
+	assert.Contains(t, notSupported.Message, "requires spatialite")
+}
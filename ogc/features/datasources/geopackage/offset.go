@@ -0,0 +1,44 @@
+package geopackage
+
+import (
+	"fmt"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+// Select a page of features by offset (offset-based pagination) instead of by feature id (cursor-based pagination).
+// One feature more than the limit is selected to determine whether there's a next page, see trimOffsetPage.
+func (g *GeoPackage) makeOffsetQuery(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+	if opt.Nearest != nil || opt.Search != "" {
+		return "", nil, fmt.Errorf("offset-based pagination isn't supported for nearest or search queries")
+	}
+	join, predicates, args, err := g.makeMatchClauses(table, opt)
+	if err != nil {
+		return "", nil, err
+	}
+	columns := g.selectColumns(table, opt.OutputOptions)
+	if columns == "*" {
+		columns = "f.*" // exclude columns of the rtree
+	}
+	offsetQuery := fmt.Sprintf(`
+select %[1]s
+from %[2]s f %[3]s
+where 1 = 1 %[4]s
+order by f.%[5]s asc
+limit :limit + 1 offset :offset
+`, columns, table.from(), join, predicates, g.fidColumn)
+
+	args["limit"] = opt.Limit
+	args["offset"] = *opt.Offset
+	args["crs"] = opt.Crs
+	return offsetQuery, args, nil
+}
+
+// trimOffsetPage removes the extra feature selected by makeOffsetQuery, returns whether there's a next page
+func trimOffsetPage(features []*domain.Feature, limit int) ([]*domain.Feature, bool) {
+	if len(features) > limit {
+		return features[:limit], true
+	}
+	return features, false
+}
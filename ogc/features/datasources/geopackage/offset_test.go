@@ -0,0 +1,89 @@
+package geopackage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoPackage_GetFeatures_Offset(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+		queryTimeout: 5 * time.Second,
+	}
+	realengracht := map[string][]string{"straatnaam": {"Realengracht"}}
+	tests := []struct {
+		name        string
+		options     datasources.FeatureOptions
+		wantFids    []int64
+		wantCursors domain.Cursors
+		wantErr     string
+	}{
+		{
+			name:        "first page",
+			options:     datasources.FeatureOptions{Limit: 5, Offset: ptrTo(0), PropertyFilters: realengracht},
+			wantFids:    []int64{3837, 3838, 3839, 3840, 3841},
+			wantCursors: domain.Cursors{Prev: "0", Next: "5", HasPrev: false, HasNext: true},
+		},
+		{
+			name:        "last page",
+			options:     datasources.FeatureOptions{Limit: 5, Offset: ptrTo(5), PropertyFilters: realengracht},
+			wantFids:    []int64{3842, 4180},
+			wantCursors: domain.Cursors{Prev: "0", Next: "10", HasPrev: true, HasNext: false},
+		},
+		{
+			name:        "page in between",
+			options:     datasources.FeatureOptions{Limit: 2, Offset: ptrTo(3), PropertyFilters: realengracht},
+			wantFids:    []int64{3840, 3841},
+			wantCursors: domain.Cursors{Prev: "1", Next: "5", HasPrev: true, HasNext: true},
+		},
+		{
+			name:     "beyond last page",
+			options:  datasources.FeatureOptions{Limit: 5, Offset: ptrTo(10), PropertyFilters: realengracht},
+			wantFids: nil,
+		},
+		{
+			name: "with bbox",
+			options: datasources.FeatureOptions{Limit: 4, Offset: ptrTo(4),
+				Bbox: &geom.Extent{120900, 488800, 121100, 489000}, BboxCrs: 28992},
+			wantFids:    []int64{3842, 4028, 4029, 4180},
+			wantCursors: domain.Cursors{Prev: "0", Next: "8", HasPrev: true, HasNext: false},
+		},
+		{
+			name:    "fail on search",
+			options: datasources.FeatureOptions{Limit: 5, Offset: ptrTo(0), Search: "Realengracht"},
+			wantErr: "isn't supported for nearest or search queries",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, cursors, err := g.GetFeatures(context.Background(), "ligplaatsen", tt.options)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.wantFids == nil {
+				assert.Nil(t, fc)
+				return
+			}
+			assert.Len(t, fc.Features, len(tt.wantFids))
+			for i, feature := range fc.Features {
+				assert.Equal(t, domain.NewFeatureID(tt.wantFids[i]), feature.ID)
+			}
+			assert.Equal(t, tt.wantCursors, cursors)
+		})
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
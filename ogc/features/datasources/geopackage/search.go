@@ -0,0 +1,159 @@
+package geopackage
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/go-spatial/geom/encoding/wkt"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// suffix of the SQLite FTS5 table holding the full-text index of a feature table
+	searchIndexSuffix = "_fts"
+)
+
+// prepareSearchIndexes verifies that a full-text index exists for each collection with search enabled,
+// or creates it when configured to do so. Returns true when one or more indexes are created.
+func (g *GeoPackage) prepareSearchIndexes(collections engine.GeoSpatialCollections, gpkgConfig engine.GeoPackage) bool {
+	created := false
+	for _, collection := range collections {
+		table, ok := g.featureTableByCollectionID[collection.ID]
+		if !ok || collection.Features == nil || collection.Features.Search == nil {
+			continue
+		}
+		search := collection.Features.Search
+		assertSearchFieldsExist(collection.ID, table, search.Fields)
+		assertSearchFieldsExist(collection.ID, table, search.GetDisplayFields())
+
+		table.SearchIndex = table.TableName + searchIndexSuffix
+		exists, err := tableExists(g.backend.getDB(), table.SearchIndex)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if exists {
+			continue
+		}
+		if !search.CreateIndex || gpkgConfig.Local == nil {
+			log.Fatalf("full-text index '%s' of collection '%s' doesn't exist, add it to the GeoPackage "+
+				"or enable 'createIndex' (local GeoPackage only)", table.SearchIndex, collection.ID)
+		}
+		log.Printf("creating full-text index '%s' of collection '%s'", table.SearchIndex, collection.ID)
+		if err = createSearchIndex(gpkgConfig.Local, table, g.fidColumn, search.Fields); err != nil {
+			log.Fatalf("failed to create full-text index '%s': %v", table.SearchIndex, err)
+		}
+		created = true
+	}
+	return created
+}
+
+func assertSearchFieldsExist(collectionID string, table *featureTable, fields []string) {
+	for _, field := range fields {
+		if !slices.Contains(table.ColumnNames, field) {
+			log.Fatalf("search field '%s' of collection '%s' doesn't exist in table '%s'",
+				field, collectionID, table.TableName)
+		}
+	}
+}
+
+func tableExists(db *sqlx.DB, table string) (bool, error) {
+	var count int
+	err := db.Get(&count, `select count(*) from sqlite_master where type = 'table' and name = ?`, table)
+	if err != nil {
+		return false, fmt.Errorf("failed to check existence of table '%s', error: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// createSearchIndex creates a SQLite FTS5 index on the given fields of a feature table, see
+// https://www.sqlite.org/fts5.html. This is an 'external content' table, so only the index is
+// stored and not a copy of the content. Since GoKoala never modifies features the index is
+// only built on creation, drop the FTS5 table in order to rebuild it.
+func createSearchIndex(gpkg *engine.GeoPackageLocal, table *featureTable, fidColumn string, fields []string) error {
+	file := &url.URL{Path: gpkg.File}
+	db, err := sqlx.Open(sqliteDriverName, "file:"+file.EscapedPath()+"?mode=rw")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, fmt.Sprintf(`"%s"`, field))
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	// unicode61 with remove_diacritics makes search case- and accent-insensitive
+	create := fmt.Sprintf(`create virtual table "%[1]s" using fts5(%[2]s, content='%[3]s', content_rowid='%[4]s',
+tokenize='unicode61 remove_diacritics 2')`, table.SearchIndex, strings.Join(columns, ", "), table.TableName, fidColumn)
+	if _, err = tx.Exec(create); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(fmt.Sprintf(`insert into "%[1]s"("%[1]s") values('rebuild')`, table.SearchIndex)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Full-text search query. Results are ordered by relevance (bm25 rank) instead of feature id, so
+// cursor-based pagination isn't possible: only the best matches (up to the limit) are returned.
+func (g *GeoPackage) makeSearchQuery(table *featureTable, opt datasources.FeatureOptions, propertyFilters string) (string, map[string]any, error) {
+	if table.SearchIndex == "" {
+		return "", nil, fmt.Errorf("full-text search isn't enabled for table '%s'", table.TableName)
+	}
+	args := map[string]any{
+		"search": toSearchQuery(opt.Search, opt.SearchPrefix),
+		"limit":  opt.Limit,
+		"crs":    opt.Crs,
+	}
+	bboxFilter := ""
+	if opt.Bbox != nil {
+		bboxFilter = "and f.minx <= :maxx and f.maxx >= :minx and f.miny <= :maxy and f.maxy >= :miny " +
+			g.makeIntersectsPredicate(table)
+		bboxAsWKT, err := wkt.EncodeString(opt.Bbox)
+		if err != nil {
+			return "", nil, err
+		}
+		args["bboxWkt"] = bboxAsWKT
+		args["bboxCrs"] = opt.BboxCrs
+		args["maxx"] = opt.Bbox.MaxX()
+		args["minx"] = opt.Bbox.MinX()
+		args["maxy"] = opt.Bbox.MaxY()
+		args["miny"] = opt.Bbox.MinY()
+	}
+
+	searchQuery := fmt.Sprintf(`
+select %[4]s from (
+    select f.*, 0 as prevfid, 0 as nextfid
+    from "%[3]s" s join %[1]s f on f.%[2]s = s.rowid
+    where "%[3]s" match :search %[5]s %[6]s
+    order by s.rank
+    limit :limit) f
+`, table.TableName, g.fidColumn, table.SearchIndex, g.selectColumns(table, opt.OutputOptions, "prevfid", "nextfid"),
+		bboxFilter, propertyFilters)
+
+	return searchQuery, args, nil
+}
+
+// toSearchQuery turns user input into an FTS5 query in which all terms should match. Each
+// term is quoted, so FTS5 syntax in the input (operators, column filters, etc.) is treated as text.
+// With prefix the last term is matched as prefix, since that's the term the user is still typing.
+func toSearchQuery(input string, prefix bool) string {
+	terms := strings.Fields(input)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if prefix && len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
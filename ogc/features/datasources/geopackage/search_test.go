@@ -0,0 +1,157 @@
+package geopackage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSearchableGeoPackage opens a copy of the test GeoPackage, since the full-text index is created in the GeoPackage
+func newSearchableGeoPackage(t *testing.T) *GeoPackage {
+	registerDriver()
+	db, err := sqlx.Open(sqliteDriverName, ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	if _, err = db.Exec(`create virtual table temp.fts5_check using fts5(text)`); err != nil {
+		// fail instead of skip, otherwise search silently goes untested
+		t.Fatalf("sqlite driver is compiled without FTS5 support, run tests with build tag 'sqlite_fts5': %v", err)
+	}
+
+	content, err := os.ReadFile(pwd + "/testdata/addresses.gpkg")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "addresses.gpkg")
+	require.NoError(t, os.WriteFile(file, content, 0o600))
+
+	immutable := false
+	return NewGeoPackage(engine.GeoSpatialCollections{
+		{
+			ID: "ligplaatsen",
+			Features: &engine.CollectionEntryFeatures{
+				Search: &engine.FeatureSearch{
+					Fields:      []string{"straatnaam", "huisnummer", "postcode"},
+					CreateIndex: true,
+				},
+			},
+		},
+	}, engine.GeoPackage{
+		Local: &engine.GeoPackageLocal{
+			GeoPackageCommon: engine.GeoPackageCommon{Fid: "feature_id"},
+			File:             file,
+			Immutable:        &immutable,
+		},
+	})
+}
+
+func TestGeoPackage_GetFeatures_Search(t *testing.T) {
+	g := newSearchableGeoPackage(t)
+
+	tests := []struct {
+		name          string
+		options       datasources.FeatureOptions
+		wantNummerIDs []string
+	}{
+		{
+			name:          "search on street name and house number",
+			options:       datasources.FeatureOptions{Search: "realengracht 9", Limit: 10},
+			wantNummerIDs: []string{"0363200000398886"},
+		},
+		{
+			name:    "search is case- and accent-insensitive",
+			options: datasources.FeatureOptions{Search: "RÉALENGRACHT 1013kw", Limit: 10},
+			wantNummerIDs: []string{"0363200000398886", "0363200000398887", "0363200000398888", "0363200000398889",
+				"0363200000398890", "0363200000398891", "0363200000445532"},
+		},
+		{
+			name: "search combined with property filter",
+			options: datasources.FeatureOptions{Search: "23", Limit: 10,
+				PropertyFilters: map[string][]string{"straatnaam": {"Zandhoek"}}},
+			wantNummerIDs: []string{"0363200012111723"},
+		},
+		{
+			name: "search combined with bbox",
+			options: datasources.FeatureOptions{Search: "23", Limit: 10,
+				Bbox: &geom.Extent{120900, 488900, 121100, 489000}, BboxCrs: 28992},
+			wantNummerIDs: []string{"0363200000398891"},
+		},
+		{
+			name:          "search with prefix matching of last term",
+			options:       datasources.FeatureOptions{Search: "zandhoek 2", SearchPrefix: true, Limit: 10},
+			wantNummerIDs: []string{"0363200012111723", "0363200012111724"},
+		},
+		{
+			name: "search with selection of properties",
+			options: datasources.FeatureOptions{Search: "zandhoek", Limit: 10,
+				OutputOptions: datasources.OutputOptions{Properties: []string{"nummer_id"}}},
+			wantNummerIDs: []string{"0363200012111723", "0363200012111724"},
+		},
+		{
+			name:          "search syntax in input is treated as text",
+			options:       datasources.FeatureOptions{Search: `realengracht OR "zandhoek`, Limit: 10},
+			wantNummerIDs: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, cursors, err := g.GetFeatures(context.Background(), "ligplaatsen", tt.options)
+			require.NoError(t, err)
+			if tt.wantNummerIDs == nil {
+				assert.Nil(t, fc)
+				return
+			}
+			nummerIDs := make([]string, 0, len(fc.Features))
+			for _, feature := range fc.Features {
+				nummerIDs = append(nummerIDs, feature.Properties["nummer_id"].(string))
+			}
+			assert.ElementsMatch(t, tt.wantNummerIDs, nummerIDs)
+			assert.Equal(t, len(tt.wantNummerIDs), fc.NumberReturned)
+			assert.False(t, cursors.HasPrev)
+			assert.False(t, cursors.HasNext)
+		})
+	}
+}
+
+func TestGeoPackage_GetFeatures_SearchNotEnabled(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen",
+			GeometryColumnName: "geom"}},
+		queryTimeout: 5 * time.Second,
+	}
+	_, _, err := g.GetFeatures(context.Background(), "ligplaatsen", datasources.FeatureOptions{
+		Cursor: domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}},
+		Limit:  10,
+		Search: "realengracht",
+	})
+	assert.ErrorContains(t, err, "full-text search isn't enabled")
+}
+
+func TestToSearchQuery(t *testing.T) {
+	tests := []struct {
+		input  string
+		prefix bool
+		want   string
+	}{
+		{input: "damrak", want: `"damrak"`},
+		{input: "  damrak   1  amsterdam ", want: `"damrak" "1" "amsterdam"`},
+		{input: `NEAR(a b) OR "c`, want: `"NEAR(a" "b)" "OR" """c"`},
+		{input: "", want: ""},
+		{input: "damrak 1 amst", prefix: true, want: `"damrak" "1" "amst"*`},
+		{input: " ", prefix: true, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.want, toSearchQuery(tt.input, tt.prefix))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package geopackage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/go-spatial/geom"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQL function registered with the sqlite driver, see intersects
+const intersectsFunction = "gokoala_intersects"
+
+// intersects whether the given GeoPackage geometry intersects the given extent. Registered as SQL function so
+// the exact intersection test is part of the features query when spatialite (st_intersects) isn't available.
+func intersects(rawGeom []byte, minX float64, minY float64, maxX float64, maxY float64) bool {
+	geometry, err := readGpkgGeometry(rawGeom)
+	if err != nil || geometry == nil {
+		return false
+	}
+	return intersectsExtent(geometry, &geom.Extent{minX, minY, maxX, maxY})
+}
+
+// Build predicate (prefixed with 'and') to test whether the geometry of a feature intersects the given bbox, which
+// complements the prefilter on the bbox of features (rtree/btree). Uses named params bboxWkt, bboxCrs, minx, etc.
+func (g *GeoPackage) makeIntersectsPredicate(table *featureTable) string {
+	if g.spatialite {
+		return fmt.Sprintf("and st_intersects(geomfromtext(:bboxWkt, :bboxCrs), castautomagic(f.%s)) = 1",
+			table.GeometryColumnName)
+	}
+	return fmt.Sprintf("and %s(f.%s, :minx, :miny, :maxx, :maxy) = 1", intersectsFunction, table.GeometryColumnName)
+}
+
+// toTableBbox transforms the bbox in the given options to the CRS of the feature table, since both
+// the prefilter (rtree/btree) and the intersection test compare the bbox with the geometries as stored.
+// The bbox is replaced by the extent of the transformed bbox. Tables with an undefined CRS (<= 0) aren't transformed.
+func (g *GeoPackage) toTableBbox(ctx context.Context, table *featureTable, opt datasources.FeatureOptions) (datasources.FeatureOptions, error) {
+	if opt.Bbox == nil || opt.BboxCrs <= 0 || table.SRS <= 0 || int64(opt.BboxCrs) == table.SRS {
+		return opt, nil
+	}
+	if !g.spatialite {
+		return opt, &datasources.NotSupportedError{Message: fmt.Sprintf(
+			"bbox-crs EPSG:%d differs from the CRS of the features (EPSG:%d), transformation requires "+
+				"spatialite, which isn't available", opt.BboxCrs, table.SRS)}
+	}
+	bbox, err := g.transformExtent(ctx, *opt.Bbox, int64(opt.BboxCrs), table.SRS)
+	if err != nil {
+		return opt, err
+	}
+	opt.Bbox, opt.BboxCrs = bbox, int(table.SRS)
+	return opt, nil
+}
+
+// transformExtent transforms the given extent (requires spatialite), the result is the extent of the transformed extent
+func (g *GeoPackage) transformExtent(ctx context.Context, extent geom.Extent, fromCrs int64, toCrs int64) (*geom.Extent, error) {
+	var result struct {
+		MinX float64 `db:"minx"`
+		MinY float64 `db:"miny"`
+		MaxX float64 `db:"maxx"`
+		MaxY float64 `db:"maxy"`
+	}
+	query := `select mbrminx(e) as minx, mbrminy(e) as miny, mbrmaxx(e) as maxx, mbrmaxy(e) as maxy
+              from (select st_transform(buildmbr(?, ?, ?, ?, ?), ?) as e)`
+	if err := sqlx.GetContext(ctx, g.backend.getDB(), &result, query,
+		extent.MinX(), extent.MinY(), extent.MaxX(), extent.MaxY(), fromCrs, toCrs); err != nil {
+		return nil, fmt.Errorf("failed to transform extent from EPSG:%d to EPSG:%d, error: %w", fromCrs, toCrs, err)
+	}
+	return &geom.Extent{result.MinX, result.MinY, result.MaxX, result.MaxY}, nil
+}
+
+// intersectsExtent planar intersection test of a geometry and an extent (rectangle)
+func intersectsExtent(g geom.Geometry, extent *geom.Extent) bool {
+	switch t := g.(type) {
+	case geom.Point:
+		return extent.ContainsPoint(t)
+	case geom.MultiPoint:
+		for _, p := range t {
+			if extent.ContainsPoint(p) {
+				return true
+			}
+		}
+	case geom.LineString:
+		return lineIntersectsExtent(t, extent)
+	case geom.MultiLineString:
+		for _, l := range t {
+			if lineIntersectsExtent(l, extent) {
+				return true
+			}
+		}
+	case geom.Polygon:
+		return polygonIntersectsExtent(t, extent)
+	case geom.MultiPolygon:
+		for _, p := range t {
+			if polygonIntersectsExtent(p, extent) {
+				return true
+			}
+		}
+	case geom.Collection:
+		for _, c := range t {
+			if intersectsExtent(c, extent) {
+				return true
+			}
+		}
+	default:
+		// unknown geometry type, fall back to comparing extents
+		geomExtent, err := geom.NewExtentFromGeometry(g)
+		if err != nil || geomExtent == nil {
+			return false
+		}
+		_, ok := extent.Intersect(geomExtent)
+		return ok
+	}
+	return false
+}
+
+func lineIntersectsExtent(line [][2]float64, extent *geom.Extent) bool {
+	if len(line) == 1 {
+		return extent.ContainsPoint(line[0])
+	}
+	for i := 0; i < len(line)-1; i++ {
+		if segmentIntersectsExtent(line[i], line[i+1], extent) {
+			return true
+		}
+	}
+	return false
+}
+
+func polygonIntersectsExtent(polygon [][][2]float64, extent *geom.Extent) bool {
+	if len(polygon) == 0 {
+		return false
+	}
+	// boundary of the polygon crosses or lies within the extent
+	for _, ring := range polygon {
+		if len(ring) == 0 {
+			continue
+		}
+		closedRing := append(ring[:len(ring):len(ring)], ring[0])
+		if lineIntersectsExtent(closedRing, extent) {
+			return true
+		}
+	}
+	// otherwise the extent lies either completely inside or completely outside the polygon
+	corner := [2]float64{extent.MinX(), extent.MinY()}
+	if !ringContainsPoint(polygon[0], corner) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if ringContainsPoint(hole, corner) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentIntersectsExtent clips the segment to the extent (Liang-Barsky), when
+// something remains after clipping the segment intersects the extent
+func segmentIntersectsExtent(p1, p2 [2]float64, extent *geom.Extent) bool {
+	dx, dy := p2[0]-p1[0], p2[1]-p1[1]
+	t0, t1 := 0.0, 1.0
+	clip := func(p, q float64) bool {
+		if p == 0 {
+			return q >= 0 // parallel to this edge, intersects only when inside
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return false
+			}
+			if r > t0 {
+				t0 = r
+			}
+		} else {
+			if r < t0 {
+				return false
+			}
+			if r < t1 {
+				t1 = r
+			}
+		}
+		return true
+	}
+	return clip(-dx, p1[0]-extent.MinX()) && clip(dx, extent.MaxX()-p1[0]) &&
+		clip(-dy, p1[1]-extent.MinY()) && clip(dy, extent.MaxY()-p1[1])
+}
+
+// ringContainsPoint point-in-polygon test using ray casting
+func ringContainsPoint(ring [][2]float64, pt [2]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		if (ring[i][1] > pt[1]) != (ring[j][1] > pt[1]) &&
+			pt[0] < (ring[j][0]-ring[i][0])*(pt[1]-ring[i][1])/(ring[j][1]-ring[i][1])+ring[i][0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,98 @@
+package geopackage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntersectsExtent(t *testing.T) {
+	extent := &geom.Extent{10, 10, 20, 20}
+	square := func(minX, minY, maxX, maxY float64) [][2]float64 {
+		return [][2]float64{{minX, minY}, {maxX, minY}, {maxX, maxY}, {minX, maxY}, {minX, minY}}
+	}
+
+	tests := []struct {
+		name     string
+		geometry geom.Geometry
+		want     bool
+	}{
+		{name: "point inside", geometry: geom.Point{15, 15}, want: true},
+		{name: "point on boundary", geometry: geom.Point{10, 15}, want: true},
+		{name: "point outside", geometry: geom.Point{25, 15}, want: false},
+		{name: "multipoint with one point inside", geometry: geom.MultiPoint{{0, 0}, {15, 15}}, want: true},
+		{name: "line crossing extent", geometry: geom.LineString{{0, 15}, {30, 15}}, want: true},
+		{name: "line inside extent", geometry: geom.LineString{{12, 12}, {18, 18}}, want: true},
+		{name: "diagonal line passing corner", geometry: geom.LineString{{0, 25}, {25, 0}}, want: true},
+		{name: "diagonal line missing corner", geometry: geom.LineString{{0, 19}, {9, 30}}, want: false},
+		{name: "polygon overlapping extent", geometry: geom.Polygon{square(15, 15, 25, 25)}, want: true},
+		{name: "polygon containing extent", geometry: geom.Polygon{square(0, 0, 30, 30)}, want: true},
+		{name: "extent in hole of polygon", geometry: geom.Polygon{square(0, 0, 30, 30), square(5, 5, 25, 25)}, want: false},
+		{name: "polygon outside extent", geometry: geom.Polygon{square(30, 30, 40, 40)}, want: false},
+		{name: "L-shaped polygon around extent",
+			geometry: geom.Polygon{{{0, 0}, {30, 0}, {30, 5}, {5, 5}, {5, 30}, {0, 30}, {0, 0}}}, want: false},
+		{name: "multipolygon", geometry: geom.MultiPolygon{{square(30, 30, 40, 40)}, {square(11, 11, 12, 12)}}, want: true},
+		{name: "collection", geometry: geom.Collection{geom.Point{0, 0}, geom.LineString{{15, 0}, {15, 30}}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, intersectsExtent(tt.geometry, extent))
+		})
+	}
+}
+
+func TestGeoPackage_GetFeatures_Bbox(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}, SRS: 28992}},
+		queryTimeout: 5 * time.Second,
+	}
+	bbox := &geom.Extent{120900, 488800, 121100, 489000}
+	count, err := g.GetFeatureCount(context.Background(), "ligplaatsen", datasources.FeatureOptions{Bbox: bbox, BboxCrs: 28992}, false)
+	require.NoError(t, err)
+	require.Greater(t, count, 3)
+
+	// the intersection test is part of the query, so pages are full and paging returns every matching feature
+	var features []*domain.Feature
+	cursor := domain.DecodedCursor{FID: domain.NewFeatureID(0), FiltersChecksum: []byte{}}
+	for {
+		fc, cursors, err := g.GetFeatures(context.Background(), "ligplaatsen",
+			datasources.FeatureOptions{Cursor: cursor, Limit: 3, Bbox: bbox, BboxCrs: 28992})
+		require.NoError(t, err)
+		require.NotNil(t, fc)
+		for _, feature := range fc.Features {
+			assert.True(t, intersectsExtent(feature.Geometry.Geometry, bbox))
+		}
+		features = append(features, fc.Features...)
+		if !cursors.HasNext {
+			break
+		}
+		assert.Len(t, fc.Features, 3)
+		cursor = cursors.Next.Decode([]byte{})
+	}
+	assert.Len(t, features, count)
+}
+
+func TestGeoPackage_GetFeatures_BboxCrs(t *testing.T) {
+	g := &GeoPackage{
+		backend:                    newAddressesGeoPackage(),
+		fidColumn:                  "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom", SRS: 28992}},
+		queryTimeout:               5 * time.Second,
+		spatialite:                 false,
+	}
+	_, _, err := g.GetFeatures(context.Background(), "ligplaatsen",
+		datasources.FeatureOptions{Limit: 3, Bbox: &geom.Extent{4.89, 52.37, 4.9, 52.38}, BboxCrs: 4326})
+
+	var notSupported *datasources.NotSupportedError
+	require.ErrorAs(t, err, &notSupported)
+	assert.Contains(t, notSupported.Message, "requires spatialite")
+}
@@ -0,0 +1,55 @@
+package geopackage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+// featureStream streams the features of a result set, the first feature is read beforehand (see StreamFeatures)
+type featureStream struct {
+	query *featuresQuery
+	rows  *domain.FeatureRows
+
+	first *domain.Feature
+}
+
+// StreamFeatures see datasources.StreamingDatasource
+func (g *GeoPackage) StreamFeatures(ctx context.Context, collection string, options datasources.FeatureOptions) (datasources.FeatureStream, domain.Cursors, error) {
+	if options.Offset != nil {
+		return nil, domain.Cursors{}, errors.New("offset-based pagination isn't supported when streaming features")
+	}
+	query, err := g.queryFeatures(ctx, collection, options)
+	if err != nil {
+		return nil, domain.Cursors{}, err
+	}
+	rows, err := domain.NewFeatureRows(query.rows, g.fidColumn, query.table.GeometryColumnName,
+		query.table.PropertyTypes, options.Properties, readGpkgGeometry)
+	if err != nil {
+		query.close()
+		return nil, domain.Cursors{}, err
+	}
+	stream := &featureStream{query: query, rows: rows}
+	// read the first feature, since the cursors are derived from the first row
+	first, err := rows.Next()
+	if err != nil || first == nil {
+		query.close()
+		return nil, domain.Cursors{}, err
+	}
+	stream.first = first
+	return stream, domain.NewCursors(*rows.PrevNextFID(), options.Cursor.FiltersChecksum), nil
+}
+
+func (s *featureStream) Next() (*domain.Feature, error) {
+	if feature := s.first; feature != nil {
+		s.first = nil
+		return feature, nil
+	}
+	return s.rows.Next()
+}
+
+func (s *featureStream) Close() {
+	s.query.close()
+}
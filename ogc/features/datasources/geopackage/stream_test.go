@@ -0,0 +1,79 @@
+package geopackage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoPackage_StreamFeatures(t *testing.T) {
+	g := &GeoPackage{
+		backend:   newAddressesGeoPackage(),
+		fidColumn: "feature_id",
+		featureTableByCollectionID: map[string]*featureTable{"ligplaatsen": {TableName: "ligplaatsen", GeometryColumnName: "geom",
+			ColumnNames: []string{"feature_id", "geom", "straatnaam", "nummer_id"}}},
+		queryTimeout: 5 * time.Second,
+	}
+	tests := []struct {
+		name    string
+		options datasources.FeatureOptions
+		wantNil bool
+		wantErr string
+	}{
+		{
+			name:    "page of features",
+			options: datasources.FeatureOptions{Limit: 5, PropertyFilters: map[string][]string{"straatnaam": {"Realengracht"}}},
+		},
+		{
+			name:    "with bbox",
+			options: datasources.FeatureOptions{Limit: 10, Bbox: &geom.Extent{120900, 488800, 121100, 489000}, BboxCrs: 28992},
+		},
+		{
+			name:    "no matching features",
+			options: datasources.FeatureOptions{Limit: 5, PropertyFilters: map[string][]string{"straatnaam": {"does not exist"}}},
+			wantNil: true,
+		},
+		{
+			name:    "fail on offset",
+			options: datasources.FeatureOptions{Limit: 5, Offset: ptrTo(0)},
+			wantErr: "offset-based pagination isn't supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, cursors, err := g.StreamFeatures(context.Background(), "ligplaatsen", tt.options)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, stream)
+				return
+			}
+			defer stream.Close()
+
+			var streamed []*domain.Feature
+			for {
+				feature, err := stream.Next()
+				require.NoError(t, err)
+				if feature == nil {
+					break
+				}
+				streamed = append(streamed, feature)
+			}
+
+			// streaming should result in the same page as retrieving the features at once
+			fc, wantCursors, err := g.GetFeatures(context.Background(), "ligplaatsen", tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, fc.Features, streamed)
+			assert.Equal(t, wantCursors, cursors)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package geopackage
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/PDOK/gokoala/engine"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// SQL functions registered with the sqlite driver, since the built-in NOCASE
+	// collation and lower() function of SQLite only support ASCII characters.
+	lowerFunction = "gokoala_lower"
+	foldFunction  = "gokoala_fold"
+)
+
+// lower lowercases text, including non-ASCII characters (e.g. "ÉÉN" -> "één")
+func lower(text string) string {
+	return strings.ToLower(text)
+}
+
+// fold lowercases text and removes diacritics (e.g. "Één" -> "een", "Curaçao" -> "curacao")
+func fold(text string) string {
+	removeDiacritics := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	result, _, err := transform.String(removeDiacritics, text)
+	if err != nil {
+		return strings.ToLower(text)
+	}
+	return strings.ToLower(result)
+}
+
+// asSQLFunction applies the given function to the text representation of a SQL value, so
+// non-text columns (e.g. numbers) can be compared with text values as well. Null remains null.
+func asSQLFunction(fn func(string) string) func(value any) any {
+	return func(value any) any {
+		switch v := value.(type) {
+		case nil:
+			return nil
+		case string:
+			return fn(v)
+		case []byte:
+			return fn(string(v))
+		default:
+			return fn(fmt.Sprint(v))
+		}
+	}
+}
+
+// textMatcher returns the SQL function to apply to a column and the Go function to apply
+// to the given values, in order to compare text according to the configured text matching.
+func textMatcher(textMatching string) (string, func(string) string) {
+	switch textMatching {
+	case engine.TextMatchingCaseInsensitive:
+		return lowerFunction, lower
+	case engine.TextMatchingCaseAccentInsensitive:
+		return foldFunction, fold
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,39 @@
+package geopackage
+
+import (
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextMatcher(t *testing.T) {
+	tests := []struct {
+		textMatching    string
+		value           any
+		wantSQLFunction string
+		wantTransformed any
+	}{
+		{textMatching: engine.TextMatchingCaseInsensitive, value: "ÉÉN Straat", wantSQLFunction: lowerFunction, wantTransformed: "één straat"},
+		{textMatching: engine.TextMatchingCaseAccentInsensitive, value: "ÉÉN Straat", wantSQLFunction: foldFunction, wantTransformed: "een straat"},
+		{textMatching: engine.TextMatchingCaseAccentInsensitive, value: "Curaçao", wantSQLFunction: foldFunction, wantTransformed: "curacao"},
+		{textMatching: engine.TextMatchingCaseAccentInsensitive, value: []byte("Zürich"), wantSQLFunction: foldFunction, wantTransformed: "zurich"},
+		{textMatching: engine.TextMatchingCaseAccentInsensitive, value: int64(42), wantSQLFunction: foldFunction, wantTransformed: "42"},
+		{textMatching: engine.TextMatchingCaseAccentInsensitive, value: nil, wantSQLFunction: foldFunction, wantTransformed: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.textMatching, func(t *testing.T) {
+			sqlFunction, transform := textMatcher(tt.textMatching)
+			assert.Equal(t, tt.wantSQLFunction, sqlFunction)
+			assert.Equal(t, tt.wantTransformed, asSQLFunction(transform)(tt.value))
+		})
+	}
+}
+
+func TestTextMatcher_exact(t *testing.T) {
+	for _, textMatching := range []string{"", engine.TextMatchingExact} {
+		sqlFunction, transform := textMatcher(textMatching)
+		assert.Empty(t, sqlFunction)
+		assert.Nil(t, transform)
+	}
+}
@@ -0,0 +1,147 @@
+package geopackage
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom/encoding/wkt"
+	"github.com/jmoiron/sqlx"
+)
+
+// from the feature table, or the (parenthesized) query of a view, to select features from in named queries
+func (t *featureTable) from() string {
+	if t.ViewQuery == "" {
+		return t.TableName
+	}
+	if t.Materialized != nil {
+		return `"` + t.TableName + `"` // table in the database of the materialized view, see getDB
+	}
+	// escape colons (e.g. in time literals), since sqlx considers these named params
+	return "(" + strings.ReplaceAll(t.ViewQuery, ":", "::") + ")"
+}
+
+func (t *featureTable) isView() bool {
+	return t.ViewQuery != ""
+}
+
+// cursorFID feature id from which to page, the first page starts at the lowest integer or text
+func (t *featureTable) cursorFID(cursor domain.DecodedCursor) any {
+	if cursor.FID.IsZero() && t.TextFid {
+		return ""
+	}
+	return cursor.FID
+}
+
+// getDB to query the given feature table, a materialized view is queried from its own database
+func (g *GeoPackage) getDB(table *featureTable) *sqlx.DB {
+	if table.Materialized != nil {
+		return table.Materialized.getDB()
+	}
+	return g.backend.getDB()
+}
+
+// Add a feature table for each collection backed by a view (SQL query) instead of a feature table, see View in
+// config. Views aren't registered in gpkg_contents, the query is executed to validate the columns and determine
+// the CRS of the geometries.
+func readViews(collections engine.GeoSpatialCollections, db *sqlx.DB, fidColumn string, featureTables map[string]*featureTable) error {
+	for _, collection := range collections {
+		if collection.Features == nil || collection.Features.View == nil {
+			continue
+		}
+		view := collection.Features.View
+		table := &featureTable{
+			TableName:          collection.ID,
+			DataType:           "features",
+			Identifier:         collection.ID,
+			GeometryColumnName: view.GeometryColumn,
+			ViewQuery:          strings.TrimRight(strings.TrimSpace(view.Query), ";"),
+		}
+		applyCollectionConfig(table, collection)
+		if err := readFeatureTableColumns(table, db); err != nil {
+			return err
+		}
+		for _, column := range append([]string{fidColumn, table.GeometryColumnName}, bboxColumns...) {
+			if !slices.Contains(table.ColumnNames, column) {
+				return fmt.Errorf("view of collection '%s' should return column '%s', found columns: %v",
+					collection.ID, column, table.ColumnNames)
+			}
+		}
+		srs, err := readViewSrs(table, db)
+		if err != nil {
+			return err
+		}
+		table.SRS = srs
+		featureTables[collection.ID] = table
+	}
+	return nil
+}
+
+// Read the column names (and declared types) of the given view by executing its query without returning rows
+func readViewColumns(table *featureTable, db *sqlx.DB) ([]string, []string, error) {
+	rows, err := db.Queryx(fmt.Sprintf("select * from (%s) limit 0", table.ViewQuery))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to execute query of view '%s', error: %w", table.TableName, err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read columns of view '%s', error: %w", table.TableName, err)
+	}
+	names := make([]string, 0, len(columnTypes))
+	types := make([]string, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		names = append(names, columnType.Name())
+		types = append(types, columnType.DatabaseTypeName()) // empty for computed columns
+	}
+	return names, types, nil
+}
+
+// Read the CRS (srs_id) of the geometries in the given view from the header of the first geometry,
+// see http://www.geopackage.org/spec/#gpb_format. A view without geometries has an undefined CRS (0).
+func readViewSrs(table *featureTable, db *sqlx.DB) (int64, error) {
+	var rawGeom []byte
+	query := fmt.Sprintf("select f.%[1]s from (%[2]s) f where f.%[1]s is not null limit 1", table.GeometryColumnName, table.ViewQuery)
+	if err := db.Get(&rawGeom, query); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("view of collection '%s' has no geometries, its CRS is undefined", table.TableName)
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read geometry of view '%s', error: %w", table.TableName, err)
+	}
+	const headerSize = 8
+	if len(rawGeom) < headerSize || rawGeom[0] != 'G' || rawGeom[1] != 'P' {
+		return 0, fmt.Errorf("column '%s' of view '%s' doesn't hold GeoPackage geometries",
+			table.GeometryColumnName, table.TableName)
+	}
+	var byteOrder binary.ByteOrder = binary.BigEndian
+	if rawGeom[3]&1 == 1 {
+		byteOrder = binary.LittleEndian
+	}
+	return int64(int32(byteOrder.Uint32(rawGeom[4:headerSize]))), nil
+}
+
+// Build predicate (prefixed with 'and', like the property filters) to filter a view by bbox. Views lack the rtree
+// and spatial index of feature tables, so the bbox columns are compared directly.
+func (g *GeoPackage) makeViewBboxFilter(table *featureTable, opt datasources.FeatureOptions) (string, map[string]any, error) {
+	predicate := " and f.minx <= :maxx and f.maxx >= :minx and f.miny <= :maxy and f.maxy >= :miny " +
+		g.makeIntersectsPredicate(table)
+	bboxAsWKT, err := wkt.EncodeString(opt.Bbox)
+	if err != nil {
+		return "", nil, err
+	}
+	return predicate, map[string]any{
+		"bboxWkt": bboxAsWKT,
+		"bboxCrs": opt.BboxCrs,
+		"maxx":    opt.Bbox.MaxX(),
+		"minx":    opt.Bbox.MinX(),
+		"maxy":    opt.Bbox.MaxY(),
+		"miny":    opt.Bbox.MinY()}, nil
+}
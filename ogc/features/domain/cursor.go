@@ -3,14 +3,22 @@ package domain
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"log"
 	"math/big"
+	"strconv"
 )
 
-const separator = '|'
+const (
+	separator = '|'
+
+	// marks a cursor holding a textual feature id, the encoding of numeric feature ids never starts with this byte
+	textFidMarker = 0x00
+)
 
 // Cursors holds next and previous cursor. Note that we use
-// 'cursor-based pagination' as opposed to 'offset-based pagination'
+// 'cursor-based pagination' as opposed to 'offset-based pagination',
+// unless the latter is enabled for a collection (see NewOffsetCursors)
 type Cursors struct {
 	Prev EncodedCursor
 	Next EncodedCursor
@@ -24,14 +32,14 @@ type EncodedCursor string
 
 // DecodedCursor the cursor values after decoding EncodedCursor
 type DecodedCursor struct {
-	FID             int64
+	FID             FeatureID
 	FiltersChecksum []byte
 }
 
 // PrevNextFID previous and next feature id (fid) to encode in cursor.
 type PrevNextFID struct {
-	Prev int64
-	Next int64
+	Prev FeatureID
+	Next FeatureID
 }
 
 // NewCursors create Cursors based on the prev/next feature ids from the datasource
@@ -41,13 +49,32 @@ func NewCursors(fid PrevNextFID, filtersChecksum []byte) Cursors {
 		Prev: encodeCursor(fid.Prev, filtersChecksum),
 		Next: encodeCursor(fid.Next, filtersChecksum),
 
-		HasPrev: fid.Prev > 0,
-		HasNext: fid.Next > 0,
+		HasPrev: !fid.Prev.IsZero(),
+		HasNext: !fid.Next.IsZero(),
+	}
+}
+
+// NewOffsetCursors create Cursors for offset-based pagination, in which case the
+// cursors hold the offset of the previous and next page instead of a feature id.
+func NewOffsetCursors(offset int, limit int, hasNext bool) Cursors {
+	return Cursors{
+		Prev: EncodedCursor(strconv.Itoa(max(offset-limit, 0))),
+		Next: EncodedCursor(strconv.Itoa(offset + limit)),
+
+		HasPrev: offset > 0,
+		HasNext: hasNext,
 	}
 }
 
-func encodeCursor(fid int64, filtersChecksum []byte) EncodedCursor {
-	fidAsBytes := big.NewInt(fid).Bytes()
+func encodeCursor(fid FeatureID, filtersChecksum []byte) EncodedCursor {
+	var fidAsBytes []byte
+	if fid.IsText() {
+		// format of a textual fid: <marker><length><fid>, since the fid could contain the separator
+		fidAsBytes = append([]byte{textFidMarker}, binary.AppendUvarint(nil, uint64(len(fid.text)))...)
+		fidAsBytes = append(fidAsBytes, fid.text...)
+	} else {
+		fidAsBytes = big.NewInt(fid.number).Bytes()
+	}
 
 	// format of the cursor: <fid><separator><checksum>
 	cursor := fidAsBytes
@@ -62,37 +89,53 @@ func encodeCursor(fid int64, filtersChecksum []byte) EncodedCursor {
 func (c EncodedCursor) Decode(filtersChecksum []byte) DecodedCursor {
 	value := string(c)
 	if value == "" {
-		return DecodedCursor{0, filtersChecksum}
+		return DecodedCursor{FeatureID{}, filtersChecksum}
 	}
 
 	decoded, err := base64.URLEncoding.DecodeString(value)
 	if err != nil || len(decoded) == 0 {
 		log.Printf("decoding cursor value '%v' failed, defaulting to first page", decoded)
-		return DecodedCursor{0, filtersChecksum}
+		return DecodedCursor{FeatureID{}, filtersChecksum}
 	}
 
-	decodedFid, decodedChecksum, found := bytes.Cut(decoded, []byte{separator})
+	// feature id
+	var fid FeatureID
+	var decodedChecksum []byte
+	var found bool
+	if decoded[0] == textFidMarker {
+		fid, decodedChecksum, found = decodeTextFid(decoded[1:])
+	} else {
+		var decodedFid []byte
+		decodedFid, decodedChecksum, found = bytes.Cut(decoded, []byte{separator})
+		fid = NewFeatureID(big.NewInt(0).SetBytes(decodedFid).Int64())
+		if fid.number < 0 {
+			log.Printf("negative feature ID detected: %d, defaulting to first page", fid.number)
+			fid = FeatureID{}
+		}
+	}
 	if !found {
 		log.Printf("cursor '%v' doesn't contain expected separator %c", decoded, separator)
-		return DecodedCursor{0, filtersChecksum}
-	}
-
-	// feature id
-	fid := big.NewInt(0).SetBytes(decodedFid).Int64()
-	if fid < 0 {
-		log.Printf("negative feature ID detected: %d, defaulting to first page", fid)
-		fid = 0
+		return DecodedCursor{FeatureID{}, filtersChecksum}
 	}
 
 	// checksum
 	if !bytes.Equal(decodedChecksum, filtersChecksum) {
 		log.Printf("filters in query params have changed during pagination, resetting to first page")
-		return DecodedCursor{0, filtersChecksum}
+		return DecodedCursor{FeatureID{}, filtersChecksum}
 	}
 
 	return DecodedCursor{fid, filtersChecksum}
 }
 
+// decodeTextFid decodes <length><fid><separator><checksum>, returns false when malformed
+func decodeTextFid(decoded []byte) (FeatureID, []byte, bool) {
+	length, n := binary.Uvarint(decoded)
+	if n <= 0 || uint64(len(decoded)-n) <= length || decoded[n+int(length)] != separator {
+		return FeatureID{}, nil, false
+	}
+	return NewTextFeatureID(string(decoded[n : n+int(length)])), decoded[n+int(length)+1:], true
+}
+
 func (c EncodedCursor) String() string {
 	return string(c)
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/base64"
 	"math"
 	"reflect"
 	"testing"
@@ -19,10 +20,10 @@ func TestNewCursor(t *testing.T) {
 		{
 			name: "test first page",
 			args: args{
-				features: []*Feature{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}},
+				features: []*Feature{{ID: NewFeatureID(1)}, {ID: NewFeatureID(2)}, {ID: NewFeatureID(3)}, {ID: NewFeatureID(4)}},
 				id: PrevNextFID{
-					Prev: 0,
-					Next: 4,
+					Prev: NewFeatureID(0),
+					Next: NewFeatureID(4),
 				},
 			},
 			want: Cursors{
@@ -35,10 +36,10 @@ func TestNewCursor(t *testing.T) {
 		{
 			name: "test last page",
 			args: args{
-				features: []*Feature{{ID: 5}, {ID: 6}, {ID: 7}, {ID: 8}},
+				features: []*Feature{{ID: NewFeatureID(5)}, {ID: NewFeatureID(6)}, {ID: NewFeatureID(7)}, {ID: NewFeatureID(8)}},
 				id: PrevNextFID{
-					Prev: 4,
-					Next: 0,
+					Prev: NewFeatureID(4),
+					Next: NewFeatureID(0),
 				},
 			},
 			want: Cursors{
@@ -51,10 +52,10 @@ func TestNewCursor(t *testing.T) {
 		{
 			name: "test middle page",
 			args: args{
-				features: []*Feature{{ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}},
+				features: []*Feature{{ID: NewFeatureID(3)}, {ID: NewFeatureID(4)}, {ID: NewFeatureID(5)}, {ID: NewFeatureID(6)}},
 				id: PrevNextFID{
-					Prev: 2,
-					Next: 7,
+					Prev: NewFeatureID(2),
+					Next: NewFeatureID(7),
 				},
 			},
 			want: Cursors{
@@ -75,6 +76,46 @@ func TestNewCursor(t *testing.T) {
 	}
 }
 
+func TestNewOffsetCursors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		offset  int
+		limit   int
+		hasNext bool
+		want    Cursors
+	}{
+		{
+			name:    "test first page",
+			offset:  0,
+			limit:   10,
+			hasNext: true,
+			want:    Cursors{Prev: "0", Next: "10", HasPrev: false, HasNext: true},
+		},
+		{
+			name:    "test middle page, offset not a multiple of limit",
+			offset:  5,
+			limit:   10,
+			hasNext: true,
+			want:    Cursors{Prev: "0", Next: "15", HasPrev: true, HasNext: true},
+		},
+		{
+			name:    "test last page",
+			offset:  20,
+			limit:   10,
+			hasNext: false,
+			want:    Cursors{Prev: "10", Next: "30", HasPrev: true, HasNext: false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewOffsetCursors(tt.offset, tt.limit, tt.hasNext)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewOffsetCursors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestEncodedCursor_Decode(t *testing.T) {
 	type args struct {
 		filtersChecksum []byte
@@ -87,67 +128,89 @@ func TestEncodedCursor_Decode(t *testing.T) {
 	}{
 		{
 			name: "should return cursor if no checksum is available in cursor, and no expected checksum provided",
-			c:    encodeCursor(123, []byte{}),
+			c:    encodeCursor(NewFeatureID(123), []byte{}),
 			args: args{
 				filtersChecksum: []byte{},
 			},
 			want: DecodedCursor{
-				FID:             123,
+				FID:             NewFeatureID(123),
 				FiltersChecksum: []byte{},
 			},
 		},
 		{
 			name: "should not fail on checksum which contains separator",
-			c:    encodeCursor(123456, []byte{'a', separator, 'b'}),
+			c:    encodeCursor(NewFeatureID(123456), []byte{'a', separator, 'b'}),
 			args: args{
 				filtersChecksum: []byte{'a', separator, 'b'},
 			},
 			want: DecodedCursor{
-				FID:             123456,
+				FID:             NewFeatureID(123456),
 				FiltersChecksum: []byte{'a', separator, 'b'},
 			},
 		},
 		{
 			name: "should not fail on checksum which contains only separator",
-			c:    encodeCursor(123456, []byte{separator}),
+			c:    encodeCursor(NewFeatureID(123456), []byte{separator}),
 			args: args{
 				filtersChecksum: []byte{separator},
 			},
 			want: DecodedCursor{
-				FID:             123456,
+				FID:             NewFeatureID(123456),
 				FiltersChecksum: []byte{separator},
 			},
 		},
 		{
 			name: "should fail (return 0 fid) on non matching checksums",
-			c:    encodeCursor(123456, []byte("foobarbaz")),
+			c:    encodeCursor(NewFeatureID(123456), []byte("foobarbaz")),
 			args: args{
 				filtersChecksum: []byte("bazbar"),
 			},
 			want: DecodedCursor{
-				FID:             0,
+				FID:             NewFeatureID(0),
 				FiltersChecksum: []byte("bazbar"),
 			},
 		},
 		{
 			name: "should handle large feature id",
-			c:    encodeCursor(math.MaxInt64, []byte("foobar")),
+			c:    encodeCursor(NewFeatureID(math.MaxInt64), []byte("foobar")),
 			args: args{
 				filtersChecksum: []byte("foobar"),
 			},
 			want: DecodedCursor{
-				FID:             math.MaxInt64,
+				FID:             NewFeatureID(math.MaxInt64),
 				FiltersChecksum: []byte("foobar"),
 			},
 		},
+		{
+			name: "should return textual feature id, even when it contains the separator",
+			c:    encodeCursor(NewTextFeatureID("a|b"), []byte("foobar")),
+			args: args{
+				filtersChecksum: []byte("foobar"),
+			},
+			want: DecodedCursor{
+				FID:             NewTextFeatureID("a|b"),
+				FiltersChecksum: []byte("foobar"),
+			},
+		},
+		{
+			name: "should fail (return zero fid) on truncated textual feature id",
+			c:    EncodedCursor(base64.URLEncoding.EncodeToString([]byte{textFidMarker, 10, 'a', separator})),
+			args: args{
+				filtersChecksum: []byte{},
+			},
+			want: DecodedCursor{
+				FID:             FeatureID{},
+				FiltersChecksum: []byte{},
+			},
+		},
 		{
 			name: "should always return positive feature id",
-			c:    encodeCursor(math.MinInt64, []byte("foobar")),
+			c:    encodeCursor(NewFeatureID(math.MinInt64), []byte("foobar")),
 			args: args{
 				filtersChecksum: []byte("foobar"),
 			},
 			want: DecodedCursor{
-				FID:             0,
+				FID:             NewFeatureID(0),
 				FiltersChecksum: []byte("foobar"),
 			},
 		},
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strconv"
+)
+
+// FeatureID identifies a Feature. Usually an (auto-incrementing) integer, which is the default in GeoPackages,
+// but textual ids (e.g. UUIDs) are supported as well. Features are ordered by id for cursor-based pagination.
+type FeatureID struct {
+	number int64
+	text   string
+}
+
+// NewFeatureID numeric feature id
+func NewFeatureID(id int64) FeatureID {
+	return FeatureID{number: id}
+}
+
+// NewTextFeatureID textual feature id, e.g. a UUID
+func NewTextFeatureID(id string) FeatureID {
+	return FeatureID{text: id}
+}
+
+// ToFeatureID converts a value read from a datasource to a feature id, returns false
+// when the value can't be a feature id
+func ToFeatureID(value any) (FeatureID, bool) {
+	switch v := value.(type) {
+	case int64:
+		return NewFeatureID(v), true
+	case string:
+		return NewTextFeatureID(v), v != ""
+	case []byte:
+		return NewTextFeatureID(string(v)), len(v) > 0
+	default:
+		return FeatureID{}, false
+	}
+}
+
+// IsText whether this is a textual instead of a numeric feature id
+func (id FeatureID) IsText() bool {
+	return id.text != ""
+}
+
+// IsZero whether the feature id is absent (e.g. there's no previous or next page)
+func (id FeatureID) IsZero() bool {
+	return id == FeatureID{}
+}
+
+func (id FeatureID) String() string {
+	if id.IsText() {
+		return id.text
+	}
+	return strconv.FormatInt(id.number, 10)
+}
+
+// Value binds the feature id as SQL parameter, see driver.Valuer
+func (id FeatureID) Value() (driver.Value, error) {
+	if id.IsText() {
+		return id.text, nil
+	}
+	return id.number, nil
+}
+
+// MarshalJSON numeric feature ids are JSON numbers, textual feature ids are JSON strings
+func (id FeatureID) MarshalJSON() ([]byte, error) {
+	if id.IsText() {
+		return json.Marshal(id.text)
+	}
+	return []byte(strconv.FormatInt(id.number, 10)), nil
+}
+
+func (id *FeatureID) UnmarshalJSON(data []byte) error {
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*id = NewFeatureID(number)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*id = NewTextFeatureID(text)
+	return nil
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureID_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		id   FeatureID
+		want string
+	}{
+		{name: "numeric id", id: NewFeatureID(3837), want: `3837`},
+		{name: "textual id", id: NewTextFeatureID("b6a2c2d4-1e0f-4f1a-9a3e-3f4c5d6e7f80"), want: `"b6a2c2d4-1e0f-4f1a-9a3e-3f4c5d6e7f80"`},
+		{name: "numeric text stays text", id: NewTextFeatureID("42"), want: `"42"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+
+			var roundtrip FeatureID
+			assert.NoError(t, json.Unmarshal(got, &roundtrip))
+			assert.Equal(t, tt.id, roundtrip)
+		})
+	}
+}
+
+func TestToFeatureID(t *testing.T) {
+	tests := []struct {
+		value  any
+		want   FeatureID
+		wantOk bool
+	}{
+		{value: int64(42), want: NewFeatureID(42), wantOk: true},
+		{value: "abc", want: NewTextFeatureID("abc"), wantOk: true},
+		{value: []byte("abc"), want: NewTextFeatureID("abc"), wantOk: true},
+		{value: "", wantOk: false},
+		{value: 4.2, wantOk: false},
+		{value: nil, wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := ToFeatureID(tt.value)
+		assert.Equal(t, tt.wantOk, ok)
+		assert.Equal(t, tt.want, got)
+	}
+}
@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/go-spatial/geom"
@@ -22,21 +25,52 @@ func (fc *featureCollectionType) UnmarshalJSON([]byte) error { return nil }
 type FeatureCollection struct {
 	Links []Link `json:"links,omitempty"`
 
+	TimeStamp      string                `json:"timeStamp,omitempty"`     // time the response was generated (RFC 3339)
+	NumberMatched  *int                  `json:"numberMatched,omitempty"` // only when requested (limit=0) or configured
 	NumberReturned int                   `json:"numberReturned"`
 	Type           featureCollectionType `json:"type"`
+	Bbox           *geom.Extent          `json:"bbox,omitempty"` // only when requested (limit=0)
 	Features       []*Feature            `json:"features"`
 }
 
 // Feature is a GeoJSON Feature with extras such as links
 type Feature struct {
 	// we overwrite ID since we want to make it a required attribute. We also expect feature ids to be
-	// auto-incrementing integers (which is the default in geopackages) since we use it for cursor-based pagination.
-	ID    int64  `json:"id"`
-	Links []Link `json:"links,omitempty"`
+	// auto-incrementing integers (which is the default in geopackages) or otherwise sortable text (e.g. UUIDs)
+	// since we use it for cursor-based pagination.
+	ID    FeatureID `json:"id"`
+	Links []Link    `json:"links,omitempty"`
 
 	geojson.Feature
 }
 
+// MarshalJSON marshals the Feature to GeoJSON. Overwritten to support features without
+// geometry (e.g. when the geometry is skipped on request), in which case the geometry is 'null'.
+func (f Feature) MarshalJSON() ([]byte, error) {
+	type featureJSON struct {
+		ID         FeatureID              `json:"id"`
+		Links      []Link                 `json:"links,omitempty"`
+		Type       geojson.JsonType       `json:"type"`
+		Geometry   *geojson.Geometry      `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	result := featureJSON{
+		ID:         f.ID,
+		Links:      f.Links,
+		Type:       geojson.FeatureType,
+		Properties: f.Properties,
+	}
+	if f.Geometry.Geometry != nil {
+		result.Geometry = &f.Geometry
+	}
+	// don't escape '<', '>' and '&', the latter is used in links
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(result)
+	return bytes.TrimRight(buffer.Bytes(), "\n"), err
+}
+
 // Link according to RFC 8288, https://datatracker.ietf.org/doc/html/rfc8288
 type Link struct {
 	Length    int64  `json:"length,omitempty"`
@@ -48,42 +82,96 @@ type Link struct {
 	Templated bool   `json:"templated,omitempty"`
 }
 
-// MapRowsToFeatures datasource agnostic mapper from SQL rows/result set to Features domain model
-func MapRowsToFeatures(rows *sqlx.Rows, fidColumn string, geomColumn string,
-	geomMapper func([]byte) (geom.Geometry, error)) ([]*Feature, *PrevNextFID, error) {
+// MapRowsToFeatures datasource agnostic mapper from SQL rows/result set to Features domain model.
+// Property values are coerced to the given property types, when available. When properties are
+// given only these are mapped (even when the result set holds more columns), otherwise all.
+func MapRowsToFeatures(rows *sqlx.Rows, fidColumn string, geomColumn string, propertyTypes PropertyTypes,
+	properties []string, geomMapper func([]byte) (geom.Geometry, error)) ([]*Feature, *PrevNextFID, error) {
 
 	result := make([]*Feature, 0)
-	columns, err := rows.Columns()
+	featureRows, err := NewFeatureRows(rows, fidColumn, geomColumn, propertyTypes, properties, geomMapper)
 	if err != nil {
 		return result, nil, err
 	}
-
-	firstRow := true
-	var prevNextID *PrevNextFID
-	for rows.Next() {
-		var values []interface{}
-		if values, err = rows.SliceScan(); err != nil {
-			return result, nil, err
-		}
-
-		feature := &Feature{Feature: geojson.Feature{Properties: make(map[string]interface{})}}
-		np, err := mapColumnsToFeature(firstRow, feature, columns, values, fidColumn, geomColumn, geomMapper)
+	for {
+		feature, err := featureRows.Next()
 		if err != nil {
 			return result, nil, err
-		} else if firstRow {
-			prevNextID = np
-			firstRow = false
+		}
+		if feature == nil {
+			return result, featureRows.PrevNextFID(), nil
 		}
 		result = append(result, feature)
 	}
-	return result, prevNextID, nil
+}
+
+// FeatureRows maps SQL rows/result set to Features one by one, e.g. to stream Features to the client
+// as they're scanned instead of materializing all Features in memory first. See MapRowsToFeatures.
+type FeatureRows struct {
+	rows          *sqlx.Rows
+	columns       []string
+	fidColumn     string
+	geomColumn    string
+	propertyTypes PropertyTypes
+	properties    []string
+	geomMapper    func([]byte) (geom.Geometry, error)
+
+	prevNextID *PrevNextFID
+}
+
+func NewFeatureRows(rows *sqlx.Rows, fidColumn string, geomColumn string, propertyTypes PropertyTypes,
+	properties []string, geomMapper func([]byte) (geom.Geometry, error)) (*FeatureRows, error) {
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	return &FeatureRows{
+		rows:          rows,
+		columns:       columns,
+		fidColumn:     fidColumn,
+		geomColumn:    geomColumn,
+		propertyTypes: propertyTypes,
+		properties:    properties,
+		geomMapper:    geomMapper,
+	}, nil
+}
+
+// Next maps the next row to a Feature, returns nil when all rows are read
+func (fr *FeatureRows) Next() (*Feature, error) {
+	if !fr.rows.Next() {
+		return nil, fr.rows.Err()
+	}
+	values, err := fr.rows.SliceScan()
+	if err != nil {
+		return nil, err
+	}
+	firstRow := fr.prevNextID == nil
+	feature := &Feature{Feature: geojson.Feature{Properties: make(map[string]interface{})}}
+	np, err := mapColumnsToFeature(firstRow, feature, fr.columns, values, fr.fidColumn, fr.geomColumn,
+		fr.propertyTypes, fr.properties, fr.geomMapper)
+	if err != nil {
+		return nil, err
+	}
+	if firstRow {
+		fr.prevNextID = np
+	}
+	return feature, nil
+}
+
+// PrevNextFID the previous and next feature id (for pagination) as read from the first row,
+// nil when no rows are read (yet)
+func (fr *FeatureRows) PrevNextFID() *PrevNextFID {
+	return fr.prevNextID
 }
 
 //nolint:cyclop,funlen
 func mapColumnsToFeature(firstRow bool, feature *Feature, columns []string, values []interface{},
-	fidColumn string, geomColumn string, geomMapper func([]byte) (geom.Geometry, error)) (*PrevNextFID, error) {
+	fidColumn string, geomColumn string, propertyTypes PropertyTypes, properties []string,
+	geomMapper func([]byte) (geom.Geometry, error)) (*PrevNextFID, error) {
 
 	prevNextID := PrevNextFID{}
+	bbox := bboxColumns{}
 	for i, columnName := range columns {
 		columnValue := values[i]
 		if columnValue == nil {
@@ -92,7 +180,11 @@ func mapColumnsToFeature(firstRow bool, feature *Feature, columns []string, valu
 
 		switch columnName {
 		case fidColumn:
-			feature.ID = columnValue.(int64)
+			id, ok := ToFeatureID(columnValue)
+			if !ok {
+				return nil, fmt.Errorf("unexpected type for feature id column: %v: %T", fidColumn, columnValue)
+			}
+			feature.ID = id
 
 		case geomColumn:
 			rawGeom, ok := columnValue.([]byte)
@@ -105,43 +197,80 @@ func mapColumnsToFeature(firstRow bool, feature *Feature, columns []string, valu
 			}
 			feature.Geometry = geojson.Geometry{Geometry: mappedGeom}
 
-		case "minx", "miny", "maxx", "maxy", "min_zoom", "max_zoom":
-			// Skip these columns used for bounding box and zoom filtering
+		case "minx", "miny", "maxx", "maxy":
+			// Columns used for bounding box filtering, only used as geometry
+			// when the actual geometry isn't selected (e.g. bbox-only)
+			bbox.set(columnName, columnValue)
+
+		case "min_zoom", "max_zoom":
+			// Skip these columns used for zoom filtering
 			continue
 
 		case "prevfid":
 			// Only the first row in the result set contains the previous feature id
 			if firstRow {
-				prevNextID.Prev = columnValue.(int64)
+				prevNextID.Prev, _ = ToFeatureID(columnValue)
 			}
 
 		case "nextfid":
 			// Only the first row in the result set contains the next feature id
 			if firstRow {
-				prevNextID.Next = columnValue.(int64)
+				prevNextID.Next, _ = ToFeatureID(columnValue)
 			}
 
 		default:
+			if len(properties) > 0 && !slices.Contains(properties, columnName) {
+				// Skip columns which aren't selected
+				continue
+			}
 			// Grab any non-nil, non-id, non-bounding box, & non-geometry column as a tag
 			switch v := columnValue.(type) {
 			case []uint8:
 				asBytes := make([]byte, len(v))
 				copy(asBytes, v)
-				feature.Properties[columnName] = string(asBytes)
-			case int64:
-				feature.Properties[columnName] = v
-			case float64:
-				feature.Properties[columnName] = v
-			case time.Time:
-				feature.Properties[columnName] = v
-			case string:
-				feature.Properties[columnName] = v
-			case bool:
-				feature.Properties[columnName] = v
+				columnValue = string(asBytes)
+			case int64, float64, time.Time, string, bool:
+				// supported type
 			default:
 				return nil, fmt.Errorf("unexpected type for sqlite column data: %v: %T", columns[i], v)
 			}
+			feature.Properties[columnName] = coerce(columnValue, propertyTypes[columnName])
+		}
+	}
+	if feature.Geometry.Geometry == nil {
+		if bboxGeom := bbox.toGeometry(); bboxGeom != nil {
+			feature.Geometry = geojson.Geometry{Geometry: bboxGeom}
 		}
 	}
 	return &prevNextID, nil
 }
+
+// bboxColumns values of the bounding box columns (minx, miny, maxx, maxy) of a feature
+type bboxColumns struct {
+	values map[string]float64
+}
+
+func (b *bboxColumns) set(column string, value any) {
+	if b.values == nil {
+		b.values = make(map[string]float64, 4)
+	}
+	switch v := value.(type) {
+	case float64:
+		b.values[column] = v
+	case int64:
+		b.values[column] = float64(v)
+	}
+}
+
+// toGeometry returns the bounding box as polygon (or point, in case of a point feature),
+// returns nil when not all bounding box columns are present.
+func (b *bboxColumns) toGeometry() geom.Geometry {
+	if len(b.values) != 4 {
+		return nil
+	}
+	extent := geom.Extent{b.values["minx"], b.values["miny"], b.values["maxx"], b.values["maxy"]}
+	if extent.MinX() == extent.MaxX() && extent.MinY() == extent.MaxY() {
+		return geom.Point{extent.MinX(), extent.MinY()}
+	}
+	return extent.AsPolygon()
+}
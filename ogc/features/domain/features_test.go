@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapColumnsToFeature_Properties(t *testing.T) {
+	columns := []string{"fid", "straatnaam", "huisnummer", "postcode"}
+	values := []any{int64(1), "Silodam", int64(1), "1013AS"}
+	tests := []struct {
+		name       string
+		properties []string
+		want       map[string]any
+	}{
+		{
+			name: "all properties",
+			want: map[string]any{"straatnaam": "Silodam", "huisnummer": int64(1), "postcode": "1013AS"},
+		},
+		{
+			name:       "selected properties",
+			properties: []string{"huisnummer", "straatnaam", "unknown"},
+			want:       map[string]any{"straatnaam": "Silodam", "huisnummer": int64(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feature := &Feature{Feature: geojson.Feature{Properties: make(map[string]any)}}
+			_, err := mapColumnsToFeature(true, feature, columns, values, "fid", "geom", nil, tt.properties, nil)
+			require.NoError(t, err)
+			assert.Equal(t, NewFeatureID(1), feature.ID)
+			assert.Equal(t, tt.want, feature.Properties)
+		})
+	}
+}
+
+func TestBboxColumns_toGeometry(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   geom.Geometry
+	}{
+		{
+			name:   "bbox of polygon",
+			values: map[string]any{"minx": 1.0, "miny": 2.0, "maxx": 3.0, "maxy": int64(4)},
+			want:   geom.Polygon{{{1, 2}, {3, 2}, {3, 4}, {1, 4}}},
+		},
+		{
+			name:   "bbox of point",
+			values: map[string]any{"minx": 1.5, "miny": 2.5, "maxx": 1.5, "maxy": 2.5},
+			want:   geom.Point{1.5, 2.5},
+		},
+		{
+			name:   "incomplete bbox",
+			values: map[string]any{"minx": 1.0, "miny": 2.0},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bbox := bboxColumns{}
+			for column, value := range tt.values {
+				bbox.set(column, value)
+			}
+			assert.Equal(t, tt.want, bbox.toGeometry())
+		})
+	}
+}
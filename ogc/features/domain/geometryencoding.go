@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/go-spatial/geom/encoding/wkb"
+	"github.com/go-spatial/geom/encoding/wkt"
+)
+
+// GeometryEncoding how geometries are serialized in output formats without native geometry support
+// (such as CSV, XLSX or NDJSON), where the geometry ends up as text in a single column or field.
+type GeometryEncoding string
+
+const (
+	GeometryEncodingWKT     GeometryEncoding = "wkt"
+	GeometryEncodingWKBHex  GeometryEncoding = "wkb"
+	GeometryEncodingGeoJSON GeometryEncoding = "geojson"
+	GeometryEncodingNone    GeometryEncoding = "none"
+
+	DefaultGeometryEncoding = GeometryEncodingWKT
+)
+
+var geometryEncodings = []GeometryEncoding{GeometryEncodingWKT, GeometryEncodingWKBHex, GeometryEncodingGeoJSON, GeometryEncodingNone}
+
+// ParseGeometryEncoding parses the geometry encoding as requested by a client (case-insensitive),
+// the default encoding is used when the given value is empty.
+func ParseGeometryEncoding(value string) (GeometryEncoding, error) {
+	if value == "" {
+		return DefaultGeometryEncoding, nil
+	}
+	for _, encoding := range geometryEncodings {
+		if strings.EqualFold(value, string(encoding)) {
+			return encoding, nil
+		}
+	}
+	return "", fmt.Errorf("unknown geometry encoding '%s', supported encodings are: %v", value, geometryEncodings)
+}
+
+// EncodeGeometry serializes the given geometry as text using the given encoding. Returns an
+// empty string when there's no geometry (e.g. it's skipped) or when the geometry should be omitted.
+func EncodeGeometry(g geom.Geometry, encoding GeometryEncoding) (string, error) {
+	if g == nil || encoding == GeometryEncodingNone {
+		return "", nil
+	}
+	switch encoding {
+	case GeometryEncodingWKT:
+		return wkt.EncodeString(g)
+	case GeometryEncodingWKBHex:
+		b, err := wkb.EncodeBytes(g)
+		if err != nil {
+			return "", err
+		}
+		return strings.ToUpper(hex.EncodeToString(b)), nil
+	case GeometryEncodingGeoJSON:
+		b, err := json.Marshal(geojson.Geometry{Geometry: g})
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("unknown geometry encoding '%s'", encoding)
+}
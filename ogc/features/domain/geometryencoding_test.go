@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/go-spatial/geom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeGeometry(t *testing.T) {
+	point := geom.Point{121108.424, 488930.925}
+	tests := []struct {
+		name     string
+		geometry geom.Geometry
+		encoding GeometryEncoding
+		want     string
+	}{
+		{name: "WKT", geometry: point, encoding: GeometryEncodingWKT, want: "POINT (121108.424 488930.925)"},
+		{name: "WKB hex", geometry: geom.Point{1, 2}, encoding: GeometryEncodingWKBHex, want: "0101000000000000000000F03F0000000000000040"},
+		{name: "GeoJSON", geometry: point, encoding: GeometryEncodingGeoJSON, want: `{"type":"Point","coordinates":[121108.424,488930.925]}`},
+		{name: "omitted", geometry: point, encoding: GeometryEncodingNone, want: ""},
+		{name: "without geometry", geometry: nil, encoding: GeometryEncodingWKT, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeGeometry(tt.geometry, tt.encoding)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseGeometryEncoding(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    GeometryEncoding
+		wantErr bool
+	}{
+		{value: "", want: GeometryEncodingWKT},
+		{value: "wkb", want: GeometryEncodingWKBHex},
+		{value: "GeoJSON", want: GeometryEncodingGeoJSON},
+		{value: "none", want: GeometryEncodingNone},
+		{value: "gml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseGeometryEncoding(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PropertyType the type of feature property, derived from the schema of the datasource (or configured explicitly).
+// Used to coerce values read from the datasource deterministically, instead of relying on the (driver specific)
+// Go types reported for a column. For example booleans stored as 0/1 or dates stored as text.
+type PropertyType string
+
+const (
+	PropertyTypeBoolean  PropertyType = "boolean"
+	PropertyTypeDate     PropertyType = "date"
+	PropertyTypeDateTime PropertyType = "datetime"
+	PropertyTypeInteger  PropertyType = "integer"
+	PropertyTypeNumber   PropertyType = "number"
+	PropertyTypeString   PropertyType = "string"
+)
+
+// PropertyTypes type per property (column name), properties without a type are returned as read from the datasource
+type PropertyTypes map[string]PropertyType
+
+// Property of features in a collection, as defined by the schema of the datasource
+type Property struct {
+	Name string
+	Type PropertyType // empty when the type is unknown
+}
+
+// dateTimeLayouts layouts of dates and timestamps stored as text, as written by common (sqlite) tools
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+// coerce converts the given value to the given property type. Values which can't be
+// converted (e.g. malformed dates) are returned as-is, same for values without a property type.
+func coerce(value any, propertyType PropertyType) any {
+	switch propertyType {
+	case PropertyTypeBoolean:
+		if b, ok := toBool(value); ok {
+			return b
+		}
+	case PropertyTypeDate:
+		if t, ok := toTime(value); ok {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		}
+	case PropertyTypeDateTime:
+		if t, ok := toTime(value); ok {
+			return t
+		}
+	case PropertyTypeInteger:
+		if i, ok := toInteger(value); ok {
+			return i
+		}
+	case PropertyTypeNumber:
+		if f, ok := toNumber(value); ok {
+			return f
+		}
+	case PropertyTypeString:
+		return toString(value)
+	}
+	return value
+}
+
+func toBool(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
+func toTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range dateTimeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func toInteger(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case float64:
+		// only when no precision is lost
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), true
+		}
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
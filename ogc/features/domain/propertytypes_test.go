@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        any
+		propertyType PropertyType
+		want         any
+	}{
+		{name: "boolean stored as 1", value: int64(1), propertyType: PropertyTypeBoolean, want: true},
+		{name: "boolean stored as 0", value: int64(0), propertyType: PropertyTypeBoolean, want: false},
+		{name: "boolean stored as text", value: "true", propertyType: PropertyTypeBoolean, want: true},
+		{name: "boolean reported by driver", value: false, propertyType: PropertyTypeBoolean, want: false},
+		{name: "invalid boolean", value: "yes", propertyType: PropertyTypeBoolean, want: "yes"},
+		{name: "date stored as text", value: "2023-05-08", propertyType: PropertyTypeDate, want: time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)},
+		{name: "date with time", value: "2023-05-08 14:30:05", propertyType: PropertyTypeDate, want: time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC)},
+		{name: "invalid date", value: "08/05/2023", propertyType: PropertyTypeDate, want: "08/05/2023"},
+		{name: "datetime stored as text", value: "2023-05-08 14:30:05", propertyType: PropertyTypeDateTime, want: time.Date(2023, 5, 8, 14, 30, 5, 0, time.UTC)},
+		{name: "datetime stored as ISO-8601", value: "2023-05-08T14:30:05Z", propertyType: PropertyTypeDateTime, want: time.Date(2023, 5, 8, 14, 30, 5, 0, time.UTC)},
+		{name: "datetime reported by driver", value: time.Date(2023, 5, 8, 14, 30, 5, 0, time.UTC), propertyType: PropertyTypeDateTime, want: time.Date(2023, 5, 8, 14, 30, 5, 0, time.UTC)},
+		{name: "integer stored as text", value: "42", propertyType: PropertyTypeInteger, want: int64(42)},
+		{name: "integer stored as real", value: float64(42), propertyType: PropertyTypeInteger, want: int64(42)},
+		{name: "real isn't an integer", value: 42.5, propertyType: PropertyTypeInteger, want: 42.5},
+		{name: "number stored as integer", value: int64(42), propertyType: PropertyTypeNumber, want: float64(42)},
+		{name: "number stored as text", value: "42.5", propertyType: PropertyTypeNumber, want: 42.5},
+		{name: "string stored as integer", value: int64(42), propertyType: PropertyTypeString, want: "42"},
+		{name: "string stored as real", value: 42.5, propertyType: PropertyTypeString, want: "42.5"},
+		{name: "no property type", value: int64(1), propertyType: "", want: int64(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, coerce(tt.value, tt.propertyType))
+		})
+	}
+}
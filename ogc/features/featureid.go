@@ -0,0 +1,64 @@
+package features
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// fidTypesByCollectionID type of the feature ids per collection, see FidType in config.
+// Collections with integer feature ids (the default) are absent.
+type fidTypesByCollectionID map[string]string
+
+func newFidTypes(collections engine.GeoSpatialCollections) fidTypesByCollectionID {
+	result := make(fidTypesByCollectionID)
+	for _, collection := range collections {
+		if collection.Features != nil && collection.Features.HasTextFid() {
+			result[collection.ID] = collection.Features.FidType
+		}
+	}
+	return result
+}
+
+// parse the given feature id (e.g. from the URL) according to the type of feature ids of the collection
+func (ft fidTypesByCollectionID) parse(collectionID string, value string) (domain.FeatureID, error) {
+	switch ft[collectionID] {
+	case engine.FidTypeString:
+		if value == "" {
+			return domain.FeatureID{}, fmt.Errorf("feature ID can't be empty")
+		}
+		return domain.NewTextFeatureID(value), nil
+	case engine.FidTypeUUID:
+		if !uuidRegex.MatchString(value) {
+			return domain.FeatureID{}, fmt.Errorf("feature ID must be a UUID, received: %s", value)
+		}
+		return domain.NewTextFeatureID(value), nil
+	default:
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return domain.FeatureID{}, fmt.Errorf("feature ID must be a number, received: %s", value)
+		}
+		return domain.NewFeatureID(id), nil
+	}
+}
+
+// toFeatureID converts the value of a property holding a reference to a feature in the given collection
+// to a feature ID, returns false when the value isn't a valid feature ID of that collection
+func (ft fidTypesByCollectionID) toFeatureID(collectionID string, value any) (domain.FeatureID, bool) {
+	var raw string
+	switch v := value.(type) {
+	case int64:
+		raw = strconv.FormatInt(v, 10)
+	case string:
+		raw = v
+	default:
+		return domain.FeatureID{}, false
+	}
+	id, err := ft.parse(collectionID, raw)
+	return id, err == nil
+}
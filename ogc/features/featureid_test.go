@@ -0,0 +1,70 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFidTypes_Parse(t *testing.T) {
+	fidTypes := newFidTypes(engine.GeoSpatialCollections{
+		{ID: "numbers", Features: &engine.CollectionEntryFeatures{FidType: engine.FidTypeInt}},
+		{ID: "names", Features: &engine.CollectionEntryFeatures{FidType: engine.FidTypeString}},
+		{ID: "uuids", Features: &engine.CollectionEntryFeatures{FidType: engine.FidTypeUUID}},
+	})
+	tests := []struct {
+		name       string
+		collection string
+		value      string
+		want       domain.FeatureID
+		wantErr    string
+	}{
+		{name: "integer", collection: "numbers", value: "42", want: domain.NewFeatureID(42)},
+		{name: "integer by default", collection: "foo", value: "42", want: domain.NewFeatureID(42)},
+		{name: "invalid integer", collection: "numbers", value: "abc", wantErr: "feature ID must be a number"},
+		{name: "string", collection: "names", value: "NL.IMBAG.Ligplaats.0363020000881621", want: domain.NewTextFeatureID("NL.IMBAG.Ligplaats.0363020000881621")},
+		{name: "empty string", collection: "names", value: "", wantErr: "feature ID can't be empty"},
+		{name: "uuid", collection: "uuids", value: "b6a2c2d4-1e0f-4f1a-9a3e-3f4c5d6e7f80", want: domain.NewTextFeatureID("b6a2c2d4-1e0f-4f1a-9a3e-3f4c5d6e7f80")},
+		{name: "invalid uuid", collection: "uuids", value: "42", wantErr: "feature ID must be a UUID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fidTypes.parse(tt.collection, tt.value)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFidTypes_ToFeatureID(t *testing.T) {
+	fidTypes := newFidTypes(engine.GeoSpatialCollections{
+		{ID: "names", Features: &engine.CollectionEntryFeatures{FidType: engine.FidTypeString}},
+	})
+	tests := []struct {
+		collection string
+		value      any
+		want       domain.FeatureID
+		wantOk     bool
+	}{
+		{collection: "foo", value: int64(42), want: domain.NewFeatureID(42), wantOk: true},
+		{collection: "foo", value: "42", want: domain.NewFeatureID(42), wantOk: true},
+		{collection: "foo", value: "foo", wantOk: false},
+		{collection: "foo", value: 4.2, wantOk: false},
+		{collection: "foo", value: nil, wantOk: false},
+		{collection: "names", value: "foo", want: domain.NewTextFeatureID("foo"), wantOk: true},
+		{collection: "names", value: int64(42), want: domain.NewTextFeatureID("42"), wantOk: true},
+	}
+	for _, tt := range tests {
+		got, ok := fidTypes.toFeatureID(tt.collection, tt.value)
+		assert.Equal(t, tt.wantOk, ok)
+		if tt.wantOk {
+			assert.Equal(t, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package features
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// fbTable a FlatBuffers table, the index of each value is the id of the field in the schema. Absent
+// (nil) fields are omitted. Supported values: bool, uint8, uint16, int32, uint64 (scalars) and
+// string, []byte, []uint32, []float64, fbTable, []fbTable (referenced objects).
+type fbTable []any
+
+// fbBuilder minimal FlatBuffers encoder (see https://flatbuffers.dev/internals), just enough for FlatGeobuf.
+// In contrast to the official builders the buffer is written front to back: each table is preceded by its
+// vtable and followed by the objects it references, which is allowed since offsets only need to point forward.
+// Alignment is relative to the start of the buffer, which is reserved for the size prefix.
+type fbBuilder struct {
+	buf []byte
+}
+
+// encodeSizePrefixedFlatBuffer encodes the given root table as FlatBuffer, prefixed with its size (uint32)
+func encodeSizePrefixedFlatBuffer(root fbTable) ([]byte, error) {
+	b := &fbBuilder{buf: make([]byte, 8, 512)} // size prefix and offset to root table
+	rootPos, err := b.table(root)
+	if err != nil {
+		return nil, err
+	}
+	b.pad(8)
+	binary.LittleEndian.PutUint32(b.buf[0:], uint32(len(b.buf)-4))
+	binary.LittleEndian.PutUint32(b.buf[4:], uint32(rootPos-4))
+	return b.buf, nil
+}
+
+func (b *fbBuilder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// table writes the vtable, the table itself and subsequently the referenced objects.
+// Returns the position of the table.
+func (b *fbBuilder) table(fields fbTable) (int, error) {
+	// vtable: size of vtable, size of table and offset of each field in the table (0 when absent)
+	b.pad(2)
+	vtablePos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*len(fields)))
+	b.buf = append(b.buf, make([]byte, 2+2*len(fields))...)
+
+	// table: offset to vtable followed by the fields, largest first to minimize padding
+	b.pad(8)
+	tablePos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(tablePos-vtablePos))
+	references := make(map[int]int) // field id -> position of offset to referenced object
+	for _, size := range []int{8, 4, 2, 1} {
+		for id, value := range fields {
+			if value == nil || fbInlineSize(value) != size {
+				continue
+			}
+			b.pad(size)
+			binary.LittleEndian.PutUint16(b.buf[vtablePos+4+2*id:], uint16(len(b.buf)-tablePos))
+			switch v := value.(type) {
+			case bool:
+				if v {
+					b.buf = append(b.buf, 1)
+				} else {
+					b.buf = append(b.buf, 0)
+				}
+			case uint8:
+				b.buf = append(b.buf, v)
+			case uint16:
+				b.buf = binary.LittleEndian.AppendUint16(b.buf, v)
+			case int32:
+				b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(v))
+			case uint64:
+				b.buf = binary.LittleEndian.AppendUint64(b.buf, v)
+			default:
+				references[id] = len(b.buf)
+				b.buf = append(b.buf, 0, 0, 0, 0) // offset is known once the object is written
+			}
+		}
+	}
+	binary.LittleEndian.PutUint16(b.buf[vtablePos+2:], uint16(len(b.buf)-tablePos))
+
+	// referenced objects
+	for id, value := range fields {
+		offsetPos, ok := references[id]
+		if !ok {
+			continue
+		}
+		pos, err := b.object(value)
+		if err != nil {
+			return 0, fmt.Errorf("field %d: %w", id, err)
+		}
+		binary.LittleEndian.PutUint32(b.buf[offsetPos:], uint32(pos-offsetPos))
+	}
+	return tablePos, nil
+}
+
+// object writes a string, vector or table. Returns the position of the object.
+func (b *fbBuilder) object(value any) (int, error) {
+	switch v := value.(type) {
+	case string:
+		pos := b.vectorLength(len(v), 1)
+		b.buf = append(b.buf, v...)
+		b.buf = append(b.buf, 0) // strings are null-terminated
+		return pos, nil
+	case []byte:
+		pos := b.vectorLength(len(v), 1)
+		b.buf = append(b.buf, v...)
+		return pos, nil
+	case []uint32:
+		pos := b.vectorLength(len(v), 4)
+		for _, e := range v {
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, e)
+		}
+		return pos, nil
+	case []float64:
+		pos := b.vectorLength(len(v), 8)
+		for _, e := range v {
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, math.Float64bits(e))
+		}
+		return pos, nil
+	case fbTable:
+		return b.table(v)
+	case []fbTable:
+		pos := b.vectorLength(len(v), 4)
+		offsetsPos := len(b.buf)
+		b.buf = append(b.buf, make([]byte, 4*len(v))...)
+		for i, t := range v {
+			tablePos, err := b.table(t)
+			if err != nil {
+				return 0, err
+			}
+			offsetPos := offsetsPos + 4*i
+			binary.LittleEndian.PutUint32(b.buf[offsetPos:], uint32(tablePos-offsetPos))
+		}
+		return pos, nil
+	default:
+		return 0, fmt.Errorf("unsupported FlatBuffers value %T", value)
+	}
+}
+
+// vectorLength writes the length of a vector, aligned so the elements that follow are aligned as well
+func (b *fbBuilder) vectorLength(length int, elementSize int) int {
+	b.pad(4)
+	for (len(b.buf)+4)%elementSize != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(length))
+	return pos
+}
+
+// fbInlineSize size of the value inside a table, references to other objects are 32-bit offsets
+func fbInlineSize(value any) int {
+	switch value.(type) {
+	case bool, uint8:
+		return 1
+	case uint16:
+		return 2
+	case uint64:
+		return 8
+	default:
+		return 4
+	}
+}
@@ -0,0 +1,434 @@
+package features
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+)
+
+// FlatGeobuf file signature, followed by the header and the features (see https://flatgeobuf.org)
+var fgbMagicBytes = []byte{0x66, 0x67, 0x62, 0x03, 0x66, 0x67, 0x62, 0x00}
+
+// FlatGeobuf geometry types
+const (
+	fgbUnknown uint8 = iota
+	fgbPoint
+	fgbLineString
+	fgbPolygon
+	fgbMultiPoint
+	fgbMultiLineString
+	fgbMultiPolygon
+	fgbGeometryCollection
+)
+
+// FlatGeobuf column types (subset)
+const (
+	fgbBool     uint8 = 2
+	fgbLong     uint8 = 7
+	fgbDouble   uint8 = 10
+	fgbString   uint8 = 11
+	fgbJSON     uint8 = 12
+	fgbDateTime uint8 = 13
+	fgbBinary   uint8 = 14
+)
+
+// name of the column holding the feature id in FlatGeobuf
+const fgbIDColumn = "id"
+
+type fgbColumn struct {
+	name       string
+	columnType uint8
+}
+
+// fgbFeatures serves features as FlatGeobuf, a binary format which is fast to read and write. Features are
+// written to the client one by one, without spatial index (since that requires all features up front).
+type fgbFeatures struct{}
+
+func newFlatGeobufFeatures() *fgbFeatures {
+	return &fgbFeatures{}
+}
+
+// features serves the given features as FlatGeobuf, e.g. features requested by id.
+// The features of a collection are exported as a whole, see exportFlatGeobuf.
+func (ff *fgbFeatures) features(w http.ResponseWriter, collectionID string, crs int, fc *domain.FeatureCollection) error {
+
+	columns := fgbColumns(fc.Features)
+	header, err := fgbHeader(collectionID, crs, fgbCommonGeometryType(fc.Features), columns, len(fc.Features))
+	if err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to encode FlatGeobuf header of collection %s", collectionID), err)
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeFlatGeobuf)
+	writer := newStreamWriter(w)
+	writer.write(fgbMagicBytes)
+	writer.write(header)
+	for _, feat := range fc.Features {
+		featFGB, err := encodeFlatGeobufFeature(feat, columns)
+		if err != nil {
+			return writer.fail(fmt.Sprintf("failed to encode feature %s in collection %s to FlatGeobuf", feat.ID, collectionID), err)
+		}
+		writer.write(featFGB)
+	}
+	if err = writer.Flush(); err != nil {
+		log.Printf("failed to write FlatGeobuf of collection %s: %v", collectionID, err)
+	}
+	return nil
+}
+
+// exportFlatGeobuf serves all features of the collection matching the given options as a single FlatGeobuf file,
+// without pagination. Like the GeoParquet export features are retrieved from the datasource page by page (of the max
+// limit) and written to the client as they're encoded, so memory usage is bounded by the size of a page. Since the
+// header precedes the features, the columns are derived from the properties of the collection and both the number of
+// features and the geometry type are unknown (0). Note FlatGeobuf responses are therefore never coalesced, see
+// engine.RequestCoalescer.
+func (f *Features) exportFlatGeobuf(w http.ResponseWriter, r *http.Request, collectionID string,
+	url featureCollectionURL, options datasources.FeatureOptions) error {
+
+	if options.Nearest != nil || options.Search != "" {
+		return engine.BadRequest("FlatGeobuf is a bulk export of (filtered) features, nearest and q params aren't supported")
+	}
+	if url.params.Get(expandParam) != "" {
+		return engine.BadRequest("FlatGeobuf is a bulk export of (filtered) features, the expand param isn't supported")
+	}
+	properties, err := f.datasource.GetProperties(collectionID)
+	if err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to retrieve properties of collection %s", collectionID), err)
+	}
+	crs, err := f.responseCrs(collectionID, url.params)
+	if err != nil {
+		return err
+	}
+	_, textFid := f.fidTypes[collectionID]
+	columns := fgbPropertyColumns(properties, options.OutputOptions, textFid)
+	header, err := fgbHeader(collectionID, crs, fgbUnknown, columns, 0)
+	if err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to encode FlatGeobuf header of collection %s", collectionID), err)
+	}
+	options.Limit = f.engine.Config.OgcAPI.Features.Limit.Max
+
+	var writer *streamWriter
+	for {
+		fc, cursor, err := f.datasource.GetFeatures(r.Context(), collectionID, options)
+		if err != nil {
+			if writer == nil {
+				return datasourceError(fmt.Sprintf("failed to retrieve feature collection %s", collectionID), err)
+			}
+			return writer.fail(fmt.Sprintf("failed to retrieve features of collection %s for FlatGeobuf export", collectionID), err)
+		}
+		if writer == nil {
+			w.Header().Set("Content-Type", engine.MediaTypeFlatGeobuf)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.fgb"`, collectionID))
+			writer = newStreamWriter(w)
+			writer.write(fgbMagicBytes)
+			writer.write(header)
+		}
+		// a page may be empty while more pages follow, only the cursor tells whether we're done
+		if fc != nil {
+			f.timeZones.normalize(collectionID, fc.Features)
+			for _, feat := range fc.Features {
+				featFGB, err := encodeFlatGeobufFeature(feat, columns)
+				if err != nil {
+					return writer.fail(fmt.Sprintf("failed to encode feature %s in collection %s to FlatGeobuf",
+						feat.ID, collectionID), err)
+				}
+				writer.write(featFGB)
+			}
+		}
+		if !cursor.HasNext {
+			break
+		}
+		if options.Offset != nil {
+			next := *options.Offset + options.Limit
+			options.Offset = &next
+		} else {
+			options.Cursor = cursor.Next.Decode(url.checksum())
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		log.Printf("failed to write FlatGeobuf of collection %s: %v", collectionID, err)
+	}
+	return nil
+}
+
+// fgbHeader encodes the FlatGeobuf header (without spatial index), a features count of 0 means unknown
+func fgbHeader(collectionID string, crs int, geometryType uint8, columns []fgbColumn, count int) ([]byte, error) {
+	return encodeSizePrefixedFlatBuffer(fbTable{
+		0:  collectionID,                      // name
+		2:  geometryType,                      // geometry_type
+		7:  fgbColumnTables(columns),          // columns
+		8:  uint64(count),                     // features_count
+		9:  uint16(0),                         // index_node_size, 0 means without spatial index
+		10: fbTable{0: "EPSG", 1: int32(crs)}, // crs
+	})
+}
+
+func encodeFlatGeobufFeature(feat *domain.Feature, columns []fgbColumn) ([]byte, error) {
+	var properties []byte
+	for i, column := range columns {
+		value := feat.Properties[column.name]
+		if column.name == fgbIDColumn && i == 0 {
+			value = feat.ID
+		}
+		if value == nil {
+			continue
+		}
+		properties = binary.LittleEndian.AppendUint16(properties, uint16(i))
+		properties = fgbAppendValue(properties, column.columnType, value)
+	}
+	feature := fbTable{1: properties}
+	if feat.Geometry.Geometry != nil {
+		geometry, err := fgbGeometry(feat.Geometry.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		feature[0] = geometry
+	}
+	return encodeSizePrefixedFlatBuffer(feature)
+}
+
+// fgbGeometry converts the geometry to a FlatGeobuf geometry table: all coordinates in a single
+// xy vector, ends marks the end of each ring/line and multi polygons or collections consist of parts
+func fgbGeometry(g geom.Geometry) (fbTable, error) {
+	switch t := g.(type) {
+	case geom.Point:
+		return fbTable{1: []float64{t[0], t[1]}, 6: fgbPoint}, nil
+	case geom.MultiPoint:
+		return fbTable{1: fgbXY(t), 6: fgbMultiPoint}, nil
+	case geom.LineString:
+		return fbTable{1: fgbXY(t), 6: fgbLineString}, nil
+	case geom.MultiLineString:
+		xy, ends := fgbLines(t, false)
+		return fbTable{0: ends, 1: xy, 6: fgbMultiLineString}, nil
+	case geom.Polygon:
+		xy, ends := fgbLines(t, true)
+		return fbTable{0: ends, 1: xy, 6: fgbPolygon}, nil
+	case geom.MultiPolygon:
+		parts := make([]fbTable, 0, len(t))
+		for _, p := range t {
+			part, err := fgbGeometry(geom.Polygon(p))
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		return fbTable{6: fgbMultiPolygon, 7: parts}, nil
+	case geom.Collection:
+		parts := make([]fbTable, 0, len(t))
+		for _, c := range t {
+			part, err := fgbGeometry(c)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		return fbTable{6: fgbGeometryCollection, 7: parts}, nil
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %T", g)
+	}
+}
+
+func fgbXY(points [][2]float64) []float64 {
+	result := make([]float64, 0, len(points)*2)
+	for _, p := range points {
+		result = append(result, p[0], p[1])
+	}
+	return result
+}
+
+// fgbLines coordinates of the given lines or rings, including the end (number of points so far) of each line
+func fgbLines(lines [][][2]float64, rings bool) ([]float64, []uint32) {
+	var xy []float64
+	ends := make([]uint32, 0, len(lines))
+	for _, line := range lines {
+		if rings {
+			line = closeRing(line)
+		}
+		xy = append(xy, fgbXY(line)...)
+		ends = append(ends, uint32(len(xy)/2))
+	}
+	return xy, ends
+}
+
+// fgbCommonGeometryType the geometry type of all given features, unknown when these differ
+func fgbCommonGeometryType(features []*domain.Feature) uint8 {
+	result := fgbUnknown
+	for i, feat := range features {
+		var geometryType uint8
+		if feat.Geometry.Geometry != nil {
+			if geometry, err := fgbGeometry(feat.Geometry.Geometry); err == nil {
+				geometryType = geometry[6].(uint8)
+			}
+		}
+		if i > 0 && geometryType != result {
+			return fgbUnknown
+		}
+		result = geometryType
+	}
+	return result
+}
+
+// fgbColumns the id column followed by the properties of the given features, sorted for stable output.
+// The type of each column is derived from the values, mixed types are stored as string.
+func fgbColumns(features []*domain.Feature) []fgbColumn {
+	idType := fgbLong
+	types := make(map[string]uint8)
+	for _, feat := range features {
+		if feat.ID.IsText() {
+			idType = fgbString
+		}
+		for name, value := range feat.Properties {
+			if value == nil {
+				if _, ok := types[name]; !ok {
+					types[name] = fgbUnknown
+				}
+				continue
+			}
+			valueType := fgbValueType(value)
+			if existing, ok := types[name]; ok && existing != fgbUnknown && existing != valueType {
+				valueType = fgbString
+			}
+			types[name] = valueType
+		}
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]fgbColumn, 0, len(names)+1)
+	result = append(result, fgbColumn{name: fgbIDColumn, columnType: idType})
+	for _, name := range names {
+		columnType := types[name]
+		if columnType == fgbUnknown {
+			columnType = fgbString // only null values
+		}
+		result = append(result, fgbColumn{name: name, columnType: columnType})
+	}
+	return result
+}
+
+// fgbPropertyColumns the id column followed by the properties of the collection, in the order of the datasource.
+// The type of each column is derived from the type of the property, properties without a type are stored as string.
+func fgbPropertyColumns(properties []domain.Property, options datasources.OutputOptions, textFid bool) []fgbColumn {
+	idType := fgbLong
+	if textFid {
+		idType = fgbString
+	}
+	result := make([]fgbColumn, 0, len(properties)+1)
+	result = append(result, fgbColumn{name: fgbIDColumn, columnType: idType})
+	for _, property := range properties {
+		if len(options.Properties) > 0 && !slices.Contains(options.Properties, property.Name) {
+			continue
+		}
+		var columnType uint8
+		switch property.Type {
+		case domain.PropertyTypeBoolean:
+			columnType = fgbBool
+		case domain.PropertyTypeInteger:
+			columnType = fgbLong
+		case domain.PropertyTypeNumber:
+			columnType = fgbDouble
+		case domain.PropertyTypeDate, domain.PropertyTypeDateTime:
+			columnType = fgbDateTime
+		default:
+			columnType = fgbString
+		}
+		result = append(result, fgbColumn{name: property.Name, columnType: columnType})
+	}
+	return result
+}
+
+func fgbColumnTables(columns []fgbColumn) []fbTable {
+	result := make([]fbTable, 0, len(columns))
+	for _, column := range columns {
+		result = append(result, fbTable{0: column.name, 1: column.columnType})
+	}
+	return result
+}
+
+func fgbValueType(value any) uint8 {
+	switch value.(type) {
+	case bool:
+		return fgbBool
+	case int, int32, int64:
+		return fgbLong
+	case float32, float64:
+		return fgbDouble
+	case time.Time:
+		return fgbDateTime
+	case []byte:
+		return fgbBinary
+	case map[string]any, []any:
+		return fgbJSON
+	default:
+		return fgbString
+	}
+}
+
+// fgbAppendValue appends the value of a property in the encoding of the given column type
+func fgbAppendValue(buf []byte, columnType uint8, value any) []byte {
+	switch columnType {
+	case fgbBool:
+		if v, _ := value.(bool); v {
+			return append(buf, 1)
+		}
+		return append(buf, 0)
+	case fgbLong:
+		var v int64
+		switch n := value.(type) {
+		case int:
+			v = int64(n)
+		case int32:
+			v = int64(n)
+		case int64:
+			v = n
+		case domain.FeatureID:
+			number, _ := n.Value()
+			v = number.(int64)
+		}
+		return binary.LittleEndian.AppendUint64(buf, uint64(v))
+	case fgbDouble:
+		var v float64
+		switch n := value.(type) {
+		case float32:
+			v = float64(n)
+		case float64:
+			v = n
+		case int64:
+			v = float64(n)
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	case fgbDateTime:
+		if v, ok := value.(time.Time); ok {
+			return fgbAppendBytes(buf, []byte(v.Format(time.RFC3339Nano)))
+		}
+		return fgbAppendBytes(buf, []byte(csvValue(value)))
+	case fgbBinary:
+		return fgbAppendBytes(buf, value.([]byte))
+	case fgbJSON:
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			valueJSON = []byte("null")
+		}
+		return fgbAppendBytes(buf, valueJSON)
+	default:
+		return fgbAppendBytes(buf, []byte(csvValue(value)))
+	}
+}
+
+// fgbAppendBytes strings, JSON, datetimes and binary values are prefixed by their length
+func fgbAppendBytes(buf []byte, value []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
@@ -0,0 +1,229 @@
+package features
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_FlatGeobuf(t *testing.T) {
+	eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+	eng.Config.OgcAPI.Features.Limit.Max = 3
+	features := NewFeatures(eng, chi.NewRouter())
+	req, err := createRequest("http://localhost:8080/collections/:collectionId/items?limit=2", "foo", "", "fgb")
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	features.CollectionContent().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, engine.MediaTypeFlatGeobuf, rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="foo.fgb"`, rr.Header().Get("Content-Disposition"))
+	assert.Empty(t, rr.Header().Get("Link"))
+
+	body := rr.Body.Bytes()
+	assert.Equal(t, fgbMagicBytes, body[:8])
+	header, body := readSizePrefixed(body[8:])
+
+	root := fbRoot(header)
+	assert.Equal(t, "foo", fbString(header, root, 0))
+	assert.Equal(t, fgbUnknown, header[fbField(header, root, 2)])
+	assert.Equal(t, uint64(0), binary.LittleEndian.Uint64(header[fbField(header, root, 8):])) // unknown
+	crs := fbRef(header, fbField(header, root, 10))
+	assert.Equal(t, "EPSG", fbString(header, crs, 0))
+	assert.Equal(t, uint32(28992), binary.LittleEndian.Uint32(header[fbField(header, crs, 1):]))
+
+	columns := fbRef(header, fbField(header, root, 7))
+	idColumn := fbVectorTable(header, columns, 0)
+	assert.Equal(t, "id", fbString(header, idColumn, 0))
+	assert.Equal(t, fgbLong, header[fbField(header, idColumn, 1)])
+
+	// all features regardless of limit, retrieved in pages of 3
+	var feature []byte
+	count := 0
+	for len(body) > 0 {
+		feature, body = readSizePrefixed(body)
+		if count == 0 {
+			root = fbRoot(feature)
+			geometry := fbRef(feature, fbField(feature, root, 0))
+			assert.Equal(t, fgbPoint, feature[fbField(feature, geometry, 6)])
+			xy := fbRef(feature, fbField(feature, geometry, 1))
+			assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(feature[xy:]))
+			assert.Equal(t, 120919.942, math.Float64frombits(binary.LittleEndian.Uint64(feature[xy+4:])))
+			assert.Equal(t, 489320.199, math.Float64frombits(binary.LittleEndian.Uint64(feature[xy+12:])))
+
+			properties := fbRef(feature, fbField(feature, root, 1))
+			assert.Equal(t, uint16(0), binary.LittleEndian.Uint16(feature[properties+4:])) // id column
+			assert.Equal(t, uint64(3542), binary.LittleEndian.Uint64(feature[properties+6:]))
+		}
+		count++
+	}
+	assert.Equal(t, 67, count)
+}
+
+func TestFeatures_FlatGeobuf_EmptyPage(t *testing.T) {
+	eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+	eng.Config.OgcAPI.Features.Limit.Max = 3
+	features := NewFeatures(eng, chi.NewRouter())
+	features.datasource = &emptyPageDatasource{Datasource: features.datasource}
+	req, err := createRequest("http://localhost:8080/collections/:collectionId/items", "foo", "", "fgb")
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	features.CollectionContent().ServeHTTP(rr, req)
+
+	// the export continues after an empty page, only the features of the first page are missing
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, body := readSizePrefixed(rr.Body.Bytes()[8:])
+	count := 0
+	for len(body) > 0 {
+		_, body = readSizePrefixed(body)
+		count++
+	}
+	assert.Equal(t, 67-3, count)
+}
+
+func TestFgbGeometry(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry geom.Geometry
+		want     fbTable
+		wantErr  bool
+	}{
+		{
+			name:     "point",
+			geometry: geom.Point{1, 2},
+			want:     fbTable{1: []float64{1, 2}, 6: fgbPoint},
+		},
+		{
+			name:     "polygon with hole, rings are closed",
+			geometry: geom.Polygon{{{0, 0}, {4, 0}, {4, 4}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+			want: fbTable{
+				0: []uint32{4, 8},
+				1: []float64{0, 0, 4, 0, 4, 4, 0, 0, 1, 1, 2, 1, 2, 2, 1, 1},
+				6: fgbPolygon,
+			},
+		},
+		{
+			name:     "multi polygon",
+			geometry: geom.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+			want: fbTable{
+				6: fgbMultiPolygon,
+				7: []fbTable{{0: []uint32{4}, 1: []float64{0, 0, 1, 0, 1, 1, 0, 0}, 6: fgbPolygon}},
+			},
+		},
+		{
+			name:     "unsupported",
+			geometry: geom.Triangle{{0, 0}, {1, 0}, {1, 1}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fgbGeometry(tt.geometry)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFgbColumns(t *testing.T) {
+	features := []*domain.Feature{
+		{
+			ID: domain.NewTextFeatureID("a"),
+			Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.Point{1, 2}},
+				Properties: map[string]any{"name": "foo", "number": int64(1), "empty": nil},
+			},
+		},
+		{
+			ID: domain.NewTextFeatureID("b"),
+			Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.LineString{{1, 2}, {3, 4}}},
+				Properties: map[string]any{"name": "bar", "number": 1.5, "empty": nil},
+			},
+		},
+	}
+	assert.Equal(t, []fgbColumn{
+		{name: "id", columnType: fgbString},
+		{name: "empty", columnType: fgbString},
+		{name: "name", columnType: fgbString},
+		{name: "number", columnType: fgbString},
+	}, fgbColumns(features))
+	assert.Equal(t, fgbUnknown, fgbCommonGeometryType(features))
+}
+
+func TestFgbPropertyColumns(t *testing.T) {
+	properties := []domain.Property{
+		{Name: "straatnaam", Type: domain.PropertyTypeString},
+		{Name: "huisnummer", Type: domain.PropertyTypeInteger},
+		{Name: "oppervlakte", Type: domain.PropertyTypeNumber},
+		{Name: "datum", Type: domain.PropertyTypeDate},
+		{Name: "onbekend"},
+	}
+	assert.Equal(t, []fgbColumn{
+		{name: "id", columnType: fgbLong},
+		{name: "straatnaam", columnType: fgbString},
+		{name: "huisnummer", columnType: fgbLong},
+		{name: "oppervlakte", columnType: fgbDouble},
+		{name: "datum", columnType: fgbDateTime},
+		{name: "onbekend", columnType: fgbString},
+	}, fgbPropertyColumns(properties, datasources.OutputOptions{}, false))
+	assert.Equal(t, []fgbColumn{
+		{name: "id", columnType: fgbString},
+		{name: "huisnummer", columnType: fgbLong},
+	}, fgbPropertyColumns(properties, datasources.OutputOptions{Properties: []string{"huisnummer"}}, true))
+}
+
+// readSizePrefixed returns the FlatBuffer (without size prefix) and the remainder of the given bytes
+func readSizePrefixed(b []byte) ([]byte, []byte) {
+	size := binary.LittleEndian.Uint32(b)
+	return b[4 : 4+size], b[4+size:]
+}
+
+func fbRoot(buf []byte) int {
+	return fbRef(buf, 0)
+}
+
+// fbField position of the given field in the table, 0 when absent
+func fbField(buf []byte, table int, id int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(buf[table:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(buf[vtable:])) {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(buf[vtable+4+2*id:]))
+	if offset == 0 {
+		return 0
+	}
+	return table + offset
+}
+
+func fbRef(buf []byte, pos int) int {
+	return pos + int(binary.LittleEndian.Uint32(buf[pos:]))
+}
+
+func fbString(buf []byte, table int, id int) string {
+	str := fbRef(buf, fbField(buf, table, id))
+	length := int(binary.LittleEndian.Uint32(buf[str:]))
+	return string(buf[str+4 : str+4+length])
+}
+
+func fbVectorTable(buf []byte, vector int, i int) int {
+	return fbRef(buf, vector+4+4*i)
+}
@@ -0,0 +1,61 @@
+package features
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+// foreignMembers custom members of GeoJSON documents of a collection, pre-encoded as JSON objects.
+// Nil when the collection has no such members.
+type foreignMembers struct {
+	featureCollection []byte
+	feature           []byte
+}
+
+// foreignMembersByCollectionID foreign members per collection, see ForeignMembers in config
+type foreignMembersByCollectionID map[string]foreignMembers
+
+func newForeignMembers(collections engine.GeoSpatialCollections) foreignMembersByCollectionID {
+	result := make(foreignMembersByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || collection.Features.ForeignMembers == nil {
+			continue
+		}
+		featureCollection, err := encodeForeignMembers(collection.Features.ForeignMembers.FeatureCollection)
+		if err != nil {
+			log.Fatalf("invalid foreign members of FeatureCollection in collection %s: %v", collection.ID, err)
+		}
+		feature, err := encodeForeignMembers(collection.Features.ForeignMembers.Feature)
+		if err != nil {
+			log.Fatalf("invalid foreign members of Feature in collection %s: %v", collection.ID, err)
+		}
+		result[collection.ID] = foreignMembers{featureCollection: featureCollection, feature: feature}
+	}
+	return result
+}
+
+func encodeForeignMembers(members map[string]any) ([]byte, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return toJSON(members)
+}
+
+// addForeignMembers adds the given members (JSON object) as the last members of the given JSON object
+func addForeignMembers(members []byte, inputJSON []byte) ([]byte, error) {
+	if members == nil {
+		return inputJSON, nil
+	}
+	if len(inputJSON) < 2 || inputJSON[0] != '{' || inputJSON[len(inputJSON)-1] != '}' {
+		return nil, fmt.Errorf("expected JSON object, can't add foreign members")
+	}
+	// merge {...} and {"member":...} into {...,"member":...}
+	result := make([]byte, 0, len(inputJSON)+len(members))
+	result = append(result, inputJSON[:len(inputJSON)-1]...)
+	if string(inputJSON) != "{}" {
+		result = append(result, ',')
+	}
+	return append(result, members[1:]...), nil
+}
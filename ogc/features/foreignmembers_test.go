@@ -0,0 +1,118 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddForeignMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []byte
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "no members",
+			input: `{"type":"Feature"}`,
+			want:  `{"type":"Feature"}`,
+		},
+		{
+			name:    "add members",
+			members: []byte(`{"conformsTo":["https://example.com/profile"],"doi":"10.1234/abcd"}`),
+			input:   `{"type":"FeatureCollection","features":[]}`,
+			want:    `{"type":"FeatureCollection","features":[],"conformsTo":["https://example.com/profile"],"doi":"10.1234/abcd"}`,
+		},
+		{
+			name:    "empty object",
+			members: []byte(`{"doi":"10.1234/abcd"}`),
+			input:   `{}`,
+			want:    `{"doi":"10.1234/abcd"}`,
+		},
+		{
+			name:    "fail on non-object",
+			members: []byte(`{"doi":"10.1234/abcd"}`),
+			input:   `["foo"]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addForeignMembers(tt.members, []byte(tt.input))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestJSONFeatures_ForeignMembers(t *testing.T) {
+	collections := engine.GeoSpatialCollections{
+		{
+			ID: "foo",
+			Features: &engine.CollectionEntryFeatures{
+				ForeignMembers: &engine.FeatureForeignMembers{
+					FeatureCollection: map[string]any{"conformsTo": []any{"https://example.com/profile"}},
+					Feature:           map[string]any{"featureType": "Address"},
+				},
+			},
+		},
+		{
+			ID:       "bar",
+			Features: &engine.CollectionEntryFeatures{},
+		},
+	}
+	fc := &domain.FeatureCollection{
+		NumberReturned: 1,
+		Features: []*domain.Feature{{
+			ID: domain.NewFeatureID(1),
+			Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.Point{5.2, 52.1}},
+				Properties: map[string]any{"straatnaam": "Silodam"},
+			},
+		}},
+	}
+	tests := []struct {
+		name            string
+		collectionID    string
+		maxResponseSize int
+		want            string
+	}{
+		{
+			name:         "collection with foreign members",
+			collectionID: "foo",
+			want: `{"numberReturned":1,"type":"FeatureCollection","features":[{"id":1,"type":"Feature","geometry":{"type":"Point","coordinates":[5.2,52.1]},` +
+				`"properties":{"straatnaam":"Silodam"},"featureType":"Address"}],"conformsTo":["https://example.com/profile"]}`,
+		},
+		{
+			name:            "collection with foreign members and max response size",
+			collectionID:    "foo",
+			maxResponseSize: 1024,
+			want: `{"numberReturned":1,"type":"FeatureCollection","features":[{"id":1,"type":"Feature","geometry":{"type":"Point","coordinates":[5.2,52.1]},` +
+				`"properties":{"straatnaam":"Silodam"},"featureType":"Address"}],"conformsTo":["https://example.com/profile"]}`,
+		},
+		{
+			name:         "collection without foreign members",
+			collectionID: "bar",
+			want: `{"numberReturned":1,"type":"FeatureCollection","features":[{"id":1,"type":"Feature","geometry":{"type":"Point","coordinates":[5.2,52.1]},` +
+				`"properties":{"straatnaam":"Silodam"}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jf := &jsonFeatures{foreignMembers: newForeignMembers(collections), maxResponseSize: tt.maxResponseSize}
+			got, err := jf.featureCollectionToJSON(tt.collectionID, fc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package features
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+// GeoJSON text sequences (RFC 8142) consist of records, each record is a GeoJSON
+// feature prefixed by a record separator and terminated by a line feed
+const (
+	geoJSONSeqRecordSeparator = 0x1E
+	geoJSONSeqLineFeed        = '\n'
+)
+
+// featuresAsGeoJSONSeq serves a page of features as GeoJSON text sequence, so clients can process features one
+// by one instead of parsing one large document. Features are written as they're returned by next (nil when done).
+// The next/prev page is linked using Link headers (RFC 8288), since a text sequence has no room for links.
+func (jf *jsonFeatures) featuresAsGeoJSONSeq(w http.ResponseWriter, collectionID string, cursor domain.Cursors,
+	featuresURL featureCollectionURL, next func() (*domain.Feature, error)) error {
+
+	featuresURL.setPaginationLinkHeaders(w, collectionID, cursor, engine.FormatGeoJSONSeq, engine.MediaTypeGeoJSONSeq)
+	return jf.writeGeoJSONSeq(w, collectionID, next)
+}
+
+// featureAsGeoJSONSeq serves a single feature as GeoJSON text sequence of one record
+func (jf *jsonFeatures) featureAsGeoJSONSeq(w http.ResponseWriter, collectionID string, feat *domain.Feature) error {
+	return jf.writeGeoJSONSeq(w, collectionID, sliceFeatures([]*domain.Feature{feat}))
+}
+
+func (jf *jsonFeatures) writeGeoJSONSeq(w http.ResponseWriter, collectionID string, next func() (*domain.Feature, error)) error {
+	w.Header().Set("Content-Type", engine.MediaTypeGeoJSONSeq)
+	members := jf.foreignMembers[collectionID]
+	writer := newStreamWriter(w)
+	for {
+		feat, err := next()
+		if err != nil {
+			return writer.fail(fmt.Sprintf("failed to retrieve features of collection %s", collectionID), err)
+		}
+		if feat == nil {
+			break
+		}
+		featJSON, err := toJSON(feat)
+		if err == nil {
+			featJSON, err = addForeignMembers(members.feature, featJSON)
+		}
+		if err != nil {
+			return writer.fail("Failed to marshal feature to JSON", err)
+		}
+		writer.write([]byte{geoJSONSeqRecordSeparator})
+		writer.write(featJSON)
+		writer.write([]byte{geoJSONSeqLineFeed})
+	}
+	if err := writer.Flush(); err != nil {
+		log.Printf("failed to write features of collection %s: %v", collectionID, err)
+	}
+	return nil
+}
+
+// sliceFeatures returns the given features one by one, for use with formats which stream features
+func sliceFeatures(features []*domain.Feature) func() (*domain.Feature, error) {
+	i := 0
+	return func() (*domain.Feature, error) {
+		if i >= len(features) {
+			return nil, nil
+		}
+		i++
+		return features[i-1], nil
+	}
+}
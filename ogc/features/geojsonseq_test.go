@@ -0,0 +1,120 @@
+package features
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_GeoJSONSeq(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		featureID    string
+		wantFeatures []string
+		wantNextLink bool
+	}{
+		{
+			name:         "Features as GeoJSON text sequence",
+			url:          "http://localhost:8080/collections/:collectionId/items?limit=2",
+			wantFeatures: []string{"3542", "3837"},
+			wantNextLink: true,
+		},
+		{
+			name:         "Feature as GeoJSON text sequence",
+			url:          "http://localhost:8080/collections/:collectionId/items/:featureId",
+			featureID:    "4030",
+			wantFeatures: []string{"4030"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest(tt.url, "foo", tt.featureID, engine.FormatGeoJSONSeq)
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			if tt.featureID != "" {
+				features.Feature().ServeHTTP(rr, req)
+			} else {
+				features.CollectionContent().ServeHTTP(rr, req)
+			}
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, engine.MediaTypeGeoJSONSeq, rr.Header().Get("Content-Type"))
+			if tt.wantNextLink {
+				assert.Contains(t, rr.Header().Get("Link"), `rel="next"; type="application/geo+json-seq"`)
+			}
+			var ids []string
+			for _, record := range readGeoJSONSeq(t, rr.Body.Bytes()) {
+				assert.Equal(t, "Feature", record["type"])
+				ids = append(ids, string(record["id"].(json.Number)))
+			}
+			assert.Equal(t, tt.wantFeatures, ids)
+		})
+	}
+}
+
+func TestJSONFeatures_writeGeoJSONSeq(t *testing.T) {
+	jf := &jsonFeatures{}
+	features := []*domain.Feature{
+		{ID: domain.NewTextFeatureID("a"), Feature: geojson.Feature{Properties: map[string]any{"name": "line\nbreak"}}},
+		{ID: domain.NewTextFeatureID("b"), Feature: geojson.Feature{Properties: map[string]any{}}},
+	}
+
+	t.Run("records", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		require.NoError(t, jf.writeGeoJSONSeq(rr, "foo", sliceFeatures(features)))
+		records := readGeoJSONSeq(t, rr.Body.Bytes())
+		require.Len(t, records, 2)
+		assert.Equal(t, "line\nbreak", records[0]["properties"].(map[string]any)["name"])
+	})
+
+	t.Run("no features", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		require.NoError(t, jf.writeGeoJSONSeq(rr, "foo", sliceFeatures(nil)))
+		assert.Empty(t, rr.Body.Bytes())
+	})
+
+	t.Run("error before anything is sent", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		err := jf.writeGeoJSONSeq(rr, "foo", func() (*domain.Feature, error) {
+			return nil, errors.New("datasource failed")
+		})
+		var apiErr *engine.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+		assert.Empty(t, rr.Body.Bytes())
+	})
+}
+
+// readGeoJSONSeq returns the records in the given GeoJSON text sequence, while checking it's well-formed (RFC 8142)
+func readGeoJSONSeq(t *testing.T, seq []byte) []map[string]any {
+	t.Helper()
+	require.NotEmpty(t, seq)
+	require.Equal(t, byte(geoJSONSeqRecordSeparator), seq[0])
+
+	var records []map[string]any
+	for _, record := range bytes.Split(seq[1:], []byte{geoJSONSeqRecordSeparator}) {
+		require.True(t, bytes.HasSuffix(record, []byte{geoJSONSeqLineFeed}), "record should end with a line feed")
+		decoder := json.NewDecoder(bytes.NewReader(record))
+		decoder.UseNumber()
+		var decoded map[string]any
+		require.NoError(t, decoder.Decode(&decoded))
+		records = append(records, decoded)
+	}
+	return records
+}
@@ -0,0 +1,477 @@
+package features
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/wkb"
+)
+
+// Parquet constants, see https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	parquetBoolean   int32 = 0 // physical types
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+
+	parquetRequired int32 = 0 // repetition types
+	parquetOptional int32 = 1
+
+	parquetNoConvertedType int32 = -1 // converted types
+	parquetUTF8            int32 = 0
+	parquetDate            int32 = 6
+	parquetTimestampMicros int32 = 10
+
+	parquetPlain        int32 = 0 // encodings
+	parquetRLE          int32 = 3
+	parquetDataPage     int32 = 0
+	parquetUncompressed int32 = 0
+
+	geoParquetVersion = "1.1.0"
+
+	// names of the columns holding the feature id and geometry in GeoParquet
+	parquetIDColumn       = "id"
+	parquetGeometryColumn = "geometry"
+)
+
+var parquetMagicBytes = []byte("PAR1")
+
+// parquetColumn a column in a Parquet file, the value of each feature is
+// converted to the Go type of the physical type (or nil when absent)
+type parquetColumn struct {
+	name          string
+	physicalType  int32
+	convertedType int32
+	required      bool
+	value         func(feat *domain.Feature) any
+}
+
+// exportGeoParquet serves all features of the collection matching the given options as a single GeoParquet file,
+// without pagination. The features are retrieved from the datasource page by page (of the max limit), each page
+// is written to the client as a Parquet row group. So memory usage is bounded by the size of a page, even for large
+// collections. Note GeoParquet responses are therefore never coalesced, see engine.RequestCoalescer.
+func (f *Features) exportGeoParquet(w http.ResponseWriter, r *http.Request, collectionID string,
+	url featureCollectionURL, options datasources.FeatureOptions) error {
+
+	if options.Nearest != nil || options.Search != "" {
+		return engine.BadRequest("GeoParquet is a bulk export of (filtered) features, nearest and q params aren't supported")
+	}
+	if url.params.Get(expandParam) != "" {
+		return engine.BadRequest("GeoParquet is a bulk export of (filtered) features, the expand param isn't supported")
+	}
+	properties, err := f.datasource.GetProperties(collectionID)
+	if err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to retrieve properties of collection %s", collectionID), err)
+	}
+	crs, err := f.responseCrs(collectionID, url.params)
+	if err != nil {
+		return err
+	}
+	_, textFid := f.fidTypes[collectionID]
+	columns := parquetColumns(properties, options.OutputOptions, textFid)
+	options.Limit = f.engine.Config.OgcAPI.Features.Limit.Max
+
+	var writer *parquetWriter
+	var buffered *bufio.Writer
+	stats := newGeoParquetStats()
+	for {
+		fc, cursor, err := f.datasource.GetFeatures(r.Context(), collectionID, options)
+		if err != nil {
+			if writer == nil {
+				return datasourceError(fmt.Sprintf("failed to retrieve feature collection %s", collectionID), err)
+			}
+			// headers are already sent, so we can only abort the response (the Parquet file lacks a footer)
+			log.Printf("failed to retrieve features of collection %s for GeoParquet export: %v", collectionID, err)
+			return nil
+		}
+		if writer == nil {
+			w.Header().Set("Content-Type", engine.MediaTypeGeoParquet)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.parquet"`, collectionID))
+			buffered = bufio.NewWriter(w)
+			writer = newParquetWriter(buffered, columns)
+		}
+		// a page may be empty while more pages follow, only the cursor tells whether we're done
+		if fc != nil && len(fc.Features) > 0 {
+			f.timeZones.normalize(collectionID, fc.Features)
+			stats.add(fc.Features)
+			if err = writer.writeRowGroup(fc.Features); err != nil {
+				log.Printf("failed to write GeoParquet of collection %s: %v", collectionID, err)
+				return nil
+			}
+		}
+		if !cursor.HasNext {
+			break
+		}
+		if options.Offset != nil {
+			next := *options.Offset + options.Limit
+			options.Offset = &next
+		} else {
+			options.Cursor = cursor.Next.Decode(url.checksum())
+		}
+	}
+
+	var keyValues []thriftStruct
+	if !options.SkipGeometry {
+		geo, err := stats.metadata(crs)
+		if err != nil {
+			log.Printf("failed to encode GeoParquet metadata of collection %s: %v", collectionID, err)
+			return nil
+		}
+		keyValues = append(keyValues, thriftStruct{1: "geo", 2: geo})
+	}
+	if err = writer.close(keyValues); err != nil {
+		log.Printf("failed to write GeoParquet of collection %s: %v", collectionID, err)
+		return nil
+	}
+	if err = buffered.Flush(); err != nil {
+		log.Printf("failed to write GeoParquet of collection %s: %v", collectionID, err)
+	}
+	return nil
+}
+
+// parquetColumns the id column, the (requested) properties of the collection and the geometry column as WKB
+func parquetColumns(properties []domain.Property, options datasources.OutputOptions, textFid bool) []parquetColumn {
+	result := make([]parquetColumn, 0, len(properties)+2)
+	if textFid {
+		result = append(result, parquetColumn{name: parquetIDColumn, physicalType: parquetByteArray,
+			convertedType: parquetUTF8, required: true, value: func(feat *domain.Feature) any {
+				return []byte(feat.ID.String())
+			}})
+	} else {
+		result = append(result, parquetColumn{name: parquetIDColumn, physicalType: parquetInt64,
+			convertedType: parquetNoConvertedType, required: true, value: func(feat *domain.Feature) any {
+				id, _ := feat.ID.Value()
+				return id
+			}})
+	}
+	for _, property := range properties {
+		if len(options.Properties) > 0 && !slices.Contains(options.Properties, property.Name) {
+			continue
+		}
+		result = append(result, parquetPropertyColumn(property))
+	}
+	if !options.SkipGeometry {
+		result = append(result, parquetColumn{name: parquetGeometryColumn, physicalType: parquetByteArray,
+			convertedType: parquetNoConvertedType, value: func(feat *domain.Feature) any {
+				if feat.Geometry.Geometry == nil {
+					return nil
+				}
+				geometry, err := wkb.EncodeBytes(feat.Geometry.Geometry)
+				if err != nil {
+					log.Printf("failed to encode geometry of feature %s to WKB: %v", feat.ID, err)
+					return nil
+				}
+				return geometry
+			}})
+	}
+	return result
+}
+
+// parquetPropertyColumn maps the type of the property to Parquet. Values that don't match the type
+// (e.g. malformed dates) are absent, properties without a (known) type are stored as text.
+func parquetPropertyColumn(property domain.Property) parquetColumn {
+	column := parquetColumn{name: property.Name, convertedType: parquetNoConvertedType}
+	switch property.Type {
+	case domain.PropertyTypeBoolean:
+		column.physicalType = parquetBoolean
+		column.value = func(feat *domain.Feature) any {
+			if v, ok := feat.Properties[property.Name].(bool); ok {
+				return v
+			}
+			return nil
+		}
+	case domain.PropertyTypeInteger:
+		column.physicalType = parquetInt64
+		column.value = func(feat *domain.Feature) any {
+			if v, ok := feat.Properties[property.Name].(int64); ok {
+				return v
+			}
+			return nil
+		}
+	case domain.PropertyTypeNumber:
+		column.physicalType = parquetDouble
+		column.value = func(feat *domain.Feature) any {
+			switch v := feat.Properties[property.Name].(type) {
+			case float64:
+				return v
+			case int64:
+				return float64(v)
+			}
+			return nil
+		}
+	case domain.PropertyTypeDate:
+		column.physicalType, column.convertedType = parquetInt32, parquetDate
+		column.value = func(feat *domain.Feature) any {
+			if v, ok := feat.Properties[property.Name].(time.Time); ok {
+				date := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+				return int32(date.Unix() / (24 * 60 * 60)) // days since epoch
+			}
+			return nil
+		}
+	case domain.PropertyTypeDateTime:
+		column.physicalType, column.convertedType = parquetInt64, parquetTimestampMicros
+		column.value = func(feat *domain.Feature) any {
+			if v, ok := feat.Properties[property.Name].(time.Time); ok {
+				return v.UnixMicro()
+			}
+			return nil
+		}
+	default:
+		column.physicalType, column.convertedType = parquetByteArray, parquetUTF8
+		column.value = func(feat *domain.Feature) any {
+			if v := feat.Properties[property.Name]; v != nil {
+				return []byte(csvValue(v))
+			}
+			return nil
+		}
+	}
+	return column
+}
+
+// encodePage encodes the given values as a single (uncompressed) data page with PLAIN encoding
+func (c parquetColumn) encodePage(values []any) ([]byte, error) {
+	var data []byte
+	if !c.required {
+		// definition levels (1 when present, 0 when null) as a single bit-packed run of the RLE/bit-packing hybrid
+		levels := make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			if v != nil {
+				levels[i/8] |= 1 << (i % 8)
+			}
+		}
+		run := binary.AppendUvarint(nil, uint64(len(levels))<<1|1) // number of groups of 8 values, bit-packed
+		run = append(run, levels...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(run)))
+		data = append(data, run...)
+	}
+	var booleans []byte
+	var numBooleans int
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			continue // null, only in the definition levels
+		case bool:
+			if numBooleans%8 == 0 {
+				booleans = append(booleans, 0)
+			}
+			if v {
+				booleans[len(booleans)-1] |= 1 << (numBooleans % 8)
+			}
+			numBooleans++
+		case int32:
+			data = binary.LittleEndian.AppendUint32(data, uint32(v))
+		case int64:
+			data = binary.LittleEndian.AppendUint64(data, uint64(v))
+		case float64:
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+		case []byte:
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(v)))
+			data = append(data, v...)
+		default:
+			return nil, fmt.Errorf("unsupported value %T in column %s", value, c.name)
+		}
+	}
+	data = append(data, booleans...)
+
+	header, err := encodeThriftCompact(thriftStruct{
+		1: parquetDataPage,
+		2: int32(len(data)), // uncompressed size
+		3: int32(len(data)), // compressed size
+		5: thriftStruct{1: int32(len(values)), 2: parquetPlain, 3: parquetRLE, 4: parquetRLE},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(header, data...), nil
+}
+
+// parquetWriter writes a Parquet file, one row group at a time. The metadata (schema,
+// location of the row groups) is written at the end, see https://parquet.apache.org/docs/file-format.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []parquetColumn
+	rowGroups []thriftStruct
+	numRows   int64
+}
+
+func newParquetWriter(w io.Writer, columns []parquetColumn) *parquetWriter {
+	return &parquetWriter{w: w, columns: columns}
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+// begin writes the magic bytes at the start of the file
+func (pw *parquetWriter) begin() error {
+	if pw.offset > 0 {
+		return nil
+	}
+	return pw.write(parquetMagicBytes)
+}
+
+// writeRowGroup writes the given features as a row group, with a column chunk (of one page) per column
+func (pw *parquetWriter) writeRowGroup(features []*domain.Feature) error {
+	if err := pw.begin(); err != nil {
+		return err
+	}
+	chunks := make([]thriftStruct, 0, len(pw.columns))
+	var size int64
+	for _, column := range pw.columns {
+		values := make([]any, 0, len(features))
+		for _, feat := range features {
+			values = append(values, column.value(feat))
+		}
+		page, err := column.encodePage(values)
+		if err != nil {
+			return err
+		}
+		pageOffset := pw.offset
+		if err = pw.write(page); err != nil {
+			return err
+		}
+		chunks = append(chunks, thriftStruct{
+			2: pageOffset, // file offset
+			3: thriftStruct{
+				1: column.physicalType,
+				2: []int32{parquetPlain, parquetRLE},
+				3: []string{column.name}, // path in schema
+				4: parquetUncompressed,
+				5: int64(len(values)),
+				6: int64(len(page)), // uncompressed size
+				7: int64(len(page)), // compressed size
+				9: pageOffset,       // data page offset
+			},
+		})
+		size += int64(len(page))
+	}
+	pw.rowGroups = append(pw.rowGroups, thriftStruct{1: chunks, 2: size, 3: int64(len(features))})
+	pw.numRows += int64(len(features))
+	return nil
+}
+
+// close writes the metadata (including the given key/value metadata) which completes the Parquet file
+func (pw *parquetWriter) close(keyValues []thriftStruct) error {
+	if err := pw.begin(); err != nil {
+		return err
+	}
+	schema := make([]thriftStruct, 0, len(pw.columns)+1)
+	schema = append(schema, thriftStruct{4: "schema", 5: int32(len(pw.columns))}) // root
+	for _, column := range pw.columns {
+		element := make(thriftStruct, 7)
+		element[1] = column.physicalType
+		element[3] = parquetOptional
+		if column.required {
+			element[3] = parquetRequired
+		}
+		element[4] = column.name
+		if column.convertedType != parquetNoConvertedType {
+			element[6] = column.convertedType
+		}
+		schema = append(schema, element)
+	}
+	rowGroups := pw.rowGroups
+	if rowGroups == nil {
+		rowGroups = []thriftStruct{}
+	}
+	metadata := thriftStruct{1: int32(1), 2: schema, 3: pw.numRows, 4: rowGroups, 6: "GoKoala"}
+	if len(keyValues) > 0 {
+		metadata[5] = keyValues
+	}
+	footer, err := encodeThriftCompact(metadata)
+	if err != nil {
+		return err
+	}
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagicBytes...)
+	return pw.write(footer)
+}
+
+// geoParquetStats collects the geometry types and extent of the exported features, for the GeoParquet metadata
+type geoParquetStats struct {
+	geometryTypes []string
+	extent        *geom.Extent
+}
+
+func newGeoParquetStats() *geoParquetStats {
+	return &geoParquetStats{geometryTypes: []string{}}
+}
+
+func (s *geoParquetStats) add(features []*domain.Feature) {
+	for _, feat := range features {
+		g := feat.Geometry.Geometry
+		if g == nil {
+			continue
+		}
+		if geometryType := geoParquetGeometryType(g); geometryType != "" && !slices.Contains(s.geometryTypes, geometryType) {
+			s.geometryTypes = append(s.geometryTypes, geometryType)
+		}
+		extent, err := geom.NewExtentFromGeometry(g)
+		if err != nil {
+			continue
+		}
+		if s.extent == nil {
+			s.extent = extent
+		} else {
+			s.extent.Add(extent)
+		}
+	}
+}
+
+// metadata the GeoParquet metadata (https://geoparquet.org/releases/v1.1.0) of the geometry column as JSON
+func (s *geoParquetStats) metadata(crs int) (string, error) {
+	column := map[string]any{
+		"encoding":       "WKB",
+		"geometry_types": s.geometryTypes,
+	}
+	if crs != wgs84SRID {
+		// PROJJSON identifying the CRS, when absent the default OGC:CRS84 applies
+		column["crs"] = map[string]any{"id": map[string]any{"authority": "EPSG", "code": crs}}
+	}
+	if s.extent != nil {
+		column["bbox"] = []float64{s.extent.MinX(), s.extent.MinY(), s.extent.MaxX(), s.extent.MaxY()}
+	}
+	result, err := json.Marshal(map[string]any{
+		"version":        geoParquetVersion,
+		"primary_column": parquetGeometryColumn,
+		"columns":        map[string]any{parquetGeometryColumn: column},
+	})
+	return string(result), err
+}
+
+func geoParquetGeometryType(g geom.Geometry) string {
+	switch g.(type) {
+	case geom.Point:
+		return "Point"
+	case geom.MultiPoint:
+		return "MultiPoint"
+	case geom.LineString:
+		return "LineString"
+	case geom.MultiLineString:
+		return "MultiLineString"
+	case geom.Polygon:
+		return "Polygon"
+	case geom.MultiPolygon:
+		return "MultiPolygon"
+	case geom.Collection:
+		return "GeometryCollection"
+	default:
+		return ""
+	}
+}
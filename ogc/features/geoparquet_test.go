@@ -0,0 +1,281 @@
+package features
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/wkb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_GeoParquet(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		wantStatusCode int
+		wantRows       int64
+		wantRowGroups  int
+	}{
+		{
+			name:           "All features as GeoParquet, regardless of limit",
+			url:            "http://localhost:8080/collections/:collectionId/items?limit=2",
+			wantStatusCode: http.StatusOK,
+			wantRows:       67,
+			wantRowGroups:  23, // 3 features per row group
+		},
+		{
+			name:           "Filtered features as GeoParquet",
+			url:            "http://localhost:8080/collections/:collectionId/items?straatnaam=Realengracht",
+			wantStatusCode: http.StatusOK,
+			wantRows:       7,
+			wantRowGroups:  3,
+		},
+		{
+			name:           "Nearest isn't supported",
+			url:            "http://localhost:8080/collections/:collectionId/items?nearest=POINT(120919%20489320)",
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			eng.Config.OgcAPI.Features.Limit.Max = 3
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest(tt.url, "foo", "", "parquet")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, engine.MediaTypeGeoParquet, rr.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="foo.parquet"`, rr.Header().Get("Content-Disposition"))
+
+			file := rr.Body.Bytes()
+			metadata := readParquetMetadata(t, file)
+			assert.Equal(t, tt.wantRows, metadata[3])
+			assert.Len(t, metadata[4], tt.wantRowGroups)
+
+			schema := metadata[2].([]any)
+			assert.Equal(t, "id", string(schema[1].(map[int]any)[4].([]byte)))
+			assert.Equal(t, "geometry", string(schema[len(schema)-1].(map[int]any)[4].([]byte)))
+
+			keyValue := metadata[5].([]any)[0].(map[int]any)
+			assert.Equal(t, "geo", string(keyValue[1].([]byte)))
+			var geo map[string]any
+			assert.NoError(t, json.Unmarshal(keyValue[2].([]byte), &geo))
+			assert.Equal(t, "geometry", geo["primary_column"])
+			assert.Equal(t, []any{"Point"}, geo["columns"].(map[string]any)["geometry"].(map[string]any)["geometry_types"])
+
+			// every column chunk starts with a page header holding all rows of the row group
+			var rows int64
+			for _, rowGroup := range metadata[4].([]any) {
+				numRows := rowGroup.(map[int]any)[3].(int64)
+				for _, chunk := range rowGroup.(map[int]any)[1].([]any) {
+					offset := chunk.(map[int]any)[3].(map[int]any)[9].(int64)
+					page, _ := decodeThriftStruct(file[offset:])
+					assert.Equal(t, numRows, int64(page[5].(map[int]any)[1].(int32)))
+				}
+				rows += numRows
+			}
+			assert.Equal(t, tt.wantRows, rows)
+		})
+	}
+}
+
+// emptyPageDatasource datasource stub, returns an empty first page which still has a next page
+type emptyPageDatasource struct {
+	datasources.Datasource
+	emptied bool
+}
+
+func (ds *emptyPageDatasource) GetFeatures(ctx context.Context, collection string,
+	options datasources.FeatureOptions) (*domain.FeatureCollection, domain.Cursors, error) {
+
+	fc, cursor, err := ds.Datasource.GetFeatures(ctx, collection, options)
+	if !ds.emptied && fc != nil {
+		ds.emptied = true
+		fc.Features, fc.NumberReturned = nil, 0
+	}
+	return fc, cursor, err
+}
+
+func TestFeatures_GeoParquet_EmptyPage(t *testing.T) {
+	eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+	eng.Config.OgcAPI.Features.Limit.Max = 3
+	features := NewFeatures(eng, chi.NewRouter())
+	features.datasource = &emptyPageDatasource{Datasource: features.datasource}
+	req, err := createRequest("http://localhost:8080/collections/:collectionId/items", "foo", "", "parquet")
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	features.CollectionContent().ServeHTTP(rr, req)
+
+	// the export continues after an empty page, only the features of the first page are missing
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(67-3), readParquetMetadata(t, rr.Body.Bytes())[3])
+}
+
+func TestParquetColumn_encodePage(t *testing.T) {
+	values := []any{int64(1), nil, int64(3)}
+	page, err := parquetColumn{name: "number", physicalType: parquetInt64}.encodePage(values)
+	require.NoError(t, err)
+
+	header, n := decodeThriftStruct(page)
+	data := page[n:]
+	assert.Equal(t, int32(len(data)), header[2])
+	assert.Equal(t, int32(3), header[5].(map[int]any)[1])
+
+	// definition levels: length, bit-packed run of 1 group, 101 (the second value is null)
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data))
+	assert.Equal(t, []byte{1<<1 | 1, 0b101}, data[4:6])
+	assert.Equal(t, uint64(1), binary.LittleEndian.Uint64(data[6:]))
+	assert.Equal(t, uint64(3), binary.LittleEndian.Uint64(data[14:]))
+	assert.Len(t, data, 22)
+}
+
+func TestParquetPropertyColumn(t *testing.T) {
+	date := time.Date(1970, 1, 3, 15, 0, 0, 0, time.UTC)
+	feat := &domain.Feature{}
+	feat.Properties = map[string]any{
+		"flag":   true,
+		"number": int64(2),
+		"date":   date,
+		"moment": date,
+		"text":   "foo",
+		"other":  3.5,
+		"wrong":  "not a number",
+	}
+	tests := []struct {
+		property domain.Property
+		want     any
+	}{
+		{property: domain.Property{Name: "flag", Type: domain.PropertyTypeBoolean}, want: true},
+		{property: domain.Property{Name: "number", Type: domain.PropertyTypeNumber}, want: float64(2)},
+		{property: domain.Property{Name: "date", Type: domain.PropertyTypeDate}, want: int32(2)},
+		{property: domain.Property{Name: "moment", Type: domain.PropertyTypeDateTime}, want: date.UnixMicro()},
+		{property: domain.Property{Name: "text", Type: domain.PropertyTypeString}, want: []byte("foo")},
+		{property: domain.Property{Name: "other"}, want: []byte("3.5")},
+		{property: domain.Property{Name: "wrong", Type: domain.PropertyTypeInteger}, want: nil},
+		{property: domain.Property{Name: "absent", Type: domain.PropertyTypeInteger}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.property.Name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parquetPropertyColumn(tt.property).value(feat))
+		})
+	}
+}
+
+func TestGeoParquetStats(t *testing.T) {
+	stats := newGeoParquetStats()
+	point := &domain.Feature{}
+	point.Geometry.Geometry = geom.Point{1, 2}
+	line := &domain.Feature{}
+	line.Geometry.Geometry = geom.LineString{{0, 0}, {3, 4}}
+	stats.add([]*domain.Feature{point, line, point, {}})
+
+	metadata, err := stats.metadata(28992)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": "1.1.0",
+		"primary_column": "geometry",
+		"columns": {
+			"geometry": {
+				"encoding": "WKB",
+				"geometry_types": ["Point", "LineString"],
+				"bbox": [0, 0, 3, 4],
+				"crs": {"id": {"authority": "EPSG", "code": 28992}}
+			}
+		}
+	}`, metadata)
+
+	geometry, err := wkb.DecodeBytes(parquetColumns(nil, datasources.OutputOptions{}, false)[1].value(point).([]byte))
+	require.NoError(t, err)
+	assert.Equal(t, geom.Point{1, 2}, geometry)
+}
+
+// readParquetMetadata verifies the magic bytes and decodes the FileMetaData in the footer of the Parquet file
+func readParquetMetadata(t *testing.T, file []byte) map[int]any {
+	t.Helper()
+	require.Equal(t, "PAR1", string(file[:4]))
+	require.Equal(t, "PAR1", string(file[len(file)-4:]))
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metadata, n := decodeThriftStruct(file[len(file)-8-length : len(file)-8])
+	require.Equal(t, length, n)
+	return metadata
+}
+
+// decodeThriftStruct decodes a struct in the Thrift compact protocol (just enough for Parquet metadata),
+// returns the fields by id and the number of bytes read
+func decodeThriftStruct(buf []byte) (map[int]any, int) {
+	result := make(map[int]any)
+	pos, lastID := 0, 0
+	for {
+		header := buf[pos]
+		pos++
+		if header == 0 {
+			return result, pos
+		}
+		fieldType := header & 0x0F
+		if delta := int(header >> 4); delta > 0 {
+			lastID += delta
+		} else {
+			id, n := binary.Uvarint(buf[pos:])
+			pos += n
+			lastID = int(int64(id>>1) ^ -int64(id&1))
+		}
+		value, n := decodeThriftValue(buf[pos:], fieldType)
+		pos += n
+		result[lastID] = value
+	}
+}
+
+func decodeThriftValue(buf []byte, valueType byte) (any, int) {
+	switch valueType {
+	case thriftTypeTrue:
+		return true, 0
+	case thriftTypeFalse:
+		return false, 0
+	case thriftTypeI32, thriftTypeI64:
+		v, n := binary.Uvarint(buf)
+		decoded := int64(v>>1) ^ -int64(v&1)
+		if valueType == thriftTypeI32 {
+			return int32(decoded), n
+		}
+		return decoded, n
+	case thriftTypeBinary:
+		length, n := binary.Uvarint(buf)
+		return buf[n : n+int(length)], n + int(length)
+	case thriftTypeStruct:
+		return decodeThriftStruct(buf)
+	case thriftTypeList:
+		size, elementType, pos := int(buf[0]>>4), buf[0]&0x0F, 1
+		if size == 15 {
+			s, n := binary.Uvarint(buf[1:])
+			size, pos = int(s), 1+n
+		}
+		result := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			value, n := decodeThriftValue(buf[pos:], elementType)
+			result = append(result, value)
+			pos += n
+		}
+		return result, pos
+	}
+	panic("unsupported thrift type")
+}
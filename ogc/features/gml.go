@@ -0,0 +1,278 @@
+package features
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+)
+
+const (
+	gmlNamespace  = "http://www.opengis.net/gml/3.2"
+	sfNamespace   = "http://www.opengis.net/ogcapi-features-1/1.0/sf"
+	atomNamespace = "http://www.w3.org/2005/Atom"
+	sfSchema      = "http://schemas.opengis.net/ogcapi/features/part1/1.0/xml/core-sf.xsd"
+
+	// name of the element holding the geometry of a feature
+	gmlGeometryProperty = "geometry"
+)
+
+// gmlFeatures serves features as GML 3.2 according to the Simple Features profile level 0 (SF-0),
+// see https://docs.ogc.org/is/17-069r4/17-069r4.html#_requirements_class_geography_markup_language_gml_simple_features_profile_level_0.
+// Each collection is a feature type in the application namespace {baseURL}/collections/{collectionID}.
+type gmlFeatures struct {
+	engine *engine.Engine
+}
+
+func newGMLFeatures(e *engine.Engine) *gmlFeatures {
+	return &gmlFeatures{
+		engine: e,
+	}
+}
+
+// features serves a page of features as sf:FeatureCollection, including links to the next/prev page
+func (gf *gmlFeatures) features(w http.ResponseWriter, collectionID string, crs int,
+	cursor domain.Cursors, featuresURL featureCollectionURL, fc *domain.FeatureCollection) {
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<sf:FeatureCollection`)
+	gf.writeNamespaces(&buf, collectionID)
+	fmt.Fprintf(&buf, ` timeStamp="%s" numberReturned="%d"`, fc.TimeStamp, fc.NumberReturned)
+	if fc.NumberMatched != nil {
+		fmt.Fprintf(&buf, ` numberMatched="%d"`, *fc.NumberMatched)
+	}
+	buf.WriteString(`>`)
+
+	writeAtomLink(&buf, "self", "This document", featuresURL.toSelfURL(collectionID, engine.FormatGML))
+	if cursor.HasNext {
+		writeAtomLink(&buf, "next", "Next page", featuresURL.toPrevNextURL(collectionID, cursor.Next, engine.FormatGML))
+	}
+	if cursor.HasPrev {
+		writeAtomLink(&buf, "prev", "Previous page", featuresURL.toPrevNextURL(collectionID, cursor.Prev, engine.FormatGML))
+	}
+
+	encoder := gmlEncoder{buf: &buf, collectionID: collectionID, srsName: crsURI(crs)}
+	for _, feat := range fc.Features {
+		buf.WriteString(`<sf:featureMember>`)
+		if err := encoder.feature(feat, ""); err != nil {
+			log.Printf("failed to convert feature %s in collection %s to GML: %v", feat.ID, collectionID, err)
+			http.Error(w, "Failed to convert features to GML", http.StatusInternalServerError)
+			return
+		}
+		buf.WriteString(`</sf:featureMember>`)
+	}
+	buf.WriteString(`</sf:FeatureCollection>`)
+
+	w.Header().Set("Content-Type", engine.MediaTypeGML)
+	engine.SafeWrite(w.Write, buf.Bytes())
+}
+
+// feature serves a single feature, the feature type element is the root element
+func (gf *gmlFeatures) feature(w http.ResponseWriter, collectionID string, crs int, feat *domain.Feature) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	var namespaces bytes.Buffer
+	gf.writeNamespaces(&namespaces, collectionID)
+
+	encoder := gmlEncoder{buf: &buf, collectionID: collectionID, srsName: crsURI(crs)}
+	if err := encoder.feature(feat, namespaces.String()); err != nil {
+		log.Printf("failed to convert feature %s in collection %s to GML: %v", feat.ID, collectionID, err)
+		http.Error(w, "Failed to convert feature to GML", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", engine.MediaTypeGML)
+	engine.SafeWrite(w.Write, buf.Bytes())
+}
+
+func (gf *gmlFeatures) writeNamespaces(buf *bytes.Buffer, collectionID string) {
+	appNamespace := gf.engine.Config.BaseURL.JoinPath("collections", collectionID).String()
+	fmt.Fprintf(buf, ` xmlns:sf="%s" xmlns:gml="%s" xmlns:atom="%s" xmlns:app="%s"`,
+		sfNamespace, gmlNamespace, atomNamespace, escapeXML(appNamespace))
+	fmt.Fprintf(buf, ` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="%s %s"`,
+		sfNamespace, sfSchema)
+}
+
+func writeAtomLink(buf *bytes.Buffer, rel string, title string, href string) {
+	fmt.Fprintf(buf, `<atom:link rel="%s" title="%s" type="%s" href="%s"/>`,
+		rel, escapeXML(title), engine.MediaTypeGML, escapeXML(href))
+}
+
+// gmlEncoder writes features as GML SF-0 feature type elements
+type gmlEncoder struct {
+	buf          *bytes.Buffer
+	collectionID string
+	srsName      string
+}
+
+// feature writes the feature, the given (optional) attributes are added to the feature type element
+func (e *gmlEncoder) feature(feat *domain.Feature, attributes string) error {
+	featureType := "app:" + toXMLName(e.collectionID)
+	id := toXMLName(e.collectionID + "." + feat.ID.String())
+	fmt.Fprintf(e.buf, `<%s%s gml:id="%s">`, featureType, attributes, id)
+
+	if feat.Geometry.Geometry != nil {
+		fmt.Fprintf(e.buf, `<app:%s>`, gmlGeometryProperty)
+		if err := e.geometry(feat.Geometry.Geometry, id+".geom", true); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.buf, `</app:%s>`, gmlGeometryProperty)
+	}
+
+	// sort for stable output
+	properties := make([]string, 0, len(feat.Properties))
+	for property := range feat.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		value := feat.Properties[property]
+		if value == nil {
+			continue
+		}
+		element := "app:" + toXMLName(property)
+		fmt.Fprintf(e.buf, `<%s>%s</%s>`, element, escapeXML(gmlValue(value)), element)
+	}
+	fmt.Fprintf(e.buf, `</%s>`, featureType)
+	return nil
+}
+
+// geometry writes the geometry as GML, only the outermost geometry carries the srsName
+func (e *gmlEncoder) geometry(g geom.Geometry, id string, root bool) error {
+	attributes := fmt.Sprintf(` gml:id="%s"`, id)
+	if root {
+		attributes += fmt.Sprintf(` srsName="%s"`, e.srsName)
+	}
+	switch t := g.(type) {
+	case geom.Point:
+		fmt.Fprintf(e.buf, `<gml:Point%s><gml:pos>%s</gml:pos></gml:Point>`, attributes, gmlPosList([][2]float64{t}))
+	case geom.MultiPoint:
+		fmt.Fprintf(e.buf, `<gml:MultiPoint%s>`, attributes)
+		for i, p := range t {
+			e.buf.WriteString(`<gml:pointMember>`)
+			if err := e.geometry(geom.Point(p), id+"."+strconv.Itoa(i+1), false); err != nil {
+				return err
+			}
+			e.buf.WriteString(`</gml:pointMember>`)
+		}
+		e.buf.WriteString(`</gml:MultiPoint>`)
+	case geom.LineString:
+		fmt.Fprintf(e.buf, `<gml:LineString%s><gml:posList>%s</gml:posList></gml:LineString>`, attributes, gmlPosList(t))
+	case geom.MultiLineString:
+		fmt.Fprintf(e.buf, `<gml:MultiCurve%s>`, attributes)
+		for i, l := range t {
+			e.buf.WriteString(`<gml:curveMember>`)
+			if err := e.geometry(geom.LineString(l), id+"."+strconv.Itoa(i+1), false); err != nil {
+				return err
+			}
+			e.buf.WriteString(`</gml:curveMember>`)
+		}
+		e.buf.WriteString(`</gml:MultiCurve>`)
+	case geom.Polygon:
+		fmt.Fprintf(e.buf, `<gml:Polygon%s>`, attributes)
+		for i, ring := range t {
+			boundary := "interior"
+			if i == 0 {
+				boundary = "exterior"
+			}
+			fmt.Fprintf(e.buf, `<gml:%s><gml:LinearRing><gml:posList>%s</gml:posList></gml:LinearRing></gml:%s>`,
+				boundary, gmlPosList(closeRing(ring)), boundary)
+		}
+		e.buf.WriteString(`</gml:Polygon>`)
+	case geom.MultiPolygon:
+		fmt.Fprintf(e.buf, `<gml:MultiSurface%s>`, attributes)
+		for i, p := range t {
+			e.buf.WriteString(`<gml:surfaceMember>`)
+			if err := e.geometry(geom.Polygon(p), id+"."+strconv.Itoa(i+1), false); err != nil {
+				return err
+			}
+			e.buf.WriteString(`</gml:surfaceMember>`)
+		}
+		e.buf.WriteString(`</gml:MultiSurface>`)
+	case geom.Collection:
+		fmt.Fprintf(e.buf, `<gml:MultiGeometry%s>`, attributes)
+		for i, c := range t {
+			e.buf.WriteString(`<gml:geometryMember>`)
+			if err := e.geometry(c, id+"."+strconv.Itoa(i+1), false); err != nil {
+				return err
+			}
+			e.buf.WriteString(`</gml:geometryMember>`)
+		}
+		e.buf.WriteString(`</gml:MultiGeometry>`)
+	default:
+		return fmt.Errorf("unsupported geometry type %T", g)
+	}
+	return nil
+}
+
+// gmlPosList coordinates separated by spaces, in the axis order of the geometry (same as GeoJSON/JSON-FG)
+func gmlPosList(points [][2]float64) string {
+	coords := make([]string, 0, len(points)*2)
+	for _, p := range points {
+		coords = append(coords, strconv.FormatFloat(p[0], 'f', -1, 64), strconv.FormatFloat(p[1], 'f', -1, 64))
+	}
+	return strings.Join(coords, " ")
+}
+
+// closeRing GML requires the first and last point of a LinearRing to be identical, go-spatial may omit the last point
+func closeRing(ring [][2]float64) [][2]float64 {
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		return append(ring[:len(ring):len(ring)], ring[0])
+	}
+	return ring
+}
+
+func gmlValue(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]any, []any:
+		// expanded relation(s), keep as JSON since SF-0 only allows simple values
+		result, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(result)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// toXMLName replaces characters that aren't allowed in XML names (e.g. in feature types, properties or gml:id)
+func toXMLName(name string) string {
+	var sb strings.Builder
+	for i, c := range name {
+		switch {
+		case unicode.IsLetter(c) || c == '_':
+			sb.WriteRune(c)
+		case i > 0 && (unicode.IsDigit(c) || c == '-' || c == '.'):
+			sb.WriteRune(c)
+		case i == 0 && unicode.IsDigit(c):
+			sb.WriteRune('_')
+			sb.WriteRune(c)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+func escapeXML(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
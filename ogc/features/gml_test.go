@@ -0,0 +1,167 @@
+package features
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatures_GML(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		featureID      string
+		wantStatusCode int
+		wantContains   []string
+	}{
+		{
+			name:           "Features as GML",
+			url:            "http://localhost:8080/collections/:collectionId/items?limit=2",
+			wantStatusCode: http.StatusOK,
+			wantContains: []string{
+				`<sf:FeatureCollection xmlns:sf="http://www.opengis.net/ogcapi-features-1/1.0/sf" xmlns:gml="http://www.opengis.net/gml/3.2"`,
+				`xmlns:app="http://localhost:8080/collections/foo"`,
+				`timeStamp="20`,
+				`numberReturned="2"`,
+				`<atom:link rel="next" title="Next page" type="application/gml+xml;version=3.2" href="http://localhost:8080/collections/foo/items?cursor=`,
+				`<sf:featureMember><app:foo gml:id="foo.3542"><app:geometry><gml:Point gml:id="foo.3542.geom" srsName="http://www.opengis.net/def/crs/EPSG/0/28992"><gml:pos>120919.942 489320.199</gml:pos>`,
+				`<app:straatnaam>Van Diemenkade</app:straatnaam>`,
+			},
+		},
+		{
+			name:           "Feature as GML",
+			url:            "http://localhost:8080/collections/:collectionId/items/:featureId",
+			featureID:      "4030",
+			wantStatusCode: http.StatusOK,
+			wantContains: []string{
+				`<app:foo xmlns:sf="http://www.opengis.net/ogcapi-features-1/1.0/sf"`,
+				`gml:id="foo.4030"><app:geometry><gml:Point gml:id="foo.4030.geom"`,
+				`<app:huisnummer>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest(tt.url, "foo", tt.featureID, "gml")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			if tt.featureID != "" {
+				features.Feature().ServeHTTP(rr, req)
+			} else {
+				features.CollectionContent().ServeHTTP(rr, req)
+			}
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			assert.Equal(t, engine.MediaTypeGML, rr.Header().Get("Content-Type"))
+			for _, want := range tt.wantContains {
+				assert.Contains(t, rr.Body.String(), want)
+			}
+			assertWellFormedXML(t, rr.Body.Bytes())
+		})
+	}
+}
+
+func TestGMLEncoder_Geometry(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry geom.Geometry
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Point",
+			geometry: geom.Point{5.1, 52.3},
+			want:     `<gml:Point gml:id="g" srsName="urn:test"><gml:pos>5.1 52.3</gml:pos></gml:Point>`,
+		},
+		{
+			name:     "LineString",
+			geometry: geom.LineString{{1, 2}, {3, 4}},
+			want:     `<gml:LineString gml:id="g" srsName="urn:test"><gml:posList>1 2 3 4</gml:posList></gml:LineString>`,
+		},
+		{
+			name:     "Polygon with unclosed ring",
+			geometry: geom.Polygon{{{0, 0}, {1, 0}, {1, 1}}},
+			want: `<gml:Polygon gml:id="g" srsName="urn:test"><gml:exterior><gml:LinearRing>` +
+				`<gml:posList>0 0 1 0 1 1 0 0</gml:posList></gml:LinearRing></gml:exterior></gml:Polygon>`,
+		},
+		{
+			name:     "MultiPolygon with hole",
+			geometry: geom.MultiPolygon{{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}}},
+			want: `<gml:MultiSurface gml:id="g" srsName="urn:test"><gml:surfaceMember><gml:Polygon gml:id="g.1">` +
+				`<gml:exterior><gml:LinearRing><gml:posList>0 0 4 0 4 4 0 0</gml:posList></gml:LinearRing></gml:exterior>` +
+				`<gml:interior><gml:LinearRing><gml:posList>1 1 2 1 2 2 1 1</gml:posList></gml:LinearRing></gml:interior>` +
+				`</gml:Polygon></gml:surfaceMember></gml:MultiSurface>`,
+		},
+		{
+			name:     "Collection",
+			geometry: geom.Collection{geom.Point{1, 2}, geom.MultiLineString{{{1, 2}, {3, 4}}}},
+			want: `<gml:MultiGeometry gml:id="g" srsName="urn:test">` +
+				`<gml:geometryMember><gml:Point gml:id="g.1"><gml:pos>1 2</gml:pos></gml:Point></gml:geometryMember>` +
+				`<gml:geometryMember><gml:MultiCurve gml:id="g.2"><gml:curveMember><gml:LineString gml:id="g.2.1">` +
+				`<gml:posList>1 2 3 4</gml:posList></gml:LineString></gml:curveMember></gml:MultiCurve></gml:geometryMember>` +
+				`</gml:MultiGeometry>`,
+		},
+		{
+			name:     "Unsupported geometry",
+			geometry: geom.Line{{1, 2}, {3, 4}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := gmlEncoder{buf: &buf, collectionID: "foo", srsName: "urn:test"}
+			err := encoder.geometry(tt.geometry, "g", true)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestGMLEncoder_Feature(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := gmlEncoder{buf: &buf, collectionID: "2foo bar", srsName: "urn:test"}
+	feature := &domain.Feature{
+		ID: domain.NewFeatureID(1),
+		Feature: geojson.Feature{
+			Properties: map[string]any{
+				"straat naam": "Bickers<gracht & co",
+				"huisnummer":  int64(285),
+				"leeg":        nil,
+			},
+		},
+	}
+	assert.NoError(t, encoder.feature(feature, ""))
+	assert.Equal(t, `<app:_2foo_bar gml:id="_2foo_bar.1"><app:huisnummer>285</app:huisnummer>`+
+		`<app:straat_naam>Bickers&lt;gracht &amp; co</app:straat_naam></app:_2foo_bar>`, buf.String())
+}
+
+func assertWellFormedXML(t *testing.T, body []byte) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		_, err := decoder.Token()
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			return
+		}
+	}
+}
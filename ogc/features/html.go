@@ -1,38 +1,52 @@
 package features
 
 import (
+	"fmt"
 	"net/http"
+	neturl "net/url"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/PDOK/gokoala/engine"
 	"github.com/PDOK/gokoala/ogc/features/domain"
 )
 
-const (
-	collectionsCrumb = "collections/"
-)
-
 var (
-	collectionsBreadcrumb = []engine.Breadcrumb{
-		{
-			Name: "Collections",
-			Path: "collections",
-		},
-	}
 	featuresKey = engine.NewTemplateKey(templatesDir + "features.go.html")
 	featureKey  = engine.NewTemplateKey(templatesDir + "feature.go.html")
 )
 
+const (
+	// base maps of features in CRS84 (the default) or another CRS without its own tile grid use WebMercator
+	defaultMapSRID = 3857
+)
+
+// tile grid (and thereby the projection of the map) per CRS of the returned features
+var tileMatrixSets = map[int]string{
+	28992: "NetherlandsRDNewQuad",
+	3035:  "EuropeanETRS89_LAEAQuad",
+	3857:  "WebMercatorQuad",
+}
+
 type htmlFeatures struct {
-	engine *engine.Engine
+	engine      *engine.Engine
+	collections map[string]*engine.GeoSpatialCollectionMetadata
+	properties  propertiesByCollectionID
 }
 
-func newHTMLFeatures(e *engine.Engine) *htmlFeatures {
+func newHTMLFeatures(e *engine.Engine, collections map[string]*engine.GeoSpatialCollectionMetadata,
+	properties propertiesByCollectionID) *htmlFeatures {
 	e.ParseTemplate(featuresKey)
 	e.ParseTemplate(featureKey)
+	for collectionID := range collections {
+		e.RegisterRouteTitle(itemsPath(collectionID), "Items")
+	}
 
 	return &htmlFeatures{
-		engine: e,
+		engine:      e,
+		collections: collections,
+		properties:  properties,
 	}
 }
 
@@ -46,32 +60,43 @@ type featureCollectionPage struct {
 	PrevLink     string
 	NextLink     string
 	Limit        int
+	Map          *featuresMap
+
+	// configured metadata (description, unit) per property, shown alongside the property names
+	PropertyMetadata map[string]engine.FeatureProperty
 }
 
 // featurePage enriched Feature for HTML representation.
 type featurePage struct {
 	domain.Feature
 
-	FeatureID int64
+	FeatureID domain.FeatureID
 	Metadata  *engine.GeoSpatialCollectionMetadata
+	Map       *featuresMap
+
+	// configured metadata (description, unit) per property, shown alongside the property names
+	PropertyMetadata map[string]engine.FeatureProperty
 }
 
-func (hf *htmlFeatures) features(w http.ResponseWriter, r *http.Request, collectionID string,
-	cursor domain.Cursors, featuresURL featureCollectionURL, limit int, fc *domain.FeatureCollection) {
+// featuresMap map preview of features, with a base map in the projection of the returned
+// coordinates so what users see matches these coordinates. Base maps are vector tiles of this API.
+type featuresMap struct {
+	// CRS of the returned features, as URI
+	Crs string
+
+	// CRSs users can switch to, as URIs
+	SupportedCrs []string
+
+	// base map (vector tiles) in the tile grid matching the CRS, e.g. NetherlandsRDNewQuad for RD
+	TileMatrixSet string
+	TileURL       string
+}
 
-	collectionMetadata := collections[collectionID]
+func (hf *htmlFeatures) features(w http.ResponseWriter, r *http.Request, collectionID string, crs int,
+	cursor domain.Cursors, featuresURL featureCollectionURL, limit int, fc *domain.FeatureCollection) {
 
-	breadcrumbs := collectionsBreadcrumb
-	breadcrumbs = append(breadcrumbs, []engine.Breadcrumb{
-		{
-			Name: getCollectionTitle(collectionID, collectionMetadata),
-			Path: collectionsCrumb + collectionID,
-		},
-		{
-			Name: "Items",
-			Path: collectionsCrumb + collectionID + "/items",
-		},
-	}...)
+	collectionMetadata := hf.collections[collectionID]
+	breadcrumbs := hf.engine.Breadcrumbs(itemsPath(collectionID))
 
 	pageContent := &featureCollectionPage{
 		*fc,
@@ -81,45 +106,71 @@ func (hf *htmlFeatures) features(w http.ResponseWriter, r *http.Request, collect
 		featuresURL.toPrevNextURL(collectionID, cursor.Prev, engine.FormatHTML),
 		featuresURL.toPrevNextURL(collectionID, cursor.Next, engine.FormatHTML),
 		limit,
+		hf.newFeaturesMap(crs),
+		hf.properties[collectionID],
 	}
 
 	lang := hf.engine.CN.NegotiateLanguage(w, r)
 	hf.engine.RenderAndServePage(w, r, engine.ExpandTemplateKey(featuresKey, lang), pageContent, breadcrumbs)
 }
 
-func (hf *htmlFeatures) feature(w http.ResponseWriter, r *http.Request, collectionID string, feat *domain.Feature) {
-	collectionMetadata := collections[collectionID]
-
-	breadcrumbs := collectionsBreadcrumb
-	breadcrumbs = append(breadcrumbs, []engine.Breadcrumb{
-		{
-			Name: getCollectionTitle(collectionID, collectionMetadata),
-			Path: collectionsCrumb + collectionID,
-		},
-		{
-			Name: "Items",
-			Path: collectionsCrumb + collectionID + "/items",
-		},
-		{
-			Name: strconv.FormatInt(feat.ID, 10),
-			Path: collectionsCrumb + collectionID + "/items/" + strconv.FormatInt(feat.ID, 10),
-		},
-	}...)
+func (hf *htmlFeatures) feature(w http.ResponseWriter, r *http.Request, collectionID string, crs int, feat *domain.Feature) {
+	collectionMetadata := hf.collections[collectionID]
+	featureID := feat.ID.String()
+	breadcrumbs := append(hf.engine.Breadcrumbs(itemsPath(collectionID)), engine.Breadcrumb{
+		Name: featureID,
+		Path: itemsPath(collectionID) + "/" + neturl.PathEscape(featureID),
+	})
 
 	pageContent := &featurePage{
 		*feat,
 		feat.ID,
 		collectionMetadata,
+		hf.newFeaturesMap(crs),
+		hf.properties[collectionID],
 	}
 
 	lang := hf.engine.CN.NegotiateLanguage(w, r)
 	hf.engine.RenderAndServePage(w, r, engine.ExpandTemplateKey(featureKey, lang), pageContent, breadcrumbs)
 }
 
-func getCollectionTitle(collectionID string, metadata *engine.GeoSpatialCollectionMetadata) string {
-	title := collectionID
-	if metadata != nil && metadata.Title != nil {
-		title = *metadata.Title
+// newFeaturesMap returns the map preview for the CRS of the features (requested by the user using the crs param, or
+// otherwise the CRS in which these are stored), or nil when this API doesn't offer a base map in the tile grid matching this CRS.
+func (hf *htmlFeatures) newFeaturesMap(crs int) *featuresMap {
+	tiles := hf.engine.Config.OgcAPI.Tiles
+	if tiles == nil {
+		return nil
+	}
+	mapSRID := crs
+	if _, ok := tileMatrixSets[mapSRID]; !ok {
+		mapSRID = defaultMapSRID
 	}
-	return title
+	supportedSrs := make([]string, 0, len(tiles.SupportedSrs))
+	for _, srs := range tiles.SupportedSrs {
+		supportedSrs = append(supportedSrs, srs.Srs)
+	}
+	if !slices.Contains(supportedSrs, fmt.Sprintf("EPSG:%d", mapSRID)) {
+		return nil
+	}
+	result := &featuresMap{
+		Crs:           crsURI(crs),
+		SupportedCrs:  []string{crs84URI},
+		TileMatrixSet: tileMatrixSets[mapSRID],
+		TileURL:       hf.engine.Config.BaseURL.String() + "/tiles/" + tileMatrixSets[mapSRID],
+	}
+	if hf.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesCRS) {
+		// only CRSs with a tile grid, since the map should match the coordinates
+		for _, srs := range supportedSrs {
+			srid, err := strconv.Atoi(strings.TrimPrefix(srs, "EPSG:"))
+			if err == nil && tileMatrixSets[srid] != "" {
+				result.SupportedCrs = append(result.SupportedCrs, crsURIPrefix+strconv.Itoa(srid))
+			}
+		}
+	}
+	return result
+}
+
+// itemsPath relative path to the items of the given collection, as used in breadcrumbs
+func itemsPath(collectionID string) string {
+	return "collections/" + collectionID + "/items"
 }
@@ -0,0 +1,62 @@
+package features
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLFeatures_newFeaturesMap(t *testing.T) {
+	tiles := &engine.OgcAPITiles{SupportedSrs: []engine.SupportedSrs{{Srs: "EPSG:28992"}, {Srs: "EPSG:3857"}}}
+	tests := []struct {
+		name  string
+		tiles *engine.OgcAPITiles
+		crs   int
+		want  *featuresMap
+	}{
+		{
+			name: "no tiles, no base map",
+			crs:  wgs84SRID,
+			want: nil,
+		},
+		{
+			name:  "CRS84 on WebMercator",
+			tiles: tiles,
+			crs:   wgs84SRID,
+			want: &featuresMap{
+				Crs:           crs84URI,
+				SupportedCrs:  []string{crs84URI, crsURIPrefix + "28992", crsURIPrefix + "3857"},
+				TileMatrixSet: "WebMercatorQuad",
+				TileURL:       "https://api.foobar.example/tiles/WebMercatorQuad",
+			},
+		},
+		{
+			name:  "RD on RD tile grid",
+			tiles: tiles,
+			crs:   28992,
+			want: &featuresMap{
+				Crs:           crsURIPrefix + "28992",
+				SupportedCrs:  []string{crs84URI, crsURIPrefix + "28992", crsURIPrefix + "3857"},
+				TileMatrixSet: "NetherlandsRDNewQuad",
+				TileURL:       "https://api.foobar.example/tiles/NetherlandsRDNewQuad",
+			},
+		},
+		{
+			name:  "no base map in tile grid of CRS",
+			tiles: &engine.OgcAPITiles{SupportedSrs: []engine.SupportedSrs{{Srs: "EPSG:28992"}}},
+			crs:   wgs84SRID,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hf := &htmlFeatures{engine: &engine.Engine{Config: &engine.Config{
+				BaseURL: engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example"}},
+				OgcAPI:  engine.OgcAPI{Tiles: tt.tiles},
+			}}}
+			assert.Equal(t, tt.want, hf.newFeaturesMap(tt.crs))
+		})
+	}
+}
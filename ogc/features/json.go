@@ -1,39 +1,186 @@
 package features
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/PDOK/gokoala/engine"
 	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+)
+
+const (
+	// GeoJSON-LD context, maps GeoJSON members (type, geometry, properties, etc.) to linked data terms
+	geoJSONLDContext = "https://geojson.org/geojson-ld/geojson-context.jsonld"
 )
 
 type jsonFeatures struct {
 	engine *engine.Engine
+
+	jsonLDContexts map[string][]any
+
+	// temporal properties per collection, for the time of features in JSON-FG
+	temporal temporalByCollectionID
+
+	// custom members of GeoJSON documents per collection
+	foreignMembers foreignMembersByCollectionID
+
+	// whether features are also offered as JSON-FG, see FeatureFlagJSONFG
+	jsonFG bool
+
+	// max size (in bytes) of a FeatureCollection response, 0 means unlimited
+	maxResponseSize int
+
+	// current time, for the timeStamp of responses
+	now func() time.Time
 }
 
+// errResponseTooLarge the response exceeds the configured max response size
+var errResponseTooLarge = errors.New("response exceeds max response size")
+
 func newJSONFeatures(e *engine.Engine) *jsonFeatures {
+	jsonLDContexts := make(map[string][]any)
+	for _, collection := range e.Config.OgcAPI.Features.Collections {
+		jsonLDContext := []any{geoJSONLDContext}
+		if collection.Features != nil && collection.Features.JSONLDContext != nil {
+			jsonLDContext = append(jsonLDContext, collection.Features.JSONLDContext)
+		}
+		jsonLDContexts[collection.ID] = jsonLDContext
+	}
 	return &jsonFeatures{
-		engine: e,
+		engine:          e,
+		jsonLDContexts:  jsonLDContexts,
+		temporal:        newTemporal(e.Config.OgcAPI.Features.Collections),
+		foreignMembers:  newForeignMembers(e.Config.OgcAPI.Features.Collections),
+		jsonFG:          e.Config.FeatureEnabled(engine.FeatureFlagJSONFG),
+		maxResponseSize: e.Config.OgcAPI.Features.GetMaxResponseSize() * 1024 * 1024,
+		now:             time.Now,
 	}
 }
 
+// setResponseMetadata sets the timeStamp and numberReturned of the FeatureCollection. Generated here (instead of
+// by the datasource) so all formats report the same, also when features are added or removed after retrieval.
+// The numberMatched (when enabled) is set beforehand, since it requires a separate query.
+func (jf *jsonFeatures) setResponseMetadata(fc *domain.FeatureCollection) {
+	fc.TimeStamp = jf.now().UTC().Format(time.RFC3339)
+	fc.NumberReturned = len(fc.Features)
+}
+
 func (jf *jsonFeatures) featuresAsGeoJSON(w http.ResponseWriter, collectionID string,
-	cursor domain.Cursors, featuresURL featureCollectionURL, fc *domain.FeatureCollection) {
+	cursor domain.Cursors, featuresURL featureCollectionURL, fc *domain.FeatureCollection) error {
 
-	fc.Links = jf.createFeatureCollectionLinks(collectionID, cursor, featuresURL)
-	fcJSON, err := toJSON(&fc)
+	fc.Links = jf.createFeatureCollectionLinks(engine.FormatJSON, collectionID, cursor, featuresURL)
+	fcJSON, err := jf.featureCollectionToJSON(collectionID, fc)
 	if err != nil {
-		http.Error(w, "Failed to marshal FeatureCollection to JSON", http.StatusInternalServerError)
-		return
+		return jf.encodingError(err, "Failed to marshal FeatureCollection to JSON")
 	}
 	engine.SafeWrite(w.Write, fcJSON)
+	return nil
+}
+
+// streamFeaturesAsGeoJSON performs the equivalent of featuresAsGeoJSON, but features are encoded and written one by
+// one as they're returned by next (nil when done), so a page is never materialized in memory. The given FeatureCollection
+// holds everything but the features. Since the number of features isn't known upfront numberReturned is the last member.
+func (jf *jsonFeatures) streamFeaturesAsGeoJSON(w http.ResponseWriter, collectionID string, cursor domain.Cursors,
+	featuresURL featureCollectionURL, fc *domain.FeatureCollection, next func() (*domain.Feature, error)) error {
+
+	// same members (and order) as domain.FeatureCollection, up to the features
+	type featureCollectionJSON struct {
+		Links         []domain.Link `json:"links,omitempty"`
+		TimeStamp     string        `json:"timeStamp,omitempty"`
+		NumberMatched *int          `json:"numberMatched,omitempty"`
+		Type          string        `json:"type"`
+	}
+	members := jf.foreignMembers[collectionID]
+	fcJSON, err := toJSON(featureCollectionJSON{
+		Links:         jf.createFeatureCollectionLinks(engine.FormatJSON, collectionID, cursor, featuresURL),
+		TimeStamp:     fc.TimeStamp,
+		NumberMatched: fc.NumberMatched,
+		Type:          "FeatureCollection",
+	})
+	if err == nil {
+		fcJSON, err = addForeignMembers(members.featureCollection, fcJSON)
+	}
+	if err != nil {
+		return jf.encodingError(err, "Failed to marshal FeatureCollection to JSON")
+	}
+
+	writer := newStreamWriter(w)
+	writer.write(fcJSON[:len(fcJSON)-1]) // leave the object open
+	writer.write([]byte(`,"features":[`))
+	numberReturned := 0
+	for {
+		feat, err := next()
+		if err != nil {
+			return writer.fail(fmt.Sprintf("failed to retrieve features of collection %s", collectionID), err)
+		}
+		if feat == nil {
+			break
+		}
+		featJSON, err := toJSON(feat)
+		if err == nil {
+			featJSON, err = addForeignMembers(members.feature, featJSON)
+		}
+		if err != nil {
+			return writer.fail("Failed to marshal FeatureCollection to JSON", err)
+		}
+		if numberReturned > 0 {
+			writer.write([]byte(","))
+		}
+		writer.write(featJSON)
+		numberReturned++
+	}
+	writer.write([]byte(fmt.Sprintf(`],"numberReturned":%d}`, numberReturned)))
+	if err = writer.Flush(); err != nil {
+		log.Printf("failed to write features of collection %s: %v", collectionID, err)
+	}
+	return nil
+}
+
+// streamWriter buffers a streamed response. Nothing is sent to the client until the buffer is flushed,
+// so until then a proper error response can still be returned.
+type streamWriter struct {
+	*bufio.Writer
+	written int
+}
+
+func newStreamWriter(w http.ResponseWriter) *streamWriter {
+	return &streamWriter{Writer: bufio.NewWriter(w)}
+}
+
+// Write implements io.Writer, keeping track of the number of bytes written
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	n, err := sw.Writer.Write(b)
+	sw.written += n
+	return n, err
+}
+
+func (sw *streamWriter) write(b []byte) {
+	_, _ = sw.Write(b) // errors are reported on flush
+}
+
+// fail returns an error for the client, or logs the error when the response is partially sent already
+func (sw *streamWriter) fail(detail string, err error) error {
+	if sw.written == sw.Buffered() {
+		return engine.InternalError(detail, err)
+	}
+	// the response is partially sent already, so we can only abort the response
+	log.Printf("%s: %v", detail, err)
+	return nil
 }
 
 func (jf *jsonFeatures) featureAsGeoJSON(w http.ResponseWriter, collectionID string, feat *domain.Feature, url featureURL) {
-	feat.Links = jf.createFeatureLinks(url, collectionID, feat.ID)
+	feat.Links = jf.createFeatureLinks(engine.FormatJSON, url, collectionID, feat.ID)
 	featJSON, err := toJSON(feat)
+	if err == nil {
+		featJSON, err = addForeignMembers(jf.foreignMembers[collectionID].feature, featJSON)
+	}
 	if err != nil {
 		http.Error(w, "Failed to marshal Feature to JSON", http.StatusInternalServerError)
 		return
@@ -41,61 +188,82 @@ func (jf *jsonFeatures) featureAsGeoJSON(w http.ResponseWriter, collectionID str
 	engine.SafeWrite(w.Write, featJSON)
 }
 
-func (jf *jsonFeatures) featuresAsJSONFG() {
-	// TODO: not implemented yet
+// featuresAsJSONLD serves GeoJSON-LD, which is GeoJSON with a JSON-LD @context: the GeoJSON-LD
+// vocabulary and optionally the configured context of the collection (mapping properties to URIs).
+func (jf *jsonFeatures) featuresAsJSONLD(w http.ResponseWriter, collectionID string,
+	cursor domain.Cursors, featuresURL featureCollectionURL, fc *domain.FeatureCollection) error {
+
+	fc.Links = jf.createFeatureCollectionLinks(engine.FormatJSONLD, collectionID, cursor, featuresURL)
+	fcJSON, err := jf.featureCollectionToJSON(collectionID, fc)
+	if err == nil {
+		fcJSON, err = addJSONLDContext(jf.jsonLDContexts[collectionID], fcJSON)
+	}
+	if err != nil {
+		return jf.encodingError(err, "Failed to marshal FeatureCollection to JSON-LD")
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeJSONLD)
+	engine.SafeWrite(w.Write, fcJSON)
+	return nil
 }
 
-func (jf *jsonFeatures) featureAsJSONFG() {
-	// TODO: not implemented yet
+func (jf *jsonFeatures) featureAsJSONLD(w http.ResponseWriter, collectionID string, feat *domain.Feature, url featureURL) {
+	feat.Links = jf.createFeatureLinks(engine.FormatJSONLD, url, collectionID, feat.ID)
+	featJSON, err := toJSONLD(jf.jsonLDContexts[collectionID], feat)
+	if err == nil {
+		featJSON, err = addForeignMembers(jf.foreignMembers[collectionID].feature, featJSON)
+	}
+	if err != nil {
+		http.Error(w, "Failed to marshal Feature to JSON-LD", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeJSONLD)
+	engine.SafeWrite(w.Write, featJSON)
 }
 
-func (jf *jsonFeatures) createFeatureCollectionLinks(collectionID string, cursor domain.Cursors, featuresURL featureCollectionURL) []domain.Link {
+// createFeatureCollectionLinks links of a page of features in the given format (GeoJSON, JSON-FG or JSON-LD),
+// the other JSON format (when enabled) and HTML are alternates
+func (jf *jsonFeatures) createFeatureCollectionLinks(format string, collectionID string, cursor domain.Cursors, featuresURL featureCollectionURL) []domain.Link {
 	links := make([]domain.Link, 0)
-	links = append(links, domain.Link{
-		Rel:   "self",
-		Title: "This document as GeoJSON",
-		Type:  engine.MediaTypeGeoJSON,
-		Href:  featuresURL.toSelfURL(collectionID, engine.FormatJSON),
-	})
-	links = append(links, domain.Link{
-		Rel:   "alternate",
-		Title: "This document as HTML",
-		Type:  engine.MediaTypeHTML,
-		Href:  featuresURL.toSelfURL(collectionID, engine.FormatHTML),
-	})
+	for _, f := range jf.linkFormats(format) {
+		links = append(links, domain.Link{
+			Rel:   f.rel,
+			Title: "This document as " + f.title,
+			Type:  f.mediaType,
+			Href:  featuresURL.toSelfURL(collectionID, f.format),
+		})
+	}
+	mediaType := jsonMediaType(format)
 	if cursor.HasNext {
 		links = append(links, domain.Link{
 			Rel:   "next",
 			Title: "Next page",
-			Type:  engine.MediaTypeGeoJSON,
-			Href:  featuresURL.toPrevNextURL(collectionID, cursor.Next, engine.FormatJSON),
+			Type:  mediaType,
+			Href:  featuresURL.toPrevNextURL(collectionID, cursor.Next, format),
 		})
 	}
 	if cursor.HasPrev {
 		links = append(links, domain.Link{
 			Rel:   "prev",
 			Title: "Previous page",
-			Type:  engine.MediaTypeGeoJSON,
-			Href:  featuresURL.toPrevNextURL(collectionID, cursor.Prev, engine.FormatJSON),
+			Type:  mediaType,
+			Href:  featuresURL.toPrevNextURL(collectionID, cursor.Prev, format),
 		})
 	}
 	return links
 }
 
-func (jf *jsonFeatures) createFeatureLinks(url featureURL, collectionID string, featureID int64) []domain.Link {
+// createFeatureLinks links of a single feature in the given format (GeoJSON, JSON-FG or JSON-LD),
+// the other JSON format (when enabled) and HTML are alternates
+func (jf *jsonFeatures) createFeatureLinks(format string, url featureURL, collectionID string, featureID domain.FeatureID) []domain.Link {
 	links := make([]domain.Link, 0)
-	links = append(links, domain.Link{
-		Rel:   "self",
-		Title: "This document as GeoJSON",
-		Type:  engine.MediaTypeGeoJSON,
-		Href:  url.toSelfURL(collectionID, featureID, engine.FormatJSON),
-	})
-	links = append(links, domain.Link{
-		Rel:   "alternate",
-		Title: "This document as HTML",
-		Type:  engine.MediaTypeHTML,
-		Href:  url.toSelfURL(collectionID, featureID, engine.FormatHTML),
-	})
+	for _, f := range jf.linkFormats(format) {
+		links = append(links, domain.Link{
+			Rel:   f.rel,
+			Title: "This document as " + f.title,
+			Type:  f.mediaType,
+			Href:  url.toSelfURL(collectionID, featureID, f.format),
+		})
+	}
 	links = append(links, domain.Link{
 		Rel:   "collection",
 		Title: "The collection to which this feature belongs",
@@ -105,6 +273,126 @@ func (jf *jsonFeatures) createFeatureLinks(url featureURL, collectionID string,
 	return links
 }
 
+type linkFormat struct {
+	rel       string
+	format    string
+	title     string
+	mediaType string
+}
+
+// linkFormats the given format (self) followed by the alternate formats of features
+func (jf *jsonFeatures) linkFormats(format string) []linkFormat {
+	result := []linkFormat{{rel: "self", format: format, title: jsonTitle(format), mediaType: jsonMediaType(format)}}
+	for _, alternate := range []string{engine.FormatJSON, engine.FormatJSONFG} {
+		if alternate == format || (alternate == engine.FormatJSONFG && !jf.jsonFG) {
+			continue
+		}
+		result = append(result, linkFormat{rel: "alternate", format: alternate, title: jsonTitle(alternate), mediaType: jsonMediaType(alternate)})
+	}
+	return append(result, linkFormat{rel: "alternate", format: engine.FormatHTML, title: "HTML", mediaType: engine.MediaTypeHTML})
+}
+
+func jsonTitle(format string) string {
+	switch format {
+	case engine.FormatJSONFG:
+		return "JSON-FG"
+	case engine.FormatJSONLD:
+		return "JSON-LD"
+	}
+	return "GeoJSON"
+}
+
+func jsonMediaType(format string) string {
+	switch format {
+	case engine.FormatJSONFG:
+		return engine.MediaTypeJSONFG
+	case engine.FormatJSONLD:
+		return engine.MediaTypeJSONLD
+	}
+	return engine.MediaTypeGeoJSON
+}
+
+// featureCollectionToJSON performs the equivalent of toJSON, but encodes the features one by one so
+// encoding is aborted as soon as the response exceeds the max response size (errResponseTooLarge).
+// The foreign members of the collection (if any) are added to the FeatureCollection and each Feature.
+func (jf *jsonFeatures) featureCollectionToJSON(collectionID string, fc *domain.FeatureCollection) ([]byte, error) {
+	members := jf.foreignMembers[collectionID]
+	var fcJSON []byte
+	var err error
+	if jf.maxResponseSize <= 0 && members.feature == nil {
+		fcJSON, err = toJSON(fc)
+	} else {
+		fcJSON, err = jf.encodeFeatureCollection(fc, members.feature)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return addForeignMembers(members.featureCollection, fcJSON)
+}
+
+// encodeFeatureCollection encodes the FeatureCollection, the features are encoded one by one (see encodeFeatures)
+func (jf *jsonFeatures) encodeFeatureCollection(fc *domain.FeatureCollection, featureMembers []byte) ([]byte, error) {
+	// same members (and order) as domain.FeatureCollection
+	type featureCollectionJSON struct {
+		Links          []domain.Link     `json:"links,omitempty"`
+		TimeStamp      string            `json:"timeStamp,omitempty"`
+		NumberMatched  *int              `json:"numberMatched,omitempty"`
+		NumberReturned int               `json:"numberReturned"`
+		Type           string            `json:"type"`
+		Bbox           *geom.Extent      `json:"bbox,omitempty"`
+		Features       []json.RawMessage `json:"features"`
+	}
+	result := featureCollectionJSON{
+		Links:          fc.Links,
+		TimeStamp:      fc.TimeStamp,
+		NumberMatched:  fc.NumberMatched,
+		NumberReturned: fc.NumberReturned,
+		Type:           "FeatureCollection",
+		Bbox:           fc.Bbox,
+	}
+	var err error
+	if result.Features, err = encodeFeatures(fc.Features, jf.maxResponseSize, featureMembers); err != nil {
+		return nil, err
+	}
+	return toJSON(&result)
+}
+
+// encodeFeatures encodes the given features one by one (see toJSON) including the given foreign members (optional),
+// encoding is aborted as soon as the total size exceeds the given max size (errResponseTooLarge).
+// A max size of 0 means unlimited.
+func encodeFeatures[F any](features []F, maxSize int, members []byte) ([]json.RawMessage, error) {
+	if features == nil {
+		return nil, nil
+	}
+	result := make([]json.RawMessage, 0, len(features))
+	size := 0
+	for _, feat := range features {
+		featJSON, err := toJSON(feat)
+		if err == nil {
+			featJSON, err = addForeignMembers(members, featJSON)
+		}
+		if err != nil {
+			return nil, err
+		}
+		size += len(featJSON)
+		if maxSize > 0 && size > maxSize {
+			return nil, errResponseTooLarge
+		}
+		result = append(result, featJSON)
+	}
+	return result, nil
+}
+
+// encodingError translates the given error (which occurred while encoding features) to an API error
+func (jf *jsonFeatures) encodingError(err error, detail string) error {
+	if errors.Is(err, errResponseTooLarge) {
+		return engine.ContentTooLarge(fmt.Sprintf("the response exceeds the max response size of %d MiB, "+
+			"lower the number of features per page using the limit parameter (e.g. limit=10) or use a more "+
+			"selective filter such as bbox", jf.maxResponseSize/1024/1024))
+	}
+	return engine.InternalError(detail, err)
+}
+
 // toJSON performs the equivalent of json.Marshal but without escaping '<', '>' and '&'.
 // Especially the '&' is important since we use this character in the next/prev links.
 func toJSON(input interface{}) ([]byte, error) {
@@ -115,3 +403,29 @@ func toJSON(input interface{}) ([]byte, error) {
 	marshalled := bytes.TrimRight(buffer.Bytes(), "\n")
 	return marshalled, err
 }
+
+// toJSONLD marshals the input to JSON (see toJSON) and adds the given JSON-LD @context as the first member.
+func toJSONLD(jsonLDContext []any, input interface{}) ([]byte, error) {
+	inputJSON, err := toJSON(input)
+	if err != nil {
+		return nil, err
+	}
+	return addJSONLDContext(jsonLDContext, inputJSON)
+}
+
+// addJSONLDContext adds the given JSON-LD @context as the first member of the given JSON object.
+func addJSONLDContext(jsonLDContext []any, inputJSON []byte) ([]byte, error) {
+	contextJSON, err := toJSON(map[string]any{"@context": jsonLDContext})
+	if err != nil {
+		return nil, err
+	}
+	if len(inputJSON) < 2 || inputJSON[0] != '{' {
+		return nil, fmt.Errorf("expected JSON object, can't add JSON-LD context")
+	}
+	// merge {"@context":...} and {...} into {"@context":...,...}
+	result := contextJSON[:len(contextJSON)-1]
+	if string(inputJSON) != "{}" {
+		result = append(result, ',')
+	}
+	return append(result, inputJSON[1:]...), nil
+}
@@ -0,0 +1,215 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToJSONLD(t *testing.T) {
+	tests := []struct {
+		name          string
+		jsonLDContext []any
+		input         any
+		want          string
+		wantErr       bool
+	}{
+		{
+			name:          "add GeoJSON-LD context",
+			jsonLDContext: []any{geoJSONLDContext},
+			input:         map[string]any{"type": "Feature", "id": 1},
+			want:          `{"@context":["https://geojson.org/geojson-ld/geojson-context.jsonld"],"id":1,"type":"Feature"}`,
+		},
+		{
+			name:          "add GeoJSON-LD context and collection context",
+			jsonLDContext: []any{geoJSONLDContext, map[string]any{"straatnaam": "https://schema.org/streetAddress"}},
+			input:         map[string]any{"type": "Feature"},
+			want:          `{"@context":["https://geojson.org/geojson-ld/geojson-context.jsonld",{"straatnaam":"https://schema.org/streetAddress"}],"type":"Feature"}`,
+		},
+		{
+			name:          "empty object",
+			jsonLDContext: []any{geoJSONLDContext},
+			input:         map[string]any{},
+			want:          `{"@context":["https://geojson.org/geojson-ld/geojson-context.jsonld"]}`,
+		},
+		{
+			name:          "fail on non-object",
+			jsonLDContext: []any{geoJSONLDContext},
+			input:         []string{"foo"},
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toJSONLD(tt.jsonLDContext, tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestJSONFeatures_featureAsJSONLD(t *testing.T) {
+	baseURL, err := neturl.Parse("http://localhost:8080")
+	assert.NoError(t, err)
+	jf := &jsonFeatures{}
+	rr := httptest.NewRecorder()
+	feat := &domain.Feature{ID: domain.NewFeatureID(1), Feature: geojson.Feature{Properties: map[string]any{}}}
+	jf.featureAsJSONLD(rr, "foo", feat, featureURL{*baseURL, neturl.Values{}})
+
+	assert.Equal(t, engine.MediaTypeJSONLD, rr.Header().Get("Content-Type"))
+	var result struct {
+		Links []domain.Link `json:"links"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, domain.Link{
+		Rel:   "self",
+		Title: "This document as JSON-LD",
+		Type:  engine.MediaTypeJSONLD,
+		Href:  "http://localhost:8080/collections/foo/items/1?f=jsonld",
+	}, result.Links[0])
+	assert.Equal(t, "This document as GeoJSON", result.Links[1].Title)
+}
+
+func TestJSONFeatures_featureCollectionToJSON(t *testing.T) {
+	fc := &domain.FeatureCollection{
+		Links:          []domain.Link{{Rel: "self", Href: "https://api.foobar.example/collections/foo/items?f=json&limit=3"}},
+		NumberReturned: 3,
+	}
+	for i := 1; i <= 3; i++ {
+		fc.Features = append(fc.Features, &domain.Feature{
+			ID: domain.NewFeatureID(int64(i)),
+			Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.Point{5.2, 52.1}},
+				Properties: map[string]any{"straatnaam": "Silodam <&>"},
+			},
+		})
+	}
+	unlimited, err := toJSON(fc)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		maxResponseSize int
+		wantErr         bool
+	}{
+		{
+			name:            "no max response size",
+			maxResponseSize: 0,
+		},
+		{
+			name:            "response within max response size",
+			maxResponseSize: len(unlimited),
+		},
+		{
+			name:            "response exceeds max response size",
+			maxResponseSize: len(unlimited) / 2,
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jf := &jsonFeatures{maxResponseSize: tt.maxResponseSize}
+			got, err := jf.featureCollectionToJSON("foo", fc)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errResponseTooLarge)
+				var apiErr *engine.Error
+				assert.True(t, errors.As(jf.encodingError(err, ""), &apiErr))
+				assert.Equal(t, http.StatusRequestEntityTooLarge, apiErr.Status)
+				assert.Contains(t, apiErr.Detail, "limit")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, string(unlimited), string(got))
+		})
+	}
+}
+
+func TestJSONFeatures_setResponseMetadata(t *testing.T) {
+	jf := &jsonFeatures{now: func() time.Time {
+		return time.Date(2024, 1, 2, 4, 4, 5, 123, time.FixedZone("CET", 3600))
+	}}
+	numberMatched := 10
+	fc := &domain.FeatureCollection{
+		NumberMatched:  &numberMatched,
+		NumberReturned: 5, // stale, e.g. features are filtered after retrieval
+		Features:       []*domain.Feature{{ID: domain.NewFeatureID(1)}, {ID: domain.NewFeatureID(2)}},
+	}
+	jf.setResponseMetadata(fc)
+	assert.Equal(t, "2024-01-02T03:04:05Z", fc.TimeStamp)
+	assert.Equal(t, 2, fc.NumberReturned)
+	assert.Equal(t, 10, *fc.NumberMatched)
+}
+
+func TestJSONFeatures_streamFeaturesAsGeoJSON(t *testing.T) {
+	baseURL, _ := neturl.Parse("https://api.foobar.example")
+	featuresURL := featureCollectionURL{*baseURL, neturl.Values{"limit": []string{"2"}}, nil}
+	cursor := domain.Cursors{Next: "abc", HasNext: true}
+	jf := &jsonFeatures{foreignMembers: foreignMembersByCollectionID{
+		"foo": {featureCollection: []byte(`{"license":"CC0"}`), feature: []byte(`{"source":"BAG"}`)},
+	}}
+	newFeatures := func() []*domain.Feature {
+		var features []*domain.Feature
+		for i := 1; i <= 2; i++ {
+			features = append(features, &domain.Feature{
+				ID: domain.NewFeatureID(int64(i)),
+				Feature: geojson.Feature{
+					Geometry:   geojson.Geometry{Geometry: geom.Point{5.2, 52.1}},
+					Properties: map[string]any{"straatnaam": "Silodam <&>"},
+				},
+			})
+		}
+		return features
+	}
+	streamOf := func(features []*domain.Feature, err error) func() (*domain.Feature, error) {
+		return func() (*domain.Feature, error) {
+			if len(features) == 0 {
+				return nil, err
+			}
+			feature := features[0]
+			features = features[1:]
+			return feature, nil
+		}
+	}
+
+	// streaming should result in the same document as encoding the materialized page
+	want := httptest.NewRecorder()
+	assert.NoError(t, jf.featuresAsGeoJSON(want, "foo", cursor, featuresURL,
+		&domain.FeatureCollection{TimeStamp: "2024-01-02T03:04:05Z", NumberReturned: 2, Features: newFeatures()}))
+	got := httptest.NewRecorder()
+	assert.NoError(t, jf.streamFeaturesAsGeoJSON(got, "foo", cursor, featuresURL,
+		&domain.FeatureCollection{TimeStamp: "2024-01-02T03:04:05Z"}, streamOf(newFeatures(), nil)))
+	assert.JSONEq(t, want.Body.String(), got.Body.String())
+	assert.Contains(t, got.Body.String(), `"source":"BAG"}],"numberReturned":2}`)
+
+	// failure before anything is sent, a proper error is returned
+	var apiErr *engine.Error
+	err := jf.streamFeaturesAsGeoJSON(httptest.NewRecorder(), "foo", cursor, featuresURL,
+		&domain.FeatureCollection{}, streamOf(newFeatures()[:1], errors.New("query timeout")))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+
+	// failure after the response is partially sent, the response is aborted (invalid JSON)
+	var many []*domain.Feature
+	for i := 0; i < 1000; i++ {
+		many = append(many, newFeatures()...)
+	}
+	aborted := httptest.NewRecorder()
+	assert.NoError(t, jf.streamFeaturesAsGeoJSON(aborted, "foo", cursor, featuresURL,
+		&domain.FeatureCollection{}, streamOf(many, errors.New("query timeout"))))
+	assert.NotEmpty(t, aborted.Body.Bytes())
+	assert.False(t, json.Valid(aborted.Body.Bytes()))
+}
@@ -0,0 +1,180 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+)
+
+const (
+	// JSON-FG (draft 0.2) core conformance class, advertised in the conformsTo member of documents
+	jsonFGCoreConformance = "http://www.opengis.net/spec/json-fg-1/0.2/conf/core"
+
+	// JSON-FG date of a feature, when the temporal property holds a date (without time of day)
+	jsonFGDateLayout = time.DateOnly
+
+	// JSON-FG open start or end of an interval
+	jsonFGUnbounded = ".."
+)
+
+// jsonFGFeatureCollection JSON-FG FeatureCollection, a GeoJSON FeatureCollection with extra members.
+// See https://docs.ogc.org/DRAFTS/21-045.html
+type jsonFGFeatureCollection struct {
+	Type           string            `json:"type"`
+	ConformsTo     []string          `json:"conformsTo"`
+	FeatureType    string            `json:"featureType"`
+	CoordRefSys    string            `json:"coordRefSys"`
+	Links          []domain.Link     `json:"links,omitempty"`
+	TimeStamp      string            `json:"timeStamp,omitempty"`
+	NumberMatched  *int              `json:"numberMatched,omitempty"`
+	NumberReturned int               `json:"numberReturned"`
+	Bbox           *geom.Extent      `json:"bbox,omitempty"`
+	Features       []json.RawMessage `json:"features"`
+}
+
+// jsonFGFeature JSON-FG Feature. Geometries in CRS84 are in the geometry member (like GeoJSON),
+// geometries in another CRS are in the place member, in which case geometry is null.
+type jsonFGFeature struct {
+	Type        string                 `json:"type"`
+	ConformsTo  []string               `json:"conformsTo,omitempty"`  // only on the root of the document
+	FeatureType string                 `json:"featureType,omitempty"` // only on the root of the document
+	CoordRefSys string                 `json:"coordRefSys,omitempty"` // only on the root of the document
+	ID          domain.FeatureID       `json:"id"`
+	Time        *jsonFGTime            `json:"time"`
+	Place       *geojson.Geometry      `json:"place"`
+	Geometry    *geojson.Geometry      `json:"geometry"`
+	Properties  map[string]interface{} `json:"properties"`
+	Links       []domain.Link          `json:"links,omitempty"`
+}
+
+// jsonFGTime JSON-FG time of a feature, either an instant (date or timestamp) or an interval
+type jsonFGTime struct {
+	Date      string   `json:"date,omitempty"`
+	Timestamp string   `json:"timestamp,omitempty"`
+	Interval  []string `json:"interval,omitempty"`
+}
+
+// featuresAsJSONFG serves the FeatureCollection as JSON-FG, the geometries are in the requested CRS
+func (jf *jsonFeatures) featuresAsJSONFG(w http.ResponseWriter, collectionID string, crs int,
+	cursor domain.Cursors, featuresURL featureCollectionURL, fc *domain.FeatureCollection) error {
+
+	coordRefSys := crsURI(crs)
+	result := jsonFGFeatureCollection{
+		Type:           "FeatureCollection",
+		ConformsTo:     []string{jsonFGCoreConformance},
+		FeatureType:    collectionID,
+		CoordRefSys:    coordRefSys,
+		Links:          jf.createFeatureCollectionLinks(engine.FormatJSONFG, collectionID, cursor, featuresURL),
+		TimeStamp:      fc.TimeStamp,
+		NumberMatched:  fc.NumberMatched,
+		NumberReturned: fc.NumberReturned,
+		Bbox:           fc.Bbox,
+	}
+	features := make([]*jsonFGFeature, 0, len(fc.Features))
+	for _, feat := range fc.Features {
+		features = append(features, jf.toJSONFGFeature(collectionID, coordRefSys, feat))
+	}
+	var err error
+	if result.Features, err = encodeFeatures(features, jf.maxResponseSize, nil); err != nil {
+		return jf.encodingError(err, "Failed to marshal FeatureCollection to JSON-FG")
+	}
+	fcJSON, err := toJSON(&result)
+	if err != nil {
+		return jf.encodingError(err, "Failed to marshal FeatureCollection to JSON-FG")
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeJSONFG)
+	engine.SafeWrite(w.Write, fcJSON)
+	return nil
+}
+
+// featureAsJSONFG serves a single Feature as JSON-FG, the geometry is in the requested CRS
+func (jf *jsonFeatures) featureAsJSONFG(w http.ResponseWriter, collectionID string, crs int, feat *domain.Feature,
+	url featureURL) {
+
+	coordRefSys := crsURI(crs)
+	feat.Links = jf.createFeatureLinks(engine.FormatJSONFG, url, collectionID, feat.ID)
+	result := jf.toJSONFGFeature(collectionID, coordRefSys, feat)
+	result.ConformsTo = []string{jsonFGCoreConformance}
+	result.FeatureType = collectionID
+	result.CoordRefSys = coordRefSys
+	featJSON, err := toJSON(result)
+	if err != nil {
+		http.Error(w, "Failed to marshal Feature to JSON-FG", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeJSONFG)
+	engine.SafeWrite(w.Write, featJSON)
+}
+
+func (jf *jsonFeatures) toJSONFGFeature(collectionID string, crsURI string, feat *domain.Feature) *jsonFGFeature {
+	result := &jsonFGFeature{
+		Type:       "Feature",
+		ID:         feat.ID,
+		Time:       jf.jsonFGTime(collectionID, feat.Properties),
+		Properties: feat.Properties,
+		Links:      feat.Links,
+	}
+	if feat.Geometry.Geometry != nil {
+		geometry := feat.Geometry
+		if crsURI == crs84URI {
+			result.Geometry = &geometry
+		} else {
+			result.Place = &geometry
+		}
+	}
+	return result
+}
+
+// jsonFGTime time of the feature based on the temporal properties of the collection (see config),
+// nil when the collection has no temporal properties or the feature has no (valid) time
+func (jf *jsonFeatures) jsonFGTime(collectionID string, properties map[string]interface{}) *jsonFGTime {
+	temporal, ok := jf.temporal[collectionID]
+	if !ok {
+		return nil
+	}
+	start, startIsDate, startOk := jsonFGInstant(properties[temporal.StartDate])
+	if temporal.EndDate == "" {
+		if !startOk {
+			return nil
+		}
+		if startIsDate {
+			return &jsonFGTime{Date: start}
+		}
+		return &jsonFGTime{Timestamp: start}
+	}
+	end, _, endOk := jsonFGInstant(properties[temporal.EndDate])
+	if !startOk && !endOk {
+		return nil
+	}
+	if !startOk {
+		start = jsonFGUnbounded
+	}
+	if !endOk {
+		end = jsonFGUnbounded
+	}
+	return &jsonFGTime{Interval: []string{start, end}}
+}
+
+// jsonFGInstant formats the given property value as a JSON-FG date or timestamp (RFC 3339 in UTC)
+func jsonFGInstant(value any) (instant string, isDate bool, ok bool) {
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return "", false, false
+		}
+		return v.UTC().Format(time.RFC3339), false, true
+	case string:
+		if _, err := time.Parse(jsonFGDateLayout, v); err == nil {
+			return v, true, true
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.UTC().Format(time.RFC3339), false, true
+		}
+	}
+	return "", false, false
+}
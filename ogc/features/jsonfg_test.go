@@ -0,0 +1,116 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFeatures_jsonFGTime(t *testing.T) {
+	jf := &jsonFeatures{temporal: temporalByCollectionID{
+		"instants":  {StartDate: "datum"},
+		"intervals": {StartDate: "begin", EndDate: "eind"},
+	}}
+	tests := []struct {
+		name       string
+		collection string
+		properties map[string]any
+		want       *jsonFGTime
+	}{
+		{
+			name:       "timestamp",
+			collection: "instants",
+			properties: map[string]any{"datum": time.Date(2023, 5, 8, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))},
+			want:       &jsonFGTime{Timestamp: "2023-05-08T10:30:00Z"},
+		},
+		{
+			name:       "date",
+			collection: "instants",
+			properties: map[string]any{"datum": "2023-05-08"},
+			want:       &jsonFGTime{Date: "2023-05-08"},
+		},
+		{
+			name:       "interval with open end",
+			collection: "intervals",
+			properties: map[string]any{"begin": time.Date(2023, 5, 8, 0, 0, 0, 0, time.UTC), "eind": nil},
+			want:       &jsonFGTime{Interval: []string{"2023-05-08T00:00:00Z", ".."}},
+		},
+		{
+			name:       "no time",
+			collection: "instants",
+			properties: map[string]any{"datum": nil},
+		},
+		{
+			name:       "collection without temporal properties",
+			collection: "foo",
+			properties: map[string]any{"datum": "2023-05-08"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, jf.jsonFGTime(tt.collection, tt.properties))
+		})
+	}
+}
+
+func TestJSONFeatures_featureAsJSONFG(t *testing.T) {
+	baseURL, err := neturl.Parse("http://localhost:8080")
+	require.NoError(t, err)
+	tests := []struct {
+		name            string
+		crs             int
+		wantCoordRefSys string
+		wantPlace       bool
+	}{
+		{
+			name:            "CRS84 in geometry",
+			crs:             wgs84SRID,
+			wantCoordRefSys: crs84URI,
+		},
+		{
+			name:            "other CRS in place",
+			crs:             28992,
+			wantCoordRefSys: "http://www.opengis.net/def/crs/EPSG/0/28992",
+			wantPlace:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jf := &jsonFeatures{jsonFG: true}
+			feat := &domain.Feature{ID: domain.NewFeatureID(1), Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.Point{5, 52}},
+				Properties: map[string]any{"naam": "foo"},
+			}}
+			rr := httptest.NewRecorder()
+			jf.featureAsJSONFG(rr, "foo", tt.crs, feat, featureURL{*baseURL, neturl.Values{}})
+
+			assert.Equal(t, engine.MediaTypeJSONFG, rr.Header().Get("Content-Type"))
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.Equal(t, []any{jsonFGCoreConformance}, got["conformsTo"])
+			assert.Equal(t, "foo", got["featureType"])
+			assert.Equal(t, tt.wantCoordRefSys, got["coordRefSys"])
+			assert.Nil(t, got["time"])
+			assert.Contains(t, got, "time")
+			if tt.wantPlace {
+				assert.NotNil(t, got["place"])
+				assert.Nil(t, got["geometry"])
+			} else {
+				assert.Nil(t, got["place"])
+				assert.NotNil(t, got["geometry"])
+			}
+			self := got["links"].([]any)[0].(map[string]any)
+			assert.Equal(t, "self", self["rel"])
+			assert.Equal(t, engine.MediaTypeJSONFG, self["type"])
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package features
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+)
+
+const (
+	kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+	// name of the KML document in a KMZ archive, by convention
+	kmzDocument = "doc.kml"
+)
+
+// kmlFeatures serves features as KML 2.2 (or zipped as KMZ), e.g. for users loading data into Google Earth.
+// Each feature is a Placemark with its properties as ExtendedData, nested properties (e.g. expanded relations)
+// are flattened like in CSV. KML only supports WGS84 longitude/latitude, so other CRSs are rejected.
+type kmlFeatures struct{}
+
+func newKMLFeatures() *kmlFeatures {
+	return &kmlFeatures{}
+}
+
+// features serves a page of features as KML Document. The next/prev page is linked using Link headers
+// (RFC 8288), since Google Earth doesn't follow links in the document.
+func (kf *kmlFeatures) features(w http.ResponseWriter, collectionID string, format string, crs int,
+	cursor domain.Cursors, featuresURL featureCollectionURL, fc *domain.FeatureCollection) error {
+
+	if err := validateKMLCrs(crs); err != nil {
+		return err
+	}
+	doc, err := encodeKML(collectionID, fc.Features)
+	if err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to convert features in collection %s to KML", collectionID), err)
+	}
+	featuresURL.setPaginationLinkHeaders(w, collectionID, cursor, format, kmlMediaType(format))
+	return kf.write(w, format, doc)
+}
+
+// feature serves a single feature as KML Document with one Placemark
+func (kf *kmlFeatures) feature(w http.ResponseWriter, collectionID string, format string, crs int,
+	feat *domain.Feature) error {
+
+	if err := validateKMLCrs(crs); err != nil {
+		return err
+	}
+	doc, err := encodeKML(collectionID, []*domain.Feature{feat})
+	if err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to convert feature %s in collection %s to KML", feat.ID, collectionID), err)
+	}
+	return kf.write(w, format, doc)
+}
+
+func (kf *kmlFeatures) write(w http.ResponseWriter, format string, doc []byte) error {
+	if format == engine.FormatKMZ {
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		file, err := archive.Create(kmzDocument)
+		if err == nil {
+			_, err = file.Write(doc)
+		}
+		if err == nil {
+			err = archive.Close()
+		}
+		if err != nil {
+			return engine.InternalError("failed to create KMZ", err)
+		}
+		doc = buf.Bytes()
+	}
+	w.Header().Set("Content-Type", kmlMediaType(format))
+	engine.SafeWrite(w.Write, doc)
+	return nil
+}
+
+func validateKMLCrs(crs int) error {
+	if crs != wgs84SRID {
+		return engine.BadRequest(fmt.Sprintf("KML only supports coordinates in %s, request these using crs=%s", crs84URI, crs84URI))
+	}
+	return nil
+}
+
+func kmlMediaType(format string) string {
+	if format == engine.FormatKMZ {
+		return engine.MediaTypeKMZ
+	}
+	return engine.MediaTypeKML
+}
+
+// encodeKML writes the features as Placemarks in a KML Document named after the collection
+func encodeKML(collectionID string, features []*domain.Feature) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintf(&buf, `<kml xmlns="%s"><Document><name>%s</name>`, kmlNamespace, escapeXML(collectionID))
+	for _, feat := range features {
+		id := feat.ID.String()
+		fmt.Fprintf(&buf, `<Placemark id="%s"><name>%s</name>`, toXMLName(collectionID+"."+id), escapeXML(id))
+
+		values := make(map[string]string, len(feat.Properties))
+		flattenProperties("", feat.Properties, values)
+		if len(values) > 0 {
+			// sort for stable output
+			names := make([]string, 0, len(values))
+			for name := range values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			buf.WriteString(`<ExtendedData>`)
+			for _, name := range names {
+				fmt.Fprintf(&buf, `<Data name="%s"><value>%s</value></Data>`, escapeXML(name), escapeXML(values[name]))
+			}
+			buf.WriteString(`</ExtendedData>`)
+		}
+		if feat.Geometry.Geometry != nil {
+			if err := kmlGeometry(&buf, feat.Geometry.Geometry); err != nil {
+				return nil, fmt.Errorf("feature %s: %w", id, err)
+			}
+		}
+		buf.WriteString(`</Placemark>`)
+	}
+	buf.WriteString(`</Document></kml>`)
+	return buf.Bytes(), nil
+}
+
+// kmlGeometry writes the geometry as KML, multi geometries and geometry collections become a MultiGeometry
+func kmlGeometry(buf *bytes.Buffer, g geom.Geometry) error {
+	switch t := g.(type) {
+	case geom.Point:
+		fmt.Fprintf(buf, `<Point><coordinates>%s</coordinates></Point>`, kmlCoordinates([][2]float64{t}))
+	case geom.LineString:
+		fmt.Fprintf(buf, `<LineString><coordinates>%s</coordinates></LineString>`, kmlCoordinates(t))
+	case geom.Polygon:
+		buf.WriteString(`<Polygon>`)
+		for i, ring := range t {
+			boundary := "innerBoundaryIs"
+			if i == 0 {
+				boundary = "outerBoundaryIs"
+			}
+			fmt.Fprintf(buf, `<%s><LinearRing><coordinates>%s</coordinates></LinearRing></%s>`,
+				boundary, kmlCoordinates(closeRing(ring)), boundary)
+		}
+		buf.WriteString(`</Polygon>`)
+	case geom.MultiPoint:
+		members := make([]geom.Geometry, 0, len(t))
+		for _, p := range t {
+			members = append(members, geom.Point(p))
+		}
+		return kmlMultiGeometry(buf, members)
+	case geom.MultiLineString:
+		members := make([]geom.Geometry, 0, len(t))
+		for _, l := range t {
+			members = append(members, geom.LineString(l))
+		}
+		return kmlMultiGeometry(buf, members)
+	case geom.MultiPolygon:
+		members := make([]geom.Geometry, 0, len(t))
+		for _, p := range t {
+			members = append(members, geom.Polygon(p))
+		}
+		return kmlMultiGeometry(buf, members)
+	case geom.Collection:
+		return kmlMultiGeometry(buf, t)
+	default:
+		return fmt.Errorf("unsupported geometry type %T", g)
+	}
+	return nil
+}
+
+func kmlMultiGeometry(buf *bytes.Buffer, members []geom.Geometry) error {
+	buf.WriteString(`<MultiGeometry>`)
+	for _, member := range members {
+		if err := kmlGeometry(buf, member); err != nil {
+			return err
+		}
+	}
+	buf.WriteString(`</MultiGeometry>`)
+	return nil
+}
+
+// kmlCoordinates tuples of longitude,latitude separated by spaces
+func kmlCoordinates(points [][2]float64) string {
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, strconv.FormatFloat(p[0], 'f', -1, 64)+","+strconv.FormatFloat(p[1], 'f', -1, 64))
+	}
+	return strings.Join(coords, " ")
+}
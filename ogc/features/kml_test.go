@@ -0,0 +1,202 @@
+package features
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_KML(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		featureID      string
+		format         string
+		storageCrs     int
+		wantStatusCode int
+		wantContains   []string
+	}{
+		{
+			name:           "Features as KML",
+			url:            "http://localhost:8080/collections/:collectionId/items?limit=2",
+			format:         engine.FormatKML,
+			storageCrs:     wgs84SRID,
+			wantStatusCode: http.StatusOK,
+			wantContains: []string{
+				`<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>foo</name>`,
+				`<Placemark id="foo.3542"><name>3542</name><ExtendedData>`,
+				`<Data name="straatnaam"><value>Van Diemenkade</value></Data>`,
+				`<Point><coordinates>120919.942,489320.199</coordinates></Point></Placemark>`,
+			},
+		},
+		{
+			name:           "Feature as KML",
+			url:            "http://localhost:8080/collections/:collectionId/items/:featureId",
+			featureID:      "4030",
+			format:         engine.FormatKML,
+			storageCrs:     wgs84SRID,
+			wantStatusCode: http.StatusOK,
+			wantContains: []string{
+				`<Placemark id="foo.4030"><name>4030</name>`,
+				`<Data name="huisnummer">`,
+			},
+		},
+		{
+			name:           "Features as KMZ",
+			url:            "http://localhost:8080/collections/:collectionId/items?limit=2",
+			format:         engine.FormatKMZ,
+			storageCrs:     wgs84SRID,
+			wantStatusCode: http.StatusOK,
+			wantContains: []string{
+				`<Placemark id="foo.3542"><name>3542</name>`,
+			},
+		},
+		{
+			name:           "KML requires CRS84, features are stored in another CRS",
+			url:            "http://localhost:8080/collections/:collectionId/items",
+			format:         engine.FormatKML,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "KML doesn't support other CRSs",
+			url:            "http://localhost:8080/collections/:collectionId/items?crs=http://www.opengis.net/def/crs/EPSG/0/28992",
+			format:         engine.FormatKML,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			features := NewFeatures(eng, chi.NewRouter())
+			if tt.storageCrs != 0 {
+				features.datasource = &storageCrsDatasource{Datasource: features.datasource, crs: tt.storageCrs}
+			}
+			req, err := createRequest(tt.url, "foo", tt.featureID, tt.format)
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			if tt.featureID != "" {
+				features.Feature().ServeHTTP(rr, req)
+			} else {
+				features.CollectionContent().ServeHTTP(rr, req)
+			}
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			doc := rr.Body.Bytes()
+			if tt.format == engine.FormatKMZ {
+				assert.Equal(t, engine.MediaTypeKMZ, rr.Header().Get("Content-Type"))
+				doc = readKMZ(t, doc)
+			} else {
+				assert.Equal(t, engine.MediaTypeKML, rr.Header().Get("Content-Type"))
+			}
+			for _, want := range tt.wantContains {
+				assert.Contains(t, string(doc), want)
+			}
+			assertWellFormedXML(t, doc)
+		})
+	}
+}
+
+// storageCrsDatasource datasource stub, reports the given CRS as the CRS in which the features are stored
+type storageCrsDatasource struct {
+	datasources.Datasource
+	crs int
+}
+
+func (ds *storageCrsDatasource) GetStorageCrs(_ string) (int, error) {
+	return ds.crs, nil
+}
+
+func TestKMLGeometry(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry geom.Geometry
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Point",
+			geometry: geom.Point{5.1, 52.3},
+			want:     `<Point><coordinates>5.1,52.3</coordinates></Point>`,
+		},
+		{
+			name:     "Polygon with hole and unclosed ring",
+			geometry: geom.Polygon{{{0, 0}, {4, 0}, {4, 4}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+			want: `<Polygon><outerBoundaryIs><LinearRing><coordinates>0,0 4,0 4,4 0,0</coordinates></LinearRing></outerBoundaryIs>` +
+				`<innerBoundaryIs><LinearRing><coordinates>1,1 2,1 2,2 1,1</coordinates></LinearRing></innerBoundaryIs></Polygon>`,
+		},
+		{
+			name:     "Collection",
+			geometry: geom.Collection{geom.Point{1, 2}, geom.MultiLineString{{{1, 2}, {3, 4}}}},
+			want: `<MultiGeometry><Point><coordinates>1,2</coordinates></Point>` +
+				`<MultiGeometry><LineString><coordinates>1,2 3,4</coordinates></LineString></MultiGeometry></MultiGeometry>`,
+		},
+		{
+			name:     "Unsupported geometry",
+			geometry: geom.Line{{1, 2}, {3, 4}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := kmlGeometry(&buf, tt.geometry)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestEncodeKML(t *testing.T) {
+	features := []*domain.Feature{
+		{
+			ID: domain.NewTextFeatureID("a&b"),
+			Feature: geojson.Feature{
+				Properties: map[string]any{"name": "<foo>", "relation": map[string]any{"id": 1}, "empty": nil},
+			},
+		},
+	}
+	doc, err := encodeKML("foo", features)
+	require.NoError(t, err)
+	assert.Contains(t, string(doc), `<Placemark id="foo.a_b"><name>a&amp;b</name><ExtendedData>`+
+		`<Data name="empty"><value></value></Data>`+
+		`<Data name="name"><value>&lt;foo&gt;</value></Data>`+
+		`<Data name="relation.id"><value>1</value></Data>`+
+		`</ExtendedData></Placemark>`)
+	assertWellFormedXML(t, doc)
+}
+
+// readKMZ returns the KML document in the given KMZ archive
+func readKMZ(t *testing.T, kmz []byte) []byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(kmz), int64(len(kmz)))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 1)
+	assert.Equal(t, kmzDocument, archive.File[0].Name)
+	file, err := archive.File[0].Open()
+	require.NoError(t, err)
+	defer file.Close()
+	doc, err := io.ReadAll(file)
+	require.NoError(t, err)
+	return doc
+}
@@ -1,19 +1,21 @@
 package features
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	neturl "net/url"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/PDOK/gokoala/engine"
 	"github.com/PDOK/gokoala/ogc/common/geospatial"
+	"github.com/PDOK/gokoala/ogc/features/cql"
 	"github.com/PDOK/gokoala/ogc/features/datasources"
 	"github.com/PDOK/gokoala/ogc/features/datasources/geopackage"
-	"github.com/PDOK/gokoala/ogc/features/datasources/postgis"
 	"github.com/PDOK/gokoala/ogc/features/domain"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-spatial/geom"
@@ -21,162 +23,489 @@ import (
 
 const (
 	templatesDir = "ogc/features/templates/"
-)
+	wgs84SRID    = 4326
+
+	// value of the geometry param to return a point on the surface of each feature instead of the geometry
+	geometryCentroid = "centroid"
+
+	// only supported value of the filter-lang param
+	filterLangCQL2Text = "cql2-text"
 
-var (
-	collections map[string]*engine.GeoSpatialCollectionMetadata
+	// name of the geometry of features in filters
+	filterGeometryProperty = "geometry"
 )
 
 type Features struct {
-	engine     *engine.Engine
-	datasource datasources.Datasource
+	engine       *engine.Engine
+	datasource   datasources.Datasource
+	relations    relationsByCollectionID
+	queryables   queryablesByCollectionID
+	searchable   searchableCollections
+	timeZones    timeZonesByCollectionID
+	temporal     temporalByCollectionID
+	supportedCrs supportedCrsByCollectionID
+	attachments  attachmentsByCollectionID
+	fidTypes     fidTypesByCollectionID
+	offsets      offsetPaginationCollections
+	properties   propertiesByCollectionID
+	collections  map[string]*engine.GeoSpatialCollectionMetadata
+
+	attachmentAccessHooks []AttachmentAccessHook
+	terms                 downloadTerms
 
 	html *htmlFeatures
 	json *jsonFeatures
+	gml  *gmlFeatures
+	csv  *csvFeatures
+	fgb  *fgbFeatures
+	kml  *kmlFeatures
+	rdf  *rdfFeatures
 }
 
-func NewFeatures(e *engine.Engine, router *chi.Mux) *Features {
+func NewFeatures(e *engine.Engine, router chi.Router) *Features {
 	cfg := e.Config.OgcAPI.Features
 
-	var datasource datasources.Datasource
-	if cfg.Datasource.GeoPackage != nil {
-		datasource = geopackage.NewGeoPackage(cfg.Collections, *cfg.Datasource.GeoPackage)
-	} else if cfg.Datasource.PostGIS != nil {
-		datasource = postgis.NewPostGIS()
+	// geopackage is the only supported datasource, see validateFeatureDatasource in config
+	datasource := geopackage.NewGeoPackage(cfg.Collections, *cfg.Datasource.GeoPackage)
+	e.RegisterShutdownHook(engine.ShutdownHook{Name: "features datasource", Func: datasource.Close})
+	e.RegisterHealthCheck("features datasource", datasource.Ping)
+	if e.Config.Warmup != nil && e.Config.Warmup.SmokeQueries {
+		e.RegisterWarmupTask(engine.WarmupTask{Name: "features smoke queries", Func: smokeQueries(datasource, cfg.Collections)})
 	}
-	e.RegisterShutdownHook(datasource.Close)
 
+	collections := cacheCollectionsMetadata(e)
+	properties := newProperties(cfg.Collections)
 	f := &Features{
-		engine:     e,
-		datasource: datasource,
-		html:       newHTMLFeatures(e),
-		json:       newJSONFeatures(e),
+		engine:       e,
+		datasource:   datasource,
+		relations:    newRelations(cfg.Collections),
+		queryables:   newQueryables(cfg.Collections),
+		searchable:   newSearchableCollections(cfg.Collections),
+		timeZones:    newTimeZones(cfg.Collections),
+		temporal:     newTemporal(cfg.Collections),
+		supportedCrs: newSupportedCrs(cfg),
+		attachments:  newAttachments(cfg.Collections),
+		fidTypes:     newFidTypes(cfg.Collections),
+		offsets:      newOffsetPaginationCollections(cfg.Collections),
+		properties:   properties,
+		terms:        newDownloadTerms(e, cfg.Collections),
+		collections:  collections,
+		html:         newHTMLFeatures(e, collections, properties),
+		json:         newJSONFeatures(e),
+		gml:          newGMLFeatures(e),
+		csv:          newCSVFeatures(e),
+		fgb:          newFlatGeobufFeatures(),
+		kml:          newKMLFeatures(),
+		rdf:          newRDFFeatures(e),
 	}
-	collections = f.cacheCollectionsMetadata()
 
-	router.Get(geospatial.CollectionsPath+"/{collectionId}/items", f.CollectionContent())
-	router.Get(geospatial.CollectionsPath+"/{collectionId}/items/{featureId}", f.Feature())
+	// identical concurrent requests share a single datasource query
+	coalescer := engine.NewRequestCoalescer(e.CN, e.Templates.VariantHeaders()...)
+	itemsMiddleware := chi.Middlewares{coalescer.Coalesce}
+	if cfg.ConcurrencyLimit != nil {
+		limiter := engine.NewConcurrencyLimiter("spatial features", *cfg.ConcurrencyLimit)
+		itemsMiddleware = append(itemsMiddleware, limiter.Limit(isSpatialRequest))
+	}
+	router.With(itemsMiddleware...).Get(geospatial.CollectionsPath+"/{collectionId}/items", f.CollectionContent())
+	router.With(coalescer.Coalesce).Get(geospatial.CollectionsPath+"/{collectionId}/items/{featureId}", f.Feature())
+	router.With(coalescer.Coalesce).Get(geospatial.CollectionsPath+"/{collectionId}/suggest", f.Suggest())
+	router.Get(geospatial.CollectionsPath+"/{collectionId}/schema", f.Schema())
+	router.Get(geospatial.CollectionsPath+"/{collectionId}/queryables", f.Queryables())
+	router.Get(geospatial.CollectionsPath+"/{collectionId}/items/{featureId}/attachments/{property}", f.Attachment())
+	router.Get(geospatial.CollectionsPath+"/{collectionId}/terms", f.Terms())
+	router.Post(geospatial.CollectionsPath+"/{collectionId}/terms", f.AcceptTerms())
 	return f
 }
 
+// isSpatialRequest spatial queries are the most expensive requests to the datasource
+func isSpatialRequest(r *http.Request) bool {
+	return r.URL.Query().Get(bboxParam) != "" || r.URL.Query().Get(nearestParam) != ""
+}
+
 // CollectionContent serve a FeatureCollection with the given collectionId
 func (f *Features) CollectionContent(_ ...any) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Query().Has(idsParam) {
+			return f.featuresByID(w, r)
+		}
 		collectionID, encodedCursor, limit, bbox, bboxCrs, err := f.parseFeatureCollectionRequest(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		outputOptions, outputErr := f.parseOutputOptions(r.URL.Query())
+		expand, expandErr := f.relations.parseExpand(collectionID, r.URL.Query())
+		search, searchErr := f.searchable.parseSearch(collectionID, r.URL.Query())
+		nearest, nearestErr := f.parseNearest(r.URL.Query())
+		filter, filterCrs, filterErr := f.parseFilter(collectionID, r.URL.Query())
+		temporal, dateTimeErr := f.temporal.parseDateTime(collectionID, r.URL.Query())
+		crsErr := f.supportedCrs.validate(collectionID, r.URL.Query())
+		offset, offsetErr := f.offsets.parseOffset(collectionID, r.URL.Query())
+		_, encodingErr := domain.ParseGeometryEncoding(r.URL.Query().Get(geometryEncodingParam)) // used by CSV
+		if err == nil && limit == 0 && search != "" {
+			err = fmt.Errorf("limit=0 can't be combined with the %s param", searchParam)
 		}
-		url := featureCollectionURL{*f.engine.Config.BaseURL.URL, r.URL.Query()}
+		if err = errors.Join(err, outputErr, expandErr, searchErr, nearestErr, filterErr, dateTimeErr, crsErr, offsetErr,
+			encodingErr); err != nil {
+			return engine.BadRequest(err.Error())
+		}
+		url := featureCollectionURL{*f.engine.Config.BaseURL.URL, r.URL.Query(), f.queryables[collectionID]}
 		if err = url.validateNoUnknownParams(); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if _, ok := collections[collectionID]; !ok {
-			log.Printf("collection %s doesn't exist in this features service", collectionID)
-			http.NotFound(w, r)
-			return
-		}
-
-		fc, newCursor, err := f.datasource.GetFeatures(r.Context(), collectionID, datasources.FeatureOptions{
-			Cursor:  encodedCursor.Decode(url.checksum()),
-			Limit:   limit,
-			Bbox:    bbox,
-			BboxCrs: bboxCrs,
-			// TODO set crs, filters, etc
-		})
+			return engine.BadRequest(err.Error())
+		}
+		if _, ok := f.collections[collectionID]; !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist in this features service", collectionID))
+		}
+
+		options := datasources.FeatureOptions{
+			Cursor:          encodedCursor.Decode(url.checksum()),
+			Limit:           limit,
+			Offset:          offset,
+			Bbox:            bbox,
+			BboxCrs:         bboxCrs,
+			Filter:          filter,
+			FilterCrs:       filterCrs,
+			PropertyFilters: f.queryables.parsePropertyFilters(collectionID, r.URL.Query()),
+			Temporal:        temporal,
+			Search:          search,
+			OutputOptions:   outputOptions,
+		}
+		if nearest != nil {
+			options.Nearest, options.NearestCrs, options.Limit = &nearest.point, nearest.crs, nearest.count
+		}
+		f.timeZones.localizeFilters(collectionID, options.PropertyFilters)
+		f.timeZones.localizeTemporal(collectionID, options.Temporal)
+		// negotiate on a copy of the request, since negotiation removes the ?f= param required by serveFeatures
+		format := f.engine.CN.NegotiateFormat(r.Clone(r.Context()))
+		switch format {
+		case engine.FormatGeoParquet:
+			return f.exportGeoParquet(w, r, collectionID, url, options)
+		case engine.FormatFlatGeobuf:
+			return f.exportFlatGeobuf(w, r, collectionID, url, options)
+		}
+		if options.Limit == 0 {
+			return f.featureHits(w, r, collectionID, url, options)
+		}
+		if f.canStream(format, options, expand) {
+			return f.streamFeatures(w, r, collectionID, format, url, options)
+		}
+		fc, newCursor, err := f.datasource.GetFeatures(r.Context(), collectionID, options)
 		if err != nil {
-			// log error, but sent generic message to client to prevent possible information leakage from datasource
-			msg := fmt.Sprintf("failed to retrieve feature collection %s", collectionID)
-			log.Printf("%s, error: %v\n", msg, err)
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
+			return datasourceError(fmt.Sprintf("failed to retrieve feature collection %s", collectionID), err)
 		}
 		if fc == nil {
 			log.Printf("no results found for collection '%s' with params: %s",
 				collectionID, r.URL.Query().Encode())
-			return // still 200 OK
+			return nil // still 200 OK
 		}
-
-		switch f.engine.CN.NegotiateFormat(r) {
-		case engine.FormatHTML:
-			f.html.features(w, r, collectionID, newCursor, url, limit, fc)
-		case engine.FormatJSON:
-			f.json.featuresAsGeoJSON(w, collectionID, newCursor, url, fc)
-		case engine.FormatJSONFG:
-			f.json.featuresAsJSONFG()
-		default:
-			http.NotFound(w, r)
-			return
+		if err = f.numberMatched(r, collectionID, options, fc); err != nil {
+			return err
 		}
-	}
+		f.timeZones.normalize(collectionID, fc.Features)
+		f.attachments.link(*f.engine.Config.BaseURL.URL, collectionID, fc.Features)
+		if err = expandRelations(r.Context(), f.datasource, f.fidTypes, expand, fc.Features); err != nil {
+			return engine.InternalError(fmt.Sprintf("failed to expand relations of feature collection %s", collectionID), err)
+		}
+
+		return f.serveFeatures(w, r, collectionID, newCursor, url, limit, fc)
+	})
 }
 
 // Feature serves a single Feature
 func (f *Features) Feature() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
 		collectionID := chi.URLParam(r, "collectionId")
-		featureID, err := strconv.Atoi(chi.URLParam(r, "featureId"))
+		featureID, err := f.fidTypes.parse(collectionID, chi.URLParam(r, "featureId"))
 		if err != nil {
-			http.Error(w, "feature ID must be a number", http.StatusBadRequest)
-			return
+			return engine.BadRequest(err.Error())
+		}
+		outputOptions, outputErr := f.parseOutputOptions(r.URL.Query())
+		expand, expandErr := f.relations.parseExpand(collectionID, r.URL.Query())
+		crsErr := f.supportedCrs.validate(collectionID, r.URL.Query())
+		if err = errors.Join(outputErr, expandErr, crsErr); err != nil {
+			return engine.BadRequest(err.Error())
 		}
 		url := featureURL{*f.engine.Config.BaseURL.URL, r.URL.Query()}
 		if err = url.validateNoUnknownParams(); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return engine.BadRequest(err.Error())
 		}
-		if _, ok := collections[collectionID]; !ok {
-			log.Printf("collection %s doesn't exist in this features service", collectionID)
-			http.NotFound(w, r)
-			return
+		if _, ok := f.collections[collectionID]; !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist in this features service", collectionID))
 		}
 
-		feat, err := f.datasource.GetFeature(r.Context(), collectionID, int64(featureID))
+		feat, err := f.datasource.GetFeature(r.Context(), collectionID, featureID, outputOptions)
 		if err != nil {
-			// log error, but sent generic message to client to prevent possible information leakage from datasource
-			msg := fmt.Sprintf("failed to retrieve feature %d in collection %s", featureID, collectionID)
-			log.Printf("%s, error: %v\n", msg, err)
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
+			return datasourceError(fmt.Sprintf("failed to retrieve feature %s in collection %s", featureID, collectionID), err)
 		}
 		if feat == nil {
-			log.Printf("no result found for collection '%s' and feature id: %d",
-				collectionID, featureID)
-			http.NotFound(w, r)
-			return
+			return engine.NotFound(fmt.Sprintf("feature %s doesn't exist in collection %s", featureID, collectionID))
+		}
+		f.timeZones.normalize(collectionID, []*domain.Feature{feat})
+		f.attachments.link(*f.engine.Config.BaseURL.URL, collectionID, []*domain.Feature{feat})
+		if err = expandRelations(r.Context(), f.datasource, f.fidTypes, expand, []*domain.Feature{feat}); err != nil {
+			return engine.InternalError(fmt.Sprintf("failed to expand relations of feature %s in collection %s", featureID, collectionID), err)
 		}
 
-		switch f.engine.CN.NegotiateFormat(r) {
+		crs, err := f.responseCrs(collectionID, r.URL.Query())
+		if err != nil {
+			return err
+		}
+		f.setContentCrs(w, crs)
+		switch format := f.engine.CN.NegotiateFormat(r); format {
 		case engine.FormatHTML:
-			f.html.feature(w, r, collectionID, feat)
+			f.html.feature(w, r, collectionID, crs, feat)
 		case engine.FormatJSON:
 			f.json.featureAsGeoJSON(w, collectionID, feat, url)
+		case engine.FormatGeoJSONSeq:
+			return f.json.featureAsGeoJSONSeq(w, collectionID, feat)
+		case engine.FormatJSONLD:
+			f.json.featureAsJSONLD(w, collectionID, feat, url)
 		case engine.FormatJSONFG:
-			f.json.featureAsJSONFG()
+			if !f.engine.Config.FeatureEnabled(engine.FeatureFlagJSONFG) {
+				return engine.NotFound(fmt.Sprintf("format %s isn't supported", format))
+			}
+			f.json.featureAsJSONFG(w, collectionID, crs, feat, url)
+		case engine.FormatGML:
+			f.gml.feature(w, collectionID, crs, feat)
+		case engine.FormatKML, engine.FormatKMZ:
+			return f.kml.feature(w, collectionID, format, crs, feat)
+		case engine.FormatTurtle, engine.FormatNTriples:
+			if !f.rdf.hasMapping(collectionID) {
+				return engine.NotFound(fmt.Sprintf("collection %s isn't available as RDF", collectionID))
+			}
+			f.rdf.features(w, collectionID, format, []*domain.Feature{feat})
 		default:
-			http.NotFound(w, r)
-			return
+			return engine.NotFound(fmt.Sprintf("format %s isn't supported", format))
 		}
+		return nil
+	})
+}
+
+// featureHits serves a FeatureCollection without features (limit=0), only the number of features
+// matching the given options and their extent. This is much cheaper than retrieving the features.
+func (f *Features) featureHits(w http.ResponseWriter, r *http.Request, collectionID string,
+	url featureCollectionURL, options datasources.FeatureOptions) error {
+
+	fc, err := f.datasource.GetFeatureHits(r.Context(), collectionID, options)
+	if err != nil {
+		return datasourceError(fmt.Sprintf("failed to count features in collection %s", collectionID), err)
+	}
+	// no pagination, there's nothing to page through
+	return f.serveFeatures(w, r, collectionID, domain.Cursors{}, url, 0, fc)
+}
+
+// canStream whether the page of features can be written to the client while it's read from the datasource,
+// see streamFeatures. Only GeoJSON (text sequences) and CSV are streamed, other formats (or expanding relations) need the
+// whole page. Since the size of a streamed response isn't known upfront, GeoJSON isn't streamed when a max response size applies.
+func (f *Features) canStream(format string, options datasources.FeatureOptions, expand []engine.FeatureRelation) bool {
+	if _, ok := f.datasource.(datasources.StreamingDatasource); !ok || options.Offset != nil || len(expand) > 0 {
+		return false
+	}
+	return format == engine.FormatGeoJSONSeq || format == engine.FormatCSV ||
+		(format == engine.FormatJSON && f.json.maxResponseSize <= 0)
+}
+
+// streamFeatures serves a page of features as GeoJSON (text sequence) or CSV, features are encoded and written to the
+// client as they're read from the datasource. This reduces memory usage and time to first byte compared to materializing
+// the page.
+func (f *Features) streamFeatures(w http.ResponseWriter, r *http.Request, collectionID string, format string,
+	url featureCollectionURL, options datasources.FeatureOptions) error {
+
+	// CSV columns precede the rows, so these are derived from the properties of the collection
+	var properties []domain.Property
+	if format == engine.FormatCSV {
+		var err error
+		if properties, err = f.datasource.GetProperties(collectionID); err != nil {
+			return engine.InternalError(fmt.Sprintf("failed to retrieve properties of collection %s", collectionID), err)
+		}
+	}
+	// count beforehand, so no other query runs while the result set of the stream is open
+	fc := &domain.FeatureCollection{}
+	if err := f.numberMatched(r, collectionID, options, fc); err != nil {
+		return err
+	}
+	stream, cursor, err := f.datasource.(datasources.StreamingDatasource).StreamFeatures(r.Context(), collectionID, options)
+	if err != nil {
+		return datasourceError(fmt.Sprintf("failed to retrieve feature collection %s", collectionID), err)
+	}
+	if stream == nil {
+		log.Printf("no results found for collection '%s' with params: %s",
+			collectionID, r.URL.Query().Encode())
+		return nil // still 200 OK
+	}
+	defer stream.Close()
+
+	crs, err := f.responseCrs(collectionID, r.URL.Query())
+	if err != nil {
+		return err
+	}
+	baseURL := *f.engine.Config.BaseURL.URL
+	f.setContentCrs(w, crs)
+	f.json.setResponseMetadata(fc)
+	next := func() (*domain.Feature, error) {
+		feat, err := stream.Next()
+		if feat != nil {
+			f.timeZones.normalize(collectionID, []*domain.Feature{feat})
+			f.attachments.link(baseURL, collectionID, []*domain.Feature{feat})
+		}
+		return feat, err
+	}
+	switch format {
+	case engine.FormatGeoJSONSeq:
+		return f.json.featuresAsGeoJSONSeq(w, collectionID, cursor, url, next)
+	case engine.FormatCSV:
+		return f.csv.features(w, collectionID, cursor, url, csvPropertyColumns(properties, options.OutputOptions), next)
 	}
+	return f.json.streamFeaturesAsGeoJSON(w, collectionID, cursor, url, fc, next)
 }
 
-func (f *Features) cacheCollectionsMetadata() map[string]*engine.GeoSpatialCollectionMetadata {
+// numberMatched adds the number of features matching the given options to the FeatureCollection, when configured.
+// Estimates are only available without filters, nearest and search queries have no meaningful number of matches.
+func (f *Features) numberMatched(r *http.Request, collectionID string, options datasources.FeatureOptions,
+	fc *domain.FeatureCollection) error {
+
+	mode := f.engine.Config.OgcAPI.Features.NumberMatched
+	if mode == "" || options.Nearest != nil || options.Search != "" {
+		return nil
+	}
+	estimated := mode == engine.NumberMatchedEstimated
+	if estimated && options.HasFilters() {
+		return nil
+	}
+	count, err := f.datasource.GetFeatureCount(r.Context(), collectionID, options, estimated)
+	if err != nil {
+		return datasourceError(fmt.Sprintf("failed to count features in collection %s", collectionID), err)
+	}
+	fc.NumberMatched = &count
+	return nil
+}
+
+// featuresByID serves a FeatureCollection with specific Features (by ID) in the given collectionId.
+// Allows clients to resolve many references in one request instead of requesting each Feature separately.
+func (f *Features) featuresByID(w http.ResponseWriter, r *http.Request) error {
+	collectionID := chi.URLParam(r, "collectionId")
+	featureIDs, err := f.parseFeatureIDs(collectionID, r.URL.Query())
+	outputOptions, outputErr := f.parseOutputOptions(r.URL.Query())
+	expand, expandErr := f.relations.parseExpand(collectionID, r.URL.Query())
+	crsErr := f.supportedCrs.validate(collectionID, r.URL.Query())
+	if err = errors.Join(err, outputErr, expandErr, crsErr); err != nil {
+		return engine.BadRequest(err.Error())
+	}
+	url := featureCollectionURL{*f.engine.Config.BaseURL.URL, r.URL.Query(), nil}
+	if err = url.validateNoUnknownParams(); err != nil {
+		return engine.BadRequest(err.Error())
+	}
+	if _, ok := f.collections[collectionID]; !ok {
+		return engine.NotFound(fmt.Sprintf("collection %s doesn't exist in this features service", collectionID))
+	}
+
+	fc, err := f.datasource.GetFeaturesByID(r.Context(), collectionID, featureIDs, outputOptions)
+	if err != nil {
+		return datasourceError(fmt.Sprintf("failed to retrieve features by id in collection %s", collectionID), err)
+	}
+	f.timeZones.normalize(collectionID, fc.Features)
+	f.attachments.link(*f.engine.Config.BaseURL.URL, collectionID, fc.Features)
+	if err = expandRelations(r.Context(), f.datasource, f.fidTypes, expand, fc.Features); err != nil {
+		return engine.InternalError(fmt.Sprintf("failed to expand relations of features in collection %s", collectionID), err)
+	}
+
+	// no pagination, all requested features are returned at once
+	return f.serveFeatures(w, r, collectionID, domain.Cursors{}, url, len(featureIDs), fc)
+}
+
+// serveFeatures serves the FeatureCollection in the negotiated format
+func (f *Features) serveFeatures(w http.ResponseWriter, r *http.Request, collectionID string,
+	cursor domain.Cursors, url featureCollectionURL, limit int, fc *domain.FeatureCollection) error {
+
+	crs, err := f.responseCrs(collectionID, r.URL.Query())
+	if err != nil {
+		return err
+	}
+	f.setContentCrs(w, crs)
+	f.json.setResponseMetadata(fc)
+	switch format := f.engine.CN.NegotiateFormat(r); format {
+	case engine.FormatHTML:
+		f.html.features(w, r, collectionID, crs, cursor, url, limit, fc)
+	case engine.FormatJSON:
+		return f.json.featuresAsGeoJSON(w, collectionID, cursor, url, fc)
+	case engine.FormatGeoJSONSeq:
+		return f.json.featuresAsGeoJSONSeq(w, collectionID, cursor, url, sliceFeatures(fc.Features))
+	case engine.FormatJSONLD:
+		return f.json.featuresAsJSONLD(w, collectionID, cursor, url, fc)
+	case engine.FormatJSONFG:
+		if !f.engine.Config.FeatureEnabled(engine.FeatureFlagJSONFG) {
+			return engine.NotFound(fmt.Sprintf("format %s isn't supported", format))
+		}
+		return f.json.featuresAsJSONFG(w, collectionID, crs, cursor, url, fc)
+	case engine.FormatGML:
+		f.gml.features(w, collectionID, crs, cursor, url, fc)
+	case engine.FormatCSV:
+		return f.csv.features(w, collectionID, cursor, url, csvColumns(fc.Features), sliceFeatures(fc.Features))
+	case engine.FormatFlatGeobuf:
+		return f.fgb.features(w, collectionID, crs, fc)
+	case engine.FormatKML, engine.FormatKMZ:
+		return f.kml.features(w, collectionID, format, crs, cursor, url, fc)
+	case engine.FormatTurtle, engine.FormatNTriples:
+		if !f.rdf.hasMapping(collectionID) {
+			return engine.NotFound(fmt.Sprintf("collection %s isn't available as RDF", collectionID))
+		}
+		f.rdf.features(w, collectionID, format, fc.Features)
+	default:
+		return engine.NotFound(fmt.Sprintf("format %s isn't supported", format))
+	}
+	return nil
+}
+
+func cacheCollectionsMetadata(e *engine.Engine) map[string]*engine.GeoSpatialCollectionMetadata {
 	result := make(map[string]*engine.GeoSpatialCollectionMetadata)
-	for _, collection := range f.engine.Config.OgcAPI.Features.Collections {
+	for _, collection := range e.Config.OgcAPI.Features.Collections {
 		result[collection.ID] = collection.Metadata
 	}
 	return result
 }
 
+// smokeQueries retrieves a single feature of each collection, to verify the collections are queryable
+// and to warm up the datasource (e.g. connection pools or the page cache) before reporting ready
+func smokeQueries(datasource datasources.Datasource, collections engine.GeoSpatialCollections) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for _, collection := range collections {
+			if _, _, err := datasource.GetFeatures(ctx, collection.ID, datasources.FeatureOptions{Limit: 1}); err != nil {
+				return fmt.Errorf("smoke query on collection %s failed: %w", collection.ID, err)
+			}
+		}
+		return nil
+	}
+}
+
 func (f *Features) parseFeatureCollectionRequest(r *http.Request) (string, domain.EncodedCursor, int, *geom.Extent, int, error) {
 	collectionID := chi.URLParam(r, "collectionId")
 	encodedCursor := domain.EncodedCursor(r.URL.Query().Get(cursorParam))
 	limit, limitErr := f.parseLimit(r.URL.Query())
 	bbox, bboxCrs, bboxErr := f.parseBbox(r.URL.Query())
-	dateTimeErr := f.parseDateTime(r.URL.Query())
-	filterErr := f.parseFilter(r.URL.Query())
-	return collectionID, encodedCursor, limit, bbox, bboxCrs, errors.Join(limitErr, bboxErr, dateTimeErr, filterErr)
+	return collectionID, encodedCursor, limit, bbox, bboxCrs, errors.Join(limitErr, bboxErr)
+}
+
+func (f *Features) parseFeatureIDs(collectionID string, params neturl.Values) ([]domain.FeatureID, error) {
+	var excluded []string
+	for _, param := range idsExcludedParams {
+		if params.Get(param) != "" {
+			excluded = append(excluded, param)
+		}
+	}
+	if len(excluded) > 0 {
+		return nil, fmt.Errorf("ids param can't be combined with params: %s", strings.Join(excluded, ", "))
+	}
+	idValues := strings.Split(params.Get(idsParam), ",")
+	if len(idValues) > f.engine.Config.OgcAPI.Features.Limit.Max {
+		return nil, fmt.Errorf("ids param accepts at most %d ids", f.engine.Config.OgcAPI.Features.Limit.Max)
+	}
+	featureIDs := make([]domain.FeatureID, 0, len(idValues))
+	for _, v := range idValues {
+		featureID, err := f.fidTypes.parse(collectionID, strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("ids param should contain feature ids separated by commas: %w", err)
+		}
+		if !slices.Contains(featureIDs, featureID) {
+			featureIDs = append(featureIDs, featureID)
+		}
+	}
+	return featureIDs, nil
 }
 
 func (f *Features) parseLimit(params neturl.Values) (int, error) {
@@ -201,16 +530,14 @@ func (f *Features) parseLimit(params neturl.Values) (int, error) {
 func (f *Features) parseBbox(params neturl.Values) (*geom.Extent, int, error) {
 	var err error
 
-	// TODO Make more robust, once we fully implement multiple CRS support (e.g. also handle CRS84 code)
-	bboxCrs := 4326
+	bboxCrs := wgs84SRID
 	if params.Get(bboxCrsParam) != "" {
-		lastIndex := strings.LastIndex(params.Get(bboxCrsParam), "/")
-		if lastIndex != -1 {
-			crs := params.Get(bboxCrsParam)[lastIndex+1:]
-			bboxCrs, err = strconv.Atoi(crs)
-			if err != nil {
-				return nil, bboxCrs, fmt.Errorf("CRS code should be a numeric value, received: %s", crs)
-			}
+		if !f.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesCRS) {
+			return nil, bboxCrs, fmt.Errorf("bbox-crs param is not supported by this API")
+		}
+		bboxCrs, err = parseCrsToEPSGCode(params.Get(bboxCrsParam))
+		if err != nil {
+			return nil, bboxCrs, err
 		}
 	}
 
@@ -234,19 +561,128 @@ func (f *Features) parseBbox(params neturl.Values) (*geom.Extent, int, error) {
 	return &extent, bboxCrs, nil
 }
 
-func (f *Features) parseDateTime(params neturl.Values) error {
-	if params.Get(dateTimeParam) != "" {
-		return fmt.Errorf("datetime param is currently not supported")
+// parseOutputOptions parses the query params that influence the shape of the returned
+// feature(s) but not which features are returned, so no effect on pagination.
+func (f *Features) parseOutputOptions(params neturl.Values) (datasources.OutputOptions, error) {
+	var options datasources.OutputOptions
+	var err error
+	if params.Get(crsParam) != "" {
+		if !f.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesCRS) {
+			return options, fmt.Errorf("crs param is not supported by this API")
+		}
+		options.Crs, err = parseCrsToEPSGCode(params.Get(crsParam))
+		if err != nil {
+			return options, err
+		}
+	}
+	if params.Get(propertiesParam) != "" {
+		if options.Properties, err = parseProperties(params.Get(propertiesParam)); err != nil {
+			return options, err
+		}
+	}
+	err = parseGeometryOptions(params, &options)
+	return options, err
+}
+
+// parseProperties parses the properties param, a comma separated list of the properties to return.
+// Unknown properties are ignored, like properties without a value these are absent in the response.
+func parseProperties(value string) ([]string, error) {
+	var properties []string
+	for _, property := range strings.Split(value, ",") {
+		property = strings.TrimSpace(property)
+		if property == "" {
+			return nil, fmt.Errorf("properties param should contain property names separated by commas, received: %s", value)
+		}
+		if !slices.Contains(properties, property) {
+			properties = append(properties, property)
+		}
+	}
+	return properties, nil
+}
+
+// parseGeometryOptions parses the (mutually exclusive) query params which replace or omit the geometry
+func parseGeometryOptions(params neturl.Values, options *datasources.OutputOptions) error {
+	var err error
+	if params.Get(skipGeometryParam) != "" {
+		options.SkipGeometry, err = strconv.ParseBool(params.Get(skipGeometryParam))
+		if err != nil {
+			return fmt.Errorf("skipGeometry must be a boolean (true or false)")
+		}
+	}
+	if params.Get(bboxOnlyParam) != "" {
+		options.BboxOnly, err = strconv.ParseBool(params.Get(bboxOnlyParam))
+		if err != nil {
+			return fmt.Errorf("bbox-only must be a boolean (true or false)")
+		}
+		if options.BboxOnly && options.SkipGeometry {
+			return fmt.Errorf("bbox-only can't be combined with skipGeometry")
+		}
+	}
+	if geometry := params.Get(geometryParam); geometry != "" {
+		if geometry != geometryCentroid {
+			return fmt.Errorf("geometry param only supports '%s'", geometryCentroid)
+		}
+		if options.SkipGeometry || options.BboxOnly {
+			return fmt.Errorf("geometry param can't be combined with skipGeometry or bbox-only")
+		}
+		options.Centroid = true
 	}
 	return nil
 }
 
-func (f *Features) parseFilter(params neturl.Values) error {
-	if params.Get(filterParam) != "" {
-		return fmt.Errorf("CQL filter param is currently not supported")
+// parseFilter parses the CQL2 filter (text encoding), which may only refer to the queryables of the
+// given collection and its geometry. Geometries in the filter are in CRS84, unless filter-crs is given.
+func (f *Features) parseFilter(collectionID string, params neturl.Values) (cql.Expression, int, error) {
+	filterCrs := wgs84SRID
+	if params.Get(filterParam) == "" {
+		return nil, filterCrs, nil
+	}
+	if !f.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesFilter) {
+		return nil, filterCrs, fmt.Errorf("filter param is not supported by this API")
 	}
+	if lang := params.Get(filterLangParam); lang != "" && lang != filterLangCQL2Text {
+		return nil, filterCrs, fmt.Errorf("filter-lang '%s' is not supported, only '%s' is supported", lang, filterLangCQL2Text)
+	}
+	var err error
 	if params.Get(filterCrsParam) != "" {
-		return fmt.Errorf("CQL filter-crs param is currently not supported")
+		if !f.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesCRS) {
+			return nil, filterCrs, fmt.Errorf("filter-crs param is not supported by this API")
+		}
+		if filterCrs, err = parseCrsToEPSGCode(params.Get(filterCrsParam)); err != nil {
+			return nil, filterCrs, err
+		}
 	}
-	return nil
+	filter, err := cql.Parse(params.Get(filterParam))
+	if err != nil {
+		return nil, filterCrs, err
+	}
+	for _, op := range cql.Operators(filter) {
+		class := engine.ConformanceClassSpatialFunctions
+		switch op {
+		case "like", "between", "in":
+			class = engine.ConformanceClassAdvancedComparisonOperators
+		case "s_intersects":
+			class = engine.ConformanceClassBasicSpatialFunctions
+		}
+		if !f.engine.Config.ConformanceClassEnabled(class) {
+			return nil, filterCrs, fmt.Errorf("%s isn't supported in filter by this API", strings.ToUpper(op))
+		}
+	}
+	for _, property := range cql.Properties(filter) {
+		if property != filterGeometryProperty && !slices.Contains(f.queryables[collectionID], property) {
+			return nil, filterCrs, fmt.Errorf("can't filter on property '%s', only on queryables %v and '%s'",
+				property, f.queryables[collectionID], filterGeometryProperty)
+		}
+	}
+	return filter, filterCrs, nil
+}
+
+// datasourceError translates an error of the datasource to an API error. Options the datasource doesn't support result
+// in a bad request, other errors in a generic message to the client to prevent possible information leakage.
+func datasourceError(detail string, err error) error {
+	var notSupported *datasources.NotSupportedError
+	if errors.As(err, &notSupported) {
+		return engine.BadRequest(notSupported.Message)
+	}
+	return engine.InternalError(detail, err)
 }
@@ -2,6 +2,9 @@ package features
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -11,10 +14,14 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/engine/util"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -108,6 +115,253 @@ func TestFeatures_CollectionContent(t *testing.T) {
 				statusCode: http.StatusBadRequest,
 			},
 		},
+		{
+			name: "Request GeoJSON for 'foo' collection filtered on property",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?straatnaam=Realengracht&limit=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "ogc/features/testdata/expected_foo_collection_filtered.json",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request with filter on property which isn't queryable",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?nummer_id=0363200000398886",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request features by date",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?datetime=2016-02-19",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request features by half-bounded interval",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?datetime=../2016-02-19T12:00:00Z",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request with datetime on collection without temporal properties",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?datetime=2016-02-19",
+				collectionID: "bar",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with crs which isn't supported by the collection",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?crs=http://www.opengis.net/def/crs/EPSG/0/3035",
+				collectionID: "bar",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with bbox-crs which isn't a CRS URI",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?bbox=120000,485000,121000,486000&bbox-crs=EPSG:28992",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with invalid datetime",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?datetime=19-02-2016",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with CQL2 filter on queryable",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=straatnaam%20LIKE%20%27Realen%25%27&limit=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request with CQL2 filter on property which isn't queryable",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=nummer_id%3D%270363200000398886%27",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with CQL2 filter using disabled advanced comparison operators",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features_basic_cql2.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=straatnaam%20LIKE%20%27Realen%25%27&limit=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with CQL2 filter using disabled spatial functions",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features_basic_cql2.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=S_WITHIN(geometry%2CPOINT(4.9%2052.3))&limit=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with basic CQL2 filter while advanced comparison operators are disabled",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features_basic_cql2.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=straatnaam%3D%27Realengracht%27&limit=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request with unsupported filter-lang",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=straatnaam%3D%27Realengracht%27&filter-lang=cql2-json",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with invalid CQL2 filter",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?filter=straatnaam%3D%3D",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with full-text search on collection without search",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?q=realengracht",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request nearest features",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?nearest=121100,488900&nearest-crs=http://www.opengis.net/def/crs/EPSG/0/28992&count=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "ogc/features/testdata/expected_foo_collection_nearest.json",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request nearest features combined with bbox",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?nearest=121100,488900&bbox=1,2,3,4",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with count but without nearest",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?count=2",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
 		{
 			name: "Request with invalid limit",
 			fields: fields{
@@ -134,6 +388,45 @@ func TestFeatures_CollectionContent(t *testing.T) {
 				statusCode: http.StatusBadRequest,
 			},
 		},
+		{
+			name: "Request GeoJSON for specific features by id in 'foo' collection",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?ids=4031,99999,4030",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "ogc/features/testdata/expected_foo_collection_by_ids.json",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request with invalid ids",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?ids=4030,foo",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with ids combined with bbox",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items?ids=4030&bbox=1,2,3,4",
+				collectionID: "foo",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
 		{
 			name: "Request HTML for 'foo' collection using limit of 1",
 			fields: fields{
@@ -159,6 +452,7 @@ func TestFeatures_CollectionContent(t *testing.T) {
 
 			newEngine := engine.NewEngine(tt.fields.configFile, "")
 			features := NewFeatures(newEngine, chi.NewRouter())
+			features.json.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
 			handler := features.CollectionContent()
 			handler.ServeHTTP(rr, req)
 
@@ -214,6 +508,48 @@ func TestFeatures_Feature(t *testing.T) {
 				statusCode: http.StatusOK,
 			},
 		},
+		{
+			name: "Request GeoJSON for feature 4030 without geometry",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items/:featureId?skipGeometry=true",
+				collectionID: "foo",
+				featureID:    "4030",
+				format:       "json",
+			},
+			want: want{
+				body:       "ogc/features/testdata/expected_feature_4030_without_geometry.json",
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "Request with invalid skipGeometry param",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items/:featureId?skipGeometry=maybe",
+				collectionID: "foo",
+				featureID:    "4030",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "Request with crs param while CRS conformance class is disabled",
+			fields: fields{
+				configFile:   "ogc/features/testdata/config_features_without_crs.yaml",
+				url:          "http://localhost:8080/collections/:collectionId/items/:featureId?crs=http://www.opengis.net/def/crs/EPSG/0/28992",
+				collectionID: "foo",
+				featureID:    "4030",
+				format:       "json",
+			},
+			want: want{
+				body:       "",
+				statusCode: http.StatusBadRequest,
+			},
+		},
 		{
 			name: "Request non existing feature",
 			fields: fields{
@@ -292,6 +628,272 @@ func TestFeatures_Feature(t *testing.T) {
 	}
 }
 
+func TestNewFeatures_MultipleInstances(t *testing.T) {
+	// each instance has its own config, queryables are only configured in the first config
+	withQueryables := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features.yaml", ""), chi.NewRouter())
+	withoutQueryables := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features_without_crs.yaml", ""), chi.NewRouter())
+	assert.NotSame(t, withQueryables.collections["foo"], withoutQueryables.collections["foo"])
+
+	tests := []struct {
+		name       string
+		features   *Features
+		statusCode int
+	}{
+		{
+			name:       "Filter on queryable of instance with queryables",
+			features:   withQueryables,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Filter on queryable of instance without queryables",
+			features:   withoutQueryables,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createRequest("http://localhost:8080/collections/foo/items?straatnaam=Silodam", "foo", "", "json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			tt.features.CollectionContent().ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestFeatures_CollectionContent_IdsCombinedWithOtherParams(t *testing.T) {
+	features := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features.yaml", ""), chi.NewRouter())
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{
+			name:       "Combine ids with params shaping the output",
+			url:        "http://localhost:8080/collections/foo/items?ids=4030&properties=straatnaam&skipGeometry=true",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Fail on ids combined with filter",
+			url:        "http://localhost:8080/collections/foo/items?ids=4030&filter=straatnaam%3D%27Silodam%27",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on ids combined with q",
+			url:        "http://localhost:8080/collections/foo/items?ids=4030&q=Silodam",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on ids combined with datetime",
+			url:        "http://localhost:8080/collections/foo/items?ids=4030&datetime=2020-01-01T00:00:00Z",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on ids combined with nearest",
+			url:        "http://localhost:8080/collections/foo/items?ids=4030&nearest=5,52",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on ids combined with limit",
+			url:        "http://localhost:8080/collections/foo/items?ids=4030&limit=10",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createRequest(tt.url, "foo", "", "json")
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusBadRequest {
+				assert.Contains(t, rr.Body.String(), "ids param can't be combined with params")
+			}
+		})
+	}
+}
+
+func TestFeatures_CollectionContent_GeometryOptions(t *testing.T) {
+	features := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features.yaml", ""), chi.NewRouter())
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{
+			name:       "Request bounding boxes instead of geometries",
+			url:        "http://localhost:8080/collections/foo/items?bbox-only=true&limit=2",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Fail on bounding boxes in another CRS than the one in which the features are stored",
+			url:        "http://localhost:8080/collections/foo/items?bbox-only=true&crs=http://www.opengis.net/def/crs/OGC/1.3/CRS84",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on bbox-only combined with skipGeometry",
+			url:        "http://localhost:8080/collections/foo/items?bbox-only=true&skipGeometry=true",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on unsupported geometry mode",
+			url:        "http://localhost:8080/collections/foo/items?geometry=simplified",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Fail on centroid combined with bbox-only",
+			url:        "http://localhost:8080/collections/foo/items?geometry=centroid&bbox-only=true",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createRequest(tt.url, "foo", "", "json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusOK {
+				var fc map[string]any
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &fc))
+				for _, feature := range fc["features"].([]any) {
+					geometry := feature.(map[string]any)["geometry"].(map[string]any)
+					assert.Equal(t, "Point", geometry["type"]) // bbox of a point is the point itself
+				}
+			}
+		})
+	}
+}
+
+func TestFeatures_PropertySelection(t *testing.T) {
+	features := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features.yaml", ""), chi.NewRouter())
+	tests := []struct {
+		name       string
+		url        string
+		featureID  string
+		statusCode int
+	}{
+		{
+			name:       "Select properties of features",
+			url:        "http://localhost:8080/collections/foo/items?properties=straatnaam,huisnummer,unknown&limit=2",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Select properties of a single feature",
+			url:        "http://localhost:8080/collections/foo/items/4030?properties=huisnummer,straatnaam",
+			featureID:  "4030",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Fail on empty property name",
+			url:        "http://localhost:8080/collections/foo/items?properties=straatnaam,,huisnummer",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createRequest(tt.url, "foo", tt.featureID, "json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			if tt.featureID != "" {
+				features.Feature().ServeHTTP(rr, req)
+			} else {
+				features.CollectionContent().ServeHTTP(rr, req)
+			}
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var result map[string]any
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			selected := []any{result}
+			if tt.featureID == "" {
+				selected = result["features"].([]any)
+				assert.Len(t, selected, 2)
+			}
+			for _, feature := range selected {
+				properties := feature.(map[string]any)["properties"].(map[string]any)
+				assert.ElementsMatch(t, []string{"straatnaam", "huisnummer"}, util.Keys(properties))
+				assert.NotNil(t, feature.(map[string]any)["geometry"])
+			}
+		})
+	}
+}
+
+func TestFeatures_Hits(t *testing.T) {
+	features := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features.yaml", ""), chi.NewRouter())
+	tests := []struct {
+		name              string
+		url               string
+		statusCode        int
+		wantNumberMatched float64
+	}{
+		{
+			name:              "Only number of matching features",
+			url:               "http://localhost:8080/collections/foo/items?limit=0",
+			statusCode:        http.StatusOK,
+			wantNumberMatched: 67,
+		},
+		{
+			name:              "Only number of matching features, filtered on property",
+			url:               "http://localhost:8080/collections/foo/items?limit=0&straatnaam=Realengracht",
+			statusCode:        http.StatusOK,
+			wantNumberMatched: 7,
+		},
+		{
+			name:       "Fail on negative limit",
+			url:        "http://localhost:8080/collections/foo/items?limit=-1",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createRequest(tt.url, "foo", "", "json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var result map[string]any
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.Equal(t, tt.wantNumberMatched, result["numberMatched"])
+			assert.Equal(t, float64(0), result["numberReturned"])
+			assert.Empty(t, result["features"])
+			assert.Len(t, result["bbox"], 4)
+			for _, link := range result["links"].([]any) {
+				assert.NotContains(t, []string{"next", "prev"}, link.(map[string]any)["rel"])
+			}
+		})
+	}
+}
+
+func TestFeatures_JSONFGFeatureFlag(t *testing.T) {
+	features := NewFeatures(engine.NewEngine("ogc/features/testdata/config_features.yaml", ""), chi.NewRouter())
+	request := func() int {
+		req, err := createRequest("http://localhost:8080/collections/foo/items?f=jsonfg", "foo", "", "jsonfg")
+		if err != nil {
+			log.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		features.CollectionContent().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, request())
+	t.Setenv("GOKOALA_FEATURE_JSONFG", "true")
+	assert.Equal(t, http.StatusOK, request())
+}
+
 func createMockServer() (*httptest.ResponseRecorder, *httptest.Server) {
 	rr := httptest.NewRecorder()
 	l, err := net.Listen("tcp", "localhost:9095")
@@ -327,3 +929,196 @@ func createRequest(url string, collectionID string, featureID string, format str
 func normalize(s string) string {
 	return strings.ToLower(strings.Join(strings.Fields(s), ""))
 }
+
+func TestFeatures_NumberMatched(t *testing.T) {
+	tests := []struct {
+		name              string
+		numberMatched     string
+		url               string
+		wantNumberMatched any
+	}{
+		{
+			name:              "Exact number of matching features",
+			numberMatched:     engine.NumberMatchedExact,
+			url:               "http://localhost:8080/collections/foo/items?limit=2&straatnaam=Realengracht",
+			wantNumberMatched: float64(7),
+		},
+		{
+			name:              "Estimated number of matching features",
+			numberMatched:     engine.NumberMatchedEstimated,
+			url:               "http://localhost:8080/collections/foo/items?limit=2",
+			wantNumberMatched: float64(67),
+		},
+		{
+			name:          "No estimate when filtered",
+			numberMatched: engine.NumberMatchedEstimated,
+			url:           "http://localhost:8080/collections/foo/items?limit=2&straatnaam=Realengracht",
+		},
+		{
+			name: "No number of matching features by default",
+			url:  "http://localhost:8080/collections/foo/items?limit=2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			eng.Config.OgcAPI.Features.NumberMatched = tt.numberMatched
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest(tt.url, "foo", "", "json")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var result map[string]any
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.Equal(t, tt.wantNumberMatched, result["numberMatched"])
+			assert.Equal(t, float64(2), result["numberReturned"])
+		})
+	}
+}
+
+func TestFeatures_OffsetPagination(t *testing.T) {
+	tests := []struct {
+		name             string
+		offsetPagination bool
+		url              string
+		format           string
+		wantStatusCode   int
+		wantLinks        []string
+		wantNoLinks      []string
+	}{
+		{
+			name:             "First page by offset",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&offset=0&straatnaam=Realengracht",
+			format:           "json",
+			wantStatusCode:   http.StatusOK,
+			wantLinks:        []string{"offset=2"},
+			wantNoLinks:      []string{"cursor="},
+		},
+		{
+			name:             "Page in between by offset",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&offset=3&straatnaam=Realengracht",
+			format:           "json",
+			wantStatusCode:   http.StatusOK,
+			wantLinks:        []string{"offset=1", "offset=5"},
+		},
+		{
+			name:             "Last page by startIndex",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&startIndex=5&straatnaam=Realengracht",
+			format:           "json",
+			wantStatusCode:   http.StatusOK,
+			wantLinks:        []string{"startIndex=3"},
+			wantNoLinks:      []string{"startIndex=7", "offset="},
+		},
+		{
+			name:             "Page by offset in HTML",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&offset=3&straatnaam=Realengracht",
+			format:           "html",
+			wantStatusCode:   http.StatusOK,
+			wantLinks:        []string{"offset=1", "offset=5"},
+		},
+		{
+			name:             "Cursor pagination remains available",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&straatnaam=Realengracht",
+			format:           "json",
+			wantStatusCode:   http.StatusOK,
+			wantLinks:        []string{"cursor="},
+			wantNoLinks:      []string{"offset="},
+		},
+		{
+			name:           "Offset on collection without offset pagination",
+			url:            "http://localhost:8080/collections/foo/items?limit=2&offset=2",
+			format:         "json",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:             "Offset combined with cursor",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&offset=2&cursor=Dv58Nwyr1Q%3D%3D",
+			format:           "json",
+			wantStatusCode:   http.StatusBadRequest,
+		},
+		{
+			name:             "Negative offset",
+			offsetPagination: true,
+			url:              "http://localhost:8080/collections/foo/items?limit=2&offset=-1",
+			format:           "json",
+			wantStatusCode:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			for _, collection := range eng.Config.OgcAPI.Features.Collections {
+				if collection.Features != nil {
+					collection.Features.OffsetPagination = tt.offsetPagination
+				}
+			}
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest(tt.url, "foo", "", tt.format)
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			features.CollectionContent().ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			for _, link := range tt.wantLinks {
+				assert.Contains(t, rr.Body.String(), link)
+			}
+			for _, link := range tt.wantNoLinks {
+				assert.NotContains(t, rr.Body.String(), link)
+			}
+		})
+	}
+}
+
+func TestDatasourceError(t *testing.T) {
+	notSupported := &datasources.NotSupportedError{Message: "reprojection requires spatialite, which isn't available"}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantDetail string
+	}{
+		{
+			name:       "unsupported options result in bad request",
+			err:        fmt.Errorf("failed to make features query, error: %w", notSupported),
+			wantStatus: http.StatusBadRequest,
+			wantDetail: notSupported.Message,
+		},
+		{
+			name:       "other errors result in generic message",
+			err:        errors.New("no such table: foo"),
+			wantStatus: http.StatusInternalServerError,
+			wantDetail: "failed to retrieve feature collection foo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr *engine.Error
+			require.ErrorAs(t, datasourceError("failed to retrieve feature collection foo", tt.err), &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.Status)
+			assert.Equal(t, tt.wantDetail, apiErr.Detail)
+		})
+	}
+}
+
+func TestSmokeQueries(t *testing.T) {
+	eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+	features := NewFeatures(eng, chi.NewRouter())
+
+	foo := engine.GeoSpatialCollections{{ID: "foo"}}
+	assert.NoError(t, smokeQueries(features.datasource, foo)(context.Background()))
+
+	// collection bar is configured, but absent in the geopackage
+	bar := engine.GeoSpatialCollections{{ID: "foo"}, {ID: "bar"}}
+	assert.ErrorContains(t, smokeQueries(features.datasource, bar)(context.Background()), "collection bar failed")
+}
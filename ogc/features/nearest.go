@@ -0,0 +1,59 @@
+package features
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-spatial/geom"
+)
+
+// nearest the k nearest features to a point, e.g. ?nearest=4.89,52.37&count=5
+type nearest struct {
+	point geom.Point
+	crs   int
+	count int
+}
+
+func (f *Features) parseNearest(params neturl.Values) (*nearest, error) {
+	if params.Get(nearestParam) == "" {
+		if params.Get(countParam) != "" || params.Get(nearestCrsParam) != "" {
+			return nil, fmt.Errorf("count and nearest-crs params require the nearest param")
+		}
+		return nil, nil //nolint:nilnil
+	}
+	if params.Get(bboxParam) != "" || params.Get(cursorParam) != "" || params.Has(searchParam) {
+		return nil, fmt.Errorf("nearest param can't be combined with bbox, cursor or q params")
+	}
+
+	result := nearest{crs: wgs84SRID, count: 1}
+	var err error
+	if params.Get(nearestCrsParam) != "" {
+		if !f.engine.Config.ConformanceClassEnabled(engine.ConformanceClassFeaturesCRS) {
+			return nil, fmt.Errorf("nearest-crs param is not supported by this API")
+		}
+		if result.crs, err = parseCrsToEPSGCode(params.Get(nearestCrsParam)); err != nil {
+			return nil, err
+		}
+	}
+	values := strings.Split(params.Get(nearestParam), ",")
+	if len(values) != 2 {
+		return nil, fmt.Errorf("nearest should contain exactly 2 values separated by a comma: x,y (e.g. lon,lat)")
+	}
+	for i, v := range values {
+		if result.point[i], err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+			return nil, fmt.Errorf("failed to parse value %s in nearest, error: %w", v, err)
+		}
+	}
+	if params.Get(countParam) != "" {
+		result.count, err = strconv.Atoi(params.Get(countParam))
+		if err != nil || result.count < 1 {
+			return nil, fmt.Errorf("count must be a positive number")
+		}
+		// same maximum as the page size, more features at once aren't allowed either
+		result.count = min(result.count, f.engine.Config.OgcAPI.Features.Limit.Max)
+	}
+	return &result, nil
+}
@@ -0,0 +1,58 @@
+package features
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strconv"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+// offsetPaginationCollections collections on which offset-based pagination is enabled alongside
+// cursor-based pagination, see OffsetPagination in config
+type offsetPaginationCollections map[string]bool
+
+func newOffsetPaginationCollections(collections engine.GeoSpatialCollections) offsetPaginationCollections {
+	result := make(offsetPaginationCollections)
+	for _, collection := range collections {
+		if collection.Features != nil && collection.Features.OffsetPagination {
+			result[collection.ID] = true
+		}
+	}
+	return result
+}
+
+// parseOffset returns the number of features to skip, e.g. ?offset=100 or ?startIndex=100 (as used by WFS).
+// Nil means no offset, in that case features are paged using cursors.
+func (o offsetPaginationCollections) parseOffset(collectionID string, params neturl.Values) (*int, error) {
+	param := offsetParamOf(params)
+	if param == "" {
+		return nil, nil //nolint:nilnil
+	}
+	if !o[collectionID] {
+		return nil, fmt.Errorf("offset-based pagination (%s param) isn't supported on collection '%s'", param, collectionID)
+	}
+	if params.Has(offsetParam) && params.Has(startIndexParam) {
+		return nil, fmt.Errorf("%s and %s params can't be combined", offsetParam, startIndexParam)
+	}
+	if params.Get(cursorParam) != "" || params.Get(nearestParam) != "" || params.Has(searchParam) {
+		return nil, fmt.Errorf("%s param can't be combined with cursor, nearest or q params", param)
+	}
+	offset, err := strconv.Atoi(params.Get(param))
+	if err != nil || offset < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number", param)
+	}
+	return &offset, nil
+}
+
+// offsetParamOf returns the name of the param holding the offset in the given params, empty when absent
+func offsetParamOf(params neturl.Values) string {
+	switch {
+	case params.Has(offsetParam):
+		return offsetParam
+	case params.Has(startIndexParam):
+		return startIndexParam
+	default:
+		return ""
+	}
+}
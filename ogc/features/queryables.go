@@ -0,0 +1,49 @@
+package features
+
+import (
+	"log"
+	neturl "net/url"
+	"slices"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+// standard query params of the items endpoint, these can't be used as queryables
+var reservedParams = []string{engine.FormatParam, engine.EmbedParam, cursorParam, limitParam, idsParam, crsParam,
+	skipGeometryParam, bboxOnlyParam, geometryParam, geometryEncodingParam, expandParam, dateTimeParam, bboxParam, bboxCrsParam, filterParam, filterCrsParam, filterLangParam, searchParam,
+	nearestParam, nearestCrsParam, countParam, offsetParam, startIndexParam}
+
+// queryablesByCollectionID properties on which features can be filtered using (simple) query params
+type queryablesByCollectionID map[string][]string
+
+func newQueryables(collections engine.GeoSpatialCollections) queryablesByCollectionID {
+	result := make(queryablesByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || len(collection.Features.Queryables) == 0 {
+			continue
+		}
+		for _, queryable := range collection.Features.Queryables {
+			if slices.Contains(reservedParams, queryable) {
+				log.Fatalf("queryable '%s' of collection '%s' conflicts with a standard query parameter",
+					queryable, collection.ID)
+			}
+		}
+		result[collection.ID] = collection.Features.Queryables
+	}
+	return result
+}
+
+// parsePropertyFilters returns the values to filter on per queryable property, e.g. ?status=active&year=2023.
+// Unknown properties aren't returned here, these are reported by validateNoUnknownParams.
+func (q queryablesByCollectionID) parsePropertyFilters(collectionID string, params neturl.Values) map[string][]string {
+	var result map[string][]string
+	for _, queryable := range q[collectionID] {
+		if values, ok := params[queryable]; ok {
+			if result == nil {
+				result = make(map[string][]string)
+			}
+			result[queryable] = values
+		}
+	}
+	return result
+}
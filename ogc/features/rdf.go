@@ -0,0 +1,336 @@
+package features
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom/encoding/wkt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	rdfType       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+	xsdNamespace  = "http://www.w3.org/2001/XMLSchema#"
+	wktLiteral    = "http://www.opengis.net/ont/geosparql#wktLiteral"
+	idPlaceholder = "{id}"
+)
+
+// rdfMapping R2RML-lite mapping of a collection, describes how features are converted to RDF triples.
+// For example:
+//
+//	prefixes:
+//	  locn: http://www.w3.org/ns/locn#
+//	subject: https://example.com/id/address/{id}
+//	class: locn:Address
+//	geometry: http://www.opengis.net/ont/geosparql#asWKT
+//	properties:
+//	  straatnaam:
+//	    predicate: locn:thoroughfare
+//	  woonplaats:
+//	    predicate: locn:postName
+//	  pand_id:
+//	    predicate: https://example.com/def/building
+//	    template: https://example.com/id/building/{value}
+type rdfMapping struct {
+	// Prefixes (namespaces) to shorten IRIs, usable in the mapping as well as in the Turtle output
+	Prefixes map[string]string `yaml:"prefixes"`
+
+	// IRI template of the subject, {id} and {<property name>} are replaced by the actual value
+	Subject string `yaml:"subject"`
+
+	// Class (rdf:type) of the subject, optional
+	Class string `yaml:"class"`
+
+	// Predicate for the geometry as GeoSPARQL WKT literal, optional. Geometry is omitted when empty
+	Geometry string `yaml:"geometry"`
+
+	// Mapping of feature properties to predicates, properties without mapping are omitted
+	Properties map[string]rdfPropertyMapping `yaml:"properties"`
+}
+
+type rdfPropertyMapping struct {
+	// Predicate of the triple
+	Predicate string `yaml:"predicate"`
+
+	// Optional IRI template, when set the object is an IRI instead of a literal. {value} is replaced by the actual value
+	Template string `yaml:"template"`
+
+	// Optional datatype of the literal, by default derived from the property value
+	Datatype string `yaml:"datatype"`
+}
+
+type rdfFeatures struct {
+	mappings map[string]*rdfMapping
+}
+
+func newRDFFeatures(e *engine.Engine) *rdfFeatures {
+	mappings := make(map[string]*rdfMapping)
+	for _, collection := range e.Config.OgcAPI.Features.Collections {
+		if collection.Features == nil || collection.Features.RDFMapping == nil {
+			continue
+		}
+		mapping, err := readRDFMapping(*collection.Features.RDFMapping)
+		if err != nil {
+			log.Fatalf("invalid RDF mapping for collection %s: %v", collection.ID, err)
+		}
+		mappings[collection.ID] = mapping
+	}
+	return &rdfFeatures{
+		mappings: mappings,
+	}
+}
+
+func readRDFMapping(file string) (*rdfMapping, error) {
+	mappingYAML, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	var mapping rdfMapping
+	if err = yaml.Unmarshal(mappingYAML, &mapping); err != nil {
+		return nil, err
+	}
+	if mapping.Subject == "" {
+		return nil, fmt.Errorf("subject is required in RDF mapping %s", file)
+	}
+	for property, propertyMapping := range mapping.Properties {
+		if propertyMapping.Predicate == "" {
+			return nil, fmt.Errorf("predicate is required for property %s in RDF mapping %s", property, file)
+		}
+	}
+	return &mapping, nil
+}
+
+func (rf *rdfFeatures) hasMapping(collectionID string) bool {
+	_, ok := rf.mappings[collectionID]
+	return ok
+}
+
+// features serves the given Features as RDF, either Turtle or N-Triples
+func (rf *rdfFeatures) features(w http.ResponseWriter, collectionID string, format string, features []*domain.Feature) {
+	mapping := rf.mappings[collectionID]
+
+	var triples []triple
+	for _, feature := range features {
+		featureTriples, err := mapping.toTriples(feature)
+		if err != nil {
+			log.Printf("failed to convert feature %s in collection %s to RDF: %v", feature.ID, collectionID, err)
+			http.Error(w, "Failed to convert features to RDF", http.StatusInternalServerError)
+			return
+		}
+		triples = append(triples, featureTriples...)
+	}
+
+	var result string
+	if format == engine.FormatTurtle {
+		w.Header().Set("Content-Type", engine.MediaTypeTurtle)
+		result = mapping.toTurtle(triples)
+	} else {
+		w.Header().Set("Content-Type", engine.MediaTypeNTriples)
+		result = toNTriples(triples)
+	}
+	engine.SafeWrite(w.Write, []byte(result))
+}
+
+// triple in RDF, the object is either an IRI or a literal (with datatype)
+type triple struct {
+	Subject   string
+	Predicate string
+	Object    string
+	Datatype  string
+	IsIRI     bool
+}
+
+func (m *rdfMapping) toTriples(feature *domain.Feature) ([]triple, error) {
+	subject := m.expand(m.fillTemplate(m.Subject, feature))
+	result := make([]triple, 0, len(m.Properties)+2)
+	if m.Class != "" {
+		result = append(result, triple{Subject: subject, Predicate: rdfType, Object: m.expand(m.Class), IsIRI: true})
+	}
+	if m.Geometry != "" && feature.Geometry.Geometry != nil {
+		geomAsWKT, err := wkt.EncodeString(feature.Geometry.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, triple{Subject: subject, Predicate: m.expand(m.Geometry), Object: geomAsWKT, Datatype: wktLiteral})
+	}
+
+	// sort for stable output
+	properties := make([]string, 0, len(m.Properties))
+	for property := range m.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		value, ok := feature.Properties[property]
+		if !ok || value == nil {
+			continue
+		}
+		propertyMapping := m.Properties[property]
+		t := triple{Subject: subject, Predicate: m.expand(propertyMapping.Predicate)}
+		if propertyMapping.Template != "" {
+			t.Object = m.expand(strings.ReplaceAll(propertyMapping.Template, "{value}", url.PathEscape(literalValue(value))))
+			t.IsIRI = true
+		} else {
+			t.Object = literalValue(value)
+			t.Datatype = literalDatatype(value)
+			if propertyMapping.Datatype != "" {
+				t.Datatype = m.expand(propertyMapping.Datatype)
+			}
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// fillTemplate replaces {id} and {<property name>} placeholders with the actual (IRI-safe) values
+func (m *rdfMapping) fillTemplate(template string, feature *domain.Feature) string {
+	result := strings.ReplaceAll(template, idPlaceholder, feature.ID.String())
+	for property, value := range feature.Properties {
+		placeholder := "{" + property + "}"
+		if value != nil && strings.Contains(result, placeholder) {
+			result = strings.ReplaceAll(result, placeholder, url.PathEscape(literalValue(value)))
+		}
+	}
+	return result
+}
+
+// expand prefixed names (e.g. locn:Address) to full IRIs
+func (m *rdfMapping) expand(iri string) string {
+	prefix, localName, found := strings.Cut(iri, ":")
+	if !found {
+		return iri
+	}
+	if namespace, ok := m.Prefixes[prefix]; ok {
+		return namespace + localName
+	}
+	return iri
+}
+
+// toTurtle serializes the triples as Turtle, grouped by subject and using the configured prefixes
+func (m *rdfMapping) toTurtle(triples []triple) string {
+	var sb strings.Builder
+	prefixes := make([]string, 0, len(m.Prefixes))
+	for prefix := range m.Prefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		sb.WriteString(fmt.Sprintf("@prefix %s: <%s> .\n", prefix, m.Prefixes[prefix]))
+	}
+	if len(prefixes) > 0 {
+		sb.WriteString("\n")
+	}
+
+	for i, t := range triples {
+		if i == 0 || triples[i-1].Subject != t.Subject {
+			sb.WriteString(m.toTurtleIRI(t.Subject))
+			sb.WriteString("\n")
+		}
+		predicate := m.toTurtleIRI(t.Predicate)
+		if t.Predicate == rdfType {
+			predicate = "a"
+		}
+		sb.WriteString(fmt.Sprintf("    %s %s", predicate, m.toTurtleObject(t)))
+		if i == len(triples)-1 || triples[i+1].Subject != t.Subject {
+			sb.WriteString(" .\n\n")
+		} else {
+			sb.WriteString(" ;\n")
+		}
+	}
+	return sb.String()
+}
+
+func (m *rdfMapping) toTurtleIRI(iri string) string {
+	result := "<" + iri + ">"
+	longestNamespace := 0
+	for prefix, namespace := range m.Prefixes {
+		localName, found := strings.CutPrefix(iri, namespace)
+		if found && isTurtleLocalName(localName) && len(namespace) > longestNamespace {
+			result = prefix + ":" + localName
+			longestNamespace = len(namespace)
+		}
+	}
+	return result
+}
+
+func (m *rdfMapping) toTurtleObject(t triple) string {
+	if t.IsIRI {
+		return m.toTurtleIRI(t.Object)
+	}
+	if t.Datatype == "" {
+		return quoteLiteral(t.Object)
+	}
+	return quoteLiteral(t.Object) + "^^" + m.toTurtleIRI(t.Datatype)
+}
+
+// toNTriples serializes the triples as N-Triples, one triple per line with full IRIs
+func toNTriples(triples []triple) string {
+	var sb strings.Builder
+	for _, t := range triples {
+		object := "<" + t.Object + ">"
+		if !t.IsIRI {
+			object = quoteLiteral(t.Object)
+			if t.Datatype != "" {
+				object += "^^<" + t.Datatype + ">"
+			}
+		}
+		sb.WriteString(fmt.Sprintf("<%s> <%s> %s .\n", t.Subject, t.Predicate, object))
+	}
+	return sb.String()
+}
+
+func literalValue(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case map[string]any:
+		// expanded relation, use the ID of the referenced feature
+		return fmt.Sprint(v["id"])
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func literalDatatype(value any) string {
+	switch value.(type) {
+	case int64:
+		return xsdNamespace + "integer"
+	case float64:
+		return xsdNamespace + "double"
+	case bool:
+		return xsdNamespace + "boolean"
+	case time.Time:
+		return xsdNamespace + "dateTime"
+	default:
+		return "" // plain string literal
+	}
+}
+
+// quoteLiteral quotes and escapes a literal, valid in both Turtle and N-Triples
+func quoteLiteral(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// isTurtleLocalName conservative check whether a string can be used as local name in a prefixed name
+func isTurtleLocalName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRDFMapping(t *testing.T) {
+	mapping := &rdfMapping{
+		Prefixes: map[string]string{
+			"locn": "http://www.w3.org/ns/locn#",
+			"geo":  "http://www.opengis.net/ont/geosparql#",
+		},
+		Subject:  "https://example.com/id/address/{id}",
+		Class:    "locn:Address",
+		Geometry: "geo:asWKT",
+		Properties: map[string]rdfPropertyMapping{
+			"straatnaam": {Predicate: "locn:thoroughfare"},
+			"huisnummer": {Predicate: "https://example.com/def/huisnummer"},
+			"pand_id":    {Predicate: "https://example.com/def/pand", Template: "https://example.com/id/pand/{value}"},
+		},
+	}
+	feature := &domain.Feature{
+		ID: domain.NewFeatureID(4030),
+		Feature: geojson.Feature{
+			Geometry: geojson.Geometry{Geometry: geom.Point{121100.455, 488900.976}},
+			Properties: map[string]any{
+				"straatnaam": "Bickers\"gracht",
+				"huisnummer": int64(285),
+				"pand_id":    "0363 100",
+				"unmapped":   "foo",
+			},
+		},
+	}
+
+	triples, err := mapping.toTriples(feature)
+	assert.NoError(t, err)
+
+	expectedTurtle := `@prefix geo: <http://www.opengis.net/ont/geosparql#> .
+@prefix locn: <http://www.w3.org/ns/locn#> .
+
+<https://example.com/id/address/4030>
+    a locn:Address ;
+    geo:asWKT "POINT (121100.455 488900.976)"^^geo:wktLiteral ;
+    <https://example.com/def/huisnummer> "285"^^<http://www.w3.org/2001/XMLSchema#integer> ;
+    <https://example.com/def/pand> <https://example.com/id/pand/0363%20100> ;
+    locn:thoroughfare "Bickers\"gracht" .
+
+`
+	assert.Equal(t, expectedTurtle, mapping.toTurtle(triples))
+
+	expectedNTriples := `<https://example.com/id/address/4030> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://www.w3.org/ns/locn#Address> .
+<https://example.com/id/address/4030> <http://www.opengis.net/ont/geosparql#asWKT> "POINT (121100.455 488900.976)"^^<http://www.opengis.net/ont/geosparql#wktLiteral> .
+<https://example.com/id/address/4030> <https://example.com/def/huisnummer> "285"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<https://example.com/id/address/4030> <https://example.com/def/pand> <https://example.com/id/pand/0363%20100> .
+<https://example.com/id/address/4030> <http://www.w3.org/ns/locn#thoroughfare> "Bickers\"gracht" .
+`
+	assert.Equal(t, expectedNTriples, toNTriples(triples))
+}
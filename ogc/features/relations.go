@@ -0,0 +1,106 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"slices"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+// relationsByCollectionID configured relations (references to features in other collections) per collection
+type relationsByCollectionID map[string][]engine.FeatureRelation
+
+func newRelations(collections engine.GeoSpatialCollections) relationsByCollectionID {
+	result := make(relationsByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || len(collection.Features.Relations) == 0 {
+			continue
+		}
+		for _, relation := range collection.Features.Relations {
+			if !slices.ContainsFunc(collections, func(c engine.GeoSpatialCollection) bool {
+				return c.ID == relation.Collection
+			}) {
+				log.Fatalf("relation '%s' of collection '%s' references collection '%s' which doesn't exist",
+					relation.Property, collection.ID, relation.Collection)
+			}
+		}
+		result[collection.ID] = collection.Features.Relations
+	}
+	return result
+}
+
+// parseExpand returns the relations to expand, as requested by the client using the expand param
+// (comma separated list of property names). Only configured relations can be expanded, and when
+// the client selects properties (properties param) only relations which are part of the selection.
+func (r relationsByCollectionID) parseExpand(collectionID string, params neturl.Values) ([]engine.FeatureRelation, error) {
+	if params.Get(expandParam) == "" {
+		return nil, nil
+	}
+	var selected []string
+	if params.Get(propertiesParam) != "" {
+		selected, _ = parseProperties(params.Get(propertiesParam)) // an invalid param is reported by parseOutputOptions
+	}
+	var result []engine.FeatureRelation
+	for _, property := range strings.Split(params.Get(expandParam), ",") {
+		i := slices.IndexFunc(r[collectionID], func(relation engine.FeatureRelation) bool {
+			return relation.Property == property
+		})
+		if i == -1 {
+			return nil, fmt.Errorf("property '%s' can't be expanded, it's not a relation to another collection", property)
+		}
+		if len(selected) > 0 && !slices.Contains(selected, property) {
+			return nil, fmt.Errorf("property '%s' can't be expanded, it's not selected by the %s param", property, propertiesParam)
+		}
+		result = append(result, r[collectionID][i])
+	}
+	return result, nil
+}
+
+// expandRelations embeds the key properties of referenced features inline, replacing the ID in the
+// property holding the reference. Uses one query per relation regardless of the number of features.
+func expandRelations(ctx context.Context, datasource datasources.Datasource, fidTypes fidTypesByCollectionID,
+	relations []engine.FeatureRelation, features []*domain.Feature) error {
+
+	for _, relation := range relations {
+		var referencedIDs []domain.FeatureID
+		for _, feature := range features {
+			if id, ok := fidTypes.toFeatureID(relation.Collection, feature.Properties[relation.Property]); ok && !slices.Contains(referencedIDs, id) {
+				referencedIDs = append(referencedIDs, id)
+			}
+		}
+		if len(referencedIDs) == 0 {
+			continue
+		}
+
+		referenced, err := datasource.GetFeaturesByID(ctx, relation.Collection, referencedIDs, datasources.OutputOptions{
+			Properties:   relation.KeyProperties,
+			SkipGeometry: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to expand relation '%s' to collection '%s': %w",
+				relation.Property, relation.Collection, err)
+		}
+		embeddable := make(map[domain.FeatureID]map[string]any, len(referenced.Features))
+		for _, feature := range referenced.Features {
+			embedded := map[string]any{"id": feature.ID}
+			for k, v := range feature.Properties {
+				embedded[k] = v
+			}
+			embeddable[feature.ID] = embedded
+		}
+		for _, feature := range features {
+			if id, ok := fidTypes.toFeatureID(relation.Collection, feature.Properties[relation.Property]); ok {
+				if embedded, found := embeddable[id]; found {
+					feature.Properties[relation.Property] = embedded
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package features
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relationsDatasource datasource stub, only supports retrieving features by id
+type relationsDatasource struct {
+	datasources.Datasource
+	features map[domain.FeatureID]*domain.Feature
+
+	// requests received, to assert the number of queries
+	requestedIDs     [][]domain.FeatureID
+	requestedOptions []datasources.OutputOptions
+}
+
+func (ds *relationsDatasource) GetFeaturesByID(_ context.Context, _ string, featureIDs []domain.FeatureID, options datasources.OutputOptions) (*domain.FeatureCollection, error) {
+	ds.requestedIDs = append(ds.requestedIDs, featureIDs)
+	ds.requestedOptions = append(ds.requestedOptions, options)
+	result := &domain.FeatureCollection{Features: make([]*domain.Feature, 0)}
+	for _, id := range featureIDs {
+		if feature, ok := ds.features[id]; ok {
+			result.Features = append(result.Features, feature)
+		}
+	}
+	result.NumberReturned = len(result.Features)
+	return result, nil
+}
+
+func TestRelations_ParseExpand(t *testing.T) {
+	relations := relationsByCollectionID{
+		"addresses": {
+			{Property: "building_id", Collection: "buildings", KeyProperties: []string{"name"}},
+			{Property: "street_id", Collection: "streets"},
+		},
+	}
+	tests := []struct {
+		name         string
+		collectionID string
+		query        string
+		want         []engine.FeatureRelation
+		wantErr      bool
+	}{
+		{
+			name:         "no expand param",
+			collectionID: "addresses",
+			query:        "",
+			want:         nil,
+		},
+		{
+			name:         "expand single relation",
+			collectionID: "addresses",
+			query:        "expand=street_id",
+			want:         []engine.FeatureRelation{{Property: "street_id", Collection: "streets"}},
+		},
+		{
+			name:         "expand multiple relations",
+			collectionID: "addresses",
+			query:        "expand=street_id,building_id",
+			want: []engine.FeatureRelation{
+				{Property: "street_id", Collection: "streets"},
+				{Property: "building_id", Collection: "buildings", KeyProperties: []string{"name"}},
+			},
+		},
+		{
+			name:         "fail on property which isn't a relation",
+			collectionID: "addresses",
+			query:        "expand=postcode",
+			wantErr:      true,
+		},
+		{
+			name:         "expand selected relation",
+			collectionID: "addresses",
+			query:        "expand=street_id&properties=postcode,street_id",
+			want:         []engine.FeatureRelation{{Property: "street_id", Collection: "streets"}},
+		},
+		{
+			name:         "fail on relation which isn't selected",
+			collectionID: "addresses",
+			query:        "expand=street_id&properties=postcode",
+			wantErr:      true,
+		},
+		{
+			name:         "fail on collection without relations",
+			collectionID: "buildings",
+			query:        "expand=street_id",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := relations.parseExpand(tt.collectionID, params)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpandRelations(t *testing.T) {
+	datasource := &relationsDatasource{features: map[domain.FeatureID]*domain.Feature{
+		domain.NewFeatureID(10): {ID: domain.NewFeatureID(10), Feature: geojson.Feature{Properties: map[string]any{"name": "town hall"}}},
+	}}
+	relations := []engine.FeatureRelation{{Property: "building_id", Collection: "buildings", KeyProperties: []string{"name"}}}
+	newAddress := func(id int64, buildingID any) *domain.Feature {
+		return &domain.Feature{ID: domain.NewFeatureID(id), Feature: geojson.Feature{Properties: map[string]any{"building_id": buildingID}}}
+	}
+	features := []*domain.Feature{
+		newAddress(1, int64(10)),
+		newAddress(2, int64(10)),
+		newAddress(3, int64(11)), // building doesn't exist
+		newAddress(4, nil),       // no building
+	}
+
+	err := expandRelations(context.Background(), datasource, fidTypesByCollectionID{}, relations, features)
+	require.NoError(t, err)
+
+	// one query for all referenced features, only requesting the key properties
+	assert.Equal(t, [][]domain.FeatureID{{domain.NewFeatureID(10), domain.NewFeatureID(11)}}, datasource.requestedIDs)
+	assert.Equal(t, []datasources.OutputOptions{{Properties: []string{"name"}, SkipGeometry: true}}, datasource.requestedOptions)
+
+	townHall := map[string]any{"id": domain.NewFeatureID(10), "name": "town hall"}
+	assert.Equal(t, townHall, features[0].Properties["building_id"])
+	assert.Equal(t, townHall, features[1].Properties["building_id"])
+	assert.Equal(t, int64(11), features[2].Properties["building_id"])
+	assert.Nil(t, features[3].Properties["building_id"])
+}
@@ -0,0 +1,136 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	jsonSchemaDialect     = "https://json-schema.org/draft/2020-12/schema"
+	mediaTypeJSONSchema   = "application/schema+json"
+	schemaGeometryFormat  = "geometry-any"
+	schemaRolePrimaryGeom = "primary-geometry"
+)
+
+// propertiesByCollectionID configured metadata (description, unit, etc.) per property per collection
+type propertiesByCollectionID map[string]map[string]engine.FeatureProperty
+
+func newProperties(collections engine.GeoSpatialCollections) propertiesByCollectionID {
+	result := make(propertiesByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || len(collection.Features.Properties) == 0 {
+			continue
+		}
+		properties := make(map[string]engine.FeatureProperty, len(collection.Features.Properties))
+		for _, property := range collection.Features.Properties {
+			properties[property.Property] = property
+		}
+		result[collection.ID] = properties
+	}
+	return result
+}
+
+// jsonSchema describes the features of a collection, see OGC API Features - Part 5: Schemas
+// (https://docs.ogc.org/DRAFTS/23-058r1.html) and Part 3: Filtering (queryables)
+type jsonSchema struct {
+	Schema               string                        `json:"$schema"`
+	ID                   string                        `json:"$id"`
+	Type                 string                        `json:"type"`
+	Title                string                        `json:"title,omitempty"`
+	Description          string                        `json:"description,omitempty"`
+	Properties           map[string]jsonSchemaProperty `json:"properties"`
+	AdditionalProperties bool                          `json:"additionalProperties"`
+}
+
+type jsonSchemaProperty struct {
+	Type        string `json:"type,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"x-ogc-unit,omitempty"`
+	Role        string `json:"x-ogc-role,omitempty"`
+	Examples    []any  `json:"examples,omitempty"`
+}
+
+// Schema serves the schema (all properties) of the features in the given collection
+func (f *Features) Schema() http.HandlerFunc {
+	return f.serveSchema("schema", func(string, string) bool {
+		return true
+	})
+}
+
+// Queryables serves the properties on which features in the given collection can be filtered
+func (f *Features) Queryables() http.HandlerFunc {
+	return f.serveSchema("queryables", func(collectionID string, property string) bool {
+		return property == filterGeometryProperty || slices.Contains(f.queryables[collectionID], property)
+	})
+}
+
+func (f *Features) serveSchema(path string, include func(collectionID string, property string) bool) http.HandlerFunc {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		collectionID := chi.URLParam(r, "collectionId")
+		if _, ok := f.collections[collectionID]; !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist in this features service", collectionID))
+		}
+		properties, err := f.datasource.GetProperties(collectionID)
+		if err != nil {
+			return engine.InternalError(fmt.Sprintf("failed to retrieve %s of collection %s", path, collectionID), err)
+		}
+
+		result := jsonSchema{
+			Schema:     jsonSchemaDialect,
+			ID:         fmt.Sprintf("%s/collections/%s/%s", f.engine.Config.BaseURL.String(), collectionID, path),
+			Type:       "object",
+			Properties: make(map[string]jsonSchemaProperty),
+		}
+		if metadata := f.collections[collectionID]; metadata != nil {
+			if metadata.Title != nil {
+				result.Title = *metadata.Title
+			}
+			if metadata.Description != nil {
+				result.Description = *metadata.Description
+			}
+		}
+		if include(collectionID, filterGeometryProperty) {
+			result.Properties[filterGeometryProperty] = jsonSchemaProperty{Format: schemaGeometryFormat, Role: schemaRolePrimaryGeom}
+		}
+		for _, property := range properties {
+			if include(collectionID, property.Name) {
+				result.Properties[property.Name] = f.toSchemaProperty(collectionID, property)
+			}
+		}
+
+		resultJSON, err := toJSON(result)
+		if err != nil {
+			return engine.InternalError(fmt.Sprintf("failed to marshal %s to JSON", path), err)
+		}
+		w.Header().Set("Content-Type", mediaTypeJSONSchema)
+		engine.SafeWrite(w.Write, resultJSON)
+		return nil
+	})
+}
+
+// toSchemaProperty maps the type of the property to JSON Schema, enriched with the configured metadata
+func (f *Features) toSchemaProperty(collectionID string, property domain.Property) jsonSchemaProperty {
+	var result jsonSchemaProperty
+	switch property.Type {
+	case domain.PropertyTypeDate:
+		result.Type, result.Format = "string", "date"
+	case domain.PropertyTypeDateTime:
+		result.Type, result.Format = "string", "date-time"
+	default:
+		result.Type = string(property.Type) // boolean, integer, number and string are JSON Schema types as well
+	}
+	if metadata, ok := f.properties[collectionID][property.Name]; ok {
+		result.Description = metadata.Description
+		result.Unit = metadata.Unit
+		if metadata.Example != nil {
+			result.Examples = []any{metadata.Example}
+		}
+	}
+	return result
+}
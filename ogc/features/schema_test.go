@@ -0,0 +1,116 @@
+package features
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatures_Schema(t *testing.T) {
+	tests := []struct {
+		name           string
+		queryables     bool
+		collectionID   string
+		wantStatusCode int
+		wantProperties map[string]any
+	}{
+		{
+			name:           "Schema of all properties",
+			collectionID:   "foo",
+			wantStatusCode: http.StatusOK,
+			wantProperties: map[string]any{
+				"geometry":   map[string]any{"format": "geometry-any", "x-ogc-role": "primary-geometry"},
+				"straatnaam": map[string]any{"type": "string", "description": "Name of the street"},
+				"huisnummer": map[string]any{"type": "integer", "description": "House number", "x-ogc-unit": "1", "examples": []any{float64(9)}},
+				"postcode":   map[string]any{"type": "string"},
+			},
+		},
+		{
+			name:           "Queryables",
+			queryables:     true,
+			collectionID:   "foo",
+			wantStatusCode: http.StatusOK,
+			wantProperties: map[string]any{
+				"geometry":   map[string]any{"format": "geometry-any", "x-ogc-role": "primary-geometry"},
+				"straatnaam": map[string]any{"type": "string", "description": "Name of the street"},
+			},
+		},
+		{
+			name:           "Schema of non existing collection",
+			collectionID:   "vakantieparken",
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+			for _, collection := range eng.Config.OgcAPI.Features.Collections {
+				if collection.ID == "foo" {
+					collection.Features.Properties = []engine.FeatureProperty{
+						{Property: "straatnaam", Description: "Name of the street"},
+						{Property: "huisnummer", Description: "House number", Unit: "1", Example: 9},
+					}
+				}
+			}
+			features := NewFeatures(eng, chi.NewRouter())
+			req, err := createRequest("http://localhost:8080/collections/:collectionId/schema", tt.collectionID, "", "")
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			if tt.queryables {
+				features.Queryables().ServeHTTP(rr, req)
+			} else {
+				features.Schema().ServeHTTP(rr, req)
+			}
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantProperties == nil {
+				return
+			}
+			assert.Equal(t, "application/schema+json", rr.Header().Get("Content-Type"))
+
+			var result map[string]any
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.Equal(t, "Foooo", result["title"])
+			properties := result["properties"].(map[string]any)
+			for name, want := range tt.wantProperties {
+				assert.Equal(t, want, properties[name], name)
+			}
+			if tt.queryables {
+				assert.Len(t, properties, len(tt.wantProperties))
+			} else {
+				assert.NotContains(t, properties, "feature_id")
+				assert.NotContains(t, properties, "minx")
+			}
+		})
+	}
+}
+
+func TestFeatures_PropertyMetadataInHTML(t *testing.T) {
+	eng := engine.NewEngine("ogc/features/testdata/config_features.yaml", "")
+	for _, collection := range eng.Config.OgcAPI.Features.Collections {
+		if collection.ID == "foo" {
+			collection.Features.Properties = []engine.FeatureProperty{
+				{Property: "straatnaam", Description: "Name of the street"},
+				{Property: "huisnummer", Unit: "1"},
+			}
+		}
+	}
+	features := NewFeatures(eng, chi.NewRouter())
+	req, err := createRequest("http://localhost:8080/collections/:collectionId/items?limit=1", "foo", "", "html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	features.CollectionContent().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `<td class="w-25" title="Name of the street">straatnaam</td>`)
+	assert.Contains(t, rr.Body.String(), `<td class="w-25">huisnummer (1)</td>`)
+	assert.Contains(t, rr.Body.String(), `<td class="w-25">postcode</td>`)
+}
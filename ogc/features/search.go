@@ -0,0 +1,34 @@
+package features
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+// searchableCollections collections on which full-text search is enabled
+type searchableCollections map[string]*engine.FeatureSearch
+
+func newSearchableCollections(collections engine.GeoSpatialCollections) searchableCollections {
+	result := make(searchableCollections)
+	for _, collection := range collections {
+		if collection.Features != nil && collection.Features.Search != nil {
+			result[collection.ID] = collection.Features.Search
+		}
+	}
+	return result
+}
+
+// parseSearch returns the full-text search terms, e.g. ?q=damrak amsterdam. An empty
+// string means no search, in that case features are returned in the regular order.
+func (s searchableCollections) parseSearch(collectionID string, params neturl.Values) (string, error) {
+	if !params.Has(searchParam) {
+		return "", nil
+	}
+	if s[collectionID] == nil {
+		return "", fmt.Errorf("full-text search (%s param) isn't supported on collection '%s'", searchParam, collectionID)
+	}
+	return strings.TrimSpace(params.Get(searchParam)), nil
+}
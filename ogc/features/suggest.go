@@ -0,0 +1,133 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-spatial/geom"
+)
+
+const (
+	suggestLimitDefault = 10
+	suggestLimitMax     = 50
+)
+
+// suggestions lightweight search results for autocomplete (type-ahead) UIs
+type suggestions struct {
+	Suggestions []suggestion `json:"suggestions"`
+}
+
+type suggestion struct {
+	ID          domain.FeatureID `json:"id"`
+	DisplayName string           `json:"displayName"`
+	Centroid    []float64        `json:"centroid,omitempty"`
+}
+
+// Suggest serves autocomplete suggestions for the given (incomplete) search terms, e.g. ?q=damrak 1 amst
+func (f *Features) Suggest() http.HandlerFunc {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		collectionID := chi.URLParam(r, "collectionId")
+		search, ok := f.searchable[collectionID]
+		if !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist or doesn't support search", collectionID))
+		}
+		params := r.URL.Query()
+		if err := validateNoUnknownSuggestParams(params); err != nil {
+			return engine.BadRequest(err.Error())
+		}
+		searchTerms := strings.TrimSpace(params.Get(searchParam))
+		if searchTerms == "" {
+			return engine.BadRequest(fmt.Sprintf("%s param is required", searchParam))
+		}
+		limit, err := parseSuggestLimit(params)
+		if err != nil {
+			return engine.BadRequest(err.Error())
+		}
+		outputOptions, err := f.parseOutputOptions(params)
+		if err != nil {
+			return engine.BadRequest(err.Error())
+		}
+
+		displayFields := search.GetDisplayFields()
+		fc, _, err := f.datasource.GetFeatures(r.Context(), collectionID, datasources.FeatureOptions{
+			Limit:        limit,
+			Search:       searchTerms,
+			SearchPrefix: true,
+			OutputOptions: datasources.OutputOptions{
+				Crs:        outputOptions.Crs,
+				Properties: displayFields, // only retrieve what's needed
+			},
+		})
+		if err != nil {
+			// generic message to client to prevent possible information leakage from datasource
+			return engine.InternalError(fmt.Sprintf("failed to retrieve suggestions for collection %s", collectionID), err)
+		}
+
+		result := suggestions{Suggestions: make([]suggestion, 0, limit)}
+		if fc != nil {
+			for _, feat := range fc.Features {
+				result.Suggestions = append(result.Suggestions, toSuggestion(feat, displayFields))
+			}
+		}
+		resultJSON, err := toJSON(result)
+		if err != nil {
+			return engine.InternalError("failed to marshal suggestions to JSON", err)
+		}
+		w.Header().Set("Content-Type", engine.MediaTypeJSON)
+		engine.SafeWrite(w.Write, resultJSON)
+		return nil
+	})
+}
+
+// toSuggestion composes the display name from the given properties and uses the center of
+// the bounding box of the geometry as centroid (exact for points, approximation otherwise)
+func toSuggestion(feat *domain.Feature, displayFields []string) suggestion {
+	names := make([]string, 0, len(displayFields))
+	for _, field := range displayFields {
+		if value, ok := feat.Properties[field]; ok && value != nil && fmt.Sprint(value) != "" {
+			names = append(names, fmt.Sprint(value))
+		}
+	}
+	result := suggestion{ID: feat.ID, DisplayName: strings.Join(names, " ")}
+	if feat.Geometry.Geometry != nil {
+		if extent, err := geom.NewExtentFromGeometry(feat.Geometry.Geometry); err == nil && extent != nil {
+			result.Centroid = []float64{(extent.MinX() + extent.MaxX()) / 2, (extent.MinY() + extent.MaxY()) / 2}
+		}
+	}
+	return result
+}
+
+// parseSuggestLimit type-ahead UIs only show a handful of suggestions, so the limit
+// is lower than the limit of the items endpoint
+func parseSuggestLimit(params neturl.Values) (int, error) {
+	if params.Get(limitParam) == "" {
+		return suggestLimitDefault, nil
+	}
+	limit, err := strconv.Atoi(params.Get(limitParam))
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("limit must be a positive number")
+	}
+	if limit > suggestLimitMax {
+		limit = suggestLimitMax
+	}
+	return limit, nil
+}
+
+func validateNoUnknownSuggestParams(params neturl.Values) error {
+	copyParams := clone(params)
+	copyParams.Del(engine.FormatParam)
+	copyParams.Del(searchParam)
+	copyParams.Del(limitParam)
+	copyParams.Del(crsParam)
+	if len(copyParams) > 0 {
+		return fmt.Errorf("unknown query parameter(s) found: %v", copyParams.Encode())
+	}
+	return nil
+}
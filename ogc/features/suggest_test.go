@@ -0,0 +1,84 @@
+package features
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSuggestion(t *testing.T) {
+	tests := []struct {
+		name          string
+		feature       *domain.Feature
+		displayFields []string
+		want          suggestion
+	}{
+		{
+			name: "point",
+			feature: &domain.Feature{ID: domain.NewFeatureID(3837), Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.Point{121108.424, 488930.925}},
+				Properties: map[string]any{"straatnaam": "Realengracht", "huisnummer": int64(9), "postcode": "1013KW"},
+			}},
+			displayFields: []string{"straatnaam", "huisnummer", "postcode"},
+			want:          suggestion{ID: domain.NewFeatureID(3837), DisplayName: "Realengracht 9 1013KW", Centroid: []float64{121108.424, 488930.925}},
+		},
+		{
+			name: "polygon and missing properties",
+			feature: &domain.Feature{ID: domain.NewFeatureID(1), Feature: geojson.Feature{
+				Geometry:   geojson.Geometry{Geometry: geom.Polygon{{{0, 0}, {10, 0}, {10, 20}, {0, 20}}}},
+				Properties: map[string]any{"name": "Dam", "suffix": nil, "empty": ""},
+			}},
+			displayFields: []string{"name", "suffix", "empty", "unknown"},
+			want:          suggestion{ID: domain.NewFeatureID(1), DisplayName: "Dam", Centroid: []float64{5, 10}},
+		},
+		{
+			name: "without geometry",
+			feature: &domain.Feature{ID: domain.NewFeatureID(2), Feature: geojson.Feature{
+				Properties: map[string]any{"name": "Dam"},
+			}},
+			displayFields: []string{"name"},
+			want:          suggestion{ID: domain.NewFeatureID(2), DisplayName: "Dam"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, toSuggestion(tt.feature, tt.displayFields))
+		})
+	}
+}
+
+func TestParseSuggestLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{query: "", want: suggestLimitDefault},
+		{query: "limit=5", want: 5},
+		{query: "limit=1000", want: suggestLimitMax},
+		{query: "limit=0", wantErr: true},
+		{query: "limit=five", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			got, err := parseSuggestLimit(params)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateNoUnknownSuggestParams(t *testing.T) {
+	assert.NoError(t, validateNoUnknownSuggestParams(url.Values{"q": {"dam"}, "limit": {"5"}, "f": {"json"}}))
+	assert.Error(t, validateNoUnknownSuggestParams(url.Values{"q": {"dam"}, "bbox": {"1,2,3,4"}}))
+}
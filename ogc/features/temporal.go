@@ -0,0 +1,99 @@
+package features
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+)
+
+const (
+	// open start or end of an interval in the datetime param, e.g. ../2023-05-08T00:00:00Z
+	openIntervalBound = ".."
+
+	dateLayout = "2006-01-02"
+)
+
+// temporalByCollectionID temporal properties per collection, see Temporal in config.
+// Collections without temporal properties are absent, these can't be filtered by time.
+type temporalByCollectionID map[string]*engine.FeatureTemporalProperties
+
+func newTemporal(collections engine.GeoSpatialCollections) temporalByCollectionID {
+	result := make(temporalByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || collection.Features.Temporal == nil {
+			continue
+		}
+		result[collection.ID] = collection.Features.Temporal
+	}
+	return result
+}
+
+// parseDateTime parses the datetime param: an instant (2023-05-08T12:00:00Z or a date like 2023-05-08) or an
+// interval with an optionally open start or end (2023-05-08/.., ../2023-05-08T12:00:00Z). A date covers the whole day.
+func (t temporalByCollectionID) parseDateTime(collectionID string, params neturl.Values) (*datasources.TemporalFilter, error) {
+	dateTime := params.Get(dateTimeParam)
+	if dateTime == "" {
+		return nil, nil //nolint:nilnil
+	}
+	temporal, ok := t[collectionID]
+	if !ok {
+		return nil, fmt.Errorf("datetime param isn't supported on collection %s, it has no temporal properties", collectionID)
+	}
+
+	var start, end string
+	var err error
+	if startValue, endValue, isInterval := strings.Cut(dateTime, "/"); isInterval {
+		if isOpenIntervalBound(startValue) && isOpenIntervalBound(endValue) {
+			return nil, fmt.Errorf("datetime interval can't be open at both ends")
+		}
+		if start, _, err = parseInstant(startValue); err != nil {
+			return nil, err
+		}
+		if _, end, err = parseInstant(endValue); err != nil {
+			return nil, err
+		}
+		if start != "" && end != "" && start > end {
+			return nil, fmt.Errorf("datetime interval must start before it ends")
+		}
+	} else {
+		if isOpenIntervalBound(dateTime) {
+			return nil, fmt.Errorf("datetime must be an instant or an interval")
+		}
+		if start, end, err = parseInstant(dateTime); err != nil {
+			return nil, err
+		}
+	}
+	return &datasources.TemporalFilter{
+		Start:         start,
+		End:           end,
+		StartProperty: temporal.StartDate,
+		EndProperty:   temporal.EndDate,
+	}, nil
+}
+
+// parseInstant returns the first and last moment (RFC 3339, in UTC) of the given date or timestamp,
+// both are empty for an open interval bound
+func parseInstant(value string) (string, string, error) {
+	if isOpenIntervalBound(value) {
+		return "", "", nil
+	}
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		endOfDay := date.AddDate(0, 0, 1).Add(-time.Second)
+		return date.Format(time.RFC3339), endOfDay.Format(time.RFC3339), nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", "", fmt.Errorf("datetime '%s' must be a date (e.g. 2023-05-08) or an RFC 3339 "+
+			"timestamp (e.g. 2023-05-08T12:00:00Z)", value)
+	}
+	utc := timestamp.UTC().Format(time.RFC3339)
+	return utc, utc, nil
+}
+
+func isOpenIntervalBound(value string) bool {
+	return value == "" || value == openIntervalBound
+}
@@ -0,0 +1,99 @@
+package features
+
+import (
+	neturl "net/url"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemporal_parseDateTime(t *testing.T) {
+	temporal := newTemporal(engine.GeoSpatialCollections{
+		{ID: "buildings", Features: &engine.CollectionEntryFeatures{
+			Temporal: &engine.FeatureTemporalProperties{StartDate: "validfrom", EndDate: "validto"}}},
+		{ID: "roads", Features: &engine.CollectionEntryFeatures{}},
+	})
+	tests := []struct {
+		name         string
+		collectionID string
+		dateTime     string
+		want         *datasources.TemporalFilter
+		wantErr      string
+	}{
+		{
+			name:         "no datetime",
+			collectionID: "buildings",
+		},
+		{
+			name:         "timestamp",
+			collectionID: "buildings",
+			dateTime:     "2023-05-08T14:30:00+02:00",
+			want:         &datasources.TemporalFilter{Start: "2023-05-08T12:30:00Z", End: "2023-05-08T12:30:00Z", StartProperty: "validfrom", EndProperty: "validto"},
+		},
+		{
+			name:         "date covers whole day",
+			collectionID: "buildings",
+			dateTime:     "2023-05-08",
+			want:         &datasources.TemporalFilter{Start: "2023-05-08T00:00:00Z", End: "2023-05-08T23:59:59Z", StartProperty: "validfrom", EndProperty: "validto"},
+		},
+		{
+			name:         "bounded interval",
+			collectionID: "buildings",
+			dateTime:     "2023-05-08/2023-06-01T00:00:00Z",
+			want:         &datasources.TemporalFilter{Start: "2023-05-08T00:00:00Z", End: "2023-06-01T00:00:00Z", StartProperty: "validfrom", EndProperty: "validto"},
+		},
+		{
+			name:         "half-bounded interval",
+			collectionID: "buildings",
+			dateTime:     "../2023-05-08",
+			want:         &datasources.TemporalFilter{End: "2023-05-08T23:59:59Z", StartProperty: "validfrom", EndProperty: "validto"},
+		},
+		{
+			name:         "half-bounded interval with empty end",
+			collectionID: "buildings",
+			dateTime:     "2023-05-08T00:00:00Z/",
+			want:         &datasources.TemporalFilter{Start: "2023-05-08T00:00:00Z", StartProperty: "validfrom", EndProperty: "validto"},
+		},
+		{
+			name:         "interval open at both ends",
+			collectionID: "buildings",
+			dateTime:     "../..",
+			wantErr:      "datetime interval can't be open at both ends",
+		},
+		{
+			name:         "interval ends before it starts",
+			collectionID: "buildings",
+			dateTime:     "2023-05-08/2023-05-01",
+			wantErr:      "datetime interval must start before it ends",
+		},
+		{
+			name:         "invalid timestamp",
+			collectionID: "buildings",
+			dateTime:     "08-05-2023",
+			wantErr:      "datetime '08-05-2023' must be a date",
+		},
+		{
+			name:         "collection without temporal properties",
+			collectionID: "roads",
+			dateTime:     "2023-05-08",
+			wantErr:      "datetime param isn't supported on collection roads",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := neturl.Values{}
+			if tt.dateTime != "" {
+				params.Set(dateTimeParam, tt.dateTime)
+			}
+			got, err := temporal.parseDateTime(tt.collectionID, params)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
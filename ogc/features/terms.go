@@ -0,0 +1,147 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/common/geospatial"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// API clients acknowledge the terms of a collection by sending this header (with value "true")
+	termsAcceptedHeader = "X-Terms-Accepted"
+
+	// browsers get a cookie per collection after accepting its terms
+	termsCookiePrefix = "gokoala-terms-"
+	termsCookieMaxAge = 60 * 60 * 24 * 365
+)
+
+var termsKey = engine.NewTemplateKey(templatesDir + "terms.go.html")
+
+// downloadTerms terms users need to accept before downloading attachments, per collection. See Terms in config.
+type downloadTerms map[string]engine.DownloadTerms
+
+// termsPage terms of a collection for HTML representation
+type termsPage struct {
+	CollectionID string
+	Metadata     *engine.GeoSpatialCollectionMetadata
+	Terms        engine.DownloadTerms
+	Redirect     string
+}
+
+func newDownloadTerms(e *engine.Engine, collections engine.GeoSpatialCollections) downloadTerms {
+	result := make(downloadTerms)
+	for _, collection := range collections {
+		if collection.Features == nil || collection.Features.Terms == nil {
+			continue
+		}
+		result[collection.ID] = *collection.Features.Terms
+	}
+	if len(result) > 0 {
+		e.ParseTemplate(termsKey)
+	}
+	return result
+}
+
+// accepted returns true when the given collection has no terms, or the client accepted these
+func (t downloadTerms) accepted(r *http.Request, collectionID string) bool {
+	terms, ok := t[collectionID]
+	if !ok || r.Header.Get(termsAcceptedHeader) == "true" {
+		return true
+	}
+	cookie, err := r.Cookie(termsCookiePrefix + collectionID)
+	return err == nil && cookie.Value == termsToken(terms)
+}
+
+// termsToken identifies the current version of the terms, so changed terms need to be accepted again
+func termsToken(terms engine.DownloadTerms) string {
+	return strings.Trim(engine.NewETag([]byte(terms.Title+terms.Content)), `"`)
+}
+
+func termsPath(collectionID string) string {
+	return geospatial.CollectionsPath + "/" + collectionID + "/terms"
+}
+
+// requireTerms makes sure the terms of the given collection are accepted before a download. Browsers are
+// redirected to the terms, after which they return to the download. Returns false when the download
+// shouldn't proceed, in which case the response is already handled or an error is returned.
+func (f *Features) requireTerms(w http.ResponseWriter, r *http.Request, collectionID string) (bool, error) {
+	if f.terms.accepted(r, collectionID) {
+		return true, nil
+	}
+	if strings.Contains(r.Header.Get("Accept"), engine.MediaTypeHTML) {
+		target := f.absoluteURL(termsPath(collectionID)) + "?redirect=" + neturl.QueryEscape(engine.RelativePath(r))
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return false, nil
+	}
+	return false, engine.Forbidden(fmt.Sprintf("the terms of collection %s need to be accepted first, "+
+		"see %s or send header %s: true", collectionID, f.absoluteURL(termsPath(collectionID)), termsAcceptedHeader))
+}
+
+// Terms shows the terms of the collection, which the user can accept. The redirect parameter
+// holds the path of the download to return to after accepting the terms.
+func (f *Features) Terms() http.HandlerFunc {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		collectionID := chi.URLParam(r, "collectionId")
+		terms, ok := f.terms[collectionID]
+		if !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist or doesn't have terms", collectionID))
+		}
+		page := &termsPage{
+			CollectionID: collectionID,
+			Metadata:     f.collections[collectionID],
+			Terms:        terms,
+			Redirect:     safeRedirect(r.URL.Query().Get("redirect")),
+		}
+		breadcrumbs := append(f.engine.Breadcrumbs(geospatial.CollectionsPath+"/"+collectionID), engine.Breadcrumb{
+			Name: terms.Title,
+			Path: termsPath(collectionID),
+		})
+		lang := f.engine.CN.NegotiateLanguage(w, r)
+		f.engine.RenderAndServePage(w, r, engine.ExpandTemplateKey(termsKey, lang), page, breadcrumbs)
+		return nil
+	})
+}
+
+// AcceptTerms registers (in a cookie) that the user accepted the terms of the collection, and
+// returns the user to the download which required the terms (when given)
+func (f *Features) AcceptTerms() http.HandlerFunc {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		collectionID := chi.URLParam(r, "collectionId")
+		terms, ok := f.terms[collectionID]
+		if !ok {
+			return engine.NotFound(fmt.Sprintf("collection %s doesn't exist or doesn't have terms", collectionID))
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     termsCookiePrefix + collectionID,
+			Value:    termsToken(terms),
+			Path:     "/",
+			MaxAge:   termsCookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		redirect := safeRedirect(r.FormValue("redirect"))
+		if redirect == "" {
+			redirect = geospatial.CollectionsPath + "/" + collectionID
+		}
+		http.Redirect(w, r, f.absoluteURL(redirect), http.StatusSeeOther)
+		return nil
+	})
+}
+
+// absoluteURL the URL of the given path (relative to the base URL) of this API
+func (f *Features) absoluteURL(path string) string {
+	return strings.TrimSuffix(f.engine.Config.BaseURL.String(), "/") + path
+}
+
+// safeRedirect only allows redirects to paths (relative to the base URL) of this API, so no open redirect
+func safeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, `\`) {
+		return ""
+	}
+	return redirect
+}
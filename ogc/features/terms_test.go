@@ -0,0 +1,91 @@
+package features
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestFeatures_Terms(t *testing.T) {
+	collections := engine.GeoSpatialCollections{
+		{ID: "buildings", Features: &engine.CollectionEntryFeatures{
+			Attachments: []engine.FeatureAttachment{{Property: "photo"}},
+			Terms:       &engine.DownloadTerms{Title: "Terms of use", Content: "Photos are for **personal use** only."},
+		}},
+	}
+	e := engine.NewEngineWithConfig(&engine.Config{
+		Version:            "1.0.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.Dutch, language.English},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/v1"}},
+	}, "")
+	f := &Features{
+		engine:      e,
+		datasource:  attachmentDatasource{content: []byte("photo")},
+		attachments: newAttachments(collections),
+		terms:       newDownloadTerms(e, collections),
+		collections: map[string]*engine.GeoSpatialCollectionMetadata{},
+	}
+	router := chi.NewRouter()
+	router.Get("/collections/{collectionId}/items/{featureId}/attachments/{property}", f.Attachment())
+	router.Get("/collections/{collectionId}/terms", f.Terms())
+	router.Post("/collections/{collectionId}/terms", f.AcceptTerms())
+	request := func(method string, target string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	photo := "/collections/buildings/items/1/attachments/photo"
+
+	// API client
+	rr := request(http.MethodGet, photo, "", nil)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://api.foobar.example/v1/collections/buildings/terms")
+	assert.Contains(t, rr.Body.String(), "X-Terms-Accepted")
+	rr = request(http.MethodGet, photo, "", map[string]string{"X-Terms-Accepted": "true"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// browser is shown the terms first
+	rr = request(http.MethodGet, photo, "", map[string]string{"Accept": "text/html,*/*"})
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	termsURL := "https://api.foobar.example/v1/collections/buildings/terms?redirect=%2Fcollections%2Fbuildings%2Fitems%2F1%2Fattachments%2Fphoto"
+	assert.Equal(t, termsURL, rr.Header().Get("Location"))
+
+	rr = request(http.MethodGet, strings.TrimPrefix(termsURL, "https://api.foobar.example/v1"), "", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<strong>personal use</strong>")
+	assert.Contains(t, rr.Body.String(), `name="redirect" value="/collections/buildings/items/1/attachments/photo"`)
+
+	// accepting the terms returns the browser to the download
+	rr = request(http.MethodPost, "/collections/buildings/terms", "redirect="+url.QueryEscape(photo),
+		map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, "https://api.foobar.example/v1"+photo, rr.Header().Get("Location"))
+	cookie := rr.Result().Cookies()[0]
+	assert.Equal(t, "gokoala-terms-buildings", cookie.Name)
+
+	rr = request(http.MethodGet, photo, "", map[string]string{"Accept": "text/html", "Cookie": cookie.String()})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "photo", rr.Body.String())
+
+	// no open redirect
+	rr = request(http.MethodPost, "/collections/buildings/terms", "redirect=//evil.example",
+		map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	assert.Equal(t, "https://api.foobar.example/v1/collections/buildings", rr.Header().Get("Location"))
+
+	// changed terms need to be accepted again
+	changed := termsToken(engine.DownloadTerms{Title: "Terms of use", Content: "Photos are for commercial use too."})
+	assert.NotEqual(t, cookie.Value, changed)
+}
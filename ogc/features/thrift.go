@@ -0,0 +1,130 @@
+package features
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// thriftStruct a Thrift struct, the index of each value is the id of the field in the IDL. Absent (nil)
+// fields are omitted. Supported values: bool, int32, int64, string, []byte, thriftStruct and lists
+// of int32, string or thriftStruct.
+type thriftStruct []any
+
+// Thrift compact protocol types, see https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+const (
+	thriftTypeTrue   byte = 1
+	thriftTypeFalse  byte = 2
+	thriftTypeI32    byte = 5
+	thriftTypeI64    byte = 6
+	thriftTypeBinary byte = 8
+	thriftTypeList   byte = 9
+	thriftTypeStruct byte = 12
+)
+
+// encodeThriftCompact encodes the given struct using the Thrift compact protocol (as used by Parquet metadata)
+func encodeThriftCompact(s thriftStruct) ([]byte, error) {
+	return appendThriftStruct(nil, s)
+}
+
+func appendThriftStruct(buf []byte, s thriftStruct) ([]byte, error) {
+	lastID := 0
+	for id, value := range s {
+		if value == nil {
+			continue
+		}
+		fieldType, err := thriftFieldType(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", id, err)
+		}
+		if delta := id - lastID; delta > 0 && delta <= 15 {
+			buf = append(buf, byte(delta<<4)|fieldType) // short form, field id relative to previous field
+		} else {
+			buf = append(buf, fieldType)
+			buf = binary.AppendUvarint(buf, zigzag(int64(id)))
+		}
+		lastID = id
+		if _, isBool := value.(bool); isBool {
+			continue // value is part of the field type
+		}
+		if buf, err = appendThriftValue(buf, value); err != nil {
+			return nil, fmt.Errorf("field %d: %w", id, err)
+		}
+	}
+	return append(buf, 0), nil // stop field
+}
+
+func appendThriftValue(buf []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case int32:
+		return binary.AppendUvarint(buf, zigzag(int64(v))), nil
+	case int64:
+		return binary.AppendUvarint(buf, zigzag(v)), nil
+	case string:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...), nil
+	case []byte:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...), nil
+	case thriftStruct:
+		return appendThriftStruct(buf, v)
+	case []int32:
+		buf = appendThriftListHeader(buf, len(v), thriftTypeI32)
+		for _, e := range v {
+			buf = binary.AppendUvarint(buf, zigzag(int64(e)))
+		}
+		return buf, nil
+	case []string:
+		buf = appendThriftListHeader(buf, len(v), thriftTypeBinary)
+		for _, e := range v {
+			buf = binary.AppendUvarint(buf, uint64(len(e)))
+			buf = append(buf, e...)
+		}
+		return buf, nil
+	case []thriftStruct:
+		buf = appendThriftListHeader(buf, len(v), thriftTypeStruct)
+		var err error
+		for _, e := range v {
+			if buf, err = appendThriftStruct(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("unsupported Thrift value %T", value)
+	}
+}
+
+func appendThriftListHeader(buf []byte, size int, elementType byte) []byte {
+	if size < 15 {
+		return append(buf, byte(size<<4)|elementType)
+	}
+	buf = append(buf, 0xF0|elementType)
+	return binary.AppendUvarint(buf, uint64(size))
+}
+
+func thriftFieldType(value any) (byte, error) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return thriftTypeTrue, nil
+		}
+		return thriftTypeFalse, nil
+	case int32:
+		return thriftTypeI32, nil
+	case int64:
+		return thriftTypeI64, nil
+	case string, []byte:
+		return thriftTypeBinary, nil
+	case thriftStruct:
+		return thriftTypeStruct, nil
+	case []int32, []string, []thriftStruct:
+		return thriftTypeList, nil
+	default:
+		return 0, fmt.Errorf("unsupported Thrift value %T", value)
+	}
+}
+
+// zigzag maps signed integers to unsigned integers, so small negative numbers result in small varints
+func zigzag(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
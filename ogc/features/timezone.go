@@ -0,0 +1,84 @@
+package features
+
+import (
+	"log"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+)
+
+// layout of timestamps without offset, as stored in (legacy) datasources in local time
+const localDateTimeLayout = "2006-01-02T15:04:05"
+
+// timeZonesByCollectionID time zone of datetime columns without an offset per collection, see TimeZone in config.
+// Collections without a configured time zone are absent, their datetime columns are considered UTC.
+type timeZonesByCollectionID map[string]*time.Location
+
+func newTimeZones(collections engine.GeoSpatialCollections) timeZonesByCollectionID {
+	result := make(timeZonesByCollectionID)
+	for _, collection := range collections {
+		if collection.Features == nil || collection.Features.TimeZone == nil {
+			continue
+		}
+		location, err := time.LoadLocation(*collection.Features.TimeZone)
+		if err != nil {
+			log.Fatalf("invalid time zone '%s' of collection '%s': %v",
+				*collection.Features.TimeZone, collection.ID, err)
+		}
+		result[collection.ID] = location
+	}
+	return result
+}
+
+// normalize converts the datetime properties of the given features to UTC. Datetime columns without an offset
+// are read as UTC by the datasource, these are reinterpreted in the time zone of the collection first.
+func (tz timeZonesByCollectionID) normalize(collectionID string, features []*domain.Feature) {
+	location, ok := tz[collectionID]
+	if !ok {
+		return
+	}
+	for _, feature := range features {
+		for name, value := range feature.Properties {
+			t, isTime := value.(time.Time)
+			if !isTime {
+				continue
+			}
+			if t.Location() == time.UTC {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+			}
+			feature.Properties[name] = t.UTC()
+		}
+	}
+}
+
+// localizeFilters converts timestamps (with offset, e.g. 2023-05-08T12:00:00Z) in the given property
+// filters to the local time of the collection, since that's how datetime columns are stored.
+func (tz timeZonesByCollectionID) localizeFilters(collectionID string, filters map[string][]string) {
+	location, ok := tz[collectionID]
+	if !ok {
+		return
+	}
+	for _, values := range filters {
+		for i, value := range values {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				values[i] = t.In(location).Format(localDateTimeLayout)
+			}
+		}
+	}
+}
+
+// localizeTemporal converts the start and end (RFC 3339) of the given temporal filter to the
+// local time of the collection, since that's how datetime columns are stored.
+func (tz timeZonesByCollectionID) localizeTemporal(collectionID string, temporal *datasources.TemporalFilter) {
+	location, ok := tz[collectionID]
+	if !ok || temporal == nil {
+		return
+	}
+	for _, value := range []*string{&temporal.Start, &temporal.End} {
+		if t, err := time.Parse(time.RFC3339, *value); err == nil {
+			*value = t.In(location).Format(localDateTimeLayout)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package features
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/features/datasources"
+	"github.com/PDOK/gokoala/ogc/features/domain"
+	"github.com/go-spatial/geom/encoding/geojson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeZones_Normalize(t *testing.T) {
+	amsterdam := "Europe/Amsterdam"
+	timeZones := newTimeZones(engine.GeoSpatialCollections{
+		{ID: "legacy", Features: &engine.CollectionEntryFeatures{TimeZone: &amsterdam}},
+		{ID: "modern", Features: &engine.CollectionEntryFeatures{}},
+	})
+	withOffset := time.Date(2023, 5, 8, 14, 0, 0, 0, time.FixedZone("", 2*60*60))
+
+	tests := []struct {
+		name         string
+		collectionID string
+		properties   map[string]any
+		want         map[string]any
+	}{
+		{
+			name:         "local time in summer",
+			collectionID: "legacy",
+			properties:   map[string]any{"validfrom": time.Date(2023, 5, 8, 14, 0, 0, 0, time.UTC), "name": "foo"},
+			want:         map[string]any{"validfrom": time.Date(2023, 5, 8, 12, 0, 0, 0, time.UTC), "name": "foo"},
+		},
+		{
+			name:         "local time in winter",
+			collectionID: "legacy",
+			properties:   map[string]any{"validfrom": time.Date(2023, 1, 8, 14, 0, 0, 0, time.UTC)},
+			want:         map[string]any{"validfrom": time.Date(2023, 1, 8, 13, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:         "timestamp with offset",
+			collectionID: "legacy",
+			properties:   map[string]any{"validfrom": withOffset},
+			want:         map[string]any{"validfrom": time.Date(2023, 5, 8, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:         "collection without time zone",
+			collectionID: "modern",
+			properties:   map[string]any{"validfrom": time.Date(2023, 5, 8, 14, 0, 0, 0, time.UTC)},
+			want:         map[string]any{"validfrom": time.Date(2023, 5, 8, 14, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feature := &domain.Feature{Feature: geojson.Feature{Properties: tt.properties}}
+			timeZones.normalize(tt.collectionID, []*domain.Feature{feature})
+			assert.Equal(t, tt.want, feature.Properties)
+		})
+	}
+}
+
+func TestTimeZones_LocalizeFilters(t *testing.T) {
+	amsterdam := "Europe/Amsterdam"
+	timeZones := newTimeZones(engine.GeoSpatialCollections{
+		{ID: "legacy", Features: &engine.CollectionEntryFeatures{TimeZone: &amsterdam}},
+	})
+	filters := map[string][]string{
+		"validfrom": {"2023-05-08T12:00:00Z", "2023-05-08"},
+		"status":    {"active"},
+	}
+	timeZones.localizeFilters("legacy", filters)
+	assert.Equal(t, map[string][]string{
+		"validfrom": {"2023-05-08T14:00:00", "2023-05-08"},
+		"status":    {"active"},
+	}, filters)
+}
+
+func TestTimeZones_LocalizeTemporal(t *testing.T) {
+	amsterdam := "Europe/Amsterdam"
+	timeZones := newTimeZones(engine.GeoSpatialCollections{
+		{ID: "legacy", Features: &engine.CollectionEntryFeatures{TimeZone: &amsterdam}},
+	})
+	temporal := &datasources.TemporalFilter{Start: "2023-05-08T12:00:00Z", StartProperty: "validfrom"}
+	timeZones.localizeTemporal("legacy", temporal)
+	assert.Equal(t, &datasources.TemporalFilter{Start: "2023-05-08T14:00:00", StartProperty: "validfrom"}, temporal)
+
+	timeZones.localizeTemporal("legacy", nil) // no datetime param
+}
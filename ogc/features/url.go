@@ -4,28 +4,47 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"net/http"
 	"net/url"
 	"slices"
 	"sort"
-	"strconv"
 
 	"github.com/PDOK/gokoala/engine"
 	"github.com/PDOK/gokoala/ogc/features/domain"
 )
 
 const (
-	cursorParam    = "cursor"
-	limitParam     = "limit"
-	crsParam       = "crs"
-	dateTimeParam  = "datetime"
-	bboxParam      = "bbox"
-	bboxCrsParam   = "bbox-crs"
-	filterParam    = "filter"
-	filterCrsParam = "filter-crs"
+	cursorParam           = "cursor"
+	limitParam            = "limit"
+	idsParam              = "ids"
+	crsParam              = "crs"
+	skipGeometryParam     = "skipGeometry"
+	bboxOnlyParam         = "bbox-only"
+	geometryParam         = "geometry"
+	geometryEncodingParam = "geometry-encoding"
+	expandParam           = "expand"
+	propertiesParam       = "properties"
+	dateTimeParam         = "datetime"
+	bboxParam             = "bbox"
+	bboxCrsParam          = "bbox-crs"
+	filterParam           = "filter"
+	filterCrsParam        = "filter-crs"
+	filterLangParam       = "filter-lang"
+	searchParam           = "q"
+	nearestParam          = "nearest"
+	nearestCrsParam       = "nearest-crs"
+	countParam            = "count"
+	offsetParam           = "offset"
+	startIndexParam       = "startIndex"
 )
 
 var (
-	checksumExcludedParams = []string{engine.FormatParam, cursorParam} // don't include these in checksum
+	// don't include these in checksum
+	checksumExcludedParams = []string{engine.FormatParam, engine.EmbedParam, cursorParam, offsetParam, startIndexParam}
+
+	// params which select or page through features, these are meaningless when requesting features by id
+	idsExcludedParams = []string{limitParam, cursorParam, offsetParam, startIndexParam, dateTimeParam, bboxParam,
+		bboxCrsParam, filterParam, filterCrsParam, filterLangParam, searchParam, nearestParam, nearestCrsParam, countParam}
 )
 
 type URL interface {
@@ -34,8 +53,9 @@ type URL interface {
 
 // URL to a page in a collection of features
 type featureCollectionURL struct {
-	baseURL url.URL
-	params  url.Values
+	baseURL    url.URL
+	params     url.Values
+	queryables []string
 }
 
 // Calculate checksum over the query parameters that have a "filtering effect" on
@@ -86,25 +106,62 @@ func (fc featureCollectionURL) toSelfURL(collectionID string, format string) str
 func (fc featureCollectionURL) toPrevNextURL(collectionID string, cursor domain.EncodedCursor, format string) string {
 	copyParams := clone(fc.params)
 	copyParams.Set(engine.FormatParam, format)
-	copyParams.Set(cursorParam, cursor.String())
+	if param := offsetParamOf(fc.params); param != "" {
+		copyParams.Set(param, cursor.String()) // offset-based pagination, the cursor holds the offset
+	} else {
+		copyParams.Set(cursorParam, cursor.String())
+	}
 
 	result := fc.baseURL.JoinPath("collections", collectionID, "items")
 	result.RawQuery = copyParams.Encode()
 	return result.String()
 }
 
+// setPaginationLinkHeaders links to the next/prev page using Link headers (RFC 8288),
+// for formats that have no room for links in the response body itself
+func (fc featureCollectionURL) setPaginationLinkHeaders(w http.ResponseWriter, collectionID string,
+	cursor domain.Cursors, format string, mediaType string) {
+
+	if cursor.HasNext {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"; type="%s"`,
+			fc.toPrevNextURL(collectionID, cursor.Next, format), mediaType))
+	}
+	if cursor.HasPrev {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev"; type="%s"`,
+			fc.toPrevNextURL(collectionID, cursor.Prev, format), mediaType))
+	}
+}
+
 // implements req 7.6 (https://docs.ogc.org/is/17-069r4/17-069r4.html#query_parameters)
 func (fc featureCollectionURL) validateNoUnknownParams() error {
 	copyParams := clone(fc.params)
 	copyParams.Del(engine.FormatParam)
+	copyParams.Del(engine.EmbedParam)
 	copyParams.Del(limitParam)
 	copyParams.Del(cursorParam)
+	copyParams.Del(idsParam)
 	copyParams.Del(crsParam)
+	copyParams.Del(skipGeometryParam)
+	copyParams.Del(bboxOnlyParam)
+	copyParams.Del(geometryParam)
+	copyParams.Del(geometryEncodingParam)
+	copyParams.Del(expandParam)
+	copyParams.Del(propertiesParam)
 	copyParams.Del(dateTimeParam)
 	copyParams.Del(bboxParam)
 	copyParams.Del(bboxCrsParam)
 	copyParams.Del(filterParam)
 	copyParams.Del(filterCrsParam)
+	copyParams.Del(filterLangParam)
+	copyParams.Del(searchParam)
+	copyParams.Del(nearestParam)
+	copyParams.Del(nearestCrsParam)
+	copyParams.Del(countParam)
+	copyParams.Del(offsetParam)
+	copyParams.Del(startIndexParam)
+	for _, queryable := range fc.queryables {
+		copyParams.Del(queryable)
+	}
 	if len(copyParams) > 0 {
 		return fmt.Errorf("unknown query parameter(s) found: %v", copyParams.Encode())
 	}
@@ -117,11 +174,11 @@ type featureURL struct {
 	params  url.Values
 }
 
-func (f featureURL) toSelfURL(collectionID string, featureID int64, format string) string {
+func (f featureURL) toSelfURL(collectionID string, featureID domain.FeatureID, format string) string {
 	newParams := url.Values{}
 	newParams.Set(engine.FormatParam, format)
 
-	result := f.baseURL.JoinPath("collections", collectionID, "items", strconv.FormatInt(featureID, 10))
+	result := f.baseURL.JoinPath("collections", collectionID, "items", featureID.String())
 	result.RawQuery = newParams.Encode()
 	return result.String()
 }
@@ -139,7 +196,13 @@ func (f featureURL) toCollectionURL(collectionID string, format string) string {
 func (f featureURL) validateNoUnknownParams() error {
 	copyParams := clone(f.params)
 	copyParams.Del(engine.FormatParam)
+	copyParams.Del(engine.EmbedParam)
 	copyParams.Del(crsParam)
+	copyParams.Del(skipGeometryParam)
+	copyParams.Del(bboxOnlyParam)
+	copyParams.Del(geometryParam)
+	copyParams.Del(expandParam)
+	copyParams.Del(propertiesParam)
 	if len(copyParams) > 0 {
 		return fmt.Errorf("unknown query parameter(s) found: %v", copyParams.Encode())
 	}
@@ -14,18 +14,23 @@ import (
 )
 
 type ThreeDimensionalGeoVolumes struct {
-	engine *engine.Engine
+	engine   *engine.Engine
+	client   *http.Client
+	subtrees *subtreeCache
 }
 
-func NewThreeDimensionalGeoVolumes(e *engine.Engine, router *chi.Mux) *ThreeDimensionalGeoVolumes {
+func NewThreeDimensionalGeoVolumes(e *engine.Engine, router chi.Router) *ThreeDimensionalGeoVolumes {
 	_, err := url.ParseRequestURI(e.Config.OgcAPI.GeoVolumes.TileServer.String())
 	if err != nil {
 		log.Fatalf("invalid tileserver url provided: %v", err)
 	}
 
 	geoVolumes := &ThreeDimensionalGeoVolumes{
-		engine: e,
+		engine:   e,
+		client:   &http.Client{},
+		subtrees: newSubtreeCache(e.Config.OgcAPI.GeoVolumes.GetSubtreeCacheSize()),
 	}
+	geoVolumes.enrichCollections()
 
 	// 3D Tiles
 	router.Get(geospatial.CollectionsPath+"/{3dContainerId}/3dtiles", geoVolumes.CollectionContent("tileset.json"))
@@ -99,6 +104,10 @@ func (t *ThreeDimensionalGeoVolumes) Tile() http.HandlerFunc {
 		}
 
 		path, _ := url.JoinPath("/", tileServerPath, tilePathPrefix, tileMatrix, tileRow, tileColAndSuffix)
+		if strings.HasSuffix(tileColAndSuffix, subtreeSuffix) {
+			t.subtree(w, r, path)
+			return
+		}
 		t.reverseProxy(w, r, path, true, contentType)
 	}
 }
@@ -125,8 +134,7 @@ func (t *ThreeDimensionalGeoVolumes) reverseProxy(w http.ResponseWriter, r *http
 
 	target, err := url.Parse(t.engine.Config.OgcAPI.GeoVolumes.TileServer.String() + path)
 	if err != nil {
-		log.Printf("invalid target url, can't proxy tiles: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		engine.RenderError(w, r, engine.InternalError("invalid target url, can't proxy tiles", err))
 		return
 	}
 	t.engine.ReverseProxy(w, r, target, prefer204, contentTypeOverwrite)
@@ -0,0 +1,271 @@
+package geovolumes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const (
+	metadataTimeout = 10 * time.Second
+
+	// WGS84 ellipsoid, to convert earth-centered earth-fixed (ECEF) coordinates to lon/lat
+	wgs84SemiMajorAxis    = 6378137.0
+	wgs84EccentricitySqrd = 6.69437999014e-3
+
+	// bounding volumes further from (or closer to) the center of the earth aren't in ECEF
+	minEarthRadius = 6.0e6
+	maxEarthRadius = 7.0e6
+)
+
+// tileset subset of a 3D Tiles tileset.json, see https://docs.ogc.org/cs/22-025r4/22-025r4.html#toc29
+type tileset struct {
+	GeometricError *float64 `json:"geometricError"`
+	Root           tile     `json:"root"`
+}
+
+type tile struct {
+	BoundingVolume struct {
+		Region []float64 `json:"region"`
+		Box    []float64 `json:"box"`
+		Sphere []float64 `json:"sphere"`
+	} `json:"boundingVolume"`
+	GeometricError *float64  `json:"geometricError"`
+	Transform      []float64 `json:"transform"`
+	Children       []tile    `json:"children"`
+	ImplicitTiling *struct {
+		AvailableLevels int `json:"availableLevels"`
+	} `json:"implicitTiling"`
+	Extensions struct {
+		ImplicitTiling *struct {
+			MaximumLevel int `json:"maximumLevel"`
+		} `json:"3DTILES_implicit_tiling"`
+	} `json:"extensions"`
+}
+
+// layer subset of a quantized mesh layer.json, see https://github.com/CesiumGS/quantized-mesh
+type layer struct {
+	Bounds    []float64 `json:"bounds"`
+	Available [][]any   `json:"available"`
+	MaxZoom   *int      `json:"maxzoom"`
+}
+
+// enrichCollections retrieves the tileset (tileset.json or layer.json) of each collection from the tileserver
+// to derive the extent, geometric error and available levels of the collection. Failures are logged, since
+// this metadata is optional. Should run before the collections are rendered, see geospatial.NewCollections.
+func (t *ThreeDimensionalGeoVolumes) enrichCollections() {
+	client := &http.Client{Timeout: metadataTimeout}
+	collections := t.engine.Config.OgcAPI.GeoVolumes.Collections
+
+	var wg sync.WaitGroup
+	for i := range collections {
+		collection := &collections[i]
+		if collection.GeoVolumes == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := t.enrichCollection(client, collection); err != nil {
+				log.Printf("failed to derive metadata of 3D collection %s from its tileset, "+
+					"continuing without: %v", collection.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (t *ThreeDimensionalGeoVolumes) enrichCollection(client *http.Client, collection *engine.GeoSpatialCollection) error {
+	tileServerPath := collection.ID
+	if collection.GeoVolumes.TileServerPath != nil {
+		tileServerPath = *collection.GeoVolumes.TileServerPath
+	}
+	var metadata *engine.TilesetMetadata
+	var extent *engine.Extent
+	var err error
+	switch {
+	case collection.GeoVolumes.Has3DTiles():
+		var ts tileset
+		if err = t.getJSON(client, tileServerPath, "tileset.json", &ts); err != nil {
+			return err
+		}
+		metadata, extent = ts.metadata()
+	case collection.GeoVolumes.HasDTM():
+		var l layer
+		if err = t.getJSON(client, tileServerPath, "layer.json", &l); err != nil {
+			return err
+		}
+		metadata, extent = l.metadata()
+	default:
+		return nil
+	}
+	collection.GeoVolumes.TilesetMetadata = metadata
+
+	// configured extent takes precedence
+	if extent != nil {
+		if collection.Metadata == nil {
+			collection.Metadata = &engine.GeoSpatialCollectionMetadata{}
+		}
+		if collection.Metadata.Extent == nil {
+			collection.Metadata.Extent = extent
+		}
+	}
+	return nil
+}
+
+func (t *ThreeDimensionalGeoVolumes) getJSON(client *http.Client, tileServerPath string, fileName string, result any) error {
+	target, err := url.JoinPath(t.engine.Config.OgcAPI.GeoVolumes.TileServer.String(), tileServerPath, fileName)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d for %s", resp.StatusCode, target)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", target, err)
+	}
+	return nil
+}
+
+func (ts *tileset) metadata() (*engine.TilesetMetadata, *engine.Extent) {
+	metadata := &engine.TilesetMetadata{GeometricError: ts.Root.GeometricError}
+	if metadata.GeometricError == nil {
+		metadata.GeometricError = ts.GeometricError
+	}
+	levels := ts.Root.levels()
+	metadata.AvailableLevels = &levels
+	return metadata, ts.Root.extent()
+}
+
+// levels depth of the tile tree, for implicit tiling this is defined in the tileset.
+// Note that external tilesets (children with a tileset.json as content) aren't followed.
+func (t *tile) levels() int {
+	if t.ImplicitTiling != nil {
+		return t.ImplicitTiling.AvailableLevels
+	}
+	if t.Extensions.ImplicitTiling != nil {
+		return t.Extensions.ImplicitTiling.MaximumLevel + 1
+	}
+	maxChildLevels := 0
+	for _, child := range t.Children {
+		maxChildLevels = max(maxChildLevels, child.levels())
+	}
+	return maxChildLevels + 1
+}
+
+// extent of the bounding volume of the tile in WGS84 (lon/lat)
+func (t *tile) extent() *engine.Extent {
+	bv := t.BoundingVolume
+	switch {
+	case len(bv.Region) >= 4:
+		// region is west, south, east, north in radians (and min/max height)
+		return toExtent(radToDeg(bv.Region[0]), radToDeg(bv.Region[1]), radToDeg(bv.Region[2]), radToDeg(bv.Region[3]))
+	case len(bv.Box) == 12:
+		// box is center followed by 3 half-axes
+		var corners [][3]float64
+		for _, sx := range []float64{-1, 1} {
+			for _, sy := range []float64{-1, 1} {
+				for _, sz := range []float64{-1, 1} {
+					var corner [3]float64
+					for i := 0; i < 3; i++ {
+						corner[i] = bv.Box[i] + sx*bv.Box[3+i] + sy*bv.Box[6+i] + sz*bv.Box[9+i]
+					}
+					corners = append(corners, corner)
+				}
+			}
+		}
+		return ecefToExtent(corners, t.Transform)
+	case len(bv.Sphere) == 4:
+		// sphere is center and radius, use the enclosing box
+		var corners [][3]float64
+		for _, sx := range []float64{-1, 1} {
+			for _, sy := range []float64{-1, 1} {
+				for _, sz := range []float64{-1, 1} {
+					r := bv.Sphere[3]
+					corners = append(corners, [3]float64{bv.Sphere[0] + sx*r, bv.Sphere[1] + sy*r, bv.Sphere[2] + sz*r})
+				}
+			}
+		}
+		return ecefToExtent(corners, t.Transform)
+	}
+	return nil
+}
+
+func (l *layer) metadata() (*engine.TilesetMetadata, *engine.Extent) {
+	metadata := &engine.TilesetMetadata{}
+	if len(l.Available) > 0 {
+		levels := len(l.Available)
+		metadata.AvailableLevels = &levels
+	} else if l.MaxZoom != nil {
+		levels := *l.MaxZoom + 1
+		metadata.AvailableLevels = &levels
+	}
+	var extent *engine.Extent
+	if len(l.Bounds) == 4 {
+		// bounds are west, south, east, north in degrees
+		extent = toExtent(l.Bounds[0], l.Bounds[1], l.Bounds[2], l.Bounds[3])
+	}
+	return metadata, extent
+}
+
+// ecefToExtent transforms the given points (optionally with a 4x4 column-major transform, as
+// used in 3D Tiles) to lon/lat. Returns nil when the points aren't in ECEF but in a local CRS.
+func ecefToExtent(points [][3]float64, transform []float64) *engine.Extent {
+	minLon, minLat, maxLon, maxLat := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		if len(transform) == 16 {
+			p = [3]float64{
+				transform[0]*p[0] + transform[4]*p[1] + transform[8]*p[2] + transform[12],
+				transform[1]*p[0] + transform[5]*p[1] + transform[9]*p[2] + transform[13],
+				transform[2]*p[0] + transform[6]*p[1] + transform[10]*p[2] + transform[14],
+			}
+		}
+		distance := math.Sqrt(p[0]*p[0] + p[1]*p[1] + p[2]*p[2])
+		if distance < minEarthRadius || distance > maxEarthRadius {
+			return nil
+		}
+		lon, lat := ecefToLonLat(p)
+		minLon, minLat = math.Min(minLon, lon), math.Min(minLat, lat)
+		maxLon, maxLat = math.Max(maxLon, lon), math.Max(maxLat, lat)
+	}
+	return toExtent(minLon, minLat, maxLon, maxLat)
+}
+
+// ecefToLonLat converts earth-centered earth-fixed coordinates to WGS84 lon/lat in degrees (iteratively)
+func ecefToLonLat(p [3]float64) (float64, float64) {
+	x, y, z := p[0], p[1], p[2]
+	lon := math.Atan2(y, x)
+	distance := math.Hypot(x, y)
+	lat := math.Atan2(z, distance*(1-wgs84EccentricitySqrd))
+	for i := 0; i < 5; i++ {
+		n := wgs84SemiMajorAxis / math.Sqrt(1-wgs84EccentricitySqrd*math.Sin(lat)*math.Sin(lat))
+		height := distance/math.Cos(lat) - n
+		lat = math.Atan2(z, distance*(1-wgs84EccentricitySqrd*n/(n+height)))
+	}
+	return radToDeg(lon), radToDeg(lat)
+}
+
+func toExtent(minLon, minLat, maxLon, maxLat float64) *engine.Extent {
+	bbox := make([]string, 0, 4)
+	for _, v := range []float64{minLon, minLat, maxLon, maxLat} {
+		bbox = append(bbox, strconv.FormatFloat(v, 'f', 6, 64))
+	}
+	return &engine.Extent{Srs: "EPSG:4326", Bbox: bbox}
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
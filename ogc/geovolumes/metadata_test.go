@@ -0,0 +1,136 @@
+package geovolumes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreeDimensionalGeoVolumes_EnrichCollections(t *testing.T) {
+	tilesets := map[string]string{
+		// region in radians, explicit tiling with 3 levels
+		"/region/tileset.json": `{
+  "asset": {"version": "1.0"},
+  "geometricError": 500,
+  "root": {
+    "boundingVolume": {"region": [0.07853981633974483, 0.8988445647770797, 0.09599310885968812, 0.9162978572970231, 0, 100]},
+    "geometricError": 250,
+    "children": [
+      {"boundingVolume": {"region": [0, 0, 0, 0, 0, 0]}, "geometricError": 100, "children": [
+        {"boundingVolume": {"region": [0, 0, 0, 0, 0, 0]}, "geometricError": 0}
+      ]},
+      {"boundingVolume": {"region": [0, 0, 0, 0, 0, 0]}, "geometricError": 100}
+    ]
+  }
+}`,
+		// box around the origin, transformed to ECEF (lon 5, lat 52), implicit tiling
+		"/box/tileset.json": `{
+  "asset": {"version": "1.1"},
+  "geometricError": 1000,
+  "root": {
+    "boundingVolume": {"box": [0, 0, 0, 100, 0, 0, 0, 100, 0, 0, 0, 100]},
+    "transform": [1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 3919986.7541026636, 342954.4021557669, 5002803.34548264, 1],
+    "implicitTiling": {"subdivisionScheme": "QUADTREE", "availableLevels": 12, "subtreeLevels": 4}
+  }
+}`,
+		// box in local CRS, extent can't be derived
+		"/local/tileset.json": `{
+  "asset": {"version": "1.0"},
+  "geometricError": 10,
+  "root": {"boundingVolume": {"box": [0, 0, 0, 100, 0, 0, 0, 100, 0, 0, 0, 100]}}
+}`,
+		// configured extent takes precedence
+		"/configured/tileset.json": `{
+  "asset": {"version": "1.0"},
+  "root": {"boundingVolume": {"region": [0.07, 0.89, 0.09, 0.91, 0, 100]}}
+}`,
+		"/dtm/layer.json": `{
+  "tilejson": "2.1.0",
+  "format": "quantized-mesh-1.0",
+  "bounds": [3.2, 50.7, 7.3, 53.6],
+  "available": [[{"startX": 0, "startY": 0, "endX": 1, "endY": 0}], [], []]
+}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tileset, ok := tilesets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		engine.SafeWrite(w.Write, []byte(tileset))
+	}))
+	defer ts.Close()
+
+	tileServer, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	uriTemplate := "{level}/{x}/{y}.glb"
+	dtmPath := "dtm"
+	configuredTitle := "Configured"
+	e := &engine.Engine{Config: &engine.Config{OgcAPI: engine.OgcAPI{GeoVolumes: &engine.OgcAPI3dGeoVolumes{
+		TileServer: engine.YAMLURL{URL: tileServer},
+		Collections: engine.GeoSpatialCollections{
+			{ID: "region", GeoVolumes: &engine.CollectionEntry3dGeoVolumes{URITemplate3dTiles: &uriTemplate}},
+			{ID: "box", GeoVolumes: &engine.CollectionEntry3dGeoVolumes{URITemplate3dTiles: &uriTemplate},
+				Metadata: &engine.GeoSpatialCollectionMetadata{Title: &configuredTitle}},
+			{ID: "local", GeoVolumes: &engine.CollectionEntry3dGeoVolumes{URITemplate3dTiles: &uriTemplate}},
+			{ID: "terrain", GeoVolumes: &engine.CollectionEntry3dGeoVolumes{URITemplateDTM: &uriTemplate, TileServerPath: &dtmPath}},
+			{ID: "configured", GeoVolumes: &engine.CollectionEntry3dGeoVolumes{URITemplate3dTiles: &uriTemplate},
+				Metadata: &engine.GeoSpatialCollectionMetadata{Extent: &engine.Extent{Srs: "EPSG:28992", Bbox: []string{"1", "2", "3", "4"}}}},
+			{ID: "missing", GeoVolumes: &engine.CollectionEntry3dGeoVolumes{URITemplate3dTiles: &uriTemplate}},
+		},
+	}}}}
+
+	geoVolumes := &ThreeDimensionalGeoVolumes{engine: e}
+	geoVolumes.enrichCollections()
+	collections := e.Config.OgcAPI.GeoVolumes.Collections
+
+	tests := []struct {
+		collection         int
+		wantGeometricError *float64
+		wantLevels         *int
+		wantBbox           []float64 // nil when no extent is expected
+		wantSrs            string
+	}{
+		{collection: 0, wantGeometricError: ptr(250.0), wantLevels: ptr(3), wantBbox: []float64{4.5, 51.5, 5.5, 52.5}, wantSrs: "EPSG:4326"},
+		{collection: 1, wantGeometricError: ptr(1000.0), wantLevels: ptr(12), wantBbox: []float64{5, 52, 5, 52}, wantSrs: "EPSG:4326"},
+		{collection: 2, wantGeometricError: ptr(10.0), wantLevels: ptr(1)},
+		{collection: 3, wantLevels: ptr(3), wantBbox: []float64{3.2, 50.7, 7.3, 53.6}, wantSrs: "EPSG:4326"},
+		{collection: 4, wantLevels: ptr(1), wantBbox: []float64{1, 2, 3, 4}, wantSrs: "EPSG:28992"},
+		{collection: 5},
+	}
+	for _, tt := range tests {
+		collection := collections[tt.collection]
+		t.Run(collection.ID, func(t *testing.T) {
+			metadata := collection.GeoVolumes.TilesetMetadata
+			if tt.wantLevels == nil {
+				assert.Nil(t, metadata)
+			} else {
+				require.NotNil(t, metadata)
+				assert.Equal(t, tt.wantGeometricError, metadata.GeometricError)
+				assert.Equal(t, tt.wantLevels, metadata.AvailableLevels)
+			}
+			if tt.wantBbox == nil {
+				assert.True(t, collection.Metadata == nil || collection.Metadata.Extent == nil)
+				return
+			}
+			require.NotNil(t, collection.Metadata.Extent)
+			assert.Equal(t, tt.wantSrs, collection.Metadata.Extent.Srs)
+			for i, value := range collection.Metadata.Extent.Bbox {
+				actual, err := strconv.ParseFloat(value, 64)
+				require.NoError(t, err)
+				assert.InDelta(t, tt.wantBbox[i], actual, 0.01)
+			}
+		})
+	}
+	assert.Equal(t, &configuredTitle, collections[1].Metadata.Title)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,163 @@
+package geovolumes
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const (
+	subtreeSuffix  = ".subtree"
+	subtreeTimeout = 15 * time.Second
+)
+
+// headers of the upstream response which are cached along with the subtree
+var subtreeHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Cache-Control"}
+
+// subtreeCache in-memory LRU cache of subtrees (from the 3D Tiles implicit tiling extension). Subtrees
+// are small, immutable and requested often since clients (e.g. Cesium) need them to determine which
+// tiles are available. Bounded by size in bytes.
+type subtreeCache struct {
+	maxSize int
+
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List // most recently used in front
+}
+
+type subtree struct {
+	path   string
+	body   []byte
+	header http.Header
+}
+
+func newSubtreeCache(maxSizeMiB int) *subtreeCache {
+	return &subtreeCache{
+		maxSize: maxSizeMiB * 1024 * 1024,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *subtreeCache) get(path string) (*subtree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*subtree), true
+}
+
+func (c *subtreeCache) add(s *subtree) {
+	if len(s.body) > c.maxSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[s.path]; ok {
+		return // added by concurrent request
+	}
+	c.entries[s.path] = c.lru.PushFront(s)
+	c.size += len(s.body)
+	for c.size > c.maxSize {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*subtree)
+		delete(c.entries, evicted.path)
+		c.size -= len(evicted.body)
+	}
+}
+
+// subtree serves a subtree from cache, or retrieves it from the tileserver when it isn't cached yet.
+// Supports conditional requests using the ETag of the tileserver (or a generated ETag when absent).
+func (t *ThreeDimensionalGeoVolumes) subtree(w http.ResponseWriter, r *http.Request, path string) {
+	s, ok := t.subtrees.get(path)
+	if !ok {
+		var status int
+		var err error
+		s, status, err = t.fetchSubtree(r.Context(), path)
+		if err != nil {
+			engine.RenderError(w, r, engine.UpstreamUnavailable("failed to retrieve subtree", fmt.Errorf("subtree %s: %w", path, err)))
+			return
+		}
+		if status != http.StatusOK {
+			engine.RenderProblem(w, status, "")
+			return
+		}
+		t.subtrees.add(s)
+	}
+
+	for name, values := range s.header {
+		w.Header()[name] = values
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), s.header.Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	engine.SafeWrite(w.Write, s.body)
+}
+
+// fetchSubtree retrieves a subtree from the tileserver, only successful responses are returned
+func (t *ThreeDimensionalGeoVolumes) fetchSubtree(ctx context.Context, path string) (*subtree, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, subtreeTimeout)
+	defer cancel()
+
+	target := t.engine.Config.OgcAPI.GeoVolumes.TileServer.String() + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-BaseUrl", t.engine.Config.BaseURL.String())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, http.StatusNotFound, nil
+		}
+		return nil, 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s := &subtree{path: path, body: body, header: make(http.Header)}
+	for _, name := range subtreeHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			s.header.Set(name, value)
+		}
+	}
+	if s.header.Get("ETag") == "" {
+		hash := sha256.Sum256(body)
+		s.header.Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+	}
+	return s, http.StatusOK, nil
+}
+
+// etagMatches compares the If-None-Match header with the given ETag (weak comparison, see RFC 9110)
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package geovolumes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreeDimensionalGeoVolumes_Subtree(t *testing.T) {
+	var upstreamRequests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequests.Add(1)
+		switch r.URL.Path {
+		case "/container_1/subtrees/0/0/0.subtree":
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Content-Type", "application/octet-stream")
+			engine.SafeWrite(w.Write, []byte("subtree with etag"))
+		case "/container_1/subtrees/1/0/0.subtree":
+			engine.SafeWrite(w.Write, []byte("subtree without etag"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tileServer, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	geoVolumes := &ThreeDimensionalGeoVolumes{
+		engine: &engine.Engine{Config: &engine.Config{
+			BaseURL: engine.YAMLURL{URL: tileServer},
+			OgcAPI: engine.OgcAPI{GeoVolumes: &engine.OgcAPI3dGeoVolumes{
+				TileServer:  engine.YAMLURL{URL: tileServer},
+				Collections: engine.GeoSpatialCollections{{ID: "container_1"}},
+			}},
+		}},
+		client:   &http.Client{},
+		subtrees: newSubtreeCache(1),
+	}
+
+	tests := []struct {
+		name                 string
+		tile                 string
+		ifNoneMatch          string
+		wantStatusCode       int
+		wantBody             string
+		wantETag             string
+		wantUpstreamRequests int32
+	}{
+		{
+			name:                 "subtree from tileserver",
+			tile:                 "0/0/0.subtree",
+			wantStatusCode:       http.StatusOK,
+			wantBody:             "subtree with etag",
+			wantETag:             `"abc"`,
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "subtree from cache",
+			tile:                 "0/0/0.subtree",
+			wantStatusCode:       http.StatusOK,
+			wantBody:             "subtree with etag",
+			wantETag:             `"abc"`,
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "subtree not modified",
+			tile:                 "0/0/0.subtree",
+			ifNoneMatch:          `W/"abc", "def"`,
+			wantStatusCode:       http.StatusNotModified,
+			wantETag:             `"abc"`,
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "subtree with generated etag",
+			tile:                 "1/0/0.subtree",
+			wantStatusCode:       http.StatusOK,
+			wantBody:             "subtree without etag",
+			wantETag:             `"4347d5272b82624d302a02c66ab78b93"`,
+			wantUpstreamRequests: 2,
+		},
+		{
+			name:                 "subtree not found",
+			tile:                 "2/0/0.subtree",
+			wantStatusCode:       http.StatusNotFound,
+			wantUpstreamRequests: 3,
+		},
+		{
+			name:                 "missing subtree isn't cached",
+			tile:                 "2/0/0.subtree",
+			wantStatusCode:       http.StatusNotFound,
+			wantUpstreamRequests: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/collections/container_1/3dtiles/subtrees/"+tt.tile, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("3dContainerId", "container_1")
+			rctx.URLParams.Add("tilePathPrefix", "subtrees")
+			tile := strings.Split(tt.tile, "/")
+			rctx.URLParams.Add("tileMatrix", tile[0])
+			rctx.URLParams.Add("tileRow", tile[1])
+			rctx.URLParams.Add("tileColAndSuffix", tile[2])
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			geoVolumes.Tile().ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+			if tt.wantETag != "" {
+				assert.Equal(t, tt.wantETag, rr.Header().Get("ETag"))
+			}
+			assert.Equal(t, tt.wantUpstreamRequests, upstreamRequests.Load())
+		})
+	}
+}
+
+func TestSubtreeCache_Eviction(t *testing.T) {
+	cache := newSubtreeCache(1)
+	half := make([]byte, 512*1024)
+
+	cache.add(&subtree{path: "a", body: half})
+	cache.add(&subtree{path: "b", body: half})
+	_, ok := cache.get("a") // a is now most recently used
+	assert.True(t, ok)
+
+	cache.add(&subtree{path: "c", body: half}) // evicts b
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	_, ok = cache.get("a")
+	assert.True(t, ok)
+	_, ok = cache.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 1024*1024, cache.size)
+
+	cache.add(&subtree{path: "too large", body: make([]byte, 1024*1024+1)})
+	_, ok = cache.get("too large")
+	assert.False(t, ok)
+}
@@ -16,7 +16,7 @@ type Maps struct {
 }
 
 // NewMaps !!! Placeholder implementation, for future reference !!!
-func NewMaps(e *engine.Engine, router *chi.Mux) *Maps {
+func NewMaps(e *engine.Engine, router chi.Router) *Maps {
 	maps := &Maps{
 		engine: e,
 	}
@@ -0,0 +1,286 @@
+package processes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// separates the backend ID from the process or job ID of the backend, e.g. "vector.buffer"
+	idSeparator = "."
+
+	backendTimeout = 30 * time.Second
+)
+
+// backend an upstream processes server which is part of the aggregated processes API
+type backend struct {
+	id  string
+	url *url.URL
+}
+
+// aggregator serves multiple upstream processes servers (backends) as a single processes API.
+// The process and job lists are combined, process and job IDs are prefixed with the backend ID
+// so requests for a specific process or job can be routed to the backend it belongs to.
+type aggregator struct {
+	engine   *engine.Engine
+	baseURL  string
+	backends []backend
+	client   *http.Client
+}
+
+type processList struct {
+	Processes []map[string]any `json:"processes"`
+	Links     []link           `json:"links"`
+}
+
+type jobList struct {
+	Jobs  []map[string]any `json:"jobs"`
+	Links []link           `json:"links"`
+}
+
+type link struct {
+	Rel   string `json:"rel"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Href  string `json:"href"`
+}
+
+func newAggregator(e *engine.Engine) *aggregator {
+	a := &aggregator{
+		engine:  e,
+		baseURL: strings.TrimSuffix(e.Config.BaseURL.String(), "/"),
+		client:  &http.Client{Timeout: backendTimeout},
+	}
+	for _, b := range e.Config.OgcAPI.Processes.Backends {
+		a.backends = append(a.backends, backend{id: b.ID, url: b.ProcessesServer.URL})
+	}
+	return a
+}
+
+func (a *aggregator) registerRoutes(router chi.Router) {
+	router.Get("/processes", a.processes())
+	router.Handle("/processes/{processId}", a.forward("processes", "processId"))
+	router.Handle("/processes/{processId}/*", a.forward("processes", "processId"))
+	router.Get("/jobs", a.jobs())
+	router.Handle("/jobs/{jobId}", a.forward("jobs", "jobId"))
+	router.Handle("/jobs/{jobId}/*", a.forward("jobs", "jobId"))
+}
+
+// processes lists the processes of all backends. A backend which fails is logged and
+// skipped, so one unavailable backend doesn't break the whole API.
+func (a *aggregator) processes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := processList{
+			Processes: make([]map[string]any, 0),
+			Links:     []link{{Rel: "self", Type: engine.MediaTypeJSON, Title: "This document as JSON", Href: a.baseURL + "/processes"}},
+		}
+		for _, b := range a.backends {
+			var list processList
+			if err := a.getJSON(b, "/processes", r.URL.RawQuery, &list); err != nil {
+				log.Printf("failed to list processes of backend %s: %v", b.id, err)
+				continue
+			}
+			for _, process := range list.Processes {
+				b.prefixIDs(process, "id")
+				result.Processes = append(result.Processes, process)
+			}
+		}
+		a.writeJSON(w, r, result)
+	}
+}
+
+// jobs lists the jobs of all backends, similar to processes
+func (a *aggregator) jobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := jobList{
+			Jobs:  make([]map[string]any, 0),
+			Links: []link{{Rel: "self", Type: engine.MediaTypeJSON, Title: "This document as JSON", Href: a.baseURL + "/jobs"}},
+		}
+		for _, b := range a.backends {
+			var list jobList
+			if err := a.getJSON(b, "/jobs", r.URL.RawQuery, &list); err != nil {
+				log.Printf("failed to list jobs of backend %s: %v", b.id, err)
+				continue
+			}
+			for _, job := range list.Jobs {
+				b.prefixIDs(job, "jobID", "processID")
+				result.Jobs = append(result.Jobs, job)
+			}
+		}
+		a.writeJSON(w, r, result)
+	}
+}
+
+// forward routes the request for a specific process or job to the backend
+// identified by the prefix of the process or job ID in the URL.
+func (a *aggregator) forward(resource string, idParam string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefixedID := chi.URLParam(r, idParam)
+		b, id, ok := a.findBackend(prefixedID)
+		if !ok {
+			engine.RenderError(w, r, engine.NotFound(fmt.Sprintf("%s %s doesn't exist", resource, prefixedID)))
+			return
+		}
+		subPath := strings.TrimPrefix(engine.RelativePath(r), "/"+resource+"/"+prefixedID)
+		target := *b.url
+		target.Path = b.url.Path + "/" + resource + "/" + id + subPath
+		target.RawQuery = r.URL.RawQuery
+
+		// a process description or job status info contains IDs which need a prefix too
+		var idFields []string
+		if subPath == "" && resource == "processes" {
+			idFields = []string{"id"}
+		} else if subPath == "" || subPath == "/execution" {
+			idFields = []string{"jobID", "processID"}
+		}
+		a.proxy(w, r, b, &target, idFields)
+	}
+}
+
+func (a *aggregator) findBackend(prefixedID string) (backend, string, bool) {
+	backendID, id, found := strings.Cut(prefixedID, idSeparator)
+	if !found {
+		return backend{}, "", false
+	}
+	for _, b := range a.backends {
+		if b.id == backendID {
+			return b, id, true
+		}
+	}
+	return backend{}, "", false
+}
+
+// resultsURL the location of the results of the given job on the backend it belongs to
+func (a *aggregator) resultsURL(prefixedJobID string) (*url.URL, bool) {
+	b, id, ok := a.findBackend(prefixedJobID)
+	if !ok {
+		return nil, false
+	}
+	return b.url.JoinPath("jobs", id, "results"), true
+}
+
+func (a *aggregator) proxy(w http.ResponseWriter, r *http.Request, b backend, target *url.URL, idFields []string) {
+	rewrite := func(r *httputil.ProxyRequest) {
+		r.Out.URL = target
+		r.Out.Host = ""   // Don't pass Host header (similar to Traefik's passHostHeader=false)
+		r.SetXForwarded() // Set X-Forwarded-* headers.
+		// leave (de)compression to the transport, since we need to rewrite the response
+		r.Out.Header.Del("Accept-Encoding")
+	}
+	modifyResponse := func(proxyRes *http.Response) error {
+		if location := proxyRes.Header.Get("Location"); location != "" {
+			proxyRes.Header.Set("Location", a.rewriteURLs(b, location))
+		}
+		if !strings.Contains(proxyRes.Header.Get("Content-Type"), "json") {
+			return nil
+		}
+		body, err := io.ReadAll(proxyRes.Body)
+		if err != nil {
+			return err
+		}
+		_ = proxyRes.Body.Close()
+		body = a.rewriteBody(b, body, idFields)
+		proxyRes.Body = io.NopCloser(bytes.NewReader(body))
+		proxyRes.ContentLength = int64(len(body))
+		proxyRes.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+	reverseProxy := &httputil.ReverseProxy{Rewrite: rewrite, ModifyResponse: modifyResponse}
+	reverseProxy.ServeHTTP(w, r)
+}
+
+func (a *aggregator) getJSON(b backend, path string, query string, result any) error {
+	target := *b.url
+	target.Path = b.url.Path + path
+	target.RawQuery = query
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", engine.MediaTypeJSON)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target.String())
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(a.rewriteURLs(b, string(body))), result)
+}
+
+func (a *aggregator) writeJSON(w http.ResponseWriter, r *http.Request, result any) {
+	output, err := json.MarshalIndent(result, "", " ")
+	if err != nil {
+		engine.RenderError(w, r, engine.InternalError("failed to marshal to JSON", err))
+		return
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeJSON)
+	engine.SafeWrite(w.Write, output)
+}
+
+// rewriteBody rewrites the URLs in the given JSON response of the backend and prefixes the
+// given ID fields. A response which isn't a JSON object only gets its URLs rewritten.
+func (a *aggregator) rewriteBody(b backend, body []byte, idFields []string) []byte {
+	body = []byte(a.rewriteURLs(b, string(body)))
+	if len(idFields) == 0 {
+		return body
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+	if !b.prefixIDs(doc, idFields...) {
+		return body
+	}
+	result, err := json.MarshalIndent(doc, "", " ")
+	if err != nil {
+		return body
+	}
+	return result
+}
+
+// rewriteURLs replaces URLs of the backend with URLs of this API, URLs of specific processes
+// and jobs get the backend ID as prefix. Backends which use the X-Forwarded-* headers or the
+// base URL of this API to generate links are supported as well.
+func (a *aggregator) rewriteURLs(b backend, content string) string {
+	backendURL := strings.TrimSuffix(b.url.String(), "/")
+	prefix := b.id + idSeparator
+	return strings.NewReplacer(
+		backendURL+"/processes/", a.baseURL+"/processes/"+prefix,
+		backendURL+"/jobs/", a.baseURL+"/jobs/"+prefix,
+		a.baseURL+"/processes/", a.baseURL+"/processes/"+prefix,
+		a.baseURL+"/jobs/", a.baseURL+"/jobs/"+prefix,
+		backendURL, a.baseURL,
+	).Replace(content)
+}
+
+// prefixIDs prefixes the given ID fields of the given process or job with the backend ID,
+// returns true when at least one field was prefixed.
+func (b backend) prefixIDs(doc map[string]any, fields ...string) bool {
+	prefixed := false
+	for _, field := range fields {
+		if id, ok := doc[field].(string); ok {
+			doc[field] = b.id + idSeparator + id
+			prefixed = true
+		}
+	}
+	return prefixed
+}
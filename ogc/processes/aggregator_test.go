@@ -0,0 +1,196 @@
+package processes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func init() {
+	// change working dir to root, to mimic behavior of 'go run' in order to resolve template files.
+	_, filename, _, _ := runtime.Caller(0)
+	dir := path.Join(path.Dir(filename), "../../")
+	err := os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// newBackend mimics an upstream processes server with a single process and job
+func newBackend(processID string, jobID string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", engine.MediaTypeJSON)
+		switch r.URL.Path {
+		case "/ogcapi/processes":
+			engine.SafeWrite(w.Write, []byte(`{"processes": [{"id": "`+processID+`", "version": "1.0.0", "links": [{"href": "`+ts.URL+`/ogcapi/processes/`+processID+`", "rel": "self"}]}], "links": []}`))
+		case "/ogcapi/processes/" + processID:
+			engine.SafeWrite(w.Write, []byte(`{"id": "`+processID+`", "version": "1.0.0", "links": [{"href": "`+ts.URL+`/ogcapi/processes/`+processID+`/execution", "rel": "execute"}]}`))
+		case "/ogcapi/processes/" + processID + "/execution":
+			w.Header().Set("Location", ts.URL+"/ogcapi/jobs/"+jobID)
+			w.WriteHeader(http.StatusCreated)
+			engine.SafeWrite(w.Write, []byte(`{"jobID": "`+jobID+`", "processID": "`+processID+`", "status": "accepted", "type": "process"}`))
+		case "/ogcapi/jobs":
+			engine.SafeWrite(w.Write, []byte(`{"jobs": [{"jobID": "`+jobID+`", "processID": "`+processID+`", "status": "running", "type": "process"}], "links": []}`))
+		case "/ogcapi/jobs/" + jobID + "/results":
+			engine.SafeWrite(w.Write, []byte(`{"id": "result", "value": 42}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return ts
+}
+
+func newAggregatedProcesses(backends ...*httptest.Server) *chi.Mux {
+	router := chi.NewRouter()
+	NewProcesses(newAggregatedEngine(backends...), router)
+	return router
+}
+
+func newAggregatedEngine(backends ...*httptest.Server) *engine.Engine {
+	var config []engine.ProcessesBackend
+	for i, ts := range backends {
+		backendURL, _ := url.Parse(ts.URL + "/ogcapi")
+		config = append(config, engine.ProcessesBackend{ID: []string{"vector", "raster"}[i], ProcessesServer: engine.YAMLURL{URL: backendURL}})
+	}
+	return engine.NewEngineWithConfig(&engine.Config{
+		Version:            "0.4.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.English},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example"}},
+		OgcAPI: engine.OgcAPI{
+			Processes: &engine.OgcAPIProcesses{Backends: config},
+		},
+	}, "")
+}
+
+func TestAggregator_lists(t *testing.T) {
+	vector := newBackend("buffer", "1")
+	defer vector.Close()
+	raster := newBackend("hillshade", "2")
+	defer raster.Close()
+	unavailable := httptest.NewServer(http.NotFoundHandler())
+	defer unavailable.Close()
+
+	router := newAggregatedProcesses(vector, raster)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/processes", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var processes processList
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processes))
+	assert.Len(t, processes.Processes, 2)
+	assert.Equal(t, "vector.buffer", processes.Processes[0]["id"])
+	assert.Equal(t, "raster.hillshade", processes.Processes[1]["id"])
+	assert.Contains(t, rr.Body.String(), `"href": "https://api.foobar.example/processes/vector.buffer"`)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var jobs jobList
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jobs))
+	assert.Len(t, jobs.Jobs, 2)
+	assert.Equal(t, "vector.1", jobs.Jobs[0]["jobID"])
+	assert.Equal(t, "raster.hillshade", jobs.Jobs[1]["processID"])
+
+	// unavailable backend is skipped
+	router = newAggregatedProcesses(vector, unavailable)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/processes", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &processes))
+	assert.Len(t, processes.Processes, 1)
+}
+
+func TestAggregator_forward(t *testing.T) {
+	vector := newBackend("buffer", "1")
+	defer vector.Close()
+	raster := newBackend("hillshade", "2")
+	defer raster.Close()
+
+	router := newAggregatedProcesses(vector, raster)
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		wantStatus   int
+		wantBody     []string
+		wantLocation string
+	}{
+		{
+			name:       "process description",
+			method:     http.MethodGet,
+			url:        "/processes/raster.hillshade",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"id": "raster.hillshade"`, `"href": "https://api.foobar.example/processes/raster.hillshade/execution"`},
+		},
+		{
+			name:         "execute process",
+			method:       http.MethodPost,
+			url:          "/processes/vector.buffer/execution",
+			wantStatus:   http.StatusCreated,
+			wantBody:     []string{`"jobID": "vector.1"`, `"processID": "vector.buffer"`},
+			wantLocation: "https://api.foobar.example/jobs/vector.1",
+		},
+		{
+			name:       "job results",
+			method:     http.MethodGet,
+			url:        "/jobs/raster.2/results",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`"id": "result"`},
+		},
+		{
+			name:       "unknown backend",
+			method:     http.MethodGet,
+			url:        "/processes/other.buffer",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "without backend prefix",
+			method:     http.MethodGet,
+			url:        "/processes/buffer",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, strings.NewReader("{}")))
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			for _, want := range tt.wantBody {
+				assert.Contains(t, rr.Body.String(), want)
+			}
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestAggregator_forwardMountedUnderPrefix(t *testing.T) {
+	vector := newBackend("buffer", "1")
+	defer vector.Close()
+	raster := newBackend("hillshade", "2")
+	defer raster.Close()
+
+	router := chi.NewRouter()
+	router.Route("/some/prefix", func(r chi.Router) {
+		NewProcesses(newAggregatedEngine(vector, raster), r)
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/some/prefix/jobs/raster.2/results", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"id": "result"`)
+}
@@ -2,28 +2,51 @@ package processes
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/PDOK/gokoala/engine"
 
 	"github.com/go-chi/chi/v5"
 )
 
+const executionPath = "/processes/{processId}/execution"
+
 type Processes struct {
 	engine *engine.Engine
 }
 
-func NewProcesses(e *engine.Engine, router *chi.Mux) *Processes {
+func NewProcesses(e *engine.Engine, router chi.Router) *Processes {
 	processes := &Processes{engine: e}
-	router.Handle("/jobs*", processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer))
-	router.Handle("/processes*", processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer))
-	router.Handle("/api*", processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer))
+
+	var execute http.HandlerFunc
+	var resultsURL func(jobID string) (*url.URL, bool)
+	if len(e.Config.OgcAPI.Processes.Backends) > 0 {
+		aggregator := newAggregator(e)
+		aggregator.registerRoutes(router)
+		execute = aggregator.forward("processes", "processId")
+		resultsURL = aggregator.resultsURL
+	} else {
+		router.Handle("/jobs*", processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer))
+		router.Handle("/processes*", processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer))
+		router.Handle("/api*", processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer))
+		execute = processes.forwarder(e.Config.OgcAPI.Processes.ProcessesServer)
+		resultsURL = func(jobID string) (*url.URL, bool) {
+			return e.Config.OgcAPI.Processes.ProcessesServer.JoinPath("jobs", jobID, "results"), true
+		}
+	}
+	if e.Config.OgcAPI.Processes.Staging != nil {
+		router.With(newStager(e, router).middleware).Post(executionPath, execute)
+	}
+	if e.Config.OgcAPI.Processes.ResultsStorage != nil {
+		router.Get(resultsPath, newResultsStore(e, resultsURL).results())
+	}
 	return processes
 }
 
 func (p *Processes) forwarder(processServer engine.YAMLURL) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		targetURL := *processServer.URL
-		targetURL.Path = processServer.URL.Path + r.URL.Path
+		targetURL.Path = processServer.URL.Path + engine.RelativePath(r)
 		targetURL.RawQuery = r.URL.RawQuery
 		p.engine.ReverseProxy(w, r, &targetURL, false, "")
 	}
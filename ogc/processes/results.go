@@ -0,0 +1,198 @@
+package processes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	resultsPath         = "/jobs/{jobId}/results"
+	resultsManifestName = "results.json"
+	rawResultName       = "result"
+	resultsTimeout      = 5 * time.Minute
+)
+
+// resultsStore persists the results of jobs in object storage on first request. Subsequent requests
+// are served from object storage. Either way, clients receive time-limited signed links to the stored
+// results instead of the results themselves, so large outputs don't go through this API.
+type resultsStore struct {
+	storage engine.ObjectStore
+	expiry  time.Duration
+	client  *http.Client
+
+	// location of the results of the given job on the processes server
+	resultsURL func(jobID string) (*url.URL, bool)
+}
+
+// storedResult a single output of a job, as stored in the manifest of a job
+type storedResult struct {
+	Blob      string `json:"blob"`
+	MediaType string `json:"mediaType"`
+}
+
+type resultLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+func newResultsStore(e *engine.Engine, resultsURL func(jobID string) (*url.URL, bool)) *resultsStore {
+	config := e.Config.OgcAPI.Processes.ResultsStorage
+	storage, err := engine.NewObjectStore(&config.ObjectStorage)
+	if err != nil {
+		log.Fatalf("failed to configure object storage for job results: %v", err)
+	}
+	return &resultsStore{
+		storage:    storage,
+		expiry:     config.GetLinkExpiry(),
+		client:     &http.Client{Timeout: resultsTimeout},
+		resultsURL: resultsURL,
+	}
+}
+
+func (s *resultsStore) results() http.HandlerFunc {
+	return engine.HandleErrors(func(w http.ResponseWriter, r *http.Request) error {
+		jobID := chi.URLParam(r, "jobId")
+		manifest, err := s.manifest(r.Context(), jobID)
+		if err != nil {
+			return engine.UpstreamUnavailable("failed to retrieve job results", fmt.Errorf("job %s: %w", jobID, err))
+		}
+		if manifest == nil {
+			source, ok := s.resultsURL(jobID)
+			if !ok {
+				return engine.NotFound(fmt.Sprintf("job %s doesn't exist", jobID))
+			}
+			resp, err := s.client.Get(source.String())
+			if err != nil {
+				return engine.UpstreamUnavailable("failed to retrieve job results", fmt.Errorf("job %s: %w", jobID, err))
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				// e.g. job not finished (yet), pass through the response of the processes server
+				w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+				w.WriteHeader(resp.StatusCode)
+				_, _ = io.Copy(w, resp.Body)
+				return nil
+			}
+			if manifest, err = s.store(r.Context(), jobID, resp); err != nil {
+				return engine.UpstreamUnavailable("failed to store job results", fmt.Errorf("job %s: %w", jobID, err))
+			}
+		}
+
+		links := make(map[string]resultLink, len(manifest))
+		for name, result := range manifest {
+			href, err := s.storage.SignedURL(result.Blob, s.expiry)
+			if err != nil {
+				return engine.InternalError("failed to link to job results", err)
+			}
+			links[name] = resultLink{Href: href, Type: result.MediaType}
+		}
+		output, err := json.MarshalIndent(links, "", " ")
+		if err != nil {
+			return engine.InternalError("failed to marshal job results to JSON", err)
+		}
+		w.Header().Set("Content-Type", engine.MediaTypeJSON)
+		engine.SafeWrite(w.Write, output)
+		return nil
+	})
+}
+
+// manifest returns the previously stored results of the given job, or nil when there are none
+func (s *resultsStore) manifest(ctx context.Context, jobID string) (map[string]storedResult, error) {
+	object, err := s.storage.Get(ctx, jobID+"/"+resultsManifestName, "")
+	if errors.Is(err, engine.ErrObjectNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var manifest map[string]storedResult
+	err = json.Unmarshal(object.Content, &manifest)
+	return manifest, err
+}
+
+// store uploads each output of the given results to object storage, followed by the manifest
+// of the job which marks the results as stored. Results which aren't a (JSON) results document
+// are stored as a single output.
+func (s *resultsStore) store(ctx context.Context, jobID string, resp *http.Response) (map[string]storedResult, error) {
+	manifest := make(map[string]storedResult)
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "json") {
+		blob := jobID + "/" + rawResultName
+		if err := s.storage.Put(ctx, blob, contentType, resp.Body, resp.ContentLength); err != nil {
+			return nil, err
+		}
+		manifest[rawResultName] = storedResult{Blob: blob, MediaType: contentType}
+	} else {
+		var results map[string]json.RawMessage
+		if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+			return nil, fmt.Errorf("invalid results document: %w", err)
+		}
+		for name, output := range results {
+			result, err := s.storeOutput(ctx, jobID+"/"+name, output)
+			if err != nil {
+				return nil, err
+			}
+			manifest[name] = result
+		}
+	}
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	err = s.storage.Put(ctx, jobID+"/"+resultsManifestName, engine.MediaTypeJSON, bytes.NewReader(content), int64(len(content)))
+	return manifest, err
+}
+
+// storeOutput stores a single output of a results document, which is either a link to the
+// actual output, a qualified value (value + media type) or a plain value.
+func (s *resultsStore) storeOutput(ctx context.Context, blob string, output json.RawMessage) (storedResult, error) {
+	var qualified struct {
+		Href      string          `json:"href"`
+		Type      string          `json:"type"`
+		Value     json.RawMessage `json:"value"`
+		MediaType string          `json:"mediaType"`
+	}
+	_ = json.Unmarshal(output, &qualified) // plain values (e.g. a number) aren't qualified, that's fine
+	switch {
+	case qualified.Href != "":
+		resp, err := s.client.Get(qualified.Href)
+		if err != nil {
+			return storedResult{}, fmt.Errorf("failed to retrieve output %s: %w", blob, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return storedResult{}, fmt.Errorf("unexpected status %d while retrieving output %s", resp.StatusCode, blob)
+		}
+		mediaType := qualified.Type
+		if mediaType == "" {
+			mediaType = resp.Header.Get("Content-Type")
+		}
+		return storedResult{Blob: blob, MediaType: mediaType}, s.storage.Put(ctx, blob, mediaType, resp.Body, resp.ContentLength)
+	case qualified.Value != nil:
+		content := []byte(qualified.Value)
+		var text string
+		if json.Unmarshal(qualified.Value, &text) == nil {
+			content = []byte(text) // e.g. XML or CSV as string
+		}
+		mediaType := qualified.MediaType
+		if mediaType == "" {
+			mediaType = engine.MediaTypeJSON
+		}
+		return storedResult{Blob: blob, MediaType: mediaType}, s.storage.Put(ctx, blob, mediaType, bytes.NewReader(content), int64(len(content)))
+	default:
+		return storedResult{Blob: blob, MediaType: engine.MediaTypeJSON}, s.storage.Put(ctx, blob, engine.MediaTypeJSON, bytes.NewReader(output), int64(len(output)))
+	}
+}
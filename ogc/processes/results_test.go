@@ -0,0 +1,131 @@
+package processes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+const azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+// fakeBlobStorage mimics Azure Blob Storage (Azurite), without verifying signatures
+type fakeBlobStorage struct {
+	mu    sync.Mutex
+	blobs map[string]string
+	types map[string]string
+}
+
+func (f *fakeBlobStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Query().Get("sig") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.blobs[r.URL.Path] = string(body)
+		f.types[r.URL.Path] = r.Header.Get("x-ms-blob-content-type")
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		blob, ok := f.blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		engine.SafeWrite(w.Write, []byte(blob))
+	}
+}
+
+func TestResultsStore_results(t *testing.T) {
+	blobs := &fakeBlobStorage{blobs: make(map[string]string), types: make(map[string]string)}
+	blobServer := httptest.NewServer(blobs)
+	defer blobServer.Close()
+
+	var processesServer *httptest.Server
+	resultsRequests := 0
+	processesServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/jobs/done/results":
+			resultsRequests++
+			w.Header().Set("Content-Type", engine.MediaTypeJSON)
+			engine.SafeWrite(w.Write, []byte(`{
+				"count": 42,
+				"buffered": {"value": {"type": "FeatureCollection", "features": []}, "mediaType": "application/geo+json"},
+				"report": {"href": "`+processesServer.URL+`/files/report.csv", "type": "text/csv"}
+			}`))
+		case "/files/report.csv":
+			engine.SafeWrite(w.Write, []byte("a,b\n1,2\n"))
+		case "/jobs/running/results":
+			w.Header().Set("Content-Type", engine.MediaTypeJSON)
+			w.WriteHeader(http.StatusNotFound)
+			engine.SafeWrite(w.Write, []byte(`{"type": "http://www.opengis.net/def/exceptions/ogcapi-processes-1/1.0/result-not-ready"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer processesServer.Close()
+
+	processesServerURL, _ := url.Parse(processesServer.URL)
+	blobServerURL, _ := url.Parse(blobServer.URL + "/devstoreaccount1")
+	e := engine.NewEngineWithConfig(&engine.Config{
+		Version:            "0.4.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.English},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example"}},
+		OgcAPI: engine.OgcAPI{
+			Processes: &engine.OgcAPIProcesses{
+				ProcessesServer: engine.YAMLURL{URL: processesServerURL},
+				ResultsStorage: &engine.ProcessesResultsStorage{
+					ObjectStorage: engine.ObjectStorage{
+						Type:      engine.ObjectStorageAzure,
+						URL:       &engine.YAMLURL{URL: blobServerURL},
+						User:      "devstoreaccount1",
+						Auth:      azuriteKey,
+						Container: "results",
+					},
+				},
+			},
+		},
+	}, "")
+	router := chi.NewRouter()
+	NewProcesses(e, router)
+
+	// first request stores the results, second request is served from storage
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/done/results", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var links map[string]resultLink
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &links))
+		assert.Len(t, links, 3)
+		assert.Equal(t, "text/csv", links["report"].Type)
+		assert.Equal(t, engine.MediaTypeGeoJSON, links["buffered"].Type)
+		assert.True(t, strings.HasPrefix(links["count"].Href, blobServer.URL+"/devstoreaccount1/results/done/count?"))
+		assert.Contains(t, links["count"].Href, "sp=r")
+	}
+	assert.Equal(t, 1, resultsRequests)
+	assert.Equal(t, "42", blobs.blobs["/devstoreaccount1/results/done/count"])
+	assert.Equal(t, "a,b\n1,2\n", blobs.blobs["/devstoreaccount1/results/done/report"])
+	assert.Equal(t, `{"type": "FeatureCollection", "features": []}`, blobs.blobs["/devstoreaccount1/results/done/buffered"])
+	assert.Equal(t, engine.MediaTypeGeoJSON, blobs.types["/devstoreaccount1/results/done/buffered"])
+
+	// results not ready, pass through response of processes server
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/running/results", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), "result-not-ready")
+}
@@ -0,0 +1,180 @@
+package processes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+var collectionItemsRegex = regexp.MustCompile(`^/collections/([^/]+)(/items)?$`)
+
+// stager stages features of collections in this API which are referenced as process input. The features
+// are retrieved by requesting the Features API in-process, so filters like bbox, datetime or
+// properties in the referenced URL are honored.
+type stager struct {
+	baseURL     string
+	handler     http.Handler
+	maxFeatures int
+}
+
+type featureCollection struct {
+	Features []json.RawMessage `json:"features"`
+	Links    []link            `json:"links"`
+}
+
+func newStager(e *engine.Engine, handler http.Handler) *stager {
+	return &stager{
+		baseURL:     strings.TrimSuffix(e.Config.BaseURL.String(), "/"),
+		handler:     handler,
+		maxFeatures: e.Config.OgcAPI.Processes.Staging.GetMaxFeatures(),
+	}
+}
+
+// middleware stages the inputs of the execute request before handing it to the next handler
+func (s *stager) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			engine.RenderError(w, r, engine.BadRequest("failed to read execute request"))
+			return
+		}
+		staged, err := s.stage(body)
+		if err != nil {
+			engine.RenderError(w, r, engine.BadRequest(err.Error()))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(staged))
+		r.ContentLength = int64(len(staged))
+		r.Header.Set("Content-Length", strconv.Itoa(len(staged)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stage replaces references to collections of this API in the inputs of the given execute request
+// by the actual features, as a GeoJSON FeatureCollection. Other inputs are left untouched, as is the
+// request when it isn't valid JSON (in which case the processes server will reject it).
+func (s *stager) stage(executeRequest []byte) ([]byte, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(executeRequest, &request); err != nil {
+		return executeRequest, nil
+	}
+	var inputs map[string]any
+	if err := json.Unmarshal(request["inputs"], &inputs); err != nil {
+		return executeRequest, nil
+	}
+	staged := false
+	for name, input := range inputs {
+		result, changed, err := s.stageInput(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stage input %s: %w", name, err)
+		}
+		if changed {
+			inputs[name] = result
+			staged = true
+		}
+	}
+	if !staged {
+		return executeRequest, nil
+	}
+	var err error
+	if request["inputs"], err = json.Marshal(inputs); err != nil {
+		return nil, err
+	}
+	return json.Marshal(request)
+}
+
+// stageInput stages a single input, which can also be an array of inputs
+func (s *stager) stageInput(input any) (any, bool, error) {
+	switch value := input.(type) {
+	case []any:
+		changed := false
+		for i, item := range value {
+			result, itemChanged, err := s.stageInput(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemChanged {
+				value[i] = result
+				changed = true
+			}
+		}
+		return value, changed, nil
+	case map[string]any:
+		href, ok := value["href"].(string)
+		if !ok {
+			return input, false, nil
+		}
+		path, ok := s.collectionItemsPath(href)
+		if !ok {
+			return input, false, nil
+		}
+		features, err := s.fetchFeatures(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return map[string]any{
+			"value":     map[string]any{"type": "FeatureCollection", "features": features},
+			"mediaType": engine.MediaTypeGeoJSON,
+		}, true, nil
+	default:
+		return input, false, nil
+	}
+}
+
+// collectionItemsPath returns the (relative) path to the features of the collection referenced by the
+// given href, including the query string. Returns false when the href doesn't reference a collection of this API.
+func (s *stager) collectionItemsPath(href string) (string, bool) {
+	if strings.HasPrefix(href, s.baseURL+"/") {
+		href = strings.TrimPrefix(href, s.baseURL)
+	} else if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return "", false
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	matches := collectionItemsRegex.FindStringSubmatch(ref.Path)
+	if matches == nil {
+		return "", false
+	}
+	query := ref.Query()
+	query.Set(engine.FormatParam, engine.FormatJSON)
+	return "/collections/" + matches[1] + "/items?" + query.Encode(), true
+}
+
+// fetchFeatures retrieves the features at the given path, following the next links up to the max number of features
+func (s *stager) fetchFeatures(path string) ([]json.RawMessage, error) {
+	features := make([]json.RawMessage, 0)
+	for path != "" {
+		rr := httptest.NewRecorder()
+		s.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			return nil, fmt.Errorf("request for features failed with status %d: %s", rr.Code, strings.TrimSpace(rr.Body.String()))
+		}
+		var fc featureCollection
+		if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+			return nil, fmt.Errorf("failed to parse features: %w", err)
+		}
+		features = append(features, fc.Features...)
+		if len(features) > s.maxFeatures {
+			return nil, errors.New("too many features to stage, use a more selective filter (e.g. bbox)")
+		}
+		path = ""
+		for _, l := range fc.Links {
+			if l.Rel == "next" {
+				path = strings.TrimPrefix(l.Href, s.baseURL)
+			}
+		}
+	}
+	return features, nil
+}
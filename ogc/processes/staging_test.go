@@ -0,0 +1,123 @@
+package processes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+// fakeFeatures serves two pages of features for collection "buildings"
+func fakeFeatures(w http.ResponseWriter, r *http.Request) {
+	if chi.URLParam(r, "collectionId") != "buildings" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", engine.MediaTypeGeoJSON)
+	if r.URL.Query().Get("cursor") == "" {
+		engine.SafeWrite(w.Write, []byte(`{"type": "FeatureCollection", "features": [{"type": "Feature", "id": 1, "properties": {"bbox": "`+r.URL.Query().Get("bbox")+`"}, "geometry": null}], "links": [{"rel": "next", "href": "https://api.foobar.example/collections/buildings/items?cursor=2&f=json"}]}`))
+		return
+	}
+	engine.SafeWrite(w.Write, []byte(`{"type": "FeatureCollection", "features": [{"type": "Feature", "id": 2, "properties": {}, "geometry": null}], "links": []}`))
+}
+
+func TestStager_stage(t *testing.T) {
+	router := chi.NewRouter()
+	router.Get("/collections/{collectionId}/items", fakeFeatures)
+	s := &stager{baseURL: "https://api.foobar.example", handler: router, maxFeatures: 10}
+
+	tests := []struct {
+		name    string
+		request string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "collection referenced with absolute URL, including bbox",
+			request: `{"inputs": {"geom": {"href": "https://api.foobar.example/collections/buildings/items?bbox=1,2,3,4"}, "distance": 10}}`,
+			want:    []string{`"mediaType":"application/geo+json"`, `"id":1`, `"id":2`, `"bbox":"1,2,3,4"`, `"distance":10`},
+		},
+		{
+			name:    "collection referenced with relative URL, in array of inputs",
+			request: `{"inputs": {"geoms": [{"href": "/collections/buildings"}, {"value": "other"}]}}`,
+			want:    []string{`"mediaType":"application/geo+json"`, `"id":2`, `{"value":"other"}`},
+		},
+		{
+			name:    "other URLs are left untouched",
+			request: `{"inputs": {"geom": {"href": "https://example.com/collections/buildings/items"}}}`,
+			want:    []string{`{"inputs": {"geom": {"href": "https://example.com/collections/buildings/items"}}}`},
+		},
+		{
+			name:    "unknown collection",
+			request: `{"inputs": {"geom": {"href": "/collections/roads/items"}}}`,
+			wantErr: "failed to stage input geom: request for features failed with status 404",
+		},
+		{
+			name:    "invalid request is passed as-is",
+			request: `not json`,
+			want:    []string{`not json`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.stage([]byte(tt.request))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, string(got), want)
+			}
+		})
+	}
+
+	s.maxFeatures = 1
+	_, err := s.stage([]byte(`{"inputs": {"geom": {"href": "/collections/buildings/items"}}}`))
+	assert.ErrorContains(t, err, "too many features to stage")
+}
+
+func TestNewProcesses_staging(t *testing.T) {
+	var executeRequest string
+	processesServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		executeRequest = string(body)
+	}))
+	defer processesServer.Close()
+	processesServerURL, _ := url.Parse(processesServer.URL)
+
+	e := engine.NewEngineWithConfig(&engine.Config{
+		Version:            "0.4.0",
+		Title:              "Test API",
+		Abstract:           "Test API description",
+		AvailableLanguages: []language.Tag{language.English},
+		BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example"}},
+		OgcAPI: engine.OgcAPI{
+			Processes: &engine.OgcAPIProcesses{
+				ProcessesServer: engine.YAMLURL{URL: processesServerURL},
+				Staging:         &engine.ProcessesStaging{},
+			},
+		},
+	}, "")
+	router := chi.NewRouter()
+	router.Get("/collections/{collectionId}/items", fakeFeatures)
+	NewProcesses(e, router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/processes/buffer/execution",
+		strings.NewReader(`{"inputs": {"geom": {"href": "/collections/buildings/items"}}}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, executeRequest, `"type":"FeatureCollection"`)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/processes/buffer/execution",
+		strings.NewReader(`{"inputs": {"geom": {"href": "/collections/roads/items"}}}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,30 @@
+package styles
+
+import "encoding/json"
+
+// addAttribution sets the given attribution on all sources of the given Mapbox style which don't
+// have an attribution of their own. This way maps based on the style show the attribution.
+func addAttribution(style []byte, attribution string) ([]byte, error) {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal(style, &parsed); err != nil {
+		return nil, err
+	}
+	rawSources, ok := parsed["sources"]
+	if !ok {
+		return style, nil
+	}
+	var sources map[string]map[string]any
+	if err := json.Unmarshal(rawSources, &sources); err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		if _, ok = source["attribution"]; !ok {
+			source["attribution"] = attribution
+		}
+	}
+	var err error
+	if parsed["sources"], err = json.Marshal(sources); err != nil {
+		return nil, err
+	}
+	return json.Marshal(parsed)
+}
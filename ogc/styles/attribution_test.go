@@ -0,0 +1,33 @@
+package styles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddAttribution(t *testing.T) {
+	tests := []struct {
+		name  string
+		style string
+		want  string
+	}{
+		{
+			name:  "add to sources without attribution",
+			style: `{"version":8,"sources":{"a":{"type":"vector"},"b":{"type":"vector","attribution":"own"}},"layers":[]}`,
+			want:  `{"version":8,"sources":{"a":{"type":"vector","attribution":"dataset"},"b":{"type":"vector","attribution":"own"}},"layers":[]}`,
+		},
+		{
+			name:  "style without sources",
+			style: `{"version":8,"layers":[]}`,
+			want:  `{"version":8,"layers":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addAttribution([]byte(tt.style), "dataset")
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
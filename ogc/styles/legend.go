@@ -0,0 +1,222 @@
+package styles
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const (
+	formatSVG = "svg"
+
+	legendDefaultColor  = "#808080"
+	legendMaxLineWidth  = 6
+	legendMaxRadius     = 8
+	legendDefaultRadius = 5
+	legendRowHeight     = 24
+	legendPadding       = 8
+)
+
+// Legend auto-generated legend of a Mapbox style, see parseLegend
+type Legend struct {
+	StyleID string
+	Title   string
+	Items   []LegendItem
+}
+
+// LegendItem a single entry (symbol plus label) in the legend
+type LegendItem struct {
+	Title       string
+	Kind        string // fill, line, circle, text or icon
+	Color       string
+	StrokeColor string
+	Opacity     float64
+	Width       float64 // line width or circle radius
+}
+
+// Height of the legend (in pixels) when rendered as an image
+func (l Legend) Height() int {
+	return len(l.Items)*legendRowHeight + legendPadding
+}
+
+// Offset the y-coordinate of the row for the legend item at the given index
+func (l Legend) Offset(index int) int {
+	return index*legendRowHeight + legendPadding
+}
+
+// renderLegend generates the legend from the given (rendered) Mapbox style. The style is the
+// same in all languages, so we derive the legend from the first rendered style we come across.
+func renderLegend(e *engine.Engine, style engine.StyleMetadata, styleTitle string, stylePath string, styleKey engine.TemplateKey) error {
+	var mapboxStyle []byte
+	for _, lang := range e.Config.AvailableLanguages {
+		if rendered, err := e.Templates.GetRenderedTemplate(engine.ExpandTemplateKey(styleKey, lang)); err == nil {
+			mapboxStyle = rendered
+			break
+		}
+	}
+	if mapboxStyle == nil {
+		return nil
+	}
+	legend, err := parseLegend(style.ID, styleTitle, mapboxStyle)
+	if err != nil {
+		return fmt.Errorf("failed to generate legend for style %s: %w", style.ID, err)
+	}
+	e.RenderTemplatesWithParams(legend,
+		nil,
+		engine.NewTemplateKeyWithName(templatesDir+"legend.go."+formatSVG, style.ID))
+	e.RenderTemplatesWithParams(legend,
+		e.Breadcrumbs(stylePath+"/legend"),
+		engine.NewTemplateKeyWithName(templatesDir+"legend.go.html", style.ID))
+	return nil
+}
+
+type mapboxStyle struct {
+	Layers []mapboxLayer `json:"layers"`
+}
+
+type mapboxLayer struct {
+	ID          string         `json:"id"`
+	Type        string         `json:"type"`
+	SourceLayer string         `json:"source-layer"`
+	Paint       map[string]any `json:"paint"`
+	Layout      map[string]any `json:"layout"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+// parseLegend derives a legend from the layers of the given Mapbox style. Every (visible) fill,
+// line, circle and symbol layer results in a legend item, data-driven colors (stops) result
+// in an item per stop. Raster, hillshade and background layers are skipped since they have no
+// meaningful representation in a legend.
+func parseLegend(styleID string, title string, style []byte) (*Legend, error) {
+	var parsed mapboxStyle
+	if err := json.Unmarshal(style, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse Mapbox style: %w", err)
+	}
+	legend := &Legend{StyleID: styleID, Title: title}
+	for _, layer := range parsed.Layers {
+		if visibility, ok := layer.Layout["visibility"]; ok && visibility == "none" {
+			continue
+		}
+		for _, item := range legendItems(layer) {
+			if !legend.contains(item.Title) {
+				legend.Items = append(legend.Items, item)
+			}
+		}
+	}
+	return legend, nil
+}
+
+func (l *Legend) contains(title string) bool {
+	for _, item := range l.Items {
+		if item.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+func legendItems(layer mapboxLayer) []LegendItem {
+	item := LegendItem{Title: legendTitle(layer), Kind: layer.Type, Opacity: 1}
+	var colorProperty string
+	switch layer.Type {
+	case "fill":
+		colorProperty = "fill-color"
+		item.StrokeColor = color(layer.Paint["fill-outline-color"], "")
+		item.Opacity = number(layer.Paint["fill-opacity"], 1)
+	case "line":
+		colorProperty = "line-color"
+		item.Width = min(number(layer.Paint["line-width"], 1), legendMaxLineWidth)
+		item.Opacity = number(layer.Paint["line-opacity"], 1)
+	case "circle":
+		colorProperty = "circle-color"
+		item.StrokeColor = color(layer.Paint["circle-stroke-color"], "")
+		item.Width = min(number(layer.Paint["circle-radius"], legendDefaultRadius), legendMaxRadius)
+		item.Opacity = number(layer.Paint["circle-opacity"], 1)
+	case "symbol":
+		if _, ok := layer.Layout["icon-image"]; ok {
+			item.Kind = "icon"
+			colorProperty = "icon-color"
+		} else if _, ok = layer.Layout["text-field"]; ok {
+			item.Kind = "text"
+			colorProperty = "text-color"
+		} else {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	paint := layer.Paint[colorProperty]
+	if stops, ok := colorStops(paint); ok {
+		items := make([]LegendItem, 0, len(stops))
+		for _, stop := range stops {
+			stopItem := item
+			stopItem.Title = stop[0]
+			stopItem.Color = stop[1]
+			items = append(items, stopItem)
+		}
+		return items
+	}
+	item.Color = color(paint, legendDefaultColor)
+	return []LegendItem{item}
+}
+
+// legendTitle the title of the layer in the legend: the "title" from the layer metadata
+// when available, otherwise the (humanized) source layer or layer id.
+func legendTitle(layer mapboxLayer) string {
+	if title, ok := layer.Metadata["title"].(string); ok && title != "" {
+		return title
+	}
+	title := layer.SourceLayer
+	if title == "" {
+		title = layer.ID
+	}
+	if title == "" {
+		return title
+	}
+	title = strings.NewReplacer("_", " ", "-", " ").Replace(title)
+	r, size := utf8.DecodeRuneInString(title)
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+// colorStops returns the (value, color) pairs of a legacy Mapbox function with stops,
+// e.g. {"property": "type", "type": "categorical", "stops": [["a", "#fff"], ["b", "#000"]]}
+func colorStops(paint any) ([][2]string, bool) {
+	function, ok := paint.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	rawStops, ok := function["stops"].([]any)
+	if !ok {
+		return nil, false
+	}
+	var stops [][2]string
+	for _, rawStop := range rawStops {
+		stop, ok := rawStop.([]any)
+		if !ok || len(stop) != 2 {
+			continue
+		}
+		stops = append(stops, [2]string{fmt.Sprint(stop[0]), color(stop[1], legendDefaultColor)})
+	}
+	return stops, len(stops) > 0
+}
+
+// color returns the given paint value when it's a plain color, or the fallback when it's
+// something else, like an expression which can't be evaluated without actual features.
+func color(paint any, fallback string) string {
+	if c, ok := paint.(string); ok && c != "" {
+		return c
+	}
+	return fallback
+}
+
+func number(paint any, fallback float64) float64 {
+	if n, ok := paint.(float64); ok {
+		return n
+	}
+	return fallback
+}
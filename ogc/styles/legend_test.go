@@ -0,0 +1,70 @@
+package styles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLegend(t *testing.T) {
+	tests := []struct {
+		name  string
+		style string
+		want  []LegendItem
+	}{
+		{
+			name: "fill with outline",
+			style: `{"layers": [{"id": "water", "type": "fill", "source-layer": "waterdeel_vlak",
+				"paint": {"fill-color": "#9cc8f0", "fill-outline-color": "#5a8fc0", "fill-opacity": 0.5}}]}`,
+			want: []LegendItem{{Title: "Waterdeel vlak", Kind: "fill", Color: "#9cc8f0", StrokeColor: "#5a8fc0", Opacity: 0.5}},
+		},
+		{
+			name: "line with stops and capped width",
+			style: `{"layers": [{"id": "roads", "type": "line", "source-layer": "wegdeel", "paint": {"line-width": 20,
+				"line-color": {"property": "type", "type": "categorical", "stops": [["rijbaan", "#c00"], ["fietspad", "#0a0"]]}}}]}`,
+			want: []LegendItem{
+				{Title: "rijbaan", Kind: "line", Color: "#c00", Opacity: 1, Width: legendMaxLineWidth},
+				{Title: "fietspad", Kind: "line", Color: "#0a0", Opacity: 1, Width: legendMaxLineWidth},
+			},
+		},
+		{
+			name: "circle with expression as color",
+			style: `{"layers": [{"id": "trees", "type": "circle",
+				"paint": {"circle-color": ["get", "color"], "circle-stroke-color": "#000"}}]}`,
+			want: []LegendItem{{Title: "Trees", Kind: "circle", Color: legendDefaultColor, StrokeColor: "#000", Opacity: 1, Width: legendDefaultRadius}},
+		},
+		{
+			name: "icons and labels, title from metadata",
+			style: `{"layers": [
+				{"id": "poi", "type": "symbol", "layout": {"icon-image": "pin", "text-field": "{name}"}},
+				{"id": "labels", "type": "symbol", "metadata": {"title": "Street names"}, "layout": {"text-field": "{name}"}, "paint": {"text-color": "#333"}}]}`,
+			want: []LegendItem{
+				{Title: "Poi", Kind: "icon", Color: legendDefaultColor, Opacity: 1},
+				{Title: "Street names", Kind: "text", Color: "#333", Opacity: 1},
+			},
+		},
+		{
+			name: "skip background, raster, hidden and duplicate layers",
+			style: `{"layers": [
+				{"id": "background", "type": "background", "paint": {"background-color": "#fff"}},
+				{"id": "aerial", "type": "raster"},
+				{"id": "hidden", "type": "line", "layout": {"visibility": "none"}},
+				{"id": "buildings", "type": "fill", "source-layer": "pand", "paint": {"fill-color": "#f00"}},
+				{"id": "buildings-outline", "type": "line", "source-layer": "pand", "paint": {"line-color": "#000"}}]}`,
+			want: []LegendItem{{Title: "Pand", Kind: "fill", Color: "#f00", Opacity: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legend, err := parseLegend("foo", "Foo", []byte(tt.style))
+			assert.NoError(t, err)
+			assert.Equal(t, "foo", legend.StyleID)
+			assert.Equal(t, tt.want, legend.Items)
+		})
+	}
+}
+
+func TestParseLegend_InvalidStyle(t *testing.T) {
+	_, err := parseLegend("foo", "Foo", []byte(`{"layers": "invalid"}`))
+	assert.Error(t, err)
+}
@@ -1,11 +1,14 @@
 package styles
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"slices"
 
 	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/engine/util"
+	"github.com/PDOK/gokoala/ogc/common/geospatial"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -13,85 +16,177 @@ import (
 const (
 	templatesDir = "ogc/styles/templates/"
 	stylesPath   = "/styles"
-	stylesCrumb  = "/styles"
 )
 
 type Styles struct {
-	engine *engine.Engine
+	engine    *engine.Engine
+	stylesDir string
+	storage   *objectStorage // only when stylesheets are stored in object storage
 }
 
-func NewStyles(e *engine.Engine, router *chi.Mux) *Styles {
+// collectionStyles the styles applicable to a single collection
+type collectionStyles struct {
+	CollectionID string
+	Default      string
+	Styles       []engine.StyleMetadata
+}
+
+func NewStyles(e *engine.Engine, router chi.Router) *Styles {
 	// default style must be the first entry in supportedstyles
 	if e.Config.OgcAPI.Styles.Default != e.Config.OgcAPI.Styles.SupportedStyles[0].ID {
 		log.Fatalf("default style must be first entry in supported styles. '%s' does not match '%s'", e.Config.OgcAPI.Styles.SupportedStyles[0].ID, e.Config.OgcAPI.Styles.Default)
 	}
 
-	stylesBreadcrumbs := []engine.Breadcrumb{
-		{
-			Name: "Styles",
-			Path: "styles",
-		},
+	if err := e.CN.RegisterFormat(engine.Format{Name: formatSVG, MediaType: engine.MediaTypeSVG, Extension: ".svg", Negotiable: true}); err != nil {
+		log.Fatalf("failed to register legend format: %v", err)
+	}
+
+	styles := &Styles{
+		engine:    e,
+		stylesDir: e.Config.OgcAPI.Styles.MapboxStylesPath,
+	}
+	if storageConfig := e.Config.OgcAPI.Styles.MapboxStylesStorage; storageConfig != nil {
+		storage, err := newObjectStorage(storageConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		styles.storage = storage
+		styles.stylesDir = storage.cacheDir
+		for _, style := range e.Config.OgcAPI.Styles.SupportedStyles {
+			for _, stylesheet := range style.Stylesheets {
+				if _, err = storage.fetch(styles.stylesheetFileName(style.ID, *stylesheet.Link.Format)); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
 	}
 
+	e.RegisterLocalizedRouteTitle(stylesPath, "Styles")
 	e.RenderTemplates(stylesPath,
-		stylesBreadcrumbs,
+		e.Breadcrumbs(stylesPath),
 		engine.NewTemplateKey(templatesDir+"styles.go.json"),
 		engine.NewTemplateKey(templatesDir+"styles.go.html"))
 
 	for _, style := range e.Config.OgcAPI.Styles.SupportedStyles {
+		stylePath := stylesPath + "/" + style.ID
+		e.RegisterRouteTitle(stylePath, styleTitle(style))
+		e.RegisterRouteTitle(stylePath+"/metadata", "Metadata")
+		e.RegisterLocalizedRouteTitle(stylePath+"/legend", "Legend")
+
 		// Render metadata templates
 		e.RenderTemplatesWithParams(style,
 			nil,
 			engine.NewTemplateKeyWithName(templatesDir+"styleMetadata.go.json", style.ID))
-		styleMetadataBreadcrumbs := stylesBreadcrumbs
-		styleMetadataBreadcrumbs = append(styleMetadataBreadcrumbs, []engine.Breadcrumb{
-			{
-				Name: style.Title,
-				Path: stylesCrumb + style.ID,
-			},
-			{
-				Name: "Metadata",
-				Path: stylesCrumb + style.ID + "/metadata",
-			},
-		}...)
 		e.RenderTemplatesWithParams(style,
-			styleMetadataBreadcrumbs,
+			e.Breadcrumbs(stylePath+"/metadata"),
 			engine.NewTemplateKeyWithName(templatesDir+"styleMetadata.go.html", style.ID))
 
 		// Add existing style definitions to rendered templates
 		for _, stylesheet := range style.Stylesheets {
-			formatExtension := e.CN.GetStyleFormatExtension(*stylesheet.Link.Format)
-			styleKey := engine.TemplateKey{
-				Name:         style.ID + formatExtension,
-				Directory:    e.Config.OgcAPI.Styles.MapboxStylesPath,
-				Format:       *stylesheet.Link.Format,
-				InstanceName: style.ID + "." + *stylesheet.Link.Format,
+			if err := styles.renderStylesheet(style, *stylesheet.Link.Format); err != nil {
+				log.Fatal(err)
 			}
-			e.RenderTemplatesWithParams(nil, nil, styleKey)
-			styleBreadCrumbs := stylesBreadcrumbs
-			styleBreadCrumbs = append(styleBreadCrumbs, []engine.Breadcrumb{
-				{
-					Name: style.Title,
-					Path: stylesCrumb + style.ID,
-				},
-			}...)
 			e.RenderTemplatesWithParams(style,
-				styleBreadCrumbs,
+				e.Breadcrumbs(stylePath),
 				engine.NewTemplateKeyWithName(templatesDir+"style.go.html", style.ID))
 		}
 	}
 
-	styles := &Styles{
-		engine: e,
+	for _, collectionID := range e.Config.OgcAPI.Styles.StyledCollections() {
+		renderCollectionStyles(e, collectionID)
+	}
+
+	if styles.storage != nil {
+		go styles.refreshPeriodically(e.Config.OgcAPI.Styles.GetRefreshInterval())
 	}
 
 	router.Get(stylesPath, styles.Styles())
 	router.Get(stylesPath+"/{style}", styles.Style())
 	router.Get(stylesPath+"/{style}/metadata", styles.StyleMetadata())
+	router.Get(stylesPath+"/{style}/legend", styles.Legend())
+	router.Get(geospatial.CollectionsPath+"/{collectionId}"+stylesPath, styles.CollectionStyles())
 
 	return styles
 }
 
+func styleTitle(style engine.StyleMetadata) string {
+	if style.Title == "" {
+		return style.ID
+	}
+	return style.Title
+}
+
+func (s *Styles) stylesheetFileName(styleID string, format string) string {
+	return styleID + s.engine.CN.GetStyleFormatExtension(format)
+}
+
+func (s *Styles) stylesheetKey(styleID string, format string) engine.TemplateKey {
+	return engine.TemplateKey{
+		Name:         s.stylesheetFileName(styleID, format),
+		Directory:    s.stylesDir,
+		Format:       format,
+		InstanceName: styleID + "." + format,
+	}
+}
+
+// renderStylesheet renders the stylesheet (in the given format) of the given style. Mapbox
+// styles are enriched (URLs, attribution) and used to generate the legend of the style.
+func (s *Styles) renderStylesheet(style engine.StyleMetadata, format string) error {
+	e := s.engine
+	styleKey := s.stylesheetKey(style.ID, format)
+	e.RenderTemplatesWithParams(nil, nil, styleKey)
+	if format != engine.FormatMapboxStyle {
+		return nil
+	}
+	err := updateStyle(e, styleKey, func(style []byte) ([]byte, error) {
+		return rewriteURLs(style, e.Config.BaseURL.String(), e.Config.OgcAPI.Styles.URLRewrites)
+	})
+	if err != nil {
+		return err
+	}
+	err = updateStyle(e, styleKey, func(style []byte) ([]byte, error) {
+		return addAttribution(style, e.Config.MapAttribution())
+	})
+	if err != nil {
+		return err
+	}
+	return renderLegend(e, style, styleTitle(style), stylesPath+"/"+style.ID, styleKey)
+}
+
+// updateStyle applies the given update to the rendered Mapbox style (in all languages)
+func updateStyle(e *engine.Engine, styleKey engine.TemplateKey, update func(style []byte) ([]byte, error)) error {
+	err := e.Templates.UpdateRenderedTemplate(styleKey, func(style []byte) ([]byte, error) {
+		result, err := update(style)
+		if err != nil {
+			return nil, err
+		}
+		return util.PrettyPrintJSON(result, styleKey.Name), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update style %s: %w", styleKey.Name, err)
+	}
+	return nil
+}
+
+// renderCollectionStyles renders the list of styles applicable to the given collection, the
+// first style in this list is the default style of the collection.
+func renderCollectionStyles(e *engine.Engine, collectionID string) {
+	params := collectionStyles{
+		CollectionID: collectionID,
+		Styles:       e.Config.OgcAPI.Styles.StylesForCollection(collectionID),
+	}
+	params.Default = params.Styles[0].ID
+
+	collectionStylesPath := geospatial.CollectionsPath + "/" + collectionID + stylesPath
+	e.RegisterLocalizedRouteTitle(collectionStylesPath, "Styles")
+	e.RenderTemplatesWithParams(params,
+		nil,
+		engine.NewTemplateKeyWithName(templatesDir+"collectionStyles.go.json", collectionID))
+	e.RenderTemplatesWithParams(params,
+		e.Breadcrumbs(collectionStylesPath),
+		engine.NewTemplateKeyWithName(templatesDir+"collectionStyles.go.html", collectionID))
+}
+
 func (s *Styles) Styles() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		key := engine.NewTemplateKeyWithLanguage(templatesDir+"styles.go."+s.engine.CN.NegotiateFormat(r), s.engine.CN.NegotiateLanguage(w, r))
@@ -108,20 +203,11 @@ func (s *Styles) Style() http.HandlerFunc {
 		if styleFormat == engine.FormatHTML {
 			key = engine.NewTemplateKeyWithNameAndLanguage(templatesDir+"style.go.html", styleID, s.engine.CN.NegotiateLanguage(w, r))
 		} else {
-			var instanceName string
-			if slices.Contains(s.engine.CN.GetSupportedStyleFormats(), styleFormat) {
-				instanceName = styleID + "." + styleFormat
-			} else {
-				styleFormat = "mapbox"
-				instanceName = styleID + ".mapbox"
-			}
-			key = engine.TemplateKey{
-				Name:         styleID + s.engine.CN.GetStyleFormatExtension(styleFormat),
-				Directory:    s.engine.Config.OgcAPI.Styles.MapboxStylesPath,
-				Format:       styleFormat,
-				InstanceName: instanceName,
-				Language:     s.engine.CN.NegotiateLanguage(w, r),
+			if !slices.Contains(s.engine.CN.GetSupportedStyleFormats(), styleFormat) {
+				styleFormat = engine.FormatMapboxStyle
 			}
+			key = s.stylesheetKey(styleID, styleFormat)
+			key.Language = s.engine.CN.NegotiateLanguage(w, r)
 		}
 		s.engine.ServePage(w, r, key)
 	}
@@ -134,3 +220,25 @@ func (s *Styles) StyleMetadata() http.HandlerFunc {
 		s.engine.ServePage(w, r, key)
 	}
 }
+
+// Legend serves the legend of the style as SVG image, or as HTML page when requested
+func (s *Styles) Legend() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		styleID := chi.URLParam(r, "style")
+		format := s.engine.CN.NegotiateFormat(r)
+		if format != engine.FormatHTML {
+			format = formatSVG
+		}
+		key := engine.NewTemplateKeyWithNameAndLanguage(templatesDir+"legend.go."+format, styleID, s.engine.CN.NegotiateLanguage(w, r))
+		s.engine.ServePage(w, r, key)
+	}
+}
+
+// CollectionStyles serves the styles applicable to a single collection
+func (s *Styles) CollectionStyles() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID := chi.URLParam(r, "collectionId")
+		key := engine.NewTemplateKeyWithNameAndLanguage(templatesDir+"collectionStyles.go."+s.engine.CN.NegotiateFormat(r), collectionID, s.engine.CN.NegotiateLanguage(w, r))
+		s.engine.ServePage(w, r, key)
+	}
+}
@@ -1,6 +1,8 @@
 package styles
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
@@ -80,3 +82,71 @@ func TestNewStyles(t *testing.T) {
 		})
 	}
 }
+
+func TestStyles_CollectionStyles(t *testing.T) {
+	tests := []struct {
+		name         string
+		collectionID string
+		format       string
+		wantStatus   int
+		wantBody     []string
+	}{
+		{
+			name:         "styles of collection as JSON",
+			collectionID: "buildings",
+			format:       "json",
+			wantStatus:   http.StatusOK,
+			wantBody:     []string{`"default": "buildings"`, `"id": "foo"`, `/collections/buildings?f=json`},
+		},
+		{
+			name:         "styles of collection as HTML",
+			collectionID: "roads",
+			format:       "html",
+			wantStatus:   http.StatusOK,
+			wantBody:     []string{"/styles/foo/metadata", "<b>Foo</b>"},
+		},
+		{
+			name:         "collection without styles",
+			collectionID: "water",
+			format:       "json",
+			wantStatus:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newEngine := engine.NewEngineWithConfig(&engine.Config{
+				Version:            "0.4.0",
+				Title:              "Test API",
+				Abstract:           "Test API description",
+				AvailableLanguages: []language.Tag{language.Dutch},
+				BaseURL:            engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "api.foobar.example", Path: "/"}},
+				OgcAPI: engine.OgcAPI{
+					Tiles: &engine.OgcAPITiles{
+						TileServer:   engine.YAMLURL{URL: &url.URL{Scheme: "https", Host: "tiles.foobar.example", Path: "/somedataset"}},
+						Types:        []string{"vector"},
+						SupportedSrs: []engine.SupportedSrs{{Srs: "EPSG:28992", ZoomLevelRange: engine.ZoomLevelRange{Start: 12, End: 12}}},
+						Collections:  engine.GeoSpatialCollections{{ID: "buildings"}, {ID: "roads"}, {ID: "water"}},
+					},
+					Styles: &engine.OgcAPIStyles{
+						Default: "buildings",
+						SupportedStyles: []engine.StyleMetadata{
+							{ID: "buildings", Title: "Buildings", Collections: []string{"buildings"}},
+							{ID: "foo", Title: "Foo", Collections: []string{"buildings", "roads"}},
+						},
+					},
+				},
+			}, "")
+			router := chi.NewRouter()
+			NewStyles(newEngine, router)
+
+			req := httptest.NewRequest(http.MethodGet, "https://api.foobar.example/collections/"+tt.collectionID+"/styles?f="+tt.format, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			for _, want := range tt.wantBody {
+				assert.Contains(t, rr.Body.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package styles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const objectStorageTimeout = 30 * time.Second
+
+// objectStorage keeps a local copy of the stylesheets stored in object storage, such as an S3 bucket or
+// Azure blob container. The etag of each stylesheet is kept, so unchanged stylesheets aren't downloaded again.
+type objectStorage struct {
+	store    engine.ObjectStore
+	cacheDir string
+	etags    map[string]string
+}
+
+func newObjectStorage(config *engine.ObjectStorage) (*objectStorage, error) {
+	store, err := engine.NewObjectStore(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure object storage for styles: %w", err)
+	}
+	cacheDir, err := os.MkdirTemp("", "gokoala-styles-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory for styles: %w", err)
+	}
+	return &objectStorage{
+		store:    store,
+		cacheDir: cacheDir,
+		etags:    make(map[string]string),
+	}, nil
+}
+
+// fetch downloads the given file from object storage into the local cache, returns
+// true when the file is new or has changed since the previous fetch.
+func (o *objectStorage) fetch(fileName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), objectStorageTimeout)
+	defer cancel()
+	object, err := o.store.Get(ctx, fileName, o.etags[fileName])
+	if errors.Is(err, engine.ErrObjectNotModified) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to fetch %s from object storage: %w", fileName, err)
+	}
+	o.etags[fileName] = object.ETag
+
+	cachedFile := filepath.Join(o.cacheDir, fileName)
+	if cached, err := os.ReadFile(cachedFile); err == nil && bytes.Equal(cached, object.Content) {
+		return false, nil
+	}
+	return true, os.WriteFile(cachedFile, object.Content, 0o600)
+}
+
+// refreshPeriodically checks object storage for changed stylesheets at the given interval
+func (s *Styles) refreshPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.refresh()
+	}
+}
+
+// refresh fetches the stylesheets from object storage and re-renders the ones that changed.
+// Errors are logged, the previously rendered stylesheet is kept in that case.
+func (s *Styles) refresh() {
+	for _, style := range s.engine.Config.OgcAPI.Styles.SupportedStyles {
+		for _, stylesheet := range style.Stylesheets {
+			format := *stylesheet.Link.Format
+			fileName := s.stylesheetFileName(style.ID, format)
+			changed, err := s.storage.fetch(fileName)
+			if err != nil {
+				log.Printf("failed to refresh stylesheet: %v", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if format == engine.FormatMapboxStyle {
+				content, err := os.ReadFile(filepath.Join(s.storage.cacheDir, fileName))
+				if err != nil || !json.Valid(content) {
+					log.Printf("stylesheet %s in object storage isn't valid JSON, keeping previous version", fileName)
+					continue
+				}
+			}
+			if err = s.renderStylesheet(style, format); err != nil {
+				log.Printf("failed to render refreshed stylesheet %s: %v", fileName, err)
+				continue
+			}
+			log.Printf("refreshed stylesheet %s from object storage", fileName)
+		}
+	}
+}
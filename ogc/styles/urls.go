@@ -0,0 +1,92 @@
+package styles
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+// rewriteURLs makes the URLs of the sources, sprite and glyphs in the given Mapbox style absolute
+// (relative to the given base URL) and applies the given rewrites. This way the same style can
+// be used in multiple environments (e.g. test, acceptance and production) without modification.
+func rewriteURLs(style []byte, baseURL string, rewrites []engine.URLRewrite) ([]byte, error) {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal(style, &parsed); err != nil {
+		return nil, err
+	}
+	// only the members containing URLs are decoded, other members (e.g. layers) are left as-is
+	for _, key := range []string{"glyphs", "sprite", "sources"} {
+		raw, ok := parsed[key]
+		if !ok {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		value = rewriteURLsInMember(key, value, baseURL, rewrites)
+		var err error
+		if parsed[key], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(parsed)
+}
+
+func rewriteURLsInMember(key string, value any, baseURL string, rewrites []engine.URLRewrite) any {
+	rewrite := func(value any) any {
+		if u, ok := value.(string); ok {
+			return rewriteURL(u, baseURL, rewrites)
+		}
+		return value
+	}
+	switch key {
+	case "sprite":
+		// either a single sprite or multiple, see https://docs.mapbox.com/style-spec/reference/root/#sprite
+		if sprites, ok := value.([]any); ok {
+			for _, sprite := range sprites {
+				if sprite, ok := sprite.(map[string]any); ok {
+					sprite["url"] = rewrite(sprite["url"])
+				}
+			}
+			return sprites
+		}
+	case "sources":
+		if sources, ok := value.(map[string]any); ok {
+			for _, source := range sources {
+				if source, ok := source.(map[string]any); ok {
+					rewriteURLsInSource(source, rewrite)
+				}
+			}
+			return sources
+		}
+	}
+	return rewrite(value)
+}
+
+func rewriteURLsInSource(source map[string]any, rewrite func(value any) any) {
+	for _, member := range []string{"url", "data"} {
+		if value, ok := source[member]; ok {
+			source[member] = rewrite(value)
+		}
+	}
+	if tiles, ok := source["tiles"].([]any); ok {
+		for i := range tiles {
+			tiles[i] = rewrite(tiles[i])
+		}
+	}
+}
+
+func rewriteURL(u string, baseURL string, rewrites []engine.URLRewrite) string {
+	if !strings.Contains(u, "://") && !strings.HasPrefix(u, "//") {
+		// relative URL
+		u = strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(u, "/")
+	}
+	for _, r := range rewrites {
+		if strings.HasPrefix(u, r.From) {
+			return r.To + strings.TrimPrefix(u, r.From)
+		}
+	}
+	return u
+}
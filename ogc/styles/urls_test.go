@@ -0,0 +1,45 @@
+package styles
+
+import (
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		style    string
+		rewrites []engine.URLRewrite
+		want     string
+	}{
+		{
+			name: "relative URLs",
+			style: `{"version":8,"sprite":"/resources/sprite","glyphs":"resources/fonts/{fontstack}/{range}.pbf",
+				"sources":{"a":{"type":"vector","tiles":["/tiles/NetherlandsRDNewQuad/{z}/{y}/{x}?f=mvt"]},"b":{"type":"vector","url":"tiles/WebMercatorQuad?f=tilejson"}},"layers":[]}`,
+			want: `{"version":8,"sprite":"https://api.example/dataset/resources/sprite","glyphs":"https://api.example/dataset/resources/fonts/{fontstack}/{range}.pbf",
+				"sources":{"a":{"type":"vector","tiles":["https://api.example/dataset/tiles/NetherlandsRDNewQuad/{z}/{y}/{x}?f=mvt"]},"b":{"type":"vector","url":"https://api.example/dataset/tiles/WebMercatorQuad?f=tilejson"}},"layers":[]}`,
+		},
+		{
+			name: "absolute URLs with rewrites",
+			style: `{"version":8,"sprite":[{"id":"default","url":"https://api.test.example/dataset/resources/sprite"}],"glyphs":"mapbox://fonts/{fontstack}/{range}.pbf",
+				"sources":{"a":{"type":"geojson","data":{"type":"FeatureCollection","features":[]}},"b":{"type":"geojson","data":"https://api.test.example/dataset/collections/foo/items"}},"layers":[]}`,
+			rewrites: []engine.URLRewrite{{From: "https://api.test.example/", To: "https://api.example/"}},
+			want: `{"version":8,"sprite":[{"id":"default","url":"https://api.example/dataset/resources/sprite"}],"glyphs":"mapbox://fonts/{fontstack}/{range}.pbf",
+				"sources":{"a":{"type":"geojson","data":{"type":"FeatureCollection","features":[]}},"b":{"type":"geojson","data":"https://api.example/dataset/collections/foo/items"}},"layers":[]}`,
+		},
+		{
+			name:  "style without URLs",
+			style: `{"version":8,"layers":[]}`,
+			want:  `{"version":8,"layers":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteURLs([]byte(tt.style), "https://api.example/dataset", tt.rewrites)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
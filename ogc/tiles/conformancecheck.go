@@ -0,0 +1,170 @@
+package tiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+
+	"github.com/PDOK/gokoala/engine"
+)
+
+const conformanceClassTilesCore = "http://www.opengis.net/spec/ogcapi-tiles-1/1.0/conf/core"
+
+// tileMatrixSetsBySrs the tile matrix sets (tiling schemes) supported by GoKoala, per SRS
+var tileMatrixSetsBySrs = map[string]string{
+	"EPSG:28992": "NetherlandsRDNewQuad",
+	"EPSG:3035":  "EuropeanETRS89_LAEAQuad",
+	"EPSG:3857":  "WebMercatorQuad",
+}
+
+// Discrepancy a deviation from the OGC API Tiles spec, found by CheckConformance
+type Discrepancy struct {
+	Check   string
+	URL     string
+	Message string
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("[%s] %s: %s", d.Check, d.URL, d.Message)
+}
+
+type tileMatrixLimits struct {
+	TileMatrix string `json:"tileMatrix"`
+	MinTileRow int    `json:"minTileRow"`
+	MaxTileRow int    `json:"maxTileRow"`
+	MinTileCol int    `json:"minTileCol"`
+	MaxTileCol int    `json:"maxTileCol"`
+}
+
+// CheckConformance runs smoke tests in the spirit of the OGC executable test suite (ETS) for
+// OGC API Tiles against the given handler, which should serve the API of the given config.
+// Tiles are requested from the configured tile server, so this also checks the tile backend:
+// tile matrix set limits, handling of empty tiles and media types. Useful before
+// submitting an API for certification. Returns the discrepancies found, if any.
+func CheckConformance(config *engine.Config, handler http.Handler) []Discrepancy {
+	c := &conformanceChecker{handler: handler}
+	c.checkConformanceDeclaration()
+	c.checkMetadata("tilesets-list", "/tiles?f=json")
+	for _, srs := range config.OgcAPI.Tiles.SupportedSrs {
+		tms, ok := tileMatrixSetsBySrs[srs.Srs]
+		if !ok {
+			c.report("tilematrixset", srs.Srs, "no tile matrix set available for this SRS")
+			continue
+		}
+		c.checkMetadata("tilematrixset", "/tileMatrixSets/"+tms+"?f=json")
+		limits := c.checkTileset(tms, srs.ZoomLevelRange)
+		if len(limits) > 0 {
+			c.checkTiles(tms, limits[0], srs.ZoomLevelRange)
+		}
+	}
+	return c.discrepancies
+}
+
+type conformanceChecker struct {
+	handler       http.Handler
+	discrepancies []Discrepancy
+}
+
+func (c *conformanceChecker) report(check string, url string, format string, args ...any) {
+	c.discrepancies = append(c.discrepancies, Discrepancy{Check: check, URL: url, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *conformanceChecker) get(url string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	c.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+	return rr
+}
+
+// checkMetadata the resource should be available as JSON, returns the response when it is
+func (c *conformanceChecker) checkMetadata(check string, url string) *httptest.ResponseRecorder {
+	rr := c.get(url)
+	if rr.Code != http.StatusOK {
+		c.report(check, url, "expected status %d, got %d", http.StatusOK, rr.Code)
+		return nil
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != engine.MediaTypeJSON {
+		c.report(check, url, "expected media type %s, got '%s'", engine.MediaTypeJSON, contentType)
+	}
+	return rr
+}
+
+func (c *conformanceChecker) checkConformanceDeclaration() {
+	url := "/conformance?f=json"
+	rr := c.checkMetadata("conformance", url)
+	if rr == nil {
+		return
+	}
+	var conformance struct {
+		ConformsTo []string `json:"conformsTo"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &conformance); err != nil {
+		c.report("conformance", url, "invalid JSON: %v", err)
+		return
+	}
+	if !slices.Contains(conformance.ConformsTo, conformanceClassTilesCore) {
+		c.report("conformance", url, "conformance class %s isn't declared", conformanceClassTilesCore)
+	}
+}
+
+// checkTileset the tileset metadata should declare limits for each configured zoom level
+func (c *conformanceChecker) checkTileset(tms string, zoomLevels engine.ZoomLevelRange) []tileMatrixLimits {
+	url := "/tiles/" + tms + "?f=json"
+	rr := c.checkMetadata("tileset", url)
+	if rr == nil {
+		return nil
+	}
+	var tileset struct {
+		TileMatrixSetLimits []tileMatrixLimits `json:"tileMatrixSetLimits"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &tileset); err != nil {
+		c.report("tileset", url, "invalid JSON: %v", err)
+		return nil
+	}
+	for zoom := zoomLevels.Start; zoom <= zoomLevels.End; zoom++ {
+		if !slices.ContainsFunc(tileset.TileMatrixSetLimits, func(limits tileMatrixLimits) bool {
+			return limits.TileMatrix == strconv.Itoa(zoom)
+		}) {
+			c.report("tileset", url, "no tile matrix set limits for configured zoom level %d", zoom)
+		}
+	}
+	return tileset.TileMatrixSetLimits
+}
+
+// checkTiles tiles within the limits should be served as Mapbox Vector Tiles or as empty tile
+// (204 without content), tiles outside the limits should result in a 404.
+func (c *conformanceChecker) checkTiles(tms string, limits tileMatrixLimits, zoomLevels engine.ZoomLevelRange) {
+	tileURL := func(tileMatrix string, tileRow int, tileCol int) string {
+		return fmt.Sprintf("/tiles/%s/%s/%d/%d?f=mvt", tms, tileMatrix, tileRow, tileCol)
+	}
+
+	url := tileURL(limits.TileMatrix, limits.MinTileRow, limits.MinTileCol)
+	rr := c.get(url)
+	switch rr.Code {
+	case http.StatusOK:
+		if contentType := rr.Header().Get("Content-Type"); contentType != engine.MediaTypeMVT {
+			c.report("tile", url, "expected media type %s, got '%s'", engine.MediaTypeMVT, contentType)
+		}
+	case http.StatusNoContent:
+		if rr.Body.Len() > 0 {
+			c.report("empty-tile", url, "expected no content for empty tile, got %d bytes", rr.Body.Len())
+		}
+	default:
+		c.report("tile", url, "expected status %d or %d for tile within limits, got %d",
+			http.StatusOK, http.StatusNoContent, rr.Code)
+	}
+
+	outsideLimits := []string{
+		tileURL(limits.TileMatrix, limits.MaxTileRow+1, limits.MinTileCol),
+		tileURL(limits.TileMatrix, limits.MinTileRow, limits.MaxTileCol+1),
+		tileURL(strconv.Itoa(zoomLevels.End+1), 0, 0),
+	}
+	for _, url = range outsideLimits {
+		if rr = c.get(url); rr.Code != http.StatusNotFound {
+			c.report("tile-matrix-limits", url, "expected status %d for tile outside limits, got %d",
+				http.StatusNotFound, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tiles
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/PDOK/gokoala/engine"
+	"github.com/PDOK/gokoala/ogc/common/core"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConformance(t *testing.T) {
+	tests := []struct {
+		name       string
+		tileServer http.HandlerFunc
+		wantChecks []string
+	}{
+		{
+			name: "tile server serves tiles",
+			tileServer: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/WebMercatorQuad/0/0/0.pbf" || r.URL.Path == "/NetherlandsRDNewQuad/0/0/0.pbf" {
+					engine.SafeWrite(w.Write, []byte("tile"))
+					return
+				}
+				http.NotFound(w, r)
+			},
+			// tiles outside the limits are proxied to the tile server, which results in an empty tile (204)
+			wantChecks: []string{"tile-matrix-limits"},
+		},
+		{
+			name: "tile server fails",
+			tileServer: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "failed", http.StatusInternalServerError)
+			},
+			wantChecks: []string{"tile", "tile-matrix-limits"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := createTileServer(tt.tileServer)
+			defer ts.Close()
+
+			newEngine := engine.NewEngine("ogc/tiles/testdata/config_tiles_collections.yaml", "")
+			router := chi.NewRouter()
+			core.NewCommonCore(newEngine, router)
+			NewTiles(newEngine, router)
+
+			discrepancies := CheckConformance(newEngine.Config, router)
+
+			var checks []string
+			for _, discrepancy := range discrepancies {
+				if !slices.Contains(checks, discrepancy.Check) {
+					checks = append(checks, discrepancy.Check)
+				}
+			}
+			assert.Equal(t, tt.wantChecks, checks, discrepancies)
+		})
+	}
+}
+
+func createTileServer(handler http.HandlerFunc) *httptest.Server {
+	l, err := net.Listen("tcp", "localhost:9090")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	return ts
+}
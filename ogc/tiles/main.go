@@ -1,6 +1,7 @@
 package tiles
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
@@ -24,32 +25,33 @@ type Tiles struct {
 	engine *engine.Engine
 }
 
-func NewTiles(e *engine.Engine, router *chi.Mux) *Tiles {
-	tilesBreadcrumbs := []engine.Breadcrumb{
-		{
-			Name: "Tiles",
-			Path: "tiles",
-		},
-	}
-	tileMatrixSetsBreadcrumbs := []engine.Breadcrumb{
-		{
-			Name: "Tile Matrix Sets",
-			Path: "tileMatrixSets",
-		},
-	}
+func NewTiles(e *engine.Engine, router chi.Router) *Tiles {
+	e.RegisterLocalizedRouteTitle(tilesPath, "Tiles")
+	e.RegisterLocalizedRouteTitle(tileMatrixSetsPath, "TileMatrixSets")
 
 	e.RenderTemplates(tilesPath,
-		tilesBreadcrumbs,
+		e.Breadcrumbs(tilesPath),
 		engine.NewTemplateKey(templatesDir+"tiles.go.json"),
 		engine.NewTemplateKey(templatesDir+"tiles.go.html"))
 	e.RenderTemplates(tileMatrixSetsPath,
-		tileMatrixSetsBreadcrumbs,
+		e.Breadcrumbs(tileMatrixSetsPath),
 		engine.NewTemplateKey(templatesDir+"tileMatrixSets.go.json"),
 		engine.NewTemplateKey(templatesDir+"tileMatrixSets.go.html"))
 
-	renderTemplatesForSrs(e, "EuropeanETRS89_LAEAQuad", tilesBreadcrumbs, tileMatrixSetsBreadcrumbs)
-	renderTemplatesForSrs(e, "NetherlandsRDNewQuad", tilesBreadcrumbs, tileMatrixSetsBreadcrumbs)
-	renderTemplatesForSrs(e, "WebMercatorQuad", tilesBreadcrumbs, tileMatrixSetsBreadcrumbs)
+	renderTemplatesForSrs(e, "EuropeanETRS89_LAEAQuad")
+	renderTemplatesForSrs(e, "NetherlandsRDNewQuad")
+	renderTemplatesForSrs(e, "WebMercatorQuad")
+
+	for _, coll := range e.Config.OgcAPI.Tiles.Collections {
+		collectionTilesPath := geospatial.CollectionsPath + "/" + coll.ID + tilesPath
+		e.RegisterLocalizedRouteTitle(collectionTilesPath, "Tiles")
+		e.RenderTemplatesWithParams(coll,
+			nil,
+			engine.NewTemplateKeyWithName(templatesDir+"collectionTiles.go.json", coll.ID))
+		e.RenderTemplatesWithParams(coll,
+			e.Breadcrumbs(collectionTilesPath),
+			engine.NewTemplateKeyWithName(templatesDir+"collectionTiles.go.html", coll.ID))
+	}
 
 	_, err := url.ParseRequestURI(e.Config.OgcAPI.Tiles.TileServer.String())
 	if err != nil {
@@ -64,27 +66,23 @@ func NewTiles(e *engine.Engine, router *chi.Mux) *Tiles {
 	router.Get(tilesPath, tiles.TilesetsList())
 	router.Get(tilesPath+"/{tileMatrixSetId}", tiles.Tileset())
 	router.Head(tilesPath+"/{tileMatrixSetId}/{tileMatrix}/{tileRow}/{tileCol}", tiles.Tile())
-	router.Get(tilesPath+"/{tileMatrixSetId}/{tileMatrix}/{tileRow}/{tileCol}", tiles.Tile())
+	// identical concurrent tile requests share a single request to the tile server
+	router.With(engine.NewRequestCoalescer(e.CN).Coalesce).Get(tilesPath+"/{tileMatrixSetId}/{tileMatrix}/{tileRow}/{tileCol}", tiles.Tile())
 	router.Get(geospatial.CollectionsPath+"/{collectionId}/tiles", tiles.CollectionContent())
+	if e.Config.OgcAPI.Tiles.URITemplateCollectionTiles != nil {
+		collectionTilePath := geospatial.CollectionsPath + "/{collectionId}" + tilesPath + "/{tileMatrixSetId}/{tileMatrix}/{tileRow}/{tileCol}"
+		router.Head(collectionTilePath, tiles.CollectionTile())
+		router.With(engine.NewRequestCoalescer(e.CN).Coalesce).Get(collectionTilePath, tiles.CollectionTile())
+	}
 
 	return tiles
 }
 
-func renderTemplatesForSrs(e *engine.Engine, srs string, tilesBreadcrumbs []engine.Breadcrumb, tileMatrixSetsBreadcrumbs []engine.Breadcrumb) {
-	tilesSrsBreadcrumbs := tilesBreadcrumbs
-	tilesSrsBreadcrumbs = append(tilesSrsBreadcrumbs, []engine.Breadcrumb{
-		{
-			Name: srs,
-			Path: tilesLocalPath + srs,
-		},
-	}...)
-	tileMatrixSetsSrsBreadcrumbs := tileMatrixSetsBreadcrumbs
-	tileMatrixSetsSrsBreadcrumbs = append(tileMatrixSetsSrsBreadcrumbs, []engine.Breadcrumb{
-		{
-			Name: srs,
-			Path: tileMatrixSetsLocalPath + srs,
-		},
-	}...)
+func renderTemplatesForSrs(e *engine.Engine, srs string) {
+	e.RegisterRouteTitle(tilesLocalPath+srs, srs)
+	e.RegisterRouteTitle(tileMatrixSetsLocalPath+srs, srs)
+	tilesSrsBreadcrumbs := e.Breadcrumbs(tilesLocalPath + srs)
+	tileMatrixSetsSrsBreadcrumbs := e.Breadcrumbs(tileMatrixSetsLocalPath + srs)
 
 	e.RenderTemplates(tileMatrixSetsPath+"/"+srs,
 		tileMatrixSetsSrsBreadcrumbs,
@@ -133,47 +131,79 @@ func (t *Tiles) Tileset() http.HandlerFunc {
 
 // Tile reverse proxy to Azure Blob, assumes blob bucket/container is public
 func (t *Tiles) Tile() http.HandlerFunc {
+	tilesTmpl := defaultTilesTmpl
+	if t.engine.Config.OgcAPI.Tiles.URITemplateTiles != nil {
+		tilesTmpl = *t.engine.Config.OgcAPI.Tiles.URITemplateTiles
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		tileMatrixSetID := chi.URLParam(r, "tileMatrixSetId")
-		tileMatrix := chi.URLParam(r, "tileMatrix")
-		tileRow := chi.URLParam(r, "tileRow")
-		tileCol := chi.URLParam(r, "tileCol")
-
-		// We support content negotiation using Accept header and ?f= param, but also
-		// using the .pbf extension. This is for backwards compatibility.
-		if !strings.HasSuffix(tileCol, ".pbf") {
-			if t.engine.CN.NegotiateFormat(r) != "mvt" {
-				http.Error(w, "Specify tile format. Currently only"+
-					" Mapbox Vector Tiles (?f=mvt) tiles are supported", http.StatusBadRequest)
-				return
-			}
-		} else {
-			tileCol = tileCol[:len(tileCol)-4] // remove .pbf extension
-		}
+		t.proxyTile(w, r, tilesTmpl, "")
+	}
+}
 
-		// ogc spec is (default) z/row/col but tileserver is z/col/row (z/x/y)
-		replacer := strings.NewReplacer("{tms}", tileMatrixSetID, "{z}", tileMatrix, "{x}", tileCol, "{y}", tileRow)
-		tilesTmpl := defaultTilesTmpl
-		if t.engine.Config.OgcAPI.Tiles.URITemplateTiles != nil {
-			tilesTmpl = *t.engine.Config.OgcAPI.Tiles.URITemplateTiles
+// CollectionTile reverse proxy to a tile containing only the given collection, using uriTemplateCollectionTiles
+func (t *Tiles) CollectionTile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID := chi.URLParam(r, "collectionId")
+		if !t.engine.Config.OgcAPI.Tiles.Collections.ContainsID(collectionID) {
+			engine.RenderError(w, r, engine.NotFound(fmt.Sprintf("collection %s doesn't exist or has no tiles", collectionID)))
+			return
 		}
-		path, _ := url.JoinPath("/", replacer.Replace(tilesTmpl))
+		t.proxyTile(w, r, *t.engine.Config.OgcAPI.Tiles.URITemplateCollectionTiles, collectionID)
+	}
+}
 
-		target, err := url.Parse(t.engine.Config.OgcAPI.Tiles.TileServer.String() + path)
-		if err != nil {
-			log.Printf("invalid target url, can't proxy tiles: %v", err)
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+func (t *Tiles) proxyTile(w http.ResponseWriter, r *http.Request, tilesTmpl string, collectionID string) {
+	tileMatrixSetID := chi.URLParam(r, "tileMatrixSetId")
+	tileMatrix := chi.URLParam(r, "tileMatrix")
+	tileRow := chi.URLParam(r, "tileRow")
+	tileCol := chi.URLParam(r, "tileCol")
+
+	// We support content negotiation using Accept header and ?f= param, but also
+	// using the .pbf extension. This is for backwards compatibility.
+	if !strings.HasSuffix(tileCol, ".pbf") {
+		if t.engine.CN.NegotiateFormat(r) != "mvt" {
+			engine.RenderError(w, r, engine.BadRequest("Specify tile format. Currently only"+
+				" Mapbox Vector Tiles (?f=mvt) tiles are supported"))
 			return
 		}
-		t.engine.ReverseProxy(w, r, target, true, engine.MediaTypeMVT)
+	} else {
+		tileCol = tileCol[:len(tileCol)-4] // remove .pbf extension
+	}
+
+	// ogc spec is (default) z/row/col but tileserver is z/col/row (z/x/y)
+	replacer := strings.NewReplacer("{tms}", tileMatrixSetID, "{z}", tileMatrix, "{x}", tileCol, "{y}", tileRow,
+		"{collection}", collectionID)
+	path, _ := url.JoinPath("/", replacer.Replace(tilesTmpl))
+
+	target, err := url.Parse(t.engine.Config.OgcAPI.Tiles.TileServer.String() + path)
+	if err != nil {
+		engine.RenderError(w, r, engine.InternalError("invalid target url, can't proxy tiles", err))
+		return
 	}
+	target.RawQuery = t.upstreamQuery(r.URL.Query()).Encode()
+	t.engine.ReverseProxy(w, r, target, true, engine.MediaTypeMVT)
 }
 
+// upstreamQuery query params of the tile request which are allowed to be passed on to the tileserver
+func (t *Tiles) upstreamQuery(query url.Values) url.Values {
+	passthrough := t.engine.Config.OgcAPI.Tiles.QueryPassthrough
+	result := url.Values{}
+	for param, values := range query {
+		// the format param is meant for GoKoala, not the tileserver
+		if param != engine.FormatParam && passthrough.Allows(param) {
+			result[param] = values
+		}
+	}
+	return result
+}
+
+// CollectionContent tilesets of a collection. Tiles contain all collections of the dataset (each
+// collection as a separate layer), so these are the tilesets of the dataset.
 func (t *Tiles) CollectionContent(_ ...any) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		collectionID := chi.URLParam(r, "collectionId")
 
-		// TODO: not implemented, since we don't (yet) support tile collections
-		log.Printf("TODO: return tiles for collection %s", collectionID)
+		key := engine.NewTemplateKeyWithNameAndLanguage(templatesDir+"collectionTiles.go."+t.engine.CN.NegotiateFormat(r), collectionID, t.engine.CN.NegotiateLanguage(w, r))
+		t.engine.ServePage(w, r, key)
 	}
 }
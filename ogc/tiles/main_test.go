@@ -169,7 +169,7 @@ func TestTiles_Tile(t *testing.T) {
 				tileCol:         "15",
 			},
 			want: want{
-				body:       "Specify tile format. Currently only Mapbox Vector Tiles (?f=mvt) tiles are supported\n",
+				body:       `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Specify tile format. Currently only Mapbox Vector Tiles (?f=mvt) tiles are supported"}`,
 				statusCode: http.StatusBadRequest,
 			},
 		},
@@ -332,6 +332,18 @@ func TestTile_Tileset(t *testing.T) {
 				statusCode:   http.StatusOK,
 			},
 		},
+		{
+			name: "WebMercatorQuad with collections as layers",
+			fields: fields{
+				configFile:      "ogc/tiles/testdata/config_tiles_collections.yaml",
+				url:             "http://localhost:8080/tiles/WebMercatorQuad?f=json",
+				tileMatrixSetID: "WebMercatorQuad",
+			},
+			want: want{
+				bodyContains: "\"id\": \"buildings\"",
+				statusCode:   http.StatusOK,
+			},
+		},
 		{
 			name: "Invalid",
 			fields: fields{
@@ -340,7 +352,7 @@ func TestTile_Tileset(t *testing.T) {
 				tileMatrixSetID: "Invalid",
 			},
 			want: want{
-				bodyContains: "request doesn't conform to OpenAPI spec: parameter \"tileMatrixSetId\" in path has an error: value is not one of the allowed values",
+				bodyContains: `request doesn't conform to OpenAPI spec: parameter \"tileMatrixSetId\" in path has an error: value is not one of the allowed values`,
 				statusCode:   http.StatusBadRequest,
 			},
 		},
@@ -424,7 +436,7 @@ func TestTile_TilematrixSet(t *testing.T) {
 				tileMatrixSetID: "Invalid",
 			},
 			want: want{
-				bodyContains: "request doesn't conform to OpenAPI spec: parameter \"tileMatrixSetId\" in path has an error: value is not one of the allowed values",
+				bodyContains: `request doesn't conform to OpenAPI spec: parameter \"tileMatrixSetId\" in path has an error: value is not one of the allowed values`,
 				statusCode:   http.StatusBadRequest,
 			},
 		},
@@ -517,6 +529,149 @@ func TestTile_TilematrixSets(t *testing.T) {
 	}
 }
 
+func TestTiles_CollectionTile(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		collectionID   string
+		tileCol        string
+		wantBody       string
+		wantStatusCode int
+	}{
+		{
+			name:           "tile of collection",
+			url:            "http://localhost:8080/collections/buildings/tiles/NetherlandsRDNewQuad/5/10/15?f=mvt",
+			collectionID:   "buildings",
+			tileCol:        "15",
+			wantBody:       "/buildings/NetherlandsRDNewQuad/5/15/10.pbf",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "tile of collection with .pbf extension",
+			url:            "http://localhost:8080/collections/roads/tiles/NetherlandsRDNewQuad/5/10/15.pbf",
+			collectionID:   "roads",
+			tileCol:        "15.pbf",
+			wantBody:       "/roads/NetherlandsRDNewQuad/5/15/10.pbf",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "pass on allowed query params, except denied ones",
+			url:            "http://localhost:8080/collections/buildings/tiles/NetherlandsRDNewQuad/5/10/15?f=mvt&datetime=2023-01-01&token=secret",
+			collectionID:   "buildings",
+			tileCol:        "15",
+			wantBody:       "/buildings/NetherlandsRDNewQuad/5/15/10.pbf?datetime=2023-01-01",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "unknown collection",
+			url:            "http://localhost:8080/collections/foo/tiles/NetherlandsRDNewQuad/5/10/15?f=mvt",
+			collectionID:   "foo",
+			tileCol:        "15",
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createTileRequest(tt.url, "NetherlandsRDNewQuad", "5", "10", tt.tileCol)
+			if err != nil {
+				log.Fatal(err)
+			}
+			rctx := chi.RouteContext(req.Context())
+			rctx.URLParams.Add("collectionId", tt.collectionID)
+			rr, ts := createMockServer()
+			defer ts.Close()
+
+			newEngine := engine.NewEngine("ogc/tiles/testdata/config_tiles_collections.yaml", "")
+			tiles := NewTiles(newEngine, chi.NewRouter())
+			handler := tiles.CollectionTile()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTiles_CollectionContent(t *testing.T) {
+	type fields struct {
+		configFile   string
+		url          string
+		collectionID string
+	}
+	type want struct {
+		bodyContains []string
+		statusCode   int
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   want
+	}{
+		{
+			name: "tilesets of collection as JSON",
+			fields: fields{
+				configFile:   "ogc/tiles/testdata/config_tiles_collections.yaml",
+				url:          "http://localhost:8080/collections/buildings/tiles?f=json",
+				collectionID: "buildings",
+			},
+			want: want{
+				bodyContains: []string{
+					`"title": "Buildings - Tiles"`,
+					`"href": "http://localhost:8080/tiles/WebMercatorQuad?f=json"`,
+					`"href": "http://localhost:8080/tileMatrixSets/NetherlandsRDNewQuad"`,
+					`"crs": "https://www.opengis.net/def/crs/EPSG/0/28992"`,
+				},
+				statusCode: http.StatusOK,
+			},
+		},
+		{
+			name: "tilesets of collection as HTML",
+			fields: fields{
+				configFile:   "ogc/tiles/testdata/config_tiles_collections.yaml",
+				url:          "http://localhost:8080/collections/roads/tiles?f=html",
+				collectionID: "roads",
+			},
+			want: want{
+				bodyContains: []string{"<code>roads</code>", "/tiles/NetherlandsRDNewQuad"},
+				statusCode:   http.StatusOK,
+			},
+		},
+		{
+			name: "unknown collection",
+			fields: fields{
+				configFile:   "ogc/tiles/testdata/config_tiles_collections.yaml",
+				url:          "http://localhost:8080/collections/foo/tiles?f=json",
+				collectionID: "foo",
+			},
+			want: want{
+				statusCode: http.StatusNotFound,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := createCollectionTilesRequest(tt.fields.url, tt.fields.collectionID)
+			if err != nil {
+				log.Fatal(err)
+			}
+			rr, ts := createMockServer()
+			defer ts.Close()
+
+			newEngine := engine.NewEngine(tt.fields.configFile, "")
+			tiles := NewTiles(newEngine, chi.NewRouter())
+			handler := tiles.CollectionContent()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.want.statusCode, rr.Code)
+			for _, expected := range tt.want.bodyContains {
+				assert.Contains(t, rr.Body.String(), expected)
+			}
+		})
+	}
+}
+
 func createMockServer() (*httptest.ResponseRecorder, *httptest.Server) {
 	rr := httptest.NewRecorder()
 	l, err := net.Listen("tcp", "localhost:9090")
@@ -577,3 +732,12 @@ func createTilematrixSetsRequest(url string) (*http.Request, error) {
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
 	return req, err
 }
+
+func createCollectionTilesRequest(url string, collectionID string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("collectionId", collectionID)
+
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	return req, err
+}
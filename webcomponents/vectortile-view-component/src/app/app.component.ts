@@ -97,6 +97,7 @@ export class AppComponent implements OnChanges {
 
   @Input() tileUrl: string = NetherlandsRDNewQuadDefault;
   @Input() styleUrl!: string;
+  @Input() attribution: string | undefined;
   @Input() id!: string | undefined;
 
   @Input()
@@ -386,6 +387,7 @@ export class AppComponent implements OnChanges {
       projection: projection,
       tileGrid: this.tileGrid,
       url: url + this.xyzselector,
+      attributions: this.attribution,
       cacheSize: 0,
     });
     source.on(['tileloadend'], e => {